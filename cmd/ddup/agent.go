@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/italypaleale/go-kit/servicerunner"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/utils"
+)
+
+// runAgent runs ddup as a remote checker agent, which only performs health checks and reports the results to a central instance
+// This call blocks until the context is canceled
+func runAgent(ctx context.Context, log *slog.Logger, cfg *config.Config, metrics *appmetrics.AppMetrics, shutdowns *shutdownManager) {
+	agent, err := healthcheck.NewAgent(cfg, metrics)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to init agent", err)
+		return
+	}
+
+	log.Info("Running as remote checker agent", "central", cfg.Agent.URL)
+
+	err = servicerunner.
+		NewServiceRunner(agent.Run).
+		Run(ctx)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to run agent", err)
+		return
+	}
+
+	shutdowns.Run(log)
+}
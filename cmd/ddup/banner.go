@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// logStartupSummary logs a structured summary of the configuration in effect
+// This makes it easier to understand how ddup is configured when troubleshooting
+func logStartupSummary(log *slog.Logger, cfg *config.Config) {
+	var (
+		endpoints       int
+		weighted        int
+		cname           int
+		ipv6Prefix      int
+		ipFrom          int
+		maintenanceWins int
+	)
+	for _, d := range cfg.Domains {
+		endpoints += len(d.Endpoints)
+		switch d.RoutingPolicy {
+		case config.RoutingPolicyWeighted:
+			weighted++
+		case config.RoutingPolicyCNAME:
+			cname++
+		}
+		if d.IPv6Prefix != nil {
+			ipv6Prefix++
+		}
+		for _, e := range d.Endpoints {
+			if e.IPFrom != "" {
+				ipFrom++
+			}
+		}
+	}
+
+	// List the providers with their type, sorted by name
+	providers := make([]string, 0, len(cfg.Providers))
+	for _, name := range slices.Sorted(maps.Keys(cfg.Providers)) {
+		p := cfg.Providers[name]
+		providers = append(providers, name+" ("+p.Type()+")")
+		maintenanceWins += len(p.MaintenanceWindows)
+	}
+
+	log.Info("Configuration summary",
+		slog.String("configFile", cfg.GetLoadedConfigPath()),
+		slog.Duration("interval", cfg.Interval),
+		slog.Duration("jitter", cfg.Jitter),
+		slog.Duration("reconcileInterval", cfg.ReconcileInterval),
+		slog.Int("maxConcurrentChecks", cfg.MaxConcurrentChecks),
+		slog.String("stateFile", cfg.StateFile),
+		slog.Bool("heartbeat", cfg.Heartbeat.URL != ""),
+		slog.Int("domains", len(cfg.Domains)),
+		slog.Int("endpoints", endpoints),
+		slog.Any("providers", providers),
+		slog.Group("server",
+			slog.Bool("enabled", cfg.Server.Enabled),
+			slog.Any("bind", []string(cfg.Server.Bind)),
+			slog.Int("port", cfg.Server.Port),
+			slog.Bool("adminAPI", len(cfg.Server.APITokens) > 0),
+			slog.Bool("readOnlyAPI", len(cfg.Server.ReadOnlyAPITokens) > 0),
+			slog.Bool("acme", cfg.Server.ACME != nil),
+			slog.Bool("dashboardAuth", cfg.Server.DashboardAuth != nil),
+		),
+		slog.Group("logs",
+			slog.String("level", cfg.Logs.Level),
+			slog.Any("levels", cfg.Logs.Levels),
+			slog.Bool("json", cfg.Logs.JSON),
+			slog.Bool("syslog", cfg.Logs.Syslog != nil),
+			slog.Bool("journald", cfg.Logs.Journald),
+		),
+		slog.Group("features",
+			slog.Bool("watchConfigFile", cfg.WatchConfigFile),
+			slog.Int("weightedDomains", weighted),
+			slog.Int("cnameDomains", cname),
+			slog.Int("ipv6PrefixDomains", ipv6Prefix),
+			slog.Int("ipFromEndpoints", ipFrom),
+			slog.Int("maintenanceWindows", maintenanceWins),
+		),
+	)
+}
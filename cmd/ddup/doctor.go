@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+	"github.com/italypaleale/ddup/pkg/signals"
+)
+
+const (
+	// Timeout for each query sent to authoritative name servers by the "doctor" command
+	doctorDNSTimeout = 5 * time.Second
+	// Clock skew above which the "doctor" command reports a warning
+	doctorMaxClockSkew = 10 * time.Second
+)
+
+// Status of each check in the report of the "doctor" command
+const (
+	doctorOK   = "OK"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+	doctorSkip = "SKIP"
+)
+
+// clockSkewProvider is implemented by providers that can measure the difference between the local clock and the time of their API
+type clockSkewProvider interface {
+	ClockSkew(ctx context.Context) (time.Duration, error)
+}
+
+// doctorReport prints the results of the checks performed by the "doctor" command, and counts failures and warnings
+type doctorReport struct {
+	w        io.Writer
+	failed   int
+	warnings int
+}
+
+// section prints the title of a section of the report
+func (r *doctorReport) section(title string) {
+	fmt.Fprintln(r.w, "\n"+title)
+}
+
+// result prints the result of a check, indented by level
+func (r *doctorReport) result(level int, status string, format string, args ...any) {
+	switch status {
+	case doctorFail:
+		r.failed++
+	case doctorWarn:
+		r.warnings++
+	}
+	fmt.Fprintf(r.w, "%s[%s] %s\n", strings.Repeat("  ", level), status, fmt.Sprintf(format, args...))
+}
+
+// runDoctor checks the configuration, the DNS providers, the clock, the health checks of the endpoints, and the records served by the authoritative name servers, and prints a report
+// The process exits with code 1 if some checks failed
+func runDoctor(log *slog.Logger, cfg *config.Config, shutdowns *shutdownManager) {
+	ctx := signals.SignalContext(context.Background())
+	r := &doctorReport{w: os.Stdout}
+
+	doctorChecks(ctx, r, cfg, shutdowns)
+	fmt.Fprintf(r.w, "\nSummary: %d failed, %d warnings\n", r.failed, r.warnings)
+
+	shutdowns.Run(log)
+
+	if r.failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// doctorChecks performs the checks of the "doctor" command and prints their results
+// If the configuration is invalid, or the DNS providers can't be initialized, the other checks are not performed
+func doctorChecks(ctx context.Context, r *doctorReport, cfg *config.Config, shutdowns *shutdownManager) {
+	r.section("Configuration")
+	err := cfg.Validate(logger())
+	if err != nil {
+		r.result(1, doctorFail, "Configuration is invalid: %v", err)
+		return
+	}
+	r.result(1, doctorOK, "Configuration is valid")
+
+	shutdowns.Add(dns.StopPlugins)
+	dnsProviders, err := initDNSProviders(cfg, nil)
+	if err != nil {
+		r.result(1, doctorFail, "Failed to init DNS providers: %v", err)
+		return
+	}
+
+	r.section("DNS providers")
+	results := dns.VerifyCredentials(ctx, dnsProviders)
+	for _, name := range slices.Sorted(maps.Keys(dnsProviders)) {
+		err, verified := results[name]
+		switch {
+		case !verified:
+			r.result(1, doctorSkip, "%s: the provider doesn't support verifying credentials", name)
+		case err != nil:
+			r.result(1, doctorFail, "%s: %v", name, err)
+		default:
+			r.result(1, doctorOK, "%s: credentials are valid", name)
+		}
+	}
+
+	r.section("Clock")
+	doctorClockSkew(ctx, r, dnsProviders)
+
+	hc, err := healthcheck.NewHealthChecker(cfg, dnsProviders, nil, nil, nil)
+	if err != nil {
+		r.result(1, doctorFail, "Failed to init health checker: %v", err)
+		return
+	}
+	plans := hc.Plan(ctx)
+
+	r.section("Health checks")
+	for _, domain := range slices.Sorted(maps.Keys(plans)) {
+		fmt.Fprintln(r.w, "  "+domain)
+		plan := plans[domain]
+		for _, ep := range plan.Endpoints {
+			label := ep.Address
+			if ep.Name != "" {
+				label = ep.Name + " (" + ep.Address + ")"
+			}
+			switch {
+			case !ep.Healthy:
+				r.result(2, doctorFail, "%s: %s", label, ep.Error)
+			case ep.Degraded:
+				r.result(2, doctorWarn, "%s: latency exceeds the maximum", label)
+			default:
+				r.result(2, doctorOK, "%s", label)
+			}
+		}
+		if plan.Error != "" {
+			r.result(2, doctorFail, "%s", plan.Error)
+		}
+	}
+
+	r.section("Authoritative DNS")
+	for _, domain := range slices.Sorted(maps.Keys(plans)) {
+		plan := plans[domain]
+		switch {
+		case plan.Skipped != "":
+			fmt.Fprintln(r.w, "  "+domain)
+			r.result(2, doctorSkip, "Records would not be updated: %s", plan.Skipped)
+			continue
+		case plan.Error != "":
+			continue
+		}
+		for _, rp := range plan.Records {
+			fmt.Fprintf(r.w, "  %s %s\n", rp.Name, rp.RecordType)
+			doctorAuthoritativeDNS(ctx, r, rp)
+		}
+	}
+}
+
+// doctorClockSkew checks the difference between the local clock and the time of the APIs of the providers that can measure it
+// This is important for providers such as OVH, which sign requests with the current time
+func doctorClockSkew(ctx context.Context, r *doctorReport, dnsProviders map[string]dns.Provider) {
+	var checked bool
+	for _, name := range slices.Sorted(maps.Keys(dnsProviders)) {
+		p, ok := dnsProviders[name].(clockSkewProvider)
+		if !ok {
+			continue
+		}
+		checked = true
+
+		skew, err := p.ClockSkew(ctx)
+		switch {
+		case err != nil:
+			r.result(1, doctorFail, "%s: failed to measure the clock skew: %v", name, err)
+		case skew.Abs() > doctorMaxClockSkew:
+			r.result(1, doctorWarn, "%s: the clock of this system differs from the time of the API by %v", name, skew.Round(time.Millisecond))
+		default:
+			r.result(1, doctorOK, "%s: clock skew is %v", name, skew.Round(time.Millisecond))
+		}
+	}
+
+	if !checked {
+		r.result(1, doctorSkip, "No provider requires an accurate clock")
+	}
+}
+
+// doctorAuthoritativeDNS queries the authoritative name servers for the records, and compares them with the desired records
+// Differences are reported as warnings, because changes take time to propagate to all name servers
+func doctorAuthoritativeDNS(ctx context.Context, r *doctorReport, rp healthcheck.RecordsPlan) {
+	nameServers, err := lookupAuthoritativeNS(ctx, rp.Name)
+	if err != nil {
+		r.result(2, doctorFail, "Failed to find the authoritative name servers: %v", err)
+		return
+	}
+
+	desired := slices.Sorted(slices.Values(rp.Desired))
+	for _, ns := range nameServers {
+		values, err := lookupAuthoritative(ctx, ns, rp.Name, rp.RecordType)
+		switch {
+		case err != nil:
+			r.result(2, doctorFail, "%s: %v", ns, err)
+		case !slices.Equal(values, desired):
+			r.result(2, doctorWarn, "%s: %s (desired: %s)", ns, formatValues(values), formatValues(desired))
+		default:
+			r.result(2, doctorOK, "%s: %s", ns, formatValues(values))
+		}
+	}
+}
+
+// lookupAuthoritativeNS returns the name servers of the zone that contains the name, looking for NS records of the name and its parents
+func lookupAuthoritativeNS(ctx context.Context, name string) ([]string, error) {
+	name = strings.TrimSuffix(name, ".")
+	for zone := name; strings.Contains(zone, "."); {
+		records, err := net.DefaultResolver.LookupNS(ctx, zone)
+		if err == nil && len(records) > 0 {
+			res := make([]string, len(records))
+			for i, ns := range records {
+				res[i] = strings.TrimSuffix(ns.Host, ".")
+			}
+			slices.Sort(res)
+			return res, nil
+		}
+
+		var dnsErr *net.DNSError
+		if err != nil && !errors.As(err, &dnsErr) {
+			return nil, err
+		}
+		_, zone, _ = strings.Cut(zone, ".")
+	}
+
+	return nil, fmt.Errorf("no NS records found for '%s' or its parent domains", name)
+}
+
+// lookupAuthoritative queries the name server for the records of the given type, and returns their values, sorted
+func lookupAuthoritative(ctx context.Context, nameServer string, name string, recordType string) ([]string, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(nameServer, "53"))
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, doctorDNSTimeout)
+	defer cancel()
+
+	var (
+		res []string
+		err error
+	)
+	switch recordType {
+	case dns.RecordTypeCNAME:
+		var target string
+		target, err = resolver.LookupCNAME(ctx, name)
+		if err == nil {
+			res = []string{strings.TrimSuffix(target, ".")}
+		}
+	case dns.RecordTypeA, dns.RecordTypeAAAA:
+		network := "ip4"
+		if recordType == dns.RecordTypeAAAA {
+			network = "ip6"
+		}
+		var ips []net.IP
+		ips, err = resolver.LookupIP(ctx, network, name)
+		for _, ip := range ips {
+			res = append(res, ip.String())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported record type '%s'", recordType)
+	}
+
+	// Names that have no records are reported as empty
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(res)
+	return res, nil
+}
+
+// formatValues formats the values of records for the report
+func formatValues(values []string) string {
+	if len(values) == 0 {
+		return "no records"
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/utils"
+)
+
+// runExport runs health checks once, and prints the desired and actual state of the DNS records of all domains, in JSON or CSV
+func runExport(ctx context.Context, log *slog.Logger, cfg *config.Config, dnsProviders map[string]dns.Provider, metrics *appmetrics.AppMetrics, format string, shutdowns *shutdownManager) {
+	hc, err := healthcheck.NewHealthChecker(cfg, dnsProviders, metrics, nil, nil)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to init health checker", err)
+		return
+	}
+
+	// The desired state is computed with the same checks as the plan command
+	plans := hc.Plan(ctx)
+	for domain, plan := range plans {
+		switch {
+		case plan.Error != "":
+			log.Warn("Failed to compute the desired state of the domain", "domain", domain, "error", plan.Error)
+		case plan.Skipped != "":
+			log.Warn("Records of the domain would not be updated, skipping", "domain", domain, "reason", plan.Skipped)
+		}
+	}
+	states := healthcheck.PlanRecordStates(plans)
+
+	if format == "csv" {
+		err = healthcheck.WriteRecordStatesCSV(os.Stdout, states)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(states)
+	}
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to print the state of the records", err)
+		return
+	}
+
+	shutdowns.Run(log)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Commands that can be passed as first argument
+const (
+	// Runs ddup as a remote checker agent
+	commandAgent = "agent"
+	// Prints the changes to the DNS records that would be applied, without applying them
+	commandPlan = "plan"
+	// Prints a starter configuration for domains, with endpoints inferred from the records published by a provider
+	commandImport = "import"
+	// Prints the desired and actual state of the DNS records of all domains
+	commandExport = "export"
+	// Checks that the server of the running instance is healthy, for container liveness probes
+	commandHealthcheck = "healthcheck"
+	// Validates the configuration, and optionally verifies the credentials of the DNS providers
+	commandValidate = "validate"
+	// Checks the configuration, the DNS providers, the endpoints, and the published records, and prints a diagnostic report
+	commandDoctor = "doctor"
+)
+
+// cliFlags contains the values passed as command-line flags, which override the values in the configuration file
+type cliFlags struct {
+	// Command passed as first argument; empty when running the service
+	command    string
+	configFile string
+	interval   time.Duration
+	logLevel   string
+	serverPort int
+	// Options for the "import" command
+	provider string
+	ttl      int
+	// Output format for the "export" command
+	format string
+	// If true, the "validate" command verifies the credentials of the DNS providers too
+	live bool
+	// Record names to import, passed as arguments to the "import" command
+	names []string
+}
+
+// parseFlags parses the command-line flags
+func parseFlags(args []string) (*cliFlags, error) {
+	f := &cliFlags{}
+
+	// The optional command is the first argument
+	if len(args) > 0 && slices.Contains([]string{commandAgent, commandPlan, commandImport, commandExport, commandHealthcheck, commandValidate, commandDoctor}, args[0]) {
+		f.command = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet("ddup", flag.ContinueOnError)
+	fs.StringVar(&f.configFile, "config", "", "Path to the configuration file (overrides the DDUP_CONFIG environmental variable)")
+	fs.DurationVar(&f.interval, "interval", 0, "Interval to perform health checks (overrides 'interval')")
+	fs.StringVar(&f.logLevel, "log-level", "", "Log level: debug, info, warn, error (overrides 'logs.level')")
+	fs.IntVar(&f.serverPort, "server.port", 0, "Port the server listens on (overrides 'server.port')")
+	fs.StringVar(&f.provider, "provider", "", "Name of the provider to read records from, with the import command (required if there's more than one provider)")
+	fs.StringVar(&f.format, "format", "json", "Output format with the export command: json, csv")
+	fs.IntVar(&f.ttl, "ttl", 60, "TTL for the imported domains, in seconds, with the import command")
+	fs.BoolVar(&f.live, "live", false, "Verify the credentials of the DNS providers with read-only requests to their APIs, with the validate command")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case f.command == commandImport && fs.NArg() == 0:
+		return nil, errors.New("the import command requires the names of the records to import")
+	case f.command == commandImport:
+		f.names = fs.Args()
+	case fs.NArg() > 0:
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	if f.interval < 0 {
+		return nil, fmt.Errorf("invalid value for flag --interval: %v", f.interval)
+	}
+	if f.format != "json" && f.format != "csv" {
+		return nil, fmt.Errorf("invalid value for flag --format: %s", f.format)
+	}
+	if f.ttl <= 0 {
+		return nil, fmt.Errorf("invalid value for flag --ttl: %d", f.ttl)
+	}
+	if f.serverPort < 0 || f.serverPort > 65535 {
+		return nil, fmt.Errorf("invalid value for flag --server.port: %d", f.serverPort)
+	}
+
+	return f, nil
+}
+
+// applyConfigFile sets the path of the config file to load, if the flag is set
+func (f *cliFlags) applyConfigFile() error {
+	if f.configFile == "" {
+		return nil
+	}
+
+	// config.Load reads the path from the environmental variable
+	return os.Setenv("DDUP_CONFIG", f.configFile)
+}
+
+// apply the values from the flags to the configuration
+// This must be invoked after the configuration is loaded and before it's validated
+func (f *cliFlags) apply(cfg *config.Config) {
+	if f == nil {
+		return
+	}
+
+	if f.interval > 0 {
+		cfg.Interval = f.interval
+	}
+	switch {
+	case f.logLevel != "":
+		cfg.Logs.Level = f.logLevel
+	case f.command == commandPlan || f.command == commandImport || f.command == commandExport || f.command == commandValidate || f.command == commandDoctor:
+		// Logs would be mixed with the output, so only warnings and errors are shown unless a level is set
+		cfg.Logs.Level = "warn"
+	}
+
+	// The import command only uses the providers, so the configuration doesn't need domains
+	cfg.SetProvidersOnly(f.command == commandImport)
+	if f.serverPort > 0 {
+		cfg.Server.Port = f.serverPort
+	}
+}
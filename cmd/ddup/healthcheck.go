@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Timeout for the request sent by the "healthcheck" command
+const healthcheckTimeout = 5 * time.Second
+
+// runHealthcheck checks that the server of the ddup instance using the same configuration is running, by requesting its /healthz route
+// The process exits with code 0 if the server responds successfully, and 1 otherwise, so this can be used as a liveness probe by containers
+func runHealthcheck(cfg *config.Config) {
+	err := checkServerHealth(context.Background(), cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Health check failed: "+err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Fprintln(os.Stdout, "OK")
+}
+
+// checkServerHealth requests the /healthz route of the local server, and returns an error if it doesn't respond successfully
+func checkServerHealth(ctx context.Context, cfg *config.Config) error {
+	if !cfg.Server.Enabled {
+		return errors.New("the server is not enabled in the configuration")
+	}
+
+	// Connect to the first address the server listens on; when it listens on all interfaces, connect to the loopback address
+	var host string
+	if len(cfg.Server.Bind) > 0 {
+		host = cfg.Server.Bind[0]
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+
+	// With ACME, the server uses HTTPS, but its certificate is for the public name and not for the address used here
+	scheme := "http"
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	if cfg.Server.ACME != nil {
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec
+		}
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   healthcheckTimeout,
+	}
+
+	u := scheme + "://" + net.JoinHostPort(host, strconv.Itoa(cfg.Server.Port)) + cfg.Server.BasePath + "/healthz"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("invalid response status code HTTP %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"slices"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/utils"
+)
+
+// importedDomain is a domain in the configuration printed by the import command
+// It contains only the options that are set, so the output is a starting point that can be edited
+type importedDomain struct {
+	RecordName string             `yaml:"recordName"`
+	Provider   string             `yaml:"provider"`
+	TTL        int                `yaml:"ttl"`
+	Endpoints  []importedEndpoint `yaml:"endpoints"`
+}
+
+// importedEndpoint is an endpoint in the configuration printed by the import command
+type importedEndpoint struct {
+	URL  string `yaml:"url"`
+	IP   string `yaml:"ip"`
+	Host string `yaml:"host"`
+}
+
+// runImport reads the A and AAAA records of the names passed as arguments from a provider, and prints a starter configuration for them
+func runImport(ctx context.Context, log *slog.Logger, cfg *config.Config, flags *cliFlags, metrics *appmetrics.AppMetrics, shutdowns *shutdownManager) {
+	providerName, err := importProviderName(cfg, flags.provider)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Invalid command-line flags", err)
+		return
+	}
+
+	// Only the provider that records are read from is initialized
+	pc := cfg.Providers[providerName]
+	shutdowns.Add(dns.StopPlugins)
+	provider, err := dns.NewProvider(providerName, &pc, cfg.HTTPTransport, metrics)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to init DNS provider", fmt.Errorf("failed to init DNS provider '%s': %w", providerName, err))
+		return
+	}
+	reader, ok := provider.(dns.RecordReader)
+	if !ok {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to import records", fmt.Errorf("DNS provider '%s' can't return its records", providerName))
+		return
+	}
+
+	domains := make([]importedDomain, 0, len(flags.names))
+	for _, name := range flags.names {
+		domain, err := importDomain(ctx, reader, providerName, name, flags.ttl)
+		if err != nil {
+			shutdowns.Run(log)
+			utils.FatalError(log, "Failed to import records", fmt.Errorf("failed to read records for '%s': %w", name, err))
+			return
+		}
+		if len(domain.Endpoints) == 0 {
+			log.Warn("No A or AAAA records found, skipping", "name", name)
+			continue
+		}
+		domains = append(domains, domain)
+	}
+
+	err = printImportedConfig(os.Stdout, domains)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to print configuration", err)
+		return
+	}
+
+	shutdowns.Run(log)
+}
+
+// importProviderName returns the name of the provider to read records from
+// If the flag is not set, the configuration must contain a single provider
+func importProviderName(cfg *config.Config, name string) (string, error) {
+	if name != "" {
+		_, ok := cfg.Providers[name]
+		if !ok {
+			return "", fmt.Errorf("provider '%s' is not configured", name)
+		}
+		return name, nil
+	}
+
+	if len(cfg.Providers) != 1 {
+		return "", errors.New("the configuration contains more than one provider: select one with --provider")
+	}
+	return slices.Collect(maps.Keys(cfg.Providers))[0], nil
+}
+
+// importDomain reads the records of the name from the provider, and returns a domain with an endpoint for each IP
+func importDomain(ctx context.Context, reader dns.RecordReader, providerName string, name string, ttl int) (importedDomain, error) {
+	domain := importedDomain{
+		RecordName: name,
+		Provider:   providerName,
+		TTL:        ttl,
+		Endpoints:  []importedEndpoint{},
+	}
+
+	for _, recordType := range []string{dns.RecordTypeA, dns.RecordTypeAAAA} {
+		ips, err := reader.GetRecords(ctx, name, recordType)
+		if err != nil {
+			return domain, fmt.Errorf("error getting %s records: %w", recordType, err)
+		}
+		slices.Sort(ips)
+
+		for _, ip := range ips {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				continue
+			}
+			addr = addr.Unmap()
+			host := addr.String()
+			if addr.Is6() {
+				host = "[" + host + "]"
+			}
+
+			// Health checks are performed on the IP, and requests include the record name as hostname
+			// The URLs are a starting point, and they should be replaced with the health check endpoints of the servers
+			domain.Endpoints = append(domain.Endpoints, importedEndpoint{
+				URL:  "http://" + host + "/",
+				IP:   addr.String(),
+				Host: name,
+			})
+		}
+	}
+
+	return domain, nil
+}
+
+// printImportedConfig prints the configuration with the imported domains, in YAML
+func printImportedConfig(w io.Writer, domains []importedDomain) error {
+	_, err := io.WriteString(w, "# Generated by \"ddup import\"\n"+
+		"# Review the health check URLs of the endpoints, then add the domains to the configuration file\n")
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	err = enc.Encode(map[string]any{
+		"domains": domains,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return enc.Close()
+}
@@ -3,19 +3,29 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
+	"os"
 	"time"
 
 	configkit "github.com/italypaleale/go-kit/config"
 	"github.com/italypaleale/go-kit/observability"
 	"github.com/italypaleale/go-kit/servicerunner"
 
+	"github.com/italypaleale/ddup/pkg/acme"
 	"github.com/italypaleale/ddup/pkg/buildinfo"
 	"github.com/italypaleale/ddup/pkg/config"
 	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/events"
 	"github.com/italypaleale/ddup/pkg/healthcheck"
+	"github.com/italypaleale/ddup/pkg/influxdb"
+	"github.com/italypaleale/ddup/pkg/leader"
+	"github.com/italypaleale/ddup/pkg/logging"
 	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/notifications"
 	"github.com/italypaleale/ddup/pkg/server"
+	appservicerunner "github.com/italypaleale/ddup/pkg/servicerunner"
 	"github.com/italypaleale/ddup/pkg/signals"
 	"github.com/italypaleale/ddup/pkg/utils"
 )
@@ -28,12 +38,22 @@ func main() {
 		With(slog.String("app", buildinfo.AppName)).
 		With(slog.String("version", buildinfo.AppVersion))
 
+	// Parse command-line flags
+	flags, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		utils.FatalError(initLogger, "Invalid command-line flags", err)
+		return
+	}
+	err = flags.applyConfigFile()
+	if err != nil {
+		utils.FatalError(initLogger, "Failed to set configuration file path", err)
+		return
+	}
+
 	// Load config
-	cfg := config.Get()
-	err := configkit.LoadConfig(cfg, configkit.LoadConfigOpts{
-		EnvVar:  "DDUP_CONFIG",
-		DirName: "ddup",
-	})
+	cfg, err := config.Load()
 	if err != nil {
 		var ce *configkit.ConfigError
 		if errors.As(err, &ce) {
@@ -44,18 +64,21 @@ func main() {
 		}
 	}
 
+	// Apply overrides from the command-line flags
+	flags.apply(cfg)
+
+	// The "healthcheck" command only sends a request to the server, so it doesn't need the rest of the app
+	if flags.command == commandHealthcheck {
+		runHealthcheck(cfg)
+		return
+	}
+
 	shutdowns := &shutdownManager{
 		fns: make([]servicerunner.Service, 0, 2),
 	}
 
 	// Get the logger and set it in the context
-	log, loggerShutdownFn, err := observability.InitLogs(context.Background(), observability.InitLogsOpts{
-		Config:     cfg,
-		Level:      cfg.Logs.Level,
-		JSON:       cfg.Logs.JSON,
-		AppName:    buildinfo.AppName,
-		AppVersion: buildinfo.AppVersion,
-	})
+	log, loggerShutdownFn, err := logging.InitLogs(context.Background(), cfg)
 	if err != nil {
 		utils.FatalError(initLogger, "Failed to create logger", err)
 		return
@@ -63,22 +86,45 @@ func main() {
 	slog.SetDefault(log)
 	shutdowns.Add(loggerShutdownFn)
 
+	// With the "validate" command, the configuration is validated and the result is printed
+	if flags.command == commandValidate {
+		runValidate(log, cfg, flags.live, shutdowns)
+		return
+	}
+
+	// With the "doctor" command, the configuration, providers, endpoints, and records are checked, and a report is printed
+	if flags.command == commandDoctor {
+		runDoctor(log, cfg, shutdowns)
+		return
+	}
+
 	// Validate the configuration
-	err = cfg.Validate(log)
+	err = cfg.Validate(logger())
 	if err != nil {
 		shutdowns.Run(log)
 		utils.FatalError(log, "Invalid configuration", err)
 		return
 	}
+	switch {
+	case flags.command == commandAgent && cfg.Agent == nil:
+		shutdowns.Run(log)
+		utils.FatalError(log, "Invalid configuration", errors.New("running as agent requires the 'agent' section in the configuration"))
+		return
+	case flags.command != commandAgent && cfg.Agent != nil:
+		shutdowns.Run(log)
+		utils.FatalError(log, "Invalid configuration", errors.New("the 'agent' section is only used when running as agent, with 'ddup agent'"))
+		return
+	}
 
 	log.Info("Starting ddup", "build", buildinfo.BuildDescription)
+	logStartupSummary(log, cfg)
 
 	// Get a context that is canceled when the application receives a termination signal
 	// We store the logger in the context too
 	ctx := signals.SignalContext(context.Background())
 
 	// Init metrics
-	metrics, metricsShutdownFn, err := appmetrics.NewAppMetrics(ctx)
+	metrics, metricsShutdownFn, err := appmetrics.NewAppMetrics(ctx, cfg)
 	if err != nil {
 		shutdowns.Run(log)
 		utils.FatalError(log, "Failed to init metrics", err)
@@ -86,48 +132,177 @@ func main() {
 	}
 	shutdowns.Add(metricsShutdownFn)
 
+	// Init tracing
+	// Traces are exported only if an exporter is configured with the OTEL_TRACES_EXPORTER env var
+	_, tracesShutdownFn, err := observability.InitTraces(ctx, observability.InitTracesOpts{
+		Config:  cfg,
+		AppName: buildinfo.AppName,
+	})
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to init tracing", err)
+		return
+	}
+	shutdowns.Add(tracesShutdownFn)
+
+	// When running as a remote checker agent, only health checks are performed, and the results are reported to the central instance
+	if flags.command == commandAgent {
+		runAgent(ctx, log, cfg, metrics, shutdowns)
+		return
+	}
+
+	// With the "import" command, records are read from a provider, and a starter configuration is printed
+	if flags.command == commandImport {
+		runImport(ctx, log, cfg, flags, metrics, shutdowns)
+		return
+	}
+
 	// Initialize DNS providers
-	dnsProviders := make(map[string]dns.Provider, len(cfg.Providers))
-	for name, pc := range cfg.Providers {
-		var provider dns.Provider
-		provider, err = dns.NewProvider(name, &pc, metrics)
+	// Plugins are started by the providers that use them, and they're stopped when the app shuts down
+	shutdowns.Add(dns.StopPlugins)
+	dnsProviders, err := initDNSProviders(cfg, metrics)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to init DNS providers", err)
+		return
+	}
+
+	// With the "plan" command, checks are run once and the changes to the records are printed, without applying them
+	if flags.command == commandPlan {
+		runPlan(ctx, log, cfg, dnsProviders, metrics, shutdowns)
+		return
+	}
+
+	// With the "export" command, checks are run once and the desired and actual state of the records are printed
+	if flags.command == commandExport {
+		runExport(ctx, log, cfg, dnsProviders, metrics, flags.format, shutdowns)
+		return
+	}
+
+	// Verify the credentials of the DNS providers, so invalid ones are reported right away rather than on the first failover
+	if cfg.PreflightChecks && statusProvider == nil {
+		err = verifyCredentials(ctx, dnsProviders)
 		if err != nil {
 			shutdowns.Run(log)
-			utils.FatalError(log, "Failed to init DNS provider '"+name+"'", err)
+			utils.FatalError(log, "Preflight checks failed", err)
 			return
 		}
-		dnsProviders[name] = provider
+		log.Debug("Verified the credentials of the DNS providers")
 	}
 
 	// List of services to run
-	services := make([]servicerunner.Service, 0, 2)
+	services := make([]servicerunner.Service, 0, 3)
+
+	// The events bus receives state transitions from the health checker, and delivers them to subscribers
+	bus := events.NewBus()
 
 	// Initialize health checker
 	// If there's a non-nil statusProvider, it means we're in the "dashboarddev" mode where we use static data
+	var (
+		cr          *configReloader
+		reloader    server.ConfigReloader
+		drainer     healthcheck.EndpointDrainer
+		checkRunner healthcheck.CheckRunner
+		pauser      healthcheck.DomainPauser
+		observer    healthcheck.ObservationProvider
+		agents      healthcheck.AgentReportReceiver
+		exporter    healthcheck.RecordExporter
+	)
 	if statusProvider == nil {
-		hc, err := healthcheck.NewHealthChecker(dnsProviders, metrics)
+		// When running multiple replicas, only the leader updates DNS records
+		var elector healthcheck.LeaderElector
+		if cfg.LeaderElection != nil {
+			le, err := leader.NewElector(cfg.LeaderElection)
+			if err != nil {
+				shutdowns.Run(log)
+				utils.FatalError(log, "Failed to init leader election", err)
+				return
+			}
+			services = append(services, le.Run)
+			elector = le
+		}
+
+		hc, err := healthcheck.NewHealthChecker(cfg, dnsProviders, metrics, bus, elector)
 		if err != nil {
 			shutdowns.Run(log)
 			utils.FatalError(log, "Failed to init health checker", err)
 			return
 		}
-		services = append(services, hc.Run)
+		// If the health checker fails, it's restarted, so it doesn't stop the other services
+		services = append(services, appservicerunner.WithRestart("healthcheck", hc.Run, appservicerunner.RestartOptions{Metrics: metrics}))
+
+		// Serve the records of providers that use the built-in DNS server
+		// This runs even if no such provider is configured, so one can be added when the configuration is reloaded
+		services = append(services, dns.RunDNSServers)
+
+		// Send notifications to webhooks
+		// The notifier runs even if no webhook is configured, so webhooks can be added when the configuration is reloaded
+		notifier := notifications.NewNotifier(cfg.Notifications, bus)
+		services = append(services, notifier.Run)
+
+		// Write the results of health checks to InfluxDB
+		// Like the notifier, the writer runs even if InfluxDB is not configured, so it can be enabled when the configuration is reloaded
+		influxWriter := influxdb.NewWriter(cfg.InfluxDB)
+		hc.SetResultRecorder(influxWriter)
+		services = append(services, influxWriter.Run)
+
+		// Watch the config file for changes if needed
+		cr = newConfigReloader(cfg, hc, notifier, influxWriter, metrics, flags)
+		if cfg.WatchConfigFile {
+			services = append(services, cr.Watch)
+		}
+		reloader = cr
+		drainer = hc
+		checkRunner = hc
+		pauser = hc
+		observer = hc
+		agents = hc
+		exporter = hc
 
 		statusProvider = hc
 	}
 
 	// Init the server if needed
 	if cfg.Server.Enabled {
-		srv, err := server.NewServer(server.NewServerOpts{
-			HealthChecker: statusProvider,
-		})
+		srvOpts := server.NewServerOpts{
+			Config:              cfg,
+			HealthChecker:       statusProvider,
+			ConfigReloader:      reloader,
+			EndpointDrainer:     drainer,
+			CheckRunner:         checkRunner,
+			DomainPauser:        pauser,
+			ObservationProvider: observer,
+			AgentReportReceiver: agents,
+			RecordExporter:      exporter,
+		}
+
+		// Obtain and renew the server's certificate using ACME if needed
+		if cfg.Server.ACME != nil {
+			certManager, err := acme.NewManager(*cfg.Server.ACME, dnsProviders)
+			if err != nil {
+				shutdowns.Run(log)
+				utils.FatalError(log, "Failed to init ACME", err)
+				return
+			}
+			services = append(services, certManager.Run)
+
+			srvOpts.TLSConfig = certManager.TLSConfig()
+			srvOpts.ACMEHTTPHandler = certManager.HTTPHandler()
+		}
+
+		srv, err := server.NewServer(srvOpts)
 		if err != nil {
 			shutdowns.Run(log)
 			utils.FatalError(log, "Failed to init server", err)
 			return
 		}
 
-		services = append(services, srv.Run)
+		// The server receives the new configuration when it's reloaded
+		if cr != nil {
+			cr.server = srv
+		}
+
+		services = append(services, appservicerunner.WithRestart("server", srv.Run, appservicerunner.RestartOptions{Metrics: metrics}))
 	}
 
 	// Run all services
@@ -144,6 +319,19 @@ func main() {
 	shutdowns.Run(log)
 }
 
+func initDNSProviders(cfg *config.Config, metrics *appmetrics.AppMetrics) (map[string]dns.Provider, error) {
+	dnsProviders := make(map[string]dns.Provider, len(cfg.Providers))
+	for name, pc := range cfg.Providers {
+		provider, err := dns.NewProvider(name, &pc, cfg.HTTPTransport, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init DNS provider '%s': %w", name, err)
+		}
+		dnsProviders[name] = provider
+	}
+
+	return dnsProviders, nil
+}
+
 type shutdownManager struct {
 	fns []servicerunner.Service
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/utils"
+)
+
+// runPlan runs health checks once, and prints the changes to the DNS records that would be applied, without applying them
+func runPlan(ctx context.Context, log *slog.Logger, cfg *config.Config, dnsProviders map[string]dns.Provider, metrics *appmetrics.AppMetrics, shutdowns *shutdownManager) {
+	hc, err := healthcheck.NewHealthChecker(cfg, dnsProviders, metrics, nil, nil)
+	if err != nil {
+		shutdowns.Run(log)
+		utils.FatalError(log, "Failed to init health checker", err)
+		return
+	}
+
+	plans := hc.Plan(ctx)
+	failed := printPlan(os.Stdout, plans)
+
+	shutdowns.Run(log)
+
+	// Exit with an error if the plan could not be computed for some domains
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printPlan prints the plan in a human-readable format
+// It returns the number of domains for which the plan could not be computed
+func printPlan(w io.Writer, plans map[string]healthcheck.DomainPlan) (failed int) {
+	var add, remove, changed int
+	for _, domain := range slices.Sorted(maps.Keys(plans)) {
+		plan := plans[domain]
+		fmt.Fprintf(w, "%s (provider: %s, TTL: %d)\n", domain, plan.Provider, plan.TTL)
+
+		switch {
+		case plan.Error != "":
+			fmt.Fprintf(w, "  ! %s\n", plan.Error)
+			failed++
+			continue
+		case plan.Skipped != "":
+			fmt.Fprintf(w, "  Records would not be updated: %s\n", plan.Skipped)
+			continue
+		case !plan.HasChanges():
+			fmt.Fprintln(w, "  No changes")
+			continue
+		}
+
+		changed++
+		for _, r := range plan.Records {
+			// Records of aliases are prefixed with their name
+			label := r.RecordType
+			if r.Name != "" && r.Name != domain {
+				label = r.Name + " " + r.RecordType
+			}
+
+			switch {
+			case r.Error != "":
+				fmt.Fprintf(w, "  %s: %s; records would be replaced with: %s\n", label, r.Error, strings.Join(r.Desired, ", "))
+			case !r.Known():
+				fmt.Fprintf(w, "  %s: provider can't return its records; records would be replaced with: %s\n", label, strings.Join(r.Desired, ", "))
+			default:
+				fmt.Fprintf(w, "  %s:\n", label)
+				for _, ip := range r.Desired {
+					if slices.Contains(r.Add, ip) {
+						fmt.Fprintf(w, "    + %s\n", ip)
+					} else {
+						fmt.Fprintf(w, "      %s\n", ip)
+					}
+				}
+				for _, ip := range r.Remove {
+					fmt.Fprintf(w, "    - %s\n", ip)
+				}
+				add += len(r.Add)
+				remove += len(r.Remove)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nPlan: %d to add, %d to remove, %d of %d domains changed\n", add, remove, changed, len(plans))
+	return failed
+}
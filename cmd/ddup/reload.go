@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/italypaleale/go-kit/fsnotify"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+	"github.com/italypaleale/ddup/pkg/influxdb"
+	"github.com/italypaleale/ddup/pkg/logging"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/notifications"
+	"github.com/italypaleale/ddup/pkg/server"
+)
+
+// configReloader reloads the configuration file and applies it to the running health checker
+type configReloader struct {
+	hc       *healthcheck.HealthChecker
+	notifier *notifications.Notifier
+	influx   *influxdb.Writer
+	metrics  *appmetrics.AppMetrics
+	// Overrides from the command-line flags, which are applied to every new configuration
+	flags *cliFlags
+	// Server that receives the new configuration, if enabled
+	// It's set after the server is created, before the services are started
+	server *server.Server
+
+	lock sync.Mutex
+	// Configuration currently applied
+	// Protected by lock
+	cfg *config.Config
+	// Hash of the last configuration file that was applied
+	lastHash [sha256.Size]byte
+}
+
+func newConfigReloader(cfg *config.Config, hc *healthcheck.HealthChecker, notifier *notifications.Notifier, influx *influxdb.Writer, metrics *appmetrics.AppMetrics, flags *cliFlags) *configReloader {
+	r := &configReloader{
+		hc:       hc,
+		notifier: notifier,
+		influx:   influx,
+		metrics:  metrics,
+		flags:    flags,
+		cfg:      cfg,
+	}
+
+	// Store the hash of the file currently loaded, so we don't re-apply it if it hasn't changed
+	data, err := os.ReadFile(cfg.GetLoadedConfigPath())
+	if err == nil {
+		r.lastHash = sha256.Sum256(data)
+	}
+
+	return r
+}
+
+// Reload the configuration file from disk and apply it.
+// The new configuration is validated before being applied: if it's not valid, the current configuration remains in use.
+func (r *configReloader) Reload(ctx context.Context) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	filePath := r.cfg.GetLoadedConfigPath()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file '%s': %w", filePath, err)
+	}
+
+	// Skip if the file hasn't changed since it was last applied
+	hash := sha256.Sum256(data)
+	if hash == r.lastHash {
+		logger().DebugContext(ctx, "Configuration file has not changed")
+		return nil
+	}
+
+	newCfg, err := config.ParseFormat(bytes.NewReader(data), config.FormatFromPath(filePath))
+	if err != nil {
+		return fmt.Errorf("failed to load config file '%s': %w", filePath, err)
+	}
+	newCfg.SetLoadedConfigPath(filePath)
+	r.flags.apply(newCfg)
+
+	err = newCfg.Validate(logger())
+	if err != nil {
+		return fmt.Errorf("new configuration is invalid: %w", err)
+	}
+
+	dnsProviders, err := initDNSProviders(newCfg, r.metrics)
+	if err != nil {
+		return err
+	}
+
+	err = r.hc.UpdateConfig(newCfg, dnsProviders)
+	if err != nil {
+		return fmt.Errorf("failed to apply new configuration: %w", err)
+	}
+	r.notifier.UpdateConfig(newCfg.Notifications)
+	r.influx.UpdateConfig(newCfg.InfluxDB)
+	if r.server != nil {
+		r.server.UpdateConfig(newCfg)
+	}
+
+	r.metrics.SetConfigHash(newCfg.Hash())
+
+	r.cfg = newCfg
+	r.lastHash = hash
+
+	logger().InfoContext(ctx, "Configuration reloaded", slog.String("path", filePath), slog.Int("domains", len(newCfg.Domains)))
+
+	return nil
+}
+
+// Watch the configuration file for changes and reload it automatically.
+// Changes happening in quick succession are batched together.
+func (r *configReloader) Watch(ctx context.Context) error {
+	r.lock.Lock()
+	filePath := r.cfg.GetLoadedConfigPath()
+	r.lock.Unlock()
+	if filePath == "" {
+		return errors.New("cannot watch configuration file: no file was loaded")
+	}
+
+	// We watch the entire folder, as that's needed to detect files being replaced, including with Kubernetes ConfigMaps (which use symlinks)
+	watchCh, err := fsnotify.WatchFolder(ctx, filepath.Dir(filePath))
+	if err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	logger().InfoContext(ctx, "Watching configuration file for changes", slog.String("path", filePath))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-watchCh:
+			if !ok {
+				return nil
+			}
+
+			err = r.Reload(ctx)
+			if err != nil {
+				logger().ErrorContext(ctx, "Failed to reload configuration", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// logger returns the logger for configuration changes
+func logger() *slog.Logger {
+	return logging.Component("config")
+}
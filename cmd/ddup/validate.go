@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/signals"
+)
+
+// runValidate validates the configuration and prints the result
+// If live is true, the credentials of the DNS providers are verified too, with read-only requests to their APIs
+// The process exits with code 1 if the configuration is invalid, or if the credentials of some providers are invalid
+func runValidate(log *slog.Logger, cfg *config.Config, live bool, shutdowns *shutdownManager) {
+	err := cfg.Validate(logger())
+	if err != nil {
+		shutdowns.Run(log)
+		fmt.Fprintln(os.Stderr, "Configuration is invalid: "+err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stdout, "Configuration is valid")
+
+	if !live {
+		shutdowns.Run(log)
+		return
+	}
+
+	shutdowns.Add(dns.StopPlugins)
+	dnsProviders, err := initDNSProviders(cfg, nil)
+	if err != nil {
+		shutdowns.Run(log)
+		fmt.Fprintln(os.Stderr, "Failed to init DNS providers: "+err.Error())
+		os.Exit(1)
+	}
+
+	ctx := signals.SignalContext(context.Background())
+	results := dns.VerifyCredentials(ctx, dnsProviders)
+	failed := printCredentialsResults(os.Stdout, dnsProviders, results)
+
+	shutdowns.Run(log)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printCredentialsResults prints the result of the verification of the credentials of each provider
+// It returns the number of providers whose credentials are invalid
+func printCredentialsResults(w io.Writer, dnsProviders map[string]dns.Provider, results map[string]error) (failed int) {
+	for _, name := range slices.Sorted(maps.Keys(dnsProviders)) {
+		err, verified := results[name]
+		switch {
+		case !verified:
+			fmt.Fprintf(w, "Provider '%s': skipped, the provider doesn't support verifying credentials\n", name)
+		case err != nil:
+			fmt.Fprintf(w, "Provider '%s': failed: %v\n", name, err)
+			failed++
+		default:
+			fmt.Fprintf(w, "Provider '%s': OK\n", name)
+		}
+	}
+	return failed
+}
+
+// verifyCredentials verifies the credentials of the DNS providers, and returns an error listing the providers whose credentials are invalid
+func verifyCredentials(ctx context.Context, dnsProviders map[string]dns.Provider) error {
+	results := dns.VerifyCredentials(ctx, dnsProviders)
+
+	errs := make([]error, 0, len(results))
+	for _, name := range slices.Sorted(maps.Keys(results)) {
+		if results[name] != nil {
+			errs = append(errs, fmt.Errorf("provider '%s': %w", name, results[name]))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -2,12 +2,19 @@ import { useState, useEffect, useCallback } from 'react'
 import { Card, CardContent, CardHeader, CardTitle } from '@/ui/card'
 import { Badge } from '@/ui/badge'
 import { Button } from '@/ui/button'
-import { RefreshCw, Activity, AlertTriangle, CheckCircle, XCircle, Clock, Search } from 'lucide-react'
+import { RefreshCw, Activity, AlertTriangle, CheckCircle, XCircle, Clock, Search, Pause } from 'lucide-react'
 import { cn } from '@/lib/utils'
 
 interface DomainStatusEndpoint {
   healthy: boolean
   ip: string
+  name?: string
+  url?: string
+  lastLatencyMs?: number
+  lastError?: string
+  degraded?: boolean
+  flapping?: boolean
+  drained?: boolean
   failureCount?: number
 }
 
@@ -15,7 +22,10 @@ interface DomainStatus {
   lastUpdated: string
   provider: string
   error?: string
+  warning?: string
   endpoints: DomainStatusEndpoint[]
+  fallbackIPs?: string[]
+  paused?: boolean
 }
 
 type DomainsResponse = Record<string, DomainStatus>
@@ -104,7 +114,10 @@ const DomainMonitorDashboard = ({ endpoint }: { endpoint: string }) => {
   const filteredDomains = domains.filter((domain) => {
     const searchLower = searchTerm.toLowerCase()
     const domainMatches = domain.name.toLowerCase().includes(searchLower)
-    const endpointMatches = domain.status.endpoints.some((endpoint) => endpoint.ip.toLowerCase().includes(searchLower))
+    const endpointMatches = domain.status.endpoints.some(
+      (endpoint) =>
+        endpoint.ip.toLowerCase().includes(searchLower) || !!endpoint.name?.toLowerCase().includes(searchLower)
+    )
     return domainMatches || endpointMatches
   })
 
@@ -256,6 +269,16 @@ const DomainMonitorDashboard = ({ endpoint }: { endpoint: string }) => {
                   </CardHeader>
 
                   <CardContent className="space-y-4">
+                    {domain.status.paused && (
+                      <div className="rounded-lg bg-blue-50 dark:bg-blue-950/50 p-3 text-sm text-blue-800 dark:text-blue-200">
+                        <div className="flex items-center gap-2">
+                          <Pause className="h-4 w-4" />
+                          <span className="font-medium">Paused</span>
+                        </div>
+                        <p className="mt-1">Health checks and DNS updates are paused for this domain</p>
+                      </div>
+                    )}
+
                     {domain.status.error && (
                       <div className="rounded-lg bg-red-50 dark:bg-red-950/50 p-3 text-sm text-red-800 dark:text-red-200">
                         <div className="flex items-center gap-2">
@@ -266,6 +289,29 @@ const DomainMonitorDashboard = ({ endpoint }: { endpoint: string }) => {
                       </div>
                     )}
 
+                    {domain.status.warning && (
+                      <div className="rounded-lg bg-yellow-50 dark:bg-yellow-950/50 p-3 text-sm text-yellow-800 dark:text-yellow-200">
+                        <div className="flex items-center gap-2">
+                          <AlertTriangle className="h-4 w-4" />
+                          <span className="font-medium">Domain Warning</span>
+                        </div>
+                        <p className="mt-1">{domain.status.warning}</p>
+                      </div>
+                    )}
+
+                    {domain.status.fallbackIPs && domain.status.fallbackIPs.length > 0 && (
+                      <div className="rounded-lg bg-yellow-50 dark:bg-yellow-950/50 p-3 text-sm text-yellow-800 dark:text-yellow-200">
+                        <div className="flex items-center gap-2">
+                          <AlertTriangle className="h-4 w-4" />
+                          <span className="font-medium">Fallback Active</span>
+                        </div>
+                        <p className="mt-1">
+                          No endpoint is healthy; publishing{' '}
+                          <span className="font-mono">{domain.status.fallbackIPs.join(', ')}</span>
+                        </p>
+                      </div>
+                    )}
+
                     {/* Endpoints */}
                     {domain.status.endpoints.length > 0 && (
                       <div>
@@ -289,9 +335,31 @@ const DomainMonitorDashboard = ({ endpoint }: { endpoint: string }) => {
                                   )}
                                   {endpoint.healthy ? 'Healthy' : 'Unhealthy'}
                                 </Badge>
-                                <span className="font-mono text-sm">{endpoint.ip}</span>
+                                <div className="min-w-0">
+                                  {endpoint.name && endpoint.name !== endpoint.url && (
+                                    <div className="truncate text-sm font-medium" title={endpoint.url}>
+                                      {endpoint.name}
+                                    </div>
+                                  )}
+                                  <div className="font-mono text-sm">{endpoint.ip}</div>
+                                  {endpoint.lastError && (
+                                    <div className="truncate text-xs text-red-700 dark:text-red-300" title={endpoint.lastError}>
+                                      {endpoint.lastError}
+                                    </div>
+                                  )}
+                                </div>
                               </div>
                               <div className="text-right text-xs text-muted-foreground">
+                                {endpoint.drained && (
+                                  <div className="text-blue-700 dark:text-blue-300">Drained</div>
+                                )}
+                                {endpoint.flapping && (
+                                  <div className="text-yellow-700 dark:text-yellow-300">Flapping</div>
+                                )}
+                                {endpoint.degraded && (
+                                  <div className="text-yellow-700 dark:text-yellow-300">Slow response</div>
+                                )}
+                                {endpoint.lastLatencyMs !== undefined && <div>Latency: {endpoint.lastLatencyMs}ms</div>}
                                 <div>Failures: {endpoint.failureCount || '0'}</div>
                               </div>
                             </div>
@@ -5,8 +5,11 @@ import { DomainMonitorDashboard } from '@/components/DomainMonitorDashboard'
 
 import './index.css'
 
+// When ddup is served under a base path, the server adds it to the page in a meta tag
+const basePath = document.querySelector<HTMLMetaElement>('meta[name="ddup-base-path"]')?.content ?? ''
+
 createRoot(document.getElementById('root')!).render(
   <StrictMode>
-    <DomainMonitorDashboard endpoint="" />
+    <DomainMonitorDashboard endpoint={basePath} />
   </StrictMode>
 )
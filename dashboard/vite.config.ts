@@ -5,6 +5,8 @@ import path from 'path'
 
 // https://vite.dev/config/
 export default defineConfig({
+    // Assets are loaded with relative paths, so the dashboard works when ddup is served under a base path
+    base: './',
     plugins: [react(), tailwindcss()],
     resolve: {
         alias: {
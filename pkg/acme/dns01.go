@@ -0,0 +1,292 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	acmeapi "golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/italypaleale/ddup/pkg/dns"
+)
+
+const (
+	// Keys for the objects stored in the cache
+	// These don't overlap with the keys used by autocert
+	cacheKeyAccount = "dns01+account_key"
+	cacheKeyCert    = "dns01+cert"
+
+	// TTL for the TXT records created for challenges
+	challengeRecordTTL = 60
+	// Timeout for deleting the TXT records after the challenges are completed
+	cleanupTimeout = 30 * time.Second
+)
+
+// needsRenewal returns true if there's no certificate, if it's about to expire, or if it doesn't match the domains in the configuration
+func (m *Manager) needsRenewal(now time.Time) bool {
+	cert := m.cert.Load()
+	if cert == nil || cert.Leaf == nil {
+		return true
+	}
+	if cert.Leaf.NotAfter.Sub(now) < renewBefore {
+		return true
+	}
+
+	certDomains := slices.Clone(cert.Leaf.DNSNames)
+	slices.Sort(certDomains)
+	cfgDomains := slices.Clone(m.cfg.Domains)
+	slices.Sort(cfgDomains)
+	return !slices.Equal(certDomains, cfgDomains)
+}
+
+// obtainCert requests a new certificate, solving dns-01 challenges
+func (m *Manager) obtainCert(ctx context.Context) error {
+	err := m.register(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acmeapi.DomainIDs(m.cfg.Domains...))
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+
+	// Collect the challenges to solve
+	// A domain and its wildcard share the same TXT record name, so records can have multiple values
+	var (
+		challenges []*acmeapi.Challenge
+		authzURLs  []string
+	)
+	records := map[string][]string{}
+	for _, u := range order.AuthzURLs {
+		authz, err := m.client.GetAuthorization(ctx, u)
+		if err != nil {
+			return fmt.Errorf("failed to get authorization: %w", err)
+		}
+		if authz.Status == acmeapi.StatusValid {
+			continue
+		}
+
+		idx := slices.IndexFunc(authz.Challenges, func(c *acmeapi.Challenge) bool {
+			return c.Type == "dns-01"
+		})
+		if idx < 0 {
+			return fmt.Errorf("the CA did not offer a dns-01 challenge for '%s'", authz.Identifier.Value)
+		}
+		chal := authz.Challenges[idx]
+
+		value, err := m.client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return fmt.Errorf("failed to compute challenge record: %w", err)
+		}
+		name := "_acme-challenge." + authz.Identifier.Value
+		records[name] = append(records[name], value)
+		challenges = append(challenges, chal)
+		authzURLs = append(authzURLs, authz.URI)
+	}
+
+	// Create the TXT records, and delete them when done
+	if len(records) > 0 {
+		defer m.deleteChallengeRecords(ctx, records)
+		for name, values := range records {
+			err = m.provider.UpdateTXTRecords(ctx, name, challengeRecordTTL, values)
+			if err != nil {
+				return fmt.Errorf("failed to create TXT record '%s': %w", name, err)
+			}
+		}
+		err = dns.Flush(ctx, m.provider)
+		if err != nil {
+			return fmt.Errorf("failed to publish TXT records: %w", err)
+		}
+
+		// Wait for the records to propagate
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.cfg.PropagationDelay):
+		}
+	}
+
+	for i, chal := range challenges {
+		_, err = m.client.Accept(ctx, chal)
+		if err != nil {
+			return fmt.Errorf("failed to accept challenge: %w", err)
+		}
+		_, err = m.client.WaitAuthorization(ctx, authzURLs[i])
+		if err != nil {
+			return fmt.Errorf("authorization failed: %w", err)
+		}
+	}
+
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("order failed: %w", err)
+	}
+
+	// Generate the key and request the certificate
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.cfg.Domains[0]},
+		DNSNames: m.cfg.Domains,
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to obtain certificate: %w", err)
+	}
+
+	data, err := encodeCert(key, der)
+	if err != nil {
+		return err
+	}
+	cert, err := decodeCert(data)
+	if err != nil {
+		return err
+	}
+	m.cert.Store(cert)
+
+	// Failing to store the certificate isn't fatal, as it's still used until the app is restarted
+	err = m.cache.Put(ctx, cacheKeyCert, data)
+	if err != nil {
+		logger().WarnContext(ctx, "Failed to store certificate in the cache", slog.Any("error", err))
+	}
+
+	return nil
+}
+
+// deleteChallengeRecords deletes the TXT records created for challenges
+// This runs even if the context is canceled
+func (m *Manager) deleteChallengeRecords(parentCtx context.Context, records map[string][]string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parentCtx), cleanupTimeout)
+	defer cancel()
+
+	for name := range records {
+		err := m.provider.UpdateTXTRecords(ctx, name, challengeRecordTTL, nil)
+		if err != nil {
+			logger().WarnContext(ctx, "Failed to delete TXT record for ACME challenge", slog.String("name", name), slog.Any("error", err))
+		}
+	}
+	err := dns.Flush(ctx, m.provider)
+	if err != nil {
+		logger().WarnContext(ctx, "Failed to publish deletion of TXT records for ACME challenge", slog.Any("error", err))
+	}
+}
+
+// register sets the account key in the client, and registers the account with the CA if needed
+func (m *Manager) register(ctx context.Context) error {
+	if m.client.Key != nil {
+		return nil
+	}
+
+	key, err := m.loadAccountKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.client.Key = key
+	account := &acmeapi.Account{}
+	if m.cfg.Email != "" {
+		account.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	_, err = m.client.Register(ctx, account, acmeapi.AcceptTOS)
+	if err != nil && !errors.Is(err, acmeapi.ErrAccountAlreadyExists) {
+		m.client.Key = nil
+		return fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	return nil
+}
+
+// loadAccountKey returns the account key from the cache, generating a new one if needed
+func (m *Manager) loadAccountKey(ctx context.Context) (crypto.Signer, error) {
+	data, err := m.cache.Get(ctx, cacheKeyAccount)
+	switch {
+	case errors.Is(err, autocert.ErrCacheMiss):
+		// Generate a new key
+	case err != nil:
+		return nil, fmt.Errorf("failed to read account key from the cache: %w", err)
+	default:
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "EC PRIVATE KEY" {
+			return nil, errors.New("account key in the cache is not valid")
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("account key in the cache is not valid: %w", err)
+		}
+		return key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate account key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode account key: %w", err)
+	}
+	err = m.cache.Put(ctx, cacheKeyAccount, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store account key in the cache: %w", err)
+	}
+
+	return key, nil
+}
+
+// loadCachedCert loads the certificate from the cache, if present
+func (m *Manager) loadCachedCert(ctx context.Context) error {
+	data, err := m.cache.Get(ctx, cacheKeyCert)
+	if errors.Is(err, autocert.ErrCacheMiss) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read certificate from the cache: %w", err)
+	}
+
+	cert, err := decodeCert(data)
+	if err != nil {
+		return err
+	}
+	m.cert.Store(cert)
+	return nil
+}
+
+// encodeCert encodes the private key and the certificate chain as PEM
+func encodeCert(key *ecdsa.PrivateKey, chain [][]byte) ([]byte, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, der := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return data, nil
+}
+
+// decodeCert decodes a private key and certificate chain encoded as PEM
+func decodeCert(data []byte) (*tls.Certificate, error) {
+	// Blocks of other types are ignored, so the same data can be used for both arguments
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return &cert, nil
+}
@@ -0,0 +1,158 @@
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	acmeapi "golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/italypaleale/ddup/pkg/buildinfo"
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/logging"
+)
+
+const (
+	// Interval for checking whether the certificate needs to be renewed
+	renewCheckInterval = 12 * time.Hour
+	// Certificates are renewed when they expire within this duration
+	renewBefore = 30 * 24 * time.Hour
+	// Initial delay before retrying after a failure to obtain a certificate
+	initialRetryDelay = time.Minute
+)
+
+// Manager obtains and renews the server's certificate using ACME
+// With the http-01 challenge, certificates are managed by autocert, which obtains them on demand
+// With the dns-01 challenge, certificates are obtained in the background, creating TXT records with a DNS provider
+type Manager struct {
+	cfg   config.ConfigACME
+	cache autocert.Cache
+
+	// Used with the http-01 challenge
+	autocert *autocert.Manager
+
+	// Used with the dns-01 challenge
+	client   *acmeapi.Client
+	provider dns.TXTRecordProvider
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// NewManager returns a new Manager
+// For the dns-01 challenge, the provider is selected from the list of DNS providers
+func NewManager(cfg config.ConfigACME, dnsProviders map[string]dns.Provider) (*Manager, error) {
+	m := &Manager{
+		cfg:   cfg,
+		cache: autocert.DirCache(cfg.CacheDir),
+	}
+
+	client := &acmeapi.Client{
+		DirectoryURL: cfg.DirectoryURL,
+		UserAgent:    buildinfo.AppName + "/" + buildinfo.AppVersion,
+	}
+
+	switch cfg.Challenge {
+	case config.ACMEChallengeDNS01:
+		provider, ok := dnsProviders[cfg.Provider].(dns.TXTRecordProvider)
+		if !ok {
+			return nil, fmt.Errorf("DNS provider '%s' does not support TXT records", cfg.Provider)
+		}
+		m.provider = provider
+		m.client = client
+	default:
+		m.autocert = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      m.cache,
+			HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+			Email:      cfg.Email,
+			Client:     client,
+		}
+	}
+
+	return m, nil
+}
+
+// TLSConfig returns the TLS configuration for the server
+func (m *Manager) TLSConfig() *tls.Config {
+	if m.autocert != nil {
+		return m.autocert.TLSConfig()
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.getCertificate,
+	}
+}
+
+// HTTPHandler returns the handler for http-01 challenges, which redirects all other requests to HTTPS
+// It returns nil if the http-01 challenge is not used
+func (m *Manager) HTTPHandler() http.Handler {
+	if m.autocert == nil {
+		return nil
+	}
+	return m.autocert.HTTPHandler(nil)
+}
+
+// Run obtains the certificate and renews it until the context is canceled
+func (m *Manager) Run(ctx context.Context) error {
+	// autocert obtains and renews certificates on its own
+	if m.autocert != nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	m.runDNS01(ctx)
+	return nil
+}
+
+func (m *Manager) runDNS01(ctx context.Context) {
+	err := m.loadCachedCert(ctx)
+	if err != nil {
+		logger().WarnContext(ctx, "Failed to load cached certificate, requesting a new one", slog.Any("error", err))
+	}
+
+	retryDelay := initialRetryDelay
+	for {
+		next := renewCheckInterval
+		if m.needsRenewal(time.Now()) {
+			logger().InfoContext(ctx, "Requesting certificate using ACME", slog.Any("domains", m.cfg.Domains))
+			err = m.obtainCert(ctx)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil:
+				logger().ErrorContext(ctx, "Failed to obtain certificate using ACME", slog.Any("error", err), slog.Duration("retryDelay", retryDelay))
+				next = retryDelay
+				retryDelay = min(retryDelay*2, renewCheckInterval)
+			default:
+				logger().InfoContext(ctx, "Obtained certificate using ACME", slog.Time("notAfter", m.cert.Load().Leaf.NotAfter))
+				retryDelay = initialRetryDelay
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next):
+		}
+	}
+}
+
+func (m *Manager) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := m.cert.Load()
+	if cert == nil {
+		return nil, errors.New("certificate has not been obtained yet")
+	}
+	return cert, nil
+}
+
+// logger returns the logger for ACME, which is part of the server
+func logger() *slog.Logger {
+	return logging.Component("server")
+}
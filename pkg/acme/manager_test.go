@@ -0,0 +1,156 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+)
+
+// providerWithoutTXT is a DNS provider that doesn't implement dns.TXTRecordProvider
+type providerWithoutTXT struct{}
+
+func (providerWithoutTXT) Name() string { return "notxt" }
+
+func (providerWithoutTXT) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	return nil
+}
+
+func TestNewManager(t *testing.T) {
+	providers := map[string]dns.Provider{
+		"mock":  dns.NewMockProvider(false),
+		"notxt": providerWithoutTXT{},
+	}
+
+	t.Run("http-01", func(t *testing.T) {
+		m, err := NewManager(config.ConfigACME{
+			Domains:   []string{"ddup.example.com"},
+			Challenge: config.ACMEChallengeHTTP01,
+			CacheDir:  t.TempDir(),
+		}, providers)
+		require.NoError(t, err)
+
+		assert.NotNil(t, m.HTTPHandler())
+		// autocert also supports tls-alpn-01 challenges
+		assert.Contains(t, m.TLSConfig().NextProtos, "acme-tls/1")
+	})
+
+	t.Run("dns-01", func(t *testing.T) {
+		m, err := NewManager(config.ConfigACME{
+			Domains:   []string{"ddup.example.com", "*.ddup.example.com"},
+			Challenge: config.ACMEChallengeDNS01,
+			Provider:  "mock",
+			CacheDir:  t.TempDir(),
+		}, providers)
+		require.NoError(t, err)
+
+		assert.Nil(t, m.HTTPHandler())
+
+		// There's no certificate until it's obtained
+		_, err = m.TLSConfig().GetCertificate(nil)
+		require.Error(t, err)
+	})
+
+	t.Run("dns-01 with provider that doesn't support TXT records", func(t *testing.T) {
+		_, err := NewManager(config.ConfigACME{
+			Domains:   []string{"ddup.example.com"},
+			Challenge: config.ACMEChallengeDNS01,
+			Provider:  "notxt",
+			CacheDir:  t.TempDir(),
+		}, providers)
+		require.ErrorContains(t, err, "DNS provider 'notxt' does not support TXT records")
+	})
+}
+
+func TestCertificateCache(t *testing.T) {
+	newManager := func(t *testing.T, cacheDir string, domains ...string) *Manager {
+		t.Helper()
+		m, err := NewManager(config.ConfigACME{
+			Domains:   domains,
+			Challenge: config.ACMEChallengeDNS01,
+			Provider:  "mock",
+			CacheDir:  cacheDir,
+		}, map[string]dns.Provider{"mock": dns.NewMockProvider(false)})
+		require.NoError(t, err)
+		return m
+	}
+
+	t.Run("Certificate", func(t *testing.T) {
+		cacheDir := t.TempDir()
+		now := time.Now()
+		data := newTestCert(t, now.Add(90*24*time.Hour), "ddup.example.com", "*.ddup.example.com")
+		require.NoError(t, autocert.DirCache(cacheDir).Put(t.Context(), cacheKeyCert, data))
+
+		m := newManager(t, cacheDir, "*.ddup.example.com", "ddup.example.com")
+		assert.True(t, m.needsRenewal(now))
+
+		require.NoError(t, m.loadCachedCert(t.Context()))
+		cert, err := m.TLSConfig().GetCertificate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ddup.example.com", "*.ddup.example.com"}, cert.Leaf.DNSNames)
+
+		// The certificate is renewed when it's about to expire
+		assert.False(t, m.needsRenewal(now))
+		assert.True(t, m.needsRenewal(now.Add(61*24*time.Hour)))
+
+		// The certificate is renewed if the domains change
+		m = newManager(t, cacheDir, "ddup.example.com")
+		require.NoError(t, m.loadCachedCert(t.Context()))
+		assert.True(t, m.needsRenewal(now))
+	})
+
+	t.Run("No cached certificate", func(t *testing.T) {
+		m := newManager(t, t.TempDir(), "ddup.example.com")
+		require.NoError(t, m.loadCachedCert(t.Context()))
+		assert.True(t, m.needsRenewal(time.Now()))
+	})
+
+	t.Run("Account key", func(t *testing.T) {
+		cacheDir := t.TempDir()
+
+		key, err := newManager(t, cacheDir, "ddup.example.com").loadAccountKey(t.Context())
+		require.NoError(t, err)
+
+		// The key is stored and loaded again
+		key2, err := newManager(t, cacheDir, "ddup.example.com").loadAccountKey(t.Context())
+		require.NoError(t, err)
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		require.True(t, ok)
+		assert.True(t, ecKey.Equal(key2))
+	})
+}
+
+// newTestCert returns a self-signed certificate and its key, encoded as PEM
+func newTestCert(t *testing.T, notAfter time.Time, domains ...string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     slices.Clone(domains),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	data, err := encodeCert(key, [][]byte{der})
+	require.NoError(t, err)
+	return data
+}
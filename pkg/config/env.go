@@ -0,0 +1,112 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Matches "${VAR}" references, as well as "$${" which is used to escape a literal "${"
+var envVarRefExp = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+// Matches valid names for environmental variables
+var envVarNameExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ExpandEnv replaces references to environmental variables in the form "${VAR}" with their values, in all string values of the configuration.
+// To include a literal "${" in a value, escape it as "$${".
+// It returns an error if a referenced variable is not set.
+func (c *Config) ExpandEnv() error {
+	errs := make([]error, 0)
+	expandEnvValue(reflect.ValueOf(c).Elem(), &errs)
+	return errors.Join(errs...)
+}
+
+func expandEnvValue(val reflect.Value, errs *[]error) {
+	switch val.Kind() {
+	case reflect.String:
+		res, err := expandEnvString(val.String())
+		if err != nil {
+			*errs = append(*errs, err)
+			return
+		}
+		val.SetString(res)
+
+	case reflect.Pointer:
+		if !val.IsNil() {
+			expandEnvValue(val.Elem(), errs)
+		}
+
+	case reflect.Struct:
+		typ := val.Type()
+		for i := range typ.NumField() {
+			field := typ.Field(i)
+			// Skip unexported fields and fields that aren't loaded from the config file
+			if !field.IsExported() || field.Tag.Get("yaml") == "-" {
+				continue
+			}
+			expandEnvValue(val.Field(i), errs)
+		}
+
+	case reflect.Slice:
+		for i := range val.Len() {
+			expandEnvValue(val.Index(i), errs)
+		}
+
+	case reflect.Map:
+		// Map values are not addressable, so we need to work on a copy
+		iter := val.MapRange()
+		for iter.Next() {
+			v := reflect.New(iter.Value().Type()).Elem()
+			v.Set(iter.Value())
+			expandEnvValue(v, errs)
+			val.SetMapIndex(iter.Key(), v)
+		}
+
+	case reflect.Interface:
+		// Values in maps with interface values, such as the configuration of plugins
+		if !val.IsNil() && val.CanSet() {
+			v := reflect.New(val.Elem().Type()).Elem()
+			v.Set(val.Elem())
+			expandEnvValue(v, errs)
+			val.Set(v)
+		}
+
+	default:
+		// Nop for all other types
+	}
+}
+
+func expandEnvString(s string) (string, error) {
+	// Fast path
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var err error
+	res := envVarRefExp.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+
+		name := match[2 : len(match)-1]
+		if !envVarNameExp.MatchString(name) {
+			err = errors.Join(err, fmt.Errorf("invalid reference to environmental variable '%s'", match))
+			return match
+		}
+
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			err = errors.Join(err, fmt.Errorf("environmental variable '%s' is not set", name))
+			return match
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("DDUP_TEST_TOKEN", "secret-token")
+	t.Setenv("DDUP_TEST_HOST", "example.com")
+
+	t.Run("Expands variables", func(t *testing.T) {
+		cfg := &Config{
+			Domains: []ConfigDomain{
+				{
+					RecordName: "app.${DDUP_TEST_HOST}",
+					Endpoints: []*ConfigEndpoint{
+						{URL: "https://${DDUP_TEST_HOST}/health", IP: "10.0.0.1"},
+					},
+				},
+			},
+			Providers: map[string]ConfigProvider{
+				"p1": {
+					Cloudflare: &CloudflareConfig{APIToken: "${DDUP_TEST_TOKEN}", ZoneID: "zone"},
+				},
+				"p2": {
+					Plugin: &PluginConfig{Command: "ddup-plugin", Config: map[string]any{
+						"token":   "${DDUP_TEST_TOKEN}",
+						"servers": []any{"ns1.${DDUP_TEST_HOST}"},
+						"port":    53,
+					}},
+				},
+			},
+			Server: ConfigServer{
+				APITokens: []string{"${DDUP_TEST_TOKEN}"},
+			},
+		}
+
+		err := cfg.ExpandEnv()
+		require.NoError(t, err)
+
+		assert.Equal(t, "app.example.com", cfg.Domains[0].RecordName)
+		assert.Equal(t, "https://example.com/health", cfg.Domains[0].Endpoints[0].URL)
+		assert.Equal(t, "10.0.0.1", cfg.Domains[0].Endpoints[0].IP)
+		assert.Equal(t, "secret-token", cfg.Providers["p1"].Cloudflare.APIToken)
+		assert.Equal(t, map[string]any{"token": "secret-token", "servers": []any{"ns1.example.com"}, "port": 53}, cfg.Providers["p2"].Plugin.Config)
+		assert.Equal(t, "zone", cfg.Providers["p1"].Cloudflare.ZoneID)
+		assert.Equal(t, []string{"secret-token"}, cfg.Server.APITokens)
+	})
+
+	t.Run("Escaped references", func(t *testing.T) {
+		cfg := &Config{
+			Logs: ConfigLogs{Level: "$${DDUP_TEST_TOKEN}"},
+		}
+
+		err := cfg.ExpandEnv()
+		require.NoError(t, err)
+		assert.Equal(t, "${DDUP_TEST_TOKEN}", cfg.Logs.Level)
+	})
+
+	t.Run("Variable not set", func(t *testing.T) {
+		cfg := &Config{
+			Logs:   ConfigLogs{Level: "${DDUP_TEST_NOT_SET}"},
+			Server: ConfigServer{Bind: StringList{"${DDUP_TEST_ALSO_NOT_SET}"}},
+		}
+
+		err := cfg.ExpandEnv()
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "'DDUP_TEST_NOT_SET' is not set")
+		assert.ErrorContains(t, err, "'DDUP_TEST_ALSO_NOT_SET' is not set")
+	})
+
+	t.Run("Invalid reference", func(t *testing.T) {
+		cfg := &Config{
+			Logs: ConfigLogs{Level: "${not valid}"},
+		}
+
+		err := cfg.ExpandEnv()
+		require.ErrorContains(t, err, "invalid reference")
+	})
+}
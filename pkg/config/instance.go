@@ -7,41 +7,38 @@ import (
 )
 
 var (
-	config *Config
+	// Instance ID, which is the same for all configurations created by the process, including after a reload
+	instanceID string
 
 	defaultDevConfig ConfigDev
 )
 
 func init() {
-	// Set the default config at startup
-	config = GetDefaultConfig()
-
-	// Set the instance ID
+	// Set the instance ID at startup
 	// This may panic if there's not enough entropy in the system
 	var err error
-	config.internal.instanceID, err = configkit.GetInstanceID()
+	instanceID, err = configkit.GetInstanceID()
 	if err != nil {
 		panic("failed to set instance ID: " + err.Error())
 	}
 }
 
-// Get returns the singleton instance
-func Get() *Config {
-	return config
-}
-
 // GetDefaultConfig returns the default configuration.
 func GetDefaultConfig() *Config {
 	return &Config{
-		Interval: 30 * time.Second,
+		Interval:        30 * time.Second,
+		PreflightChecks: true,
 		Logs: ConfigLogs{
 			Level: "info",
 		},
 		Server: ConfigServer{
 			Enabled: false,
-			Bind:    "127.0.0.1",
+			Bind:    StringList{"127.0.0.1"},
 			Port:    7401,
 		},
 		Dev: defaultDevConfig,
+		internal: internal{
+			instanceID: instanceID,
+		},
 	}
 }
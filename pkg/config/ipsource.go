@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// Types of sources for the IP of endpoints
+const (
+	// IP set with the ip option
+	IPSourceStatic = "static"
+	// Public IP of the machine, detected with external services
+	IPSourcePublic = "public"
+	// External IP of the local gateway
+	IPSourceGateway = "gateway"
+	// Address of a network interface
+	IPSourceInterface = "interface"
+	// Address a hostname resolves to
+	IPSourceDNS = "dns"
+	// Address printed by a command
+	IPSourceCommand = "command"
+)
+
+// Address families for IP sources
+const (
+	IPFamilyAny  = ""
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+)
+
+// Matches valid hostnames, which are resolved by endpoints with ipFrom set to "dns:<hostname>"
+var hostnameRegexp = regexp.MustCompile(`^([a-z0-9_]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// IPSource is the source of the IP of an endpoint
+type IPSource struct {
+	// Type of the source, one of the IPSource* constants
+	Type string
+	// Value for the source, which depends on the type: the IP for static sources, the name of the interface, the hostname, or the command line
+	Value string
+	// Address family, one of the IPFamily* constants
+	Family string
+}
+
+// ParseIPFrom parses the value of the ipFrom option of an endpoint
+func ParseIPFrom(ipFrom string) (IPSource, error) {
+	typ, rest, _ := strings.Cut(ipFrom, ":")
+	src := IPSource{Type: typ}
+	switch typ {
+	case IPSourcePublic:
+		switch rest {
+		case "", IPFamilyIPv4:
+			src.Family = IPFamilyIPv4
+		case IPFamilyIPv6:
+			src.Family = IPFamilyIPv6
+		default:
+			return IPSource{}, fmt.Errorf("ipFrom '%s' is not supported: family must be 'ipv4' or 'ipv6'", ipFrom)
+		}
+	case IPSourceGateway:
+		if rest != "" && rest != IPFamilyIPv4 {
+			return IPSource{}, fmt.Errorf("ipFrom '%s' is not supported: gateways return IPv4 addresses only", ipFrom)
+		}
+		src.Family = IPFamilyIPv4
+	case IPSourceInterface:
+		src.Value, src.Family = cutIPFamily(rest)
+		if src.Value == "" || strings.ContainsAny(src.Value, " \t\r\n/") {
+			return IPSource{}, fmt.Errorf("ipFrom '%s' does not contain a valid interface name", ipFrom)
+		}
+	case IPSourceDNS:
+		src.Value, src.Family = cutIPFamily(rest)
+		src.Value = strings.TrimSuffix(strings.ToLower(src.Value), ".")
+		if !hostnameRegexp.MatchString(src.Value) {
+			return IPSource{}, fmt.Errorf("ipFrom '%s' does not contain a valid hostname", ipFrom)
+		}
+	case IPSourceCommand:
+		src.Value = strings.TrimSpace(rest)
+		if src.Value == "" {
+			return IPSource{}, fmt.Errorf("ipFrom '%s' does not contain a command", ipFrom)
+		}
+	default:
+		return IPSource{}, fmt.Errorf("ipFrom '%s' is not supported", ipFrom)
+	}
+
+	return src, nil
+}
+
+// ParseSourceAddress parses the value of the sourceAddress option of health checks
+// The value is an IP address, or "interface:<name>" optionally followed by ":ipv4" or ":ipv6" to use an address of a network interface
+func ParseSourceAddress(sourceAddress string) (IPSource, error) {
+	if rest, ok := strings.CutPrefix(sourceAddress, IPSourceInterface+":"); ok {
+		src := IPSource{Type: IPSourceInterface}
+		src.Value, src.Family = cutIPFamily(rest)
+		if src.Value == "" || strings.ContainsAny(src.Value, " \t\r\n/") {
+			return IPSource{}, fmt.Errorf("sourceAddress '%s' does not contain a valid interface name", sourceAddress)
+		}
+		return src, nil
+	}
+
+	addr, err := netip.ParseAddr(sourceAddress)
+	if err != nil {
+		return IPSource{}, fmt.Errorf("sourceAddress '%s' must be an IP address or 'interface:<name>'", sourceAddress)
+	}
+	return IPSource{Type: IPSourceStatic, Value: addr.Unmap().String()}, nil
+}
+
+// formatSourceAddress returns the source in the format of the sourceAddress option
+func formatSourceAddress(src IPSource) string {
+	if src.Type == IPSourceStatic {
+		return src.Value
+	}
+	return src.String()
+}
+
+// cutIPFamily removes the ":ipv4" or ":ipv6" suffix from the value, and returns the family
+func cutIPFamily(val string) (string, string) {
+	if v, ok := strings.CutSuffix(val, ":"+IPFamilyIPv4); ok {
+		return v, IPFamilyIPv4
+	}
+	if v, ok := strings.CutSuffix(val, ":"+IPFamilyIPv6); ok {
+		return v, IPFamilyIPv6
+	}
+	return val, IPFamilyAny
+}
+
+// String returns the source in the format of the ipFrom option
+func (s IPSource) String() string {
+	res := s.Type
+	if s.Value != "" {
+		res += ":" + s.Value
+	}
+	if s.Family != IPFamilyAny && s.Type != IPSourceGateway {
+		res += ":" + s.Family
+	}
+	return res
+}
+
+// GetIPSource returns the source of the IP of the endpoint
+func (e ConfigEndpoint) GetIPSource() (IPSource, error) {
+	if e.IPFrom == "" {
+		return IPSource{Type: IPSourceStatic, Value: e.IP}, nil
+	}
+	return ParseIPFrom(e.IPFrom)
+}
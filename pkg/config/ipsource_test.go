@@ -0,0 +1,76 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPFrom(t *testing.T) {
+	tests := []struct {
+		ipFrom     string
+		want       IPSource
+		normalized string
+		err        string
+	}{
+		{ipFrom: "public", want: IPSource{Type: IPSourcePublic, Family: IPFamilyIPv4}, normalized: "public:ipv4"},
+		{ipFrom: "public:ipv6", want: IPSource{Type: IPSourcePublic, Family: IPFamilyIPv6}, normalized: "public:ipv6"},
+		{ipFrom: "public:eth0", err: "family must be 'ipv4' or 'ipv6'"},
+		{ipFrom: "gateway", want: IPSource{Type: IPSourceGateway, Family: IPFamilyIPv4}, normalized: "gateway"},
+		{ipFrom: "gateway:ipv6", err: "gateways return IPv4 addresses only"},
+		{ipFrom: "interface:eth0", want: IPSource{Type: IPSourceInterface, Value: "eth0"}, normalized: "interface:eth0"},
+		{ipFrom: "interface:eth0:ipv6", want: IPSource{Type: IPSourceInterface, Value: "eth0", Family: IPFamilyIPv6}, normalized: "interface:eth0:ipv6"},
+		{ipFrom: "interface:", err: "does not contain a valid interface name"},
+		{ipFrom: "dns:Origin.Example.NET.", want: IPSource{Type: IPSourceDNS, Value: "origin.example.net"}, normalized: "dns:origin.example.net"},
+		{ipFrom: "dns:origin.example.net:ipv4", want: IPSource{Type: IPSourceDNS, Value: "origin.example.net", Family: IPFamilyIPv4}, normalized: "dns:origin.example.net:ipv4"},
+		{ipFrom: "dns:origin example.net", err: "does not contain a valid hostname"},
+		{ipFrom: "command: /usr/local/bin/get-ip --iface wan ", want: IPSource{Type: IPSourceCommand, Value: "/usr/local/bin/get-ip --iface wan"}, normalized: "command:/usr/local/bin/get-ip --iface wan"},
+		{ipFrom: "command:", err: "does not contain a command"},
+		{ipFrom: "static:10.0.0.1", err: "is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ipFrom, func(t *testing.T) {
+			src, err := ParseIPFrom(tt.ipFrom)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, src)
+			assert.Equal(t, tt.normalized, src.String())
+		})
+	}
+}
+
+func TestParseSourceAddress(t *testing.T) {
+	tests := []struct {
+		sourceAddress string
+		want          IPSource
+		normalized    string
+		err           string
+	}{
+		{sourceAddress: "192.168.1.10", want: IPSource{Type: IPSourceStatic, Value: "192.168.1.10"}, normalized: "192.168.1.10"},
+		{sourceAddress: "::ffff:192.168.1.10", want: IPSource{Type: IPSourceStatic, Value: "192.168.1.10"}, normalized: "192.168.1.10"},
+		{sourceAddress: "2001:db8::1", want: IPSource{Type: IPSourceStatic, Value: "2001:db8::1"}, normalized: "2001:db8::1"},
+		{sourceAddress: "interface:wan0", want: IPSource{Type: IPSourceInterface, Value: "wan0"}, normalized: "interface:wan0"},
+		{sourceAddress: "interface:wan0:ipv6", want: IPSource{Type: IPSourceInterface, Value: "wan0", Family: IPFamilyIPv6}, normalized: "interface:wan0:ipv6"},
+		{sourceAddress: "interface:", err: "does not contain a valid interface name"},
+		{sourceAddress: "wan0", err: "must be an IP address or 'interface:<name>'"},
+		{sourceAddress: "public", err: "must be an IP address or 'interface:<name>'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sourceAddress, func(t *testing.T) {
+			src, err := ParseSourceAddress(tt.sourceAddress)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, src)
+			assert.Equal(t, tt.normalized, formatSourceAddress(src))
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	configkit "github.com/italypaleale/go-kit/config"
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// Formats for configuration documents
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+const (
+	// Environmental variable containing the path to the configuration file
+	configFileEnvVar = "DDUP_CONFIG"
+	// Name of the folder containing the configuration file, in the home directory and in /etc
+	configDirName = "ddup"
+)
+
+// Names of configuration files that are searched, in order
+var configFileNames = []string{"config.yaml", "config.yml", "config.json", "config.toml"}
+
+// Load finds the configuration file and parses it
+// The path of the file is read from the DDUP_CONFIG environmental variable, or the file is searched in the default folders.
+// The configuration is not validated.
+func Load() (*Config, error) {
+	filePath := os.Getenv(configFileEnvVar)
+	if filePath != "" {
+		info, err := os.Stat(filePath)
+		if err != nil || info.IsDir() {
+			return nil, configkit.NewConfigError("Environmental variable "+configFileEnvVar+" points to a file that does not exist", "Error loading config file")
+		}
+	} else {
+		filePath = findConfigFile()
+		if filePath == "" {
+			return nil, configkit.NewConfigError("Could not find a configuration file config.yaml (or config.json, config.toml) in the current folder, '~/."+configDirName+"', or '/etc/"+configDirName+"'", "Error loading config file")
+		}
+	}
+
+	f, err := os.Open(filePath) //nolint:gosec
+	if err != nil {
+		return nil, configkit.NewConfigError(fmt.Errorf("failed to open config file '%s': %w", filePath, err), "Error loading config file")
+	}
+	defer f.Close() //nolint:errcheck
+
+	cfg, err := ParseFormat(f, FormatFromPath(filePath))
+	if err != nil {
+		return nil, configkit.NewConfigError(fmt.Errorf("failed to load config file '%s': %w", filePath, err), "Error loading config file")
+	}
+
+	cfg.SetLoadedConfigPath(filePath)
+	return cfg, nil
+}
+
+// findConfigFile looks for the configuration file in the default folders
+// It returns an empty string if no file is found
+func findConfigFile() string {
+	searchPaths := []string{".", "/etc/" + configDirName}
+	home, err := os.UserHomeDir()
+	if err == nil && home != "" {
+		searchPaths = []string{".", filepath.Join(home, "."+configDirName), "/etc/" + configDirName}
+	}
+
+	for _, name := range configFileNames {
+		for _, dir := range searchPaths {
+			p := filepath.Join(dir, name)
+			info, err := os.Stat(p)
+			if err == nil && !info.IsDir() {
+				return p
+			}
+		}
+	}
+
+	return ""
+}
+
+// FormatFromPath returns the format of a configuration file based on its extension
+// Files with an unknown extension are assumed to be YAML
+func FormatFromPath(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatYAML
+	}
+}
+
+// Parse reads a configuration document in YAML format
+// References to environmental variables are expanded.
+// The returned object starts from the default configuration and it is not validated
+func Parse(r io.Reader) (*Config, error) {
+	return ParseFormat(r, FormatYAML)
+}
+
+// ParseOptions contains options for parsing configuration documents
+type ParseOptions struct {
+	// If true, references to environmental variables are not expanded
+	// This must be set for documents coming from untrusted sources, so the values of environmental variables cannot be exfiltrated through validation errors
+	SkipEnvExpansion bool
+}
+
+// ParseFormat reads a configuration document in the given format
+// All formats use the same keys, which are the ones defined in the "yaml" struct tags.
+// References to environmental variables are expanded.
+// The returned object starts from the default configuration and it is not validated
+func ParseFormat(r io.Reader, format string) (*Config, error) {
+	return ParseFormatWithOptions(r, format, ParseOptions{})
+}
+
+// ParseFormatWithOptions reads a configuration document in the given format, using the given options
+// The returned object starts from the default configuration and it is not validated
+func ParseFormatWithOptions(r io.Reader, format string, opts ParseOptions) (*Config, error) {
+	switch format {
+	case FormatYAML, FormatJSON:
+		// JSON documents are valid YAML
+		return parseYAML(r, opts)
+	case FormatTOML:
+		// Convert TOML documents to YAML, so we can use the same struct tags and decoding logic
+		var doc map[string]any
+		_, err := toml.NewDecoder(r).Decode(&doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode configuration: %w", err)
+		}
+		if len(doc) == 0 {
+			return nil, errors.New("configuration document is empty")
+		}
+
+		converted, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert configuration: %w", err)
+		}
+		return parseYAML(bytes.NewReader(converted), opts)
+	default:
+		return nil, fmt.Errorf("unsupported configuration format '%s'", format)
+	}
+}
+
+func parseYAML(r io.Reader, opts ParseOptions) (*Config, error) {
+	cfg := GetDefaultConfig()
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	err := dec.Decode(cfg)
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("configuration document is empty")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+
+	if !opts.SkipEnvExpansion {
+		err = cfg.ExpandEnv()
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand environmental variables: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// StringList is a list of strings that can be set in configuration documents as a single string, or as a list
+type StringList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = StringList{value.Value}
+		return nil
+	}
+
+	var list []string
+	err := value.Decode(&list)
+	if err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
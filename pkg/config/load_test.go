@@ -0,0 +1,239 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testYAMLConfig = `
+interval: 30s
+domains:
+  - recordName: app.example.com
+    provider: cf
+    ttl: 120
+    endpoints:
+      - url: https://10.0.0.1/health
+        ip: 10.0.0.1
+providers:
+  cf:
+    cloudflare:
+      apiToken: token
+      zoneId: zone
+    maintenanceWindows:
+      - start: 2026-01-01T00:00:00Z
+        end: 2026-01-01T02:00:00Z
+`
+
+const testJSONConfig = `{
+  "interval": "30s",
+  "domains": [
+    {
+      "recordName": "app.example.com",
+      "provider": "cf",
+      "ttl": 120,
+      "endpoints": [
+        {"url": "https://10.0.0.1/health", "ip": "10.0.0.1"}
+      ]
+    }
+  ],
+  "providers": {
+    "cf": {
+      "cloudflare": {"apiToken": "token", "zoneId": "zone"},
+      "maintenanceWindows": [
+        {"start": "2026-01-01T00:00:00Z", "end": "2026-01-01T02:00:00Z"}
+      ]
+    }
+  }
+}`
+
+const testTOMLConfig = `
+interval = "30s"
+
+[[domains]]
+recordName = "app.example.com"
+provider = "cf"
+ttl = 120
+
+[[domains.endpoints]]
+url = "https://10.0.0.1/health"
+ip = "10.0.0.1"
+
+[providers.cf.cloudflare]
+apiToken = "token"
+zoneId = "zone"
+
+[[providers.cf.maintenanceWindows]]
+start = 2026-01-01T00:00:00Z
+end = 2026-01-01T02:00:00Z
+`
+
+func TestParseFormat(t *testing.T) {
+	assertConfig := func(t *testing.T, cfg *Config) {
+		t.Helper()
+
+		assert.Equal(t, 30*time.Second, cfg.Interval)
+		require.Len(t, cfg.Domains, 1)
+		assert.Equal(t, "app.example.com", cfg.Domains[0].RecordName)
+		assert.Equal(t, "cf", cfg.Domains[0].Provider)
+		assert.Equal(t, 120, cfg.Domains[0].TTL)
+		require.Len(t, cfg.Domains[0].Endpoints, 1)
+		assert.Equal(t, "https://10.0.0.1/health", cfg.Domains[0].Endpoints[0].URL)
+		assert.Equal(t, "10.0.0.1", cfg.Domains[0].Endpoints[0].IP)
+		require.Contains(t, cfg.Providers, "cf")
+		require.NotNil(t, cfg.Providers["cf"].Cloudflare)
+		assert.Equal(t, "token", cfg.Providers["cf"].Cloudflare.APIToken)
+		assert.Equal(t, "zone", cfg.Providers["cf"].Cloudflare.ZoneID)
+		require.Len(t, cfg.Providers["cf"].MaintenanceWindows, 1)
+		assert.True(t, cfg.Providers["cf"].MaintenanceWindows[0].Start.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.True(t, cfg.Providers["cf"].MaintenanceWindows[0].End.Equal(time.Date(2026, 1, 1, 2, 0, 0, 0, time.UTC)))
+
+		// Defaults are preserved
+		assert.Equal(t, GetDefaultConfig().Server.Port, cfg.Server.Port)
+	}
+
+	t.Run("YAML", func(t *testing.T) {
+		cfg, err := ParseFormat(strings.NewReader(testYAMLConfig), FormatYAML)
+		require.NoError(t, err)
+		assertConfig(t, cfg)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		cfg, err := ParseFormat(strings.NewReader(testJSONConfig), FormatJSON)
+		require.NoError(t, err)
+		assertConfig(t, cfg)
+	})
+
+	t.Run("TOML", func(t *testing.T) {
+		cfg, err := ParseFormat(strings.NewReader(testTOMLConfig), FormatTOML)
+		require.NoError(t, err)
+		assertConfig(t, cfg)
+	})
+
+	t.Run("Unknown keys are rejected", func(t *testing.T) {
+		_, err := ParseFormat(strings.NewReader(`{"notAKey": 1}`), FormatJSON)
+		require.Error(t, err)
+
+		_, err = ParseFormat(strings.NewReader(`notAKey = 1`), FormatTOML)
+		require.Error(t, err)
+	})
+
+	t.Run("Empty documents", func(t *testing.T) {
+		_, err := ParseFormat(strings.NewReader(""), FormatJSON)
+		require.ErrorContains(t, err, "empty")
+
+		_, err = ParseFormat(strings.NewReader(""), FormatTOML)
+		require.ErrorContains(t, err, "empty")
+	})
+
+	t.Run("Invalid TOML", func(t *testing.T) {
+		_, err := ParseFormat(strings.NewReader(`interval = `), FormatTOML)
+		require.Error(t, err)
+	})
+
+	t.Run("Unsupported format", func(t *testing.T) {
+		_, err := ParseFormat(strings.NewReader(testYAMLConfig), "xml")
+		require.ErrorContains(t, err, "unsupported")
+	})
+
+	t.Run("String lists", func(t *testing.T) {
+		cfg, err := ParseFormat(strings.NewReader("server:\n  bind: 127.0.0.1\n"), FormatYAML)
+		require.NoError(t, err)
+		assert.Equal(t, StringList{"127.0.0.1"}, cfg.Server.Bind)
+
+		cfg, err = ParseFormat(strings.NewReader("server:\n  bind: [127.0.0.1, 100.64.0.1]\n"), FormatYAML)
+		require.NoError(t, err)
+		assert.Equal(t, StringList{"127.0.0.1", "100.64.0.1"}, cfg.Server.Bind)
+
+		cfg, err = ParseFormat(strings.NewReader(`{"server": {"bind": ["127.0.0.1", "::1"]}}`), FormatJSON)
+		require.NoError(t, err)
+		assert.Equal(t, StringList{"127.0.0.1", "::1"}, cfg.Server.Bind)
+
+		cfg, err = ParseFormat(strings.NewReader("[server]\nbind = [\"127.0.0.1\", \"100.64.0.1\"]\n"), FormatTOML)
+		require.NoError(t, err)
+		assert.Equal(t, StringList{"127.0.0.1", "100.64.0.1"}, cfg.Server.Bind)
+
+		_, err = ParseFormat(strings.NewReader("server:\n  bind:\n    a: b\n"), FormatYAML)
+		require.Error(t, err)
+	})
+
+	t.Run("Skip env expansion", func(t *testing.T) {
+		t.Setenv("DDUP_TEST_PARSE_SECRET", "secret")
+
+		cfg, err := ParseFormat(strings.NewReader(`stateFile: "${DDUP_TEST_PARSE_SECRET}"`), FormatYAML)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", cfg.StateFile)
+
+		cfg, err = ParseFormatWithOptions(strings.NewReader(`stateFile: "${DDUP_TEST_PARSE_SECRET}"`), FormatYAML, ParseOptions{SkipEnvExpansion: true})
+		require.NoError(t, err)
+		assert.Equal(t, "${DDUP_TEST_PARSE_SECRET}", cfg.StateFile)
+	})
+}
+
+func TestFormatFromPath(t *testing.T) {
+	assert.Equal(t, FormatYAML, FormatFromPath("/etc/ddup/config.yaml"))
+	assert.Equal(t, FormatYAML, FormatFromPath("config.yml"))
+	assert.Equal(t, FormatJSON, FormatFromPath("config.json"))
+	assert.Equal(t, FormatJSON, FormatFromPath("CONFIG.JSON"))
+	assert.Equal(t, FormatTOML, FormatFromPath("/home/user/.ddup/config.toml"))
+	assert.Equal(t, FormatYAML, FormatFromPath("config"))
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Loads the file from the env var", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "custom.toml")
+		require.NoError(t, os.WriteFile(filePath, []byte(testTOMLConfig), 0o600))
+		t.Setenv(configFileEnvVar, filePath)
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, filePath, cfg.GetLoadedConfigPath())
+		assert.Equal(t, "app.example.com", cfg.Domains[0].RecordName)
+	})
+
+	t.Run("Searches the current folder", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(testJSONConfig), 0o600))
+		t.Chdir(dir)
+		t.Setenv(configFileEnvVar, "")
+		t.Setenv("HOME", t.TempDir())
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, "config.json", cfg.GetLoadedConfigPath())
+		assert.Equal(t, 30*time.Second, cfg.Interval)
+	})
+
+	t.Run("YAML is preferred", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(testJSONConfig), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(testYAMLConfig), 0o600))
+		t.Chdir(dir)
+		t.Setenv(configFileEnvVar, "")
+		t.Setenv("HOME", t.TempDir())
+
+		cfg, err := Load()
+		require.NoError(t, err)
+		assert.Equal(t, "config.yaml", cfg.GetLoadedConfigPath())
+	})
+
+	t.Run("File in env var does not exist", func(t *testing.T) {
+		t.Setenv(configFileEnvVar, filepath.Join(t.TempDir(), "missing.yaml"))
+
+		_, err := Load()
+		require.Error(t, err)
+	})
+}
+
+func TestInstanceID(t *testing.T) {
+	// Configurations parsed after a reload keep the same instance ID
+	cfg, err := ParseFormat(strings.NewReader(testYAMLConfig), FormatYAML)
+	require.NoError(t, err)
+	assert.NotEmpty(t, cfg.GetInstanceID())
+	assert.Equal(t, GetDefaultConfig().GetInstanceID(), cfg.GetInstanceID())
+}
@@ -0,0 +1,189 @@
+// Package ddup exposes the engine that checks the health of endpoints and updates DNS records, so it can be embedded in other Go programs.
+//
+// Domains are configured with the same options as in the configuration file, and they use DNS providers that are registered with the engine by name.
+// Logs are written with the default slog logger, and its level can be changed with slog.SetLogLoggerLevel.
+package ddup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/events"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+	"github.com/italypaleale/ddup/pkg/logging"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+)
+
+type (
+	// Domain is the configuration of a domain, with the same options as the domains in the configuration file
+	Domain = config.ConfigDomain
+	// Endpoint is the configuration of an endpoint of a domain
+	Endpoint = config.ConfigEndpoint
+	// Provider is a DNS provider, which updates the records of domains
+	// Providers can implement the optional interfaces in the dns package, such as dns.WeightedProvider, to support more features
+	Provider = dns.Provider
+	// DomainStatus is the status of a domain and its endpoints
+	DomainStatus = healthcheck.DomainStatus
+)
+
+// Options for the engine
+type Options struct {
+	// Interval between check cycles
+	// +default 30s
+	Interval time.Duration
+	// Maximum random delay for the checks of each domain within a cycle
+	// +default 0
+	Jitter time.Duration
+	// Metrics, which can be nil to disable them
+	Metrics *appmetrics.AppMetrics
+	// Bus that receives the state transitions of domains and endpoints, which can be nil
+	Events *events.Bus
+}
+
+// Engine checks the health of the endpoints of domains, and updates their DNS records with the providers
+// Multiple engines can run in the same process, independently of each other
+type Engine struct {
+	opts Options
+
+	// Lock for the fields below
+	lock      sync.Mutex
+	providers map[string]dns.Provider
+	domains   []config.ConfigDomain
+	// Health checker, which is set while the engine is running
+	hc *healthcheck.HealthChecker
+}
+
+// NewEngine returns a new Engine
+// Providers must be registered and domains added before the engine is started with Run; domains can be added while it's running too
+func NewEngine(opts Options) *Engine {
+	return &Engine{
+		opts:      opts,
+		providers: map[string]dns.Provider{},
+	}
+}
+
+// RegisterProvider registers a DNS provider with a name, which is referenced by the provider option of domains
+func (e *Engine) RegisterProvider(name string, provider Provider) error {
+	if name == "" {
+		return errors.New("provider name is empty")
+	}
+	if provider == nil {
+		return fmt.Errorf("provider '%s' is nil", name)
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	_, ok := e.providers[name]
+	if ok {
+		return fmt.Errorf("provider '%s' is already registered", name)
+	}
+	e.providers[name] = provider
+	return nil
+}
+
+// AddDomain adds a domain to the engine
+// The domain is validated, and an error is returned if it's invalid, such as if it references a provider that isn't registered
+// If the engine is running, the domain is checked right away
+func (e *Engine) AddDomain(domain Domain) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	domains := append(slices.Clone(e.domains), domain)
+	cfg, err := e.buildConfig(domains)
+	if err != nil {
+		return err
+	}
+
+	if e.hc != nil {
+		err = e.hc.UpdateConfig(cfg, e.providers)
+		if err != nil {
+			return fmt.Errorf("failed to add domain: %w", err)
+		}
+		e.hc.TriggerCheck()
+	}
+
+	e.domains = domains
+	return nil
+}
+
+// Run checks the health of the endpoints and updates the DNS records until the context is canceled
+func (e *Engine) Run(ctx context.Context) error {
+	e.lock.Lock()
+	if e.hc != nil {
+		e.lock.Unlock()
+		return errors.New("engine is already running")
+	}
+	cfg, err := e.buildConfig(e.domains)
+	if err != nil {
+		e.lock.Unlock()
+		return err
+	}
+	hc, err := healthcheck.NewHealthChecker(cfg, e.providers, e.opts.Metrics, e.opts.Events, nil)
+	if err != nil {
+		e.lock.Unlock()
+		return fmt.Errorf("failed to init health checker: %w", err)
+	}
+	e.hc = hc
+	e.lock.Unlock()
+
+	defer func() {
+		e.lock.Lock()
+		e.hc = nil
+		e.lock.Unlock()
+	}()
+
+	return hc.Run(ctx)
+}
+
+// Status returns the status of all domains, keyed by their name
+// It returns nil if the engine is not running
+func (e *Engine) Status() map[string]DomainStatus {
+	e.lock.Lock()
+	hc := e.hc
+	e.lock.Unlock()
+
+	if hc == nil {
+		return nil
+	}
+	return hc.GetAllDomainsStatus()
+}
+
+// buildConfig returns the configuration for the health checker, with the registered providers and the domains
+// Domains are validated with the same rules as in the configuration file
+// This must be invoked while holding the lock
+func (e *Engine) buildConfig(domains []config.ConfigDomain) (*config.Config, error) {
+	cfg := config.GetDefaultConfig()
+	cfg.Interval = cmp.Or(e.opts.Interval, cfg.Interval)
+	cfg.Jitter = e.opts.Jitter
+
+	cfg.Providers = make(map[string]config.ConfigProvider, len(e.providers))
+	for name := range e.providers {
+		cfg.Providers[name] = config.ConfigProvider{Custom: &config.CustomProviderConfig{}}
+	}
+
+	// Validation sets default values, so the domains and their endpoints are copied to leave the caller's unchanged
+	cfg.Domains = make([]config.ConfigDomain, len(domains))
+	for i, d := range domains {
+		d.RecordNames = slices.Clone(d.RecordNames)
+		d.Endpoints = make([]*config.ConfigEndpoint, len(domains[i].Endpoints))
+		for j, ep := range domains[i].Endpoints {
+			epCopy := *ep
+			d.Endpoints[j] = &epCopy
+		}
+		cfg.Domains[i] = d
+	}
+
+	err := cfg.Validate(logging.Component("ddup"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid domains: %w", err)
+	}
+	return cfg, nil
+}
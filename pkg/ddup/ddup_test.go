@@ -0,0 +1,108 @@
+package ddup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider is a provider that records the IPs of the A records it receives
+type testProvider struct {
+	lock    sync.Mutex
+	records map[string][]string
+}
+
+func (p *testProvider) Name() string {
+	return "test"
+}
+
+func (p *testProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.records == nil {
+		p.records = map[string][]string{}
+	}
+	p.records[domain+"/"+recordType] = slices.Clone(ips)
+	return nil
+}
+
+func (p *testProvider) get(key string) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.records[key]
+}
+
+func TestEngine(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	provider := &testProvider{}
+	engine := NewEngine(Options{Interval: time.Hour})
+	require.NoError(t, engine.RegisterProvider("test", provider))
+	require.ErrorContains(t, engine.RegisterProvider("test", provider), "provider 'test' is already registered")
+
+	// Domains are validated
+	err := engine.AddDomain(Domain{
+		RecordName: "app.example.com",
+		Provider:   "missing",
+		Endpoints:  []*Endpoint{{URL: healthy.URL, IP: "10.0.0.1"}},
+	})
+	require.ErrorContains(t, err, "provider 'missing' does not exist")
+
+	err = engine.AddDomain(Domain{
+		RecordName: "app.example.com",
+		Provider:   "test",
+		Endpoints: []*Endpoint{
+			{URL: healthy.URL, IP: "10.0.0.1"},
+			{URL: unhealthy.URL, IP: "10.0.0.2"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, engine.Status())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.Run(ctx)
+	}()
+
+	// The records contain the healthy endpoint only
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, []string{"10.0.0.1"}, provider.get("app.example.com/A"))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := engine.Status()
+	require.Contains(t, status, "app.example.com")
+	assert.Equal(t, "test", status["app.example.com"].Provider)
+
+	// Domains added while the engine is running are checked right away
+	err = engine.AddDomain(Domain{
+		RecordName: "api.example.com",
+		Provider:   "test",
+		Endpoints:  []*Endpoint{{URL: healthy.URL, IP: "10.0.0.3"}},
+	})
+	require.NoError(t, err)
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, []string{"10.0.0.3"}, provider.get("api.example.com/A"))
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, engine.Status(), 2)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Nil(t, engine.Status())
+}
@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// Caddy discovers the upstreams of the reverse proxies of a site, using the Caddy admin API
+type Caddy struct {
+	cfg        config.ConfigDiscoveryCaddy
+	healthPath string
+	httpClient *http.Client
+}
+
+// caddyServer contains the properties of a HTTP server in the Caddy configuration that are relevant for discovery
+type caddyServer struct {
+	Routes []caddyRoute `json:"routes"`
+}
+
+// caddyRoute contains the properties of a route in the Caddy configuration that are relevant for discovery
+type caddyRoute struct {
+	Match []struct {
+		Host []string `json:"host"`
+	} `json:"match"`
+	Handle []caddyHandler `json:"handle"`
+}
+
+// caddyHandler contains the properties of a handler in the Caddy configuration that are relevant for discovery
+// This includes the properties of "reverse_proxy" handlers, and of "subroute" handlers, which contain other routes
+type caddyHandler struct {
+	Handler   string `json:"handler"`
+	Upstreams []struct {
+		Dial string `json:"dial"`
+	} `json:"upstreams"`
+	Transport *struct {
+		TLS json.RawMessage `json:"tls"`
+	} `json:"transport"`
+	Routes []caddyRoute `json:"routes"`
+}
+
+// NewCaddy returns a new Caddy source
+func NewCaddy(cfg config.ConfigDiscoveryCaddy, healthPath string) *Caddy {
+	return &Caddy{
+		cfg:        cfg,
+		healthPath: healthPath,
+		httpClient: tracing.NewHTTPClient(),
+	}
+}
+
+// Endpoints implements the Source interface
+func (c *Caddy) Endpoints(ctx context.Context) ([]*config.ConfigEndpoint, error) {
+	var servers map[string]caddyServer
+	err := getJSON(ctx, c.httpClient, strings.TrimSuffix(c.cfg.URL, "/")+"/config/apps/http/servers", nil, nil, &servers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Caddy configuration: %w", err)
+	}
+
+	// Collect the upstreams of the routes that match the site, in all servers
+	var (
+		found     bool
+		upstreams []caddyUpstream
+	)
+	for _, srv := range servers {
+		for _, route := range srv.Routes {
+			if !route.matchesHost(c.cfg.Site) {
+				continue
+			}
+			found = true
+			upstreams = collectUpstreams(route.Handle, upstreams)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("site '%s' not found in the Caddy configuration", c.cfg.Site)
+	}
+
+	res := make([]*config.ConfigEndpoint, 0, len(upstreams))
+	for _, u := range upstreams {
+		endpoints, err := endpointsForServer(ctx, u.scheme, u.dial, c.healthPath)
+		if err != nil {
+			return nil, fmt.Errorf("site '%s' has an invalid upstream: %w", c.cfg.Site, err)
+		}
+		res = append(res, endpoints...)
+	}
+
+	return sortEndpoints(res), nil
+}
+
+// caddyUpstream is an upstream of a reverse proxy
+type caddyUpstream struct {
+	scheme string
+	dial   string
+}
+
+// matchesHost returns true if the route has a matcher for the host
+func (r caddyRoute) matchesHost(host string) bool {
+	for _, m := range r.Match {
+		for _, h := range m.Host {
+			if strings.EqualFold(h, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectUpstreams appends the upstreams of the reverse proxies in the handlers to res, including those in subroutes
+// Upstreams whose address contains placeholders, which are resolved at runtime, are skipped
+func collectUpstreams(handlers []caddyHandler, res []caddyUpstream) []caddyUpstream {
+	for _, h := range handlers {
+		switch h.Handler {
+		case "reverse_proxy":
+			scheme := "http"
+			if h.Transport != nil && len(h.Transport.TLS) > 0 && string(h.Transport.TLS) != "null" {
+				scheme = "https"
+			}
+			for _, u := range h.Upstreams {
+				if u.Dial == "" || strings.Contains(u.Dial, "{") {
+					continue
+				}
+				res = append(res, caddyUpstream{scheme: scheme, dial: u.Dial})
+			}
+		case "subroute":
+			for _, r := range h.Routes {
+				res = collectUpstreams(r.Handle, res)
+			}
+		}
+	}
+	return res
+}
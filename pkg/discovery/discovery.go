@@ -0,0 +1,134 @@
+package discovery
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+const (
+	// Timeout for requests to the APIs used for discovery
+	requestTimeout = 10 * time.Second
+	// Maximum number of bytes read from responses
+	maxBodySize = 4 << 20
+)
+
+// Source returns the endpoints of a domain discovered from an external system
+type Source interface {
+	// Endpoints returns the list of endpoints that are currently discovered, sorted by URL
+	Endpoints(ctx context.Context) ([]*config.ConfigEndpoint, error)
+}
+
+// New returns the Source for the discovery configuration
+func New(cfg *config.ConfigDiscovery) (Source, error) {
+	switch {
+	case cfg == nil:
+		return nil, errors.New("discovery is not configured")
+	case cfg.Traefik != nil:
+		return NewTraefik(*cfg.Traefik, cfg.HealthPath), nil
+	case cfg.Caddy != nil:
+		return NewCaddy(*cfg.Caddy, cfg.HealthPath), nil
+	case cfg.HTTP != nil:
+		return NewHTTP(*cfg.HTTP), nil
+	default:
+		return nil, errors.New("no discovery source is configured")
+	}
+}
+
+// getJSON sends a GET request to the URL and decodes the JSON response into res
+func getJSON(ctx context.Context, client *http.Client, u string, headers map[string]string, basicAuth *config.ConfigBasicAuth, res any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if basicAuth != nil {
+		req.SetBasicAuth(basicAuth.Username, basicAuth.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed: status code %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxBodySize)).Decode(res)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
+
+// endpointsForServer returns the endpoints for a server, identified by the scheme and its address in the "host:port" format
+// If the host is a name, it's resolved, and an endpoint is returned for each of its addresses
+// The health check URL is built with the IP of the endpoint, so each address is checked individually
+func endpointsForServer(ctx context.Context, scheme string, hostPort string, healthPath string) ([]*config.ConfigEndpoint, error) {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		// The address doesn't include a port, so use the default one for the scheme
+		host = hostPort
+		port = "80"
+		if scheme == "https" {
+			port = "443"
+		}
+	}
+
+	var addrs []netip.Addr
+	addr, err := netip.ParseAddr(host)
+	if err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve '%s': %w", host, err)
+		}
+	}
+
+	res := make([]*config.ConfigEndpoint, 0, len(addrs))
+	for _, a := range addrs {
+		a = a.Unmap()
+		name := scheme + "://" + net.JoinHostPort(host, port)
+		if a.String() != host {
+			name += " (" + a.String() + ")"
+		}
+		res = append(res, &config.ConfigEndpoint{
+			Name: name,
+			Type: config.EndpointTypeURL,
+			URL:  scheme + "://" + net.JoinHostPort(a.String(), port) + healthPath,
+			IP:   a.String(),
+		})
+	}
+
+	return res, nil
+}
+
+// sortEndpoints sorts endpoints by URL and removes duplicates
+func sortEndpoints(endpoints []*config.ConfigEndpoint) []*config.ConfigEndpoint {
+	slices.SortFunc(endpoints, func(a, b *config.ConfigEndpoint) int {
+		return cmp.Compare(a.URL, b.URL)
+	})
+	return slices.CompactFunc(endpoints, func(a, b *config.ConfigEndpoint) bool {
+		return a.URL == b.URL
+	})
+}
@@ -0,0 +1,245 @@
+package discovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// newTestAPI returns a server that responds to GET requests for the given paths with the JSON documents
+func newTestAPI(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok || r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// endpointURLs returns the health check URLs and IPs of the endpoints
+func endpointURLs(endpoints []*config.ConfigEndpoint) map[string]string {
+	res := make(map[string]string, len(endpoints))
+	for _, e := range endpoints {
+		res[e.URL] = e.IP
+	}
+	return res
+}
+
+func TestTraefik(t *testing.T) {
+	srv := newTestAPI(t, map[string]string{
+		"/api/http/routers/web@docker":      `{"name":"web@docker","provider":"docker","service":"web"}`,
+		"/api/http/services/web@docker":     `{"loadBalancer":{"servers":[{"url":"http://172.18.0.3:8080"},{"url":"http://172.18.0.2:8080"}]}}`,
+		"/api/http/routers/other@file":      `{"name":"other@file","provider":"file","service":"split@file"}`,
+		"/api/http/services/split@file":     `{"weighted":{"services":[{"name":"a"},{"name":"b"}]}}`,
+		"/api/http/routers/h2c@file":        `{"name":"h2c@file","provider":"file","service":"grpc@docker"}`,
+		"/api/http/services/grpc@docker":    `{"loadBalancer":{"servers":[{"url":"h2c://[2001:db8::1]:9000"}]}}`,
+		"/api/http/routers/invalid@docker":  `{"name":"invalid@docker","provider":"docker","service":"invalid"}`,
+		"/api/http/services/invalid@docker": `{"loadBalancer":{"servers":[{"url":"not a url"}]}}`,
+	})
+
+	t.Run("Servers of the router's service", func(t *testing.T) {
+		src := NewTraefik(config.ConfigDiscoveryTraefik{URL: srv.URL, Router: "web@docker"}, "/healthz")
+		endpoints, err := src.Endpoints(t.Context())
+		require.NoError(t, err)
+		require.Len(t, endpoints, 2)
+
+		// Endpoints are sorted by URL
+		assert.Equal(t, "http://172.18.0.2:8080/healthz", endpoints[0].URL)
+		assert.Equal(t, "172.18.0.2", endpoints[0].IP)
+		assert.Equal(t, "http://172.18.0.2:8080", endpoints[0].Name)
+		assert.Equal(t, config.EndpointTypeURL, endpoints[0].Type)
+		assert.Equal(t, "http://172.18.0.3:8080/healthz", endpoints[1].URL)
+		assert.Equal(t, "172.18.0.3", endpoints[1].IP)
+	})
+
+	t.Run("Service of another provider", func(t *testing.T) {
+		src := NewTraefik(config.ConfigDiscoveryTraefik{URL: srv.URL + "/", Router: "h2c@file"}, "/")
+		endpoints, err := src.Endpoints(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"http://[2001:db8::1]:9000/": "2001:db8::1"}, endpointURLs(endpoints))
+	})
+
+	t.Run("Service is not a load balancer", func(t *testing.T) {
+		src := NewTraefik(config.ConfigDiscoveryTraefik{URL: srv.URL, Router: "other@file"}, "/")
+		_, err := src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "service 'split@file' is not a load balancer")
+	})
+
+	t.Run("Invalid server URL", func(t *testing.T) {
+		src := NewTraefik(config.ConfigDiscoveryTraefik{URL: srv.URL, Router: "invalid@docker"}, "/")
+		_, err := src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "invalid URL 'not a url'")
+	})
+
+	t.Run("Router not found", func(t *testing.T) {
+		src := NewTraefik(config.ConfigDiscoveryTraefik{URL: srv.URL, Router: "missing@docker"}, "/")
+		_, err := src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "failed to get Traefik router 'missing@docker': request failed: status code 404")
+	})
+
+	t.Run("Basic auth", func(t *testing.T) {
+		authSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != "admin" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			srv.Config.Handler.ServeHTTP(w, r)
+		}))
+		defer authSrv.Close()
+
+		src := NewTraefik(config.ConfigDiscoveryTraefik{URL: authSrv.URL, Router: "web@docker"}, "/")
+		_, err := src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "status code 401")
+
+		src = NewTraefik(config.ConfigDiscoveryTraefik{
+			URL:       authSrv.URL,
+			Router:    "web@docker",
+			BasicAuth: &config.ConfigBasicAuth{Username: "admin", Password: "secret"},
+		}, "/")
+		endpoints, err := src.Endpoints(t.Context())
+		require.NoError(t, err)
+		assert.Len(t, endpoints, 2)
+	})
+}
+
+func TestCaddy(t *testing.T) {
+	srv := newTestAPI(t, map[string]string{
+		"/config/apps/http/servers": `{
+			"srv0": {
+				"routes": [
+					{
+						"match": [{"host": ["app.example.com"]}],
+						"handle": [{
+							"handler": "subroute",
+							"routes": [
+								{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "10.0.0.2:8080"}, {"dial": "10.0.0.1:8080"}]}]},
+								{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "{http.request.header.X-Upstream}"}]}]}
+							]
+						}]
+					},
+					{
+						"match": [{"host": ["secure.example.com"]}],
+						"handle": [{"handler": "reverse_proxy", "transport": {"protocol": "http", "tls": {}}, "upstreams": [{"dial": "10.0.0.3"}]}]
+					},
+					{
+						"match": [{"host": ["other.example.com"]}],
+						"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "10.0.0.9:80"}]}]
+					}
+				]
+			}
+		}`,
+	})
+
+	t.Run("Upstreams of the site", func(t *testing.T) {
+		src := NewCaddy(config.ConfigDiscoveryCaddy{URL: srv.URL, Site: "APP.example.com"}, "/health")
+		endpoints, err := src.Endpoints(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"http://10.0.0.1:8080/health": "10.0.0.1",
+			"http://10.0.0.2:8080/health": "10.0.0.2",
+		}, endpointURLs(endpoints))
+	})
+
+	t.Run("Upstreams with TLS", func(t *testing.T) {
+		src := NewCaddy(config.ConfigDiscoveryCaddy{URL: srv.URL, Site: "secure.example.com"}, "/")
+		endpoints, err := src.Endpoints(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"https://10.0.0.3:443/": "10.0.0.3"}, endpointURLs(endpoints))
+	})
+
+	t.Run("Site not found", func(t *testing.T) {
+		src := NewCaddy(config.ConfigDiscoveryCaddy{URL: srv.URL, Site: "missing.example.com"}, "/")
+		_, err := src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "site 'missing.example.com' not found")
+	})
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/endpoints":
+			_, _ = w.Write([]byte(`{"endpoints": [
+				{"name": "web-2", "url": "http://10.0.0.2:8080/healthz", "host": "app.example.com", "weight": 5},
+				{"url": "https://web-1.internal/healthz", "ip": "10.0.0.1"}
+			]}`))
+		case "/invalid-ip":
+			_, _ = w.Write([]byte(`{"endpoints": [{"url": "http://web.internal/healthz"}]}`))
+		case "/invalid-url":
+			_, _ = w.Write([]byte(`{"endpoints": [{"url": "ssh://10.0.0.1", "ip": "10.0.0.1"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	headers := map[string]string{"X-Api-Key": "key"}
+
+	t.Run("List of endpoints", func(t *testing.T) {
+		src := NewHTTP(config.ConfigDiscoveryHTTP{URL: srv.URL + "/endpoints", Headers: headers})
+		endpoints, err := src.Endpoints(t.Context())
+		require.NoError(t, err)
+		require.Len(t, endpoints, 2)
+
+		assert.Equal(t, "web-2", endpoints[0].Name)
+		assert.Equal(t, "http://10.0.0.2:8080/healthz", endpoints[0].URL)
+		assert.Equal(t, "10.0.0.2", endpoints[0].IP)
+		assert.Equal(t, "app.example.com", endpoints[0].Host)
+		assert.Equal(t, 5, endpoints[0].GetWeight())
+
+		assert.Equal(t, "https://web-1.internal/healthz", endpoints[1].Name)
+		assert.Equal(t, "10.0.0.1", endpoints[1].IP)
+		assert.Equal(t, 1, endpoints[1].GetWeight())
+	})
+
+	t.Run("Headers are sent", func(t *testing.T) {
+		src := NewHTTP(config.ConfigDiscoveryHTTP{URL: srv.URL + "/endpoints"})
+		_, err := src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "status code 403")
+	})
+
+	t.Run("Invalid endpoints", func(t *testing.T) {
+		src := NewHTTP(config.ConfigDiscoveryHTTP{URL: srv.URL + "/invalid-ip", Headers: headers})
+		_, err := src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "endpoint 0 in the list is invalid: ip 'web.internal' is not a valid IP address")
+
+		src = NewHTTP(config.ConfigDiscoveryHTTP{URL: srv.URL + "/invalid-url", Headers: headers})
+		_, err = src.Endpoints(t.Context())
+		require.ErrorContains(t, err, "url 'ssh://10.0.0.1' is not a http(s) URL")
+	})
+}
+
+func TestNew(t *testing.T) {
+	src, err := New(&config.ConfigDiscovery{Traefik: &config.ConfigDiscoveryTraefik{URL: "http://traefik:8080", Router: "web@docker"}})
+	require.NoError(t, err)
+	assert.IsType(t, &Traefik{}, src)
+
+	src, err = New(&config.ConfigDiscovery{Caddy: &config.ConfigDiscoveryCaddy{URL: "http://localhost:2019", Site: "app.example.com"}})
+	require.NoError(t, err)
+	assert.IsType(t, &Caddy{}, src)
+
+	src, err = New(&config.ConfigDiscovery{HTTP: &config.ConfigDiscoveryHTTP{URL: "https://inventory.example.com/endpoints"}})
+	require.NoError(t, err)
+	assert.IsType(t, &HTTP{}, src)
+
+	_, err = New(&config.ConfigDiscovery{})
+	require.Error(t, err)
+}
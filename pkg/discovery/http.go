@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// HTTP discovers endpoints by polling a URL that returns the list of endpoints, in the format defined by ddup
+type HTTP struct {
+	cfg        config.ConfigDiscoveryHTTP
+	httpClient *http.Client
+}
+
+// httpEndpointList is the response returned by the URL
+type httpEndpointList struct {
+	Endpoints []httpEndpoint `json:"endpoints"`
+}
+
+// httpEndpoint is an endpoint in the list returned by the URL
+type httpEndpoint struct {
+	// Friendly name for the endpoint; defaults to the URL
+	Name string `json:"name"`
+	// HTTP(S) URL to check for health status
+	URL string `json:"url"`
+	// IP to include in DNS records when healthy; defaults to the host of the URL, if it's an IP
+	IP string `json:"ip"`
+	// Optional hostname to include in the requests
+	Host string `json:"host"`
+	// Optional relative weight, used when the domain's routing policy is "weighted"
+	Weight *int `json:"weight"`
+}
+
+// NewHTTP returns a new HTTP source
+func NewHTTP(cfg config.ConfigDiscoveryHTTP) *HTTP {
+	return &HTTP{
+		cfg:        cfg,
+		httpClient: tracing.NewHTTPClient(),
+	}
+}
+
+// Endpoints implements the Source interface
+func (h *HTTP) Endpoints(ctx context.Context) ([]*config.ConfigEndpoint, error) {
+	var list httpEndpointList
+	err := getJSON(ctx, h.httpClient, h.cfg.URL, h.cfg.Headers, h.cfg.BasicAuth, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of endpoints: %w", err)
+	}
+
+	res := make([]*config.ConfigEndpoint, len(list.Endpoints))
+	for i, e := range list.Endpoints {
+		res[i], err = e.toConfig()
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %d in the list is invalid: %w", i, err)
+		}
+	}
+
+	return sortEndpoints(res), nil
+}
+
+// toConfig validates the endpoint and returns its configuration
+func (e httpEndpoint) toConfig() (*config.ConfigEndpoint, error) {
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url '%s' is not a http(s) URL", e.URL)
+	}
+
+	ip := e.IP
+	if ip == "" {
+		ip = u.Hostname()
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("ip '%s' is not a valid IP address", ip)
+	}
+
+	if e.Weight != nil && (*e.Weight < 0 || *e.Weight > 255) {
+		return nil, fmt.Errorf("weight %d must be between 0 and 255", *e.Weight)
+	}
+
+	name := e.Name
+	if name == "" {
+		name = e.URL
+	}
+
+	return &config.ConfigEndpoint{
+		Name:   name,
+		Type:   config.EndpointTypeURL,
+		URL:    e.URL,
+		IP:     addr.Unmap().String(),
+		Host:   e.Host,
+		Weight: e.Weight,
+	}, nil
+}
@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// Traefik discovers the servers of the service that a Traefik HTTP router forwards requests to, using the Traefik API
+type Traefik struct {
+	cfg        config.ConfigDiscoveryTraefik
+	healthPath string
+	httpClient *http.Client
+}
+
+// traefikRouter contains the properties of a router returned by the Traefik API that are relevant for discovery
+type traefikRouter struct {
+	Service  string `json:"service"`
+	Provider string `json:"provider"`
+}
+
+// traefikService contains the properties of a service returned by the Traefik API that are relevant for discovery
+type traefikService struct {
+	LoadBalancer *struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	} `json:"loadBalancer"`
+}
+
+// NewTraefik returns a new Traefik source
+func NewTraefik(cfg config.ConfigDiscoveryTraefik, healthPath string) *Traefik {
+	return &Traefik{
+		cfg:        cfg,
+		healthPath: healthPath,
+		httpClient: tracing.NewHTTPClient(),
+	}
+}
+
+// Endpoints implements the Source interface
+func (t *Traefik) Endpoints(ctx context.Context) ([]*config.ConfigEndpoint, error) {
+	baseURL := strings.TrimSuffix(t.cfg.URL, "/")
+
+	var router traefikRouter
+	err := getJSON(ctx, t.httpClient, baseURL+"/api/http/routers/"+url.PathEscape(t.cfg.Router), nil, t.cfg.BasicAuth, &router)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Traefik router '%s': %w", t.cfg.Router, err)
+	}
+	if router.Service == "" {
+		return nil, fmt.Errorf("router '%s' does not have a service", t.cfg.Router)
+	}
+
+	// Services defined by the same provider as the router can be referenced without the provider name
+	service := router.Service
+	if !strings.Contains(service, "@") && router.Provider != "" {
+		service += "@" + router.Provider
+	}
+
+	var svc traefikService
+	err = getJSON(ctx, t.httpClient, baseURL+"/api/http/services/"+url.PathEscape(service), nil, t.cfg.BasicAuth, &svc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Traefik service '%s': %w", service, err)
+	}
+	if svc.LoadBalancer == nil {
+		// Services such as weighted and mirroring ones reference other services rather than servers
+		return nil, fmt.Errorf("service '%s' is not a load balancer", service)
+	}
+
+	res := make([]*config.ConfigEndpoint, 0, len(svc.LoadBalancer.Servers))
+	for _, server := range svc.LoadBalancer.Servers {
+		u, err := url.Parse(server.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("service '%s' has a server with invalid URL '%s'", service, server.URL)
+		}
+
+		// Servers using HTTP/2 over cleartext are checked with plain HTTP
+		scheme := u.Scheme
+		if scheme == "h2c" {
+			scheme = "http"
+		}
+
+		endpoints, err := endpointsForServer(ctx, scheme, u.Host, t.healthPath)
+		if err != nil {
+			return nil, fmt.Errorf("service '%s' has an invalid server: %w", service, err)
+		}
+		res = append(res, endpoints...)
+	}
+
+	return sortEndpoints(res), nil
+}
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -20,6 +21,7 @@ import (
 
 	"github.com/italypaleale/ddup/pkg/config"
 	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/tracing"
 )
 
 // AzureProvider implements the Provider interface for Azure DNS
@@ -27,25 +29,49 @@ type AzureProvider struct {
 	name              string
 	subscriptionID    string
 	resourceGroupName string
-	zoneName          string
-	credential        azcore.TokenCredential
-	metrics           *appmetrics.AppMetrics
-	httpClient        *http.Client
+	// Name of the zone; if empty, the zone of each record is detected from the zones in the resource group
+	zoneName   string
+	zones      *zoneCache
+	credential azcore.TokenCredential
+	metrics    *appmetrics.AppMetrics
+	httpClient *http.Client
 }
 
 // NewAzureProvider creates a new Azure DNS provider
-func NewAzureProvider(name string, cfg *config.AzureConfig, metrics *appmetrics.AppMetrics) (*AzureProvider, error) {
+// If httpClient is nil, a default client is used
+func NewAzureProvider(name string, cfg *config.AzureConfig, httpClient *http.Client, metrics *appmetrics.AppMetrics) (*AzureProvider, error) {
+	if httpClient == nil {
+		httpClient = tracing.NewHTTPClient()
+	}
+
 	if cfg.SubscriptionID == "" {
 		return nil, errors.New("subscription ID is required")
 	}
 	if cfg.ResourceGroupName == "" {
 		return nil, errors.New("resource group name is required")
 	}
-	if cfg.ZoneName == "" {
-		return nil, errors.New("zone name is required")
+
+	credential, err := newAzureCredential(cfg.AzureCredentialsConfig, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AzureProvider{
+		name:              name,
+		subscriptionID:    cfg.SubscriptionID,
+		resourceGroupName: cfg.ResourceGroupName,
+		zoneName:          cfg.ZoneName,
+		credential:        credential,
+		metrics:           metrics,
+		httpClient:        httpClient,
 	}
+	a.zones = newZoneCache(a.listZones)
 
-	// Create the appropriate credential based on auth method
+	return a, nil
+}
+
+// newAzureCredential creates the credential to authenticate to Azure, based on the auth method in the configuration
+func newAzureCredential(cfg config.AzureCredentialsConfig, httpClient *http.Client) (azcore.TokenCredential, error) {
 	var (
 		credential azcore.TokenCredential
 		err        error
@@ -54,14 +80,20 @@ func NewAzureProvider(name string, cfg *config.AzureConfig, metrics *appmetrics.
 		Telemetry: policy.TelemetryOptions{
 			Disabled: true,
 		},
+		Transport: httpClient,
 	}
 
 	// Otherwise, use the default credentials
 	switch {
-	case cfg.ClientID != "" && cfg.ClientSecret != "":
+	case cfg.ClientID != "" && (cfg.ClientSecret != "" || cfg.ClientSecretFile != ""):
 		// If client ID and secret are specified, use the service principal
-		slog.Info("Authenticating to Azure with a service principal", slog.String("clientId", cfg.ClientID))
-		credential, err = azidentity.NewClientSecretCredential(cfg.TenantID, cfg.ClientID, cfg.ClientSecret, &azidentity.ClientSecretCredentialOptions{
+		logger().Info("Authenticating to Azure with a service principal", slog.String("clientId", cfg.ClientID))
+		var clientSecret *secret
+		clientSecret, err = newSecret("client secret", cfg.ClientSecret, cfg.ClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		credential, err = newAzureClientSecretCredential(cfg.TenantID, cfg.ClientID, clientSecret, &azidentity.ClientSecretCredentialOptions{
 			ClientOptions: clientOpts,
 		})
 		if err != nil {
@@ -69,7 +101,7 @@ func NewAzureProvider(name string, cfg *config.AzureConfig, metrics *appmetrics.
 		}
 	case cfg.ManagedIdentityClientID != "":
 		// Use managed identity with a specific client ID (for user-assigned identities)
-		slog.Info("Authenticating to Azure with a managed identity", slog.String("managedIdentityClientID", cfg.ManagedIdentityClientID))
+		logger().Info("Authenticating to Azure with a managed identity", slog.String("managedIdentityClientID", cfg.ManagedIdentityClientID))
 		credential, err = azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
 			ClientOptions: clientOpts,
 			ID:            azidentity.ClientID(cfg.ManagedIdentityClientID),
@@ -79,7 +111,7 @@ func NewAzureProvider(name string, cfg *config.AzureConfig, metrics *appmetrics.
 		}
 	default:
 		// Use the default credentials
-		slog.Info("Authenticating to Azure with the default options")
+		logger().Info("Authenticating to Azure with the default options")
 		credential, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
 			ClientOptions: clientOpts,
 			TenantID:      cfg.TenantID,
@@ -89,15 +121,7 @@ func NewAzureProvider(name string, cfg *config.AzureConfig, metrics *appmetrics.
 		}
 	}
 
-	return &AzureProvider{
-		name:              name,
-		subscriptionID:    cfg.SubscriptionID,
-		resourceGroupName: cfg.ResourceGroupName,
-		zoneName:          cfg.ZoneName,
-		credential:        credential,
-		metrics:           metrics,
-		httpClient:        http.DefaultClient,
-	}, nil
+	return credential, nil
 }
 
 // Name returns the provider's name
@@ -105,16 +129,21 @@ func (a *AzureProvider) Name() string {
 	return a.name
 }
 
-// UpdateRecords updates DNS records for the given domain with the provided IPs
-func (a *AzureProvider) UpdateRecords(ctx context.Context, domain string, ttl int, ips []string) error {
+// UpdateRecords updates DNS records of the given type for the domain with the provided IPs
+func (a *AzureProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	zone, err := a.zoneFor(ctx, domain)
+	if err != nil {
+		return err
+	}
+
 	// First, get existing records
-	currentIPs, err := a.getExistingIPs(ctx, domain)
+	currentIPs, err := a.getExistingIPs(ctx, zone, domain, recordType)
 	if err != nil {
 		return fmt.Errorf("error getting existing records: %w", err)
 	}
 
 	// Get record name from domain
-	recordName := a.getRecordName(domain)
+	recordName := getAzureRecordName(zone, domain)
 
 	if len(ips) == 0 {
 		// If no healthy IPs, delete the record entirely
@@ -123,8 +152,8 @@ func (a *AzureProvider) UpdateRecords(ctx context.Context, domain string, ttl in
 			return nil
 		}
 
-		slog.DebugContext(ctx, "No healthy IPs, deleting record", slog.String("recordName", recordName))
-		err = a.deleteRecord(ctx, recordName)
+		logger().DebugContext(ctx, "No healthy IPs, deleting record", slog.String("recordName", recordName))
+		err = a.deleteRecord(ctx, zone, recordName, recordType)
 		if err != nil {
 			return fmt.Errorf("error deleting record for domain %s: %w", domain, err)
 		}
@@ -144,8 +173,8 @@ func (a *AzureProvider) UpdateRecords(ctx context.Context, domain string, ttl in
 	// Update if there's any difference
 	if diff {
 		// Create or update record with healthy IPs
-		slog.DebugContext(ctx, "Creating/updating record with healthy IPs", slog.String("recordName", recordName), slog.Any("ips", ips))
-		err = a.createOrUpdateRecord(ctx, recordName, ips, ttl)
+		logger().DebugContext(ctx, "Creating/updating record with healthy IPs", slog.String("recordName", recordName), slog.Any("ips", ips))
+		err = a.createOrUpdateRecord(ctx, zone, recordName, recordType, ips, ttl)
 		if err != nil {
 			return fmt.Errorf("error creating/updating record for domain %s: %w", domain, err)
 		}
@@ -154,17 +183,60 @@ func (a *AzureProvider) UpdateRecords(ctx context.Context, domain string, ttl in
 	return nil
 }
 
+// UpdateTXTRecords sets the TXT records for the name to the given values
+func (a *AzureProvider) UpdateTXTRecords(ctx context.Context, name string, ttl int, values []string) error {
+	return a.UpdateRecords(ctx, name, RecordTypeTXT, ttl, values)
+}
+
+// UpdateCNAMERecord sets the CNAME record for the name to point at the target hostname
+func (a *AzureProvider) UpdateCNAMERecord(ctx context.Context, name string, ttl int, target string) error {
+	return a.UpdateRecords(ctx, name, RecordTypeCNAME, ttl, []string{target})
+}
+
+// GetRecords returns the IPs in the DNS records of the given type for the domain
+func (a *AzureProvider) GetRecords(ctx context.Context, domain string, recordType string) ([]string, error) {
+	zone, err := a.zoneFor(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := a.getExistingIPs(ctx, zone, domain, recordType)
+	if err != nil {
+		return nil, fmt.Errorf("error getting existing records: %w", err)
+	}
+	return ips, nil
+}
+
 // azureARecord represents an A record from the Azure DNS API
 type azureARecord struct {
 	IPv4Address string `json:"ipv4Address"`
 }
 
+// azureAAAARecord represents an AAAA record from the Azure DNS API
+type azureAAAARecord struct {
+	IPv6Address string `json:"ipv6Address"`
+}
+
+// azureTXTRecord represents a TXT record from the Azure DNS API
+type azureTXTRecord struct {
+	Value []string `json:"value"`
+}
+
+// azureCNAMERecord represents a CNAME record from the Azure DNS API
+type azureCNAMERecord struct {
+	CNAME string `json:"cname"`
+}
+
 // azureRecordProperties represents a record's properties from the Azure DNS API
 //
 //nolint:tagliatelle
 type azureRecordProperties struct {
-	TTL      int            `json:"TTL"`
-	ARecords []azureARecord `json:"ARecords"`
+	TTL         int               `json:"TTL"`
+	ARecords    []azureARecord    `json:"ARecords,omitempty"`
+	AAAARecords []azureAAAARecord `json:"AAAARecords,omitempty"`
+	TXTRecords  []azureTXTRecord  `json:"TXTRecords,omitempty"`
+	// Record sets contain a single CNAME record
+	CNAMERecord *azureCNAMERecord `json:"CNAMERecord,omitempty"`
 }
 
 // azureRecord represents a DNS record from Azure DNS API
@@ -183,17 +255,161 @@ type azureRecordsResponse struct {
 	Value []azureRecord `json:"value"`
 }
 
-func (a *AzureProvider) getRecordName(domain string) string {
+// azureZonesResponse represents the response from listing DNS zones
+type azureZonesResponse struct {
+	Value []struct {
+		Name string `json:"name"`
+	} `json:"value"`
+	// URL of the next page of results, if any
+	NextLink string `json:"nextLink"`
+}
+
+// VerifyCredentials checks that the credentials are valid and that they grant access to the DNS zone, by reading the zone
+// If the zone is detected automatically, it checks that the resource group contains at least one zone instead
+func (a *AzureProvider) VerifyCredentials(ctx context.Context) error {
+	if a.zoneName == "" {
+		zones, err := a.zones.Zones(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list DNS zones: %w; check the subscription ID and resource group, and that the identity has the 'DNS Zone Contributor' role on the resource group", err)
+		}
+		if len(zones) == 0 {
+			return fmt.Errorf("the resource group '%s' doesn't contain any DNS zone", a.resourceGroupName)
+		}
+		return nil
+	}
+
+	zonePath := fmt.Sprintf(
+		"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s",
+		a.subscriptionID, a.resourceGroupName, a.zoneName,
+	)
+
+	start := time.Now()
+	var success bool
+	if a.metrics != nil {
+		defer func() {
+			a.metrics.RecordAPICall("azure", http.MethodGet, zonePath, success, time.Since(start))
+		}()
+	}
+
+	accessToken, err := a.getAccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting access token: %w; check the credentials of the provider", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, "https://management.azure.com"+zonePath+"?api-version=2018-05-01", nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("failed to read DNS zone '%s' (HTTP %d): %s; check the subscription ID, resource group, and zone name, and that the identity has the 'DNS Zone Contributor' role on the zone", a.zoneName, res.StatusCode, string(body))
+	}
+
+	success = true
+	return nil
+}
+
+// zoneFor returns the zone of the domain, which is the configured zone or the one detected from the zones in the resource group
+func (a *AzureProvider) zoneFor(ctx context.Context, domain string) (string, error) {
+	if a.zoneName != "" {
+		return a.zoneName, nil
+	}
+	return a.zones.ZoneFor(ctx, domain)
+}
+
+// listZones returns the names of the DNS zones in the resource group
+func (a *AzureProvider) listZones(ctx context.Context) ([]string, error) {
+	zonesPath := fmt.Sprintf(
+		"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones",
+		a.subscriptionID, a.resourceGroupName,
+	)
+
+	start := time.Now()
+	var success bool
+	if a.metrics != nil {
+		defer func() {
+			a.metrics.RecordAPICall("azure", http.MethodGet, zonesPath, success, time.Since(start))
+		}()
+	}
+
+	accessToken, err := a.getAccessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting access token: %w", err)
+	}
+
+	// Results can be split in multiple pages
+	var zones []string
+	reqURL := "https://management.azure.com" + zonesPath + "?api-version=2018-05-01"
+	for reqURL != "" {
+		var response azureZonesResponse
+		err = a.getJSON(ctx, accessToken, reqURL, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, z := range response.Value {
+			zones = append(zones, z.Name)
+		}
+		reqURL = response.NextLink
+	}
+
+	success = true
+	return zones, nil
+}
+
+// getJSON sends a GET request to the Azure Resource Manager API and decodes the JSON response
+func (a *AzureProvider) getJSON(ctx context.Context, accessToken string, reqURL string, dest any) error {
+	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("invalid response status code HTTP %d; response: %s", res.StatusCode, string(body))
+	}
+
+	err = json.NewDecoder(res.Body).Decode(dest)
+	if err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return nil
+}
+
+// getAzureRecordName returns the name of the record set in the zone for the domain
+func getAzureRecordName(zone string, domain string) string {
 	// Trim the ending dot if present
 	domain = strings.TrimSuffix(domain, ".")
 
 	// Extract subdomain from full domain
-	if domain == a.zoneName {
+	if domain == zone {
 		// Root domain
 		return "@"
 	}
-	if strings.HasSuffix(domain, "."+a.zoneName) {
-		return domain[:(len(domain) - len(a.zoneName) - 1)]
+	if strings.HasSuffix(domain, "."+zone) {
+		return domain[:(len(domain) - len(zone) - 1)]
 	}
 
 	// If domain doesn't match zone, return as-is (might be an error case)
@@ -202,13 +418,18 @@ func (a *AzureProvider) getRecordName(domain string) string {
 
 // getAccessToken gets a fresh access token using the Azure identity library
 func (a *AzureProvider) getAccessToken(parentCtx context.Context) (string, error) {
+	return getAzureAccessToken(parentCtx, a.credential)
+}
+
+// getAzureAccessToken gets a fresh access token for the Azure Resource Manager APIs from the credential
+func getAzureAccessToken(parentCtx context.Context, credential azcore.TokenCredential) (string, error) {
 	tokenRequestOptions := policy.TokenRequestOptions{
 		Scopes: []string{"https://management.azure.com/.default"},
 	}
 
 	ctx, cancel := context.WithTimeout(parentCtx, 20*time.Second)
 	defer cancel()
-	token, err := a.credential.GetToken(ctx, tokenRequestOptions)
+	token, err := credential.GetToken(ctx, tokenRequestOptions)
 	if err != nil {
 		return "", fmt.Errorf("error getting access token: %w", err)
 	}
@@ -216,15 +437,15 @@ func (a *AzureProvider) getAccessToken(parentCtx context.Context) (string, error
 	return token.Token, nil
 }
 
-func (a *AzureProvider) getExistingIPs(ctx context.Context, domain string) ([]string, error) {
+func (a *AzureProvider) getExistingIPs(ctx context.Context, zone string, domain string, recordType string) ([]string, error) {
 	start := time.Now()
 	var success bool
 	if a.metrics != nil {
 		defer func() {
 			a.metrics.RecordAPICall("azure", http.MethodGet,
 				fmt.Sprintf(
-					"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/A",
-					a.subscriptionID, a.resourceGroupName, a.zoneName,
+					"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/%s",
+					a.subscriptionID, a.resourceGroupName, zone, recordType,
 				),
 				success, time.Since(start))
 		}()
@@ -236,10 +457,10 @@ func (a *AzureProvider) getExistingIPs(ctx context.Context, domain string) ([]st
 		return nil, fmt.Errorf("error getting access token: %w", err)
 	}
 
-	recordName := a.getRecordName(domain)
+	recordName := getAzureRecordName(zone, domain)
 	baseURL := fmt.Sprintf(
-		"https://management.azure.com/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/A",
-		a.subscriptionID, a.resourceGroupName, a.zoneName,
+		"https://management.azure.com/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/%s",
+		a.subscriptionID, a.resourceGroupName, zone, recordType,
 	)
 
 	// Add query parameters
@@ -274,18 +495,28 @@ func (a *AzureProvider) getExistingIPs(ctx context.Context, domain string) ([]st
 		return nil, fmt.Errorf("error decoding response: %w", err)
 	}
 
-	// Get the list of A IPs
+	// Get the list of IPs
 	var ips []string
 	if len(response.Value) > 0 {
 		for _, r := range response.Value {
-			if len(r.Properties.ARecords) == 0 || r.Name != recordName {
+			if r.Name != recordName {
 				continue
 			}
 
-			ips = slices.Grow(ips, len(r.Properties.ARecords))
+			ips = slices.Grow(ips, len(r.Properties.ARecords)+len(r.Properties.AAAARecords)+len(r.Properties.TXTRecords))
 			for _, aRecord := range r.Properties.ARecords {
 				ips = append(ips, aRecord.IPv4Address)
 			}
+			for _, aaaaRecord := range r.Properties.AAAARecords {
+				ips = append(ips, aaaaRecord.IPv6Address)
+			}
+			// Values of TXT records can be split in multiple strings
+			for _, txtRecord := range r.Properties.TXTRecords {
+				ips = append(ips, strings.Join(txtRecord.Value, ""))
+			}
+			if r.Properties.CNAMERecord != nil && r.Properties.CNAMERecord.CNAME != "" {
+				ips = append(ips, strings.TrimSuffix(r.Properties.CNAMERecord.CNAME, "."))
+			}
 		}
 	}
 
@@ -293,7 +524,7 @@ func (a *AzureProvider) getExistingIPs(ctx context.Context, domain string) ([]st
 	return ips, nil
 }
 
-func (a *AzureProvider) createOrUpdateRecord(ctx context.Context, recordName string, ips []string, ttl int) error {
+func (a *AzureProvider) createOrUpdateRecord(ctx context.Context, zone string, recordName string, recordType string, ips []string, ttl int) error {
 	start := time.Now()
 	var success bool
 	if a.metrics != nil {
@@ -301,8 +532,8 @@ func (a *AzureProvider) createOrUpdateRecord(ctx context.Context, recordName str
 			a.metrics.RecordAPICall(
 				"azure", http.MethodPut,
 				fmt.Sprintf(
-					"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/A/%s",
-					a.subscriptionID, a.resourceGroupName, a.zoneName, recordName,
+					"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/%s/%s",
+					a.subscriptionID, a.resourceGroupName, zone, recordType, recordName,
 				),
 				success, time.Since(start),
 			)
@@ -316,24 +547,46 @@ func (a *AzureProvider) createOrUpdateRecord(ctx context.Context, recordName str
 	}
 
 	url := fmt.Sprintf(
-		"https://management.azure.com/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/A/%s?api-version=2018-05-01",
-		a.subscriptionID, a.resourceGroupName, a.zoneName, recordName,
+		"https://management.azure.com/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/%s/%s?api-version=2018-05-01",
+		a.subscriptionID, a.resourceGroupName, zone, recordType, recordName,
 	)
 
-	// Build A records
-	aRecords := make([]azureARecord, len(ips))
-	for i, ip := range ips {
-		aRecords[i] = azureARecord{
-			IPv4Address: ip,
-		}
-	}
-
+	// Build the records
 	recordSet := azureRecordSet{
 		Properties: azureRecordProperties{
-			TTL:      ttl,
-			ARecords: aRecords,
+			TTL: ttl,
 		},
 	}
+	switch recordType {
+	case RecordTypeCNAME:
+		// A name can only have one CNAME record
+		if len(ips) > 0 {
+			recordSet.Properties.CNAMERecord = &azureCNAMERecord{
+				CNAME: ips[0],
+			}
+		}
+	case RecordTypeTXT:
+		recordSet.Properties.TXTRecords = make([]azureTXTRecord, len(ips))
+		for i, value := range ips {
+			recordSet.Properties.TXTRecords[i] = azureTXTRecord{
+				Value: []string{value},
+			}
+		}
+	case RecordTypeAAAA:
+		recordSet.Properties.AAAARecords = make([]azureAAAARecord, len(ips))
+		for i, ip := range ips {
+			recordSet.Properties.AAAARecords[i] = azureAAAARecord{
+				IPv6Address: ip,
+			}
+		}
+	default:
+		recordSet.Properties.ARecords = make([]azureARecord, len(ips))
+		for i, ip := range ips {
+			recordSet.Properties.ARecords[i] = azureARecord{
+				IPv4Address: ip,
+			}
+		}
+	}
 
 	jsonData, err := json.Marshal(recordSet)
 	if err != nil {
@@ -365,15 +618,15 @@ func (a *AzureProvider) createOrUpdateRecord(ctx context.Context, recordName str
 	return nil
 }
 
-func (a *AzureProvider) deleteRecord(ctx context.Context, recordName string) error {
+func (a *AzureProvider) deleteRecord(ctx context.Context, zone string, recordName string, recordType string) error {
 	start := time.Now()
 	var success bool
 	if a.metrics != nil {
 		defer func() {
 			a.metrics.RecordAPICall("azure", http.MethodDelete,
 				fmt.Sprintf(
-					"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/A/%s",
-					a.subscriptionID, a.resourceGroupName, a.zoneName, recordName,
+					"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/%s/%s",
+					a.subscriptionID, a.resourceGroupName, zone, recordType, recordName,
 				),
 				success, time.Since(start),
 			)
@@ -387,8 +640,8 @@ func (a *AzureProvider) deleteRecord(ctx context.Context, recordName string) err
 	}
 
 	url := fmt.Sprintf(
-		"https://management.azure.com/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/A/%s?api-version=2018-05-01",
-		a.subscriptionID, a.resourceGroupName, a.zoneName, recordName,
+		"https://management.azure.com/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s/%s/%s?api-version=2018-05-01",
+		a.subscriptionID, a.resourceGroupName, zone, recordType, recordName,
 	)
 
 	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
@@ -415,3 +668,66 @@ func (a *AzureProvider) deleteRecord(ctx context.Context, recordName string) err
 	success = true
 	return nil
 }
+
+// azureClientSecretCredential is a TokenCredential that authenticates with a client secret.
+// The underlying credential is re-created when the value of the secret changes, such as when it's read from a file that was updated.
+type azureClientSecretCredential struct {
+	tenantID     string
+	clientID     string
+	clientSecret *secret
+	opts         *azidentity.ClientSecretCredentialOptions
+
+	lock       sync.Mutex
+	lastSecret string
+	credential *azidentity.ClientSecretCredential
+}
+
+func newAzureClientSecretCredential(tenantID string, clientID string, clientSecret *secret, opts *azidentity.ClientSecretCredentialOptions) (*azureClientSecretCredential, error) {
+	c := &azureClientSecretCredential{
+		tenantID:     tenantID,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		opts:         opts,
+	}
+
+	// Create the credential right away to catch errors early
+	_, err := c.getCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetToken implements the azcore.TokenCredential interface
+func (c *azureClientSecretCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	credential, err := c.getCredential()
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+
+	return credential.GetToken(ctx, opts)
+}
+
+func (c *azureClientSecretCredential) getCredential() (*azidentity.ClientSecretCredential, error) {
+	value, err := c.clientSecret.Get()
+	if err != nil {
+		return nil, fmt.Errorf("error getting client secret: %w", err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.credential != nil && value == c.lastSecret {
+		return c.credential, nil
+	}
+
+	credential, err := azidentity.NewClientSecretCredential(c.tenantID, c.clientID, value, c.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c.credential = credential
+	c.lastSecret = value
+	return credential, nil
+}
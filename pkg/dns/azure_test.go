@@ -55,7 +55,7 @@ func TestAzureProvider(t *testing.T) {
 		})
 
 		// Test updating records
-		err := provider.UpdateRecords(t.Context(), "example.com", 300, []string{"1.1.1.1"})
+		err := provider.UpdateRecords(t.Context(), "example.com", RecordTypeA, 300, []string{"1.1.1.1"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -117,7 +117,7 @@ func TestAzureProvider(t *testing.T) {
 		})
 
 		// Test deleting records (passing empty IPs array)
-		err := provider.UpdateRecords(t.Context(), "www.example.com", 300, []string{})
+		err := provider.UpdateRecords(t.Context(), "www.example.com", RecordTypeA, 300, []string{})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -151,7 +151,7 @@ func TestAzureProvider(t *testing.T) {
 		})
 
 		// Test deleting records (passing empty IPs array)
-		err := provider.UpdateRecords(t.Context(), "www.example.com", 300, []string{})
+		err := provider.UpdateRecords(t.Context(), "www.example.com", RecordTypeA, 300, []string{})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -202,7 +202,7 @@ func TestAzureProvider(t *testing.T) {
 		})
 
 		// Test updating records with new IPs
-		err := provider.UpdateRecords(t.Context(), "api.example.com", 300, []string{"5.6.7.8", "9.10.11.12"})
+		err := provider.UpdateRecords(t.Context(), "api.example.com", RecordTypeA, 300, []string{"5.6.7.8", "9.10.11.12"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -265,7 +265,7 @@ func TestAzureProvider(t *testing.T) {
 
 		// Test updating records with new IPs
 		// Note the order is reversed from the current state
-		err := provider.UpdateRecords(t.Context(), "api.example.com", 300, []string{"1.2.3.4", "9.8.7.6"})
+		err := provider.UpdateRecords(t.Context(), "api.example.com", RecordTypeA, 300, []string{"1.2.3.4", "9.8.7.6"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -277,12 +277,61 @@ func TestAzureProvider(t *testing.T) {
 		assert.Equal(t, http.MethodGet, getReq.Method)
 	})
 
-	t.Run("getRecordName method", func(t *testing.T) {
-		// Create a test provider
-		provider := &AzureProvider{
-			zoneName: "example.com",
-		}
+	t.Run("Get records", func(t *testing.T) {
+		provider, mockTransport := newAzureTestProviderWithMock("example.com")
+
+		mockTransport.SetResponse(http.MethodGet, "/subscriptions/test-sub/resourceGroups/test-rg/providers/Microsoft.Network/dnsZones/example.com/A?%24recordsetnamesuffix=api&api-version=2018-05-01", &MockResponse{
+			StatusCode: 200,
+			Body: `{
+			"value": [
+				{
+					"name": "api",
+					"properties": {
+						"TTL": 300,
+						"ARecords": [
+							{"ipv4Address": "9.8.7.6"},
+							{"ipv4Address": "1.2.3.4"}
+						]
+					}
+				}
+			]
+		}`,
+			Headers: map[string]string{"Content-Type": "application/json"},
+		})
+
+		ips, err := provider.GetRecords(t.Context(), "api.example.com", RecordTypeA)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"1.2.3.4", "9.8.7.6"}, ips)
+	})
+
+	t.Run("Zone detected automatically", func(t *testing.T) {
+		provider, mockTransport := newAzureTestProviderWithMock("")
+		provider.zones = newZoneCache(provider.listZones)
+
+		// The list of zones is split in two pages
+		mockTransport.SetResponse(http.MethodGet, "/subscriptions/test-sub/resourceGroups/test-rg/providers/Microsoft.Network/dnsZones?api-version=2018-05-01", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"value": [{"name": "example.com"}], "nextLink": "https://management.azure.com/subscriptions/test-sub/resourceGroups/test-rg/providers/Microsoft.Network/dnsZones?api-version=2018-05-01&$skipToken=abc"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/subscriptions/test-sub/resourceGroups/test-rg/providers/Microsoft.Network/dnsZones?api-version=2018-05-01&$skipToken=abc", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"value": [{"name": "internal.example.com"}]}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/subscriptions/test-sub/resourceGroups/test-rg/providers/Microsoft.Network/dnsZones/internal.example.com/A?%24recordsetnamesuffix=api&api-version=2018-05-01", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"value": [{"name": "api", "properties": {"TTL": 300, "ARecords": [{"ipv4Address": "10.0.0.1"}]}}]}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
 
+		ips, err := provider.GetRecords(t.Context(), "api.internal.example.com", RecordTypeA)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.1"}, ips)
+		require.NoError(t, provider.VerifyCredentials(t.Context()))
+	})
+
+	t.Run("getAzureRecordName", func(t *testing.T) {
 		tests := []struct {
 			name     string
 			domain   string
@@ -347,10 +396,7 @@ func TestAzureProvider(t *testing.T) {
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				// Update the provider's zone name for this test
-				provider.zoneName = tt.zoneName
-
-				result := provider.getRecordName(tt.domain)
+				result := getAzureRecordName(tt.zoneName, tt.domain)
 				assert.Equal(t, tt.expected, result)
 			})
 		}
@@ -0,0 +1,289 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// API version of the Traffic Manager APIs
+const azureTrafficManagerAPIVersion = "2022-04-01"
+
+// Status of Traffic Manager endpoints
+const (
+	azureTrafficManagerEnabled  = "Enabled"
+	azureTrafficManagerDisabled = "Disabled"
+)
+
+// AzureTrafficManagerProvider implements the WeightedProvider interface for Azure Traffic Manager
+// Instead of editing DNS records, it enables or disables the endpoints of a Traffic Manager profile according to their health
+// Endpoints are matched by name with the endpoints of the profile
+type AzureTrafficManagerProvider struct {
+	name              string
+	subscriptionID    string
+	resourceGroupName string
+	profileName       string
+	credential        azcore.TokenCredential
+	metrics           *appmetrics.AppMetrics
+	httpClient        *http.Client
+}
+
+// NewAzureTrafficManagerProvider creates a new Azure Traffic Manager provider
+// If httpClient is nil, a default client is used
+func NewAzureTrafficManagerProvider(name string, cfg *config.AzureTrafficManagerConfig, httpClient *http.Client, metrics *appmetrics.AppMetrics) (*AzureTrafficManagerProvider, error) {
+	if httpClient == nil {
+		httpClient = tracing.NewHTTPClient()
+	}
+
+	if cfg.SubscriptionID == "" {
+		return nil, errors.New("subscription ID is required")
+	}
+	if cfg.ResourceGroupName == "" {
+		return nil, errors.New("resource group name is required")
+	}
+	if cfg.ProfileName == "" {
+		return nil, errors.New("profile name is required")
+	}
+
+	credential, err := newAzureCredential(cfg.AzureCredentialsConfig, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AzureTrafficManagerProvider{
+		name:              name,
+		subscriptionID:    cfg.SubscriptionID,
+		resourceGroupName: cfg.ResourceGroupName,
+		profileName:       cfg.ProfileName,
+		credential:        credential,
+		metrics:           metrics,
+		httpClient:        httpClient,
+	}, nil
+}
+
+// Name returns the provider's name
+func (a *AzureTrafficManagerProvider) Name() string {
+	return a.name
+}
+
+// UpdateRecords implements the Provider interface
+// Traffic Manager profiles don't contain records, so this always returns an error: domains must use the weighted routing policy
+func (a *AzureTrafficManagerProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	return errors.New("the Azure Traffic Manager provider can only be used with the weighted routing policy")
+}
+
+// UpdateWeightedRecords enables the endpoints of the profile that are healthy, and disables the others
+// With the weighted routing method, the weights of the endpoints are updated too; weights of 0 are not supported by Traffic Manager, so they're left unchanged
+// If no endpoint is healthy, endpoints are left unchanged, as disabling all of them would make the profile stop answering queries
+func (a *AzureTrafficManagerProvider) UpdateWeightedRecords(ctx context.Context, domain string, ttl int, records []WeightedRecord) error {
+	profile, err := a.getProfile(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting Traffic Manager profile: %w", err)
+	}
+
+	// Update the TTL of the profile if needed
+	if profile.Properties.DNSConfig.TTL != ttl {
+		logger().DebugContext(ctx, "Updating TTL of the Traffic Manager profile", slog.String("profile", a.profileName), slog.Int("ttl", ttl))
+		err = a.updateProfileTTL(ctx, profile.Properties.DNSConfig, ttl)
+		if err != nil {
+			return fmt.Errorf("error updating TTL of the Traffic Manager profile: %w", err)
+		}
+	}
+
+	var anyHealthy bool
+	for _, r := range records {
+		if r.Healthy {
+			anyHealthy = true
+			break
+		}
+	}
+	if !anyHealthy {
+		logger().WarnContext(ctx, "No healthy endpoints, leaving the Traffic Manager endpoints unchanged", slog.String("profile", a.profileName), slog.String("domain", domain))
+		return nil
+	}
+
+	weighted := strings.EqualFold(profile.Properties.TrafficRoutingMethod, "Weighted")
+	for _, r := range records {
+		var endpoint *azureTrafficManagerEndpoint
+		for i := range profile.Properties.Endpoints {
+			if strings.EqualFold(profile.Properties.Endpoints[i].Name, r.Name) {
+				endpoint = &profile.Properties.Endpoints[i]
+				break
+			}
+		}
+		if endpoint == nil {
+			return fmt.Errorf("endpoint '%s' not found in Traffic Manager profile '%s'", r.Name, a.profileName)
+		}
+
+		props := azureTrafficManagerEndpointProperties{
+			EndpointStatus: azureTrafficManagerDisabled,
+		}
+		if r.Healthy {
+			props.EndpointStatus = azureTrafficManagerEnabled
+		}
+		if weighted && r.Weight > 0 {
+			props.Weight = r.Weight
+		}
+		if strings.EqualFold(props.EndpointStatus, endpoint.Properties.EndpointStatus) && (props.Weight == 0 || props.Weight == endpoint.Properties.Weight) {
+			// Nothing to do
+			continue
+		}
+
+		logger().DebugContext(ctx, "Updating Traffic Manager endpoint", slog.String("endpoint", endpoint.Name), slog.String("status", props.EndpointStatus), slog.Int("weight", props.Weight))
+		err = a.updateEndpoint(ctx, endpoint, props)
+		if err != nil {
+			return fmt.Errorf("error updating endpoint '%s': %w", endpoint.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// azureTrafficManagerProfile represents a Traffic Manager profile from the Azure API
+type azureTrafficManagerProfile struct {
+	Properties azureTrafficManagerProfileProperties `json:"properties"`
+}
+
+// azureTrafficManagerProfileProperties represents the properties of a Traffic Manager profile
+type azureTrafficManagerProfileProperties struct {
+	TrafficRoutingMethod string                        `json:"trafficRoutingMethod,omitempty"`
+	DNSConfig            azureTrafficManagerDNSConfig  `json:"dnsConfig"`
+	Endpoints            []azureTrafficManagerEndpoint `json:"endpoints,omitempty"`
+}
+
+// azureTrafficManagerDNSConfig represents the DNS configuration of a Traffic Manager profile
+type azureTrafficManagerDNSConfig struct {
+	RelativeName string `json:"relativeName"`
+	TTL          int    `json:"ttl"`
+}
+
+// azureTrafficManagerEndpoint represents an endpoint of a Traffic Manager profile
+type azureTrafficManagerEndpoint struct {
+	ID         string                                `json:"id,omitempty"`
+	Name       string                                `json:"name,omitempty"`
+	Properties azureTrafficManagerEndpointProperties `json:"properties"`
+}
+
+// azureTrafficManagerEndpointProperties represents the properties of an endpoint that are managed by ddup
+type azureTrafficManagerEndpointProperties struct {
+	EndpointStatus string `json:"endpointStatus"`
+	Weight         int    `json:"weight,omitempty"`
+}
+
+// VerifyCredentials checks that the credentials are valid and that they grant access to the Traffic Manager profile, by reading the profile
+func (a *AzureTrafficManagerProvider) VerifyCredentials(ctx context.Context) error {
+	_, err := a.getProfile(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read Traffic Manager profile '%s': %w; check the subscription ID, resource group, and profile name, and that the identity has the 'Traffic Manager Contributor' role on the profile", a.profileName, err)
+	}
+	return nil
+}
+
+// getProfile returns the Traffic Manager profile, including its endpoints
+func (a *AzureTrafficManagerProvider) getProfile(ctx context.Context) (*azureTrafficManagerProfile, error) {
+	var profile azureTrafficManagerProfile
+	err := a.performRequest(ctx, http.MethodGet, a.profilePath(), nil, &profile)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// updateProfileTTL sets the TTL of the DNS records of the profile
+func (a *AzureTrafficManagerProvider) updateProfileTTL(ctx context.Context, dnsConfig azureTrafficManagerDNSConfig, ttl int) error {
+	dnsConfig.TTL = ttl
+	body := azureTrafficManagerProfile{
+		Properties: azureTrafficManagerProfileProperties{
+			DNSConfig: dnsConfig,
+		},
+	}
+	return a.performRequest(ctx, http.MethodPatch, a.profilePath(), body, nil)
+}
+
+// updateEndpoint sets the status and weight of an endpoint
+func (a *AzureTrafficManagerProvider) updateEndpoint(ctx context.Context, endpoint *azureTrafficManagerEndpoint, props azureTrafficManagerEndpointProperties) error {
+	body := azureTrafficManagerEndpoint{
+		Properties: props,
+	}
+	return a.performRequest(ctx, http.MethodPatch, endpoint.ID, body, nil)
+}
+
+// profilePath returns the path of the profile in the Azure Resource Manager APIs
+func (a *AzureTrafficManagerProvider) profilePath() string {
+	return fmt.Sprintf(
+		"/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/trafficmanagerprofiles/%s",
+		a.subscriptionID, a.resourceGroupName, a.profileName,
+	)
+}
+
+// performRequest performs a request to the Azure Resource Manager APIs for the resource at path
+// If data is not nil, it's sent as JSON in the request body; if dest is not nil, the response body is decoded into it
+func (a *AzureTrafficManagerProvider) performRequest(ctx context.Context, method string, path string, data any, dest any) error {
+	start := time.Now()
+	var success bool
+	if a.metrics != nil {
+		defer func() {
+			a.metrics.RecordAPICall("azureTrafficManager", method, path, success, time.Since(start))
+		}()
+	}
+
+	accessToken, err := getAzureAccessToken(ctx, a.credential)
+	if err != nil {
+		return fmt.Errorf("error getting access token: %w", err)
+	}
+
+	var body io.Reader
+	if data != nil {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("error marshaling request: %w", err)
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, method, "https://management.azure.com"+path+"?api-version="+azureTrafficManagerAPIVersion, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		resBody, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("invalid response status code HTTP %d; response: %s", res.StatusCode, string(resBody))
+	}
+
+	if dest != nil {
+		err = json.NewDecoder(res.Body).Decode(dest)
+		if err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
+		}
+	}
+
+	success = true
+	return nil
+}
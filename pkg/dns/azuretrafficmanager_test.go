@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureTrafficManagerProvider(t *testing.T) {
+	const profilePath = "/subscriptions/test-sub/resourceGroups/test-rg/providers/Microsoft.Network/trafficmanagerprofiles/test-profile"
+	const profileBody = `{
+		"properties": {
+			"trafficRoutingMethod": "Weighted",
+			"dnsConfig": {"relativeName": "test-profile", "ttl": 60},
+			"endpoints": [
+				{
+					"id": "` + profilePath + `/externalEndpoints/ep1",
+					"name": "ep1",
+					"properties": {"endpointStatus": "Enabled", "weight": 1}
+				},
+				{
+					"id": "` + profilePath + `/externalEndpoints/ep2",
+					"name": "ep2",
+					"properties": {"endpointStatus": "Enabled", "weight": 1}
+				}
+			]
+		}
+	}`
+
+	newProvider := func() (*AzureTrafficManagerProvider, *MockHTTPTransport) {
+		mockClient, mockTransport := NewMockHTTPClient()
+		provider := &AzureTrafficManagerProvider{
+			name:              "test",
+			subscriptionID:    "test-sub",
+			resourceGroupName: "test-rg",
+			profileName:       "test-profile",
+			credential:        mockAzureTokenProvider{},
+			httpClient:        mockClient,
+		}
+		mockTransport.SetResponse(http.MethodGet, profilePath+"?api-version=2022-04-01", &MockResponse{
+			StatusCode: 200,
+			Body:       profileBody,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		return provider, mockTransport
+	}
+
+	t.Run("Disables unhealthy endpoints", func(t *testing.T) {
+		provider, mockTransport := newProvider()
+		mockTransport.SetResponse(http.MethodPatch, profilePath+"/externalEndpoints/ep2?api-version=2022-04-01", &MockResponse{
+			StatusCode: 200,
+			Body:       `{}`,
+		})
+
+		err := provider.UpdateWeightedRecords(t.Context(), "app.example.com", 60, []WeightedRecord{
+			{Name: "ep1", IP: "1.1.1.1", Weight: 1, Healthy: true},
+			{Name: "ep2", IP: "2.2.2.2", Weight: 1, Healthy: false},
+		})
+		require.NoError(t, err)
+
+		// The endpoint that is already enabled is not updated
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 2)
+		assert.Equal(t, http.MethodPatch, requests[1].Method)
+		assert.Equal(t, "Bearer mock-123", requests[1].Header.Get("Authorization"))
+		body, err := io.ReadAll(requests[1].Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"properties":{"endpointStatus":"Disabled","weight":1}}`, string(body))
+	})
+
+	t.Run("Updates weights and TTL", func(t *testing.T) {
+		provider, mockTransport := newProvider()
+		mockTransport.SetResponse(http.MethodPatch, profilePath+"?api-version=2022-04-01", &MockResponse{
+			StatusCode: 200,
+			Body:       `{}`,
+		})
+		mockTransport.SetResponse(http.MethodPatch, profilePath+"/externalEndpoints/ep1?api-version=2022-04-01", &MockResponse{
+			StatusCode: 200,
+			Body:       `{}`,
+		})
+
+		err := provider.UpdateWeightedRecords(t.Context(), "app.example.com", 30, []WeightedRecord{
+			{Name: "ep1", IP: "1.1.1.1", Weight: 5, Healthy: true},
+			{Name: "ep2", IP: "2.2.2.2", Weight: 1, Healthy: true},
+		})
+		require.NoError(t, err)
+
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 3)
+		body, err := io.ReadAll(requests[1].Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"properties":{"dnsConfig":{"relativeName":"test-profile","ttl":30}}}`, string(body))
+		body, err = io.ReadAll(requests[2].Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"properties":{"endpointStatus":"Enabled","weight":5}}`, string(body))
+	})
+
+	t.Run("Leaves endpoints unchanged when none is healthy", func(t *testing.T) {
+		provider, mockTransport := newProvider()
+
+		err := provider.UpdateWeightedRecords(t.Context(), "app.example.com", 60, []WeightedRecord{
+			{Name: "ep1", IP: "1.1.1.1", Weight: 1, Healthy: false},
+			{Name: "ep2", IP: "2.2.2.2", Weight: 1, Healthy: false},
+		})
+		require.NoError(t, err)
+		assert.Len(t, mockTransport.GetRequests(), 1)
+	})
+
+	t.Run("Endpoint not in the profile", func(t *testing.T) {
+		provider, _ := newProvider()
+
+		err := provider.UpdateWeightedRecords(t.Context(), "app.example.com", 60, []WeightedRecord{
+			{Name: "ep3", IP: "3.3.3.3", Weight: 1, Healthy: true},
+		})
+		require.ErrorContains(t, err, "endpoint 'ep3' not found in Traffic Manager profile 'test-profile'")
+	})
+
+	t.Run("Records are not supported", func(t *testing.T) {
+		provider, _ := newProvider()
+
+		err := provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeA, 60, []string{"1.1.1.1"})
+		require.Error(t, err)
+	})
+}
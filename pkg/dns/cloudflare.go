@@ -7,39 +7,68 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/italypaleale/ddup/pkg/config"
 	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/tracing"
 )
 
 // CloudflareProvider implements the Provider interface for Cloudflare DNS
 type CloudflareProvider struct {
-	name       string
-	apiToken   string
-	zoneID     string
+	name     string
+	apiToken *secret
+	// ID of the zone, if the provider manages a single zone
+	zoneID string
+	// Zone IDs keyed by zone name, if the provider manages multiple zones that are listed in the configuration
+	zoneIDs map[string]string
+	// If neither zoneID nor zoneIDs are set, zones are discovered from the zones the API token grants access to
+	zones *zoneCache
+	// Zone IDs keyed by zone name, for the discovered zones
+	// Protected by discoveredLock
+	discovered     map[string]string
+	discoveredLock sync.RWMutex
+
 	metrics    *appmetrics.AppMetrics
 	httpClient *http.Client
 }
 
 // NewCloudflareProvider creates a new Cloudflare DNS provider
-func NewCloudflareProvider(name string, cfg *config.CloudflareConfig, metrics *appmetrics.AppMetrics) (*CloudflareProvider, error) {
-	if cfg.APIToken == "" {
-		return nil, errors.New("API token is required")
+// If httpClient is nil, a default client is used
+func NewCloudflareProvider(name string, cfg *config.CloudflareConfig, httpClient *http.Client, metrics *appmetrics.AppMetrics) (*CloudflareProvider, error) {
+	if httpClient == nil {
+		httpClient = tracing.NewHTTPClient()
 	}
-	if cfg.ZoneID == "" {
-		return nil, errors.New("zone ID is required")
+
+	apiToken, err := newSecret("API token", cfg.APIToken, cfg.APITokenFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ZoneID != "" && len(cfg.Zones) > 0 {
+		return nil, errors.New("zone ID and zones cannot both be set")
+	}
+	for zoneName, zoneID := range cfg.Zones {
+		if zoneName == "" || zoneID == "" {
+			return nil, errors.New("zones must contain zone names and IDs that are not empty")
+		}
 	}
 
-	return &CloudflareProvider{
+	c := &CloudflareProvider{
 		name:       name,
-		apiToken:   cfg.APIToken,
+		apiToken:   apiToken,
 		zoneID:     cfg.ZoneID,
+		zoneIDs:    cfg.Zones,
 		metrics:    metrics,
-		httpClient: http.DefaultClient,
-	}, nil
+		httpClient: httpClient,
+	}
+	c.zones = newZoneCache(c.listZones)
+
+	return c, nil
 }
 
 // Name returns the provider's name
@@ -47,10 +76,15 @@ func (c *CloudflareProvider) Name() string {
 	return c.name
 }
 
-// UpdateRecords updates DNS records for the given domain with the provided IPs
-func (c *CloudflareProvider) UpdateRecords(ctx context.Context, domain string, ttl int, ips []string) error {
+// UpdateRecords updates DNS records of the given type for the domain with the provided IPs
+func (c *CloudflareProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	zoneID, err := c.zoneIDFor(ctx, domain)
+	if err != nil {
+		return err
+	}
+
 	// First, get existing records
-	existingRecords, err := c.getExistingRecords(ctx, domain)
+	existingRecords, err := c.getExistingRecords(ctx, zoneID, domain, recordType)
 	if err != nil {
 		return fmt.Errorf("error getting existing records: %w", err)
 	}
@@ -74,9 +108,9 @@ func (c *CloudflareProvider) UpdateRecords(ctx context.Context, domain string, t
 			continue
 		}
 
-		slog.DebugContext(ctx, "Deleting record for unhealthy IP", "ip", ip, "recordID", recordID)
+		logger().DebugContext(ctx, "Deleting record for unhealthy IP", "ip", ip, "recordID", recordID)
 
-		err = c.deleteRecord(ctx, recordID)
+		err = c.deleteRecord(ctx, zoneID, recordID)
 		if err != nil {
 			return fmt.Errorf("error deleting record %s for IP %s: %w", recordID, ip, err)
 		}
@@ -89,9 +123,9 @@ func (c *CloudflareProvider) UpdateRecords(ctx context.Context, domain string, t
 			continue
 		}
 
-		slog.DebugContext(ctx, "Creating record for healthy IP", "ip", ip)
+		logger().DebugContext(ctx, "Creating record for healthy IP", "ip", ip)
 
-		err = c.createRecord(ctx, domain, ip, ttl)
+		err = c.createRecord(ctx, zoneID, domain, recordType, ip, ttl)
 		if err != nil {
 			return fmt.Errorf("error creating record for IP %s: %w", ip, err)
 		}
@@ -100,6 +134,107 @@ func (c *CloudflareProvider) UpdateRecords(ctx context.Context, domain string, t
 	return nil
 }
 
+// UpdateTXTRecords sets the TXT records for the name to the given values
+func (c *CloudflareProvider) UpdateTXTRecords(ctx context.Context, name string, ttl int, values []string) error {
+	return c.UpdateRecords(ctx, name, RecordTypeTXT, ttl, values)
+}
+
+// UpdateCNAMERecord sets the CNAME record for the name to point at the target hostname
+func (c *CloudflareProvider) UpdateCNAMERecord(ctx context.Context, name string, ttl int, target string) error {
+	return c.UpdateRecords(ctx, name, RecordTypeCNAME, ttl, []string{target})
+}
+
+// GetRecords returns the IPs in the DNS records of the given type for the domain
+func (c *CloudflareProvider) GetRecords(ctx context.Context, domain string, recordType string) ([]string, error) {
+	zoneID, err := c.zoneIDFor(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	existingRecords, err := c.getExistingRecords(ctx, zoneID, domain, recordType)
+	if err != nil {
+		return nil, fmt.Errorf("error getting existing records: %w", err)
+	}
+
+	ips := make([]string, len(existingRecords))
+	for i, record := range existingRecords {
+		ips[i] = record.Content
+	}
+	return ips, nil
+}
+
+// VerifyCredentials checks that the API token is valid and that it grants access to the zones, by reading them
+// If zones are discovered automatically, it checks that the API token grants access to at least one zone instead
+func (c *CloudflareProvider) VerifyCredentials(ctx context.Context) error {
+	switch {
+	case c.zoneID != "":
+		return c.verifyZone(ctx, c.zoneID)
+	case len(c.zoneIDs) > 0:
+		for _, zoneName := range slices.Sorted(maps.Keys(c.zoneIDs)) {
+			err := c.verifyZone(ctx, c.zoneIDs[zoneName])
+			if err != nil {
+				return fmt.Errorf("zone '%s': %w", zoneName, err)
+			}
+		}
+		return nil
+	default:
+		zones, err := c.zones.Zones(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list zones: %w; check that the API token is valid and that it has the 'Zone:Read' and 'DNS:Edit' permissions", err)
+		}
+		if len(zones) == 0 {
+			return errors.New("the API token doesn't grant access to any zone")
+		}
+		return nil
+	}
+}
+
+// verifyZone checks that the API token grants access to the zone with the ID, by reading it
+func (c *CloudflareProvider) verifyZone(ctx context.Context, zoneID string) error {
+	start := time.Now()
+	var success bool
+	if c.metrics != nil {
+		defer func() {
+			c.metrics.RecordAPICall("cloudflare", http.MethodGet, "/v4/zones/"+zoneID, success, time.Since(start))
+		}()
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, "https://api.cloudflare.com/client/v4/zones/"+zoneID, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	err = c.setAuthorization(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	// The result is a zone and not a list of records, so it's not decoded
+	var cfResp struct {
+		Success bool              `json:"success"`
+		Errors  []CloudflareError `json:"errors"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&cfResp)
+	if err != nil {
+		return fmt.Errorf("error reading response body (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if !cfResp.Success {
+		return fmt.Errorf("failed to read zone '%s' (HTTP %d): %v; check that the API token is valid and that it has the 'Zone:Read' and 'DNS:Edit' permissions for the zone", zoneID, resp.StatusCode, cfResp.Errors)
+	}
+
+	success = true
+	return nil
+}
+
 // CloudflareRecord represents a DNS record from Cloudflare API
 type CloudflareRecord struct {
 	ID      string `json:"id"`
@@ -127,16 +262,128 @@ func (ce CloudflareError) String() string {
 	return fmt.Sprintf("(%d) %s", ce.Code, ce.Message)
 }
 
-func (c *CloudflareProvider) getExistingRecords(ctx context.Context, domain string) ([]CloudflareRecord, error) {
+// cloudflareZonesResponse represents the response from listing zones
+//
+//nolint:tagliatelle
+type cloudflareZonesResponse struct {
+	Success bool              `json:"success"`
+	Errors  []CloudflareError `json:"errors"`
+	Result  []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+// zoneIDFor returns the ID of the zone of the domain
+// The zone is the one in the configuration, or the longest zone that the domain belongs to, among the configured or discovered ones
+func (c *CloudflareProvider) zoneIDFor(ctx context.Context, domain string) (string, error) {
+	if c.zoneID != "" {
+		return c.zoneID, nil
+	}
+
+	if len(c.zoneIDs) > 0 {
+		zoneName, ok := zoneForName(domain, slices.Collect(maps.Keys(c.zoneIDs)))
+		if !ok {
+			return "", fmt.Errorf("domain %s does not belong to any of the zones in the configuration", domain)
+		}
+		return c.zoneIDs[zoneName], nil
+	}
+
+	zoneName, err := c.zones.ZoneFor(ctx, domain)
+	if err != nil {
+		return "", err
+	}
+
+	c.discoveredLock.RLock()
+	zoneID := c.discovered[zoneName]
+	c.discoveredLock.RUnlock()
+	if zoneID == "" {
+		return "", fmt.Errorf("zone ID not found for zone %s", zoneName)
+	}
+	return zoneID, nil
+}
+
+// listZones returns the names of the zones the API token grants access to, and stores their IDs
+func (c *CloudflareProvider) listZones(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	var success bool
+	if c.metrics != nil {
+		defer func() {
+			c.metrics.RecordAPICall("cloudflare", http.MethodGet, "/v4/zones", success, time.Since(start))
+		}()
+	}
+
+	// Results are split in multiple pages
+	discovered := map[string]string{}
+	for page := 1; ; page++ {
+		res, err := c.listZonesPage(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, z := range res.Result {
+			discovered[z.Name] = z.ID
+		}
+		if page >= res.ResultInfo.TotalPages {
+			break
+		}
+	}
+
+	c.discoveredLock.Lock()
+	c.discovered = discovered
+	c.discoveredLock.Unlock()
+
+	success = true
+	return slices.Collect(maps.Keys(discovered)), nil
+}
+
+// listZonesPage returns a page of the list of zones
+func (c *CloudflareProvider) listZonesPage(ctx context.Context, page int) (*cloudflareZonesResponse, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, "https://api.cloudflare.com/client/v4/zones?per_page=50&page="+strconv.Itoa(page), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	err = c.setAuthorization(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request error: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	var cfResp cloudflareZonesResponse
+	err = json.NewDecoder(resp.Body).Decode(&cfResp)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if !cfResp.Success {
+		return nil, fmt.Errorf("API error: %v", cfResp.Errors)
+	}
+
+	return &cfResp, nil
+}
+
+func (c *CloudflareProvider) getExistingRecords(ctx context.Context, zoneID string, domain string, recordType string) ([]CloudflareRecord, error) {
 	start := time.Now()
 	var success bool
 	if c.metrics != nil {
 		defer func() {
-			c.metrics.RecordAPICall("cloudflare", http.MethodGet, fmt.Sprintf("/v4/zones/%s/dns_records", c.zoneID), success, time.Since(start))
+			c.metrics.RecordAPICall("cloudflare", http.MethodGet, fmt.Sprintf("/v4/zones/%s/dns_records", zoneID), success, time.Since(start))
 		}()
 	}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?name=%s&type=A", c.zoneID, domain)
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?name=%s&type=%s", zoneID, domain, recordType)
 	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
@@ -144,7 +391,10 @@ func (c *CloudflareProvider) getExistingRecords(ctx context.Context, domain stri
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	err = c.setAuthorization(req)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
@@ -167,16 +417,16 @@ func (c *CloudflareProvider) getExistingRecords(ctx context.Context, domain stri
 	return cfResp.Result, nil
 }
 
-func (c *CloudflareProvider) deleteRecord(ctx context.Context, recordID string) error {
+func (c *CloudflareProvider) deleteRecord(ctx context.Context, zoneID string, recordID string) error {
 	start := time.Now()
 	var success bool
 	if c.metrics != nil {
 		defer func() {
-			c.metrics.RecordAPICall("cloudflare", http.MethodDelete, fmt.Sprintf("/v4/zones/%s/dns_records", c.zoneID), success, time.Since(start))
+			c.metrics.RecordAPICall("cloudflare", http.MethodDelete, fmt.Sprintf("/v4/zones/%s/dns_records", zoneID), success, time.Since(start))
 		}()
 	}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", c.zoneID, recordID)
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, recordID)
 	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 	req, err := http.NewRequestWithContext(reqCtx, http.MethodDelete, url, nil)
@@ -184,7 +434,10 @@ func (c *CloudflareProvider) deleteRecord(ctx context.Context, recordID string)
 		return fmt.Errorf("error creating request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	err = c.setAuthorization(req)
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
@@ -202,19 +455,19 @@ func (c *CloudflareProvider) deleteRecord(ctx context.Context, recordID string)
 	return nil
 }
 
-func (c *CloudflareProvider) createRecord(ctx context.Context, domain, ip string, ttl int) error {
+func (c *CloudflareProvider) createRecord(ctx context.Context, zoneID, domain, recordType, ip string, ttl int) error {
 	start := time.Now()
 	var success bool
 	if c.metrics != nil {
 		defer func() {
-			c.metrics.RecordAPICall("cloudflare", http.MethodPost, fmt.Sprintf("/v4/zones/%s/dns_records", c.zoneID), success, time.Since(start))
+			c.metrics.RecordAPICall("cloudflare", http.MethodPost, fmt.Sprintf("/v4/zones/%s/dns_records", zoneID), success, time.Since(start))
 		}()
 	}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", c.zoneID)
+	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records", zoneID)
 
 	record := map[string]any{
-		"type":    "A",
+		"type":    recordType,
 		"name":    domain,
 		"content": ip,
 		"ttl":     ttl,
@@ -232,7 +485,10 @@ func (c *CloudflareProvider) createRecord(ctx context.Context, domain, ip string
 		return fmt.Errorf("error creating request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiToken)
+	err = c.setAuthorization(req)
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
@@ -249,3 +505,14 @@ func (c *CloudflareProvider) createRecord(ctx context.Context, domain, ip string
 	success = true
 	return nil
 }
+
+// setAuthorization sets the Authorization header in the request
+func (c *CloudflareProvider) setAuthorization(req *http.Request) error {
+	apiToken, err := c.apiToken.Get()
+	if err != nil {
+		return fmt.Errorf("error getting API token: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiToken)
+	return nil
+}
@@ -46,7 +46,7 @@ func TestCloudflareProvider(t *testing.T) {
 		})
 
 		// Test creating records
-		err := provider.UpdateRecords(t.Context(), "example.com", 300, []string{"1.1.1.1"})
+		err := provider.UpdateRecords(t.Context(), "example.com", RecordTypeA, 300, []string{"1.1.1.1"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -83,6 +83,37 @@ func TestCloudflareProvider(t *testing.T) {
 		assert.EqualValues(t, 300, createReq["ttl"]) // JSON unmarshals numbers as float64
 	})
 
+	t.Run("Create AAAA record", func(t *testing.T) {
+		provider, mockTransport := newCloudflareTestProviderWithMock()
+
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/test-zone-id/dns_records?name=example.com&type=AAAA", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": []}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodPost, "/client/v4/zones/test-zone-id/dns_records", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": {}}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		err := provider.UpdateRecords(t.Context(), "example.com", RecordTypeAAAA, 300, []string{"2001:db8::1"})
+		require.NoError(t, err)
+
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 2)
+		assert.Contains(t, requests[0].URL.RawQuery, "type=AAAA")
+
+		body, err := io.ReadAll(requests[1].Body)
+		require.NoError(t, err)
+
+		var createReq map[string]any
+		err = json.Unmarshal(body, &createReq)
+		require.NoError(t, err)
+		assert.Equal(t, "AAAA", createReq["type"])
+		assert.Equal(t, "2001:db8::1", createReq["content"])
+	})
+
 	t.Run("Delete record", func(t *testing.T) {
 		provider, mockTransport := newCloudflareTestProviderWithMock()
 
@@ -119,7 +150,7 @@ func TestCloudflareProvider(t *testing.T) {
 		})
 
 		// Test deleting records (passing empty IPs array)
-		err := provider.UpdateRecords(t.Context(), "www.example.com", 300, []string{})
+		err := provider.UpdateRecords(t.Context(), "www.example.com", RecordTypeA, 300, []string{})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -193,7 +224,7 @@ func TestCloudflareProvider(t *testing.T) {
 		})
 
 		// Test updating records with new IPs (keep 5.6.7.8, remove 1.2.3.4, add 9.10.11.12)
-		err := provider.UpdateRecords(t.Context(), "api.example.com", 300, []string{"5.6.7.8", "9.10.11.12"})
+		err := provider.UpdateRecords(t.Context(), "api.example.com", RecordTypeA, 300, []string{"5.6.7.8", "9.10.11.12"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -240,7 +271,7 @@ func TestCloudflareProvider(t *testing.T) {
 		})
 
 		// Test updating with the same IP (no changes needed)
-		err := provider.UpdateRecords(t.Context(), "api.example.com", 300, []string{"1.2.3.4"})
+		err := provider.UpdateRecords(t.Context(), "api.example.com", RecordTypeA, 300, []string{"1.2.3.4"})
 		require.NoError(t, err)
 
 		// Verify only the GET request was made (no DELETE or POST)
@@ -248,6 +279,101 @@ func TestCloudflareProvider(t *testing.T) {
 		require.Len(t, requests, 1) // GET only
 	})
 
+	t.Run("Get records", func(t *testing.T) {
+		provider, mockTransport := newCloudflareTestProviderWithMock()
+
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/test-zone-id/dns_records?name=api.example.com&type=A", &MockResponse{
+			StatusCode: 200,
+			Body: `{
+				"success": true,
+				"errors": [],
+				"result": [
+					{"id": "record-1", "type": "A", "name": "api.example.com", "content": "1.2.3.4", "ttl": 300},
+					{"id": "record-2", "type": "A", "name": "api.example.com", "content": "5.6.7.8", "ttl": 300}
+				]
+			}`,
+			Headers: map[string]string{"Content-Type": "application/json"},
+		})
+
+		ips, err := provider.GetRecords(t.Context(), "api.example.com", RecordTypeA)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4", "5.6.7.8"}, ips)
+	})
+
+	t.Run("Multiple zones in the configuration", func(t *testing.T) {
+		provider, mockTransport := newCloudflareTestProviderWithMock()
+		provider.zoneID = ""
+		provider.zoneIDs = map[string]string{
+			"example.com":    "zone-1",
+			"eu.example.com": "zone-2",
+			"example.org":    "zone-3",
+		}
+
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/zone-2/dns_records?name=api.eu.example.com&type=A", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": [{"id": "record-1", "type": "A", "name": "api.eu.example.com", "content": "1.2.3.4", "ttl": 300}]}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/zone-3/dns_records?name=example.org&type=A", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": []}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodPost, "/client/v4/zones/zone-3/dns_records", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": {}}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		// The longest zone that matches is used
+		ips, err := provider.GetRecords(t.Context(), "api.eu.example.com", RecordTypeA)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4"}, ips)
+
+		err = provider.UpdateRecords(t.Context(), "example.org", RecordTypeA, 300, []string{"5.6.7.8"})
+		require.NoError(t, err)
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 3)
+		assert.Equal(t, "/client/v4/zones/zone-3/dns_records", requests[2].URL.Path)
+
+		// Domains that don't belong to any zone return an error
+		_, err = provider.GetRecords(t.Context(), "www.example.net", RecordTypeA)
+		require.ErrorContains(t, err, "does not belong to any of the zones in the configuration")
+		assert.Len(t, mockTransport.GetRequests(), 3)
+	})
+
+	t.Run("Zones discovered automatically", func(t *testing.T) {
+		provider, mockTransport := newCloudflareTestProviderWithMock()
+		provider.zoneID = ""
+		provider.zones = newZoneCache(provider.listZones)
+
+		// The list of zones is split in two pages
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones?per_page=50&page=1", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": [{"id": "zone-1", "name": "example.com"}], "result_info": {"page": 1, "total_pages": 2}}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones?per_page=50&page=2", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": [{"id": "zone-2", "name": "example.org"}], "result_info": {"page": 2, "total_pages": 2}}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/zone-2/dns_records?name=www.example.org&type=A", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": [{"id": "record-1", "type": "A", "name": "www.example.org", "content": "1.2.3.4", "ttl": 300}]}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		ips, err := provider.GetRecords(t.Context(), "www.example.org", RecordTypeA)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4"}, ips)
+		require.NoError(t, provider.VerifyCredentials(t.Context()))
+
+		// The list of zones is read only once
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 3)
+	})
+
 	t.Run("Multiple IPs for domain", func(t *testing.T) {
 		provider, mockTransport := newCloudflareTestProviderWithMock()
 
@@ -280,7 +406,7 @@ func TestCloudflareProvider(t *testing.T) {
 		})
 
 		// Test creating multiple records for the same domain
-		err := provider.UpdateRecords(t.Context(), "multi.example.com", 300, []string{"1.1.1.1", "2.2.2.2"})
+		err := provider.UpdateRecords(t.Context(), "multi.example.com", RecordTypeA, 300, []string{"1.1.1.1", "2.2.2.2"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -328,7 +454,7 @@ func TestCloudflareProvider(t *testing.T) {
 		})
 
 		// Test that API errors are properly handled
-		err := provider.UpdateRecords(t.Context(), "error.example.com", 300, []string{"1.1.1.1"})
+		err := provider.UpdateRecords(t.Context(), "error.example.com", RecordTypeA, 300, []string{"1.1.1.1"})
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "API error")
 		assert.Contains(t, err.Error(), "1003")
@@ -346,7 +472,7 @@ func TestCloudflareProvider(t *testing.T) {
 		})
 
 		// Test that HTTP errors are handled (this will succeed in getting records but fail parsing the response)
-		err := provider.UpdateRecords(t.Context(), "http-error.example.com", 300, []string{"1.1.1.1"})
+		err := provider.UpdateRecords(t.Context(), "http-error.example.com", RecordTypeA, 300, []string{"1.1.1.1"})
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "API error")
 	})
@@ -363,9 +489,24 @@ func TestCloudflareProvider(t *testing.T) {
 				expectErr: "API token is required",
 			},
 			{
-				name:      "missing zone ID",
+				name:      "zone ID and zones",
+				config:    &config.CloudflareConfig{APIToken: "test-token", ZoneID: "test-zone", Zones: map[string]string{"example.com": "zone-1"}},
+				expectErr: "zone ID and zones cannot both be set",
+			},
+			{
+				name:      "empty zone ID in zones",
+				config:    &config.CloudflareConfig{APIToken: "test-token", Zones: map[string]string{"example.com": ""}},
+				expectErr: "zones must contain zone names and IDs that are not empty",
+			},
+			{
+				name:      "valid config with zones",
+				config:    &config.CloudflareConfig{APIToken: "test-token", Zones: map[string]string{"example.com": "zone-1"}},
+				expectErr: "",
+			},
+			{
+				name:      "valid config with zones discovery",
 				config:    &config.CloudflareConfig{APIToken: "test-token"},
-				expectErr: "zone ID is required",
+				expectErr: "",
 			},
 			{
 				name:      "valid config",
@@ -376,7 +517,7 @@ func TestCloudflareProvider(t *testing.T) {
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				provider, err := NewCloudflareProvider("test", tt.config, nil)
+				provider, err := NewCloudflareProvider("test", tt.config, nil, nil)
 				if tt.expectErr != "" {
 					require.Error(t, err)
 					assert.Contains(t, err.Error(), tt.expectErr)
@@ -406,7 +547,7 @@ func newCloudflareTestProviderWithMock() (*CloudflareProvider, *MockHTTPTranspor
 
 	provider := &CloudflareProvider{
 		name:       "test",
-		apiToken:   "test-token",
+		apiToken:   staticSecret("test-token"),
 		zoneID:     "test-zone-id",
 		httpClient: mockClient,
 	}
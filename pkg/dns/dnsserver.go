@@ -0,0 +1,482 @@
+package dns
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Default address the embedded DNS server listens on
+const defaultDNSServerBind = ":53"
+
+// Timeout for reading queries and writing responses over TCP
+const dnsServerTCPTimeout = 10 * time.Second
+
+// Maximum size of responses sent over UDP; larger responses are truncated, so clients retry over TCP
+const dnsServerMaxUDPSize = 512
+
+var (
+	dnsServersLock sync.Mutex
+	// Embedded DNS servers, keyed by the address they listen on
+	// Protected by dnsServersLock
+	dnsServers = map[string]*dnsServer{}
+	// Receives a value when a server is added, so RunDNSServers starts it
+	dnsServersAdded = make(chan struct{}, 1)
+)
+
+// DNSServerProvider implements the Provider interface by serving records with the embedded authoritative DNS server
+// Providers with the same bind address share the same server and records, which are kept when the configuration is reloaded
+type DNSServerProvider struct {
+	name   string
+	server *dnsServer
+}
+
+// NewDNSServerProvider creates a new provider for the embedded DNS server
+// The server starts listening when RunDNSServers is invoked
+func NewDNSServerProvider(name string, cfg *config.DNSServerConfig) (*DNSServerProvider, error) {
+	bind := cmp.Or(cfg.Bind, defaultDNSServerBind)
+	_, _, err := net.SplitHostPort(bind)
+	if err != nil {
+		return nil, fmt.Errorf("bind address '%s' is invalid: %w", bind, err)
+	}
+
+	dnsServersLock.Lock()
+	server, ok := dnsServers[bind]
+	if !ok {
+		server = &dnsServer{
+			bind:    bind,
+			records: map[dnsServerKey]dnsServerRecords{},
+		}
+		dnsServers[bind] = server
+	}
+	dnsServersLock.Unlock()
+
+	if !ok {
+		select {
+		case dnsServersAdded <- struct{}{}:
+		default:
+			// There's a notification pending already
+		}
+	}
+
+	return &DNSServerProvider{
+		name:   name,
+		server: server,
+	}, nil
+}
+
+// Name returns the provider's name
+func (p *DNSServerProvider) Name() string {
+	return p.name
+}
+
+// UpdateRecords sets the records of the given type for the domain that are served by the DNS server
+func (p *DNSServerProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	p.server.setRecords(domain, recordType, ttl, ips)
+	return nil
+}
+
+// UpdateTXTRecords sets the TXT records for the name to the given values
+func (p *DNSServerProvider) UpdateTXTRecords(ctx context.Context, name string, ttl int, values []string) error {
+	return p.UpdateRecords(ctx, name, RecordTypeTXT, ttl, values)
+}
+
+// UpdateCNAMERecord sets the CNAME record for the name to point at the target hostname
+func (p *DNSServerProvider) UpdateCNAMERecord(ctx context.Context, name string, ttl int, target string) error {
+	return p.UpdateRecords(ctx, name, RecordTypeCNAME, ttl, []string{target})
+}
+
+// GetRecords returns the values of the records of the given type for the domain that are served by the DNS server
+func (p *DNSServerProvider) GetRecords(ctx context.Context, domain string, recordType string) ([]string, error) {
+	return p.server.getRecords(domain, recordType).values, nil
+}
+
+// RunDNSServers runs the embedded DNS servers until the context is canceled
+// Servers that are added when the configuration is reloaded are started too
+func RunDNSServers(ctx context.Context) error {
+	defer func() {
+		dnsServersLock.Lock()
+		defer dnsServersLock.Unlock()
+		for _, server := range dnsServers {
+			server.stop()
+		}
+	}()
+
+	for {
+		dnsServersLock.Lock()
+		var err error
+		for _, server := range dnsServers {
+			err = server.start()
+			if err != nil {
+				err = fmt.Errorf("failed to start DNS server on '%s': %w", server.bind, err)
+				break
+			}
+		}
+		dnsServersLock.Unlock()
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-dnsServersAdded:
+			// Start the new servers
+		}
+	}
+}
+
+// dnsServerKey is the key of a set of records served by the DNS server
+type dnsServerKey struct {
+	name       string
+	recordType string
+}
+
+// dnsServerRecords is a set of records of the same type for a name
+type dnsServerRecords struct {
+	ttl    int
+	values []string
+}
+
+// dnsServer is an embedded authoritative DNS server, which serves the records set by the providers over UDP and TCP
+// It only answers queries for names it has records for, and refuses the others
+type dnsServer struct {
+	bind string
+
+	lock sync.Mutex
+	// Records served, keyed by name and type
+	// Protected by lock
+	records map[dnsServerKey]dnsServerRecords
+	// Listeners, which are nil if the server is not running
+	// Protected by lock
+	udp net.PacketConn
+	tcp net.Listener
+}
+
+// normalizeDNSServerName returns the name in the format used as key for the records
+func normalizeDNSServerName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func (s *dnsServer) setRecords(name string, recordType string, ttl int, values []string) {
+	key := dnsServerKey{name: normalizeDNSServerName(name), recordType: recordType}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(values) == 0 {
+		delete(s.records, key)
+		return
+	}
+	s.records[key] = dnsServerRecords{
+		ttl:    ttl,
+		values: slices.Clone(values),
+	}
+}
+
+func (s *dnsServer) getRecords(name string, recordType string) dnsServerRecords {
+	key := dnsServerKey{name: normalizeDNSServerName(name), recordType: recordType}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := s.records[key]
+	r.values = slices.Clone(r.values)
+	return r
+}
+
+// hasName returns true if the server has records of any type for the name
+func (s *dnsServer) hasName(name string) bool {
+	name = normalizeDNSServerName(name)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key := range s.records {
+		if key.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// start starts listening, if the server is not running already
+func (s *dnsServer) start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.udp != nil {
+		return nil
+	}
+
+	udp, err := net.ListenPacket("udp", s.bind)
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP: %w", err)
+	}
+	tcp, err := net.Listen("tcp", s.bind)
+	if err != nil {
+		_ = udp.Close()
+		return fmt.Errorf("failed to listen on TCP: %w", err)
+	}
+	s.udp = udp
+	s.tcp = tcp
+
+	go s.serveUDP(udp)
+	go s.serveTCP(tcp)
+
+	logger().Info("DNS server started", slog.String("bind", s.bind))
+	return nil
+}
+
+// stop stops listening, if the server is running
+func (s *dnsServer) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.udp == nil {
+		return
+	}
+	_ = s.udp.Close()
+	_ = s.tcp.Close()
+	s.udp = nil
+	s.tcp = nil
+}
+
+// localAddr returns the address the server listens on over UDP, or nil if it's not running
+func (s *dnsServer) localAddr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+func (s *dnsServer) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			logger().Warn("Error reading DNS query over UDP", slog.Any("error", err))
+			continue
+		}
+
+		res, ok := s.handle(buf[:n], dnsServerMaxUDPSize)
+		if !ok {
+			continue
+		}
+		_, err = conn.WriteTo(res, addr)
+		if err != nil {
+			logger().Debug("Error sending DNS response over UDP", slog.Any("error", err), slog.String("client", addr.String()))
+		}
+	}
+}
+
+func (s *dnsServer) serveTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			logger().Warn("Error accepting DNS connection over TCP", slog.Any("error", err))
+			continue
+		}
+
+		go s.serveTCPConn(conn)
+	}
+}
+
+func (s *dnsServer) serveTCPConn(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	// Messages over TCP are prefixed with their length, and clients can send multiple queries on the same connection
+	for {
+		_ = conn.SetDeadline(time.Now().Add(dnsServerTCPTimeout))
+
+		var length uint16
+		err := binary.Read(conn, binary.BigEndian, &length)
+		if err != nil {
+			return
+		}
+		query := make([]byte, length)
+		_, err = io.ReadFull(conn, query)
+		if err != nil {
+			return
+		}
+
+		res, ok := s.handle(query, 0)
+		if !ok {
+			return
+		}
+		_, err = conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(res)))) //nolint:gosec
+		if err != nil {
+			return
+		}
+		_, err = conn.Write(res)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle returns the response to a query
+// If maxSize is greater than 0, responses larger than that are truncated
+// It returns false if the message can't be parsed, so no response is sent
+func (s *dnsServer) handle(query []byte, maxSize int) ([]byte, bool) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil || header.Response {
+		return nil, false
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, false
+	}
+
+	res := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               header.ID,
+			Response:         true,
+			OpCode:           header.OpCode,
+			RecursionDesired: header.RecursionDesired,
+		},
+		Questions: questions,
+	}
+
+	switch {
+	case header.OpCode != 0:
+		res.RCode = dnsmessage.RCodeNotImplemented
+	case len(questions) != 1:
+		res.RCode = dnsmessage.RCodeFormatError
+	case questions[0].Class != dnsmessage.ClassINET || !s.hasName(questions[0].Name.String()):
+		// The server is authoritative only for the names it has records for
+		res.RCode = dnsmessage.RCodeRefused
+	default:
+		res.Authoritative = true
+		res.Answers = s.answers(questions[0].Name.String(), questions[0].Type)
+	}
+
+	out, err := res.Pack()
+	if err != nil {
+		logger().Warn("Error packing DNS response", slog.Any("error", err))
+		res.Answers = nil
+		res.RCode = dnsmessage.RCodeServerFailure
+		out, err = res.Pack()
+		if err != nil {
+			return nil, false
+		}
+	}
+	if maxSize > 0 && len(out) > maxSize {
+		res.Answers = nil
+		res.Truncated = true
+		out, err = res.Pack()
+		if err != nil {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// answers returns the resource records that answer a question for a name the server has records for
+func (s *dnsServer) answers(name string, qtype dnsmessage.Type) []dnsmessage.Resource {
+	// A name with a CNAME record can't have other records, so the CNAME record is returned for queries of any type
+	// If the target has records on this server, they're included too
+	cname := s.getRecords(name, RecordTypeCNAME)
+	if len(cname.values) > 0 {
+		res := s.resources(name, RecordTypeCNAME, cname)
+		if qtype != dnsmessage.TypeCNAME && s.hasName(cname.values[0]) {
+			res = append(res, s.answers(cname.values[0], qtype)...)
+		}
+		return res
+	}
+
+	var recordTypes []string
+	switch qtype {
+	case dnsmessage.TypeA:
+		recordTypes = []string{RecordTypeA}
+	case dnsmessage.TypeAAAA:
+		recordTypes = []string{RecordTypeAAAA}
+	case dnsmessage.TypeTXT:
+		recordTypes = []string{RecordTypeTXT}
+	case dnsmessage.TypeALL:
+		recordTypes = []string{RecordTypeA, RecordTypeAAAA, RecordTypeTXT}
+	default:
+		// Other types have no records
+		return nil
+	}
+
+	var res []dnsmessage.Resource
+	for _, recordType := range recordTypes {
+		res = append(res, s.resources(name, recordType, s.getRecords(name, recordType))...)
+	}
+	return res
+}
+
+// resources returns the resource records for a set of records
+// Values that are not valid for the type are skipped
+func (s *dnsServer) resources(name string, recordType string, records dnsServerRecords) []dnsmessage.Resource {
+	rrName, err := dnsmessage.NewName(normalizeDNSServerName(name) + ".")
+	if err != nil {
+		return nil
+	}
+
+	res := make([]dnsmessage.Resource, 0, len(records.values))
+	for _, value := range records.values {
+		rr := dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{
+				Name:  rrName,
+				Class: dnsmessage.ClassINET,
+				TTL:   uint32(max(records.ttl, 0)), //nolint:gosec
+			},
+		}
+
+		switch recordType {
+		case RecordTypeA, RecordTypeAAAA:
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				continue
+			}
+			addr = addr.Unmap()
+			if addr.Is4() {
+				rr.Body = &dnsmessage.AResource{A: addr.As4()}
+			} else {
+				rr.Body = &dnsmessage.AAAAResource{AAAA: addr.As16()}
+			}
+		case RecordTypeTXT:
+			// Strings in TXT records are limited to 255 bytes, so longer values are split
+			var txt []string
+			for len(value) > 255 {
+				txt = append(txt, value[:255])
+				value = value[255:]
+			}
+			rr.Body = &dnsmessage.TXTResource{TXT: append(txt, value)}
+		case RecordTypeCNAME:
+			target, err := dnsmessage.NewName(normalizeDNSServerName(value) + ".")
+			if err != nil {
+				continue
+			}
+			rr.Body = &dnsmessage.CNAMEResource{CNAME: target}
+		default:
+			continue
+		}
+		res = append(res, rr)
+	}
+	return res
+}
@@ -0,0 +1,187 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func newTestDNSServer() (*DNSServerProvider, *dnsServer) {
+	server := &dnsServer{
+		bind:    "127.0.0.1:0",
+		records: map[dnsServerKey]dnsServerRecords{},
+	}
+	return &DNSServerProvider{name: "test", server: server}, server
+}
+
+func dnsServerQuery(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	query, err := msg.Pack()
+	require.NoError(t, err)
+	return query
+}
+
+func dnsServerResponse(t *testing.T, res []byte) dnsmessage.Message {
+	t.Helper()
+
+	var msg dnsmessage.Message
+	err := msg.Unpack(res)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestDNSServerProvider(t *testing.T) {
+	provider, server := newTestDNSServer()
+
+	require.NoError(t, provider.UpdateRecords(t.Context(), "App.Example.com", RecordTypeA, 60, []string{"1.1.1.1", "2.2.2.2"}))
+	require.NoError(t, provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeAAAA, 60, []string{"2001:db8::1"}))
+	require.NoError(t, provider.UpdateTXTRecords(t.Context(), "_ddup.app.example.com", 120, []string{"heritage=ddup"}))
+	require.NoError(t, provider.UpdateCNAMERecord(t.Context(), "www.example.com", 30, "app.example.com"))
+
+	t.Run("Reads records", func(t *testing.T) {
+		records, err := provider.GetRecords(t.Context(), "app.example.com.", RecordTypeA)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.1.1.1", "2.2.2.2"}, records)
+
+		records, err = provider.GetRecords(t.Context(), "other.example.com", RecordTypeA)
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	})
+
+	t.Run("A records", func(t *testing.T) {
+		res, ok := server.handle(dnsServerQuery(t, "app.example.com.", dnsmessage.TypeA), dnsServerMaxUDPSize)
+		require.True(t, ok)
+
+		msg := dnsServerResponse(t, res)
+		assert.Equal(t, uint16(42), msg.ID)
+		assert.True(t, msg.Authoritative)
+		assert.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+		require.Len(t, msg.Answers, 2)
+		assert.Equal(t, uint32(60), msg.Answers[0].Header.TTL)
+		assert.Equal(t, &dnsmessage.AResource{A: [4]byte{1, 1, 1, 1}}, msg.Answers[0].Body)
+		assert.Equal(t, &dnsmessage.AResource{A: [4]byte{2, 2, 2, 2}}, msg.Answers[1].Body)
+	})
+
+	t.Run("TXT records", func(t *testing.T) {
+		res, ok := server.handle(dnsServerQuery(t, "_ddup.app.example.com.", dnsmessage.TypeTXT), dnsServerMaxUDPSize)
+		require.True(t, ok)
+
+		msg := dnsServerResponse(t, res)
+		require.Len(t, msg.Answers, 1)
+		assert.Equal(t, uint32(120), msg.Answers[0].Header.TTL)
+		assert.Equal(t, &dnsmessage.TXTResource{TXT: []string{"heritage=ddup"}}, msg.Answers[0].Body)
+	})
+
+	t.Run("CNAME records include the records of the target", func(t *testing.T) {
+		res, ok := server.handle(dnsServerQuery(t, "www.example.com.", dnsmessage.TypeAAAA), dnsServerMaxUDPSize)
+		require.True(t, ok)
+
+		msg := dnsServerResponse(t, res)
+		require.Len(t, msg.Answers, 2)
+		assert.Equal(t, &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("app.example.com.")}, msg.Answers[0].Body)
+		assert.Equal(t, "app.example.com.", msg.Answers[1].Header.Name.String())
+		assert.Equal(t, dnsmessage.TypeAAAA, msg.Answers[1].Header.Type)
+	})
+
+	t.Run("No records of the type", func(t *testing.T) {
+		res, ok := server.handle(dnsServerQuery(t, "app.example.com.", dnsmessage.TypeMX), dnsServerMaxUDPSize)
+		require.True(t, ok)
+
+		msg := dnsServerResponse(t, res)
+		assert.True(t, msg.Authoritative)
+		assert.Equal(t, dnsmessage.RCodeSuccess, msg.RCode)
+		assert.Empty(t, msg.Answers)
+	})
+
+	t.Run("Unknown names are refused", func(t *testing.T) {
+		res, ok := server.handle(dnsServerQuery(t, "other.example.com.", dnsmessage.TypeA), dnsServerMaxUDPSize)
+		require.True(t, ok)
+
+		msg := dnsServerResponse(t, res)
+		assert.False(t, msg.Authoritative)
+		assert.Equal(t, dnsmessage.RCodeRefused, msg.RCode)
+	})
+
+	t.Run("Removing all records of a type", func(t *testing.T) {
+		require.NoError(t, provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeAAAA, 60, nil))
+		records, err := provider.GetRecords(t.Context(), "app.example.com", RecordTypeAAAA)
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	})
+
+	t.Run("Large responses over UDP are truncated", func(t *testing.T) {
+		ips := make([]string, 100)
+		for i := range ips {
+			ips[i] = net.IPv4(10, 0, 0, byte(i)).String() //nolint:gosec
+		}
+		require.NoError(t, provider.UpdateRecords(t.Context(), "many.example.com", RecordTypeA, 60, ips))
+
+		res, ok := server.handle(dnsServerQuery(t, "many.example.com.", dnsmessage.TypeA), dnsServerMaxUDPSize)
+		require.True(t, ok)
+		msg := dnsServerResponse(t, res)
+		assert.True(t, msg.Truncated)
+		assert.Empty(t, msg.Answers)
+
+		res, ok = server.handle(dnsServerQuery(t, "many.example.com.", dnsmessage.TypeA), 0)
+		require.True(t, ok)
+		msg = dnsServerResponse(t, res)
+		assert.False(t, msg.Truncated)
+		assert.Len(t, msg.Answers, 100)
+	})
+
+	t.Run("Invalid messages are ignored", func(t *testing.T) {
+		_, ok := server.handle([]byte{0x01, 0x02}, dnsServerMaxUDPSize)
+		assert.False(t, ok)
+	})
+}
+
+func TestDNSServerListener(t *testing.T) {
+	provider, server := newTestDNSServer()
+	require.NoError(t, provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeA, 60, []string{"1.1.1.1"}))
+
+	require.NoError(t, server.start())
+	t.Cleanup(server.stop)
+
+	conn, err := net.Dial("udp", server.localAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	_, err = conn.Write(dnsServerQuery(t, "app.example.com.", dnsmessage.TypeA))
+	require.NoError(t, err)
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+
+	msg := dnsServerResponse(t, buf[:n])
+	require.Len(t, msg.Answers, 1)
+	assert.Equal(t, &dnsmessage.AResource{A: [4]byte{1, 1, 1, 1}}, msg.Answers[0].Body)
+}
+
+func TestNewDNSServerProvider(t *testing.T) {
+	t.Run("Providers with the same address share the server", func(t *testing.T) {
+		p1, err := NewDNSServerProvider("p1", &config.DNSServerConfig{Bind: "127.0.0.1:15353"})
+		require.NoError(t, err)
+		p2, err := NewDNSServerProvider("p2", &config.DNSServerConfig{Bind: "127.0.0.1:15353"})
+		require.NoError(t, err)
+		assert.Same(t, p1.server, p2.server)
+	})
+
+	t.Run("Invalid address", func(t *testing.T) {
+		_, err := NewDNSServerProvider("test", &config.DNSServerConfig{Bind: "localhost"})
+		require.ErrorContains(t, err, "bind address 'localhost' is invalid")
+	})
+}
@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+)
+
+// Default timeout for the command of the exec provider
+const defaultExecTimeout = 30 * time.Second
+
+// ExecProvider implements the Provider interface by running a command, which receives the desired state of the records on stdin
+type ExecProvider struct {
+	name    string
+	command string
+	args    []string
+	timeout time.Duration
+	metrics *appmetrics.AppMetrics
+}
+
+// NewExecProvider creates a new exec DNS provider
+func NewExecProvider(name string, cfg *config.ExecConfig, metrics *appmetrics.AppMetrics) (*ExecProvider, error) {
+	// The command line is split on whitespace, and it's not executed through a shell
+	fields := strings.Fields(cfg.Command)
+	if len(fields) == 0 {
+		return nil, errors.New("command is required")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+
+	return &ExecProvider{
+		name:    name,
+		command: fields[0],
+		args:    fields[1:],
+		timeout: timeout,
+		metrics: metrics,
+	}, nil
+}
+
+// Name returns the provider's name
+func (e *ExecProvider) Name() string {
+	return e.name
+}
+
+// UpdateRecords runs the command with the desired state of the records of the given type for the domain
+// The command must exit with code 0 when the records have been updated
+func (e *ExecProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) (err error) {
+	start := time.Now()
+	if e.metrics != nil {
+		defer func() {
+			e.metrics.RecordAPICall("exec", "EXEC", e.command, err == nil, time.Since(start))
+		}()
+	}
+
+	if ips == nil {
+		ips = []string{}
+	}
+	input, err := json.Marshal(RecordsUpdate{
+		Provider:   e.name,
+		Domain:     domain,
+		RecordType: recordType,
+		TTL:        ttl,
+		IPs:        ips,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.command, e.args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+	// After the timeout, don't wait too long for child processes of the command that keep stderr open
+	cmd.WaitDelay = time.Second
+	cmd.Env = append(os.Environ(),
+		"DDUP_PROVIDER="+e.name,
+		"DDUP_DOMAIN="+domain,
+		"DDUP_RECORD_TYPE="+recordType,
+	)
+
+	logger().DebugContext(ctx, "Running command to update records", "provider", e.name, "command", e.command, "domain", domain, "recordType", recordType, "ips", ips)
+
+	err = cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 1<<10 {
+			msg = msg[:1<<10]
+		}
+		if msg != "" {
+			return fmt.Errorf("command '%s' failed: %w: %s", e.command, err, msg)
+		}
+		return fmt.Errorf("command '%s' failed: %w", e.command, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package dns
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestExecProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a shell script")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "update.sh")
+	out := filepath.Join(dir, "out.json")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+if [ "$DDUP_DOMAIN" = "fail.example.com" ]; then
+  echo "zone not found" >&2
+  exit 3
+fi
+if [ "$DDUP_DOMAIN" = "slow.example.com" ]; then
+  sleep 5
+fi
+cat > "$1"
+`), 0o700))
+
+	newProvider := func(t *testing.T, timeout time.Duration) *ExecProvider {
+		t.Helper()
+		provider, err := NewExecProvider("test", &config.ExecConfig{Command: script + " " + out, Timeout: timeout}, nil)
+		require.NoError(t, err)
+		return provider
+	}
+
+	t.Run("Update records", func(t *testing.T) {
+		provider := newProvider(t, 0)
+		assert.Equal(t, defaultExecTimeout, provider.timeout)
+
+		err := provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeA, 60, []string{"10.0.0.1", "10.0.0.2"})
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(out)
+		require.NoError(t, err)
+		var req RecordsUpdate
+		require.NoError(t, json.Unmarshal(data, &req))
+		assert.Equal(t, RecordsUpdate{
+			Provider:   "test",
+			Domain:     "app.example.com",
+			RecordType: RecordTypeA,
+			TTL:        60,
+			IPs:        []string{"10.0.0.1", "10.0.0.2"},
+		}, req)
+	})
+
+	t.Run("No IPs", func(t *testing.T) {
+		provider := newProvider(t, 0)
+		err := provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeAAAA, 60, nil)
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(out)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"provider":"test","domain":"app.example.com","recordType":"AAAA","ttl":60,"ips":[]}`, string(data))
+	})
+
+	t.Run("Command fails", func(t *testing.T) {
+		provider := newProvider(t, 0)
+		err := provider.UpdateRecords(t.Context(), "fail.example.com", RecordTypeA, 60, []string{"10.0.0.1"})
+		require.ErrorContains(t, err, "exit status 3: zone not found")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		provider := newProvider(t, 100*time.Millisecond)
+		err := provider.UpdateRecords(t.Context(), "slow.example.com", RecordTypeA, 60, []string{"10.0.0.1"})
+		require.Error(t, err)
+	})
+
+	t.Run("Empty command", func(t *testing.T) {
+		_, err := NewExecProvider("test", &config.ExecConfig{Command: " "}, nil)
+		require.ErrorContains(t, err, "command is required")
+	})
+}
@@ -14,6 +14,14 @@ type MockProvider struct {
 	// If true, UpdateRecords will return an error
 	ShouldError bool
 	CallCount   int
+	// IPs passed to the last invocation of UpdateRecords, for each record type
+	LastIPs map[string][]string
+	// TTL passed to the last invocation of UpdateRecords
+	LastTTL int
+	// Domains passed to each invocation of UpdateRecords
+	Domains []string
+	// Values of TXT records, keyed by name
+	TXTRecords map[string][]string
 }
 
 // NewMockProvider creates a new MockProvider.
@@ -27,10 +35,76 @@ func (m MockProvider) Name() string {
 }
 
 // UpdateRecords implements the Provider interface.
-func (m *MockProvider) UpdateRecords(ctx context.Context, domain string, ttl int, ips []string) error {
+func (m *MockProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
 	m.CallCount++
 	if m.ShouldError {
 		return errors.New("mock error")
 	}
+	m.Domains = append(m.Domains, domain)
+	if m.LastIPs == nil {
+		m.LastIPs = make(map[string][]string)
+	}
+	m.LastIPs[recordType] = ips
+	m.LastTTL = ttl
+	return nil
+}
+
+// UpdateTXTRecords implements the TXTRecordProvider interface.
+func (m *MockProvider) UpdateTXTRecords(ctx context.Context, name string, ttl int, values []string) error {
+	if m.ShouldError {
+		return errors.New("mock error")
+	}
+	if m.TXTRecords == nil {
+		m.TXTRecords = make(map[string][]string)
+	}
+	if len(values) == 0 {
+		delete(m.TXTRecords, name)
+		return nil
+	}
+	m.TXTRecords[name] = values
+	return nil
+}
+
+// UpdateCNAMERecord implements the CNAMERecordProvider interface.
+// The target is stored as the IPs of the CNAME record type.
+func (m *MockProvider) UpdateCNAMERecord(ctx context.Context, name string, ttl int, target string) error {
+	return m.UpdateRecords(ctx, name, RecordTypeCNAME, ttl, []string{target})
+}
+
+// GetRecords implements the RecordReader interface.
+// It returns the IPs passed to the last invocation of UpdateRecords for the record type, which can be modified to simulate external changes.
+// For TXT records, it returns the values in TXTRecords for the name.
+func (m *MockProvider) GetRecords(ctx context.Context, domain string, recordType string) ([]string, error) {
+	if m.ShouldError {
+		return nil, errors.New("mock error")
+	}
+	if recordType == RecordTypeTXT {
+		return m.TXTRecords[domain], nil
+	}
+	return m.LastIPs[recordType], nil
+}
+
+// MockWeightedProvider is a mock implementation of the WeightedProvider interface for testing.
+type MockWeightedProvider struct {
+	MockProvider
+
+	// Records passed to the last invocation of UpdateWeightedRecords
+	Records []WeightedRecord
+}
+
+// NewMockWeightedProvider creates a new MockWeightedProvider.
+func NewMockWeightedProvider(shouldError bool) *MockWeightedProvider {
+	return &MockWeightedProvider{
+		MockProvider: MockProvider{ShouldError: shouldError},
+	}
+}
+
+// UpdateWeightedRecords implements the WeightedProvider interface.
+func (m *MockWeightedProvider) UpdateWeightedRecords(ctx context.Context, domain string, ttl int, records []WeightedRecord) error {
+	m.CallCount++
+	if m.ShouldError {
+		return errors.New("mock error")
+	}
+	m.Records = records
 	return nil
 }
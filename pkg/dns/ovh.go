@@ -10,16 +10,25 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/italypaleale/ddup/pkg/config"
 	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/tracing"
 )
 
+// Maximum difference between the clock of this system and the time of the OVH API, beyond which signed requests may be rejected
+const ovhMaxClockSkew = 30 * time.Second
+
+// Maximum number of concurrent requests to read the details of records
+const ovhMaxConcurrentRequests = 8
+
 // getOVHEndpoint returns the full API endpoint URL based on the provided endpoint
 func getOVHEndpoint(endpoint string) string {
 	switch endpoint {
@@ -42,42 +51,55 @@ func getOVHEndpoint(endpoint string) string {
 // OVHProvider implements the Provider interface for OVH DNS
 type OVHProvider struct {
 	name        string
-	apiKey      string
-	apiSecret   string
-	consumerKey string
-	zoneName    string
-	endpoint    string
-	metrics     *appmetrics.AppMetrics
-	httpClient  *http.Client
+	apiKey      *secret
+	apiSecret   *secret
+	consumerKey *secret
+	// Name of the zone; if empty, the zone of each record is detected from the zones in the account
+	zoneName   string
+	zones      *zoneCache
+	endpoint   string
+	metrics    *appmetrics.AppMetrics
+	httpClient *http.Client
+
+	// Zones with changes that haven't been published yet with a refresh
+	dirtyZones     map[string]struct{}
+	dirtyZonesLock sync.Mutex
 }
 
 // NewOVHProvider creates a new OVH DNS provider
-func NewOVHProvider(name string, cfg *config.OVHConfig, metrics *appmetrics.AppMetrics) (*OVHProvider, error) {
-	if cfg.APIKey == "" {
-		return nil, errors.New("API key is required")
+// If httpClient is nil, a default client is used
+func NewOVHProvider(name string, cfg *config.OVHConfig, httpClient *http.Client, metrics *appmetrics.AppMetrics) (*OVHProvider, error) {
+	if httpClient == nil {
+		httpClient = tracing.NewHTTPClient()
 	}
-	if cfg.APISecret == "" {
-		return nil, errors.New("API secret is required")
+
+	apiKey, err := newSecret("API key", cfg.APIKey, cfg.APIKeyFile)
+	if err != nil {
+		return nil, err
 	}
-	if cfg.ConsumerKey == "" {
-		return nil, errors.New("consumer key is required")
+	apiSecret, err := newSecret("API secret", cfg.APISecret, cfg.APISecretFile)
+	if err != nil {
+		return nil, err
 	}
-	if cfg.ZoneName == "" {
-		return nil, errors.New("zone name is required")
+	consumerKey, err := newSecret("consumer key", cfg.ConsumerKey, cfg.ConsumerKeyFile)
+	if err != nil {
+		return nil, err
 	}
 
-	endpoint := getOVHEndpoint(cfg.Endpoint)
-
-	return &OVHProvider{
+	o := &OVHProvider{
 		name:        name,
-		apiKey:      cfg.APIKey,
-		apiSecret:   cfg.APISecret,
-		consumerKey: cfg.ConsumerKey,
+		apiKey:      apiKey,
+		apiSecret:   apiSecret,
+		consumerKey: consumerKey,
 		zoneName:    cfg.ZoneName,
-		endpoint:    endpoint,
+		endpoint:    getOVHEndpoint(cfg.Endpoint),
 		metrics:     metrics,
-		httpClient:  http.DefaultClient,
-	}, nil
+		httpClient:  httpClient,
+		dirtyZones:  map[string]struct{}{},
+	}
+	o.zones = newZoneCache(o.listZones)
+
+	return o, nil
 }
 
 // Name returns the provider's name
@@ -85,10 +107,15 @@ func (o *OVHProvider) Name() string {
 	return o.name
 }
 
-// UpdateRecords updates DNS records for the given domain with the provided IPs
-func (o *OVHProvider) UpdateRecords(ctx context.Context, domain string, ttl int, ips []string) error {
+// UpdateRecords updates DNS records of the given type for the domain with the provided IPs
+func (o *OVHProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	zone, err := o.zoneFor(ctx, domain)
+	if err != nil {
+		return err
+	}
+
 	// First, get existing records
-	existingRecords, err := o.getExistingRecords(ctx, domain)
+	existingRecords, err := o.getExistingRecords(ctx, zone, domain, recordType)
 	if err != nil {
 		return fmt.Errorf("error getting existing records: %w", err)
 	}
@@ -105,31 +132,76 @@ func (o *OVHProvider) UpdateRecords(ctx context.Context, domain string, ttl int,
 		desiredIPs[ip] = struct{}{}
 	}
 
-	// Delete records for IPs that are no longer healthy
+	// Queue the deletion of records for IPs that are no longer healthy, and the creation of records for healthy IPs that don't exist yet
+	deletes := make(map[string]int64)
 	for ip, recordID := range existingIPs {
 		_, ok := desiredIPs[ip]
-		if ok {
-			continue
+		if !ok {
+			deletes[ip] = recordID
+		}
+	}
+	creates := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		_, exists := existingIPs[ip]
+		if !exists {
+			creates = append(creates, ip)
 		}
+	}
+	if len(deletes) == 0 && len(creates) == 0 {
+		return nil
+	}
+
+	// Execute the changes; they're published when the zone is refreshed by Flush
+	// The zone is marked as changed even if some changes failed, as the others were applied already
+	err = o.applyChanges(ctx, zone, domain, recordType, ttl, deletes, creates)
+	o.markZoneDirty(zone)
+	return err
+}
+
+// Flush refreshes the zones with changes to their records, so the changes are published to the DNS servers
+// Each zone is refreshed once, regardless of how many records were changed; zones that fail to refresh are retried by the next call
+func (o *OVHProvider) Flush(ctx context.Context) error {
+	o.dirtyZonesLock.Lock()
+	zones := slices.Sorted(maps.Keys(o.dirtyZones))
+	clear(o.dirtyZones)
+	o.dirtyZonesLock.Unlock()
 
-		slog.DebugContext(ctx, "Deleting record for unhealthy IP", "ip", ip, "recordID", recordID)
+	errs := make([]error, 0)
+	for _, zone := range zones {
+		logger().DebugContext(ctx, "Refreshing zone", "zone", zone)
 
-		err = o.deleteRecord(ctx, recordID)
+		err := o.refreshZone(ctx, zone)
 		if err != nil {
-			return fmt.Errorf("error deleting record %d for IP %s: %w", recordID, ip, err)
+			o.markZoneDirty(zone)
+			errs = append(errs, fmt.Errorf("error refreshing zone %s: %w", zone, err))
 		}
 	}
 
-	// Create new records for healthy IPs that don't exist yet
-	for _, ip := range ips {
-		_, exists := existingIPs[ip]
-		if exists {
-			continue
+	return errors.Join(errs...)
+}
+
+// markZoneDirty records that the zone has changes that need to be published
+func (o *OVHProvider) markZoneDirty(zone string) {
+	o.dirtyZonesLock.Lock()
+	o.dirtyZones[zone] = struct{}{}
+	o.dirtyZonesLock.Unlock()
+}
+
+// applyChanges deletes and creates the records in the queue
+func (o *OVHProvider) applyChanges(ctx context.Context, zone, domain, recordType string, ttl int, deletes map[string]int64, creates []string) error {
+	for ip, recordID := range deletes {
+		logger().DebugContext(ctx, "Deleting record for unhealthy IP", "ip", ip, "recordID", recordID)
+
+		err := o.deleteRecord(ctx, zone, recordID)
+		if err != nil {
+			return fmt.Errorf("error deleting record %d for IP %s: %w", recordID, ip, err)
 		}
+	}
 
-		slog.DebugContext(ctx, "Creating record for healthy IP", "ip", ip)
+	for _, ip := range creates {
+		logger().DebugContext(ctx, "Creating record for healthy IP", "ip", ip)
 
-		err = o.createRecord(ctx, domain, ip, ttl)
+		err := o.createRecord(ctx, zone, domain, recordType, ip, ttl)
 		if err != nil {
 			return fmt.Errorf("error creating record for IP %s: %w", ip, err)
 		}
@@ -138,6 +210,114 @@ func (o *OVHProvider) UpdateRecords(ctx context.Context, domain string, ttl int,
 	return nil
 }
 
+// UpdateTXTRecords sets the TXT records for the name to the given values
+func (o *OVHProvider) UpdateTXTRecords(ctx context.Context, name string, ttl int, values []string) error {
+	return o.UpdateRecords(ctx, name, RecordTypeTXT, ttl, values)
+}
+
+// UpdateCNAMERecord sets the CNAME record for the name to point at the target hostname
+// OVH requires targets of CNAME records to be fully-qualified, with the trailing dot
+func (o *OVHProvider) UpdateCNAMERecord(ctx context.Context, name string, ttl int, target string) error {
+	return o.UpdateRecords(ctx, name, RecordTypeCNAME, ttl, []string{target + "."})
+}
+
+// GetRecords returns the IPs in the DNS records of the given type for the domain
+// For CNAME records, it returns the targets without the trailing dot
+func (o *OVHProvider) GetRecords(ctx context.Context, domain string, recordType string) ([]string, error) {
+	zone, err := o.zoneFor(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	existingRecords, err := o.getExistingRecords(ctx, zone, domain, recordType)
+	if err != nil {
+		return nil, fmt.Errorf("error getting existing records: %w", err)
+	}
+
+	ips := make([]string, len(existingRecords))
+	for i, record := range existingRecords {
+		ips[i] = record.Target
+		if recordType == RecordTypeCNAME {
+			ips[i] = strings.TrimSuffix(ips[i], ".")
+		}
+	}
+	return ips, nil
+}
+
+// VerifyCredentials checks that the clock is synchronized with the OVH API, and that the credentials grant access to the zone, by reading the zone
+// If the zone is detected automatically, it checks that the credentials grant access to at least one zone instead
+func (o *OVHProvider) VerifyCredentials(ctx context.Context) error {
+	// Requests are signed with the current time, so they are rejected if the clock is not accurate
+	skew, err := o.ClockSkew(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the time from the OVH API: %w", err)
+	}
+	if skew.Abs() > ovhMaxClockSkew {
+		return fmt.Errorf("the clock of this system differs from the time of the OVH API by %v; synchronize the clock (for example with NTP), as requests to the OVH API are signed with the current time", skew.Round(time.Second))
+	}
+
+	if o.zoneName == "" {
+		zones, err := o.zones.Zones(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list zones: %w; check the application key, application secret, and consumer key, and that the consumer key grants access to /domain/zone", err)
+		}
+		if len(zones) == 0 {
+			return errors.New("the credentials don't grant access to any zone")
+		}
+		return nil
+	}
+
+	start := time.Now()
+	var success bool
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.RecordAPICall("ovh", http.MethodGet, "/v1/domain/zone/"+o.zoneName, success, time.Since(start))
+		}()
+	}
+
+	err = o.performJSONRequest(ctx, http.MethodGet, o.endpoint+"/domain/zone/"+o.zoneName, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read zone '%s': %w; check the application key, application secret, and consumer key, and that the consumer key grants access to /domain/zone/%s", o.zoneName, err, o.zoneName)
+	}
+
+	success = true
+	return nil
+}
+
+// ClockSkew returns the difference between the clock of this system and the time of the OVH API
+// A positive value means that the clock of this system is ahead
+func (o *OVHProvider) ClockSkew(ctx context.Context) (time.Duration, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, o.endpoint+"/auth/time", nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+
+	// The request is not authenticated
+	start := time.Now()
+	res, err := o.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("invalid response status code HTTP %d; response: %s", res.StatusCode, string(body))
+	}
+
+	var serverTime int64
+	err = json.NewDecoder(res.Body).Decode(&serverTime)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding JSON response: %w", err)
+	}
+
+	// Compare with the time in the middle of the request, to account for latency
+	now := start.Add(time.Since(start) / 2)
+	return now.Sub(time.Unix(serverTime, 0)), nil
+}
+
 // OVHRecord represents a DNS record from OVH API
 type OVHRecord struct {
 	ID        int64  `json:"id"`
@@ -156,49 +336,90 @@ type OVHCreateRecordRequest struct {
 	TTL       int    `json:"ttl"`
 }
 
-func (o *OVHProvider) getExistingRecords(ctx context.Context, domain string) ([]OVHRecord, error) {
+// zoneFor returns the zone of the domain, which is the configured zone or the one detected from the zones in the account
+func (o *OVHProvider) zoneFor(ctx context.Context, domain string) (string, error) {
+	if o.zoneName != "" {
+		return o.zoneName, nil
+	}
+	return o.zones.ZoneFor(ctx, domain)
+}
+
+// listZones returns the names of the zones in the account
+func (o *OVHProvider) listZones(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	var success bool
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.RecordAPICall("ovh", http.MethodGet, "/v1/domain/zone", success, time.Since(start))
+		}()
+	}
+
+	var zones []string
+	err := o.performJSONRequest(ctx, http.MethodGet, o.endpoint+"/domain/zone", nil, &zones)
+	if err != nil {
+		return nil, err
+	}
+
+	success = true
+	return zones, nil
+}
+
+func (o *OVHProvider) getExistingRecords(ctx context.Context, zone string, domain string, recordType string) ([]OVHRecord, error) {
 	start := time.Now()
 	var success bool
 	if o.metrics != nil {
 		defer func() {
-			o.metrics.RecordAPICall("ovh", http.MethodGet, "/v1/domain/zone/"+o.zoneName+"/record", success, time.Since(start))
+			o.metrics.RecordAPICall("ovh", http.MethodGet, "/v1/domain/zone/"+zone+"/record", success, time.Since(start))
 		}()
 	}
 
 	// Extract subdomain from full domain
-	subDomain := ""
-	if domain != o.zoneName {
-		if len(domain) > len(o.zoneName)+1 && domain[len(domain)-len(o.zoneName)-1:] == "."+o.zoneName {
-			subDomain = domain[:len(domain)-len(o.zoneName)-1]
-		} else {
-			return nil, fmt.Errorf("domain %s is not a subdomain of zone %s", domain, o.zoneName)
-		}
+	subDomain, err := subDomainInZone(domain, zone)
+	if err != nil {
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/domain/zone/%s/record?fieldType=A&subDomain=%s", o.endpoint, o.zoneName, subDomain)
+	url := fmt.Sprintf("%s/domain/zone/%s/record?fieldType=%s&subDomain=%s", o.endpoint, zone, recordType, subDomain)
 
 	var recordIDs []int64
-	err := o.performJSONRequest(ctx, http.MethodGet, url, nil, &recordIDs)
+	err = o.performJSONRequest(ctx, http.MethodGet, url, nil, &recordIDs)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get detailed information for each record
+	// Get detailed information for each record, concurrently
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(recordIDs))
+		sem  = make(chan struct{}, ovhMaxConcurrentRequests)
+	)
 	records := make([]OVHRecord, len(recordIDs))
 	for i, recordID := range recordIDs {
-		record, err := o.getRecord(ctx, recordID)
-		if err != nil {
-			return nil, fmt.Errorf("error getting record details for ID %d: %w", recordID, err)
-		}
-		records[i] = *record
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			record, err := o.getRecord(ctx, zone, recordID)
+			if err != nil {
+				errs[i] = fmt.Errorf("error getting record details for ID %d: %w", recordID, err)
+				return
+			}
+			records[i] = *record
+		})
+	}
+	wg.Wait()
+
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, err
 	}
 
 	success = true
 	return records, nil
 }
 
-func (o *OVHProvider) getRecord(ctx context.Context, recordID int64) (*OVHRecord, error) {
-	url := fmt.Sprintf("%s/domain/zone/%s/record/%d", o.endpoint, o.zoneName, recordID)
+func (o *OVHProvider) getRecord(ctx context.Context, zone string, recordID int64) (*OVHRecord, error) {
+	url := fmt.Sprintf("%s/domain/zone/%s/record/%d", o.endpoint, zone, recordID)
 
 	var record OVHRecord
 	err := o.performJSONRequest(ctx, http.MethodGet, url, nil, &record)
@@ -213,16 +434,16 @@ func (o *OVHProvider) getRecord(ctx context.Context, recordID int64) (*OVHRecord
 	return &record, nil
 }
 
-func (o *OVHProvider) deleteRecord(ctx context.Context, recordID int64) error {
+func (o *OVHProvider) deleteRecord(ctx context.Context, zone string, recordID int64) error {
 	start := time.Now()
 	var success bool
 	if o.metrics != nil {
 		defer func() {
-			o.metrics.RecordAPICall("ovh", http.MethodDelete, "/v1/domain/zone/"+o.zoneName+"/record", success, time.Since(start))
+			o.metrics.RecordAPICall("ovh", http.MethodDelete, "/v1/domain/zone/"+zone+"/record", success, time.Since(start))
 		}()
 	}
 
-	url := fmt.Sprintf("%s/domain/zone/%s/record/%d", o.endpoint, o.zoneName, recordID)
+	url := fmt.Sprintf("%s/domain/zone/%s/record/%d", o.endpoint, zone, recordID)
 
 	err := o.performJSONRequest(ctx, http.MethodDelete, url, nil, nil)
 	if err != nil {
@@ -233,35 +454,50 @@ func (o *OVHProvider) deleteRecord(ctx context.Context, recordID int64) error {
 	return nil
 }
 
-func (o *OVHProvider) createRecord(ctx context.Context, domain, ip string, ttl int) error {
+func (o *OVHProvider) createRecord(ctx context.Context, zone, domain, recordType, ip string, ttl int) error {
 	start := time.Now()
 	var success bool
 	if o.metrics != nil {
 		defer func() {
-			o.metrics.RecordAPICall("ovh", http.MethodPost, "/v1/domain/zone/"+o.zoneName+"/record", success, time.Since(start))
+			o.metrics.RecordAPICall("ovh", http.MethodPost, "/v1/domain/zone/"+zone+"/record", success, time.Since(start))
 		}()
 	}
 
 	// Extract subdomain from full domain
-	subDomain := ""
-	if domain != o.zoneName {
-		if len(domain) > len(o.zoneName)+1 && domain[len(domain)-len(o.zoneName)-1:] == "."+o.zoneName {
-			subDomain = domain[:len(domain)-len(o.zoneName)-1]
-		} else {
-			return fmt.Errorf("domain %s is not a subdomain of zone %s", domain, o.zoneName)
-		}
+	subDomain, err := subDomainInZone(domain, zone)
+	if err != nil {
+		return err
 	}
 
-	url := o.endpoint + "/domain/zone/" + o.zoneName + "/record"
+	url := o.endpoint + "/domain/zone/" + zone + "/record"
 
 	record := OVHCreateRecordRequest{
-		FieldType: "A",
+		FieldType: recordType,
 		SubDomain: subDomain,
 		Target:    ip,
 		TTL:       ttl,
 	}
 
-	err := o.performJSONRequest(ctx, http.MethodPost, url, record, nil)
+	err = o.performJSONRequest(ctx, http.MethodPost, url, record, nil)
+	if err != nil {
+		return err
+	}
+
+	success = true
+	return nil
+}
+
+// refreshZone applies the changes to the records of the zone to the DNS servers
+func (o *OVHProvider) refreshZone(ctx context.Context, zone string) error {
+	start := time.Now()
+	var success bool
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.RecordAPICall("ovh", http.MethodPost, "/v1/domain/zone/"+zone+"/refresh", success, time.Since(start))
+		}()
+	}
+
+	err := o.performJSONRequest(ctx, http.MethodPost, o.endpoint+"/domain/zone/"+zone+"/refresh", nil, nil)
 	if err != nil {
 		return err
 	}
@@ -330,12 +566,26 @@ func (o *OVHProvider) createAuthenticatedRequest(ctx context.Context, method str
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
+	// Get the credentials, which may have been rotated
+	apiKey, err := o.apiKey.Get()
+	if err != nil {
+		return nil, fmt.Errorf("error getting API key: %w", err)
+	}
+	apiSecret, err := o.apiSecret.Get()
+	if err != nil {
+		return nil, fmt.Errorf("error getting API secret: %w", err)
+	}
+	consumerKey, err := o.consumerKey.Get()
+	if err != nil {
+		return nil, fmt.Errorf("error getting consumer key: %w", err)
+	}
+
 	// Calculate signature
-	signature := o.calculateSignature(method, url, string(bodyData), timestamp)
+	signature := calculateOVHSignature(apiSecret, consumerKey, method, url, string(bodyData), timestamp)
 
 	// Set headers
-	req.Header.Set("X-Ovh-Application", o.apiKey)
-	req.Header.Set("X-Ovh-Consumer", o.consumerKey)
+	req.Header.Set("X-Ovh-Application", apiKey)
+	req.Header.Set("X-Ovh-Consumer", consumerKey)
 	req.Header.Set("X-Ovh-Signature", signature)
 	req.Header.Set("X-Ovh-Timestamp", timestamp)
 
@@ -346,9 +596,9 @@ func (o *OVHProvider) createAuthenticatedRequest(ctx context.Context, method str
 	return req, nil
 }
 
-func (o *OVHProvider) calculateSignature(method, url, body, timestamp string) string {
+func calculateOVHSignature(apiSecret, consumerKey, method, url, body, timestamp string) string {
 	// OVH signature calculation: $1$<sha1_hex>(AS+CK+METHOD+URL+BODY+TSTAMP)
-	data := o.apiSecret + "+" + o.consumerKey + "+" + method + "+" + url + "+" + body + "+" + timestamp
+	data := apiSecret + "+" + consumerKey + "+" + method + "+" + url + "+" + body + "+" + timestamp
 
 	// Disable the "G401: Use of weak cryptographic primitive" gosec warning because this is required for an external system
 	// #nosec G401
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -39,7 +41,7 @@ func TestOVHProvider(t *testing.T) {
 		})
 
 		// Test creating records
-		err := provider.UpdateRecords(t.Context(), "example.com", 300, []string{"1.1.1.1"})
+		err := provider.UpdateRecords(t.Context(), "example.com", RecordTypeA, 300, []string{"1.1.1.1"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -109,7 +111,7 @@ func TestOVHProvider(t *testing.T) {
 		})
 
 		// Test deleting records (passing empty IPs array)
-		err := provider.UpdateRecords(t.Context(), "www.example.com", 300, []string{})
+		err := provider.UpdateRecords(t.Context(), "www.example.com", RecordTypeA, 300, []string{})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -182,7 +184,7 @@ func TestOVHProvider(t *testing.T) {
 		})
 
 		// Test updating records with new IPs (keep 5.6.7.8, remove 1.2.3.4, add 9.10.11.12)
-		err := provider.UpdateRecords(t.Context(), "api.example.com", 300, []string{"5.6.7.8", "9.10.11.12"})
+		err := provider.UpdateRecords(t.Context(), "api.example.com", RecordTypeA, 300, []string{"5.6.7.8", "9.10.11.12"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -231,7 +233,7 @@ func TestOVHProvider(t *testing.T) {
 		})
 
 		// Test updating with the same IP (no changes needed)
-		err := provider.UpdateRecords(t.Context(), "api.example.com", 300, []string{"1.2.3.4"})
+		err := provider.UpdateRecords(t.Context(), "api.example.com", RecordTypeA, 300, []string{"1.2.3.4"})
 		require.NoError(t, err)
 
 		// Verify only the GET requests were made (no DELETE or POST)
@@ -239,6 +241,100 @@ func TestOVHProvider(t *testing.T) {
 		require.Len(t, requests, 2) // GET (list), GET (details)
 	})
 
+	t.Run("Get records", func(t *testing.T) {
+		provider, mockTransport := newOVHTestProviderWithMock()
+
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record?fieldType=A&subDomain=api", &MockResponse{
+			StatusCode: 200,
+			Body:       `[12345]`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record/12345", &MockResponse{
+			StatusCode: 200,
+			Body: `{
+				"id": 12345,
+				"fieldType": "A",
+				"subDomain": "api",
+				"target": "1.2.3.4",
+				"ttl": 300,
+				"zone": "example.com"
+			}`,
+			Headers: map[string]string{"Content-Type": "application/json"},
+		})
+
+		ips, err := provider.GetRecords(t.Context(), "api.example.com", RecordTypeA)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4"}, ips)
+	})
+
+	t.Run("Zone detected automatically", func(t *testing.T) {
+		provider, mockTransport := newOVHTestProviderWithMock()
+		provider.zoneName = ""
+		provider.zones = newZoneCache(provider.listZones)
+
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone", &MockResponse{
+			StatusCode: 200,
+			Body:       `["example.com", "eu.example.com", "example.org"]`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/eu.example.com/record?fieldType=A&subDomain=api", &MockResponse{
+			StatusCode: 200,
+			Body:       `[12345]`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/eu.example.com/record/12345", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"id": 12345, "fieldType": "A", "subDomain": "api", "target": "1.2.3.4", "ttl": 300, "zone": "eu.example.com"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.org/record?fieldType=A&subDomain=", &MockResponse{
+			StatusCode: 200,
+			Body:       `[]`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		// The longest zone that matches is used
+		ips, err := provider.GetRecords(t.Context(), "api.eu.example.com", RecordTypeA)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"1.2.3.4"}, ips)
+
+		// The list of zones is cached
+		ips, err = provider.GetRecords(t.Context(), "example.org", RecordTypeA)
+		require.NoError(t, err)
+		assert.Empty(t, ips)
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 4)
+		assert.Equal(t, "/1.0/domain/zone", requests[0].URL.Path)
+
+		// Domains that don't belong to any zone return an error
+		_, err = provider.GetRecords(t.Context(), "www.example.net", RecordTypeA)
+		require.ErrorContains(t, err, "does not belong to any of the zones")
+	})
+
+	t.Run("CNAME record", func(t *testing.T) {
+		provider, mockTransport := newOVHTestProviderWithMock()
+
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record?fieldType=CNAME&subDomain=www", &MockResponse{
+			StatusCode: 200,
+			Body:       `[]`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodPost, "/1.0/domain/zone/example.com/record", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"id": 22222, "fieldType": "CNAME", "subDomain": "www", "target": "lb1.example.net.", "ttl": 300, "zone": "example.com"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		// Targets are sent with the trailing dot
+		err := provider.UpdateCNAMERecord(t.Context(), "www.example.com", 300, "lb1.example.net")
+		require.NoError(t, err)
+
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 2)
+		body, _ := io.ReadAll(requests[1].Body)
+		assert.JSONEq(t, `{"fieldType":"CNAME","subDomain":"www","target":"lb1.example.net.","ttl":300}`, string(body))
+	})
+
 	t.Run("Multiple IPs for subdomain", func(t *testing.T) {
 		provider, mockTransport := newOVHTestProviderWithMock()
 
@@ -264,7 +360,7 @@ func TestOVHProvider(t *testing.T) {
 		})
 
 		// Test creating multiple records for the same subdomain
-		err := provider.UpdateRecords(t.Context(), "multi.example.com", 300, []string{"1.1.1.1", "2.2.2.2"})
+		err := provider.UpdateRecords(t.Context(), "multi.example.com", RecordTypeA, 300, []string{"1.1.1.1", "2.2.2.2"})
 		require.NoError(t, err)
 
 		// Verify the requests were made
@@ -292,6 +388,118 @@ func TestOVHProvider(t *testing.T) {
 		assert.True(t, op1 || op2)
 	})
 
+	t.Run("Record details are read concurrently", func(t *testing.T) {
+		provider, mockTransport := newOVHTestProviderWithMock()
+
+		ids := make([]string, 20)
+		for i := range ids {
+			id := strconv.Itoa(1000 + i)
+			ids[i] = id
+			mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record/"+id, &MockResponse{
+				StatusCode: 200,
+				Body:       `{"id": ` + id + `, "fieldType": "A", "subDomain": "many", "target": "10.0.0.` + strconv.Itoa(i) + `", "ttl": 300, "zone": "example.com"}`,
+				Headers:    map[string]string{"Content-Type": "application/json"},
+			})
+		}
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record?fieldType=A&subDomain=many", &MockResponse{
+			StatusCode: 200,
+			Body:       `[` + strings.Join(ids, ",") + `]`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		// The order of the records is preserved
+		ips, err := provider.GetRecords(t.Context(), "many.example.com", RecordTypeA)
+		require.NoError(t, err)
+		require.Len(t, ips, 20)
+		for i, ip := range ips {
+			assert.Equal(t, "10.0.0."+strconv.Itoa(i), ip)
+		}
+
+		// Errors reading the details are returned
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record/1005", &MockResponse{
+			StatusCode: 500,
+			Body:       `{"message": "simulated"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		_, err = provider.GetRecords(t.Context(), "many.example.com", RecordTypeA)
+		require.ErrorContains(t, err, "error getting record details for ID 1005")
+	})
+
+	t.Run("Zone refresh fails", func(t *testing.T) {
+		provider, mockTransport := newOVHTestProviderWithMock()
+
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record?fieldType=A&subDomain=api", &MockResponse{
+			StatusCode: 200,
+			Body:       `[]`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodPost, "/1.0/domain/zone/example.com/record", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"id": 11111, "fieldType": "A", "subDomain": "api", "target": "1.1.1.1", "ttl": 300, "zone": "example.com"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		mockTransport.SetResponse(http.MethodPost, "/1.0/domain/zone/example.com/refresh", &MockResponse{
+			StatusCode: 500,
+			Body:       `{"message": "simulated"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		err := provider.UpdateRecords(t.Context(), "api.example.com", RecordTypeA, 300, []string{"1.1.1.1"})
+		require.NoError(t, err)
+
+		err = provider.Flush(t.Context())
+		require.ErrorContains(t, err, "error refreshing zone example.com")
+
+		// The zone is refreshed again by the next flush
+		mockTransport.SetResponse(http.MethodPost, "/1.0/domain/zone/example.com/refresh", &MockResponse{
+			StatusCode: 200,
+			Body:       `null`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		err = provider.Flush(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, 2, countOVHRefreshRequests(mockTransport.GetRequests()))
+	})
+
+	t.Run("Zone is refreshed once per flush", func(t *testing.T) {
+		provider, mockTransport := newOVHTestProviderWithMock()
+
+		for _, sub := range []string{"www", "api", "mail"} {
+			for _, recordType := range []string{"A", "AAAA"} {
+				mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com/record?fieldType="+recordType+"&subDomain="+sub, &MockResponse{
+					StatusCode: 200,
+					Body:       `[]`,
+					Headers:    map[string]string{"Content-Type": "application/json"},
+				})
+			}
+		}
+		mockTransport.SetResponse(http.MethodPost, "/1.0/domain/zone/example.com/record", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"id": 11111}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+
+		// Update several names in the same zone
+		for _, sub := range []string{"www", "api", "mail"} {
+			err := provider.UpdateRecords(t.Context(), sub+".example.com", RecordTypeA, 300, []string{"1.1.1.1"})
+			require.NoError(t, err)
+			err = provider.UpdateRecords(t.Context(), sub+".example.com", RecordTypeAAAA, 300, []string{"2001:db8::1"})
+			require.NoError(t, err)
+		}
+
+		// Records are not published until the provider is flushed
+		assert.Equal(t, 0, countOVHRefreshRequests(mockTransport.GetRequests()))
+
+		err := provider.Flush(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, 1, countOVHRefreshRequests(mockTransport.GetRequests()))
+
+		// With no more changes, the zone is not refreshed again
+		err = provider.Flush(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, 1, countOVHRefreshRequests(mockTransport.GetRequests()))
+	})
+
 	t.Run("Different OVH endpoints", func(t *testing.T) {
 		tests := []struct {
 			name         string
@@ -333,7 +541,7 @@ func TestOVHProvider(t *testing.T) {
 					ConsumerKey: "test-consumer",
 					ZoneName:    "example.com",
 					Endpoint:    tt.endpoint,
-				}, nil)
+				}, nil, nil)
 				require.NoError(t, err)
 
 				assert.Equal(t, tt.expectedBase, provider.endpoint)
@@ -345,7 +553,7 @@ func TestOVHProvider(t *testing.T) {
 		provider, mockTransport := newOVHTestProviderWithMock()
 
 		// Test with domain not in zone
-		err := provider.UpdateRecords(t.Context(), "other.com", 300, []string{"1.1.1.1"})
+		err := provider.UpdateRecords(t.Context(), "other.com", RecordTypeA, 300, []string{"1.1.1.1"})
 		require.Error(t, err)
 		require.ErrorContains(t, err, "is not a subdomain of zone")
 
@@ -355,13 +563,8 @@ func TestOVHProvider(t *testing.T) {
 	})
 
 	t.Run("Signature calculation", func(t *testing.T) {
-		provider := &OVHProvider{
-			apiSecret:   "test-secret",
-			consumerKey: "test-consumer",
-		}
-
 		// Test signature calculation with known values
-		signature := provider.calculateSignature("GET", "https://eu.api.ovh.com/1.0/domain/zone/example.com/record", "", "1609459200")
+		signature := calculateOVHSignature("test-secret", "test-consumer", "GET", "https://eu.api.ovh.com/1.0/domain/zone/example.com/record", "", "1609459200")
 
 		// We just verify it starts with $1$ and has the right format
 		assert.True(t, len(signature) > 3 && signature[:3] == "$1$")
@@ -396,13 +599,32 @@ func newOVHTestProviderWithMock() (*OVHProvider, *MockHTTPTransport) {
 
 	provider := &OVHProvider{
 		name:        "test",
-		apiKey:      "test-key",
-		apiSecret:   "test-secret",
-		consumerKey: "test-consumer",
+		apiKey:      staticSecret("test-key"),
+		apiSecret:   staticSecret("test-secret"),
+		consumerKey: staticSecret("test-consumer"),
 		zoneName:    "example.com",
 		endpoint:    getOVHEndpoint("eu"),
 		httpClient:  mockClient,
+		dirtyZones:  map[string]struct{}{},
 	}
 
+	// Zones are refreshed when the provider is flushed
+	mockTransport.SetResponse(http.MethodPost, "/1.0/domain/zone/example.com/refresh", &MockResponse{
+		StatusCode: 200,
+		Body:       `null`,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+	})
+
 	return provider, mockTransport
 }
+
+// countOVHRefreshRequests returns the number of requests to refresh a zone
+func countOVHRefreshRequests(requests []*http.Request) int {
+	var n int
+	for _, req := range requests {
+		if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/refresh") {
+			n++
+		}
+	}
+	return n
+}
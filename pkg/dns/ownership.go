@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Keys in the values of ownership records
+const (
+	ownershipHeritage = "heritage=ddup"
+	ownershipOwnerKey = "ddup/owner="
+)
+
+// ErrNotOwned is returned when the records of a name are not owned by this instance, so they're not modified
+var ErrNotOwned = errors.New("records are not owned by this instance")
+
+// Ownership manages the TXT records that mark the names whose records are owned by an instance of ddup, in the style of external-dns
+// Records of names that are owned by another instance, or that exist and aren't owned by any instance, are not modified
+type Ownership struct {
+	ownerID string
+	prefix  string
+
+	lock sync.Mutex
+	// Names that are known to be owned by this instance
+	// Protected by lock
+	owned map[string]struct{}
+}
+
+// NewOwnership returns a new Ownership object
+func NewOwnership(cfg *config.ConfigOwnership) *Ownership {
+	return &Ownership{
+		ownerID: cfg.OwnerID,
+		prefix:  cfg.Prefix,
+		owned:   map[string]struct{}{},
+	}
+}
+
+// CheckOwnershipSupport returns an error if the provider can't be used with ownership records, because it can't read records or manage TXT records
+func CheckOwnershipSupport(provider Provider) error {
+	_, ok := provider.(RecordReader)
+	if !ok {
+		return fmt.Errorf("DNS provider '%s' can't return its records", provider.Name())
+	}
+	_, ok = provider.(TXTRecordProvider)
+	if !ok {
+		return fmt.Errorf("DNS provider '%s' does not support TXT records", provider.Name())
+	}
+	return nil
+}
+
+// RecordName returns the name of the ownership record for the domain
+func (o *Ownership) RecordName(domain string) string {
+	return o.prefix + domain
+}
+
+// Claim checks that the records of the given type for the domain can be replaced with the IPs
+// If the name has no ownership record, and replacing its records doesn't remove any existing record, the name is claimed by publishing the ownership record
+// It returns an error wrapping ErrNotOwned if the records must not be modified
+func (o *Ownership) Claim(ctx context.Context, provider Provider, domain string, recordType string, ttl int, ips []string) error {
+	o.lock.Lock()
+	_, owned := o.owned[domain]
+	o.lock.Unlock()
+	if owned {
+		return nil
+	}
+
+	err := CheckOwnershipSupport(provider)
+	if err != nil {
+		return err
+	}
+	reader := provider.(RecordReader)           //nolint:forcetypeassert
+	txtProvider := provider.(TXTRecordProvider) //nolint:forcetypeassert
+
+	values, err := reader.GetRecords(ctx, o.RecordName(domain), RecordTypeTXT)
+	if err != nil {
+		return fmt.Errorf("error getting ownership record: %w", err)
+	}
+
+	owner, found := parseOwnershipRecords(values)
+	switch {
+	case found && owner == o.ownerID:
+		o.setOwned(domain)
+		return nil
+	case found:
+		return fmt.Errorf("%w: name is owned by instance '%s'", ErrNotOwned, owner)
+	}
+
+	// The name has no owner: it can be claimed only if no existing record would be removed
+	existing, err := reader.GetRecords(ctx, domain, recordType)
+	if err != nil {
+		return fmt.Errorf("error getting existing records: %w", err)
+	}
+	for _, ip := range existing {
+		if !slices.Contains(ips, ip) {
+			return fmt.Errorf("%w: existing %s record for IP %s was not created by ddup", ErrNotOwned, recordType, ip)
+		}
+	}
+
+	err = txtProvider.UpdateTXTRecords(ctx, o.RecordName(domain), ttl, []string{o.recordValue()})
+	if err != nil {
+		return fmt.Errorf("error publishing ownership record: %w", err)
+	}
+
+	logger().InfoContext(ctx, "Claimed ownership of records", "domain", domain, "owner", o.ownerID)
+	o.setOwned(domain)
+	return nil
+}
+
+func (o *Ownership) setOwned(domain string) {
+	o.lock.Lock()
+	o.owned[domain] = struct{}{}
+	o.lock.Unlock()
+}
+
+// recordValue returns the value of the ownership records for this instance
+func (o *Ownership) recordValue() string {
+	return ownershipHeritage + "," + ownershipOwnerKey + o.ownerID
+}
+
+// parseOwnershipRecords returns the owner from the values of TXT records
+// It returns false if none of the values is an ownership record
+func parseOwnershipRecords(values []string) (owner string, found bool) {
+	for _, v := range values {
+		// Some providers return values in quotes
+		v = strings.Trim(strings.TrimSpace(v), `"`)
+
+		parts := strings.Split(v, ",")
+		if !slices.Contains(parts, ownershipHeritage) {
+			continue
+		}
+		for _, p := range parts {
+			owner, found = strings.CutPrefix(p, ownershipOwnerKey)
+			if found {
+				return owner, true
+			}
+		}
+	}
+	return "", false
+}
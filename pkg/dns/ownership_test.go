@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestOwnership(t *testing.T) {
+	newOwnership := func() *Ownership {
+		return NewOwnership(&config.ConfigOwnership{
+			OwnerID: "instance1",
+			Prefix:  "_ddup-owner.",
+		})
+	}
+
+	t.Run("Claims names without records", func(t *testing.T) {
+		provider := NewMockProvider(false)
+		o := newOwnership()
+
+		err := o.Claim(t.Context(), provider, "example.com", RecordTypeA, 60, []string{"1.1.1.1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"heritage=ddup,ddup/owner=instance1"}, provider.TXTRecords["_ddup-owner.example.com"])
+	})
+
+	t.Run("Claims names whose records would not be removed", func(t *testing.T) {
+		provider := NewMockProvider(false)
+		provider.LastIPs = map[string][]string{RecordTypeA: {"1.1.1.1"}}
+		o := newOwnership()
+
+		err := o.Claim(t.Context(), provider, "example.com", RecordTypeA, 60, []string{"1.1.1.1", "2.2.2.2"})
+		require.NoError(t, err)
+		assert.Contains(t, provider.TXTRecords, "_ddup-owner.example.com")
+	})
+
+	t.Run("Refuses to remove records not created by ddup", func(t *testing.T) {
+		provider := NewMockProvider(false)
+		provider.LastIPs = map[string][]string{RecordTypeA: {"9.9.9.9"}}
+		o := newOwnership()
+
+		err := o.Claim(t.Context(), provider, "example.com", RecordTypeA, 60, []string{"1.1.1.1"})
+		require.ErrorIs(t, err, ErrNotOwned)
+		assert.Empty(t, provider.TXTRecords)
+	})
+
+	t.Run("Refuses names owned by another instance", func(t *testing.T) {
+		provider := NewMockProvider(false)
+		provider.TXTRecords = map[string][]string{
+			"_ddup-owner.example.com": {"heritage=ddup,ddup/owner=instance2"},
+		}
+		o := newOwnership()
+
+		err := o.Claim(t.Context(), provider, "example.com", RecordTypeA, 60, []string{"1.1.1.1"})
+		require.ErrorIs(t, err, ErrNotOwned)
+		assert.Contains(t, err.Error(), "instance2")
+	})
+
+	t.Run("Accepts names owned by this instance", func(t *testing.T) {
+		provider := NewMockProvider(false)
+		provider.LastIPs = map[string][]string{RecordTypeA: {"9.9.9.9"}}
+		provider.TXTRecords = map[string][]string{
+			"_ddup-owner.example.com": {`"heritage=ddup,ddup/owner=instance1"`},
+		}
+		o := newOwnership()
+
+		err := o.Claim(t.Context(), provider, "example.com", RecordTypeA, 60, []string{"1.1.1.1"})
+		require.NoError(t, err)
+
+		// Ownership is cached, so records are not read again
+		provider.ShouldError = true
+		err = o.Claim(t.Context(), provider, "example.com", RecordTypeA, 60, []string{"1.1.1.1"})
+		require.NoError(t, err)
+	})
+
+	t.Run("Error reading records", func(t *testing.T) {
+		o := newOwnership()
+
+		err := o.Claim(t.Context(), NewMockProvider(true), "example.com", RecordTypeA, 60, []string{"1.1.1.1"})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrNotOwned)
+	})
+}
+
+func TestParseOwnershipRecords(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []string
+		wantOwner string
+		wantFound bool
+	}{
+		{name: "no records"},
+		{name: "unrelated records", values: []string{"v=spf1 -all"}},
+		{name: "ownership record", values: []string{"v=spf1 -all", "heritage=ddup,ddup/owner=abc"}, wantOwner: "abc", wantFound: true},
+		{name: "quoted", values: []string{`"heritage=ddup,ddup/owner=abc"`}, wantOwner: "abc", wantFound: true},
+		{name: "missing heritage", values: []string{"ddup/owner=abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, found := parseOwnershipRecords(tt.values)
+			assert.Equal(t, tt.wantOwner, owner)
+			assert.Equal(t, tt.wantFound, found)
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dnsplugin"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+)
+
+// Default timeout for calls to plugins
+const defaultPluginTimeout = 30 * time.Second
+
+// Timeout for plugins to exit after their stdin is closed, before they're killed
+const pluginStopTimeout = 5 * time.Second
+
+var (
+	pluginsLock sync.Mutex
+	// Plugin processes that were started, keyed by command line
+	// Protected by pluginsLock
+	plugins = map[string]*pluginProcess{}
+)
+
+// PluginProvider implements the Provider interface by invoking a plugin, which runs as a separate process
+// Providers with the same command share the same process, which is kept running when the configuration is reloaded
+type PluginProvider struct {
+	name    string
+	process *pluginProcess
+	timeout time.Duration
+	metrics *appmetrics.AppMetrics
+}
+
+// NewPluginProvider creates a new plugin DNS provider, starting the plugin if it's not running already
+func NewPluginProvider(name string, cfg *config.PluginConfig, metrics *appmetrics.AppMetrics) (*PluginProvider, error) {
+	// The command line is split on whitespace, and it's not executed through a shell
+	fields := strings.Fields(cfg.Command)
+	if len(fields) == 0 {
+		return nil, errors.New("command is required")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultPluginTimeout
+	}
+
+	pluginsLock.Lock()
+	process, ok := plugins[strings.Join(fields, " ")]
+	if !ok {
+		process = &pluginProcess{
+			command:   fields[0],
+			args:      fields[1:],
+			instances: map[string]dnsplugin.InitArgs{},
+		}
+		plugins[strings.Join(fields, " ")] = process
+	}
+	pluginsLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := process.init(ctx, dnsplugin.InitArgs{
+		ProtocolVersion: dnsplugin.ProtocolVersion,
+		Provider:        name,
+		Config:          cfg.Config,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize plugin: %w", err)
+	}
+
+	return &PluginProvider{
+		name:    name,
+		process: process,
+		timeout: timeout,
+		metrics: metrics,
+	}, nil
+}
+
+// Name returns the provider's name
+func (p *PluginProvider) Name() string {
+	return p.name
+}
+
+// UpdateRecords invokes the plugin to update the records of the given type for the domain
+func (p *PluginProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) (err error) {
+	start := time.Now()
+	if p.metrics != nil {
+		defer func() {
+			p.metrics.RecordAPICall("plugin", "RPC", p.process.command, err == nil, time.Since(start))
+		}()
+	}
+
+	if ips == nil {
+		ips = []string{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	err = p.process.call(ctx, dnsplugin.MethodUpdateRecords, dnsplugin.UpdateRecordsArgs{
+		Provider:   p.name,
+		Domain:     domain,
+		RecordType: recordType,
+		TTL:        ttl,
+		IPs:        ips,
+		Timeout:    p.timeout,
+	}, &dnsplugin.UpdateRecordsReply{})
+	if err != nil {
+		return fmt.Errorf("plugin '%s' failed: %w", p.process.command, err)
+	}
+	return nil
+}
+
+// StopPlugins stops all plugin processes
+// Plugins are asked to exit by closing their stdin, and they're killed if they don't exit before the context is canceled
+func StopPlugins(ctx context.Context) error {
+	pluginsLock.Lock()
+	processes := make([]*pluginProcess, 0, len(plugins))
+	for _, process := range plugins {
+		processes = append(processes, process)
+	}
+	plugins = map[string]*pluginProcess{}
+	pluginsLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, pluginStopTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, process := range processes {
+		wg.Go(func() {
+			process.stop(ctx)
+		})
+	}
+	wg.Wait()
+	return nil
+}
+
+// pluginProcess is a running plugin, which can serve multiple providers
+type pluginProcess struct {
+	command string
+	args    []string
+
+	lock sync.Mutex
+	// Client for the running process, or nil if the process is not running
+	// Protected by lock
+	client *rpc.Client
+	// Running process
+	// Protected by lock
+	cmd *exec.Cmd
+	// Channel that is closed when the running process exits
+	// Protected by lock
+	exited chan struct{}
+	// Arguments for initializing each provider that uses the plugin, which are used again if the plugin is restarted
+	// Protected by lock
+	instances map[string]dnsplugin.InitArgs
+}
+
+// init initializes a provider in the plugin, starting the plugin if needed
+func (p *pluginProcess) init(ctx context.Context, args dnsplugin.InitArgs) error {
+	p.lock.Lock()
+	client, err := p.ensureStarted(ctx)
+	p.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = p.invoke(ctx, client, dnsplugin.MethodInit, args, &dnsplugin.InitReply{})
+	if err != nil {
+		return err
+	}
+
+	// Store the arguments, so the provider is initialized again if the plugin is restarted
+	p.lock.Lock()
+	p.instances[args.Provider] = args
+	p.lock.Unlock()
+	return nil
+}
+
+// call invokes a method of the plugin, starting the plugin if it's not running
+func (p *pluginProcess) call(ctx context.Context, method string, args any, reply any) error {
+	for attempt := 0; ; attempt++ {
+		p.lock.Lock()
+		client, err := p.ensureStarted(ctx)
+		p.lock.Unlock()
+		if err != nil {
+			return err
+		}
+
+		err = p.invoke(ctx, client, method, args, reply)
+		// If the connection was already lost before the call was sent, the plugin is restarted and the call is retried once
+		if errors.Is(err, rpc.ErrShutdown) && attempt == 0 {
+			continue
+		}
+		return err
+	}
+}
+
+// invoke invokes a method using the client, waiting until the context is canceled
+// If the connection to the plugin is lost, the plugin is stopped, so it's restarted when it's used again
+func (p *pluginProcess) invoke(ctx context.Context, client *rpc.Client, method string, args any, reply any) error {
+	call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("call to %s did not complete: %w", method, ctx.Err())
+	case <-call.Done:
+		if errors.Is(call.Error, rpc.ErrShutdown) || errors.Is(call.Error, io.ErrUnexpectedEOF) {
+			p.discard(client)
+		}
+		return call.Error
+	}
+}
+
+// discard stops the process of the client if it's the running one, after the connection to it was lost
+func (p *pluginProcess) discard(client *rpc.Client) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.client != client {
+		return
+	}
+	logger().Warn("Lost connection to plugin, it will be restarted when it's used again", "plugin", p.command)
+	_ = p.cmd.Process.Kill()
+	p.client = nil
+	p.cmd = nil
+}
+
+// ensureStarted starts the plugin if it's not running, and initializes all providers that use it
+// It must be called while holding the lock
+func (p *pluginProcess) ensureStarted(ctx context.Context) (*rpc.Client, error) {
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	cmd := exec.Command(p.command, p.args...) //nolint:gosec,noctx
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin '%s': %w", p.command, err)
+	}
+	logger().Info("Started plugin", "plugin", p.command, "pid", cmd.Process.Pid)
+
+	// Include the output of the plugin on stderr in the logs
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger().Info("Plugin output", "plugin", p.command, "output", scanner.Text())
+		}
+	}()
+
+	client := jsonrpc.NewClient(pluginConn{Reader: stdout, WriteCloser: stdin})
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		close(exited)
+		p.lock.Lock()
+		if p.cmd == cmd {
+			logger().Warn("Plugin exited, it will be restarted when it's used again", "plugin", p.command, "error", err)
+			p.client = nil
+			p.cmd = nil
+		}
+		p.lock.Unlock()
+		_ = client.Close()
+	}()
+
+	p.client = client
+	p.cmd = cmd
+	p.exited = exited
+
+	// Initialize all providers that use the plugin
+	for _, args := range p.instances {
+		err = p.invoke(ctx, client, dnsplugin.MethodInit, args, &dnsplugin.InitReply{})
+		if err != nil {
+			logger().Error("Failed to initialize provider in plugin", "plugin", p.command, "provider", args.Provider, "error", err)
+		}
+	}
+
+	return client, nil
+}
+
+// stop stops the plugin if it's running, killing it if it doesn't exit before the context is canceled
+func (p *pluginProcess) stop(ctx context.Context) {
+	p.lock.Lock()
+	client, cmd, exited := p.client, p.cmd, p.exited
+	p.client = nil
+	p.cmd = nil
+	p.lock.Unlock()
+
+	if client == nil {
+		return
+	}
+
+	// Closing the client closes stdin, which asks the plugin to exit
+	_ = client.Close()
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		logger().Warn("Plugin did not exit in time, killing it", "plugin", p.command)
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// pluginConn is the connection to a plugin, which reads from its stdout and writes to its stdin
+type pluginConn struct {
+	io.Reader
+	io.WriteCloser
+}
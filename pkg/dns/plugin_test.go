@@ -0,0 +1,116 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dnsplugin"
+)
+
+// testPlugin is the provider served by the test binary when it runs as a plugin
+// It writes the records to a file in the directory set in the config
+type testPlugin struct {
+	dir string
+}
+
+func (p testPlugin) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	if domain == "crash.example.com" {
+		os.Exit(1)
+	}
+	if domain == "fail.example.com" {
+		return errors.New("zone not found")
+	}
+	data, err := json.Marshal(RecordsUpdate{Domain: domain, RecordType: recordType, TTL: ttl, IPs: ips})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(p.dir, domain+".json"), data, 0o600)
+}
+
+// TestPluginHelperProcess is not a real test: it runs the test binary as a plugin when invoked by TestPluginProvider
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv("DDUP_TEST_PLUGIN") != "1" {
+		t.Skip("only used as a plugin")
+	}
+
+	err := dnsplugin.Serve(func(name string, cfg map[string]any) (dnsplugin.Provider, error) {
+		dir, _ := cfg["dir"].(string)
+		if dir == "" {
+			return nil, errors.New("dir is required")
+		}
+		return testPlugin{dir: dir}, nil
+	})
+	if err != nil {
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func TestPluginProvider(t *testing.T) {
+	t.Setenv("DDUP_TEST_PLUGIN", "1")
+	t.Cleanup(func() {
+		_ = StopPlugins(context.Background())
+	})
+
+	dir := t.TempDir()
+	cfg := &config.PluginConfig{
+		Command: os.Args[0] + " -test.run=^TestPluginHelperProcess$",
+		Config:  map[string]any{"dir": dir},
+	}
+
+	readRecords := func(t *testing.T, domain string) RecordsUpdate {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, domain+".json"))
+		require.NoError(t, err)
+		var res RecordsUpdate
+		require.NoError(t, json.Unmarshal(data, &res))
+		return res
+	}
+
+	provider, err := NewPluginProvider("test", cfg, nil)
+	require.NoError(t, err)
+
+	t.Run("Update records", func(t *testing.T) {
+		err := provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeA, 60, []string{"10.0.0.1", "10.0.0.2"})
+		require.NoError(t, err)
+		assert.Equal(t, RecordsUpdate{Domain: "app.example.com", RecordType: RecordTypeA, TTL: 60, IPs: []string{"10.0.0.1", "10.0.0.2"}}, readRecords(t, "app.example.com"))
+	})
+
+	t.Run("Providers share the process", func(t *testing.T) {
+		other, err := NewPluginProvider("other", cfg, nil)
+		require.NoError(t, err)
+		assert.Same(t, provider.process, other.process)
+
+		err = other.UpdateRecords(t.Context(), "other.example.com", RecordTypeAAAA, 120, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, readRecords(t, "other.example.com").IPs)
+	})
+
+	t.Run("Plugin returns an error", func(t *testing.T) {
+		err := provider.UpdateRecords(t.Context(), "fail.example.com", RecordTypeA, 60, []string{"10.0.0.1"})
+		require.ErrorContains(t, err, "zone not found")
+	})
+
+	t.Run("Plugin is restarted after crashing", func(t *testing.T) {
+		err := provider.UpdateRecords(t.Context(), "crash.example.com", RecordTypeA, 60, []string{"10.0.0.1"})
+		require.Error(t, err)
+
+		// The plugin is started again, and the provider is initialized again
+		err = provider.UpdateRecords(t.Context(), "restarted.example.com", RecordTypeA, 60, []string{"10.0.0.3"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.3"}, readRecords(t, "restarted.example.com").IPs)
+	})
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := NewPluginProvider("invalid", &config.PluginConfig{Command: cfg.Command}, nil)
+		require.ErrorContains(t, err, "dir is required")
+	})
+}
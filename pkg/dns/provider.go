@@ -2,9 +2,15 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
 
 	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/httptransport"
+	"github.com/italypaleale/ddup/pkg/logging"
 	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
 )
 
@@ -12,34 +18,223 @@ import (
 type Provider interface {
 	// Name returns the provider's name
 	Name() string
-	// UpdateRecords updates DNS records for the given domain with the provided IPs
-	UpdateRecords(ctx context.Context, domain string, ttl int, ips []string) error
+	// UpdateRecords updates DNS records of the given type (A or AAAA) for the domain with the provided IPs
+	// Existing records of the same type that are not in the list are removed
+	UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error
+}
+
+// Record types
+const (
+	RecordTypeA     = "A"
+	RecordTypeAAAA  = "AAAA"
+	RecordTypeTXT   = "TXT"
+	RecordTypeCNAME = "CNAME"
+)
+
+// RecordsUpdate is the desired state of the records of a type for a domain
+// It's sent to the exec and webhook providers, which apply it
+type RecordsUpdate struct {
+	// Name of the provider
+	Provider string `json:"provider"`
+	// Domain name
+	Domain string `json:"domain"`
+	// Type of the records: A or AAAA
+	RecordType string `json:"recordType"`
+	// TTL of the records, in seconds
+	TTL int `json:"ttl"`
+	// IPs that must be published; records for other IPs of the same type must be removed
+	IPs []string `json:"ips"`
+}
+
+// RecordTypeForIP returns the type of record (A or AAAA) for the IP address
+// It returns an empty string if the IP is not valid
+func RecordTypeForIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	switch {
+	case err != nil:
+		return ""
+	case addr.Unmap().Is4():
+		return RecordTypeA
+	default:
+		return RecordTypeAAAA
+	}
+}
+
+// FilterIPsByRecordType returns the IPs for records of the given type
+func FilterIPsByRecordType(ips []string, recordType string) []string {
+	res := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if RecordTypeForIP(ip) == recordType {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
+
+// RecordReader is implemented by providers that can return the records currently published
+// This is used to detect and correct records that were changed outside of ddup
+type RecordReader interface {
+	Provider
+	// GetRecords returns the IPs in the DNS records of the given type (A or AAAA) for the domain
+	GetRecords(ctx context.Context, domain string, recordType string) ([]string, error)
+}
+
+// WeightedProvider is implemented by providers that support weighted or multi-value routing natively
+type WeightedProvider interface {
+	Provider
+	// UpdateWeightedRecords updates DNS records for the given domain using the provider's native routing features
+	// The list contains all endpoints, including unhealthy ones, so the provider can map weights and health status onto its own routing policies
+	UpdateWeightedRecords(ctx context.Context, domain string, ttl int, records []WeightedRecord) error
+}
+
+// TXTRecordProvider is implemented by providers that can manage TXT records
+// This is used to solve ACME DNS-01 challenges
+type TXTRecordProvider interface {
+	Provider
+	// UpdateTXTRecords sets the TXT records for the name to the given values
+	// If the list of values is empty, the records are deleted
+	UpdateTXTRecords(ctx context.Context, name string, ttl int, values []string) error
+}
+
+// CNAMERecordProvider is implemented by providers that can manage CNAME records
+// This is used by domains with the "cname" routing policy
+type CNAMERecordProvider interface {
+	Provider
+	// UpdateCNAMERecord sets the CNAME record for the name to point at the target hostname
+	// The target does not include the trailing dot
+	UpdateCNAMERecord(ctx context.Context, name string, ttl int, target string) error
+}
+
+// CredentialsVerifier is implemented by providers that can verify their credentials with a read-only request to their API
+// This is used by the preflight checks at startup, so invalid credentials are reported before they're needed for a failover
+type CredentialsVerifier interface {
+	Provider
+	// VerifyCredentials returns an error if the credentials are invalid or they don't grant access to the resources in the configuration
+	VerifyCredentials(ctx context.Context) error
+}
+
+// Flusher is implemented by providers that publish the changes to records in batches, rather than with each update
+// Callers invoke Flush after they've finished updating records, for example once per check cycle
+type Flusher interface {
+	Provider
+	// Flush publishes the changes made since the last call
+	Flush(ctx context.Context) error
+}
+
+// Flush publishes the pending changes of the provider, if it implements Flusher
+func Flush(ctx context.Context, provider Provider) error {
+	f, ok := provider.(Flusher)
+	if !ok {
+		return nil
+	}
+	return f.Flush(ctx)
+}
+
+// WeightedRecord is a record for a weighted provider
+type WeightedRecord struct {
+	// Endpoint name
+	Name string
+	// IP address
+	IP string
+	// Relative weight, between 0 and 255
+	Weight int
+	// True if the endpoint is healthy
+	Healthy bool
 }
 
 // NewProvider creates a new DNS provider based on the configuration
-func NewProvider(name string, cfg *config.ConfigProvider, metrics *appmetrics.AppMetrics) (provider Provider, err error) {
+// The HTTP transport options of the provider are merged with the global ones in httpTransport
+func NewProvider(name string, cfg *config.ConfigProvider, httpTransport config.ConfigHTTPTransport, metrics *appmetrics.AppMetrics) (provider Provider, err error) {
+	httpClient, err := httptransport.NewHTTPClient(cfg.HTTPTransport.Merge(httpTransport))
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP client: %w", err)
+	}
+
 	// We know that only one provider will be non-nil
 	switch {
 	case cfg.Cloudflare != nil:
-		provider, err = NewCloudflareProvider(name, cfg.Cloudflare, metrics)
+		provider, err = NewCloudflareProvider(name, cfg.Cloudflare, httpClient, metrics)
 		if err != nil {
 			return nil, fmt.Errorf("error initializing Cloudflare provider: %w", err)
 		}
 		return provider, nil
 	case cfg.OVH != nil:
-		provider, err = NewOVHProvider(name, cfg.OVH, metrics)
+		provider, err = NewOVHProvider(name, cfg.OVH, httpClient, metrics)
 		if err != nil {
 			return nil, fmt.Errorf("error initializing OVH provider: %w", err)
 		}
 		return provider, nil
 	case cfg.Azure != nil:
-		provider, err = NewAzureProvider(name, cfg.Azure, metrics)
+		provider, err = NewAzureProvider(name, cfg.Azure, httpClient, metrics)
 		if err != nil {
 			return nil, fmt.Errorf("error initializing Azure provider: %w", err)
 		}
 		return provider, nil
+	case cfg.AzureTrafficManager != nil:
+		provider, err = NewAzureTrafficManagerProvider(name, cfg.AzureTrafficManager, httpClient, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing Azure Traffic Manager provider: %w", err)
+		}
+		return provider, nil
+	case cfg.Webhook != nil:
+		provider, err = NewWebhookProvider(name, cfg.Webhook, httpClient, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing webhook provider: %w", err)
+		}
+		return provider, nil
+	case cfg.Plugin != nil:
+		provider, err = NewPluginProvider(name, cfg.Plugin, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing plugin provider: %w", err)
+		}
+		return provider, nil
+	case cfg.Exec != nil:
+		provider, err = NewExecProvider(name, cfg.Exec, metrics)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing exec provider: %w", err)
+		}
+		return provider, nil
+	case cfg.DNSServer != nil:
+		provider, err = NewDNSServerProvider(name, cfg.DNSServer)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing DNS server provider: %w", err)
+		}
+		return provider, nil
+	case cfg.Custom != nil:
+		return nil, errors.New("custom providers must be registered by the program embedding ddup")
 	default:
 		// Indicates a development-time error
 		panic("invalid provider")
 	}
 }
+
+// VerifyCredentials verifies the credentials of all providers that implement CredentialsVerifier, concurrently
+// The result contains an entry for each provider that was verified, which is nil if the credentials are valid
+func VerifyCredentials(ctx context.Context, providers map[string]Provider) map[string]error {
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	res := make(map[string]error, len(providers))
+	for name, provider := range providers {
+		verifier, ok := provider.(CredentialsVerifier)
+		if !ok {
+			continue
+		}
+
+		wg.Go(func() {
+			err := verifier.VerifyCredentials(ctx)
+			lock.Lock()
+			res[name] = err
+			lock.Unlock()
+		})
+	}
+	wg.Wait()
+
+	return res
+}
+
+// logger returns the logger for DNS providers
+func logger() *slog.Logger {
+	return logging.Component("dns")
+}
@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyCredentials(t *testing.T) {
+	t.Run("Cloudflare", func(t *testing.T) {
+		provider, mockTransport := newCloudflareTestProviderWithMock()
+
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/test-zone-id", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": {"id": "test-zone-id", "name": "example.com"}}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		require.NoError(t, provider.VerifyCredentials(t.Context()))
+
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 1)
+		assert.Equal(t, http.MethodGet, requests[0].Method)
+		assert.Equal(t, "Bearer test-token", requests[0].Header.Get("Authorization"))
+
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/test-zone-id", &MockResponse{
+			StatusCode: 403,
+			Body:       `{"success": false, "errors": [{"code": 9109, "message": "Invalid access token"}], "result": null}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		err := provider.VerifyCredentials(t.Context())
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "(9109) Invalid access token")
+		assert.ErrorContains(t, err, "check that the API token is valid")
+	})
+
+	t.Run("OVH", func(t *testing.T) {
+		provider, mockTransport := newOVHTestProviderWithMock()
+
+		setTime := func(tm time.Time) {
+			mockTransport.SetResponse(http.MethodGet, "/1.0/auth/time", &MockResponse{
+				StatusCode: 200,
+				Body:       strconv.FormatInt(tm.Unix(), 10),
+				Headers:    map[string]string{"Content-Type": "application/json"},
+			})
+		}
+
+		setTime(time.Now())
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"name": "example.com"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		require.NoError(t, provider.VerifyCredentials(t.Context()))
+
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 2)
+		assert.Empty(t, requests[0].Header.Get("X-Ovh-Signature"))
+		assert.NotEmpty(t, requests[1].Header.Get("X-Ovh-Signature"))
+
+		// Clock skew
+		setTime(time.Now().Add(-5 * time.Minute))
+		skew, err := provider.ClockSkew(t.Context())
+		require.NoError(t, err)
+		assert.InDelta(t, 5*time.Minute, skew, float64(5*time.Second))
+		err = provider.VerifyCredentials(t.Context())
+		require.ErrorContains(t, err, "synchronize the clock")
+
+		// Invalid credentials
+		setTime(time.Now())
+		mockTransport.SetResponse(http.MethodGet, "/1.0/domain/zone/example.com", &MockResponse{
+			StatusCode: 403,
+			Body:       `{"message": "This call has not been granted"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		err = provider.VerifyCredentials(t.Context())
+		require.ErrorContains(t, err, "failed to read zone 'example.com'")
+		assert.ErrorContains(t, err, "This call has not been granted")
+	})
+
+	t.Run("Azure", func(t *testing.T) {
+		provider, mockTransport := newAzureTestProviderWithMock("example.com")
+
+		const zonePath = "/subscriptions/test-sub/resourceGroups/test-rg/providers/Microsoft.Network/dnsZones/example.com?api-version=2018-05-01"
+		mockTransport.SetResponse(http.MethodGet, zonePath, &MockResponse{
+			StatusCode: 200,
+			Body:       `{"name": "example.com"}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		require.NoError(t, provider.VerifyCredentials(t.Context()))
+
+		requests := mockTransport.GetRequests()
+		require.Len(t, requests, 1)
+		assert.Equal(t, "Bearer mock-123", requests[0].Header.Get("Authorization"))
+
+		mockTransport.SetResponse(http.MethodGet, zonePath, &MockResponse{
+			StatusCode: 403,
+			Body:       `{"error": {"code": "AuthorizationFailed"}}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		err := provider.VerifyCredentials(t.Context())
+		require.ErrorContains(t, err, "HTTP 403")
+		assert.ErrorContains(t, err, "AuthorizationFailed")
+	})
+
+	t.Run("Azure Traffic Manager", func(t *testing.T) {
+		mockClient, _ := NewMockHTTPClient()
+		provider := &AzureTrafficManagerProvider{
+			name:              "test",
+			subscriptionID:    "test-sub",
+			resourceGroupName: "test-rg",
+			profileName:       "test-profile",
+			credential:        mockAzureTokenProvider{},
+			httpClient:        mockClient,
+		}
+
+		// No response is configured, so the mock returns 404
+		err := provider.VerifyCredentials(t.Context())
+		require.ErrorContains(t, err, "failed to read Traffic Manager profile 'test-profile'")
+		assert.ErrorContains(t, err, "HTTP 404")
+	})
+
+	t.Run("Providers that don't support verifying credentials are skipped", func(t *testing.T) {
+		cf, mockTransport := newCloudflareTestProviderWithMock()
+		mockTransport.SetResponse(http.MethodGet, "/client/v4/zones/test-zone-id", &MockResponse{
+			StatusCode: 200,
+			Body:       `{"success": true, "errors": [], "result": {}}`,
+			Headers:    map[string]string{"Content-Type": "application/json"},
+		})
+		azure, _ := newAzureTestProviderWithMock("example.com")
+		exec := &ExecProvider{name: "exec"}
+
+		results := VerifyCredentials(t.Context(), map[string]Provider{
+			"cf":    cf,
+			"azure": azure,
+			"exec":  exec,
+		})
+		require.Len(t, results, 2)
+		require.NoError(t, results["cf"])
+		require.Error(t, results["azure"])
+		assert.NotContains(t, results, "exec")
+	})
+}
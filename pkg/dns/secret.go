@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secret is a credential that is either set in the configuration or read from a file.
+// When the value is read from a file, the file is read again when it changes, so credentials can be rotated without restarting the app.
+type secret struct {
+	value string
+	file  string
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// newSecret returns a new secret from the value or the file, one of which must be set.
+// The name is used in error messages.
+func newSecret(name string, value string, file string) (*secret, error) {
+	switch {
+	case value != "" && file != "":
+		return nil, fmt.Errorf("only one of %s and %s file can be set", name, name)
+	case value != "":
+		return staticSecret(value), nil
+	case file != "":
+		s := &secret{file: file}
+		// Read the file right away to catch errors early
+		_, err := s.Get()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", name, err)
+		}
+		return s, nil
+	default:
+		return nil, errors.New(name + " is required")
+	}
+}
+
+// staticSecret returns a secret with a fixed value
+func staticSecret(value string) *secret {
+	return &secret{value: value}
+}
+
+// Get returns the value of the secret.
+// If the secret is read from a file, the file is read again if its modification time or size changed.
+func (s *secret) Get() (string, error) {
+	if s.file == "" {
+		return s.value, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Note that os.Stat follows symlinks, which are used by Kubernetes when updating secrets mounted as volumes
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file '%s': %w", s.file, err)
+	}
+	if s.value != "" && info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.value, nil
+	}
+
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file '%s': %w", s.file, err)
+	}
+
+	// Remove trailing newlines, which are often added by editors
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("file '%s' is empty", s.file)
+	}
+
+	s.value = value
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return s.value, nil
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecret(t *testing.T) {
+	t.Run("Static value", func(t *testing.T) {
+		s, err := newSecret("API token", "my-token", "")
+		require.NoError(t, err)
+
+		val, err := s.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "my-token", val)
+	})
+
+	t.Run("Value from file is re-read when it changes", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(filePath, []byte("first\n"), 0o600))
+
+		s, err := newSecret("API token", "", filePath)
+		require.NoError(t, err)
+
+		val, err := s.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "first", val)
+
+		// Update the file, setting a different modification time
+		require.NoError(t, os.WriteFile(filePath, []byte("second"), 0o600))
+		modTime := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(filePath, modTime, modTime))
+
+		val, err = s.Get()
+		require.NoError(t, err)
+		assert.Equal(t, "second", val)
+	})
+
+	t.Run("Both value and file", func(t *testing.T) {
+		_, err := newSecret("API token", "my-token", "/path/to/token")
+		require.ErrorContains(t, err, "only one of API token and API token file can be set")
+	})
+
+	t.Run("Neither value nor file", func(t *testing.T) {
+		_, err := newSecret("API token", "", "")
+		require.ErrorContains(t, err, "API token is required")
+	})
+
+	t.Run("File does not exist", func(t *testing.T) {
+		_, err := newSecret("API token", "", filepath.Join(t.TempDir(), "not-found"))
+		require.ErrorContains(t, err, "error reading API token")
+	})
+
+	t.Run("File is empty", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(filePath, []byte("\n"), 0o600))
+
+		_, err := newSecret("API token", "", filePath)
+		require.ErrorContains(t, err, "is empty")
+	})
+}
@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 )
 
 // MockHTTPTransport provides a mock HTTP transport for testing
+// It's safe for concurrent use
 type MockHTTPTransport struct {
+	lock      sync.Mutex
 	responses map[string]*MockResponse
 	requests  []*http.Request
 }
@@ -36,6 +40,9 @@ func NewMockHTTPClient() (*http.Client, *MockHTTPTransport) {
 
 // RoundTrip implements the http.RoundTripper interface
 func (m *MockHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	// Store the request for inspection
 	m.requests = append(m.requests, req)
 
@@ -75,17 +82,26 @@ func (m *MockHTTPTransport) RoundTrip(req *http.Request) (*http.Response, error)
 
 // SetResponse sets a mock response for a specific HTTP method and URL path
 func (m *MockHTTPTransport) SetResponse(method, urlPath string, response *MockResponse) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	key := method + " " + urlPath
 	m.responses[key] = response
 }
 
 // GetRequests returns all requests made to the mock client
 func (m *MockHTTPTransport) GetRequests() []*http.Request {
-	return m.requests
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return slices.Clone(m.requests)
 }
 
 // Reset clears all responses and requests
 func (m *MockHTTPTransport) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
 	m.responses = make(map[string]*MockResponse)
 	m.requests = make([]*http.Request, 0)
 }
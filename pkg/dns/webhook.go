@@ -0,0 +1,170 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// Defaults for the webhook provider
+const (
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookRetries    = 3
+	defaultWebhookRetryDelay = time.Second
+)
+
+// WebhookProvider implements the Provider interface by sending the desired state of the records to a URL, which applies it
+type WebhookProvider struct {
+	name       string
+	url        string
+	path       string
+	headers    map[string]string
+	timeout    time.Duration
+	retries    int
+	retryDelay time.Duration
+	metrics    *appmetrics.AppMetrics
+	httpClient *http.Client
+}
+
+// NewWebhookProvider creates a new webhook DNS provider
+// If httpClient is nil, a default client is used
+func NewWebhookProvider(name string, cfg *config.WebhookProviderConfig, httpClient *http.Client, metrics *appmetrics.AppMetrics) (*WebhookProvider, error) {
+	if httpClient == nil {
+		httpClient = tracing.NewHTTPClient()
+	}
+
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url must be a http(s) URL")
+	}
+	for k := range cfg.Headers {
+		if k == "" || strings.ContainsAny(k, ": \t\r\n") {
+			return nil, fmt.Errorf("header name '%s' is not valid", k)
+		}
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	retries := defaultWebhookRetries
+	if cfg.Retries != nil {
+		if *cfg.Retries < 0 {
+			return nil, errors.New("retries must not be negative")
+		}
+		retries = *cfg.Retries
+	}
+	retryDelay := cfg.RetryDelay
+	if retryDelay <= 0 {
+		retryDelay = defaultWebhookRetryDelay
+	}
+
+	return &WebhookProvider{
+		name:       name,
+		url:        cfg.URL,
+		path:       u.Path,
+		headers:    cfg.Headers,
+		timeout:    timeout,
+		retries:    retries,
+		retryDelay: retryDelay,
+		metrics:    metrics,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Name returns the provider's name
+func (w *WebhookProvider) Name() string {
+	return w.name
+}
+
+// UpdateRecords sends the desired state of the records of the given type for the domain to the webhook, retrying on failure
+// The webhook must respond with a 2xx status code when the records have been updated
+func (w *WebhookProvider) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	if ips == nil {
+		ips = []string{}
+	}
+	body, err := json.Marshal(RecordsUpdate{
+		Provider:   w.name,
+		Domain:     domain,
+		RecordType: recordType,
+		TTL:        ttl,
+		IPs:        ips,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		err = w.send(ctx, body)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= w.retries || ctx.Err() != nil {
+			return fmt.Errorf("request failed after %d attempts: %w", attempt+1, err)
+		}
+
+		logger().WarnContext(ctx, "Failed to send records to webhook, retrying", "provider", w.name, "domain", domain, "error", err, "retryDelay", delay)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("request failed after %d attempts: %w", attempt+1, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// send performs a single request to the webhook
+func (w *WebhookProvider) send(ctx context.Context, body []byte) error {
+	start := time.Now()
+	var success bool
+	if w.metrics != nil {
+		defer func() {
+			w.metrics.RecordAPICall("webhook", http.MethodPost, w.path, success, time.Since(start))
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		return fmt.Errorf("invalid response status code HTTP %d; response: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+
+	success = true
+	return nil
+}
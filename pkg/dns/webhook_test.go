@@ -0,0 +1,100 @@
+package dns
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestWebhookProvider(t *testing.T) {
+	var (
+		calls    atomic.Int32
+		failures atomic.Int32
+		received atomic.Pointer[RecordsUpdate]
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if failures.Load() > 0 {
+			failures.Add(-1)
+			http.Error(w, "temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req RecordsUpdate
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received.Store(&req)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	newProvider := func(t *testing.T, retries int) *WebhookProvider {
+		t.Helper()
+		provider, err := NewWebhookProvider("test", &config.WebhookProviderConfig{
+			URL:        srv.URL + "/records",
+			Headers:    map[string]string{"Authorization": "Bearer secret"},
+			Retries:    &retries,
+			RetryDelay: 10 * time.Millisecond,
+		}, nil, nil)
+		require.NoError(t, err)
+		return provider
+	}
+
+	t.Run("Update records", func(t *testing.T) {
+		calls.Store(0)
+		provider := newProvider(t, 3)
+		err := provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeA, 60, []string{"10.0.0.1", "10.0.0.2"})
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, &RecordsUpdate{
+			Provider:   "test",
+			Domain:     "app.example.com",
+			RecordType: RecordTypeA,
+			TTL:        60,
+			IPs:        []string{"10.0.0.1", "10.0.0.2"},
+		}, received.Load())
+	})
+
+	t.Run("Retries on failure", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(2)
+		provider := newProvider(t, 3)
+		err := provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeAAAA, 60, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(3), calls.Load())
+		assert.Equal(t, []string{}, received.Load().IPs)
+	})
+
+	t.Run("Fails after retries", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(5)
+		provider := newProvider(t, 1)
+		err := provider.UpdateRecords(t.Context(), "app.example.com", RecordTypeA, 60, []string{"10.0.0.1"})
+		require.ErrorContains(t, err, "request failed after 2 attempts: invalid response status code HTTP 503; response: temporarily unavailable")
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := NewWebhookProvider("test", &config.WebhookProviderConfig{}, nil, nil)
+		require.ErrorContains(t, err, "url is required")
+		_, err = NewWebhookProvider("test", &config.WebhookProviderConfig{URL: "ftp://example.com"}, nil, nil)
+		require.ErrorContains(t, err, "url must be a http(s) URL")
+	})
+}
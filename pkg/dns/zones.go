@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Interval after which the list of zones is read again from the provider
+	zoneCacheTTL = 15 * time.Minute
+	// Minimum interval between reading the list of zones again when a name doesn't belong to any zone
+	zoneCacheMinRefresh = time.Minute
+)
+
+// zoneForName returns the zone that the name belongs to, which is the longest zone in the list that is the name itself or one of its parent domains
+// It returns false if the name doesn't belong to any zone
+func zoneForName(name string, zones []string) (string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	var res string
+	for _, zone := range zones {
+		z := strings.ToLower(strings.TrimSuffix(zone, "."))
+		if z == "" || len(z) <= len(res) {
+			continue
+		}
+		if name == z || strings.HasSuffix(name, "."+z) {
+			res = zone
+		}
+	}
+	return res, res != ""
+}
+
+// subDomainInZone returns the part of the name before the zone, or an empty string if the name is the zone's apex
+func subDomainInZone(name string, zone string) (string, error) {
+	name = strings.TrimSuffix(name, ".")
+	zone = strings.TrimSuffix(zone, ".")
+	if strings.EqualFold(name, zone) {
+		return "", nil
+	}
+	if len(name) > len(zone)+1 && strings.EqualFold(name[len(name)-len(zone)-1:], "."+zone) {
+		return name[:len(name)-len(zone)-1], nil
+	}
+	return "", fmt.Errorf("domain %s is not a subdomain of zone %s", name, zone)
+}
+
+// zoneCache contains the list of zones that a provider's credentials grant access to, which is used to detect the zone of records automatically
+// The list is read from the provider when it's first needed, and then again periodically, or when a name doesn't belong to any zone.
+type zoneCache struct {
+	// Function that reads the list of zones from the provider
+	list func(ctx context.Context) ([]string, error)
+
+	lock    sync.Mutex
+	zones   []string
+	fetched time.Time
+}
+
+// newZoneCache returns a zoneCache that reads the list of zones with the function
+func newZoneCache(list func(ctx context.Context) ([]string, error)) *zoneCache {
+	return &zoneCache{
+		list: list,
+	}
+}
+
+// ZoneFor returns the zone that the name belongs to
+func (z *zoneCache) ZoneFor(ctx context.Context, name string) (string, error) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	if z.zones == nil || time.Since(z.fetched) > zoneCacheTTL {
+		err := z.refresh(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	zone, ok := zoneForName(name, z.zones)
+	if ok {
+		return zone, nil
+	}
+
+	// The zone may have been added after the list was read
+	if time.Since(z.fetched) > zoneCacheMinRefresh {
+		err := z.refresh(ctx)
+		if err != nil {
+			return "", err
+		}
+		zone, ok = zoneForName(name, z.zones)
+		if ok {
+			return zone, nil
+		}
+	}
+
+	return "", fmt.Errorf("domain %s does not belong to any of the zones the credentials grant access to", name)
+}
+
+// Zones returns the list of zones, reading it from the provider if it's not cached
+func (z *zoneCache) Zones(ctx context.Context) ([]string, error) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+
+	if z.zones == nil || time.Since(z.fetched) > zoneCacheTTL {
+		err := z.refresh(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return z.zones, nil
+}
+
+// refresh reads the list of zones from the provider
+// It must be called while holding the lock
+func (z *zoneCache) refresh(ctx context.Context) error {
+	zones, err := z.list(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing zones: %w", err)
+	}
+	if zones == nil {
+		zones = []string{}
+	}
+
+	z.zones = zones
+	z.fetched = time.Now()
+	return nil
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZoneForName(t *testing.T) {
+	zones := []string{"example.com", "sub.example.com", "example.org.", "ample.com"}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "example.com", expected: "example.com"},
+		{name: "www.example.com", expected: "example.com"},
+		{name: "www.sub.example.com", expected: "sub.example.com"},
+		{name: "sub.example.com", expected: "sub.example.com"},
+		{name: "WWW.Example.Org.", expected: "example.org."},
+		{name: "notexample.com", expected: ""},
+		{name: "example.net", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone, ok := zoneForName(tt.name, zones)
+			assert.Equal(t, tt.expected, zone)
+			assert.Equal(t, tt.expected != "", ok)
+		})
+	}
+}
+
+func TestSubDomainInZone(t *testing.T) {
+	sub, err := subDomainInZone("example.com", "example.com")
+	require.NoError(t, err)
+	assert.Empty(t, sub)
+
+	sub, err = subDomainInZone("api.v1.example.com.", "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "api.v1", sub)
+
+	_, err = subDomainInZone("notexample.com", "example.com")
+	require.ErrorContains(t, err, "is not a subdomain of zone")
+}
+
+func TestZoneCache(t *testing.T) {
+	var (
+		calls   int
+		zones   = []string{"example.com"}
+		listErr error
+	)
+	cache := newZoneCache(func(ctx context.Context) ([]string, error) {
+		calls++
+		return zones, listErr
+	})
+
+	// The list is read when it's first needed, then cached
+	zone, err := cache.ZoneFor(t.Context(), "www.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", zone)
+	zone, err = cache.ZoneFor(t.Context(), "api.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", zone)
+	assert.Equal(t, 1, calls)
+
+	// Names that don't match are not refreshed again right away
+	zones = []string{"example.com", "example.org"}
+	_, err = cache.ZoneFor(t.Context(), "www.example.org")
+	require.ErrorContains(t, err, "does not belong to any of the zones")
+	assert.Equal(t, 1, calls)
+
+	// After some time, the list is read again if a name doesn't match
+	cache.fetched = time.Now().Add(-2 * zoneCacheMinRefresh)
+	zone, err = cache.ZoneFor(t.Context(), "www.example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", zone)
+	assert.Equal(t, 2, calls)
+
+	// Errors listing zones are returned
+	cache.fetched = time.Now().Add(-2 * zoneCacheTTL)
+	listErr = errors.New("simulated")
+	_, err = cache.ZoneFor(t.Context(), "www.example.com")
+	require.ErrorContains(t, err, "simulated")
+}
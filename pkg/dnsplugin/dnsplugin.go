@@ -0,0 +1,148 @@
+package dnsplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion is the version of the protocol between ddup and plugins
+const ProtocolVersion = 1
+
+// Names of the methods invoked by ddup
+const (
+	MethodInit          = "Plugin.Init"
+	MethodUpdateRecords = "Plugin.UpdateRecords"
+)
+
+// InitArgs are the arguments for the Init method, which is invoked for each provider that uses the plugin, before its records are updated
+// Init is invoked again for the same provider when the configuration is reloaded, and after the plugin is restarted
+type InitArgs struct {
+	// Version of the protocol used by ddup
+	ProtocolVersion int `json:"protocolVersion"`
+	// Name of the provider
+	Provider string `json:"provider"`
+	// Configuration for the provider, from the config section of the provider in the ddup configuration
+	Config map[string]any `json:"config"`
+}
+
+// InitReply is the response of the Init method
+type InitReply struct{}
+
+// UpdateRecordsArgs are the arguments for the UpdateRecords method, which contain the desired state of the records
+type UpdateRecordsArgs struct {
+	// Name of the provider
+	Provider string `json:"provider"`
+	// Domain name
+	Domain string `json:"domain"`
+	// Type of the records: A or AAAA
+	RecordType string `json:"recordType"`
+	// TTL of the records, in seconds
+	TTL int `json:"ttl"`
+	// IPs that must be published; records for other IPs of the same type must be removed
+	IPs []string `json:"ips"`
+	// Time after which ddup stops waiting for the update to complete; in JSON, it is encoded as a number of nanoseconds
+	Timeout time.Duration `json:"timeout"`
+}
+
+// UpdateRecordsReply is the response of the UpdateRecords method
+type UpdateRecordsReply struct{}
+
+// Provider is a DNS provider implemented by a plugin
+type Provider interface {
+	// UpdateRecords updates DNS records of the given type (A or AAAA) for the domain with the provided IPs
+	// Existing records of the same type that are not in the list must be removed
+	UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error
+}
+
+// Factory returns the Provider for a provider that uses the plugin, with the configuration from the ddup configuration
+type Factory func(name string, config map[string]any) (Provider, error)
+
+// Serve serves the plugin on stdin and stdout, and returns when ddup closes stdin
+// ddup communicates with the plugin using JSON-RPC, so the plugin must not write to stdout; logs can be written to stderr, and they're included in ddup's logs
+func Serve(factory Factory) error {
+	return ServeConn(stdio{}, factory)
+}
+
+// ServeConn serves the plugin on the connection, and returns when the connection is closed
+func ServeConn(conn io.ReadWriteCloser, factory Factory) error {
+	srv := rpc.NewServer()
+	err := srv.RegisterName("Plugin", &service{
+		factory:   factory,
+		providers: map[string]Provider{},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register service: %w", err)
+	}
+
+	srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+// service implements the methods invoked by ddup
+// Methods must be exported to be invoked with net/rpc
+type service struct {
+	factory Factory
+
+	lock sync.RWMutex
+	// Providers that were initialized, keyed by name
+	// Protected by lock
+	providers map[string]Provider
+}
+
+// Init implements the Init method
+func (s *service) Init(args InitArgs, reply *InitReply) error {
+	if args.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d: plugin supports version %d", args.ProtocolVersion, ProtocolVersion)
+	}
+
+	p, err := s.factory(args.Provider, args.Config)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.providers[args.Provider] = p
+	s.lock.Unlock()
+	return nil
+}
+
+// UpdateRecords implements the UpdateRecords method
+func (s *service) UpdateRecords(args UpdateRecordsArgs, reply *UpdateRecordsReply) error {
+	s.lock.RLock()
+	p, ok := s.providers[args.Provider]
+	s.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("provider '%s' is not initialized", args.Provider)
+	}
+
+	ctx := context.Background()
+	if args.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, args.Timeout)
+		defer cancel()
+	}
+
+	return p.UpdateRecords(ctx, args.Domain, args.RecordType, args.TTL, args.IPs)
+}
+
+// stdio is a connection that reads from stdin and writes to stdout
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error) {
+	return os.Stdin.Read(p)
+}
+
+func (stdio) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+func (stdio) Close() error {
+	return errors.Join(os.Stdin.Close(), os.Stdout.Close())
+}
@@ -0,0 +1,60 @@
+package dnsplugin
+
+import (
+	"context"
+	"net"
+	"net/rpc/jsonrpc"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type providerFn func(ctx context.Context, domain string, recordType string, ttl int, ips []string) error
+
+func (fn providerFn) UpdateRecords(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+	return fn(ctx, domain, recordType, ttl, ips)
+}
+
+func TestServeConn(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	var received UpdateRecordsArgs
+	go func() {
+		_ = ServeConn(serverConn, func(name string, config map[string]any) (Provider, error) {
+			assert.Equal(t, "test", name)
+			assert.Equal(t, map[string]any{"zone": "example.com"}, config)
+			return providerFn(func(ctx context.Context, domain string, recordType string, ttl int, ips []string) error {
+				_, hasDeadline := ctx.Deadline()
+				assert.True(t, hasDeadline)
+				received = UpdateRecordsArgs{Provider: name, Domain: domain, RecordType: recordType, TTL: ttl, IPs: ips}
+				return nil
+			}), nil
+		})
+	}()
+
+	client := jsonrpc.NewClient(clientConn)
+
+	// Providers must be initialized first
+	err := client.Call(MethodUpdateRecords, UpdateRecordsArgs{Provider: "test"}, &UpdateRecordsReply{})
+	require.ErrorContains(t, err, "provider 'test' is not initialized")
+
+	err = client.Call(MethodInit, InitArgs{ProtocolVersion: ProtocolVersion + 1, Provider: "test"}, &InitReply{})
+	require.ErrorContains(t, err, "unsupported protocol version")
+
+	err = client.Call(MethodInit, InitArgs{ProtocolVersion: ProtocolVersion, Provider: "test", Config: map[string]any{"zone": "example.com"}}, &InitReply{})
+	require.NoError(t, err)
+
+	err = client.Call(MethodUpdateRecords, UpdateRecordsArgs{
+		Provider:   "test",
+		Domain:     "app.example.com",
+		RecordType: "A",
+		TTL:        60,
+		IPs:        []string{"10.0.0.1"},
+		Timeout:    time.Second,
+	}, &UpdateRecordsReply{})
+	require.NoError(t, err)
+	assert.Equal(t, UpdateRecordsArgs{Provider: "test", Domain: "app.example.com", RecordType: "A", TTL: 60, IPs: []string{"10.0.0.1"}}, received)
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Type is the type of an event
+type Type string
+
+const (
+	// TypeEndpointUp is published when an endpoint is added to DNS after becoming healthy
+	TypeEndpointUp Type = "endpoint.up"
+	// TypeEndpointDown is published when an endpoint is removed from DNS after becoming unhealthy
+	TypeEndpointDown Type = "endpoint.down"
+	// TypeDomainDegraded is published when a domain has no healthy endpoints, or fewer than the configured minimum
+	TypeDomainDegraded Type = "domain.degraded"
+	// TypeDomainRecovered is published when a domain that was degraded has enough healthy endpoints again
+	TypeDomainRecovered Type = "domain.recovered"
+	// TypeDNSUpdated is published when the records of a domain are updated
+	TypeDNSUpdated Type = "dns.updated"
+	// TypeProviderError is published when updating the records of a domain fails
+	TypeProviderError Type = "provider.error"
+	// TypeRecordsConflict is published when the records of a domain were changed outside of ddup after ddup last published them
+	TypeRecordsConflict Type = "records.conflict"
+)
+
+// AllTypes contains all types of events
+var AllTypes = []Type{
+	TypeEndpointUp,
+	TypeEndpointDown,
+	TypeDomainDegraded,
+	TypeDomainRecovered,
+	TypeDNSUpdated,
+	TypeProviderError,
+	TypeRecordsConflict,
+}
+
+// Event is a state transition of a domain or endpoint
+type Event struct {
+	Type     Type      `json:"type"`
+	Time     time.Time `json:"time"`
+	Domain   string    `json:"domain"`
+	Provider string    `json:"provider,omitempty"`
+	// IP of the endpoint, for endpoint events
+	IP string `json:"ip,omitempty"`
+	// IPs published in DNS, for DNS and domain events
+	IPs []string `json:"ips,omitempty"`
+	// TTL of the records, for DNS events
+	TTL   int    `json:"ttl,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Bus delivers events to subscribers
+// A nil Bus is valid, and discards all events
+type Bus struct {
+	lock sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+// NewBus returns a new Bus
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives all events published after this call, and a function to unsubscribe
+// Events are dropped if the channel's buffer is full, so publishers are never blocked by slow subscribers
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.lock.Lock()
+	b.subs[ch] = struct{}{}
+	b.lock.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subs, ch)
+			close(ch)
+			b.lock.Unlock()
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish sends an event to all subscribers
+// If the event's time is not set, it's set to the current time
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			slog.Warn("Event dropped because a subscriber is not keeping up", "type", e.Type, "domain", e.Domain)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("Delivers to all subscribers", func(t *testing.T) {
+		b := NewBus()
+		ch1, unsub1 := b.Subscribe(1)
+		defer unsub1()
+		ch2, unsub2 := b.Subscribe(1)
+		defer unsub2()
+
+		b.Publish(Event{Type: TypeDNSUpdated, Domain: "example.com"})
+
+		for _, ch := range []<-chan Event{ch1, ch2} {
+			e := <-ch
+			assert.Equal(t, TypeDNSUpdated, e.Type)
+			assert.Equal(t, "example.com", e.Domain)
+			assert.False(t, e.Time.IsZero())
+		}
+	})
+
+	t.Run("Drops events when buffer is full", func(t *testing.T) {
+		b := NewBus()
+		ch, unsub := b.Subscribe(1)
+		defer unsub()
+
+		b.Publish(Event{Type: TypeEndpointUp, IP: "1.1.1.1"})
+		b.Publish(Event{Type: TypeEndpointUp, IP: "2.2.2.2"})
+
+		e := <-ch
+		assert.Equal(t, "1.1.1.1", e.IP)
+		assert.Empty(t, ch)
+	})
+
+	t.Run("Unsubscribe closes the channel", func(t *testing.T) {
+		b := NewBus()
+		ch, unsub := b.Subscribe(1)
+		unsub()
+		unsub()
+
+		_, ok := <-ch
+		require.False(t, ok)
+
+		// Publishing after unsubscribing doesn't panic
+		b.Publish(Event{Type: TypeEndpointDown})
+	})
+
+	t.Run("Nil bus", func(t *testing.T) {
+		var b *Bus
+		b.Publish(Event{Type: TypeProviderError})
+	})
+}
@@ -0,0 +1,118 @@
+package gatewayip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/logging"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// Client obtains the external IP address from the local gateway (router), using NAT-PMP or UPnP IGD
+type Client struct {
+	protocol   string
+	timeout    time.Duration
+	httpClient *http.Client
+
+	// Address of the gateway for NAT-PMP; if invalid, the default gateway is used
+	gateway netip.Addr
+	// Port for NAT-PMP requests
+	natpmpPort uint16
+	// Address where SSDP discovery requests are sent, for UPnP
+	ssdpAddr string
+
+	lock sync.Mutex
+	// URL of the UPnP control endpoint, which is cached after discovery
+	upnpControl *upnpControl
+}
+
+// NewClient returns a new Client based on the configuration
+func NewClient(cfg config.ConfigGateway) (*Client, error) {
+	c := &Client{
+		protocol:   cfg.Protocol,
+		timeout:    cfg.Timeout,
+		httpClient: tracing.NewHTTPClient(),
+		natpmpPort: natpmpPort,
+		ssdpAddr:   ssdpAddr,
+	}
+
+	switch c.protocol {
+	case "":
+		c.protocol = config.GatewayProtocolAuto
+	case config.GatewayProtocolAuto, config.GatewayProtocolNATPMP, config.GatewayProtocolUPnP:
+		// All good
+	default:
+		return nil, fmt.Errorf("protocol '%s' is not supported", cfg.Protocol)
+	}
+
+	if cfg.Address != "" {
+		addr, err := netip.ParseAddr(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway address '%s': %w", cfg.Address, err)
+		}
+		c.gateway = addr.Unmap()
+	}
+
+	return c, nil
+}
+
+// ExternalIP returns the external IPv4 address of the gateway
+// Results are not cached: the ipsource package caches them, so domains checked in the same cycle share them
+func (c *Client) ExternalIP(ctx context.Context) (netip.Addr, error) {
+	// Requests to the gateway are sent one at a time
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	addr, err := c.query(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	switch {
+	case !addr.Is4():
+		return netip.Addr{}, fmt.Errorf("gateway returned '%s', which is not an IPv4 address", addr)
+	case !addr.IsGlobalUnicast() || addr.IsPrivate():
+		// This happens when the gateway is itself behind another NAT
+		return netip.Addr{}, fmt.Errorf("gateway returned '%s', which is not a public IP address", addr)
+	}
+
+	return addr, nil
+}
+
+// query obtains the external IP using the configured protocol
+func (c *Client) query(ctx context.Context) (netip.Addr, error) {
+	switch c.protocol {
+	case config.GatewayProtocolNATPMP:
+		return c.queryNATPMP(ctx)
+	case config.GatewayProtocolUPnP:
+		return c.queryUPnP(ctx)
+	default:
+		// In auto mode, try NAT-PMP first, which is faster, then UPnP
+		addr, natpmpErr := c.queryNATPMP(ctx)
+		if natpmpErr == nil {
+			return addr, nil
+		}
+		logger().DebugContext(ctx, "Failed to get the external IP with NAT-PMP, trying UPnP", slog.Any("error", natpmpErr))
+
+		addr, upnpErr := c.queryUPnP(ctx)
+		if upnpErr != nil {
+			return netip.Addr{}, errors.Join(
+				fmt.Errorf("NAT-PMP: %w", natpmpErr),
+				fmt.Errorf("UPnP: %w", upnpErr),
+			)
+		}
+		return addr, nil
+	}
+}
+
+// logger returns the logger for the gateway client
+func logger() *slog.Logger {
+	return logging.Component("gatewayip")
+}
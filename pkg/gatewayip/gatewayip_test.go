@@ -0,0 +1,243 @@
+package gatewayip
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// newUDPServer starts a UDP server on localhost that replies to every packet with the response returned by fn
+func newUDPServer(t *testing.T, fn func(req []byte) []byte) netip.AddrPort {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			res := fn(buf[:n])
+			if res != nil {
+				_, _ = conn.WriteTo(res, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
+// newNATPMPServer starts a NAT-PMP server that returns the given external address, and counts the requests it receives
+func newNATPMPServer(t *testing.T, ip string, resultCode byte) (netip.AddrPort, *atomic.Int32) {
+	t.Helper()
+
+	var count atomic.Int32
+	addr := netip.MustParseAddr(ip).As4()
+	srv := newUDPServer(t, func(req []byte) []byte {
+		count.Add(1)
+		if len(req) != 2 || req[0] != 0 || req[1] != 0 {
+			return nil
+		}
+		res := []byte{0, 128, 0, resultCode, 0, 0, 0, 1}
+		return append(res, addr[:]...)
+	})
+	return srv, &count
+}
+
+// newUPnPGateway starts a SSDP responder and a HTTP server that implement a UPnP gateway returning the given external address
+func newUPnPGateway(t *testing.T, ip string) (ssdp netip.AddrPort, requests *atomic.Int32) {
+	t.Helper()
+
+	requests = &atomic.Int32{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /desc.xml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`)
+	})
+	mux.HandleFunc("POST /ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("SOAPAction") != `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"` {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = io.WriteString(w, `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>`+ip+`</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	ssdp = newUDPServer(t, func(req []byte) []byte {
+		if !strings.HasPrefix(string(req), "M-SEARCH * HTTP/1.1\r\n") {
+			return nil
+		}
+		return []byte("HTTP/1.1 200 OK\r\n" +
+			"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+			"LOCATION: " + srv.URL + "/desc.xml\r\n" +
+			"\r\n")
+	})
+	return ssdp, requests
+}
+
+func TestClient(t *testing.T) {
+	newClient := func(t *testing.T, protocol string, natpmp netip.AddrPort, ssdp netip.AddrPort) *Client {
+		t.Helper()
+
+		c, err := NewClient(config.ConfigGateway{
+			Protocol: protocol,
+			Address:  "127.0.0.1",
+			Timeout:  time.Second,
+		})
+		require.NoError(t, err)
+		c.natpmpPort = natpmp.Port()
+		c.ssdpAddr = ssdp.String()
+		return c
+	}
+
+	// Address where nothing is listening
+	unused := netip.MustParseAddrPort("127.0.0.1:9")
+
+	t.Run("NAT-PMP", func(t *testing.T) {
+		natpmp, count := newNATPMPServer(t, "203.0.113.1", 0)
+		c := newClient(t, config.GatewayProtocolNATPMP, natpmp, unused)
+
+		for range 3 {
+			addr, err := c.ExternalIP(t.Context())
+			require.NoError(t, err)
+			assert.Equal(t, "203.0.113.1", addr.String())
+		}
+
+		// Results are cached by the ipsource package, so the gateway is queried each time
+		assert.Equal(t, int32(3), count.Load())
+	})
+
+	t.Run("NAT-PMP error", func(t *testing.T) {
+		natpmp, _ := newNATPMPServer(t, "0.0.0.0", 3)
+		c := newClient(t, config.GatewayProtocolNATPMP, natpmp, unused)
+
+		_, err := c.ExternalIP(t.Context())
+		require.ErrorContains(t, err, "gateway returned error 3 (network failure)")
+	})
+
+	t.Run("UPnP", func(t *testing.T) {
+		ssdp, requests := newUPnPGateway(t, "203.0.113.2")
+		c := newClient(t, config.GatewayProtocolUPnP, unused, ssdp)
+
+		addr, err := c.ExternalIP(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "203.0.113.2", addr.String())
+		assert.Equal(t, int32(1), requests.Load())
+
+		// The control URL is cached after discovery
+		require.NotNil(t, c.upnpControl)
+		assert.Equal(t, "urn:schemas-upnp-org:service:WANIPConnection:1", c.upnpControl.serviceType)
+		assert.True(t, strings.HasSuffix(c.upnpControl.url, "/ctl/IPConn"))
+	})
+
+	t.Run("Auto falls back to UPnP", func(t *testing.T) {
+		ssdp, _ := newUPnPGateway(t, "203.0.113.3")
+		natpmp := newUDPServer(t, func(req []byte) []byte {
+			// Respond with an unsupported opcode error
+			return []byte{0, 128, 0, 5, 0, 0, 0, 0}
+		})
+		c := newClient(t, config.GatewayProtocolAuto, natpmp, ssdp)
+
+		addr, err := c.ExternalIP(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "203.0.113.3", addr.String())
+	})
+
+	t.Run("Private address", func(t *testing.T) {
+		natpmp, _ := newNATPMPServer(t, "100.64.0.1", 0)
+		c := newClient(t, config.GatewayProtocolNATPMP, natpmp, unused)
+		_, err := c.ExternalIP(t.Context())
+		require.NoError(t, err)
+
+		natpmp, _ = newNATPMPServer(t, "192.168.0.2", 0)
+		c = newClient(t, config.GatewayProtocolNATPMP, natpmp, unused)
+		_, err = c.ExternalIP(t.Context())
+		require.ErrorContains(t, err, "gateway returned '192.168.0.2', which is not a public IP address")
+	})
+}
+
+func TestParseNATPMPResponse(t *testing.T) {
+	_, err := parseNATPMPResponse([]byte{0, 128, 0})
+	require.ErrorContains(t, err, "invalid response length: 3")
+
+	_, err = parseNATPMPResponse([]byte{0, 129, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4})
+	require.ErrorContains(t, err, "invalid response: version 0, opcode 129")
+
+	addr, err := parseNATPMPResponse([]byte{0, 128, 0, 0, 0, 0, 0, 0, 203, 0, 113, 4})
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.4", addr.String())
+}
+
+func TestParseDeviceDescription(t *testing.T) {
+	t.Run("URLBase and preferred service", func(t *testing.T) {
+		control, err := parseDeviceDescription(strings.NewReader(`<root>
+  <URLBase>http://192.168.1.1:5000/</URLBase>
+  <device>
+    <serviceList>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:WANPPPConnection:1</serviceType>
+        <controlURL>/ppp</controlURL>
+      </service>
+      <service>
+        <serviceType>urn:schemas-upnp-org:service:WANIPConnection:2</serviceType>
+        <controlURL>ip2</controlURL>
+      </service>
+    </serviceList>
+  </device>
+</root>`), "http://192.168.1.1:1900/rootDesc.xml")
+		require.NoError(t, err)
+		assert.Equal(t, "http://192.168.1.1:5000/ip2", control.url)
+		assert.Equal(t, "urn:schemas-upnp-org:service:WANIPConnection:2", control.serviceType)
+	})
+
+	t.Run("No connection service", func(t *testing.T) {
+		_, err := parseDeviceDescription(strings.NewReader(`<root><device></device></root>`), "http://192.168.1.1/desc.xml")
+		require.ErrorContains(t, err, "gateway does not have a WANIPConnection or WANPPPConnection service")
+	})
+}
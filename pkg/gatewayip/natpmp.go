@@ -0,0 +1,105 @@
+package gatewayip
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Port of the NAT-PMP service on the gateway
+const natpmpPort = 5351
+
+// Initial interval between retries of NAT-PMP requests, which doubles after every attempt (RFC 6886, section 3.1)
+const natpmpInitialRetry = 250 * time.Millisecond
+
+// Result codes returned by NAT-PMP gateways
+var natpmpResultCodes = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized/refused",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// queryNATPMP requests the external address from the gateway using NAT-PMP (RFC 6886)
+func (c *Client) queryNATPMP(ctx context.Context) (netip.Addr, error) {
+	gateway := c.gateway
+	if !gateway.IsValid() {
+		var err error
+		gateway, err = defaultGateway()
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("failed to find the default gateway: %w", err)
+		}
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(reqCtx, "udp4", netip.AddrPortFrom(gateway, c.natpmpPort).String())
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to connect to gateway %s: %w", gateway, err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	// Stop reads when the context is canceled
+	stop := context.AfterFunc(reqCtx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	// Request for the external address: version 0, opcode 0
+	req := []byte{0, 0}
+	res := make([]byte, 16)
+	retry := natpmpInitialRetry
+	for {
+		_, err = conn.Write(req)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("failed to send request to gateway %s: %w", gateway, err)
+		}
+
+		deadline := time.Now().Add(retry)
+		if ctxDeadline, ok := reqCtx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		_ = conn.SetReadDeadline(deadline)
+
+		n, err := conn.Read(res)
+		var netErr net.Error
+		switch {
+		case reqCtx.Err() != nil:
+			return netip.Addr{}, fmt.Errorf("no response from gateway %s: %w", gateway, reqCtx.Err())
+		case errors.As(err, &netErr) && netErr.Timeout():
+			retry *= 2
+			continue
+		case err != nil:
+			return netip.Addr{}, fmt.Errorf("failed to read response from gateway %s: %w", gateway, err)
+		}
+
+		return parseNATPMPResponse(res[:n])
+	}
+}
+
+// parseNATPMPResponse parses the response to a request for the external address
+func parseNATPMPResponse(res []byte) (netip.Addr, error) {
+	// Response format: version (1 byte), opcode (1 byte), result code (2 bytes), seconds since epoch (4 bytes), external address (4 bytes)
+	if len(res) < 12 {
+		return netip.Addr{}, fmt.Errorf("invalid response length: %d", len(res))
+	}
+	if res[0] != 0 || res[1] != 128 {
+		return netip.Addr{}, fmt.Errorf("invalid response: version %d, opcode %d", res[0], res[1])
+	}
+	if code := binary.BigEndian.Uint16(res[2:4]); code != 0 {
+		msg, ok := natpmpResultCodes[code]
+		if !ok {
+			msg = "unknown error"
+		}
+		return netip.Addr{}, fmt.Errorf("gateway returned error %d (%s)", code, msg)
+	}
+
+	return netip.AddrFrom4([4]byte(res[8:12])), nil
+}
@@ -0,0 +1,53 @@
+package gatewayip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// defaultGateway returns the IPv4 address of the default gateway, read from the routing table
+func defaultGateway() (netip.Addr, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to read routing table: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	return parseRouteTable(f)
+}
+
+// parseRouteTable returns the gateway of the default route from the contents of /proc/net/route
+func parseRouteTable(r io.Reader) (netip.Addr, error) {
+	// Columns are: Iface, Destination, Gateway, Flags, ...
+	// Addresses are hex-encoded in host byte order, which is little-endian on all supported architectures
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		var addr [4]byte
+		binary.BigEndian.PutUint32(addr[:], binary.LittleEndian.Uint32(b))
+		if addr == [4]byte{} {
+			continue
+		}
+		return netip.AddrFrom4(addr), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to read routing table: %w", err)
+	}
+
+	return netip.Addr{}, errors.New("no default route found")
+}
@@ -0,0 +1,23 @@
+package gatewayip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRouteTable(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+
+	addr, err := parseRouteTable(strings.NewReader(header +
+		"eth0\t0001A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.1", addr.String())
+
+	_, err = parseRouteTable(strings.NewReader(header +
+		"eth0\t0001A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n"))
+	require.ErrorContains(t, err, "no default route found")
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package gatewayip
+
+import (
+	"errors"
+	"net/netip"
+)
+
+// defaultGateway returns the IPv4 address of the default gateway
+// This is supported on Linux only; on other systems, the address of the gateway must be configured
+func defaultGateway() (netip.Addr, error) {
+	return netip.Addr{}, errors.New("detecting the default gateway is not supported on this system: set the gateway address in the configuration")
+}
@@ -0,0 +1,246 @@
+package gatewayip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Multicast address for SSDP discovery
+const ssdpAddr = "239.255.255.250:1900"
+
+// Search target for Internet Gateway Devices
+const ssdpSearchTarget = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+
+// Service types that can return the external IP address, in order of preference
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnpControl contains the details to invoke actions on the gateway's connection service
+type upnpControl struct {
+	url         string
+	serviceType string
+}
+
+// queryUPnP requests the external address from the gateway using UPnP IGD
+func (c *Client) queryUPnP(ctx context.Context) (netip.Addr, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	// The control URL is discovered once, and then cached
+	// If the request fails, discovery is performed again the next time, in case the gateway changed
+	if c.upnpControl == nil {
+		control, err := c.discoverUPnP(reqCtx)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		c.upnpControl = control
+	}
+
+	addr, err := c.getExternalIPAddress(reqCtx, c.upnpControl)
+	if err != nil {
+		c.upnpControl = nil
+		return netip.Addr{}, err
+	}
+	return addr, nil
+}
+
+// discoverUPnP finds the gateway with SSDP, and returns the control URL of its connection service
+func (c *Client) discoverUPnP(ctx context.Context) (*upnpControl, error) {
+	location, err := c.searchSSDP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for device description: %w", err)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device description: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get device description: invalid response status code HTTP %d", res.StatusCode)
+	}
+
+	return parseDeviceDescription(io.LimitReader(res.Body, 1<<20), location)
+}
+
+// searchSSDP sends a discovery request with SSDP, and returns the location of the description of the first gateway that responds
+func (c *Client) searchSSDP(ctx context.Context) (string, error) {
+	dest, err := net.ResolveUDPAddr("udp4", c.ssdpAddr)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSDP address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to open socket for SSDP discovery: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"ST: " + ssdpSearchTarget + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	_, err = conn.WriteTo([]byte(msg), dest)
+	if err != nil {
+		return "", fmt.Errorf("failed to send SSDP discovery request: %w", err)
+	}
+
+	buf := make([]byte, 4<<10)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("no gateway responded to the SSDP discovery request: %w", ctx.Err())
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read SSDP response: %w", err)
+		}
+
+		// Ignore responses that are not valid
+		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		_ = res.Body.Close()
+		location := res.Header.Get("Location")
+		if res.StatusCode != http.StatusOK || location == "" {
+			continue
+		}
+
+		return location, nil
+	}
+}
+
+// upnpDevice is a device in the description of a UPnP gateway
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// parseDeviceDescription returns the control URL of the connection service from the description of the gateway
+func parseDeviceDescription(r io.Reader, location string) (*upnpControl, error) {
+	var desc struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	err := xml.NewDecoder(r).Decode(&desc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device description: %w", err)
+	}
+
+	// Relative URLs are resolved against URLBase if set, or the location of the description otherwise
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device description location '%s': %w", location, err)
+	}
+	if desc.URLBase != "" {
+		base, err = url.Parse(desc.URLBase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URLBase '%s': %w", desc.URLBase, err)
+		}
+	}
+
+	// Services are nested within devices, so look for them recursively
+	found := map[string]string{}
+	var walk func(d *upnpDevice)
+	walk = func(d *upnpDevice) {
+		for _, s := range d.Services {
+			if _, ok := found[s.ServiceType]; !ok {
+				found[s.ServiceType] = strings.TrimSpace(s.ControlURL)
+			}
+		}
+		for i := range d.Devices {
+			walk(&d.Devices[i])
+		}
+	}
+	walk(&desc.Device)
+
+	for _, st := range upnpServiceTypes {
+		controlURL, ok := found[st]
+		if !ok {
+			continue
+		}
+		u, err := base.Parse(controlURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid control URL '%s': %w", controlURL, err)
+		}
+		return &upnpControl{
+			url:         u.String(),
+			serviceType: st,
+		}, nil
+	}
+
+	return nil, errors.New("gateway does not have a WANIPConnection or WANPPPConnection service")
+}
+
+// getExternalIPAddress invokes the GetExternalIPAddress action on the gateway
+func (c *Client) getExternalIPAddress(ctx context.Context, control *upnpControl) (netip.Addr, error) {
+	body := `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">` +
+		`<s:Body><u:GetExternalIPAddress xmlns:u="` + control.serviceType + `"/></s:Body>` +
+		`</s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, control.url, strings.NewReader(body))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+control.serviceType+`#GetExternalIPAddress"`)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	if res.StatusCode != http.StatusOK {
+		return netip.Addr{}, fmt.Errorf("invalid response status code HTTP %d", res.StatusCode)
+	}
+
+	var envelope struct {
+		Body struct {
+			Response struct {
+				NewExternalIPAddress string `xml:"NewExternalIPAddress"`
+			} `xml:"GetExternalIPAddressResponse"`
+		} `xml:"Body"`
+	}
+	err = xml.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&envelope)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	ip := strings.TrimSpace(envelope.Body.Response.NewExternalIPAddress)
+	if ip == "" {
+		// Some gateways return an empty address when they're not connected
+		return netip.Addr{}, errors.New("gateway did not return an external IP address")
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("gateway returned an invalid IP address '%s': %w", ip, err)
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,202 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+	"github.com/italypaleale/ddup/pkg/logging"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/quorum"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// Agent performs health checks as a remote checker agent, and reports the results to a central instance of ddup, which updates DNS records
+type Agent struct {
+	// Key is domain name
+	domainCheckers map[string]*domainChecker
+	interval       time.Duration
+	reportURL      string
+	token          string
+	timeout        time.Duration
+	httpClient     *http.Client
+}
+
+// NewAgent creates a new Agent, for the domains in the configuration
+func NewAgent(cfg *config.Config, metrics *appmetrics.AppMetrics) (*Agent, error) {
+	if cfg.Agent == nil {
+		return nil, errors.New("the configuration does not contain the 'agent' section")
+	}
+
+	dcs, err := newDomainCheckers(cfg, nil, metrics, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Agent{
+		domainCheckers: dcs,
+		interval:       cfg.Interval,
+		reportURL:      strings.TrimSuffix(cfg.Agent.URL, "/") + quorum.ReportPath,
+		token:          cfg.Agent.Token,
+		timeout:        cfg.Agent.Timeout,
+		httpClient:     tracing.NewHTTPClient(),
+	}, nil
+}
+
+// Run performs health checks on an interval, and reports the results after every cycle, until the context is canceled
+func (a *Agent) Run(ctx context.Context) error {
+	agentLogger().InfoContext(ctx, "Agent started", "interval", a.interval, "domains", len(a.domainCheckers))
+
+	// Run immediately
+	a.checkAndReport(ctx)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			a.checkAndReport(ctx)
+		}
+	}
+}
+
+// checkAndReport performs the health checks for all domains, then reports the results
+func (a *Agent) checkAndReport(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "agent cycle")
+	defer span.End()
+
+	var wg sync.WaitGroup
+	for name, dc := range a.domainCheckers {
+		wg.Go(func() {
+			a.checkDomain(ctx, name, dc)
+		})
+	}
+	wg.Wait()
+
+	// When shutting down, the cycle may not have completed
+	if ctx.Err() != nil {
+		return
+	}
+
+	err := a.report(ctx, observationsOf(a.domainCheckers))
+	if err != nil {
+		agentLogger().ErrorContext(ctx, "Failed to report results to the central instance", "error", err)
+		return
+	}
+	agentLogger().DebugContext(ctx, "Reported results to the central instance")
+}
+
+// checkDomain performs the health checks for a domain, and stores the results
+func (a *Agent) checkDomain(ctx context.Context, domainName string, dc *domainChecker) {
+	domainLog := agentLogger().With("domain", domainName)
+
+	// If the domain uses discovery, refresh the list of endpoints
+	dc.refreshEndpoints(ctx, domainLog)
+
+	results := dc.checker.CheckAll(ctx)
+	ips, err := dc.resolveIPs(ctx, results)
+	if err != nil {
+		domainLog.ErrorContext(ctx, "Error resolving endpoint IPs", "error", err)
+		return
+	}
+
+	lastResults := make(map[string]checker.Result, len(results))
+	for i, result := range results {
+		lastResults[ips[i]] = result
+		if result.Healthy {
+			dc.failures.Resolved(ctx, domainLog, failureKeyEndpoint+ips[i], "✓ Endpoint recovered", "endpoint", result.Endpoint.Name, "ip", ips[i])
+		} else {
+			dc.failures.Log(ctx, domainLog, failureKeyEndpoint+ips[i], slog.LevelWarn, "✗ Endpoint health check failed", "endpoint", result.Endpoint.Name, "ip", ips[i], "error", result.Error)
+		}
+	}
+	dc.setLastResults(lastResults)
+}
+
+// report sends the observations to the central instance
+func (a *Agent) report(ctx context.Context, obs quorum.Observations) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	body, err := json.Marshal(obs)
+	if err != nil {
+		return fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.reportURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.token)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("request failed: status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ReportObservations stores the observations reported by a remote checker agent
+func (hc *HealthChecker) ReportObservations(agent string, obs quorum.Observations) {
+	hc.reports.Set(agent, obs)
+}
+
+// applyAgentReports aggregates the results of the health checks with the observations reported by remote checker agents
+// The result of each endpoint is changed if the majority of vantage points, including this instance, disagree with it
+// It returns the results to use, which are a copy if any result was changed
+func (dc *domainChecker) applyAgentReports(ctx context.Context, log *slog.Logger, domainName string, ips []string, results []checker.Result) []checker.Result {
+	if dc.agentReports == nil {
+		return results
+	}
+
+	res := results
+	var cloned bool
+	for i, result := range results {
+		vote := quorum.NewVote(result.Healthy)
+		dc.agentReports.AddVotes(&vote, domainName, ips[i], dc.agentsMaxAge)
+		if vote.Confirmed() == !result.Healthy {
+			continue
+		}
+
+		// Do not modify the results returned by the checker
+		if !cloned {
+			res = slices.Clone(results)
+			cloned = true
+		}
+		if vote.Confirmed() {
+			res[i].Healthy = false
+			res[i].Degraded = false
+			res[i].Error = fmt.Errorf("endpoint is down for %d of %d vantage points", vote.Down, vote.Voters)
+		} else {
+			res[i].Healthy = true
+			res[i].Error = nil
+		}
+		log.DebugContext(ctx, "Result of the health check changed by remote checker agents", "endpoint", result.Endpoint.Name, "ip", ips[i], "healthy", res[i].Healthy, "down", vote.Down, "voters", vote.Voters)
+	}
+	return res
+}
+
+// agentLogger returns the logger for the agent
+func agentLogger() *slog.Logger {
+	return logging.Component("agent")
+}
@@ -0,0 +1,101 @@
+package healthcheck
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+	"github.com/italypaleale/ddup/pkg/quorum"
+)
+
+func TestAgent(t *testing.T) {
+	var received quorum.Observations
+	central := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, quorum.ReportPath, r.URL.Path)
+		assert.Equal(t, "Bearer agenttoken", r.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer central.Close()
+
+	dc := &domainChecker{
+		checker: &checker.MockChecker{
+			Domain:      "example.com",
+			MaxAttempts: 1,
+			Results: []checker.Result{
+				{Endpoint: &config.ConfigEndpoint{Name: "endpoint1", IP: "1.1.1.1"}, Healthy: true},
+				{Endpoint: &config.ConfigEndpoint{Name: "endpoint2", IP: "2.2.2.2"}, Healthy: false},
+			},
+		},
+		failedIPs: make(map[string]int),
+	}
+	a := &Agent{
+		domainCheckers: map[string]*domainChecker{"example.com": dc},
+		interval:       time.Minute,
+		reportURL:      central.URL + quorum.ReportPath,
+		token:          "agenttoken",
+		timeout:        5 * time.Second,
+		httpClient:     central.Client(),
+	}
+
+	a.checkAndReport(t.Context())
+	require.Contains(t, received, "example.com")
+	assert.Equal(t, map[string]bool{"1.1.1.1": true, "2.2.2.2": false}, received["example.com"].Endpoints)
+	assert.False(t, received["example.com"].CheckedAt.IsZero())
+}
+
+func TestHealthChecker_AgentReports(t *testing.T) {
+	mockProvider := dns.NewMockProvider(false)
+	mockChecker := &checker.MockChecker{
+		Domain:      "example.com",
+		MaxAttempts: 1,
+		Results: []checker.Result{
+			{Endpoint: &config.ConfigEndpoint{Name: "endpoint1", IP: "1.1.1.1"}, Healthy: true},
+			{Endpoint: &config.ConfigEndpoint{Name: "endpoint2", IP: "2.2.2.2"}, Healthy: false},
+		},
+	}
+	reports := quorum.NewReports()
+	dc := &domainChecker{
+		checker:      mockChecker,
+		ttl:          60,
+		failedIPs:    make(map[string]int),
+		provider:     mockProvider,
+		agentReports: reports,
+		agentsMaxAge: time.Minute,
+	}
+	hc := &HealthChecker{
+		domainCheckers: map[string]*domainChecker{"example.com": dc},
+		reports:        reports,
+	}
+
+	// Two agents observe 1.1.1.1 as down and 2.2.2.2 as healthy, so they outvote this instance
+	for _, agent := range []string{"eu", "us"} {
+		hc.ReportObservations(agent, quorum.Observations{
+			"example.com": {CheckedAt: time.Now(), Endpoints: map[string]bool{"1.1.1.1": false, "2.2.2.2": true}},
+		})
+	}
+	hc.checkAndUpdateDNS(t.Context())
+	assert.Equal(t, []string{"2.2.2.2"}, mockProvider.LastIPs[dns.RecordTypeA])
+
+	// The results returned by the checker are not modified
+	assert.True(t, mockChecker.Results[0].Healthy)
+	assert.False(t, mockChecker.Results[1].Healthy)
+
+	// With one agent only, a tie does not make an endpoint unhealthy
+	reports = quorum.NewReports()
+	reports.Set("eu", quorum.Observations{
+		"example.com": {CheckedAt: time.Now(), Endpoints: map[string]bool{"1.1.1.1": false, "2.2.2.2": true}},
+	})
+	dc.agentReports = reports
+	hc.checkAndUpdateDNS(t.Context())
+	assert.Equal(t, []string{"1.1.1.1", "2.2.2.2"}, mockProvider.LastIPs[dns.RecordTypeA])
+}
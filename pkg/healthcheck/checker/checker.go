@@ -1,20 +1,35 @@
 package checker
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"regexp"
+	"slices"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/italypaleale/ddup/pkg/config"
 	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/tracing"
 )
 
 const (
 	DefaultTimeout  = 3 * time.Second
 	DefaultAttempts = 2
+
+	// Maximum number of bytes read from response bodies when matching patterns
+	maxBodySize = 1 << 20
 )
 
 // Checker performs health checks on configured endpoints
@@ -34,22 +49,75 @@ type checker struct {
 	cfg       config.ConfigHealthChecks
 	metrics   *appmetrics.AppMetrics
 	client    *http.Client
+	limiter   *Limiter
+
+	// Clients for endpoints that have custom TLS settings or that follow redirects
+	endpointClients map[*config.ConfigEndpoint]*http.Client
+	// Dialers for endpoints that have a source address, used by checks that use protocols other than HTTP
+	sourceDialers map[*config.ConfigEndpoint]*sourceDialer
+
+	// Patterns for the response body; nil if not configured
+	bodyMatch    *bodyMatcher
+	bodyNotMatch *bodyMatcher
+
+	// Client for the Docker daemon; nil if no endpoint has type "docker"
+	docker *dockerClient
 }
 
 // Result represents the result of a health check
 type Result struct {
 	Endpoint *config.ConfigEndpoint
 	Healthy  bool
+	// If true, the endpoint responded successfully, but its latency exceeded the maximum
+	Degraded bool
 	Error    error
 	Duration time.Duration
 }
 
 // New creates a new health checker
-func New(domain string, endpoints []*config.ConfigEndpoint, healthCheckConfig config.ConfigHealthChecks, metrics *appmetrics.AppMetrics) *checker {
+// The limiter bounds the number of checks performed concurrently, and it can be shared with other checkers; if nil, there's no limit
+func New(domain string, endpoints []*config.ConfigEndpoint, healthCheckConfig config.ConfigHealthChecks, limiter *Limiter, metrics *appmetrics.AppMetrics) (*checker, error) {
 	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+		CheckRedirect: noRedirects,
+	}
+
+	// Endpoints with a host, custom TLS settings, a source address, that follow redirects, or that dial their IP get their own client
+	// The clients, including the shared one, are never modified after they're created, because checks of different endpoints run concurrently
+	endpointClients := make(map[*config.ConfigEndpoint]*http.Client)
+	sourceDialers := make(map[*config.ConfigEndpoint]*sourceDialer)
+	for _, endpoint := range endpoints {
+		// The endpoint's source address overrides the domain's one
+		// Docker endpoints are checked by reading the status from the daemon, so they don't use it
+		var dialer *sourceDialer
+		if !isDockerEndpoint(endpoint) {
+			var err error
+			dialer, err = newSourceDialer(cmp.Or(endpoint.SourceAddress, healthCheckConfig.SourceAddress))
+			if err != nil {
+				return nil, fmt.Errorf("endpoint '%s' has an invalid source address: %w", endpoint.Name, err)
+			}
+			if dialer != nil {
+				sourceDialers[endpoint] = dialer
+			}
+		}
+
+		ec, err := newEndpointClient(endpoint, dialer)
+		if err != nil {
+			return nil, err
+		}
+		if ec != nil {
+			endpointClients[endpoint] = ec
+		}
+	}
+
+	// If there are endpoints with type "docker", create the client for the Docker daemon
+	// The daemon is reached at the address in the DOCKER_HOST environmental variable, or at the default socket
+	var docker *dockerClient
+	if slices.ContainsFunc(endpoints, isDockerEndpoint) {
+		var err error
+		docker, err = newDockerClient(os.Getenv("DOCKER_HOST"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Docker client: %w", err)
+		}
 	}
 
 	// Set default config value
@@ -66,19 +134,153 @@ func New(domain string, endpoints []*config.ConfigEndpoint, healthCheckConfig co
 		cfg:       healthCheckConfig,
 		metrics:   metrics,
 		client:    client,
+		limiter:   limiter,
+
+		endpointClients: endpointClients,
+		sourceDialers:   sourceDialers,
+
+		bodyMatch:    newBodyMatcher(healthCheckConfig.BodyMatch),
+		bodyNotMatch: newBodyMatcher(healthCheckConfig.BodyNotMatch),
+
+		docker: docker,
+	}, nil
+}
+
+// isDockerEndpoint returns true if the endpoint is checked by reading the status of a container from Docker
+func isDockerEndpoint(endpoint *config.ConfigEndpoint) bool {
+	return endpoint.Type == config.EndpointTypeDocker
+}
+
+// newEndpointClient returns the HTTP client for an endpoint that requires its own, or nil if the endpoint can use the shared client
+// If the endpoint has a host set, its client sends it for SNI
+// If dialer is not nil, the client connects from the endpoint's source address
+func newEndpointClient(endpoint *config.ConfigEndpoint, dialer *sourceDialer) (*http.Client, error) {
+	hasTLSSettings := endpoint.SkipTLSVerify || endpoint.CAFile != ""
+	if !hasTLSSettings && endpoint.Host == "" && !endpoint.FollowRedirects && !endpoint.DialIP && dialer == nil {
+		return nil, nil
+	}
+
+	ec := &http.Client{
+		CheckRedirect: noRedirects,
+	}
+
+	if hasTLSSettings || endpoint.Host != "" || endpoint.DialIP || dialer != nil {
+		tlsConfig, err := endpointTLSConfig(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint '%s' has an invalid TLS configuration: %w", endpoint.Name, err)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+		transport.TLSClientConfig = tlsConfig
+		switch {
+		case endpoint.DialIP:
+			// Connections are made to the endpoint's IP, even if the URL contains a hostname, so proxies are not used
+			transport.Proxy = nil
+			transport.DialContext = dialIP(endpoint.IP, dialer.DialContext)
+		case dialer != nil:
+			transport.DialContext = dialer.DialContext
+		}
+		ec.Transport = transport
+	}
+
+	if endpoint.FollowRedirects {
+		ec.CheckRedirect = limitRedirects(endpoint.MaxRedirects)
+	}
+
+	return ec, nil
+}
+
+// dialIP returns a DialContext function that connects to the IP with dial, on the port of the address that is requested
+// The hostname in the request is still used for the Host header and for SNI
+func dialIP(ip string, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		return dial(ctx, network, net.JoinHostPort(ip, port))
+	}
+}
+
+// noRedirects is a CheckRedirect function that prevents following redirects
+func noRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// limitRedirects returns a CheckRedirect function that follows up to maxRedirects redirects
+func limitRedirects(maxRedirects int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+}
+
+// endpointTLSConfig returns the TLS configuration for an endpoint with custom TLS settings
+// If the endpoint has a host set, it's used for SNI, so the transport doesn't need to be changed for each request
+func endpointTLSConfig(endpoint *config.ConfigEndpoint) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: endpoint.Host,
+	}
+
+	if endpoint.SkipTLSVerify {
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec
+	}
+
+	if endpoint.CAFile != "" {
+		pem, err := os.ReadFile(endpoint.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file '%s': %w", endpoint.CAFile, err)
+		}
+
+		// Trust the CA in addition to the system's root CAs
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file '%s' does not contain any valid PEM-encoded certificate", endpoint.CAFile)
+		}
+		tlsConfig.RootCAs = pool
 	}
+
+	return tlsConfig, nil
 }
 
 // CheckAll performs health checks on all configured endpoints concurrently
+// The number of checks running at the same time is bounded by the limiter
 func (c *checker) CheckAll(ctx context.Context) []Result {
 	var wg sync.WaitGroup
 	results := make([]Result, len(c.endpoints))
 
 	for i, endpoint := range c.endpoints {
+		// Wait for a slot before starting the goroutine, so the number of goroutines is bounded too
+		if !c.limiter.acquire(ctx) {
+			results[i] = Result{
+				Endpoint: endpoint,
+				Healthy:  false,
+				Error:    fmt.Errorf("health check not started: %w", ctx.Err()),
+			}
+			continue
+		}
+
 		wg.Add(1)
 		go func(i int, endpoint *config.ConfigEndpoint) {
 			defer wg.Done()
+			defer c.limiter.release()
+
+			ctx, span := tracing.Tracer().Start(ctx, "check endpoint",
+				trace.WithAttributes(
+					attribute.String("dns.domain", c.domain),
+					attribute.String("endpoint.name", endpoint.Name),
+					attribute.String("endpoint.ip", endpoint.IP),
+				),
+			)
 			results[i] = c.checkEndpoint(ctx, endpoint)
+			span.SetAttributes(attribute.Bool("endpoint.healthy", results[i].Healthy))
+			tracing.EndSpan(span, results[i].Error)
 
 			if c.metrics != nil {
 				c.metrics.RecordHealthCheck(c.domain, endpoint.Name, results[i].Healthy)
@@ -102,6 +304,17 @@ func (c *checker) GetMaxAttempts() int {
 
 // checkEndpoint performs a health check on a single endpoint
 func (c *checker) checkEndpoint(ctx context.Context, endpoint *config.ConfigEndpoint) Result {
+	// Endpoints with type "docker" are checked by reading the status of the container
+	if isDockerEndpoint(endpoint) && c.docker != nil {
+		return c.checkProtocolEndpoint(ctx, endpoint, c.docker.check)
+	}
+
+	// Endpoints with schemes such as "ssh" or "postgres" are checked with the corresponding protocol rather than HTTP
+	fn := getProtocolChecker(endpoint)
+	if fn != nil {
+		return c.checkProtocolEndpoint(ctx, endpoint, fn)
+	}
+
 	start := time.Now()
 
 	// Create a context with timeout for this specific endpoint
@@ -122,36 +335,25 @@ func (c *checker) checkEndpoint(ctx context.Context, endpoint *config.ConfigEndp
 	// Set user agent
 	req.Header.Set("User-Agent", "ddup/1.0")
 
+	// Set custom headers and credentials, if any
+	for k, v := range endpoint.Headers {
+		req.Header.Set(k, v)
+	}
+	if endpoint.BasicAuth != nil {
+		req.SetBasicAuth(endpoint.BasicAuth.Username, endpoint.BasicAuth.Password)
+	}
+
 	// If there's a specific host, we need to set it in the request's host
-	// For TLS requests, we set it the TLS client for SNI in the TLS handshake to work too
-	client := c.client
+	// For TLS requests, the endpoint's client already has the host set for SNI
 	if endpoint.Host != "" {
 		req.Host = endpoint.Host
+	}
 
-		if req.URL.Scheme == "https" {
-			var transport *http.Transport
-			if client.Transport != nil {
-				var ok bool
-				transport, ok = client.Transport.(*http.Transport)
-				if !ok || transport.TLSClientConfig == nil {
-					transport.TLSClientConfig = &tls.Config{
-						MinVersion: tls.VersionTLS12,
-					}
-				} else {
-					transport = transport.Clone()
-				}
-
-				transport.TLSClientConfig.ServerName = endpoint.Host
-			} else {
-				transport = &http.Transport{
-					TLSClientConfig: &tls.Config{
-						MinVersion: tls.VersionTLS12,
-						ServerName: endpoint.Host,
-					},
-				}
-			}
-			client.Transport = transport
-		}
+	// Clients are shared by concurrent checks, so they must not be modified here
+	client := c.client
+	ec, ok := c.endpointClients[endpoint]
+	if ok {
+		client = ec
 	}
 
 	// Perform the request
@@ -164,7 +366,7 @@ func (c *checker) checkEndpoint(ctx context.Context, endpoint *config.ConfigEndp
 			Duration: time.Since(start),
 		}
 	}
-	_ = resp.Body.Close() //nolint:errcheck
+	defer resp.Body.Close() //nolint:errcheck
 
 	// Check if status code indicates health
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
@@ -176,10 +378,97 @@ func (c *checker) checkEndpoint(ctx context.Context, endpoint *config.ConfigEndp
 		}
 	}
 
+	// Check the response body, if needed
+	err = c.checkBody(resp.Body)
+	if err != nil {
+		return Result{
+			Endpoint: endpoint,
+			Healthy:  false,
+			Error:    err,
+			Duration: time.Since(start),
+		}
+	}
+
+	// Check the latency, if needed
+	duration := time.Since(start)
+	err = checkLatency(endpoint, duration)
+	if err != nil {
+		return Result{
+			Endpoint: endpoint,
+			Healthy:  false,
+			Degraded: true,
+			Error:    err,
+			Duration: duration,
+		}
+	}
+
 	return Result{
 		Endpoint: endpoint,
 		Healthy:  true,
 		Error:    nil,
-		Duration: time.Since(start),
+		Duration: duration,
+	}
+}
+
+// checkLatency returns an error if the duration of the check exceeds the endpoint's maximum latency
+func checkLatency(endpoint *config.ConfigEndpoint, duration time.Duration) error {
+	if endpoint.MaxLatency > 0 && duration > endpoint.MaxLatency {
+		return fmt.Errorf("latency %v exceeds the maximum of %v", duration.Round(time.Millisecond), endpoint.MaxLatency)
+	}
+	return nil
+}
+
+// checkBody checks the response body against the configured patterns
+// It returns an error if the body doesn't satisfy the patterns
+func (c *checker) checkBody(body io.Reader) error {
+	if c.bodyMatch == nil && c.bodyNotMatch == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+
+	if c.bodyMatch != nil && !c.bodyMatch.Match(data) {
+		return fmt.Errorf("response body does not match '%s'", c.bodyMatch.pattern)
+	}
+	if c.bodyNotMatch != nil && c.bodyNotMatch.Match(data) {
+		return fmt.Errorf("response body matches '%s'", c.bodyNotMatch.pattern)
+	}
+
+	return nil
+}
+
+// bodyMatcher matches response bodies against a substring or a regular expression
+type bodyMatcher struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// newBodyMatcher returns a bodyMatcher for the pattern, or nil if the pattern is empty
+func newBodyMatcher(pattern config.BodyPattern) *bodyMatcher {
+	if pattern == "" {
+		return nil
+	}
+
+	// Patterns are validated when the configuration is loaded
+	// If the regular expression is invalid nonetheless, the pattern is matched as a substring
+	re, err := pattern.Regexp()
+	if err != nil {
+		re = nil
+	}
+
+	return &bodyMatcher{
+		pattern: string(pattern),
+		re:      re,
+	}
+}
+
+// Match returns true if the body matches the pattern
+func (m *bodyMatcher) Match(body []byte) bool {
+	if m.re != nil {
+		return m.re.Match(body)
 	}
+	return bytes.Contains(body, []byte(m.pattern))
 }
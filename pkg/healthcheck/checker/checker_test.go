@@ -2,8 +2,20 @@ package checker
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/pem"
 	"errors"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -383,3 +395,431 @@ func TestCheckEndpoint_SuccessStatusCodes(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckEndpoint_BodyMatch(t *testing.T) {
+	testCases := []struct {
+		name         string
+		body         string
+		bodyMatch    config.BodyPattern
+		bodyNotMatch config.BodyPattern
+		shouldPass   bool
+		errContains  string
+	}{
+		{name: "No patterns", body: "anything", shouldPass: true},
+		{name: "Substring matches", body: `{"status":"ok"}`, bodyMatch: `"status":"ok"`, shouldPass: true},
+		{name: "Substring does not match", body: `{"status":"degraded"}`, bodyMatch: `"status":"ok"`, errContains: "does not match"},
+		{name: "Regex matches", body: "status: ok", bodyMatch: "/^status: (ok|healthy)$/", shouldPass: true},
+		{name: "Regex does not match", body: "status: down", bodyMatch: "/^status: (ok|healthy)$/", errContains: "does not match"},
+		{name: "Case-insensitive regex", body: "STATUS OK", bodyMatch: "/status ok/i", shouldPass: true},
+		{name: "Not-match substring found", body: "Site in maintenance mode", bodyNotMatch: "maintenance mode", errContains: "matches 'maintenance mode'"},
+		{name: "Not-match substring not found", body: "all good", bodyNotMatch: "maintenance mode", shouldPass: true},
+		{name: "Not-match regex found", body: "MAINTENANCE", bodyNotMatch: "/maintenance/i", errContains: "matches"},
+		{name: "Both patterns", body: "ok, maintenance mode", bodyMatch: "ok", bodyNotMatch: "maintenance", errContains: "matches 'maintenance'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRT := &MockRoundTripper{
+				RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     make(http.Header),
+						Body:       io.NopCloser(strings.NewReader(tc.body)),
+					}, nil
+				},
+			}
+
+			checker := newTestChecker(&http.Client{Transport: mockRT})
+			checker.bodyMatch = newBodyMatcher(tc.bodyMatch)
+			checker.bodyNotMatch = newBodyMatcher(tc.bodyNotMatch)
+
+			endpoint := &config.ConfigEndpoint{
+				Name: "test-endpoint",
+				URL:  "http://example.com/health",
+				IP:   "1.1.1.1",
+			}
+
+			result := checker.checkEndpoint(t.Context(), endpoint)
+
+			if tc.shouldPass {
+				assert.True(t, result.Healthy)
+				require.NoError(t, result.Error)
+			} else {
+				assert.False(t, result.Healthy)
+				require.Error(t, result.Error)
+				assert.Contains(t, result.Error.Error(), tc.errContains)
+			}
+		})
+	}
+}
+
+func TestCheckEndpoint_HeadersAndBasicAuth(t *testing.T) {
+	mockRT := &MockRoundTripper{
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+		},
+	}
+
+	checker := newTestChecker(&http.Client{Transport: mockRT})
+
+	t.Run("Custom headers", func(t *testing.T) {
+		endpoint := &config.ConfigEndpoint{
+			Name: "test-endpoint",
+			URL:  "http://example.com/health",
+			IP:   "1.1.1.1",
+			Headers: map[string]string{
+				"X-API-Key":  "secret",
+				"User-Agent": "custom/1.0",
+			},
+		}
+
+		result := checker.checkEndpoint(t.Context(), endpoint)
+		require.NoError(t, result.Error)
+		assert.True(t, result.Healthy)
+
+		require.NotNil(t, mockRT.CapturedRequest)
+		assert.Equal(t, "secret", mockRT.CapturedRequest.Header.Get("X-API-Key"))
+		assert.Equal(t, "custom/1.0", mockRT.CapturedRequest.Header.Get("User-Agent"))
+		_, _, ok := mockRT.CapturedRequest.BasicAuth()
+		assert.False(t, ok, "Basic auth should not be set")
+	})
+
+	t.Run("Basic auth", func(t *testing.T) {
+		endpoint := &config.ConfigEndpoint{
+			Name: "test-endpoint",
+			URL:  "http://example.com/health",
+			IP:   "1.1.1.1",
+			BasicAuth: &config.ConfigBasicAuth{
+				Username: "user",
+				Password: "pass",
+			},
+		}
+
+		result := checker.checkEndpoint(t.Context(), endpoint)
+		require.NoError(t, result.Error)
+		assert.True(t, result.Healthy)
+
+		require.NotNil(t, mockRT.CapturedRequest)
+		username, password, ok := mockRT.CapturedRequest.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+		assert.Equal(t, "ddup/1.0", mockRT.CapturedRequest.Header.Get("User-Agent"))
+	})
+}
+
+func TestCheckEndpoint_TLSSettings(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// Write the server's certificate to a file, to use as CA
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	testCases := []struct {
+		name       string
+		endpoint   *config.ConfigEndpoint
+		shouldPass bool
+	}{
+		{
+			name:       "Untrusted certificate",
+			endpoint:   &config.ConfigEndpoint{Name: "default", URL: srv.URL, IP: "127.0.0.1"},
+			shouldPass: false,
+		},
+		{
+			name:       "skipTLSVerify",
+			endpoint:   &config.ConfigEndpoint{Name: "skip", URL: srv.URL, IP: "127.0.0.1", SkipTLSVerify: true},
+			shouldPass: true,
+		},
+		{
+			name:       "caFile",
+			endpoint:   &config.ConfigEndpoint{Name: "ca", URL: srv.URL, IP: "127.0.0.1", CAFile: caFile},
+			shouldPass: true,
+		},
+		{
+			name:       "caFile with custom host",
+			endpoint:   &config.ConfigEndpoint{Name: "ca-host", URL: srv.URL, IP: "127.0.0.1", Host: "example.com", CAFile: caFile},
+			shouldPass: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New("test.example.com", []*config.ConfigEndpoint{tc.endpoint}, config.ConfigHealthChecks{}, nil, nil)
+			require.NoError(t, err)
+
+			result := c.checkEndpoint(t.Context(), tc.endpoint)
+			if tc.shouldPass {
+				require.NoError(t, result.Error)
+				assert.True(t, result.Healthy)
+			} else {
+				require.Error(t, result.Error)
+				assert.False(t, result.Healthy)
+			}
+		})
+	}
+
+	t.Run("Endpoint client is not modified by checks", func(t *testing.T) {
+		endpoint := &config.ConfigEndpoint{Name: "ca-host", URL: srv.URL, IP: "127.0.0.1", Host: "example.com", CAFile: caFile}
+		c, err := New("test.example.com", []*config.ConfigEndpoint{endpoint}, config.ConfigHealthChecks{}, nil, nil)
+		require.NoError(t, err)
+
+		transport := c.endpointClients[endpoint].Transport
+		require.NotNil(t, transport)
+		for range 3 {
+			result := c.checkEndpoint(t.Context(), endpoint)
+			require.NoError(t, result.Error)
+		}
+		assert.Same(t, transport, c.endpointClients[endpoint].Transport)
+	})
+
+	t.Run("Invalid CA file", func(t *testing.T) {
+		invalidFile := filepath.Join(t.TempDir(), "invalid.pem")
+		require.NoError(t, os.WriteFile(invalidFile, []byte("not a certificate"), 0o600))
+
+		_, err := New("test.example.com", []*config.ConfigEndpoint{
+			{Name: "invalid", URL: srv.URL, IP: "127.0.0.1", CAFile: invalidFile},
+		}, config.ConfigHealthChecks{}, nil, nil)
+		require.ErrorContains(t, err, "does not contain any valid PEM-encoded certificate")
+
+		_, err = New("test.example.com", []*config.ConfigEndpoint{
+			{Name: "missing", URL: srv.URL, IP: "127.0.0.1", CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		}, config.ConfigHealthChecks{}, nil, nil)
+		require.ErrorContains(t, err, "failed to read CA file")
+	})
+}
+
+func TestCheckEndpoint_DialIP(t *testing.T) {
+	// Records the Host header and the SNI of the requests received by the servers
+	var host, serverName string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		if r.TLS != nil {
+			serverName = r.TLS.ServerName
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+		require.NoError(t, err)
+
+		// The hostname doesn't resolve, so the check succeeds only if the connection is made to the IP
+		endpoint := &config.ConfigEndpoint{Name: "dial", URL: "http://app.invalid:" + port + "/health", IP: "127.0.0.1", DialIP: true}
+		c, err := New("test.example.com", []*config.ConfigEndpoint{endpoint}, config.ConfigHealthChecks{}, nil, nil)
+		require.NoError(t, err)
+
+		result := c.checkEndpoint(t.Context(), endpoint)
+		require.NoError(t, result.Error)
+		assert.True(t, result.Healthy)
+		assert.Equal(t, "app.invalid:"+port, host)
+	})
+
+	t.Run("HTTPS", func(t *testing.T) {
+		srv := httptest.NewTLSServer(handler)
+		defer srv.Close()
+		_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+		require.NoError(t, err)
+
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+		require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+		// The certificate of the test server is valid for example.com, which is sent for SNI, and is verified
+		endpoint := &config.ConfigEndpoint{Name: "dial", URL: "https://example.com:" + port + "/health", IP: "127.0.0.1", DialIP: true, CAFile: caFile}
+		c, err := New("test.example.com", []*config.ConfigEndpoint{endpoint}, config.ConfigHealthChecks{}, nil, nil)
+		require.NoError(t, err)
+
+		result := c.checkEndpoint(t.Context(), endpoint)
+		require.NoError(t, result.Error)
+		assert.True(t, result.Healthy)
+		assert.Equal(t, "example.com:"+port, host)
+		assert.Equal(t, "example.com", serverName)
+	})
+}
+
+func TestCheckEndpoint_SourceAddress(t *testing.T) {
+	// Records the address that each request comes from
+	var mu sync.Mutex
+	remoteIPs := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		mu.Lock()
+		remoteIPs[r.URL.Path] = ip
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// The whole 127.0.0.0/8 network is assigned to the loopback interface on Linux
+	endpoints := []*config.ConfigEndpoint{
+		{Name: "endpoint", URL: srv.URL + "/endpoint", IP: "127.0.0.1", SourceAddress: "127.0.0.2"},
+		{Name: "domain", URL: srv.URL + "/domain", IP: "127.0.0.1"},
+		{Name: "interface", URL: srv.URL + "/interface", IP: "127.0.0.1", SourceAddress: "interface:ddup-invalid0"},
+	}
+	c, err := New("test.example.com", endpoints, config.ConfigHealthChecks{SourceAddress: "127.0.0.3"}, nil, nil)
+	require.NoError(t, err)
+
+	results := c.CheckAll(t.Context())
+	require.Len(t, results, 3)
+	require.NoError(t, results[0].Error)
+	require.NoError(t, results[1].Error)
+	require.ErrorContains(t, results[2].Error, "failed to get the source address")
+
+	assert.Equal(t, "127.0.0.2", remoteIPs["/endpoint"])
+	assert.Equal(t, "127.0.0.3", remoteIPs["/domain"])
+	assert.NotContains(t, remoteIPs, "/interface")
+}
+
+func TestCheckAll_ConcurrentEndpointsWithHost(t *testing.T) {
+	// Count the TLS handshakes that use the endpoints' host for SNI
+	var sniCount atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if hello.ServerName == "example.com" {
+				sniCount.Add(1)
+			}
+			return nil, nil
+		},
+	}
+	// Handshakes fail because the certificate is not trusted, which would be logged
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	// Endpoints that have a host but no TLS settings are checked concurrently
+	// This must be run with -race, to detect if the checks modify clients that are shared
+	endpoints := make([]*config.ConfigEndpoint, 20)
+	for i := range endpoints {
+		endpoints[i] = &config.ConfigEndpoint{Name: "endpoint" + strconv.Itoa(i), URL: srv.URL, IP: "127.0.0.1", Host: "example.com"}
+	}
+	c, err := New("test.example.com", endpoints, config.ConfigHealthChecks{}, nil, nil)
+	require.NoError(t, err)
+
+	for range 3 {
+		results := c.CheckAll(t.Context())
+		require.Len(t, results, len(endpoints))
+		for _, result := range results {
+			// The certificate of the test server is not trusted
+			require.Error(t, result.Error)
+		}
+	}
+
+	// Each endpoint has its own client, configured for SNI, and the shared client is not modified
+	assert.Nil(t, c.client.Transport)
+	for _, endpoint := range endpoints {
+		ec := c.endpointClients[endpoint]
+		require.NotNil(t, ec)
+		transport, ok := ec.Transport.(*http.Transport)
+		require.True(t, ok)
+		assert.Equal(t, "example.com", transport.TLSClientConfig.ServerName)
+	}
+	assert.GreaterOrEqual(t, sniCount.Load(), int32(3*len(endpoints)))
+}
+
+func TestCheckEndpoint_FollowRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/health", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	testCases := []struct {
+		name        string
+		endpoint    *config.ConfigEndpoint
+		shouldPass  bool
+		errContains string
+	}{
+		{
+			name:        "Redirects not followed by default",
+			endpoint:    &config.ConfigEndpoint{Name: "default", URL: srv.URL + "/redirect", IP: "127.0.0.1"},
+			errContains: "status code 302",
+		},
+		{
+			name:       "Redirects followed",
+			endpoint:   &config.ConfigEndpoint{Name: "follow", URL: srv.URL + "/redirect", IP: "127.0.0.1", FollowRedirects: true, MaxRedirects: 10},
+			shouldPass: true,
+		},
+		{
+			name:        "Too many redirects",
+			endpoint:    &config.ConfigEndpoint{Name: "loop", URL: srv.URL + "/loop", IP: "127.0.0.1", FollowRedirects: true, MaxRedirects: 3},
+			errContains: "stopped after 3 redirects",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := New("test.example.com", []*config.ConfigEndpoint{tc.endpoint}, config.ConfigHealthChecks{}, nil, nil)
+			require.NoError(t, err)
+
+			result := c.checkEndpoint(t.Context(), tc.endpoint)
+			if tc.shouldPass {
+				require.NoError(t, result.Error)
+				assert.True(t, result.Healthy)
+			} else {
+				require.ErrorContains(t, result.Error, tc.errContains)
+				assert.False(t, result.Healthy)
+			}
+		})
+	}
+}
+
+func TestCheckEndpoint_MaxLatency(t *testing.T) {
+	mockRT := &MockRoundTripper{
+		RoundTripFunc: func(req *http.Request) (*http.Response, error) {
+			time.Sleep(50 * time.Millisecond)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       http.NoBody,
+			}, nil
+		},
+	}
+	checker := newTestChecker(&http.Client{Transport: mockRT})
+
+	t.Run("Latency exceeds the maximum", func(t *testing.T) {
+		endpoint := &config.ConfigEndpoint{
+			Name:       "slow",
+			URL:        "http://example.com/health",
+			IP:         "1.1.1.1",
+			MaxLatency: 10 * time.Millisecond,
+		}
+
+		result := checker.checkEndpoint(t.Context(), endpoint)
+		assert.False(t, result.Healthy)
+		assert.True(t, result.Degraded)
+		require.ErrorContains(t, result.Error, "exceeds the maximum of 10ms")
+		assert.GreaterOrEqual(t, result.Duration, 50*time.Millisecond)
+	})
+
+	t.Run("Latency within the maximum", func(t *testing.T) {
+		endpoint := &config.ConfigEndpoint{
+			Name:       "fast-enough",
+			URL:        "http://example.com/health",
+			IP:         "1.1.1.1",
+			MaxLatency: 2 * time.Second,
+		}
+
+		result := checker.checkEndpoint(t.Context(), endpoint)
+		require.NoError(t, result.Error)
+		assert.True(t, result.Healthy)
+		assert.False(t, result.Degraded)
+	})
+}
@@ -0,0 +1,126 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+const (
+	// Address of the Docker daemon when DOCKER_HOST is not set
+	defaultDockerHost = "unix:///var/run/docker.sock"
+	// Version of the Docker Engine API used for requests, which is supported by Docker 17.06 and newer
+	dockerAPIVersion = "v1.30"
+)
+
+// dockerContainer contains the properties of a container returned by the Docker Engine API that are relevant for health checks
+type dockerContainer struct {
+	State struct {
+		Status string `json:"Status"`
+		Health *struct {
+			Status string `json:"Status"`
+			Log    []struct {
+				ExitCode int    `json:"ExitCode"`
+				Output   string `json:"Output"`
+			} `json:"Log"`
+		} `json:"Health"`
+	} `json:"State"`
+}
+
+// dockerClient reads the state of containers from the Docker Engine API
+type dockerClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// newDockerClient returns a client that connects to the Docker daemon at the given address
+// Supported addresses are "unix://<path>" and "tcp://<host>:<port>"; TLS is not supported
+// If the address is empty, the default socket is used
+func newDockerClient(host string) (*dockerClient, error) {
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	scheme, addr, ok := strings.Cut(host, "://")
+	if !ok || addr == "" {
+		return nil, fmt.Errorf("invalid Docker host '%s'", host)
+	}
+
+	switch scheme {
+	case "unix":
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", addr)
+			},
+		}
+		// The host in the URL is ignored when connecting over a socket
+		return &dockerClient{
+			client:  &http.Client{Transport: transport},
+			baseURL: "http://docker",
+		}, nil
+	case "tcp":
+		return &dockerClient{
+			client:  &http.Client{},
+			baseURL: "http://" + strings.TrimSuffix(addr, "/"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Docker host '%s': scheme must be 'unix' or 'tcp'", host)
+	}
+}
+
+// check reads the state of the endpoint's container from the Docker Engine API
+// The container is healthy if its HEALTHCHECK reports it as healthy; containers without a HEALTHCHECK are healthy if they're running.
+// Docker endpoints don't have a source address, so the dialer is not used.
+func (d *dockerClient) check(ctx context.Context, endpoint *config.ConfigEndpoint, _ *sourceDialer) error {
+	container := endpoint.Container
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"/"+dockerAPIVersion+"/containers/"+url.PathEscape(container)+"/json", nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	res, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to Docker failed: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// All good
+	case http.StatusNotFound:
+		return fmt.Errorf("container '%s' not found", container)
+	default:
+		return fmt.Errorf("request to Docker failed: status code %d", res.StatusCode)
+	}
+
+	var c dockerContainer
+	err = json.NewDecoder(io.LimitReader(res.Body, maxBodySize)).Decode(&c)
+	if err != nil {
+		return fmt.Errorf("failed to parse response from Docker: %w", err)
+	}
+
+	if c.State.Status != "running" {
+		return fmt.Errorf("container '%s' is not running: status is '%s'", container, c.State.Status)
+	}
+	if c.State.Health == nil {
+		// The container doesn't have a HEALTHCHECK
+		return nil
+	}
+	if c.State.Health.Status != "healthy" {
+		// Include the output of the last health check, which usually explains the failure
+		if n := len(c.State.Health.Log); n > 0 && c.State.Health.Log[n-1].ExitCode != 0 {
+			return fmt.Errorf("container '%s' is %s: %s", container, c.State.Health.Status, strings.TrimSpace(c.State.Health.Log[n-1].Output))
+		}
+		return fmt.Errorf("container '%s' is %s", container, c.State.Health.Status)
+	}
+
+	return nil
+}
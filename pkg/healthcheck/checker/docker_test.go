@@ -0,0 +1,113 @@
+package checker
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// startTestDockerDaemon starts a server on a Unix socket that responds to requests for containers with the given JSON documents
+// It sets DOCKER_HOST to the address of the server
+func startTestDockerDaemon(t *testing.T, containers map[string]string) {
+	t.Helper()
+
+	// Paths of Unix sockets have a limited length, so they're not created in the test's temporary directory
+	dir, err := os.MkdirTemp("", "ddup")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	sock := filepath.Join(dir, "docker.sock")
+
+	ln, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.30/containers/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		c, ok := containers[r.PathValue("name")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No such container"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(c))
+	})
+	srv := &http.Server{Handler: mux} //nolint:gosec
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	t.Setenv("DOCKER_HOST", "unix://"+sock)
+}
+
+func TestCheckDocker(t *testing.T) {
+	startTestDockerDaemon(t, map[string]string{
+		"healthy":   `{"State":{"Status":"running","Health":{"Status":"healthy"}}}`,
+		"unhealthy": `{"State":{"Status":"running","Health":{"Status":"unhealthy","Log":[{"ExitCode":0,"Output":"ok"},{"ExitCode":1,"Output":"curl: (7) Failed to connect\n"}]}}}`,
+		"starting":  `{"State":{"Status":"running","Health":{"Status":"starting"}}}`,
+		"nohealth":  `{"State":{"Status":"running"}}`,
+		"exited":    `{"State":{"Status":"exited","Health":{"Status":"unhealthy"}}}`,
+	})
+
+	check := func(container string) error {
+		d, err := newDockerClient(os.Getenv("DOCKER_HOST"))
+		if err != nil {
+			return err
+		}
+		return d.check(t.Context(), &config.ConfigEndpoint{Type: config.EndpointTypeDocker, Container: container}, nil)
+	}
+
+	t.Run("Healthy", func(t *testing.T) {
+		require.NoError(t, check("healthy"))
+	})
+
+	t.Run("Unhealthy", func(t *testing.T) {
+		require.EqualError(t, check("unhealthy"), "container 'unhealthy' is unhealthy: curl: (7) Failed to connect")
+	})
+
+	t.Run("Starting", func(t *testing.T) {
+		require.EqualError(t, check("starting"), "container 'starting' is starting")
+	})
+
+	t.Run("Without HEALTHCHECK", func(t *testing.T) {
+		require.NoError(t, check("nohealth"))
+	})
+
+	t.Run("Not running", func(t *testing.T) {
+		require.EqualError(t, check("exited"), "container 'exited' is not running: status is 'exited'")
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		require.EqualError(t, check("missing"), "container 'missing' not found")
+	})
+
+	t.Run("Unsupported Docker host", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "ssh://user@host")
+		require.ErrorContains(t, check("healthy"), "unsupported Docker host 'ssh://user@host'")
+
+		_, err := New("test.example.com", []*config.ConfigEndpoint{
+			{Name: "docker", Type: config.EndpointTypeDocker, Container: "healthy", IP: "127.0.0.1"},
+		}, config.ConfigHealthChecks{}, nil, nil)
+		require.ErrorContains(t, err, "failed to create Docker client")
+	})
+
+	t.Run("Checker", func(t *testing.T) {
+		endpoint := &config.ConfigEndpoint{Name: "docker", Type: config.EndpointTypeDocker, Container: "healthy", IP: "127.0.0.1"}
+		c, err := New("test.example.com", []*config.ConfigEndpoint{endpoint}, config.ConfigHealthChecks{}, nil, nil)
+		require.NoError(t, err)
+
+		result := c.checkEndpoint(t.Context(), endpoint)
+		require.NoError(t, result.Error)
+		require.True(t, result.Healthy)
+	})
+}
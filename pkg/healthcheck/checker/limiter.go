@@ -0,0 +1,50 @@
+package checker
+
+import (
+	"context"
+)
+
+// DefaultConcurrency is the default maximum number of health checks performed concurrently
+const DefaultConcurrency = 32
+
+// Limiter bounds the number of health checks that are performed concurrently
+// A Limiter can be shared by multiple checkers, so the limit applies across all domains
+// A nil Limiter does not impose any limit
+type Limiter struct {
+	sem chan struct{}
+}
+
+// NewLimiter returns a Limiter that allows up to n concurrent health checks
+// If n is zero or negative, DefaultConcurrency is used
+func NewLimiter(n int) *Limiter {
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	return &Limiter{
+		sem: make(chan struct{}, n),
+	}
+}
+
+// acquire blocks until a slot is available
+// It returns false if the context is canceled first
+func (l *Limiter) acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release returns a slot that was acquired
+func (l *Limiter) release() {
+	if l == nil {
+		return
+	}
+
+	<-l.sem
+}
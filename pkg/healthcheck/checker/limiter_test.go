@@ -0,0 +1,122 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// roundTripperFunc is a http.RoundTripper that invokes a function, and is safe for concurrent use
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("Default size", func(t *testing.T) {
+		assert.Equal(t, DefaultConcurrency, cap(NewLimiter(0).sem))
+		assert.Equal(t, 4, cap(NewLimiter(4).sem))
+	})
+
+	t.Run("Nil limiter does not block", func(t *testing.T) {
+		var l *Limiter
+		for range 100 {
+			require.True(t, l.acquire(t.Context()))
+		}
+		l.release()
+	})
+
+	t.Run("Blocks until a slot is released", func(t *testing.T) {
+		l := NewLimiter(1)
+		require.True(t, l.acquire(t.Context()))
+
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		require.False(t, l.acquire(ctx))
+
+		l.release()
+		require.True(t, l.acquire(t.Context()))
+	})
+}
+
+func TestCheckAll_Concurrency(t *testing.T) {
+	const (
+		limit     = 3
+		endpoints = 20
+	)
+
+	var running, maxRunning atomic.Int32
+	client := &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	}
+
+	// Two checkers share the same limiter
+	limiter := NewLimiter(limit)
+	newChecker := func() *checker {
+		c := newTestChecker(client)
+		c.limiter = limiter
+		for i := range endpoints {
+			c.endpoints = append(c.endpoints, &config.ConfigEndpoint{
+				Name: "endpoint" + strconv.Itoa(i),
+				URL:  "http://10.0.0.1/health",
+				IP:   "10.0.0.1",
+			})
+		}
+		return c
+	}
+	c1, c2 := newChecker(), newChecker()
+
+	done := make(chan []Result, 2)
+	go func() { done <- c1.CheckAll(t.Context()) }()
+	go func() { done <- c2.CheckAll(t.Context()) }()
+
+	for range 2 {
+		results := <-done
+		require.Len(t, results, endpoints)
+		for _, r := range results {
+			require.NoError(t, r.Error)
+			assert.True(t, r.Healthy)
+		}
+	}
+
+	assert.LessOrEqual(t, maxRunning.Load(), int32(limit))
+	assert.Positive(t, maxRunning.Load())
+
+	t.Run("Canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		// Fill the limiter so no check can start
+		full := NewLimiter(1)
+		require.True(t, full.acquire(t.Context()))
+		c := newChecker()
+		c.limiter = full
+
+		results := c.CheckAll(ctx)
+		require.Len(t, results, endpoints)
+		for _, r := range results {
+			require.ErrorIs(t, r.Error, context.Canceled)
+			assert.False(t, r.Healthy)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package checker
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// protocolCheckFn performs a health check on an endpoint using a protocol other than HTTP
+// Connections are opened with the dialer, which is nil if the endpoint doesn't have a source address
+// It returns an error if the endpoint is unhealthy
+type protocolCheckFn func(ctx context.Context, endpoint *config.ConfigEndpoint, dialer *sourceDialer) error
+
+// Functions that check endpoints using protocols other than HTTP, keyed by URL scheme
+var protocolCheckers = map[string]protocolCheckFn{
+	"ssh":        sshHandshake,
+	"postgres":   pingPostgres,
+	"postgresql": pingPostgres,
+	"mysql":      pingMySQL,
+	"redis":      pingRedis,
+	"rediss":     pingRedis,
+}
+
+// getProtocolChecker returns the function that checks the endpoint, if its URL uses a protocol other than HTTP
+// It returns nil for HTTP endpoints
+func getProtocolChecker(endpoint *config.ConfigEndpoint) protocolCheckFn {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return nil
+	}
+	return protocolCheckers[u.Scheme]
+}
+
+// checkProtocolEndpoint performs a health check on an endpoint using a protocol other than HTTP
+func (c *checker) checkProtocolEndpoint(ctx context.Context, endpoint *config.ConfigEndpoint, fn protocolCheckFn) Result {
+	start := time.Now()
+
+	// Create a context with timeout for this specific endpoint
+	endpointCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	err := fn(endpointCtx, endpoint, c.sourceDialers[endpoint])
+	if err != nil {
+		return Result{
+			Endpoint: endpoint,
+			Healthy:  false,
+			Error:    err,
+			Duration: time.Since(start),
+		}
+	}
+
+	// Check the latency, if needed
+	duration := time.Since(start)
+	err = checkLatency(endpoint, duration)
+	if err != nil {
+		return Result{
+			Endpoint: endpoint,
+			Healthy:  false,
+			Degraded: true,
+			Error:    err,
+			Duration: duration,
+		}
+	}
+
+	return Result{
+		Endpoint: endpoint,
+		Healthy:  true,
+		Error:    nil,
+		Duration: duration,
+	}
+}
@@ -0,0 +1,102 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/ipsource"
+)
+
+// dialFunc is the signature of functions that open network connections, such as net.Dialer.DialContext
+type dialFunc func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+// sourceDialer opens connections from a local source address, which is either an IP address or an address of a network interface
+// A nil sourceDialer opens connections from the address chosen by the operating system
+type sourceDialer struct {
+	src config.IPSource
+}
+
+// newSourceDialer returns a sourceDialer for the value of the sourceAddress option, or nil if the value is empty
+func newSourceDialer(sourceAddress string) (*sourceDialer, error) {
+	if sourceAddress == "" {
+		return nil, nil
+	}
+
+	src, err := config.ParseSourceAddress(sourceAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &sourceDialer{src: src}, nil
+}
+
+// DialContext opens a connection to the address, from the source address
+// When the source is an interface without a family set, the interface's address of the same family as the destination is used; for hostnames, IPv4 is tried before IPv6
+func (d *sourceDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if d == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	localAddrs, err := d.localAddrs(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dialer only connects to addresses of the same family as the local address
+	errs := make([]error, 0, len(localAddrs))
+	for _, local := range localAddrs {
+		dialer.LocalAddr = &net.TCPAddr{IP: local.AsSlice()}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("connection from %s failed: %w", local, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// localAddrs returns the local addresses to connect from, in order of preference
+func (d *sourceDialer) localAddrs(ctx context.Context, addr string) ([]netip.Addr, error) {
+	if d.src.Type == config.IPSourceStatic {
+		return []netip.Addr{netip.MustParseAddr(d.src.Value)}, nil
+	}
+
+	// If the family isn't set, select the one of the destination, if it's an IP address
+	families := []string{d.src.Family}
+	if d.src.Family == config.IPFamilyAny {
+		families = []string{config.IPFamilyIPv4, config.IPFamilyIPv6}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ip, err := netip.ParseAddr(host)
+		if err == nil && ip.Unmap().Is4() {
+			families = families[:1]
+		} else if err == nil {
+			families = families[1:]
+		}
+	}
+
+	res := make([]netip.Addr, 0, len(families))
+	var lastErr error
+	for _, family := range families {
+		local, err := ipsource.NewInterface(d.src.Value, family).IP(ctx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res = append(res, local)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("failed to get the source address: %w", lastErr)
+	}
+	return res, nil
+}
@@ -0,0 +1,127 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+const (
+	// Default port for SSH endpoints
+	defaultSSHPort = "22"
+	// Username used for the handshake when no credentials are configured
+	defaultSSHUsername = "ddup"
+)
+
+// sshHandshake connects to an SSH server and performs the handshake
+// If credentials are configured, the client must authenticate successfully too.
+// Otherwise, the server is considered healthy if the key exchange completes, even if authentication fails.
+func sshHandshake(ctx context.Context, endpoint *config.ConfigEndpoint, dialer *sourceDialer) error {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultSSHPort
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	clientConfig, err := sshClientConfig(endpoint.SSH)
+	if err != nil {
+		return err
+	}
+
+	// The host key callback is invoked after the banner exchange and key exchange, before authentication
+	var keyExchanged bool
+	hostKeyCallback := clientConfig.HostKeyCallback
+	clientConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeyCallback(hostname, remote, key)
+		if err != nil {
+			return err
+		}
+		keyExchanged = true
+		return nil
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		// Without credentials, authentication is expected to fail
+		if keyExchanged && !hasSSHCredentials(endpoint.SSH) {
+			return nil
+		}
+		return fmt.Errorf("SSH handshake failed: %w", err)
+	}
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+	_ = client.Close()
+
+	return nil
+}
+
+// sshClientConfig returns the configuration for the SSH client
+func sshClientConfig(cfg *config.ConfigEndpointSSH) (*ssh.ClientConfig, error) {
+	clientConfig := &ssh.ClientConfig{
+		User: defaultSSHUsername,
+		// This is a reachability check, so the host key is verified only if configured
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint:gosec
+	}
+	if cfg == nil {
+		return clientConfig, nil
+	}
+
+	if cfg.HostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH host key: %w", err)
+		}
+		clientConfig.HostKeyCallback = ssh.FixedHostKey(key)
+	}
+
+	if cfg.Username != "" {
+		clientConfig.User = cfg.Username
+	}
+	if cfg.PrivateKeyFile != "" {
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH private key file '%s': %w", cfg.PrivateKeyFile, err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			var passphraseErr *ssh.PassphraseMissingError
+			if errors.As(err, &passphraseErr) {
+				return nil, fmt.Errorf("SSH private key file '%s' is protected by a passphrase, which is not supported", cfg.PrivateKeyFile)
+			}
+			return nil, fmt.Errorf("failed to parse SSH private key file '%s': %w", cfg.PrivateKeyFile, err)
+		}
+		clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		clientConfig.Auth = append(clientConfig.Auth, ssh.Password(cfg.Password))
+	}
+
+	return clientConfig, nil
+}
+
+// hasSSHCredentials returns true if credentials for authenticating are configured
+func hasSSHCredentials(cfg *config.ConfigEndpointSSH) bool {
+	return cfg != nil && (cfg.Password != "" || cfg.PrivateKeyFile != "")
+}
@@ -0,0 +1,201 @@
+package checker
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// startTestSSHServer starts a SSH server that accepts the given password and public key
+// It returns the address of the server and its host key
+func startTestSSHServer(t *testing.T, password string, authorizedKey ssh.PublicKey) (string, ssh.PublicKey) {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+			if conn.User() == "test" && string(pw) == password {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorizedKey != nil && conn.User() == "test" && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("invalid key")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close() //nolint:errcheck
+				sshConn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				defer sshConn.Close() //nolint:errcheck
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					_ = ch.Reject(ssh.Prohibited, "not supported")
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestCheckEndpoint_SSH(t *testing.T) {
+	// Generate a key for the client
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	clientSSHPub, err := ssh.NewPublicKey(clientPub)
+	require.NoError(t, err)
+	pemBlock, err := ssh.MarshalPrivateKey(clientPriv, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(pemBlock), 0o600))
+
+	addr, hostKey := startTestSSHServer(t, "secret", clientSSHPub)
+	hostKeyStr := string(ssh.MarshalAuthorizedKey(hostKey))
+
+	// Generate another key to test host key mismatches
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherSSHPub, err := ssh.NewPublicKey(otherPub)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		ssh         *config.ConfigEndpointSSH
+		shouldPass  bool
+		errContains string
+	}{
+		{
+			name:       "Handshake without credentials",
+			shouldPass: true,
+		},
+		{
+			name:       "Handshake with matching host key",
+			ssh:        &config.ConfigEndpointSSH{HostKey: hostKeyStr},
+			shouldPass: true,
+		},
+		{
+			name:        "Host key mismatch",
+			ssh:         &config.ConfigEndpointSSH{HostKey: string(ssh.MarshalAuthorizedKey(otherSSHPub))},
+			errContains: "SSH handshake failed",
+		},
+		{
+			name:       "Password authentication",
+			ssh:        &config.ConfigEndpointSSH{Username: "test", Password: "secret"},
+			shouldPass: true,
+		},
+		{
+			name:        "Wrong password",
+			ssh:         &config.ConfigEndpointSSH{Username: "test", Password: "wrong"},
+			errContains: "unable to authenticate",
+		},
+		{
+			name:       "Private key authentication",
+			ssh:        &config.ConfigEndpointSSH{Username: "test", PrivateKeyFile: keyFile, HostKey: hostKeyStr},
+			shouldPass: true,
+		},
+		{
+			name:        "Missing private key file",
+			ssh:         &config.ConfigEndpointSSH{Username: "test", PrivateKeyFile: filepath.Join(t.TempDir(), "missing")},
+			errContains: "failed to read SSH private key file",
+		},
+	}
+
+	checker := newTestChecker(nil)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint := &config.ConfigEndpoint{
+				Name: "ssh",
+				URL:  "ssh://" + addr,
+				IP:   "127.0.0.1",
+				SSH:  tc.ssh,
+			}
+
+			result := checker.checkEndpoint(t.Context(), endpoint)
+			if tc.shouldPass {
+				require.NoError(t, result.Error)
+				assert.True(t, result.Healthy)
+			} else {
+				require.ErrorContains(t, result.Error, tc.errContains)
+				assert.False(t, result.Healthy)
+			}
+			assert.Greater(t, result.Duration, time.Duration(0))
+		})
+	}
+
+	t.Run("Not an SSH server", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close() //nolint:errcheck
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			_ = conn.Close()
+		}()
+
+		endpoint := &config.ConfigEndpoint{
+			Name: "not-ssh",
+			URL:  "ssh://" + ln.Addr().String(),
+			IP:   "127.0.0.1",
+		}
+
+		result := checker.checkEndpoint(t.Context(), endpoint)
+		require.ErrorContains(t, result.Error, "SSH handshake failed")
+		assert.False(t, result.Healthy)
+	})
+
+	t.Run("Connection refused", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		closedAddr := ln.Addr().String()
+		require.NoError(t, ln.Close())
+
+		endpoint := &config.ConfigEndpoint{
+			Name: "closed",
+			URL:  "ssh://" + closedAddr,
+			IP:   "127.0.0.1",
+		}
+
+		result := checker.checkEndpoint(t.Context(), endpoint)
+		require.ErrorContains(t, result.Error, "connection failed")
+		assert.False(t, result.Healthy)
+	})
+}
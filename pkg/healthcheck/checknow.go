@@ -0,0 +1,113 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// CheckNow runs health checks and updates the DNS records right away, returning when they are complete
+// If domain is empty, all domains are checked
+// If a check for a domain is already in progress, this waits for it to complete, then checks the domain again
+// Domains that are paused are skipped
+func (hc *HealthChecker) CheckNow(ctx context.Context, domain string) error {
+	dcs := hc.getDomainCheckers()
+	if domain != "" {
+		dc, ok := dcs[domain]
+		if !ok {
+			return ErrDomainNotFound
+		}
+		dcs = map[string]*domainChecker{domain: dc}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "on-demand check",
+		trace.WithAttributes(attribute.String("dns.domain", domain)),
+	)
+	defer span.End()
+
+	var wg sync.WaitGroup
+	for name, dc := range dcs {
+		wg.Go(func() {
+			dc.cycleLock.Lock()
+			defer dc.cycleLock.Unlock()
+
+			hc.checkDomainLocked(ctx, name, dc)
+		})
+	}
+	wg.Wait()
+
+	flushProviders(ctx, slices.Collect(maps.Values(dcs)))
+
+	hc.cycleLock.Lock()
+	stateFile := hc.stateFile
+	hc.cycleLock.Unlock()
+	hc.persistState(ctx, stateFile)
+
+	return ctx.Err()
+}
+
+// SyncNow runs health checks for a domain and pushes the records to the provider, even if they haven't changed
+// This can be used to recover from changes made at the provider outside of ddup
+// It returns an error if the records were not updated
+func (hc *HealthChecker) SyncNow(ctx context.Context, domain string) error {
+	dc, ok := hc.getDomainChecker(domain)
+	if !ok {
+		return ErrDomainNotFound
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "on-demand sync",
+		trace.WithAttributes(attribute.String("dns.domain", domain)),
+	)
+	defer span.End()
+
+	if dc.isPaused() {
+		return ErrDomainPaused
+	}
+	if !hc.isLeader() {
+		return ErrNotLeader
+	}
+
+	dc.cycleLock.Lock()
+	if dc.retired {
+		dc.cycleLock.Unlock()
+		return ErrDomainNotFound
+	}
+	dc.forceUpdate = true
+	hc.checkDomainLocked(ctx, domain, dc)
+	updated := !dc.forceUpdate
+	dc.forceUpdate = false
+	dc.cycleLock.Unlock()
+
+	hc.cycleLock.Lock()
+	stateFile := hc.stateFile
+	hc.cycleLock.Unlock()
+	hc.persistState(ctx, stateFile)
+
+	if updated {
+		if !flushProviders(ctx, []*domainChecker{dc}) {
+			return fmt.Errorf("records were updated, but DNS provider '%s' failed to publish them", dc.provider.Name())
+		}
+		return nil
+	}
+
+	// Return the reason why records were not updated
+	_, _, _, lastError := dc.getState()
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case lastError != "":
+		return errors.New(lastError)
+	case dc.getWarning() != "":
+		return errors.New(dc.getWarning())
+	default:
+		return ErrNoHealthyEndpoints
+	}
+}
@@ -0,0 +1,71 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// recordTypes returns the types of records that can be managed for the domain
+func (dc *domainChecker) recordTypes() []string {
+	if dc.policy == config.RoutingPolicyCNAME {
+		return []string{dns.RecordTypeCNAME}
+	}
+	return []string{dns.RecordTypeA, dns.RecordTypeAAAA}
+}
+
+// desiredRecords returns the values of the records of the given type, from the addresses of all endpoints and of the healthy ones
+// It returns false if the records of the type are not managed, because no endpoint uses them
+// With the "cname" routing policy, the only value is the target of the first healthy endpoint, in the order of ips
+func (dc *domainChecker) desiredRecords(recordType string, ips []string, healthyIPs []string) ([]string, bool) {
+	if dc.policy != config.RoutingPolicyCNAME {
+		if len(dns.FilterIPsByRecordType(ips, recordType)) == 0 {
+			return nil, false
+		}
+		return dns.FilterIPsByRecordType(healthyIPs, recordType), true
+	}
+
+	if recordType != dns.RecordTypeCNAME {
+		return nil, false
+	}
+	for _, target := range ips {
+		if slices.Contains(healthyIPs, target) {
+			return []string{target}, true
+		}
+	}
+	return []string{}, true
+}
+
+// updateCNAMERecords points the CNAME records of all names of the domain at the target
+func updateCNAMERecords(ctx context.Context, dc *domainChecker, target string, ttl int) error {
+	// This was validated when the domain checker was created
+	provider, ok := dc.provider.(dns.CNAMERecordProvider)
+	if !ok {
+		return fmt.Errorf("DNS provider '%s' does not support CNAME records", dc.provider.Name())
+	}
+
+	for _, name := range dc.recordNames() {
+		// With ownership records, records that are not owned by this instance are not modified
+		if dc.ownership != nil {
+			err := dc.ownership.Claim(ctx, dc.provider, name, dns.RecordTypeCNAME, ttl, []string{target})
+			if err != nil {
+				return fmt.Errorf("error checking ownership of CNAME records for %s: %w", name, err)
+			}
+		}
+
+		spanCtx, span := startProviderSpan(ctx, dc, "UpdateCNAMERecord", attribute.String("dns.record_type", dns.RecordTypeCNAME))
+		err := provider.UpdateCNAMERecord(spanCtx, name, ttl, target)
+		tracing.EndSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("error updating CNAME record for %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
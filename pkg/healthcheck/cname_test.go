@@ -0,0 +1,101 @@
+package healthcheck
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestDesiredRecords(t *testing.T) {
+	t.Run("Simple routing policy", func(t *testing.T) {
+		dc := &domainChecker{policy: config.RoutingPolicySimple}
+		ips := []string{"1.1.1.1", "2.2.2.2", "2001:db8::1"}
+
+		values, ok := dc.desiredRecords(dns.RecordTypeA, ips, []string{"2.2.2.2"})
+		assert.True(t, ok)
+		assert.Equal(t, []string{"2.2.2.2"}, values)
+
+		values, ok = dc.desiredRecords(dns.RecordTypeAAAA, ips[:2], []string{"2.2.2.2"})
+		assert.False(t, ok)
+		assert.Empty(t, values)
+	})
+
+	t.Run("CNAME routing policy", func(t *testing.T) {
+		dc := &domainChecker{policy: config.RoutingPolicyCNAME}
+		ips := []string{"lb1.example.net", "lb2.example.net", "lb3.example.net"}
+
+		// The first healthy endpoint is selected, in the order of the endpoints
+		values, ok := dc.desiredRecords(dns.RecordTypeCNAME, ips, []string{"lb3.example.net", "lb2.example.net"})
+		assert.True(t, ok)
+		assert.Equal(t, []string{"lb2.example.net"}, values)
+
+		values, ok = dc.desiredRecords(dns.RecordTypeCNAME, ips, nil)
+		assert.True(t, ok)
+		assert.Empty(t, values)
+
+		_, ok = dc.desiredRecords(dns.RecordTypeA, ips, ips)
+		assert.False(t, ok)
+	})
+}
+
+func TestHealthChecker_CNAME(t *testing.T) {
+	mockProvider := dns.NewMockProvider(false)
+	mockChecker := &checker.MockChecker{
+		Domain:      "example.com",
+		MaxAttempts: 1,
+		Results: []checker.Result{
+			{Endpoint: &config.ConfigEndpoint{Name: "lb1", Target: "lb1.example.net"}, Healthy: true},
+			{Endpoint: &config.ConfigEndpoint{Name: "lb2", Target: "lb2.example.net"}, Healthy: true},
+		},
+	}
+	dc := &domainChecker{
+		checker:   mockChecker,
+		ttl:       60,
+		policy:    config.RoutingPolicyCNAME,
+		failedIPs: make(map[string]int),
+		provider:  mockProvider,
+		aliases:   []string{"alt.example.com"},
+	}
+	hc := &HealthChecker{
+		domainCheckers: map[string]*domainChecker{"example.com": dc},
+	}
+
+	// The CNAME records of all names point at the first healthy endpoint
+	hc.checkAndUpdateDNS(t.Context())
+	assert.Equal(t, 2, mockProvider.CallCount)
+	assert.Equal(t, []string{"example.com", "alt.example.com"}, mockProvider.Domains)
+	assert.Equal(t, []string{"lb1.example.net"}, mockProvider.LastIPs[dns.RecordTypeCNAME])
+	assert.NotContains(t, mockProvider.LastIPs, dns.RecordTypeA)
+
+	// The target doesn't change when other endpoints fail
+	mockChecker.Results[1].Healthy = false
+	hc.checkAndUpdateDNS(t.Context())
+	assert.Equal(t, 2, mockProvider.CallCount)
+
+	// When the selected endpoint fails, the records fail over to the next healthy one
+	mockChecker.Results[0].Healthy = false
+	mockChecker.Results[1].Healthy = true
+	hc.checkAndUpdateDNS(t.Context())
+	assert.Equal(t, 4, mockProvider.CallCount)
+	assert.Equal(t, []string{"lb2.example.net"}, mockProvider.LastIPs[dns.RecordTypeCNAME])
+
+	// Records are not updated when no endpoint is healthy
+	mockChecker.Results[1].Healthy = false
+	hc.checkAndUpdateDNS(t.Context())
+	assert.Equal(t, 4, mockProvider.CallCount)
+	assert.Equal(t, []string{"lb2.example.net"}, mockProvider.LastIPs[dns.RecordTypeCNAME])
+
+	// The plan compares the CNAME records
+	mockChecker.Results[0].Healthy = true
+	plan := hc.Plan(t.Context())["example.com"]
+	require.Len(t, plan.Records, 2)
+	assert.Equal(t, dns.RecordTypeCNAME, plan.Records[0].RecordType)
+	assert.Equal(t, []string{"lb1.example.net"}, plan.Records[0].Desired)
+	assert.Equal(t, []string{"lb2.example.net"}, plan.Records[0].Current)
+	assert.True(t, plan.HasChanges())
+}
@@ -0,0 +1,31 @@
+package healthcheck
+
+import (
+	"slices"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// applyDeletionPolicy returns the IPs to publish, given the desired IPs and the ones currently published by the provider, according to the domain's deletion policy
+// ips contains the IPs of all endpoints of the domain, including fallback IPs
+func (dc *domainChecker) applyDeletionPolicy(ips []string, desired []string, published []string) []string {
+	var keep func(ip string) bool
+	switch dc.deletionPolicy {
+	case config.DeletionPolicyNever:
+		// All records are kept
+		keep = func(string) bool { return true }
+	case config.DeletionPolicyUnhealthyOnly:
+		// Records of IPs that are not endpoints of the domain weren't created by ddup, so they're kept
+		keep = func(ip string) bool { return !slices.Contains(ips, ip) }
+	default:
+		return desired
+	}
+
+	res := slices.Clone(desired)
+	for _, ip := range published {
+		if keep(ip) && !slices.Contains(res, ip) {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
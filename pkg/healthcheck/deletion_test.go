@@ -0,0 +1,116 @@
+package healthcheck
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestApplyDeletionPolicy(t *testing.T) {
+	ips := []string{"1.1.1.1", "2.2.2.2"}
+	desired := []string{"1.1.1.1"}
+	published := []string{"2.2.2.2", "9.9.9.9"}
+
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{policy: "", want: []string{"1.1.1.1"}},
+		{policy: config.DeletionPolicyFull, want: []string{"1.1.1.1"}},
+		{policy: config.DeletionPolicyUnhealthyOnly, want: []string{"1.1.1.1", "9.9.9.9"}},
+		{policy: config.DeletionPolicyNever, want: []string{"1.1.1.1", "2.2.2.2", "9.9.9.9"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			dc := &domainChecker{deletionPolicy: tt.policy}
+			assert.Equal(t, tt.want, dc.applyDeletionPolicy(ips, desired, published))
+		})
+	}
+}
+
+func TestHealthChecker_DeletionPolicy(t *testing.T) {
+	newHealthChecker := func(policy string) (*HealthChecker, *checker.MockChecker, *dns.MockProvider) {
+		mockProvider := dns.NewMockProvider(false)
+		// 9.9.9.9 was created outside of ddup
+		mockProvider.LastIPs = map[string][]string{
+			dns.RecordTypeA: {"1.1.1.1", "2.2.2.2", "9.9.9.9"},
+		}
+		mockChecker := &checker.MockChecker{
+			Domain:      "example.com",
+			MaxAttempts: 1,
+			Results: []checker.Result{
+				{Endpoint: &config.ConfigEndpoint{Name: "endpoint1", IP: "1.1.1.1"}, Healthy: true},
+				{Endpoint: &config.ConfigEndpoint{Name: "endpoint2", IP: "2.2.2.2"}, Healthy: true},
+				{Endpoint: &config.ConfigEndpoint{Name: "endpoint3", IP: "3.3.3.3"}, Healthy: false, Error: errors.New("connection failed")},
+			},
+		}
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": {
+					checker:          mockChecker,
+					ttl:              60,
+					failedIPs:        make(map[string]int),
+					provider:         mockProvider,
+					reconcilePending: true,
+					deletionPolicy:   policy,
+				},
+			},
+		}
+		return hc, mockChecker, mockProvider
+	}
+
+	t.Run("Full", func(t *testing.T) {
+		hc, _, mockProvider := newHealthChecker(config.DeletionPolicyFull)
+
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, 1, mockProvider.CallCount)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, mockProvider.LastIPs[dns.RecordTypeA])
+	})
+
+	t.Run("Unhealthy only", func(t *testing.T) {
+		hc, mockChecker, mockProvider := newHealthChecker(config.DeletionPolicyUnhealthyOnly)
+
+		// The IP that is not an endpoint is kept
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, 1, mockProvider.CallCount)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2", "9.9.9.9"}, mockProvider.LastIPs[dns.RecordTypeA])
+
+		// Unhealthy endpoints are removed, and the other records are kept
+		mockChecker.Results[1].Healthy = false
+		mockChecker.Results[2].Healthy = true
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, 2, mockProvider.CallCount)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "3.3.3.3", "9.9.9.9"}, mockProvider.LastIPs[dns.RecordTypeA])
+	})
+
+	t.Run("Never", func(t *testing.T) {
+		hc, mockChecker, mockProvider := newHealthChecker(config.DeletionPolicyNever)
+
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, 1, mockProvider.CallCount)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2", "9.9.9.9"}, mockProvider.LastIPs[dns.RecordTypeA])
+
+		// Healthy endpoints are added, but no record is removed
+		mockChecker.Results[1].Healthy = false
+		mockChecker.Results[2].Healthy = true
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, 2, mockProvider.CallCount)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "9.9.9.9"}, mockProvider.LastIPs[dns.RecordTypeA])
+	})
+
+	t.Run("Provider can't return records", func(t *testing.T) {
+		_, err := newDomainCheckers(&config.Config{
+			Domains: []config.ConfigDomain{
+				{RecordName: "example.com", Provider: "writeonly", DeletionPolicy: config.DeletionPolicyNever},
+			},
+		}, map[string]dns.Provider{"writeonly": &writeOnlyProvider{}}, nil, nil)
+		require.ErrorContains(t, err, "can't return its records")
+	})
+}
@@ -0,0 +1,77 @@
+package healthcheck
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Key used to track repeated failures discovering the endpoints of a domain
+const failureKeyDiscovery = "discovery"
+
+// refreshEndpoints updates the endpoints of a domain that uses discovery, if the refresh interval has passed
+// If discovery fails, the previously-discovered endpoints are kept, and discovery is attempted again in the next check
+// The caller must hold the domain's cycleLock
+func (dc *domainChecker) refreshEndpoints(ctx context.Context, log *slog.Logger) {
+	if dc.discovery == nil {
+		return
+	}
+
+	now := time.Now()
+	if !dc.lastDiscovered.IsZero() && now.Sub(dc.lastDiscovered) < dc.discoveryInterval {
+		return
+	}
+
+	discovered, err := dc.discovery.Endpoints(ctx)
+	if err != nil {
+		dc.failures.Log(ctx, log, failureKeyDiscovery, slog.LevelWarn, "Error discovering endpoints, keeping the previous ones", "error", err)
+		return
+	}
+	dc.failures.Resolved(ctx, log, failureKeyDiscovery, "Endpoints discovered after previous errors")
+	dc.lastDiscovered = now
+
+	if slices.EqualFunc(dc.discovered, discovered, sameEndpoint) {
+		return
+	}
+
+	endpoints := make([]*config.ConfigEndpoint, 0, len(dc.staticEndpoints)+len(discovered))
+	endpoints = append(endpoints, dc.staticEndpoints...)
+	endpoints = append(endpoints, discovered...)
+	chk, err := dc.newChecker(endpoints)
+	if err != nil {
+		log.ErrorContext(ctx, "Error creating the health checker for the discovered endpoints, keeping the previous ones", "error", err)
+		return
+	}
+
+	names := make([]string, len(discovered))
+	for i, e := range discovered {
+		names[i] = e.Name
+	}
+	log.InfoContext(ctx, "Discovered endpoints changed", "endpoints", names)
+
+	dc.discovered = discovered
+
+	dc.lock.Lock()
+	dc.checker = chk
+	dc.endpointIPs = fixedEndpointIPs(endpoints)
+	dc.lock.Unlock()
+}
+
+// sameEndpoint returns true if two discovered endpoints are the same
+func sameEndpoint(a, b *config.ConfigEndpoint) bool {
+	return a.Name == b.Name && a.URL == b.URL && a.IP == b.IP && a.Target == b.Target && a.Host == b.Host && a.GetWeight() == b.GetWeight()
+}
+
+// fixedEndpointIPs returns the IPs of the endpoints that have a fixed IP
+func fixedEndpointIPs(endpoints []*config.ConfigEndpoint) []string {
+	res := make([]string, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.IPFrom == "" {
+			res = append(res, e.Address())
+		}
+	}
+	return res
+}
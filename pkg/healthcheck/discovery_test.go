@@ -0,0 +1,109 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+// mockDiscovery is a discovery source that returns a fixed list of endpoints, or an error
+type mockDiscovery struct {
+	endpoints []*config.ConfigEndpoint
+	err       error
+	calls     int
+}
+
+func (m *mockDiscovery) Endpoints(ctx context.Context) ([]*config.ConfigEndpoint, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.endpoints, nil
+}
+
+func TestHealthChecker_Discovery(t *testing.T) {
+	staticEndpoint := &config.ConfigEndpoint{Name: "static", IP: "1.1.1.1"}
+
+	// All endpoints are healthy
+	newChecker := func(endpoints []*config.ConfigEndpoint) (checker.Checker, error) {
+		results := make([]checker.Result, len(endpoints))
+		for i, e := range endpoints {
+			results[i] = checker.Result{Endpoint: e, Healthy: true}
+		}
+		return &checker.MockChecker{Domain: "example.com", MaxAttempts: 2, Results: results}, nil
+	}
+
+	newDomainChecker := func(src *mockDiscovery, interval time.Duration) (*domainChecker, *dns.MockProvider) {
+		provider := dns.NewMockProvider(false)
+		chk, err := newChecker([]*config.ConfigEndpoint{staticEndpoint})
+		require.NoError(t, err)
+		return &domainChecker{
+			checker:           chk,
+			ttl:               60,
+			failedIPs:         make(map[string]int),
+			provider:          provider,
+			endpointIPs:       []string{"1.1.1.1"},
+			discovery:         src,
+			discoveryInterval: interval,
+			staticEndpoints:   []*config.ConfigEndpoint{staticEndpoint},
+			newChecker:        newChecker,
+		}, provider
+	}
+
+	t.Run("Discovered endpoints are added", func(t *testing.T) {
+		src := &mockDiscovery{
+			endpoints: []*config.ConfigEndpoint{
+				{Name: "d1", URL: "http://2.2.2.2/", IP: "2.2.2.2"},
+				{Name: "d2", URL: "http://3.3.3.3/", IP: "3.3.3.3"},
+			},
+		}
+		dc, provider := newDomainChecker(src, 0)
+		hc := &HealthChecker{domainCheckers: map[string]*domainChecker{"example.com": dc}}
+
+		hc.checkAndUpdateDNS(t.Context())
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}, provider.LastIPs[dns.RecordTypeA])
+		assert.True(t, dc.hasEndpointIP("3.3.3.3"))
+
+		// An endpoint is removed
+		src.endpoints = src.endpoints[:1]
+		hc.checkAndUpdateDNS(t.Context())
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, provider.LastIPs[dns.RecordTypeA])
+		assert.Equal(t, 2, src.calls)
+	})
+
+	t.Run("Errors keep the previous endpoints", func(t *testing.T) {
+		src := &mockDiscovery{
+			endpoints: []*config.ConfigEndpoint{
+				{Name: "d1", URL: "http://2.2.2.2/", IP: "2.2.2.2"},
+			},
+		}
+		dc, provider := newDomainChecker(src, 0)
+		hc := &HealthChecker{domainCheckers: map[string]*domainChecker{"example.com": dc}}
+
+		hc.checkAndUpdateDNS(t.Context())
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, provider.LastIPs[dns.RecordTypeA])
+
+		src.err = errors.New("api unavailable")
+		hc.checkAndUpdateDNS(t.Context())
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, provider.LastIPs[dns.RecordTypeA])
+		assert.Equal(t, 1, provider.CallCount)
+	})
+
+	t.Run("Refresh interval", func(t *testing.T) {
+		src := &mockDiscovery{}
+		dc, _ := newDomainChecker(src, time.Hour)
+		hc := &HealthChecker{domainCheckers: map[string]*domainChecker{"example.com": dc}}
+
+		hc.checkAndUpdateDNS(t.Context())
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, 1, src.calls)
+	})
+}
@@ -1,22 +1,127 @@
 package healthcheck
 
 import (
+	"context"
+	"fmt"
+	"net/netip"
 	"sync"
 	"time"
 
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/discovery"
 	"github.com/italypaleale/ddup/pkg/dns"
 	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+	"github.com/italypaleale/ddup/pkg/ipsource"
+	"github.com/italypaleale/ddup/pkg/ipv6prefix"
+	"github.com/italypaleale/ddup/pkg/logging"
+	"github.com/italypaleale/ddup/pkg/quorum"
+	"github.com/italypaleale/ddup/pkg/utils"
 )
 
 type domainChecker struct {
-	lock        sync.Mutex
+	lock sync.Mutex
+	// Checker for the endpoints of the domain
+	// It's replaced when discovered endpoints change, while holding both cycleLock and lock; use getChecker outside of a check
 	checker     checker.Checker
 	ttl         int
+	policy      string
 	healthyIPs  []string
 	failedIPs   map[string]int
 	provider    dns.Provider
 	lastUpdated time.Time
 	lastError   string
+	lastWarning string
+	// Set to true after the first successful update of the DNS records
+	synced bool
+	// Maintenance windows for the provider
+	maintenanceWindows []config.ConfigMaintenanceWindow
+	// During a maintenance window, updates are not attempted before this time
+	nextRetry time.Time
+	// If set, IPv6 addresses of endpoints are host suffixes to combine with the prefix returned by this source
+	prefixSource ipv6prefix.Source
+	// Sources of the IP of endpoints that have ipFrom set, keyed by the value of ipFrom
+	ipSources map[string]ipsource.Source
+	// Results of the last check, keyed by IP
+	lastResults map[string]checker.Result
+	// Time of the last check
+	lastChecked time.Time
+	// Configuration for flapping detection; nil if disabled
+	flapping *config.ConfigFlapping
+	// State for flapping detection, keyed by IP
+	flaps map[string]*flapState
+	// IPs of the endpoints, as set in the configuration
+	endpointIPs []string
+	// IPs of endpoints that are administratively removed from DNS
+	drainedIPs map[string]struct{}
+	// If true, health checks and DNS updates are paused
+	paused bool
+	// Minimum number of endpoints to keep in DNS; 0 if disabled
+	minHealthy int
+	// IPs to publish when no endpoint is healthy
+	fallbackIPs []string
+	// Configuration for the dynamic TTL; nil if disabled
+	dynamicTTL *config.ConfigDynamicTTL
+	// With dynamic TTL, the domain is considered unstable until this time
+	unstableUntil time.Time
+	// TTL of the records that were last published
+	publishedTTL int
+	// If true, the records published by the provider are compared with the desired state in the next check, and corrected if needed
+	reconcilePending bool
+	// If greater than zero, records are compared with the desired state periodically
+	reconcileInterval time.Duration
+	// Last time the records were compared with the desired state
+	lastReconciled time.Time
+	// IPs that ddup last published, or verified to be published, in the provider's records, keyed by name; nil if unknown
+	// If the records published by the provider differ from these, they were changed outside of ddup
+	publishedIPs map[string][]string
+	// Action taken when the records were changed outside of ddup
+	conflictPolicy string
+	// Which records are removed when endpoints become unhealthy
+	deletionPolicy string
+	// Names of records that are updated with the same IPs, in addition to the domain's name
+	aliases []string
+	// Set to true when the domain has no healthy endpoints, or fewer than the minimum
+	domainDegraded bool
+	// Suppresses logs for failures that repeat at every check
+	failures *logging.RepeatedFailures
+	// Lock held while the domain is checked and its records are updated
+	cycleLock sync.Mutex
+	// Set to true when the domain checker is replaced after a configuration update
+	// Protected by cycleLock
+	retired bool
+	// If true, records are updated in the next check even if they haven't changed; reset after a successful update
+	// Protected by cycleLock
+	forceUpdate bool
+	// If set, endpoints are discovered from this source, in addition to the ones in the configuration
+	discovery discovery.Source
+	// Interval for refreshing discovered endpoints
+	discoveryInterval time.Duration
+	// Endpoints in the configuration
+	staticEndpoints []*config.ConfigEndpoint
+	// Creates the checker for the given endpoints, when discovered endpoints change
+	newChecker func(endpoints []*config.ConfigEndpoint) (checker.Checker, error)
+	// If set, endpoints are removed from DNS only if the majority of vantage points observe them as down
+	quorum *quorum.Quorum
+	// If set, the results of health checks are aggregated with the ones reported by remote checker agents
+	agentReports *quorum.Reports
+	// Results reported by agents older than this are ignored
+	agentsMaxAge time.Duration
+	// If set, records are modified only if they are owned by this instance, according to the ownership records
+	ownership *dns.Ownership
+	// Endpoints that were last discovered
+	// Protected by cycleLock
+	discovered []*config.ConfigEndpoint
+	// Last time endpoints were discovered successfully
+	// Protected by cycleLock
+	lastDiscovered time.Time
+}
+
+// getChecker returns the checker for the endpoints of the domain
+func (dc *domainChecker) getChecker() checker.Checker {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.checker
 }
 
 func (dc *domainChecker) getState() (healthyIPs []string, failedIPs map[string]int, lastUpdated time.Time, lastError string) {
@@ -34,6 +139,73 @@ func (dc *domainChecker) setState(healthyIPs []string, failedIPs map[string]int)
 	dc.failedIPs = failedIPs
 	dc.lastUpdated = time.Now()
 	dc.lastError = ""
+	dc.lastWarning = ""
+	dc.synced = true
+	dc.nextRetry = time.Time{}
+}
+
+// setFollowerState sets the healthy and failed IPs when this replica is not the leader, and so it did not update the records
+// The records are reconciled in the first check after this replica becomes the leader
+func (dc *domainChecker) setFollowerState(healthyIPs []string, failedIPs map[string]int) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.healthyIPs = healthyIPs
+	dc.failedIPs = failedIPs
+	dc.lastUpdated = time.Now()
+	dc.lastError = ""
+	dc.lastWarning = ""
+	dc.synced = false
+	dc.reconcilePending = true
+	dc.publishedIPs = nil
+}
+
+// shouldReconcile returns true if the records published by the provider should be compared with the desired state
+// This happens at startup, and then periodically if a reconcile interval is set
+func (dc *domainChecker) shouldReconcile(now time.Time) bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.reconcilePending || (dc.reconcileInterval > 0 && now.Sub(dc.lastReconciled) >= dc.reconcileInterval)
+}
+
+// setReconciled records that the records published by the provider match the desired state
+func (dc *domainChecker) setReconciled(now time.Time) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.reconcilePending = false
+	dc.lastReconciled = now
+}
+
+// getReconcileState returns the state for reconciling records
+func (dc *domainChecker) getReconcileState() (pending bool, lastReconciled time.Time) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.reconcilePending, dc.lastReconciled
+}
+
+// retire marks the domain checker as replaced, so it doesn't perform checks anymore
+// If a check is in progress, this blocks until it's done
+func (dc *domainChecker) retire() {
+	dc.cycleLock.Lock()
+	defer dc.cycleLock.Unlock()
+
+	dc.retired = true
+}
+
+// recordNames returns the names of the records of the domain, starting with the domain's name
+// The caller must hold cycleLock or lock
+func (dc *domainChecker) recordNames() []string {
+	return append([]string{dc.checker.GetDomain()}, dc.aliases...)
+}
+
+func (dc *domainChecker) isSynced() bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.synced
 }
 
 func (dc *domainChecker) setError(err string) {
@@ -42,4 +214,168 @@ func (dc *domainChecker) setError(err string) {
 
 	dc.lastUpdated = time.Now()
 	dc.lastError = err
+	dc.lastWarning = ""
+}
+
+// setWarning records a failure that is not reported as an error, such as during a maintenance window
+// The next update is not attempted before nextRetry
+func (dc *domainChecker) setWarning(warning string, nextRetry time.Time) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.lastUpdated = time.Now()
+	dc.lastError = ""
+	dc.lastWarning = warning
+	dc.nextRetry = nextRetry
+}
+
+// setLastResults sets the results of the last check, keyed by IP
+func (dc *domainChecker) setLastResults(results map[string]checker.Result) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.lastResults = results
+	dc.lastChecked = time.Now()
+}
+
+// getObservations returns whether each endpoint passed the last check, keyed by IP, and the time of the check
+func (dc *domainChecker) getObservations() (map[string]bool, time.Time) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	res := make(map[string]bool, len(dc.lastResults))
+	for ip, r := range dc.lastResults {
+		res[ip] = r.Healthy
+	}
+	return res, dc.lastChecked
+}
+
+// getLastResult returns the result of the last check for the endpoint with the given IP
+func (dc *domainChecker) getLastResult(ip string) (checker.Result, bool) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	res, ok := dc.lastResults[ip]
+	return res, ok
+}
+
+// effectiveTTL returns the TTL to use for the records at the given time
+// With dynamic TTL enabled, if unstable is true the domain is marked as unstable, and the lower TTL is used until the domain is stable for the configured period
+func (dc *domainChecker) effectiveTTL(now time.Time, unstable bool) int {
+	if dc.dynamicTTL == nil {
+		return dc.ttl
+	}
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if unstable {
+		dc.unstableUntil = now.Add(dc.dynamicTTL.StablePeriod)
+	}
+	if now.Before(dc.unstableUntil) {
+		return dc.dynamicTTL.TTL
+	}
+	return dc.ttl
+}
+
+// getTTLState returns the state for the dynamic TTL
+func (dc *domainChecker) getTTLState() (unstableUntil time.Time, publishedTTL int) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.unstableUntil, dc.publishedTTL
+}
+
+// setPublishedTTL records the TTL of the records that were published
+func (dc *domainChecker) setPublishedTTL(ttl int) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.publishedTTL = ttl
+}
+
+// isFallback returns true if the list of IPs contains the fallback IPs only
+func (dc *domainChecker) isFallback(ips []string) bool {
+	return len(dc.fallbackIPs) > 0 && utils.ElementsMatch(ips, dc.fallbackIPs)
+}
+
+// setMinHealthyWarning records that fewer endpoints than the minimum are healthy, and the previous IPs were kept
+func (dc *domainChecker) setMinHealthyWarning() {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.lastWarning = fmt.Sprintf("Fewer than %d endpoints are healthy; keeping the previous IPs in DNS", dc.minHealthy)
+}
+
+func (dc *domainChecker) getWarning() string {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.lastWarning
+}
+
+// getMaintenanceWindow returns the provider's maintenance window active at the given time, if any
+func (dc *domainChecker) getMaintenanceWindow(now time.Time) *config.ConfigMaintenanceWindow {
+	for i := range dc.maintenanceWindows {
+		if dc.maintenanceWindows[i].Contains(now) {
+			return &dc.maintenanceWindows[i]
+		}
+	}
+	return nil
+}
+
+// shouldDelayUpdate returns true if the provider is in a maintenance window and the next retry is in the future
+func (dc *domainChecker) shouldDelayUpdate(now time.Time) bool {
+	if dc.getMaintenanceWindow(now) == nil {
+		return false
+	}
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return now.Before(dc.nextRetry)
+}
+
+// resolveIPs returns the IPs of the endpoints in the results
+// If IPv6 prefix tracking is enabled, the prefix portion of IPv6 addresses is replaced with the current prefix
+func (dc *domainChecker) resolveIPs(ctx context.Context, results []checker.Result) ([]string, error) {
+	var (
+		prefix netip.Prefix
+		err    error
+	)
+	if dc.prefixSource != nil {
+		prefix, err = dc.prefixSource.Prefix(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect IPv6 prefix: %w", err)
+		}
+	}
+
+	ips := make([]string, len(results))
+	for i, result := range results {
+		if result.Endpoint.IPFrom != "" {
+			src, ok := dc.ipSources[result.Endpoint.IPFrom]
+			if !ok {
+				return nil, fmt.Errorf("endpoint '%s' does not have an IP source", result.Endpoint.Name)
+			}
+			addr, err := src.IP(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the IP of endpoint '%s': %w", result.Endpoint.Name, err)
+			}
+			ips[i] = addr.String()
+			continue
+		}
+
+		ips[i] = result.Endpoint.Address()
+		if !prefix.IsValid() {
+			continue
+		}
+
+		addr, parseErr := netip.ParseAddr(ips[i])
+		if parseErr != nil || !addr.Is6() || addr.Is4In6() {
+			continue
+		}
+		ips[i] = ipv6prefix.Apply(prefix, addr).String()
+	}
+
+	return ips, nil
 }
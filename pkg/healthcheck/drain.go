@@ -0,0 +1,116 @@
+package healthcheck
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+)
+
+var (
+	// ErrDomainNotFound is returned when a domain is not in the configuration
+	ErrDomainNotFound = errors.New("domain not found")
+	// ErrEndpointNotFound is returned when a domain doesn't have an endpoint with the given IP
+	ErrEndpointNotFound = errors.New("endpoint not found")
+	// ErrNoHealthyEndpoints is returned when records can't be updated because a domain has no healthy endpoints
+	ErrNoHealthyEndpoints = errors.New("no healthy endpoints")
+	// ErrNotLeader is returned when records can't be updated because this replica is not the leader
+	ErrNotLeader = errors.New("this replica is not the leader")
+)
+
+// SetEndpointDrained administratively removes an endpoint from DNS, or restores it, regardless of its health
+// The change is applied right away, with a new check cycle
+func (hc *HealthChecker) SetEndpointDrained(domain string, ip string, drained bool) error {
+	dc, ok := hc.getDomainChecker(domain)
+	if !ok {
+		return ErrDomainNotFound
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ErrEndpointNotFound
+	}
+	ip = addr.Unmap().String()
+	if !dc.hasEndpointIP(ip) {
+		return ErrEndpointNotFound
+	}
+
+	dc.setDrained(ip, drained)
+	hc.TriggerCheck()
+
+	return nil
+}
+
+// hasEndpointIP returns true if the domain has an endpoint with the given IP
+// This matches both the IPs in the configuration and the ones published in DNS, which could differ when tracking IPv6 prefixes
+func (dc *domainChecker) hasEndpointIP(ip string) bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	_, failed := dc.failedIPs[ip]
+	return failed || slices.Contains(dc.endpointIPs, ip) || slices.Contains(dc.healthyIPs, ip)
+}
+
+// setDrained marks an endpoint as drained, or removes the mark
+func (dc *domainChecker) setDrained(ip string, drained bool) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if !drained {
+		delete(dc.drainedIPs, ip)
+		return
+	}
+
+	if dc.drainedIPs == nil {
+		dc.drainedIPs = make(map[string]struct{}, 1)
+	}
+	dc.drainedIPs[ip] = struct{}{}
+}
+
+// isDrained returns true if the endpoint with the given IP is drained
+func (dc *domainChecker) isDrained(ip string) bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	_, ok := dc.drainedIPs[ip]
+	return ok
+}
+
+// getDrainedIPs returns the IPs of the endpoints that are drained
+func (dc *domainChecker) getDrainedIPs() []string {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	res := make([]string, 0, len(dc.drainedIPs))
+	for ip := range dc.drainedIPs {
+		res = append(res, ip)
+	}
+	slices.Sort(res)
+	return res
+}
+
+// removeDrained removes drained endpoints from the list of healthy IPs
+// Endpoints can be drained using the IP in the configuration or the one published in DNS
+func (dc *domainChecker) removeDrained(configuredIPs []string, ips []string, healthyIPs []string) []string {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if len(dc.drainedIPs) == 0 {
+		return healthyIPs
+	}
+
+	res := make([]string, 0, len(healthyIPs))
+	for _, ip := range healthyIPs {
+		_, drained := dc.drainedIPs[ip]
+		if !drained {
+			// Check the IP in the configuration too
+			i := slices.Index(ips, ip)
+			if i >= 0 {
+				_, drained = dc.drainedIPs[configuredIPs[i]]
+			}
+		}
+		if !drained {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
@@ -0,0 +1,95 @@
+package healthcheck
+
+import (
+	"slices"
+
+	"github.com/italypaleale/ddup/pkg/events"
+)
+
+// setDomainDegraded sets whether the domain is degraded, and returns true if this changed
+func (dc *domainChecker) setDomainDegraded(degraded bool) bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	changed := dc.domainDegraded != degraded
+	dc.domainDegraded = degraded
+	return changed
+}
+
+func (dc *domainChecker) isDomainDegraded() bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.domainDegraded
+}
+
+// publishDomainDegraded publishes an event if the domain became degraded or recovered
+func (hc *HealthChecker) publishDomainDegraded(domainName string, dc *domainChecker, degraded bool, healthyIPs []string) {
+	if !dc.setDomainDegraded(degraded) {
+		return
+	}
+
+	typ := events.TypeDomainRecovered
+	if degraded {
+		typ = events.TypeDomainDegraded
+	}
+	hc.events.Publish(events.Event{
+		Type:     typ,
+		Domain:   domainName,
+		Provider: dc.provider.Name(),
+		IPs:      healthyIPs,
+	})
+}
+
+// recordEndpointChanges records metrics for the endpoints of a domain after a check
+// If there's a previous state, it also publishes an event for each endpoint that was added to or removed from DNS
+// Fallback IPs are not endpoints, so they are ignored
+func (hc *HealthChecker) recordEndpointChanges(domainName string, dc *domainChecker, endpoints int, hasPrevState bool, prevIPs []string, newIPs []string) {
+	healthy := 0
+	for _, ip := range newIPs {
+		if !slices.Contains(dc.fallbackIPs, ip) {
+			healthy++
+		}
+	}
+	hc.metrics.RecordEndpointCounts(domainName, healthy, max(endpoints-healthy, 0))
+
+	if !hasPrevState {
+		return
+	}
+
+	record := func(typ events.Type, ip string) {
+		if slices.Contains(dc.fallbackIPs, ip) {
+			return
+		}
+		hc.metrics.RecordEndpointTransition(domainName, ip, typ == events.TypeEndpointUp)
+		hc.events.Publish(events.Event{
+			Type:     typ,
+			Domain:   domainName,
+			Provider: dc.provider.Name(),
+			IP:       ip,
+		})
+	}
+
+	for _, ip := range newIPs {
+		if !slices.Contains(prevIPs, ip) {
+			record(events.TypeEndpointUp, ip)
+		}
+	}
+	for _, ip := range prevIPs {
+		if !slices.Contains(newIPs, ip) {
+			record(events.TypeEndpointDown, ip)
+		}
+	}
+}
+
+// publishDNSUpdated records the successful update of the records of a domain, and publishes an event
+func (hc *HealthChecker) publishDNSUpdated(domainName string, dc *domainChecker, ips []string, ttl int) {
+	hc.metrics.RecordDNSUpdate(domainName, true)
+	hc.events.Publish(events.Event{
+		Type:     events.TypeDNSUpdated,
+		Domain:   domainName,
+		Provider: dc.provider.Name(),
+		IPs:      ips,
+		TTL:      ttl,
+	})
+}
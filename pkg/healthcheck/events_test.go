@@ -0,0 +1,106 @@
+package healthcheck
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/events"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestHealthChecker_Events(t *testing.T) {
+	// Returns the events received so far, ignoring their time
+	drain := func(ch <-chan events.Event) []events.Event {
+		res := []events.Event{}
+		for {
+			select {
+			case e := <-ch:
+				e.Time = time.Time{}
+				res = append(res, e)
+			default:
+				return res
+			}
+		}
+	}
+
+	newHealthChecker := func(provider dns.Provider) (*HealthChecker, *checker.MockChecker, <-chan events.Event) {
+		mockChecker := &checker.MockChecker{
+			Domain:      "example.com",
+			MaxAttempts: 1,
+			Results: []checker.Result{
+				{Endpoint: &config.ConfigEndpoint{Name: "endpoint1", IP: "1.1.1.1"}, Healthy: true},
+				{Endpoint: &config.ConfigEndpoint{Name: "endpoint2", IP: "2.2.2.2"}, Healthy: true},
+			},
+		}
+		bus := events.NewBus()
+		ch, unsub := bus.Subscribe(10)
+		t.Cleanup(unsub)
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": {
+					checker:   mockChecker,
+					ttl:       60,
+					failedIPs: make(map[string]int),
+					provider:  provider,
+				},
+			},
+			events: bus,
+		}
+		return hc, mockChecker, ch
+	}
+
+	t.Run("Endpoint and DNS changes", func(t *testing.T) {
+		hc, mockChecker, ch := newHealthChecker(dns.NewMockProvider(false))
+
+		// First check: records are published, but there are no endpoint events as there's no previous state
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, []events.Event{
+			{Type: events.TypeDNSUpdated, Domain: "example.com", Provider: "mock", IPs: []string{"1.1.1.1", "2.2.2.2"}, TTL: 60},
+		}, drain(ch))
+
+		// An endpoint goes down
+		mockChecker.Results[1].Healthy = false
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, []events.Event{
+			{Type: events.TypeDNSUpdated, Domain: "example.com", Provider: "mock", IPs: []string{"1.1.1.1"}, TTL: 60},
+			{Type: events.TypeEndpointDown, Domain: "example.com", Provider: "mock", IP: "2.2.2.2"},
+		}, drain(ch))
+
+		// All endpoints go down, so the domain is degraded
+		mockChecker.Results[0].Healthy = false
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, []events.Event{
+			{Type: events.TypeDomainDegraded, Domain: "example.com", Provider: "mock", IPs: []string{}},
+			{Type: events.TypeEndpointDown, Domain: "example.com", Provider: "mock", IP: "1.1.1.1"},
+		}, drain(ch))
+
+		// Nothing changes, so no events are published
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Empty(t, drain(ch))
+
+		// An endpoint recovers
+		mockChecker.Results[0].Healthy = true
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, []events.Event{
+			{Type: events.TypeDomainRecovered, Domain: "example.com", Provider: "mock", IPs: []string{"1.1.1.1"}},
+			{Type: events.TypeDNSUpdated, Domain: "example.com", Provider: "mock", IPs: []string{"1.1.1.1"}, TTL: 60},
+			{Type: events.TypeEndpointUp, Domain: "example.com", Provider: "mock", IP: "1.1.1.1"},
+		}, drain(ch))
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		hc, _, ch := newHealthChecker(dns.NewMockProvider(true))
+
+		hc.checkAndUpdateDNS(t.Context())
+		received := drain(ch)
+		require.Len(t, received, 1)
+		assert.Equal(t, events.TypeProviderError, received[0].Type)
+		assert.Equal(t, "example.com", received[0].Domain)
+		assert.NotEmpty(t, received[0].Error)
+	})
+}
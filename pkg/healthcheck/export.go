@@ -0,0 +1,173 @@
+package healthcheck
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/tracing"
+	"github.com/italypaleale/ddup/pkg/utils"
+)
+
+// RecordState contains the desired and actual state of the records of a type for a domain
+type RecordState struct {
+	// Name of the records, which is the domain's name or one of its aliases
+	Domain     string `json:"domain"`
+	Provider   string `json:"provider"`
+	RecordType string `json:"recordType"`
+	TTL        int    `json:"ttl"`
+	// IPs that ddup publishes, or the target of the CNAME record
+	Desired []string `json:"desired"`
+	// IPs published by the provider
+	// It's nil if the provider can't return its records, or if reading them failed
+	Actual []string `json:"actual"`
+	// True if the actual records are known, and they match the desired ones
+	InSync bool `json:"inSync"`
+	// Error reading the actual records from the provider
+	Error string `json:"error,omitempty"`
+}
+
+// ExportRecords returns the desired and actual state of the records of all domains, sorted by domain and record type
+// The desired state is the one computed in the last check, and the actual state is read from the providers
+func (hc *HealthChecker) ExportRecords(ctx context.Context) []RecordState {
+	dcs := hc.getDomainCheckers()
+
+	ctx, span := tracing.Tracer().Start(ctx, "export records")
+	defer span.End()
+
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	res := make([]RecordState, 0, len(dcs))
+	for name, dc := range dcs {
+		wg.Go(func() {
+			states := dc.exportRecords(ctx, name)
+			lock.Lock()
+			res = append(res, states...)
+			lock.Unlock()
+		})
+	}
+	wg.Wait()
+
+	sortRecordStates(res)
+	return res
+}
+
+// exportRecords returns the desired and actual state of the records of the domain
+func (dc *domainChecker) exportRecords(ctx context.Context, domainName string) []RecordState {
+	healthyIPs, _, _, _ := dc.getState()
+	_, publishedTTL := dc.getTTLState()
+	ttl := cmp.Or(publishedTTL, dc.ttl)
+
+	// Record types used by the domain, from the IPs of the endpoints that were last checked
+	dc.lock.Lock()
+	ips := slices.Concat(healthyIPs, dc.fallbackIPs, dc.endpointIPs)
+	ips = slices.AppendSeq(ips, maps.Keys(dc.lastResults))
+	dc.lock.Unlock()
+
+	reader, _ := dc.provider.(dns.RecordReader)
+	names := append([]string{domainName}, dc.aliases...)
+	res := make([]RecordState, 0, 2*len(names))
+	for _, name := range names {
+		for _, recordType := range dc.recordTypes() {
+			desired, ok := dc.desiredRecords(recordType, ips, healthyIPs)
+			if !ok {
+				continue
+			}
+
+			state := RecordState{
+				Domain:     name,
+				Provider:   dc.provider.Name(),
+				RecordType: recordType,
+				TTL:        ttl,
+				Desired:    desired,
+			}
+			if reader != nil {
+				spanCtx, span := startProviderSpan(ctx, dc, "GetRecords", attribute.String("dns.record_type", recordType))
+				published, err := reader.GetRecords(spanCtx, name, recordType)
+				tracing.EndSpan(span, err)
+				if err != nil {
+					state.Error = "Error getting " + recordType + " records: " + err.Error()
+				} else {
+					state.Actual = normalizeIPs(published)
+					state.InSync = utils.ElementsMatch(state.Actual, state.Desired)
+				}
+			}
+			res = append(res, state)
+		}
+	}
+
+	return res
+}
+
+// PlanRecordStates returns the desired and actual state of the records from the plans returned by Plan, sorted by domain and record type
+// Domains whose records would not be updated, or whose plan could not be computed, are not included
+func PlanRecordStates(plans map[string]DomainPlan) []RecordState {
+	res := make([]RecordState, 0, len(plans))
+	for domain, plan := range plans {
+		for _, r := range plan.Records {
+			res = append(res, RecordState{
+				Domain:     cmp.Or(r.Name, domain),
+				Provider:   plan.Provider,
+				RecordType: r.RecordType,
+				TTL:        plan.TTL,
+				Desired:    r.Desired,
+				Actual:     r.Current,
+				InSync:     r.Known() && len(r.Add) == 0 && len(r.Remove) == 0,
+				Error:      r.Error,
+			})
+		}
+	}
+
+	sortRecordStates(res)
+	return res
+}
+
+// WriteRecordStatesCSV writes the state of the records in CSV format, with a header row
+// Lists of IPs are separated by spaces
+func WriteRecordStatesCSV(w io.Writer, states []RecordState) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"domain", "provider", "recordType", "ttl", "desired", "actual", "inSync", "error"})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range states {
+		err = cw.Write([]string{
+			s.Domain,
+			s.Provider,
+			s.RecordType,
+			strconv.Itoa(s.TTL),
+			strings.Join(s.Desired, " "),
+			strings.Join(s.Actual, " "),
+			strconv.FormatBool(s.InSync),
+			s.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// sortRecordStates sorts the state of the records by domain and record type
+func sortRecordStates(states []RecordState) {
+	slices.SortFunc(states, func(a, b RecordState) int {
+		return cmp.Or(
+			cmp.Compare(a.Domain, b.Domain),
+			cmp.Compare(a.RecordType, b.RecordType),
+		)
+	})
+}
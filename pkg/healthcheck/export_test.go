@@ -0,0 +1,86 @@
+package healthcheck
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestHealthChecker_ExportRecords(t *testing.T) {
+	newDomainChecker := func(domain string, provider dns.Provider, healthyIPs []string, endpointIPs []string) *domainChecker {
+		return &domainChecker{
+			checker: &checker.MockChecker{
+				Domain: domain,
+			},
+			ttl:         60,
+			healthyIPs:  healthyIPs,
+			failedIPs:   make(map[string]int),
+			provider:    provider,
+			endpointIPs: endpointIPs,
+		}
+	}
+
+	mockProvider := dns.NewMockProvider(false)
+	mockProvider.LastIPs = map[string][]string{
+		dns.RecordTypeA:    {"1.1.1.1", "9.9.9.9"},
+		dns.RecordTypeAAAA: {"2001:db8::1"},
+	}
+	hc := &HealthChecker{
+		domainCheckers: map[string]*domainChecker{
+			"b.example.com": newDomainChecker("b.example.com", mockProvider, []string{"1.1.1.1", "2001:db8::1"}, []string{"1.1.1.1", "2.2.2.2", "2001:db8::1"}),
+			"a.example.com": newDomainChecker("a.example.com", &writeOnlyProvider{}, []string{"3.3.3.3"}, []string{"3.3.3.3"}),
+			"c.example.com": newDomainChecker("c.example.com", dns.NewMockProvider(true), []string{}, []string{"4.4.4.4"}),
+		},
+	}
+
+	states := hc.ExportRecords(t.Context())
+	require.Len(t, states, 4)
+
+	// Provider can't return its records
+	assert.Equal(t, RecordState{Domain: "a.example.com", Provider: "writeonly", RecordType: "A", TTL: 60, Desired: []string{"3.3.3.3"}}, states[0])
+
+	assert.Equal(t, "b.example.com", states[1].Domain)
+	assert.Equal(t, dns.RecordTypeA, states[1].RecordType)
+	assert.Equal(t, []string{"1.1.1.1"}, states[1].Desired)
+	assert.Equal(t, []string{"1.1.1.1", "9.9.9.9"}, states[1].Actual)
+	assert.False(t, states[1].InSync)
+
+	assert.Equal(t, dns.RecordTypeAAAA, states[2].RecordType)
+	assert.True(t, states[2].InSync)
+
+	// Error reading the records
+	assert.Equal(t, "c.example.com", states[3].Domain)
+	assert.Empty(t, states[3].Desired)
+	assert.Nil(t, states[3].Actual)
+	assert.Contains(t, states[3].Error, "mock error")
+}
+
+func TestPlanRecordStates(t *testing.T) {
+	states := PlanRecordStates(map[string]DomainPlan{
+		"b.example.com": {
+			Provider: "mock",
+			TTL:      60,
+			Records: []RecordsPlan{
+				{RecordType: dns.RecordTypeAAAA, Desired: []string{"2001:db8::1"}, Current: []string{"2001:db8::1"}},
+				{RecordType: dns.RecordTypeA, Desired: []string{"1.1.1.1"}, Current: []string{}, Add: []string{"1.1.1.1"}},
+			},
+		},
+		"a.example.com": {Provider: "mock", Skipped: "no healthy endpoints"},
+	})
+	require.Len(t, states, 2)
+	assert.Equal(t, dns.RecordTypeA, states[0].RecordType)
+	assert.False(t, states[0].InSync)
+	assert.Equal(t, dns.RecordTypeAAAA, states[1].RecordType)
+	assert.True(t, states[1].InSync)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRecordStatesCSV(&buf, states))
+	assert.Equal(t, "domain,provider,recordType,ttl,desired,actual,inSync,error\n"+
+		"b.example.com,mock,A,60,1.1.1.1,,false,\n"+
+		"b.example.com,mock,AAAA,60,2001:db8::1,2001:db8::1,true,\n", buf.String())
+}
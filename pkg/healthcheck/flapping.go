@@ -0,0 +1,100 @@
+package healthcheck
+
+import (
+	"slices"
+	"time"
+)
+
+// flapState tracks the state changes of an endpoint, to detect flapping
+type flapState struct {
+	// Last health state of the endpoint
+	healthy bool
+	// Times of the state changes within the window
+	changes []time.Time
+	// The endpoint is held out of DNS until this time
+	dampenedUntil time.Time
+}
+
+// applyFlapping records the health of the endpoints and removes the ones that are flapping from the list of healthy IPs
+// It returns the updated list of healthy IPs, and the IPs of endpoints that started flapping with this check
+func (dc *domainChecker) applyFlapping(now time.Time, ips []string, healthyIPs []string) (res []string, started []string) {
+	if dc.flapping == nil {
+		return healthyIPs, nil
+	}
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if dc.flaps == nil {
+		dc.flaps = make(map[string]*flapState, len(ips))
+	}
+
+	cutoff := now.Add(-dc.flapping.Window)
+	for _, ip := range ips {
+		healthy := slices.Contains(healthyIPs, ip)
+		st, ok := dc.flaps[ip]
+		if !ok {
+			dc.flaps[ip] = &flapState{healthy: healthy}
+			continue
+		}
+
+		// Forget state changes that are outside of the window
+		st.changes = slices.DeleteFunc(st.changes, func(t time.Time) bool {
+			return t.Before(cutoff)
+		})
+
+		if healthy == st.healthy {
+			continue
+		}
+
+		st.healthy = healthy
+		st.changes = append(st.changes, now)
+		if len(st.changes) > dc.flapping.Threshold {
+			if !now.Before(st.dampenedUntil) {
+				started = append(started, ip)
+			}
+			// If the endpoint keeps flapping, the dampening period is extended
+			st.dampenedUntil = now.Add(dc.flapping.Dampening)
+		}
+	}
+
+	// Remove the state of endpoints that don't exist anymore
+	for ip := range dc.flaps {
+		if !slices.Contains(ips, ip) {
+			delete(dc.flaps, ip)
+		}
+	}
+
+	res = make([]string, 0, len(healthyIPs))
+	for _, ip := range healthyIPs {
+		st, ok := dc.flaps[ip]
+		if ok && now.Before(st.dampenedUntil) {
+			continue
+		}
+		res = append(res, ip)
+	}
+
+	return res, started
+}
+
+// getFlappingIPs returns the IPs of the endpoints that are held out of DNS because they are flapping
+func (dc *domainChecker) getFlappingIPs(now time.Time) []string {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	var res []string
+	for ip, st := range dc.flaps {
+		if now.Before(st.dampenedUntil) {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
+
+// getFlapStates returns the state used for flapping detection, so it can be carried over after a configuration update
+func (dc *domainChecker) getFlapStates() map[string]*flapState {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.flaps
+}
@@ -1,60 +1,392 @@
 package healthcheck
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
 	"maps"
 	"math"
+	"math/rand/v2"
 	"slices"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/discovery"
 	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/events"
 	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+	"github.com/italypaleale/ddup/pkg/ipsource"
+	"github.com/italypaleale/ddup/pkg/ipv6prefix"
+	"github.com/italypaleale/ddup/pkg/logging"
 	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+	"github.com/italypaleale/ddup/pkg/quorum"
+	"github.com/italypaleale/ddup/pkg/tracing"
 	"github.com/italypaleale/ddup/pkg/utils"
 )
 
+// Keys used to track repeated failures of a domain
+const (
+	// Prefix for the failures of an endpoint, followed by its IP
+	failureKeyEndpoint = "endpoint:"
+	// Failures updating the DNS records
+	failureKeyUpdate = "update"
+)
+
 // HealthChecker manages health checking and DNS updates
 type HealthChecker struct {
 	// Key is domain name
 	domainCheckers map[string]*domainChecker
+	metrics        *appmetrics.AppMetrics
+	events         *events.Bus
+	// If set, DNS records are updated only when this replica is the leader
+	leader LeaderElector
+	// If set, receives the result of every health check
+	// It's set before the health checker is started
+	results ResultRecorder
+	// Observations reported by remote checker agents
+	// They are kept when the configuration is updated
+	reports *quorum.Reports
+
+	// Lock for domainCheckers
+	lock sync.RWMutex
+	// Lock held while a check cycle is scheduled, or while the configuration is updated
+	cycleLock sync.Mutex
+	// Tracks the check cycles that are running in background goroutines
+	cycles sync.WaitGroup
+	// Interval between check cycles when the health checker is started
+	interval time.Duration
+	// Receives the new interval when the configuration is updated
+	intervalCh chan time.Duration
+	// Receives a message when a check cycle should be run right away
+	checkCh chan struct{}
+	// Maximum random delay for the checks of each domain within a cycle
+	// Protected by cycleLock
+	jitter time.Duration
+	// Path to the file where the state is persisted; empty if disabled
+	// Protected by cycleLock
+	stateFile string
+	// Configuration for heartbeat pings sent after successful cycles
+	// Protected by cycleLock
+	heartbeat config.ConfigHeartbeat
+	// Lock for persisting the state
+	stateLock sync.Mutex
+	// State that was last saved to the state file
+	savedState []byte
+}
+
+// NewHealthChecker creates a new HealthChecker instance for the domains in the configuration
+// State transitions are published to the events bus, which can be nil
+// When running multiple replicas, leader is used to update DNS records from the leader only; if nil, this replica always updates them
+func NewHealthChecker(cfg *config.Config, dnsProviders map[string]dns.Provider, metrics *appmetrics.AppMetrics, bus *events.Bus, leader LeaderElector) (*HealthChecker, error) {
+	reports := quorum.NewReports()
+	dcs, err := newDomainCheckers(cfg, dnsProviders, metrics, reports)
+	if err != nil {
+		return nil, err
+	}
+
+	// At startup, we don't know what's published in DNS, so records are reconciled in the first check
+	for _, dc := range dcs {
+		dc.reconcilePending = true
+	}
+
+	// Restore the state persisted before the last restart, if any
+	// An invalid state file does not prevent the health checker from starting
+	if cfg.StateFile != "" {
+		state, err := loadState(cfg.StateFile)
+		switch {
+		case err != nil:
+			logger().Warn("Failed to restore persisted state, ignoring", "path", cfg.StateFile, "error", err)
+		case state != nil:
+			restoreState(dcs, state)
+			logger().Info("Restored persisted state", "path", cfg.StateFile)
+		}
+	}
+
+	return &HealthChecker{
+		domainCheckers: dcs,
+		metrics:        metrics,
+		events:         bus,
+		leader:         leader,
+		reports:        reports,
+		interval:       cfg.Interval,
+		intervalCh:     make(chan time.Duration, 1),
+		checkCh:        make(chan struct{}, 1),
+		jitter:         cfg.Jitter,
+		stateFile:      cfg.StateFile,
+		heartbeat:      cfg.Heartbeat,
+	}, nil
 }
 
-// NewHealthChecker creates a new HealthChecker instance
-func NewHealthChecker(dnsProviders map[string]dns.Provider, metrics *appmetrics.AppMetrics) (*HealthChecker, error) {
-	cfg := config.Get()
+// SetResultRecorder sets the recorder that receives the result of every health check
+// It must be invoked before Run.
+func (hc *HealthChecker) SetResultRecorder(recorder ResultRecorder) {
+	hc.results = recorder
+}
 
+// newDomainCheckers creates the domain checkers for the domains in the configuration
+// If remote checker agents are enabled, their observations are read from reports
+// When running as an agent, providers are not used, and dnsProviders can be nil
+func newDomainCheckers(cfg *config.Config, dnsProviders map[string]dns.Provider, metrics *appmetrics.AppMetrics, reports *quorum.Reports) (map[string]*domainChecker, error) {
+	var err error
 	dcs := make(map[string]*domainChecker, len(cfg.Domains))
+
+	// The limiter is shared by all domains
+	limiter := checker.NewLimiter(cfg.MaxConcurrentChecks)
+
+	// IP sources are shared by all domains too
+	ipSources := ipsource.NewRegistry(cfg)
+
+	// So are observations from other vantage points
+	var q *quorum.Quorum
+	if cfg.Quorum != nil {
+		q = quorum.New(cfg.Quorum)
+	}
+	var ownership *dns.Ownership
+	if cfg.Ownership != nil && cfg.Agent == nil {
+		ownership = dns.NewOwnership(cfg.Ownership)
+	}
+	var agentsMaxAge time.Duration
+	if cfg.Agents != nil {
+		agentsMaxAge = cfg.Agents.MaxAge
+	} else {
+		reports = nil
+	}
 	for _, d := range cfg.Domains {
 		provider, ok := dnsProviders[d.Provider]
-		if !ok || provider == nil {
+		if (!ok || provider == nil) && cfg.Agent == nil {
 			return nil, fmt.Errorf("domain '%s' references DNS provider '%s' that is not configured", d.RecordName, d.Provider)
 		}
+		var prefixSource ipv6prefix.Source
+		if d.IPv6Prefix != nil {
+			prefixSource, err = ipv6prefix.NewSource(d.IPv6Prefix)
+			if err != nil {
+				return nil, fmt.Errorf("domain '%s' has an invalid IPv6 prefix configuration: %w", d.RecordName, err)
+			}
+		}
+		endpointIPs := make([]string, 0, len(d.Endpoints))
+		var endpointSources map[string]ipsource.Source
+		for _, e := range d.Endpoints {
+			if e.IPFrom == "" {
+				endpointIPs = append(endpointIPs, e.Address())
+				continue
+			}
+
+			if endpointSources == nil {
+				endpointSources = make(map[string]ipsource.Source)
+			}
+			endpointSources[e.IPFrom], err = ipSources.Get(e)
+			if err != nil {
+				return nil, fmt.Errorf("domain '%s' endpoint '%s' has an invalid IP source: %w", d.RecordName, e.Name, err)
+			}
+		}
+		if d.RoutingPolicy == config.RoutingPolicyWeighted && cfg.Agent == nil {
+			_, ok = provider.(dns.WeightedProvider)
+			if !ok {
+				return nil, fmt.Errorf("domain '%s' uses the weighted routing policy, but DNS provider '%s' does not support it", d.RecordName, d.Provider)
+			}
+		}
+		if d.RoutingPolicy == config.RoutingPolicyCNAME && cfg.Agent == nil {
+			_, ok = provider.(dns.CNAMERecordProvider)
+			if !ok {
+				return nil, fmt.Errorf("domain '%s' uses the cname routing policy, but DNS provider '%s' does not support CNAME records", d.RecordName, d.Provider)
+			}
+		}
+		if d.DeletionPolicy != "" && d.DeletionPolicy != config.DeletionPolicyFull && cfg.Agent == nil {
+			_, ok = provider.(dns.RecordReader)
+			if !ok {
+				return nil, fmt.Errorf("domain '%s' uses the deletion policy '%s', but DNS provider '%s' can't return its records", d.RecordName, d.DeletionPolicy, d.Provider)
+			}
+		}
+		if ownership != nil && d.RoutingPolicy != config.RoutingPolicyWeighted {
+			err = dns.CheckOwnershipSupport(provider)
+			if err != nil {
+				return nil, fmt.Errorf("domain '%s' cannot use ownership records: %w", d.RecordName, err)
+			}
+		}
+		newChecker := func(endpoints []*config.ConfigEndpoint) (checker.Checker, error) {
+			return checker.New(d.RecordName, endpoints, d.HealthChecks, limiter, metrics)
+		}
+		var chk checker.Checker
+		chk, err = newChecker(d.Endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create health checker for domain '%s': %w", d.RecordName, err)
+		}
+		var (
+			discoverySource   discovery.Source
+			discoveryInterval time.Duration
+		)
+		if d.Discovery != nil {
+			discoverySource, err = discovery.New(d.Discovery)
+			if err != nil {
+				return nil, fmt.Errorf("domain '%s' has an invalid discovery configuration: %w", d.RecordName, err)
+			}
+			discoveryInterval = d.Discovery.Interval
+		}
 		dcs[d.RecordName] = &domainChecker{
-			checker:   checker.New(d.RecordName, d.Endpoints, d.HealthChecks, metrics),
-			ttl:       d.TTL,
-			failedIPs: make(map[string]int, 0),
-			provider:  provider,
+			checker:        chk,
+			ttl:            d.TTL,
+			policy:         d.RoutingPolicy,
+			conflictPolicy: d.ConflictPolicy,
+			deletionPolicy: d.DeletionPolicy,
+			aliases:        d.Aliases(),
+			failedIPs:      make(map[string]int, 0),
+			provider:       provider,
+
+			prefixSource:       prefixSource,
+			ipSources:          endpointSources,
+			maintenanceWindows: cfg.Providers[d.Provider].MaintenanceWindows,
+			flapping:           d.HealthChecks.Flapping,
+			endpointIPs:        endpointIPs,
+			minHealthy:         d.MinHealthy,
+			fallbackIPs:        d.FallbackIPs,
+			dynamicTTL:         d.DynamicTTL,
+			reconcileInterval:  cfg.ReconcileInterval,
+			failures:           logging.NewRepeatedFailures(cfg.Logs.FailureSummaryInterval),
+			discovery:          discoverySource,
+			discoveryInterval:  discoveryInterval,
+			staticEndpoints:    d.Endpoints,
+			newChecker:         newChecker,
+			quorum:             q,
+			agentReports:       reports,
+			agentsMaxAge:       agentsMaxAge,
+			ownership:          ownership,
 		}
 	}
 
-	return &HealthChecker{
-		domainCheckers: dcs,
-	}, nil
+	return dcs, nil
+}
+
+// UpdateConfig applies a new configuration to the health checker, such as after the configuration file is reloaded.
+// The state of domains that are still present and use the same provider is preserved.
+// If a check is running for a domain, this method blocks until it's done.
+func (hc *HealthChecker) UpdateConfig(cfg *config.Config, dnsProviders map[string]dns.Provider) error {
+	dcs, err := newDomainCheckers(cfg, dnsProviders, hc.metrics, hc.reports)
+	if err != nil {
+		return err
+	}
+
+	hc.cycleLock.Lock()
+	defer hc.cycleLock.Unlock()
+
+	// Retire the previous domain checkers, so they don't update records anymore
+	// This waits for checks that are in progress
+	for _, old := range hc.getDomainCheckers() {
+		old.retire()
+	}
+
+	// Carry over the state of existing domains
+	// We do not carry over the "synced" flag, so domains using the weighted routing policy are updated in case weights were changed
+	for name, dc := range dcs {
+		old, ok := hc.getDomainChecker(name)
+		if !ok || old.provider.Name() != dc.provider.Name() {
+			continue
+		}
+
+		healthyIPs, failedIPs, lastUpdated, lastError := old.getState()
+		dc.healthyIPs = healthyIPs
+		dc.failedIPs = maps.Clone(failedIPs)
+		dc.lastUpdated = lastUpdated
+		dc.lastError = lastError
+		dc.lastWarning = old.getWarning()
+		if dc.flapping != nil {
+			dc.flaps = old.getFlapStates()
+		}
+		if dc.dynamicTTL != nil {
+			dc.unstableUntil, dc.publishedTTL = old.getTTLState()
+		}
+		dc.reconcilePending, dc.lastReconciled = old.getReconcileState()
+		dc.publishedIPs = old.getPublishedIPs()
+		dc.domainDegraded = old.isDomainDegraded()
+		if old.failures != nil {
+			dc.failures = old.failures
+			dc.failures.SetInterval(cfg.Logs.FailureSummaryInterval)
+		}
+		for _, ip := range old.getDrainedIPs() {
+			if dc.hasEndpointIP(ip) {
+				dc.setDrained(ip, true)
+			}
+		}
+		dc.paused = old.isPaused()
+	}
+
+	hc.lock.Lock()
+	hc.domainCheckers = dcs
+	hc.lock.Unlock()
+
+	hc.interval = cfg.Interval
+	hc.jitter = cfg.Jitter
+	hc.stateFile = cfg.StateFile
+	hc.heartbeat = cfg.Heartbeat
+
+	// Notify the run loop of the new interval, replacing any value that wasn't consumed yet
+	if hc.intervalCh != nil {
+		select {
+		case <-hc.intervalCh:
+		default:
+		}
+		hc.intervalCh <- cfg.Interval
+	}
+
+	return nil
+}
+
+// TriggerCheck requests the run loop to perform a check cycle right away, without waiting for it
+// If a request is already pending, this is a no-op
+func (hc *HealthChecker) TriggerCheck() {
+	if hc.checkCh == nil {
+		return
+	}
+
+	select {
+	case hc.checkCh <- struct{}{}:
+	default:
+	}
+}
+
+func (hc *HealthChecker) getDomainCheckers() map[string]*domainChecker {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+
+	// The map is never modified after it's been set, so we can return it directly
+	return hc.domainCheckers
+}
+
+func (hc *HealthChecker) getDomainChecker(domain string) (*domainChecker, bool) {
+	hc.lock.RLock()
+	defer hc.lock.RUnlock()
+
+	dc, ok := hc.domainCheckers[domain]
+	return dc, ok
 }
 
 func (hc *HealthChecker) Run(ctx context.Context) error {
-	cfg := config.Get()
+	hc.cycleLock.Lock()
+	interval := hc.interval
+	jitter := hc.jitter
+	hc.cycleLock.Unlock()
 
-	slog.InfoContext(ctx, "Health checker started", "interval", cfg.Interval)
+	logger().InfoContext(ctx, "Health checker started", "interval", interval, "jitter", jitter)
+
+	// Check cycles run in background goroutines, so a slow domain does not delay the next cycle
+	// Before returning, wait for cycles in progress to complete
+	defer hc.cycles.Wait()
+
+	// When this replica becomes the leader, a check cycle is run right away, so records are updated without waiting for the next interval
+	var electedCh <-chan struct{}
+	if hc.leader != nil {
+		electedCh = hc.leader.Elected()
+	}
 
 	// Run immediately
-	hc.checkAndUpdateDNS(ctx)
+	hc.startCycle(ctx)
 
 	// Run on an interval until the context is canceled
-	ticker := time.NewTicker(cfg.Interval)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -62,78 +394,572 @@ func (hc *HealthChecker) Run(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-ticker.C:
-			hc.checkAndUpdateDNS(ctx)
+			hc.startCycle(ctx)
+		case <-hc.checkCh:
+			hc.startCycle(ctx)
+		case <-electedCh:
+			hc.startCycle(ctx)
+		case interval := <-hc.intervalCh:
+			logger().InfoContext(ctx, "Health checker interval updated", "interval", interval)
+			ticker.Reset(interval)
 		}
 	}
 }
 
+// startCycle runs a check cycle in a background goroutine
+func (hc *HealthChecker) startCycle(ctx context.Context) {
+	hc.cycles.Go(func() {
+		hc.checkAndUpdateDNS(ctx)
+	})
+}
+
 // checkAndUpdateDNS performs health checks and updates DNS if needed
+// Each domain is processed in its own goroutine, so a slow domain or provider does not delay the others
+// This method returns after all domains are processed
 func (hc *HealthChecker) checkAndUpdateDNS(ctx context.Context) {
+	ctx, span := tracing.Tracer().Start(ctx, "check cycle")
+	defer span.End()
+
+	hc.cycleLock.Lock()
+	scheduled := scheduleDomains(hc.getDomainCheckers(), hc.jitter)
+	stateFile := hc.stateFile
+	heartbeat := hc.heartbeat
+	hc.cycleLock.Unlock()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, sd := range scheduled {
+		wg.Go(func() {
+			// With jitter enabled, wait until the time the domain is scheduled for, so checks and updates are spread across the interval
+			if sd.delay > 0 && !waitUntil(ctx, start.Add(sd.delay)) {
+				return
+			}
+
+			hc.checkDomain(ctx, sd.name, sd.dc)
+		})
+	}
+	wg.Wait()
+
+	// Publish the changes of providers that apply them in batches, once per provider
+	dcs := make([]*domainChecker, len(scheduled))
+	for i, sd := range scheduled {
+		dcs[i] = sd.dc
+	}
+	flushed := flushProviders(ctx, dcs)
+
+	// Persist the state, so it can be restored after a restart
+	hc.persistState(ctx, stateFile)
+
+	// If all domains were checked and updated successfully, send a heartbeat ping
+	// When shutting down, the cycle may not have completed
+	if ctx.Err() == nil && flushed && cycleSucceeded(scheduled) {
+		sendHeartbeat(ctx, heartbeat)
+	}
+}
+
+// flushProviders publishes the pending changes of the providers used by the domains, calling each provider once
+// It returns false if any provider failed to publish its changes
+func flushProviders(ctx context.Context, dcs []*domainChecker) bool {
+	ok := true
+	flushed := make(map[string]struct{}, len(dcs))
+	for _, dc := range dcs {
+		name := dc.provider.Name()
+		_, done := flushed[name]
+		if done {
+			continue
+		}
+		flushed[name] = struct{}{}
+
+		err := dns.Flush(ctx, dc.provider)
+		if err != nil {
+			logger().ErrorContext(ctx, "Error publishing changes to DNS records", "provider", name, "error", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkDomain performs health checks for a domain and updates its records if needed
+// If a check for the same domain is still in progress, for example because the provider is slow, the domain is skipped
+func (hc *HealthChecker) checkDomain(ctx context.Context, domainName string, dc *domainChecker) {
+	domainLog := logger().With("domain", domainName)
+
+	if !dc.cycleLock.TryLock() {
+		domainLog.WarnContext(ctx, "Previous check for the domain is still in progress, skipping")
+		return
+	}
+	defer dc.cycleLock.Unlock()
+
+	hc.checkDomainLocked(ctx, domainName, dc)
+}
+
+// checkDomainLocked performs health checks for a domain and updates its records if needed
+// The caller must hold the domain's cycleLock
+func (hc *HealthChecker) checkDomainLocked(ctx context.Context, domainName string, dc *domainChecker) {
+	domainLog := logger().With("domain", domainName)
+
+	// The domain checker was replaced after the configuration was updated
+	if dc.retired {
+		return
+	}
+
+	if dc.isPaused() {
+		domainLog.DebugContext(ctx, "Domain is paused, skipping")
+		return
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "check domain",
+		trace.WithAttributes(attribute.String("dns.domain", domainName)),
+	)
+	defer span.End()
+
 	var err error
 
-	for domainName, dc := range hc.domainCheckers {
-		domainLog := slog.With("domain", domainName)
+	// Get the list of currently healthy and failed IPs
+	// We clone the failed IPs map to prevent concurrent access
+	// Changes to endpoints are not reported in the first check, when there's no previous state
+	currentHealthyIPs, failedIPs, lastUpdated, _ := dc.getState()
+	failedIPs = maps.Clone(failedIPs)
+	hasPrevState := !lastUpdated.IsZero()
+
+	// If the domain uses discovery, refresh the list of endpoints
+	dc.refreshEndpoints(ctx, domainLog)
+
+	// Perform health checks for this domain
+	results := dc.checker.CheckAll(ctx)
+
+	// Get the IPs of the endpoints, which could depend on the current IPv6 prefix
+	var ips []string
+	ips, err = dc.resolveIPs(ctx, results)
+	if err != nil {
+		domainLog.ErrorContext(ctx, "Error resolving endpoint IPs", "error", err)
+		dc.setError("Error resolving endpoint IPs: " + err.Error())
+		return
+	}
+
+	// With remote checker agents, the result of each endpoint is the one observed by the majority of vantage points
+	results = dc.applyAgentReports(ctx, domainLog, domainName, ips, results)
+
+	// Collect healthy IPs
+	newHealthyIPs := make([]string, 0, len(results))
+	lastResults := make(map[string]checker.Result, len(results))
+	for i, result := range results {
+		ip := ips[i]
+		lastResults[ip] = result
 
-		// Get the list of currently healthy and failed IPs
-		// We clone the failed IPs map to prevent concurrent access
-		currentHealthyIPs, failedIPs, _, _ := dc.getState()
-		failedIPs = maps.Clone(failedIPs)
+		// If the endpoint is healthy, save it in the healthy list and remove any record of recent failed attempts
+		if result.Healthy {
+			domainLog.DebugContext(ctx, "✓ Endpoint is healthy", "endpoint", result.Endpoint.Name, "ip", ip)
+			dc.failures.Resolved(ctx, domainLog, failureKeyEndpoint+ip, "✓ Endpoint recovered", "endpoint", result.Endpoint.Name, "ip", ip)
+			newHealthyIPs = append(newHealthyIPs, ip)
+			delete(failedIPs, ip)
+			continue
+		}
 
-		// Perform health checks for this domain
-		results := dc.checker.CheckAll(ctx)
+		// Endpoint is unhealthy
+		// When the endpoint stays down, only the first failure is logged in full
+		dc.failures.Log(ctx, domainLog, failureKeyEndpoint+ip, slog.LevelWarn, "✗ Endpoint health check failed", "endpoint", result.Endpoint.Name, "ip", ip, "error", result.Error)
+		failedIPs[ip]++
 
-		// Collect healthy IPs
-		newHealthyIPs := make([]string, 0, len(results))
-		for _, result := range results {
-			ip := result.Endpoint.IP
+		// Prevent overflows
+		if failedIPs[ip] < 0 {
+			failedIPs[ip] = math.MaxInt
+		}
+
+		// If the number of attempts is less than the maximum, we consider the endpoint healthy if it was healthy before
+		// This is to allow for retries
+		maxAttempts := dc.checker.GetMaxAttempts()
+		if !slices.Contains(currentHealthyIPs, ip) {
+			continue
+		}
+		if failedIPs[ip] < maxAttempts {
+			newHealthyIPs = append(newHealthyIPs, ip)
+			continue
+		}
 
-			// If the endpoint is healthy, save it in the healthy list and remove any record of recent failed attempts
-			if result.Healthy {
-				domainLog.DebugContext(ctx, "✓ Endpoint is healthy", "endpoint", result.Endpoint.Name, "ip", ip)
+		// With checks from multiple vantage points, the endpoint is removed only if the majority of them observe it as down
+		// This avoids failovers caused by network issues that affect this instance only
+		if dc.quorum != nil {
+			vote := dc.quorum.ConfirmDown(ctx, domainName, ip)
+			if !vote.Confirmed() {
+				domainLog.WarnContext(ctx, "Endpoint is down from this vantage point, but not for the majority of them; keeping it", "endpoint", result.Endpoint.Name, "ip", ip, "down", vote.Down, "voters", vote.Voters)
 				newHealthyIPs = append(newHealthyIPs, ip)
-				delete(failedIPs, ip)
-				continue
 			}
+		}
+	}
 
-			// Endpoint is unhealthy
-			domainLog.WarnContext(ctx, "✗ Endpoint health check failed", "endpoint", result.Endpoint.Name, "ip", ip, "error", result.Error)
-			failedIPs[ip]++
+	dc.setLastResults(lastResults)
 
-			// Prevent overflows
-			if failedIPs[ip] < 0 {
-				failedIPs[ip] = math.MaxInt
-			}
+	// Report the number of consecutive failures, which is 0 for healthy endpoints, so alerts can fire before endpoints are removed from DNS
+	for i, result := range results {
+		hc.metrics.RecordConsecutiveFailures(domainName, result.Endpoint.Name, failedIPs[ips[i]])
+		if hc.results != nil {
+			hc.results.RecordResult(domainName, ips[i], result)
+		}
+	}
 
-			// If the number of attempts is less than the maximum, we consider the endpoint healthy if it was healthy before
-			// This is to allow for retries
-			maxAttempts := dc.checker.GetMaxAttempts()
-			if failedIPs[ip] < maxAttempts && slices.Contains(currentHealthyIPs, ip) {
-				newHealthyIPs = append(newHealthyIPs, ip)
+	// Hold endpoints that are flapping out of DNS
+	var flappingIPs []string
+	newHealthyIPs, flappingIPs = dc.applyFlapping(time.Now(), ips, newHealthyIPs)
+	for _, ip := range flappingIPs {
+		domainLog.WarnContext(ctx, "Endpoint is flapping, holding it out of DNS", "ip", ip, "dampening", dc.flapping.Dampening)
+		hc.metrics.RecordFlapping(domainName, ip)
+	}
+
+	// Do not shrink the record set below the minimum number of healthy endpoints
+	// When the fallback IPs are published, there's no previous set of endpoints to keep
+	var belowMinHealthy bool
+	if dc.minHealthy > 0 && len(newHealthyIPs) < dc.minHealthy && len(newHealthyIPs) < len(currentHealthyIPs) && !dc.isFallback(currentHealthyIPs) {
+		domainLog.ErrorContext(ctx, "Fewer endpoints than minHealthy are healthy, keeping the previous IPs", "healthy", newHealthyIPs, "minHealthy", dc.minHealthy, "ips", currentHealthyIPs)
+		hc.metrics.RecordMinHealthyBreach(domainName)
+		newHealthyIPs = slices.Clone(currentHealthyIPs)
+		belowMinHealthy = true
+	}
+
+	// Remove endpoints that are drained
+	configuredIPs := make([]string, len(results))
+	for i, result := range results {
+		configuredIPs[i] = result.Endpoint.Address()
+	}
+	newHealthyIPs = dc.removeDrained(configuredIPs, ips, newHealthyIPs)
+
+	// The domain is degraded if it has no healthy endpoints, or fewer than the minimum
+	hc.publishDomainDegraded(domainName, dc, belowMinHealthy || len(newHealthyIPs) == 0, newHealthyIPs)
+
+	// If no endpoint is healthy, publish the fallback IPs
+	// The record types to update include those of the fallback IPs
+	if len(dc.fallbackIPs) > 0 {
+		if len(newHealthyIPs) == 0 {
+			if !dc.isFallback(currentHealthyIPs) {
+				domainLog.WarnContext(ctx, "No healthy endpoints found, publishing the fallback IPs", "fallbackIPs", dc.fallbackIPs)
 			}
+			newHealthyIPs = slices.Clone(dc.fallbackIPs)
 		}
+		ips = append(slices.Clone(ips), dc.fallbackIPs...)
+	}
 
-		// Check if healthy IPs have changed
-		if !utils.ElementsMatch(currentHealthyIPs, newHealthyIPs) {
-			// Update DNS records
-			if len(newHealthyIPs) > 0 {
-				err = dc.provider.UpdateRecords(ctx, dc.checker.GetDomain(), dc.ttl, newHealthyIPs)
-				if err != nil {
-					domainLog.ErrorContext(ctx, "Error updating DNS records", "error", err)
-					dc.setError("Error updating DNS records: " + err.Error())
+	// With dynamic TTL enabled, the TTL is lowered while the set of endpoints is changing or endpoints are flapping
+	// The first update after starting is not considered a change
+	// If the TTL changes, records are updated even if the IPs are the same
+	now := time.Now()
+	ipsChanged := !utils.ElementsMatch(currentHealthyIPs, newHealthyIPs)
+	ttl := dc.effectiveTTL(now, (ipsChanged && dc.isSynced()) || len(dc.getFlappingIPs(now)) > 0)
+	_, publishedTTL := dc.getTTLState()
+	ttlChanged := dc.dynamicTTL != nil && ttl != publishedTTL
 
-					// Continue, so we don't update the cached previous IPs
-					continue
-				}
+	// When running multiple replicas, only the leader updates DNS records
+	// Other replicas keep track of the healthy endpoints, and reconcile the records when they become the leader
+	if !hc.isLeader() {
+		domainLog.DebugContext(ctx, "Not the leader, skipping DNS update", "healthy", newHealthyIPs)
+		dc.setFollowerState(newHealthyIPs, failedIPs)
+		hc.recordEndpointChanges(domainName, dc, len(results), hasPrevState, currentHealthyIPs, newHealthyIPs)
+		return
+	}
 
-				domainLog.InfoContext(ctx, "Updated DNS records", "ips", newHealthyIPs)
-			} else {
-				domainLog.WarnContext(ctx, "No healthy endpoints found, not updating DNS")
+	// During a provider's maintenance window, updates are retried less frequently after a failure
+	// In this case, we do not update the state, so the update is attempted again later
+	// Updates that are forced are not delayed
+	if !dc.forceUpdate && dc.shouldDelayUpdate(now) {
+		domainLog.DebugContext(ctx, "Provider is in a maintenance window, delaying DNS update")
+		return
+	}
+
+	// With the weighted routing policy, all endpoints are sent to the provider, which handles health natively
+	if dc.policy == config.RoutingPolicyWeighted {
+		if dc.forceUpdate || !dc.isSynced() || ipsChanged || ttlChanged {
+			err = updateWeightedRecords(ctx, dc, results, ips, newHealthyIPs, ttl)
+			if err != nil {
+				hc.handleUpdateError(ctx, domainLog, domainName, dc, "Error updating weighted DNS records", err)
+				return
 			}
+
+			domainLog.InfoContext(ctx, "Updated weighted DNS records", "healthy", newHealthyIPs, "ttl", ttl)
+			dc.forceUpdate = false
+			dc.failures.Resolved(ctx, domainLog, failureKeyUpdate, "DNS records updated after previous errors")
+			dc.setPublishedTTL(ttl)
+			hc.publishDNSUpdated(domainName, dc, newHealthyIPs, ttl)
 		} else {
 			domainLog.DebugContext(ctx, "Healthy IPs unchanged, skipping DNS update", "healthy", newHealthyIPs)
 		}
 
-		// Update the stored previous IPs
 		dc.setState(newHealthyIPs, failedIPs)
+		if belowMinHealthy {
+			dc.setMinHealthyWarning()
+		}
+		hc.recordEndpointChanges(domainName, dc, len(results), hasPrevState, currentHealthyIPs, newHealthyIPs)
+		return
+	}
+
+	// With the cname routing policy, the records point at the target of a single healthy endpoint
+	if dc.policy == config.RoutingPolicyCNAME {
+		target, _ := dc.desiredRecords(dns.RecordTypeCNAME, ips, newHealthyIPs)
+		currentTarget, _ := dc.desiredRecords(dns.RecordTypeCNAME, ips, currentHealthyIPs)
+		targetChanged := !slices.Equal(target, currentTarget)
+		switch {
+		case len(target) == 0:
+			domainLog.WarnContext(ctx, "No healthy endpoints found, not updating DNS")
+		case dc.forceUpdate || !dc.isSynced() || targetChanged || ttlChanged:
+			err = updateCNAMERecords(ctx, dc, target[0], ttl)
+			if err != nil {
+				hc.handleUpdateError(ctx, domainLog, domainName, dc, "Error updating CNAME records", err)
+				return
+			}
+
+			domainLog.InfoContext(ctx, "Updated CNAME records", "target", target[0], "ttl", ttl)
+			dc.forceUpdate = false
+			dc.failures.Resolved(ctx, domainLog, failureKeyUpdate, "DNS records updated after previous errors")
+			dc.setPublishedTTL(ttl)
+			hc.publishDNSUpdated(domainName, dc, target, ttl)
+		default:
+			domainLog.DebugContext(ctx, "CNAME target unchanged, skipping DNS update", "target", target[0])
+		}
+
+		dc.setState(newHealthyIPs, failedIPs)
+		if belowMinHealthy {
+			dc.setMinHealthyWarning()
+		}
+		hc.recordEndpointChanges(domainName, dc, len(results), hasPrevState, currentHealthyIPs, newHealthyIPs)
+		return
+	}
+
+	// If needed, compare the records published by the provider with the desired state, so changes made outside of ddup are corrected
+	// If there are no healthy IPs, records are not updated, so there's nothing to reconcile
+	var drifted bool
+	if len(newHealthyIPs) > 0 && dc.shouldReconcile(now) {
+		var published map[string][]string
+		drifted, published, err = detectDrift(ctx, dc, ips, newHealthyIPs)
+		known, conflictName := dc.checkPublished(ips, published)
+		switch {
+		case err != nil:
+			domainLog.WarnContext(ctx, "Error reading records from the provider, updating them", "error", err)
+			drifted = true
+		case !drifted:
+			dc.setReconciled(now)
+			dc.setPublishedIPs(published)
+		case conflictName != "":
+			// The records were changed outside of ddup after ddup last published them
+			domainLog.WarnContext(ctx, "Conflict detected: records published by the provider were changed outside of ddup", "name", conflictName, "published", published[conflictName], "ips", newHealthyIPs, "policy", dc.conflictPolicy)
+			hc.metrics.RecordDrift(domainName)
+			hc.events.Publish(events.Event{
+				Type:     events.TypeRecordsConflict,
+				Domain:   domainName,
+				Provider: dc.provider.Name(),
+				IPs:      published[conflictName],
+			})
+
+			switch dc.conflictPolicy {
+			case config.ConflictPolicyAdopt:
+				// Keep the records as they are, until the healthy IPs change
+				dc.setPublishedIPs(published)
+				dc.setReconciled(now)
+				drifted = false
+			case config.ConflictPolicyPause:
+				// Keep the records as they are, until an operator resumes the domain
+				domainLog.ErrorContext(ctx, "Pausing the domain because its records were changed outside of ddup; resume it to overwrite them")
+				dc.setPaused(true)
+				return
+			}
+		case known:
+			// The records are the ones that ddup last published, so they're updated only if the healthy IPs changed
+			drifted = false
+			dc.setReconciled(now)
+		default:
+			domainLog.WarnContext(ctx, "Drift detected: records published by the provider differ from the desired state, updating them", "ips", newHealthyIPs)
+			hc.metrics.RecordDrift(domainName)
+		}
+	}
+
+	// Check if healthy IPs or the TTL have changed, or if records need to be corrected
+	if ipsChanged || drifted || dc.forceUpdate || (ttlChanged && len(newHealthyIPs) > 0) {
+		// Update DNS records
+		if len(newHealthyIPs) > 0 {
+			var published map[string][]string
+			published, err = updateRecords(ctx, dc, ips, newHealthyIPs, ttl)
+			if err != nil {
+				hc.handleUpdateError(ctx, domainLog, domainName, dc, "Error updating DNS records", err)
+
+				// Return, so we don't update the cached previous IPs
+				return
+			}
+
+			domainLog.InfoContext(ctx, "Updated DNS records", "ips", published[domainName], "ttl", ttl)
+			dc.forceUpdate = false
+			dc.failures.Resolved(ctx, domainLog, failureKeyUpdate, "DNS records updated after previous errors")
+			dc.setPublishedTTL(ttl)
+			hc.publishDNSUpdated(domainName, dc, published[domainName], ttl)
+			dc.setReconciled(now)
+			dc.setPublishedIPs(published)
+		} else {
+			domainLog.WarnContext(ctx, "No healthy endpoints found, not updating DNS")
+		}
+	} else {
+		domainLog.DebugContext(ctx, "Healthy IPs unchanged, skipping DNS update", "healthy", newHealthyIPs)
 	}
+
+	// Update the stored previous IPs
+	dc.setState(newHealthyIPs, failedIPs)
+	if belowMinHealthy {
+		dc.setMinHealthyWarning()
+	}
+	hc.recordEndpointChanges(domainName, dc, len(results), hasPrevState, currentHealthyIPs, newHealthyIPs)
+}
+
+// isLeader returns true if this replica can update DNS records
+func (hc *HealthChecker) isLeader() bool {
+	return hc.leader == nil || hc.leader.IsLeader()
+}
+
+// scheduledDomain is a domain to check within a cycle
+type scheduledDomain struct {
+	name  string
+	dc    *domainChecker
+	delay time.Duration
+}
+
+// scheduleDomains returns the list of domains to check within a cycle
+// If jitter is greater than zero, each domain is assigned a random delay from the start of the cycle, and the list is sorted by delay
+func scheduleDomains(dcs map[string]*domainChecker, jitter time.Duration) []scheduledDomain {
+	res := make([]scheduledDomain, 0, len(dcs))
+	for name, dc := range dcs {
+		sd := scheduledDomain{name: name, dc: dc}
+		if jitter > 0 {
+			sd.delay = rand.N(jitter) //nolint:gosec
+		}
+		res = append(res, sd)
+	}
+
+	slices.SortFunc(res, func(a, b scheduledDomain) int {
+		return cmp.Compare(a.delay, b.delay)
+	})
+
+	return res
+}
+
+// waitUntil blocks until the given time
+// It returns false if the context is canceled first
+func waitUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// handleUpdateError records an error updating the DNS records of a domain
+// During a provider's maintenance window, errors are downgraded to warnings and the next attempt is delayed
+func (hc *HealthChecker) handleUpdateError(ctx context.Context, log *slog.Logger, domainName string, dc *domainChecker, msg string, err error) {
+	hc.metrics.RecordDNSUpdate(domainName, false)
+
+	now := time.Now()
+	w := dc.getMaintenanceWindow(now)
+	if w != nil {
+		dc.failures.Log(ctx, log, failureKeyUpdate, slog.LevelWarn, msg+" during provider maintenance window", "error", err, "retryInterval", w.RetryInterval)
+		dc.setWarning(msg+" during provider maintenance window: "+err.Error(), now.Add(w.RetryInterval))
+		return
+	}
+
+	dc.failures.Log(ctx, log, failureKeyUpdate, slog.LevelError, msg, "error", err)
+	dc.setError(msg + ": " + err.Error())
+	hc.events.Publish(events.Event{
+		Type:     events.TypeProviderError,
+		Domain:   domainName,
+		Provider: dc.provider.Name(),
+		Error:    err.Error(),
+	})
+}
+
+// updateRecords updates the records of a domain, for each name and type of record (A and AAAA) used by its endpoints
+// It returns the IPs that were published keyed by name, which include existing records kept because of the deletion policy
+func updateRecords(ctx context.Context, dc *domainChecker, ips []string, healthyIPs []string, ttl int) (map[string][]string, error) {
+	published := make(map[string][]string, len(dc.aliases)+1)
+	for _, name := range dc.recordNames() {
+		published[name] = make([]string, 0, len(healthyIPs))
+		for _, recordType := range []string{dns.RecordTypeA, dns.RecordTypeAAAA} {
+			// Skip record types that aren't used by any endpoint, so we don't touch records managed by others
+			if len(dns.FilterIPsByRecordType(ips, recordType)) == 0 {
+				continue
+			}
+
+			records := dns.FilterIPsByRecordType(healthyIPs, recordType)
+
+			// Unless all records are replaced, existing records are read so the ones to keep are published again
+			if dc.deletionPolicy != "" && dc.deletionPolicy != config.DeletionPolicyFull {
+				// This was validated when the domain checker was created
+				reader, ok := dc.provider.(dns.RecordReader)
+				if !ok {
+					return nil, fmt.Errorf("DNS provider '%s' can't return its records", dc.provider.Name())
+				}
+
+				spanCtx, span := startProviderSpan(ctx, dc, "GetRecords", attribute.String("dns.record_type", recordType))
+				existing, err := reader.GetRecords(spanCtx, name, recordType)
+				tracing.EndSpan(span, err)
+				if err != nil {
+					return nil, fmt.Errorf("error getting %s records for %s: %w", recordType, name, err)
+				}
+				records = dc.applyDeletionPolicy(ips, records, normalizeIPs(existing))
+			}
+
+			// With ownership records, records that are not owned by this instance are not modified
+			if dc.ownership != nil {
+				err := dc.ownership.Claim(ctx, dc.provider, name, recordType, ttl, records)
+				if err != nil {
+					return nil, fmt.Errorf("error checking ownership of %s records for %s: %w", recordType, name, err)
+				}
+			}
+
+			spanCtx, span := startProviderSpan(ctx, dc, "UpdateRecords", attribute.String("dns.record_type", recordType))
+			err := dc.provider.UpdateRecords(spanCtx, name, recordType, ttl, records)
+			tracing.EndSpan(span, err)
+			if err != nil {
+				return nil, fmt.Errorf("error updating %s records for %s: %w", recordType, name, err)
+			}
+			published[name] = append(published[name], records...)
+		}
+	}
+
+	return published, nil
+}
+
+// updateWeightedRecords sends all endpoints of a domain to a provider that supports weighted routing natively
+func updateWeightedRecords(ctx context.Context, dc *domainChecker, results []checker.Result, ips []string, healthyIPs []string, ttl int) error {
+	// This was validated when the domain checker was created
+	provider, ok := dc.provider.(dns.WeightedProvider)
+	if !ok {
+		return fmt.Errorf("DNS provider '%s' does not support weighted routing", dc.provider.Name())
+	}
+
+	records := make([]dns.WeightedRecord, len(results))
+	for i, result := range results {
+		records[i] = dns.WeightedRecord{
+			Name:    result.Endpoint.Name,
+			IP:      ips[i],
+			Weight:  result.Endpoint.GetWeight(),
+			Healthy: slices.Contains(healthyIPs, ips[i]),
+		}
+	}
+
+	ctx, span := startProviderSpan(ctx, dc, "UpdateWeightedRecords")
+	var err error
+	for _, name := range dc.recordNames() {
+		err = provider.UpdateWeightedRecords(ctx, name, ttl, records)
+		if err != nil {
+			break
+		}
+	}
+	tracing.EndSpan(span, err)
+	return err
+}
+
+// logger returns the logger for the health checker
+func logger() *slog.Logger {
+	return logging.Component("healthcheck")
 }
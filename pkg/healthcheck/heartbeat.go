@@ -0,0 +1,64 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// cycleSucceeded returns true if none of the domains checked in a cycle has an error
+func cycleSucceeded(scheduled []scheduledDomain) bool {
+	for _, sd := range scheduled {
+		_, _, _, lastError := sd.dc.getState()
+		if lastError != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// sendHeartbeat pings the heartbeat URL, so an external system can notice when ddup stops running
+func sendHeartbeat(ctx context.Context, cfg config.ConfigHeartbeat) {
+	if cfg.URL == "" {
+		return
+	}
+
+	err := pingHeartbeat(ctx, cfg)
+	if err != nil {
+		logger().WarnContext(ctx, "Failed to send heartbeat ping", "error", err)
+		return
+	}
+
+	logger().DebugContext(ctx, "Sent heartbeat ping")
+}
+
+func pingHeartbeat(ctx context.Context, cfg config.ConfigHeartbeat) error {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("invalid response status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
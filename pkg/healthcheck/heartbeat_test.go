@@ -0,0 +1,68 @@
+package healthcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestHealthChecker_Heartbeat(t *testing.T) {
+	var pings atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		pings.Add(1)
+	}))
+	defer srv.Close()
+
+	newHealthChecker := func(provider dns.Provider) *HealthChecker {
+		return &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": {
+					checker: &checker.MockChecker{
+						Domain:      "example.com",
+						MaxAttempts: 2,
+						Results:     []checker.Result{{Endpoint: &config.ConfigEndpoint{Name: "endpoint1", IP: "1.1.1.1"}, Healthy: true}},
+					},
+					ttl:       60,
+					failedIPs: make(map[string]int),
+					provider:  provider,
+				},
+			},
+			heartbeat: config.ConfigHeartbeat{URL: srv.URL, Timeout: 5 * time.Second},
+		}
+	}
+
+	t.Run("Ping after successful cycle", func(t *testing.T) {
+		pings.Store(0)
+		hc := newHealthChecker(dns.NewMockProvider(false))
+
+		hc.checkAndUpdateDNS(t.Context())
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, int32(2), pings.Load())
+	})
+
+	t.Run("No ping when a domain has errors", func(t *testing.T) {
+		pings.Store(0)
+		hc := newHealthChecker(dns.NewMockProvider(true))
+
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, int32(0), pings.Load())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		pings.Store(0)
+		hc := newHealthChecker(dns.NewMockProvider(false))
+		hc.heartbeat = config.ConfigHeartbeat{}
+
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, int32(0), pings.Load())
+	})
+}
@@ -0,0 +1,46 @@
+package healthcheck
+
+import (
+	"errors"
+)
+
+// ErrDomainPaused is returned when an operation can't be performed because the domain is paused
+var ErrDomainPaused = errors.New("domain is paused")
+
+// SetDomainPaused pauses health checks and DNS updates for a domain, or resumes them
+// While a domain is paused, its records are left unchanged
+// When a domain is resumed, a new check cycle is run right away
+func (hc *HealthChecker) SetDomainPaused(domain string, paused bool) error {
+	dc, ok := hc.getDomainChecker(domain)
+	if !ok {
+		return ErrDomainNotFound
+	}
+
+	dc.setPaused(paused)
+	if !paused {
+		hc.TriggerCheck()
+	}
+
+	return nil
+}
+
+// setPaused sets whether the domain is paused
+// When the domain is resumed, its records are compared with the desired state in the next check, and changes made outside of ddup while it was paused are overwritten
+func (dc *domainChecker) setPaused(paused bool) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.paused = paused
+	if !paused {
+		dc.reconcilePending = true
+		dc.publishedIPs = nil
+	}
+}
+
+// isPaused returns true if the domain is paused
+func (dc *domainChecker) isPaused() bool {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.paused
+}
@@ -0,0 +1,208 @@
+package healthcheck
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// DomainPlan contains the changes to the records of a domain that a check would apply
+type DomainPlan struct {
+	Provider string `json:"provider"`
+	TTL      int    `json:"ttl"`
+	// Results of the health checks of the endpoints
+	Endpoints []EndpointPlan `json:"endpoints,omitempty"`
+	// Changes for each type of record used by the domain
+	Records []RecordsPlan `json:"records,omitempty"`
+	// If set, the records of the domain would not be updated, for this reason
+	Skipped string `json:"skipped,omitempty"`
+	// Error computing the plan
+	Error string `json:"error,omitempty"`
+}
+
+// EndpointPlan contains the result of the health check of an endpoint
+type EndpointPlan struct {
+	Name string `json:"name,omitempty"`
+	// IP of the endpoint, or its target with the "cname" routing policy
+	Address string `json:"address"`
+	Healthy bool   `json:"healthy"`
+	// If true, the endpoint responded successfully, but its latency exceeded the maximum
+	Degraded bool `json:"degraded,omitempty"`
+	// Error returned by the health check
+	Error string `json:"error,omitempty"`
+}
+
+// RecordsPlan contains the changes to the records of a name and type
+type RecordsPlan struct {
+	// Name of the records, which is the domain's name or one of its aliases
+	Name       string `json:"name"`
+	RecordType string `json:"recordType"`
+	// IPs that would be published, or the target of the CNAME record
+	Desired []string `json:"desired"`
+	// IPs currently published by the provider
+	// It's nil if the provider can't return its records, or if reading them failed
+	Current []string `json:"current"`
+	// IPs that would be added and removed
+	// If the current records are not known, these are empty, and all records would be replaced with Desired
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+	// Error reading the current records from the provider
+	Error string `json:"error,omitempty"`
+}
+
+// Known returns true if the records currently published are known
+func (p RecordsPlan) Known() bool {
+	return p.Current != nil
+}
+
+// HasChanges returns true if applying the plan would change the records, or if that can't be determined
+func (p DomainPlan) HasChanges() bool {
+	if p.Skipped != "" || p.Error != "" {
+		return false
+	}
+	for _, r := range p.Records {
+		if !r.Known() || len(r.Add) > 0 || len(r.Remove) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan runs health checks for all domains once, and returns the changes to their records that would be applied, keyed by domain
+// Records are not updated, and the state of the health checker is not changed
+// Because checks are run once, retries and flapping detection do not apply, and endpoints that fail are not published
+func (hc *HealthChecker) Plan(ctx context.Context) map[string]DomainPlan {
+	dcs := hc.getDomainCheckers()
+
+	ctx, span := tracing.Tracer().Start(ctx, "plan")
+	defer span.End()
+
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	res := make(map[string]DomainPlan, len(dcs))
+	for name, dc := range dcs {
+		wg.Go(func() {
+			plan := dc.plan(ctx)
+			lock.Lock()
+			res[name] = plan
+			lock.Unlock()
+		})
+	}
+	wg.Wait()
+
+	return res
+}
+
+// plan runs health checks for the domain, and returns the changes to its records that would be applied
+func (dc *domainChecker) plan(ctx context.Context) DomainPlan {
+	dc.cycleLock.Lock()
+	defer dc.cycleLock.Unlock()
+
+	res := DomainPlan{
+		Provider: dc.provider.Name(),
+		TTL:      dc.ttl,
+	}
+
+	if dc.isPaused() {
+		res.Skipped = "domain is paused"
+		return res
+	}
+
+	dc.refreshEndpoints(ctx, logger().With("domain", dc.checker.GetDomain()))
+
+	results := dc.checker.CheckAll(ctx)
+	res.Endpoints = make([]EndpointPlan, len(results))
+	for i, result := range results {
+		res.Endpoints[i] = EndpointPlan{
+			Name:     result.Endpoint.Name,
+			Address:  result.Endpoint.Address(),
+			Healthy:  result.Healthy,
+			Degraded: result.Degraded,
+		}
+		if result.Error != nil {
+			res.Endpoints[i].Error = result.Error.Error()
+		}
+	}
+
+	ips, err := dc.resolveIPs(ctx, results)
+	if err != nil {
+		res.Error = "Error resolving endpoint IPs: " + err.Error()
+		return res
+	}
+	for i := range res.Endpoints {
+		res.Endpoints[i].Address = ips[i]
+	}
+
+	healthyIPs := make([]string, 0, len(results))
+	configuredIPs := make([]string, len(results))
+	for i, result := range results {
+		configuredIPs[i] = result.Endpoint.Address()
+		if result.Healthy {
+			healthyIPs = append(healthyIPs, ips[i])
+		}
+	}
+	healthyIPs = dc.removeDrained(configuredIPs, ips, healthyIPs)
+
+	if len(dc.fallbackIPs) > 0 {
+		if len(healthyIPs) == 0 {
+			healthyIPs = slices.Clone(dc.fallbackIPs)
+		}
+		ips = append(slices.Clone(ips), dc.fallbackIPs...)
+	}
+
+	if len(healthyIPs) == 0 {
+		res.Skipped = "no healthy endpoints"
+		return res
+	}
+
+	reader, _ := dc.provider.(dns.RecordReader)
+	for _, name := range dc.recordNames() {
+		for _, recordType := range dc.recordTypes() {
+			// Record types that aren't used by any endpoint are not managed by ddup
+			desired, ok := dc.desiredRecords(recordType, ips, healthyIPs)
+			if !ok {
+				continue
+			}
+
+			rp := RecordsPlan{
+				Name:       name,
+				RecordType: recordType,
+				Desired:    desired,
+			}
+			if reader != nil {
+				spanCtx, span := startProviderSpan(ctx, dc, "GetRecords", attribute.String("dns.record_type", recordType))
+				published, err := reader.GetRecords(spanCtx, name, recordType)
+				tracing.EndSpan(span, err)
+				if err != nil {
+					rp.Error = "Error getting " + recordType + " records: " + err.Error()
+				} else {
+					rp.Current = normalizeIPs(published)
+					rp.Desired = dc.applyDeletionPolicy(ips, rp.Desired, rp.Current)
+					rp.Add = diffIPs(rp.Desired, rp.Current)
+					rp.Remove = diffIPs(rp.Current, rp.Desired)
+				}
+			}
+			res.Records = append(res.Records, rp)
+		}
+	}
+
+	return res
+}
+
+// diffIPs returns the IPs in a that are not in b
+func diffIPs(a []string, b []string) []string {
+	var res []string
+	for _, ip := range a {
+		if !slices.Contains(b, ip) {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
@@ -0,0 +1,168 @@
+package healthcheck
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestHealthChecker_Plan(t *testing.T) {
+	endpoints := []*config.ConfigEndpoint{
+		{Name: "endpoint1", IP: "1.1.1.1"},
+		{Name: "endpoint2", IP: "2.2.2.2"},
+		{Name: "endpoint3", IP: "2001:db8::1"},
+	}
+	newDomainChecker := func(provider dns.Provider, healthy ...bool) *domainChecker {
+		results := make([]checker.Result, len(healthy))
+		for i, h := range healthy {
+			results[i] = checker.Result{Endpoint: endpoints[i], Healthy: h}
+			if !h {
+				results[i].Error = errors.New("connection failed")
+			}
+		}
+		return &domainChecker{
+			checker: &checker.MockChecker{
+				Domain:      "example.com",
+				MaxAttempts: 2,
+				Results:     results,
+			},
+			ttl:       60,
+			failedIPs: make(map[string]int),
+			provider:  provider,
+		}
+	}
+
+	t.Run("Changes", func(t *testing.T) {
+		mockProvider := dns.NewMockProvider(false)
+		mockProvider.LastIPs = map[string][]string{
+			dns.RecordTypeA:    {"1.1.1.1", "9.9.9.9"},
+			dns.RecordTypeAAAA: {"2001:db8::1"},
+		}
+		dc := newDomainChecker(mockProvider, true, true, true)
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{"example.com": dc},
+		}
+
+		plans := hc.Plan(t.Context())
+		require.Contains(t, plans, "example.com")
+		plan := plans["example.com"]
+		assert.Equal(t, "mock", plan.Provider)
+		assert.Equal(t, 60, plan.TTL)
+		assert.True(t, plan.HasChanges())
+		require.Len(t, plan.Endpoints, 3)
+		assert.Equal(t, EndpointPlan{Name: "endpoint1", Address: "1.1.1.1", Healthy: true}, plan.Endpoints[0])
+		require.Len(t, plan.Records, 2)
+
+		assert.Equal(t, dns.RecordTypeA, plan.Records[0].RecordType)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, plan.Records[0].Desired)
+		assert.Equal(t, []string{"2.2.2.2"}, plan.Records[0].Add)
+		assert.Equal(t, []string{"9.9.9.9"}, plan.Records[0].Remove)
+
+		assert.Equal(t, dns.RecordTypeAAAA, plan.Records[1].RecordType)
+		assert.Empty(t, plan.Records[1].Add)
+		assert.Empty(t, plan.Records[1].Remove)
+
+		// Records and state are not changed
+		assert.Equal(t, 0, mockProvider.CallCount)
+		assert.Empty(t, dc.healthyIPs)
+		assert.False(t, dc.isSynced())
+	})
+
+	t.Run("No changes", func(t *testing.T) {
+		mockProvider := dns.NewMockProvider(false)
+		mockProvider.LastIPs = map[string][]string{
+			dns.RecordTypeA: {"::ffff:1.1.1.1"},
+		}
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": newDomainChecker(mockProvider, true, false),
+			},
+		}
+
+		plan := hc.Plan(t.Context())["example.com"]
+		assert.False(t, plan.HasChanges())
+		require.Len(t, plan.Records, 1)
+		assert.Equal(t, []string{"1.1.1.1"}, plan.Records[0].Current)
+	})
+
+	t.Run("Provider can't return records", func(t *testing.T) {
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": newDomainChecker(&writeOnlyProvider{}, true, true),
+			},
+		}
+
+		plan := hc.Plan(t.Context())["example.com"]
+		assert.True(t, plan.HasChanges())
+		require.Len(t, plan.Records, 1)
+		assert.False(t, plan.Records[0].Known())
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, plan.Records[0].Desired)
+	})
+
+	t.Run("Error reading records", func(t *testing.T) {
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": newDomainChecker(dns.NewMockProvider(true), true),
+			},
+		}
+
+		plan := hc.Plan(t.Context())["example.com"]
+		assert.True(t, plan.HasChanges())
+		require.Len(t, plan.Records, 1)
+		assert.False(t, plan.Records[0].Known())
+		assert.Contains(t, plan.Records[0].Error, "mock error")
+	})
+
+	t.Run("No healthy endpoints", func(t *testing.T) {
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": newDomainChecker(dns.NewMockProvider(false), false, false),
+			},
+		}
+
+		plan := hc.Plan(t.Context())["example.com"]
+		assert.False(t, plan.HasChanges())
+		assert.Equal(t, "no healthy endpoints", plan.Skipped)
+		require.Len(t, plan.Endpoints, 2)
+		assert.False(t, plan.Endpoints[1].Healthy)
+		assert.Equal(t, "connection failed", plan.Endpoints[1].Error)
+	})
+
+	t.Run("Fallback IPs", func(t *testing.T) {
+		dc := newDomainChecker(dns.NewMockProvider(false), false, false)
+		dc.fallbackIPs = []string{"9.9.9.9"}
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{"example.com": dc},
+		}
+
+		plan := hc.Plan(t.Context())["example.com"]
+		require.Len(t, plan.Records, 1)
+		assert.Equal(t, []string{"9.9.9.9"}, plan.Records[0].Desired)
+		assert.Equal(t, []string{"9.9.9.9"}, plan.Records[0].Add)
+	})
+
+	t.Run("Drained and paused", func(t *testing.T) {
+		mockProvider := dns.NewMockProvider(false)
+		dc := newDomainChecker(mockProvider, true, true)
+		dc.setDrained("2.2.2.2", true)
+		paused := newDomainChecker(mockProvider, true, true)
+		paused.setPaused(true)
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{
+				"example.com": dc,
+				"paused.com":  paused,
+			},
+		}
+
+		plans := hc.Plan(t.Context())
+		require.Len(t, plans["example.com"].Records, 1)
+		assert.Equal(t, []string{"1.1.1.1"}, plans["example.com"].Records[0].Desired)
+		assert.Equal(t, "domain is paused", plans["paused.com"].Skipped)
+	})
+}
@@ -0,0 +1,114 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/tracing"
+	"github.com/italypaleale/ddup/pkg/utils"
+)
+
+// detectDrift compares the records published by the provider with the desired list of IPs, taking into account the records that are kept because of the deletion policy
+// It returns true if the records differ, for any of the names and record types used by the domain, and the IPs published by the provider for those record types, keyed by name
+// If the provider can't return its records, it always returns true and no published IPs, so the records are updated
+func detectDrift(ctx context.Context, dc *domainChecker, ips []string, healthyIPs []string) (bool, map[string][]string, error) {
+	reader, ok := dc.provider.(dns.RecordReader)
+	if !ok {
+		return true, nil, nil
+	}
+
+	var drifted bool
+	published := make(map[string][]string, len(dc.aliases)+1)
+	for _, name := range dc.recordNames() {
+		records := make([]string, 0, len(healthyIPs))
+		for _, recordType := range []string{dns.RecordTypeA, dns.RecordTypeAAAA} {
+			// Skip record types that aren't used by any endpoint, as they're not managed by ddup
+			if len(dns.FilterIPsByRecordType(ips, recordType)) == 0 {
+				continue
+			}
+
+			spanCtx, span := startProviderSpan(ctx, dc, "GetRecords", attribute.String("dns.record_type", recordType))
+			res, err := reader.GetRecords(spanCtx, name, recordType)
+			tracing.EndSpan(span, err)
+			if err != nil {
+				return false, nil, fmt.Errorf("error getting %s records for %s: %w", recordType, name, err)
+			}
+			records = append(records, normalizeIPs(res)...)
+		}
+
+		published[name] = records
+		if !utils.ElementsMatch(records, dc.applyDeletionPolicy(ips, healthyIPs, records)) {
+			drifted = true
+		}
+	}
+
+	return drifted, published, nil
+}
+
+// checkPublished compares the records published by the provider with the ones that ddup last published or verified, for the names and record types used by the domain
+// It returns false for known if the provider can't return its records, or if ddup hasn't published or verified the records of all names yet
+// Otherwise, conflictName is the first name whose records were changed outside of ddup, if any
+func (dc *domainChecker) checkPublished(ips []string, published map[string][]string) (known bool, conflictName string) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if published == nil || dc.publishedIPs == nil {
+		return false, ""
+	}
+
+	for _, name := range dc.recordNames() {
+		last, ok := dc.publishedIPs[name]
+		if !ok {
+			return false, ""
+		}
+
+		expected := make([]string, 0, len(last))
+		for _, recordType := range []string{dns.RecordTypeA, dns.RecordTypeAAAA} {
+			if len(dns.FilterIPsByRecordType(ips, recordType)) == 0 {
+				continue
+			}
+			expected = append(expected, dns.FilterIPsByRecordType(last, recordType)...)
+		}
+
+		if conflictName == "" && !utils.ElementsMatch(published[name], expected) {
+			conflictName = name
+		}
+	}
+
+	return true, conflictName
+}
+
+// setPublishedIPs sets the IPs that ddup published or verified in the provider's records, keyed by name
+func (dc *domainChecker) setPublishedIPs(ips map[string][]string) {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	dc.publishedIPs = ips
+}
+
+// getPublishedIPs returns the IPs that ddup published or verified in the provider's records, keyed by name
+func (dc *domainChecker) getPublishedIPs() map[string][]string {
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	return dc.publishedIPs
+}
+
+// normalizeIPs returns the list of IPs in the canonical format, so they can be compared
+// Values that are not valid IPs are returned as-is
+func normalizeIPs(ips []string) []string {
+	res := make([]string, len(ips))
+	for i, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			res[i] = ip
+			continue
+		}
+		res[i] = addr.Unmap().String()
+	}
+	return res
+}
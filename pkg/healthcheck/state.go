@@ -0,0 +1,158 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedState is the state of the health checker that is persisted across restarts
+type persistedState struct {
+	// Key is domain name
+	Domains map[string]persistedDomainState `json:"domains"`
+}
+
+// persistedDomainState is the state of a domain that is persisted across restarts
+type persistedDomainState struct {
+	// Name of the provider; state is not restored if the domain now uses a different provider
+	Provider    string         `json:"provider"`
+	HealthyIPs  []string       `json:"healthyIPs"`
+	FailedIPs   map[string]int `json:"failedIPs,omitempty"`
+	LastUpdated time.Time      `json:"lastUpdated,omitzero"`
+	LastError   string         `json:"lastError,omitempty"`
+	// IPs of endpoints that were drained by an operator
+	Drained []string `json:"drained,omitempty"`
+	// If true, the domain was paused by an operator
+	Paused bool `json:"paused,omitempty"`
+}
+
+// loadState reads the persisted state from the file
+// If the file doesn't exist, it returns nil with no error
+func loadState(path string) (*persistedState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	state := &persistedState{}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return state, nil
+}
+
+// saveState writes the persisted state to the file
+// The file is replaced atomically, so a crash while writing doesn't leave a corrupted file
+func saveState(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err != nil || closeErr != nil {
+		return fmt.Errorf("failed to write temporary file: %w", errors.Join(err, closeErr))
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to replace the state file: %w", err)
+	}
+
+	return nil
+}
+
+// getPersistedState returns the state of all domains to persist
+func getPersistedState(dcs map[string]*domainChecker) *persistedState {
+	state := &persistedState{
+		Domains: make(map[string]persistedDomainState, len(dcs)),
+	}
+	for name, dc := range dcs {
+		healthyIPs, failedIPs, lastUpdated, lastError := dc.getState()
+		state.Domains[name] = persistedDomainState{
+			Provider:    dc.provider.Name(),
+			HealthyIPs:  healthyIPs,
+			FailedIPs:   maps.Clone(failedIPs),
+			LastUpdated: lastUpdated,
+			LastError:   lastError,
+			Drained:     dc.getDrainedIPs(),
+			Paused:      dc.isPaused(),
+		}
+	}
+
+	return state
+}
+
+// restoreState applies the persisted state to the domain checkers
+// Domains that are not in the configuration anymore, or that use a different provider, are ignored
+// Records are still reconciled in the first check, because they may have been changed while ddup was not running
+// Drained endpoints and paused domains are restored too, as they were set by an operator
+func restoreState(dcs map[string]*domainChecker, state *persistedState) {
+	for name, dc := range dcs {
+		ds, ok := state.Domains[name]
+		if !ok || ds.Provider != dc.provider.Name() {
+			continue
+		}
+
+		dc.healthyIPs = ds.HealthyIPs
+		dc.failedIPs = ds.FailedIPs
+		if dc.failedIPs == nil {
+			dc.failedIPs = make(map[string]int, 0)
+		}
+		dc.lastUpdated = ds.LastUpdated
+		dc.lastError = ds.LastError
+
+		// Drained endpoints that were removed from the configuration are ignored
+		for _, ip := range ds.Drained {
+			if !dc.hasEndpointIP(ip) {
+				continue
+			}
+			dc.setDrained(ip, true)
+			logger().Warn("Endpoint is still drained after restart", "domain", name, "ip", ip)
+		}
+		if ds.Paused {
+			dc.paused = true
+			logger().Warn("Domain is still paused after restart", "domain", name)
+		}
+	}
+}
+
+// persistState saves the state of the health checker to the state file, if it changed since it was last saved
+func (hc *HealthChecker) persistState(ctx context.Context, path string) {
+	if path == "" {
+		return
+	}
+
+	// Hold the lock while the state is collected too, so concurrent cycles don't overwrite newer state
+	hc.stateLock.Lock()
+	defer hc.stateLock.Unlock()
+
+	data, err := json.Marshal(getPersistedState(hc.getDomainCheckers()))
+	if err != nil {
+		logger().WarnContext(ctx, "Failed to serialize state", "error", err)
+		return
+	}
+	if bytes.Equal(data, hc.savedState) {
+		return
+	}
+
+	err = saveState(path, data)
+	if err != nil {
+		logger().WarnContext(ctx, "Failed to persist state", "path", path, "error", err)
+		return
+	}
+	hc.savedState = data
+}
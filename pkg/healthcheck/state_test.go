@@ -0,0 +1,154 @@
+package healthcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/dns"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestHealthChecker_PersistState(t *testing.T) {
+	newDomainChecker := func(provider dns.Provider) *domainChecker {
+		return &domainChecker{
+			checker: &checker.MockChecker{
+				Domain:      "example.com",
+				MaxAttempts: 2,
+				Results: []checker.Result{
+					{Endpoint: &config.ConfigEndpoint{Name: "endpoint1", IP: "1.1.1.1"}, Healthy: true},
+					{Endpoint: &config.ConfigEndpoint{Name: "endpoint2", IP: "2.2.2.2"}, Healthy: false},
+				},
+			},
+			ttl:        60,
+			healthyIPs: []string{"1.1.1.1", "2.2.2.2"},
+			failedIPs:  make(map[string]int),
+			provider:   provider,
+		}
+	}
+
+	t.Run("Save and restore", func(t *testing.T) {
+		stateFile := filepath.Join(t.TempDir(), "state.json")
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{"example.com": newDomainChecker(dns.NewMockProvider(false))},
+		}
+
+		// After the first check, endpoint2 has one failure and is still healthy
+		hc.checkAndUpdateDNS(t.Context())
+		hc.persistState(t.Context(), stateFile)
+		require.FileExists(t, stateFile)
+
+		state, err := loadState(stateFile)
+		require.NoError(t, err)
+		require.NotNil(t, state)
+		require.Contains(t, state.Domains, "example.com")
+		assert.Equal(t, "mock", state.Domains["example.com"].Provider)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, state.Domains["example.com"].HealthyIPs)
+		assert.Equal(t, map[string]int{"2.2.2.2": 1}, state.Domains["example.com"].FailedIPs)
+
+		// Restore the state in new domain checkers, as after a restart
+		dc := newDomainChecker(dns.NewMockProvider(false))
+		dc.healthyIPs = nil
+		restoreState(map[string]*domainChecker{"example.com": dc}, state)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, dc.healthyIPs)
+		assert.Equal(t, map[string]int{"2.2.2.2": 1}, dc.failedIPs)
+
+		// The failure counter is not reset, so endpoint2 is removed after the next failure
+		mockProvider := dns.NewMockProvider(false)
+		dc.provider = mockProvider
+		hc = &HealthChecker{
+			domainCheckers: map[string]*domainChecker{"example.com": dc},
+		}
+		hc.checkAndUpdateDNS(t.Context())
+		assert.Equal(t, []string{"1.1.1.1"}, dc.healthyIPs)
+		assert.Equal(t, 1, mockProvider.CallCount)
+	})
+
+	t.Run("State unchanged is not written again", func(t *testing.T) {
+		stateFile := filepath.Join(t.TempDir(), "state.json")
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{"example.com": newDomainChecker(dns.NewMockProvider(false))},
+		}
+
+		hc.persistState(t.Context(), stateFile)
+		require.FileExists(t, stateFile)
+		require.NoError(t, os.Remove(stateFile))
+
+		hc.persistState(t.Context(), stateFile)
+		assert.NoFileExists(t, stateFile)
+	})
+
+	t.Run("Different provider is not restored", func(t *testing.T) {
+		state := &persistedState{
+			Domains: map[string]persistedDomainState{
+				"example.com": {Provider: "other", HealthyIPs: []string{"9.9.9.9"}},
+			},
+		}
+		dc := newDomainChecker(dns.NewMockProvider(false))
+		restoreState(map[string]*domainChecker{"example.com": dc}, state)
+		assert.ElementsMatch(t, []string{"1.1.1.1", "2.2.2.2"}, dc.healthyIPs)
+	})
+
+	t.Run("Drained endpoints and paused domains", func(t *testing.T) {
+		stateFile := filepath.Join(t.TempDir(), "state.json")
+		dc := newDomainChecker(dns.NewMockProvider(false))
+		dc.endpointIPs = []string{"1.1.1.1", "2.2.2.2"}
+		dc.setDrained("2.2.2.2", true)
+		dc.setPaused(true)
+		hc := &HealthChecker{
+			domainCheckers: map[string]*domainChecker{"example.com": dc},
+		}
+		hc.persistState(t.Context(), stateFile)
+
+		state, err := loadState(stateFile)
+		require.NoError(t, err)
+		require.Contains(t, state.Domains, "example.com")
+		assert.Equal(t, []string{"2.2.2.2"}, state.Domains["example.com"].Drained)
+		assert.True(t, state.Domains["example.com"].Paused)
+
+		// Drained IPs that are not endpoints of the domain anymore are ignored
+		ds := state.Domains["example.com"]
+		ds.Drained = append(ds.Drained, "9.9.9.9")
+		state.Domains["example.com"] = ds
+
+		restored := newDomainChecker(dns.NewMockProvider(false))
+		restored.endpointIPs = []string{"1.1.1.1", "2.2.2.2"}
+		restoreState(map[string]*domainChecker{"example.com": restored}, state)
+		assert.Equal(t, []string{"2.2.2.2"}, restored.getDrainedIPs())
+		assert.True(t, restored.isPaused())
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		state, err := loadState(filepath.Join(t.TempDir(), "missing.json"))
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("Invalid file", func(t *testing.T) {
+		stateFile := filepath.Join(t.TempDir(), "state.json")
+		require.NoError(t, os.WriteFile(stateFile, []byte("not json"), 0o600))
+
+		_, err := loadState(stateFile)
+		require.ErrorContains(t, err, "failed to parse state file")
+	})
+
+	t.Run("Restored times", func(t *testing.T) {
+		lastUpdated := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		state := &persistedState{
+			Domains: map[string]persistedDomainState{
+				"example.com": {Provider: "mock", HealthyIPs: []string{"1.1.1.1"}, LastUpdated: lastUpdated, LastError: "boom"},
+			},
+		}
+		dc := newDomainChecker(dns.NewMockProvider(false))
+		restoreState(map[string]*domainChecker{"example.com": dc}, state)
+		_, failedIPs, gotLastUpdated, lastError := dc.getState()
+		assert.NotNil(t, failedIPs)
+		assert.Equal(t, lastUpdated, gotLastUpdated)
+		assert.Equal(t, "boom", lastError)
+	})
+}
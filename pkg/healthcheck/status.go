@@ -1,32 +1,58 @@
 package healthcheck
 
 import (
+	"net/url"
+	"slices"
 	"time"
+
+	"github.com/italypaleale/ddup/pkg/quorum"
 )
 
 type DomainStatus struct {
 	LastUpdated time.Time              `json:"lastUpdated"`
 	Provider    string                 `json:"provider"`
 	Error       string                 `json:"error,omitempty"`
+	Warning     string                 `json:"warning,omitempty"`
 	Endpoints   []DomainStatusEndpoint `json:"endpoints"`
+	// Names of records that are updated with the same IPs, in addition to the domain's name
+	Aliases []string `json:"aliases,omitempty"`
+	// If no endpoint is healthy, contains the fallback IPs that are published
+	FallbackIPs []string `json:"fallbackIPs,omitempty"`
+	// If true, health checks and DNS updates are paused for the domain
+	Paused bool `json:"paused,omitempty"`
 }
 
 type DomainStatusEndpoint struct {
-	Healthy      bool   `json:"healthy"`
-	IP           string `json:"ip"`
-	FailureCount int    `json:"failureCount,omitempty"`
+	Healthy bool   `json:"healthy"`
+	IP      string `json:"ip"`
+	// Name of the endpoint, as in the configuration
+	Name string `json:"name,omitempty"`
+	// URL used for the health checks, with credentials and query string values redacted
+	URL string `json:"url,omitempty"`
+	// Duration of the last health check, in milliseconds
+	LastLatencyMs int64 `json:"lastLatencyMs,omitempty"`
+	// Error returned by the last health check, if it failed
+	LastError string `json:"lastError,omitempty"`
+	// If true, the endpoint responded successfully in the last check, but its latency exceeded the maximum
+	Degraded bool `json:"degraded,omitempty"`
+	// If true, the endpoint is held out of DNS because it's flapping
+	Flapping bool `json:"flapping,omitempty"`
+	// If true, the endpoint was administratively removed from DNS
+	Drained      bool `json:"drained,omitempty"`
+	FailureCount int  `json:"failureCount,omitempty"`
 }
 
 func (hc *HealthChecker) GetAllDomainsStatus() map[string]DomainStatus {
-	res := make(map[string]DomainStatus, len(hc.domainCheckers))
-	for name, dc := range hc.domainCheckers {
+	dcs := hc.getDomainCheckers()
+	res := make(map[string]DomainStatus, len(dcs))
+	for name, dc := range dcs {
 		res[name] = hc.getStatusObject(dc)
 	}
 	return res
 }
 
 func (hc *HealthChecker) GetDomainStatus(domain string) *DomainStatus {
-	dc, ok := hc.domainCheckers[domain]
+	dc, ok := hc.getDomainChecker(domain)
 	if !ok {
 		return nil
 	}
@@ -38,31 +64,119 @@ func (hc *HealthChecker) GetDomainStatus(domain string) *DomainStatus {
 func (hc *HealthChecker) getStatusObject(dc *domainChecker) DomainStatus {
 	healthy, unhealthy, lastUpdated, lastError := dc.getState()
 
+	// When the fallback IPs are published, they are not listed as endpoints
+	var fallbackIPs []string
+	if dc.isFallback(healthy) {
+		fallbackIPs = healthy
+		healthy = nil
+	}
+
 	// Endpoints in the unhealthy list could also be in the healthy one,
 	// if they failed a recent health check but still less than the max attempts
 	endpoints := make([]DomainStatusEndpoint, 0, len(healthy)+len(unhealthy))
 	for _, ip := range healthy {
-		endpoints = append(endpoints, DomainStatusEndpoint{
-			Healthy:      true,
-			IP:           ip,
-			FailureCount: unhealthy[ip],
-		})
+		endpoints = append(endpoints, dc.getStatusEndpoint(ip, true, unhealthy[ip]))
 	}
 	for ip, attempts := range unhealthy {
 		// If the number of attempts is less than the max, the endpoint was in the healthy list too
-		if attempts >= dc.checker.GetMaxAttempts() {
-			endpoints = append(endpoints, DomainStatusEndpoint{
-				Healthy:      false,
-				IP:           ip,
-				FailureCount: attempts,
-			})
+		if attempts >= dc.getChecker().GetMaxAttempts() {
+			endpoints = append(endpoints, dc.getStatusEndpoint(ip, false, attempts))
 		}
 	}
 
+	// Endpoints that are flapping or drained are not in the healthy list, but they could be passing health checks
+	getEndpoint := func(ip string) *DomainStatusEndpoint {
+		i := slices.IndexFunc(endpoints, func(e DomainStatusEndpoint) bool {
+			return e.IP == ip
+		})
+		if i < 0 {
+			endpoints = append(endpoints, dc.getStatusEndpoint(ip, false, unhealthy[ip]))
+			i = len(endpoints) - 1
+		}
+		return &endpoints[i]
+	}
+	for _, ip := range dc.getFlappingIPs(time.Now()) {
+		getEndpoint(ip).Flapping = true
+	}
+	for _, ip := range dc.getDrainedIPs() {
+		getEndpoint(ip).Drained = true
+	}
+
 	return DomainStatus{
 		LastUpdated: lastUpdated,
 		Provider:    dc.provider.Name(),
 		Error:       lastError,
+		Warning:     dc.getWarning(),
+		Paused:      dc.isPaused(),
+		FallbackIPs: fallbackIPs,
 		Endpoints:   endpoints,
+		Aliases:     dc.aliases,
+	}
+}
+
+// getStatusEndpoint returns the status of the endpoint with the given IP, including the details of the last check
+func (dc *domainChecker) getStatusEndpoint(ip string, healthy bool, failureCount int) DomainStatusEndpoint {
+	res := DomainStatusEndpoint{
+		Healthy:      healthy,
+		IP:           ip,
+		FailureCount: failureCount,
+	}
+
+	last, ok := dc.getLastResult(ip)
+	if !ok {
+		return res
+	}
+
+	res.Degraded = last.Degraded
+	res.LastLatencyMs = last.Duration.Milliseconds()
+	if last.Error != nil {
+		res.LastError = last.Error.Error()
 	}
+	if last.Endpoint != nil {
+		res.Name = last.Endpoint.Name
+		res.URL = sanitizeURL(last.Endpoint.URL)
+	}
+
+	return res
+}
+
+// sanitizeURL returns the URL with the password and the values in the query string redacted, so it can be displayed
+func sanitizeURL(str string) string {
+	u, err := url.Parse(str)
+	if err != nil {
+		// Do not return URLs that can't be parsed, as they could contain credentials
+		return ""
+	}
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q[k] = []string{"xxxxx"}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	return u.Redacted()
+}
+
+// GetObservations returns the results of the last health checks, which are exchanged with other instances for checks from multiple vantage points
+// Domains that haven't been checked yet are not included
+func (hc *HealthChecker) GetObservations() quorum.Observations {
+	return observationsOf(hc.getDomainCheckers())
+}
+
+// observationsOf returns the results of the last health checks of the domains
+func observationsOf(dcs map[string]*domainChecker) quorum.Observations {
+	res := make(quorum.Observations, len(dcs))
+	for name, dc := range dcs {
+		endpoints, checkedAt := dc.getObservations()
+		if checkedAt.IsZero() {
+			continue
+		}
+		res[name] = quorum.DomainObservations{
+			CheckedAt: checkedAt,
+			Endpoints: endpoints,
+		}
+	}
+	return res
 }
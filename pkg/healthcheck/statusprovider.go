@@ -1,6 +1,56 @@
 package healthcheck
 
+import (
+	"context"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+	"github.com/italypaleale/ddup/pkg/quorum"
+)
+
 type StatusProvider interface {
 	GetAllDomainsStatus() map[string]DomainStatus
 	GetDomainStatus(domain string) *DomainStatus
 }
+
+// EndpointDrainer allows administratively removing endpoints from DNS, and restoring them
+type EndpointDrainer interface {
+	SetEndpointDrained(domain string, ip string, drained bool) error
+}
+
+// DomainPauser allows pausing health checks and DNS updates for domains, and resuming them
+type DomainPauser interface {
+	SetDomainPaused(domain string, paused bool) error
+}
+
+// CheckRunner runs health checks and DNS updates on demand
+type CheckRunner interface {
+	CheckNow(ctx context.Context, domain string) error
+	SyncNow(ctx context.Context, domain string) error
+}
+
+// RecordExporter returns the desired and actual state of the records of all domains
+type RecordExporter interface {
+	ExportRecords(ctx context.Context) []RecordState
+}
+
+// ObservationProvider returns the results of the last health checks, for checks from multiple vantage points
+type ObservationProvider interface {
+	GetObservations() quorum.Observations
+}
+
+// AgentReportReceiver receives the observations reported by remote checker agents
+type AgentReportReceiver interface {
+	ReportObservations(agent string, obs quorum.Observations)
+}
+
+// LeaderElector reports whether this replica is the leader, when multiple replicas of ddup are running
+type LeaderElector interface {
+	IsLeader() bool
+	// Elected returns a channel that receives a message when this replica becomes the leader
+	Elected() <-chan struct{}
+}
+
+// ResultRecorder receives the result of every health check, such as to store them in a time-series database
+type ResultRecorder interface {
+	RecordResult(domain string, ip string, result checker.Result)
+}
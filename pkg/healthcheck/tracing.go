@@ -0,0 +1,22 @@
+package healthcheck
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// startProviderSpan starts a span for a call to the DNS provider of a domain
+func startProviderSpan(ctx context.Context, dc *domainChecker, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("dns.provider", dc.provider.Name()),
+		attribute.String("dns.domain", dc.checker.GetDomain()),
+	)
+	return tracing.Tracer().Start(ctx, "dns "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
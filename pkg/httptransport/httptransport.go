@@ -0,0 +1,207 @@
+package httptransport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// transportKey contains the options of a transport, and it's used as key for the shared transports
+type transportKey struct {
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	keepAlive           time.Duration
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	http2               bool
+	proxy               string
+	caFile              string
+	// Normalized fingerprints, separated by commas
+	fingerprints string
+}
+
+var (
+	lock sync.Mutex
+	// Transports that were created, keyed by their options
+	// Protected by lock
+	transports = map[transportKey]*http.Transport{}
+)
+
+// Get returns the shared transport for the options
+// Transports are re-used by all callers with the same options, including after the configuration is reloaded, so connections are pooled
+func Get(opts config.ConfigHTTPTransport) (*http.Transport, error) {
+	fingerprints := make([]string, len(opts.CertificateFingerprints))
+	for i, f := range opts.CertificateFingerprints {
+		fingerprints[i] = normalizeFingerprint(f)
+	}
+	slices.Sort(fingerprints)
+
+	key := transportKey{
+		maxIdleConns:        opts.MaxIdleConns,
+		maxIdleConnsPerHost: opts.MaxIdleConnsPerHost,
+		maxConnsPerHost:     opts.MaxConnsPerHost,
+		idleConnTimeout:     opts.IdleConnTimeout,
+		keepAlive:           opts.KeepAlive,
+		dialTimeout:         opts.DialTimeout,
+		tlsHandshakeTimeout: opts.TLSHandshakeTimeout,
+		http2:               opts.HTTP2 == nil || *opts.HTTP2,
+		proxy:               opts.Proxy,
+		caFile:              opts.CAFile,
+		fingerprints:        strings.Join(fingerprints, ","),
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	t, ok := transports[key]
+	if !ok {
+		var err error
+		t, err = newTransport(key)
+		if err != nil {
+			return nil, err
+		}
+		transports[key] = t
+	}
+	return t, nil
+}
+
+// NewHTTPClient returns a HTTP client that uses the shared transport for the options, and that traces requests
+func NewHTTPClient(opts config.ConfigHTTPTransport) (*http.Client, error) {
+	t, err := Get(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: tracing.NewTransport(t),
+	}, nil
+}
+
+// normalizeFingerprint returns the fingerprint in lowercase hex, without separators
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+}
+
+func newTransport(key transportKey) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   key.dialTimeout,
+		KeepAlive: key.keepAlive,
+	}
+
+	t := &http.Transport{
+		Proxy:                 proxyFunc(key.proxy),
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     key.http2,
+		MaxIdleConns:          key.maxIdleConns,
+		MaxIdleConnsPerHost:   key.maxIdleConnsPerHost,
+		MaxConnsPerHost:       key.maxConnsPerHost,
+		IdleConnTimeout:       key.idleConnTimeout,
+		TLSHandshakeTimeout:   key.tlsHandshakeTimeout,
+		ExpectContinueTimeout: http.DefaultTransport.(*http.Transport).ExpectContinueTimeout, //nolint:forcetypeassert
+	}
+
+	if !key.http2 {
+		// A non-nil, empty map disables HTTP/2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return t, nil
+}
+
+// newTLSConfig returns the TLS configuration for the options, or nil if the defaults are used
+func newTLSConfig(key transportKey) (*tls.Config, error) {
+	if key.caFile == "" && key.fingerprints == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if key.caFile != "" {
+		pem, err := os.ReadFile(key.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file '%s': %w", key.caFile, err)
+		}
+
+		// Trust the CA in addition to the system's root CAs
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file '%s' does not contain any valid PEM-encoded certificate", key.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if key.fingerprints != "" {
+		pins := make([][]byte, 0)
+		for f := range strings.SplitSeq(key.fingerprints, ",") {
+			pin, err := hex.DecodeString(f)
+			if err != nil || len(pin) != sha256.Size {
+				return nil, fmt.Errorf("certificate fingerprint '%s' is not a SHA-256 hex digest", f)
+			}
+			pins = append(pins, pin)
+		}
+
+		// When certificates are pinned, the chain is not verified against the CAs, so self-signed certificates can be used
+		// Instead, the certificate presented by the server must match one of the fingerprints
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server did not present a certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+			for _, pin := range pins {
+				if bytes.Equal(sum[:], pin) {
+					return nil
+				}
+			}
+			return fmt.Errorf("certificate presented by the server, with fingerprint %s, is not pinned", hex.EncodeToString(sum[:]))
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// proxyFunc returns the function that selects the proxy for requests, for the proxy option
+func proxyFunc(proxy string) func(*http.Request) (*url.URL, error) {
+	switch proxy {
+	case "":
+		return http.ProxyFromEnvironment
+	case "direct":
+		return nil
+	default:
+		// The URL was validated when the configuration was loaded
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return func(*http.Request) (*url.URL, error) {
+				return nil, err
+			}
+		}
+		return http.ProxyURL(u)
+	}
+}
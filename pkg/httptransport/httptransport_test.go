@@ -0,0 +1,129 @@
+package httptransport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestGet(t *testing.T) {
+	opts := config.ConfigHTTPTransport{
+		MaxIdleConns:        50,
+		MaxIdleConnsPerHost: 5,
+		MaxConnsPerHost:     8,
+		IdleConnTimeout:     time.Minute,
+		KeepAlive:           15 * time.Second,
+		DialTimeout:         5 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+		HTTP2:               new(true),
+	}
+
+	t1, err := Get(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 50, t1.MaxIdleConns)
+	assert.Equal(t, 5, t1.MaxIdleConnsPerHost)
+	assert.Equal(t, 8, t1.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, t1.IdleConnTimeout)
+	assert.True(t, t1.ForceAttemptHTTP2)
+	assert.Nil(t, t1.TLSNextProto)
+
+	// The same options return the same transport, even with a different pointer for HTTP2
+	opts2 := opts
+	opts2.HTTP2 = new(true)
+	t2, err := Get(opts2)
+	require.NoError(t, err)
+	assert.Same(t, t1, t2)
+
+	// Different options return a different transport
+	opts2.HTTP2 = new(false)
+	t2, err = Get(opts2)
+	require.NoError(t, err)
+	assert.NotSame(t, t1, t2)
+	assert.False(t, t2.ForceAttemptHTTP2)
+	assert.NotNil(t, t2.TLSNextProto)
+	assert.Empty(t, t2.TLSNextProto)
+}
+
+func TestProxy(t *testing.T) {
+	// The proxy receives requests with the full URL
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.String())
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(config.ConfigHTTPTransport{Proxy: proxy.URL})
+	require.NoError(t, err)
+	res, err := client.Get("http://provider.example.invalid/api")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "proxied http://provider.example.invalid/api", string(body))
+
+	assert.Nil(t, proxyFunc("direct"))
+}
+
+func TestTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	cert := srv.Certificate()
+	sum := sha256.Sum256(cert.Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600))
+
+	get := func(opts config.ConfigHTTPTransport) error {
+		client, err := NewHTTPClient(opts)
+		require.NoError(t, err)
+		res, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		require.ErrorContains(t, get(config.ConfigHTTPTransport{DialTimeout: time.Second}), "certificate")
+	})
+
+	t.Run("caFile", func(t *testing.T) {
+		require.NoError(t, get(config.ConfigHTTPTransport{CAFile: caFile}))
+	})
+
+	t.Run("pinned fingerprint", func(t *testing.T) {
+		// Fingerprints can use colons and uppercase letters
+		pretty := make([]string, 0, len(fingerprint)/2)
+		for i := 0; i < len(fingerprint); i += 2 {
+			pretty = append(pretty, strings.ToUpper(fingerprint[i:i+2]))
+		}
+		require.NoError(t, get(config.ConfigHTTPTransport{CertificateFingerprints: []string{strings.Join(pretty, ":")}}))
+	})
+
+	t.Run("other fingerprint", func(t *testing.T) {
+		other := sha256.Sum256([]byte("other"))
+		err := get(config.ConfigHTTPTransport{CertificateFingerprints: []string{hex.EncodeToString(other[:])}})
+		require.ErrorContains(t, err, "fingerprint "+fingerprint+", is not pinned")
+	})
+
+	t.Run("missing caFile", func(t *testing.T) {
+		_, err := Get(config.ConfigHTTPTransport{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+		require.ErrorContains(t, err, "failed to read CA file")
+	})
+}
@@ -0,0 +1,218 @@
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+	"github.com/italypaleale/ddup/pkg/logging"
+)
+
+const (
+	// Maximum number of points kept in memory while the database is unreachable; older points are dropped
+	maxBufferedPoints = 10_000
+	// Interval for checking if points must be written, when InfluxDB is not configured
+	defaultFlushInterval = 10 * time.Second
+)
+
+var (
+	// Escapes the characters that have a special meaning in measurements
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	// Escapes the characters that have a special meaning in tag keys and values
+	tagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	// Escapes the characters that have a special meaning in string field values
+	stringFieldEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+)
+
+// Writer writes the results of health checks to InfluxDB, or a compatible database, using the line protocol
+// Points are buffered in memory, and written periodically in batches.
+type Writer struct {
+	client *http.Client
+	cfg    atomic.Pointer[config.ConfigInfluxDB]
+
+	lock sync.Mutex
+	// Points, in the line protocol, that haven't been written yet
+	// Protected by lock
+	points []string
+}
+
+// NewWriter returns a new Writer
+// If cfg is nil, results are discarded until the configuration is updated.
+func NewWriter(cfg *config.ConfigInfluxDB) *Writer {
+	w := &Writer{
+		client: &http.Client{},
+	}
+	w.UpdateConfig(cfg)
+	return w
+}
+
+// UpdateConfig replaces the configuration for InfluxDB, such as after the configuration file is reloaded
+// If cfg is nil, the points that haven't been written yet are discarded.
+func (w *Writer) UpdateConfig(cfg *config.ConfigInfluxDB) {
+	w.cfg.Store(cfg)
+	if cfg == nil {
+		w.lock.Lock()
+		w.points = nil
+		w.lock.Unlock()
+	}
+}
+
+// RecordResult adds the result of a health check to the points to write
+// It implements healthcheck.ResultRecorder.
+func (w *Writer) RecordResult(domain string, ip string, result checker.Result) {
+	cfg := w.cfg.Load()
+	if cfg == nil {
+		return
+	}
+
+	var endpoint string
+	if result.Endpoint != nil {
+		endpoint = result.Endpoint.Name
+	}
+	line := formatPoint(cfg.Measurement, domain, endpoint, ip, result, time.Now())
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.points = append(w.points, line)
+	if len(w.points) > maxBufferedPoints {
+		w.points = w.points[len(w.points)-maxBufferedPoints:]
+	}
+}
+
+// Run writes the points periodically until the context is canceled
+// Before returning, the points that are still buffered are written.
+func (w *Writer) Run(ctx context.Context) error {
+	for {
+		interval := defaultFlushInterval
+		if cfg := w.cfg.Load(); cfg != nil && cfg.Interval > 0 {
+			interval = cfg.Interval
+		}
+
+		select {
+		case <-ctx.Done():
+			// Use a new context for the last write, as the parent one is canceled
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			w.flush(flushCtx)
+			cancel()
+			return nil
+		case <-time.After(interval):
+			w.flush(ctx)
+		}
+	}
+}
+
+// flush writes the buffered points to the database
+// If the write fails, the points are buffered again, so they're retried with the next ones.
+func (w *Writer) flush(ctx context.Context) {
+	cfg := w.cfg.Load()
+	if cfg == nil {
+		return
+	}
+
+	w.lock.Lock()
+	points := w.points
+	w.points = nil
+	w.lock.Unlock()
+
+	if len(points) == 0 {
+		return
+	}
+
+	err := w.write(ctx, cfg, points)
+	if err != nil {
+		logger().WarnContext(ctx, "Failed to write health check results to InfluxDB", "error", err, "points", len(points))
+
+		w.lock.Lock()
+		w.points = append(points, w.points...)
+		if len(w.points) > maxBufferedPoints {
+			w.points = w.points[len(w.points)-maxBufferedPoints:]
+		}
+		w.lock.Unlock()
+		return
+	}
+
+	logger().DebugContext(ctx, "Wrote health check results to InfluxDB", "points", len(points))
+}
+
+// write sends the points to the database in a single request
+func (w *Writer) write(ctx context.Context, cfg *config.ConfigInfluxDB, points []string) error {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	query := url.Values{
+		"bucket":    []string{cfg.Bucket},
+		"precision": []string{"ms"},
+	}
+	if cfg.Org != "" {
+		query.Set("org", cfg.Org)
+	}
+	u := strings.TrimSuffix(cfg.URL, "/") + "/api/v2/write?" + query.Encode()
+
+	body := strings.Join(points, "\n")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+cfg.Token)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	// Include the error returned by the database, if any
+	resBody, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("invalid response status code %d: %s", res.StatusCode, strings.TrimSpace(string(resBody)))
+	}
+
+	return nil
+}
+
+// formatPoint returns the point for the result of a health check, in the line protocol
+// The domain, endpoint, and IP are tags, while the outcome of the check and its latency are fields.
+func formatPoint(measurement string, domain string, endpoint string, ip string, result checker.Result, ts time.Time) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	// Tags with empty values are not allowed
+	for _, tag := range [][2]string{{"domain", domain}, {"endpoint", endpoint}, {"ip", ip}} {
+		if tag[1] != "" {
+			b.WriteString("," + tag[0] + "=" + tagEscaper.Replace(tag[1]))
+		}
+	}
+
+	b.WriteString(" healthy=" + strconv.FormatBool(result.Healthy))
+	b.WriteString(",degraded=" + strconv.FormatBool(result.Degraded))
+	b.WriteString(",latency_ms=" + strconv.FormatFloat(float64(result.Duration)/float64(time.Millisecond), 'f', -1, 64))
+	if result.Error != nil {
+		b.WriteString(`,error="` + stringFieldEscaper.Replace(result.Error.Error()) + `"`)
+	}
+
+	b.WriteString(" " + strconv.FormatInt(ts.UnixMilli(), 10))
+
+	return b.String()
+}
+
+// logger returns the logger for the InfluxDB writer
+func logger() *slog.Logger {
+	return logging.Component("influxdb")
+}
@@ -0,0 +1,118 @@
+package influxdb
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/healthcheck/checker"
+)
+
+func TestFormatPoint(t *testing.T) {
+	ts := time.UnixMilli(1700000000123)
+
+	t.Run("Healthy", func(t *testing.T) {
+		line := formatPoint("ddup_check", "app.example.com", "primary", "10.0.0.1", checker.Result{Healthy: true, Duration: 12500 * time.Microsecond}, ts)
+		assert.Equal(t, "ddup_check,domain=app.example.com,endpoint=primary,ip=10.0.0.1 healthy=true,degraded=false,latency_ms=12.5 1700000000123", line)
+	})
+
+	t.Run("Failed with error", func(t *testing.T) {
+		line := formatPoint("ddup_check", "app.example.com", "", "2001:db8::1", checker.Result{Error: errors.New(`status "503"`), Duration: time.Second}, ts)
+		assert.Equal(t, `ddup_check,domain=app.example.com,ip=2001:db8::1 healthy=false,degraded=false,latency_ms=1000,error="status \"503\"" 1700000000123`, line)
+	})
+
+	t.Run("Special characters are escaped", func(t *testing.T) {
+		line := formatPoint("ddup check", "app.example.com", "a,b=c d", "10.0.0.1", checker.Result{Healthy: true, Degraded: true}, ts)
+		assert.Equal(t, `ddup\ check,domain=app.example.com,endpoint=a\,b\=c\ d,ip=10.0.0.1 healthy=true,degraded=true,latency_ms=0 1700000000123`, line)
+	})
+}
+
+func TestWriterFlush(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		requests []*http.Request
+		bodies   []string
+		fail     bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := NewWriter(&config.ConfigInfluxDB{
+		URL:         srv.URL + "/",
+		Org:         "acme",
+		Bucket:      "ddup",
+		Token:       "secret",
+		Measurement: "ddup_check",
+		Timeout:     5 * time.Second,
+	})
+	endpoint := &config.ConfigEndpoint{Name: "primary"}
+
+	// Nothing is written if there are no points
+	w.flush(t.Context())
+	require.Empty(t, requests)
+
+	w.RecordResult("app.example.com", "10.0.0.1", checker.Result{Endpoint: endpoint, Healthy: true})
+	w.RecordResult("app.example.com", "10.0.0.2", checker.Result{Endpoint: endpoint, Healthy: false})
+	w.flush(t.Context())
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, "/api/v2/write", requests[0].URL.Path)
+	assert.Equal(t, "ddup", requests[0].URL.Query().Get("bucket"))
+	assert.Equal(t, "acme", requests[0].URL.Query().Get("org"))
+	assert.Equal(t, "ms", requests[0].URL.Query().Get("precision"))
+	assert.Equal(t, "Token secret", requests[0].Header.Get("Authorization"))
+	lines := strings.Split(bodies[0], "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "ddup_check,domain=app.example.com,endpoint=primary,ip=10.0.0.1 healthy=true,"))
+	assert.True(t, strings.HasPrefix(lines[1], "ddup_check,domain=app.example.com,endpoint=primary,ip=10.0.0.2 healthy=false,"))
+
+	// Points that failed to be written are retried with the next ones
+	fail = true
+	w.RecordResult("app.example.com", "10.0.0.1", checker.Result{Endpoint: endpoint, Healthy: true})
+	w.flush(t.Context())
+	require.Len(t, requests, 2)
+
+	fail = false
+	w.RecordResult("app.example.com", "10.0.0.2", checker.Result{Endpoint: endpoint, Healthy: true})
+	w.flush(t.Context())
+	require.Len(t, requests, 3)
+	lines = strings.Split(bodies[2], "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "ip=10.0.0.1 ")
+	assert.Contains(t, lines[1], "ip=10.0.0.2 ")
+
+	// When InfluxDB is disabled, results are discarded
+	w.UpdateConfig(nil)
+	w.RecordResult("app.example.com", "10.0.0.1", checker.Result{Endpoint: endpoint, Healthy: true})
+	assert.Empty(t, w.points)
+}
+
+func TestWriterBufferLimit(t *testing.T) {
+	w := NewWriter(&config.ConfigInfluxDB{URL: "http://127.0.0.1:1", Bucket: "ddup", Measurement: "ddup_check"})
+	for range maxBufferedPoints + 5 {
+		w.RecordResult("app.example.com", "10.0.0.1", checker.Result{Healthy: true})
+	}
+	assert.Len(t, w.points, maxBufferedPoints)
+}
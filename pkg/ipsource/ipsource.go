@@ -0,0 +1,161 @@
+package ipsource
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/gatewayip"
+	"github.com/italypaleale/ddup/pkg/logging"
+	"github.com/italypaleale/ddup/pkg/publicip"
+)
+
+// Results are cached for this duration, so domains checked in the same cycle share them
+const cacheDuration = 15 * time.Second
+
+// Source returns the IP of an endpoint
+type Source interface {
+	// IP returns the current IP
+	IP(ctx context.Context) (netip.Addr, error)
+}
+
+// Registry creates sources from the configuration of endpoints
+// Sources with the same configuration are shared, so they're queried only once when used by multiple endpoints
+type Registry struct {
+	cfg *config.Config
+
+	lock    sync.Mutex
+	sources map[string]Source
+	// Shared by all public and gateway sources, and created only if needed
+	publicIP  *publicip.Detector
+	gatewayIP *gatewayip.Client
+}
+
+// NewRegistry returns a new Registry
+func NewRegistry(cfg *config.Config) *Registry {
+	return &Registry{
+		cfg:     cfg,
+		sources: make(map[string]Source),
+	}
+}
+
+// Get returns the source for the endpoint
+func (r *Registry) Get(e *config.ConfigEndpoint) (Source, error) {
+	src, err := e.GetIPSource()
+	if err != nil {
+		return nil, err
+	}
+
+	// Static sources are not cached or shared, as there's nothing to detect
+	if src.Type == config.IPSourceStatic {
+		return NewStatic(src.Value)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := src.String()
+	if s, ok := r.sources[key]; ok {
+		return s, nil
+	}
+
+	var s Source
+	switch src.Type {
+	case config.IPSourcePublic:
+		if r.publicIP == nil {
+			r.publicIP, err = publicip.NewDetector(r.cfg.PublicIP)
+			if err != nil {
+				return nil, fmt.Errorf("failed to init public IP detection: %w", err)
+			}
+		}
+		s = &publicSource{
+			detector: r.publicIP,
+			ipv6:     src.Family == config.IPFamilyIPv6,
+		}
+	case config.IPSourceGateway:
+		if r.gatewayIP == nil {
+			r.gatewayIP, err = gatewayip.NewClient(r.cfg.Gateway)
+			if err != nil {
+				return nil, fmt.Errorf("failed to init gateway IP discovery: %w", err)
+			}
+		}
+		s = &gatewaySource{
+			client: r.gatewayIP,
+		}
+	case config.IPSourceInterface:
+		s = NewInterface(src.Value, src.Family)
+	case config.IPSourceDNS:
+		s = NewDNS(src.Value, src.Family)
+	case config.IPSourceCommand:
+		s, err = NewCommand(src.Value)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("IP source type '%s' is not supported", src.Type)
+	}
+
+	s = newCached(key, s, cacheDuration)
+	r.sources[key] = s
+	return s, nil
+}
+
+// cached is a Source that caches the results of another source, and logs when the IP changes
+type cached struct {
+	name   string
+	source Source
+	ttl    time.Duration
+
+	// Holding the lock while querying the source ensures that concurrent callers wait for the result rather than querying it again
+	lock    sync.Mutex
+	addr    netip.Addr
+	expires time.Time
+	// Last IP returned successfully, used to detect changes
+	last netip.Addr
+}
+
+func newCached(name string, source Source, ttl time.Duration) *cached {
+	return &cached{
+		name:   name,
+		source: source,
+		ttl:    ttl,
+	}
+}
+
+// IP implements the Source interface
+func (c *cached) IP(ctx context.Context) (netip.Addr, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.addr.IsValid() && time.Now().Before(c.expires) {
+		return c.addr, nil
+	}
+
+	addr, err := c.source.IP(ctx)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr = addr.Unmap()
+
+	if c.last.IsValid() && c.last != addr {
+		logger().InfoContext(ctx, "IP changed",
+			slog.String("source", c.name),
+			slog.String("previous", c.last.String()),
+			slog.String("current", addr.String()),
+		)
+	}
+	c.last = addr
+
+	c.addr = addr
+	c.expires = time.Now().Add(c.ttl)
+	return addr, nil
+}
+
+// logger returns the logger for IP sources
+func logger() *slog.Logger {
+	return logging.Component("ipsource")
+}
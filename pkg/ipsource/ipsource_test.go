@@ -0,0 +1,177 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+type countingSource struct {
+	addr  netip.Addr
+	err   error
+	calls int
+}
+
+func (s *countingSource) IP(ctx context.Context) (netip.Addr, error) {
+	s.calls++
+	return s.addr, s.err
+}
+
+func TestRegistry(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.PublicIP = config.ConfigPublicIP{Services: []string{"ipify"}, MinAgreement: 1, Timeout: time.Second}
+	r := NewRegistry(cfg)
+
+	t.Run("Sources are shared", func(t *testing.T) {
+		s1, err := r.Get(&config.ConfigEndpoint{IPFrom: "public:ipv4"})
+		require.NoError(t, err)
+		s2, err := r.Get(&config.ConfigEndpoint{IPFrom: "public:ipv4"})
+		require.NoError(t, err)
+		s3, err := r.Get(&config.ConfigEndpoint{IPFrom: "public:ipv6"})
+		require.NoError(t, err)
+
+		assert.Same(t, s1, s2)
+		assert.NotSame(t, s1, s3)
+		assert.Len(t, r.sources, 2)
+	})
+
+	t.Run("Static", func(t *testing.T) {
+		s, err := r.Get(&config.ConfigEndpoint{IP: "::ffff:10.0.0.1"})
+		require.NoError(t, err)
+
+		addr, err := s.IP(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.1", addr.String())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := r.Get(&config.ConfigEndpoint{IPFrom: "private"})
+		require.ErrorContains(t, err, "ipFrom 'private' is not supported")
+	})
+}
+
+func TestCached(t *testing.T) {
+	src := &countingSource{addr: netip.MustParseAddr("203.0.113.1")}
+	c := newCached("test", src, time.Hour)
+
+	for range 3 {
+		addr, err := c.IP(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "203.0.113.1", addr.String())
+	}
+	assert.Equal(t, 1, src.calls)
+
+	// After the cache expires, the source is queried again
+	src.addr = netip.MustParseAddr("203.0.113.2")
+	c.expires = time.Now().Add(-time.Second)
+	addr, err := c.IP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.2", addr.String())
+	assert.Equal(t, 2, src.calls)
+	assert.Equal(t, addr, c.last)
+
+	// Errors are not cached
+	src.err = errors.New("simulated")
+	c.expires = time.Now().Add(-time.Second)
+	_, err = c.IP(t.Context())
+	require.Error(t, err)
+	_, err = c.IP(t.Context())
+	require.Error(t, err)
+	assert.Equal(t, 4, src.calls)
+}
+
+func TestInterfaceSource(t *testing.T) {
+	newSource := func(family string, addrs ...string) Source {
+		return &interfaceSource{
+			name:   "eth0",
+			family: family,
+			addrs: func(name string) ([]netip.Addr, error) {
+				res := make([]netip.Addr, len(addrs))
+				for i, a := range addrs {
+					res[i] = netip.MustParseAddr(a)
+				}
+				return res, nil
+			},
+		}
+	}
+
+	addr, err := newSource("", "fe80::1", "2001:db8::1", "192.168.1.20", "192.168.1.10", "127.0.0.1").IP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.10", addr.String())
+
+	addr, err = newSource(config.IPFamilyIPv6, "fe80::1", "2001:db8::1", "192.168.1.10").IP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", addr.String())
+
+	_, err = newSource(config.IPFamilyIPv6, "fe80::1", "192.168.1.10").IP(t.Context())
+	require.ErrorContains(t, err, "interface 'eth0' does not have a global unicast address")
+}
+
+type staticResolver struct {
+	addrs []netip.Addr
+}
+
+func (r *staticResolver) LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error) {
+	var res []netip.Addr
+	for _, addr := range r.addrs {
+		if network == "ip" || (network == "ip4") == addr.Is4() {
+			res = append(res, addr)
+		}
+	}
+	if len(res) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return res, nil
+}
+
+func TestDNSSource(t *testing.T) {
+	resolver := &staticResolver{
+		addrs: []netip.Addr{
+			netip.MustParseAddr("2001:db8::1"),
+			netip.MustParseAddr("203.0.113.2"),
+			netip.MustParseAddr("203.0.113.1"),
+		},
+	}
+	newSource := func(family string) Source {
+		return &dnsSource{host: "origin.example.net", family: family, resolver: resolver}
+	}
+
+	// The lowest IPv4 address is used, unless the family is set
+	addr, err := newSource("").IP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", addr.String())
+
+	addr, err = newSource(config.IPFamilyIPv6).IP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "2001:db8::1", addr.String())
+
+	resolver.addrs = nil
+	_, err = newSource("").IP(t.Context())
+	require.ErrorContains(t, err, "failed to resolve 'origin.example.net'")
+}
+
+func TestCommandSource(t *testing.T) {
+	s, err := NewCommand("echo 203.0.113.1")
+	require.NoError(t, err)
+	addr, err := s.IP(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", addr.String())
+
+	s, err = NewCommand("echo not-an-ip")
+	require.NoError(t, err)
+	_, err = s.IP(t.Context())
+	require.ErrorContains(t, err, "command 'echo' did not print a valid IP address: 'not-an-ip'")
+
+	s, err = NewCommand("false")
+	require.NoError(t, err)
+	_, err = s.IP(t.Context())
+	require.ErrorContains(t, err, "command 'false' failed")
+}
@@ -0,0 +1,229 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/gatewayip"
+	"github.com/italypaleale/ddup/pkg/publicip"
+)
+
+// Timeout for commands that return the IP
+const commandTimeout = 10 * time.Second
+
+// static is a Source that returns a fixed IP
+type static struct {
+	addr netip.Addr
+}
+
+// NewStatic returns a Source that always returns the given IP
+func NewStatic(ip string) (Source, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("IP '%s' is not a valid IP address", ip)
+	}
+	return &static{addr: addr.Unmap()}, nil
+}
+
+// IP implements the Source interface
+func (s *static) IP(_ context.Context) (netip.Addr, error) {
+	return s.addr, nil
+}
+
+// publicSource is a Source that returns the public IP of the machine
+type publicSource struct {
+	detector *publicip.Detector
+	ipv6     bool
+}
+
+// IP implements the Source interface
+func (s *publicSource) IP(ctx context.Context) (netip.Addr, error) {
+	addr, err := s.detector.PublicIP(ctx, s.ipv6)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to detect public IP: %w", err)
+	}
+	return addr, nil
+}
+
+// gatewaySource is a Source that returns the external IP of the local gateway
+type gatewaySource struct {
+	client *gatewayip.Client
+}
+
+// IP implements the Source interface
+func (s *gatewaySource) IP(ctx context.Context) (netip.Addr, error) {
+	addr, err := s.client.ExternalIP(ctx)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to get external IP from gateway: %w", err)
+	}
+	return addr, nil
+}
+
+// interfaceSource is a Source that returns the address of a network interface
+type interfaceSource struct {
+	name   string
+	family string
+	// Returns the addresses of the interface
+	addrs func(name string) ([]netip.Addr, error)
+}
+
+// NewInterface returns a Source that returns the global unicast address of a network interface
+// If the interface has multiple addresses, IPv4 ones are preferred, unless family is set, and the lowest one is returned
+func NewInterface(name string, family string) Source {
+	return &interfaceSource{
+		name:   name,
+		family: family,
+		addrs:  interfaceAddrs,
+	}
+}
+
+// IP implements the Source interface
+func (s *interfaceSource) IP(_ context.Context) (netip.Addr, error) {
+	addrs, err := s.addrs(s.name)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	addrs = slices.DeleteFunc(addrs, func(addr netip.Addr) bool {
+		return !addr.IsGlobalUnicast() || !matchesFamily(addr, s.family)
+	})
+	if len(addrs) == 0 {
+		return netip.Addr{}, fmt.Errorf("interface '%s' does not have a global unicast address", s.name)
+	}
+
+	// Compare sorts IPv4 addresses before IPv6 ones
+	return slices.MinFunc(addrs, netip.Addr.Compare), nil
+}
+
+// interfaceAddrs returns the addresses of a network interface
+func interfaceAddrs(name string) ([]netip.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface '%s': %w", name, err)
+	}
+	ifAddrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get addresses of interface '%s': %w", name, err)
+	}
+
+	addrs := make([]netip.Addr, 0, len(ifAddrs))
+	for _, a := range ifAddrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if ok {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs, nil
+}
+
+// hostResolver resolves hostnames to IP addresses; it's implemented by *net.Resolver
+type hostResolver interface {
+	LookupNetIP(ctx context.Context, network string, host string) ([]netip.Addr, error)
+}
+
+// dnsSource is a Source that returns the address a hostname resolves to
+type dnsSource struct {
+	host     string
+	family   string
+	resolver hostResolver
+}
+
+// NewDNS returns a Source that returns the address a hostname resolves to
+// If the hostname has multiple addresses, IPv4 ones are preferred, unless family is set, and the lowest one is returned, so the result is stable with DNS round-robin
+func NewDNS(host string, family string) Source {
+	return &dnsSource{
+		host:     host,
+		family:   family,
+		resolver: net.DefaultResolver,
+	}
+}
+
+// IP implements the Source interface
+func (s *dnsSource) IP(ctx context.Context) (netip.Addr, error) {
+	network := "ip"
+	switch s.family {
+	case config.IPFamilyIPv4:
+		network = "ip4"
+	case config.IPFamilyIPv6:
+		network = "ip6"
+	}
+
+	addrs, err := s.resolver.LookupNetIP(ctx, network, s.host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to resolve '%s': %w", s.host, err)
+	}
+	if len(addrs) == 0 {
+		return netip.Addr{}, fmt.Errorf("hostname '%s' did not resolve to any address", s.host)
+	}
+
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+	// Compare sorts IPv4 addresses before IPv6 ones
+	return slices.MinFunc(addrs, netip.Addr.Compare), nil
+}
+
+// commandSource is a Source that returns the address printed by a command
+type commandSource struct {
+	name string
+	args []string
+}
+
+// NewCommand returns a Source that runs a command, and returns the address it prints to stdout
+// The command line is split on whitespace, and it's not executed through a shell
+func NewCommand(cmdline string) (Source, error) {
+	fields := strings.Fields(cmdline)
+	if len(fields) == 0 {
+		return nil, errors.New("command is empty")
+	}
+	return &commandSource{
+		name: fields[0],
+		args: fields[1:],
+	}, nil
+}
+
+// IP implements the Source interface
+func (s *commandSource) IP(ctx context.Context) (netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, s.name, s.args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return netip.Addr{}, fmt.Errorf("command '%s' failed: %w: %s", s.name, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return netip.Addr{}, fmt.Errorf("command '%s' failed: %w", s.name, err)
+	}
+
+	str := strings.TrimSpace(string(out))
+	addr, err := netip.ParseAddr(str)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("command '%s' did not print a valid IP address: '%s'", s.name, str)
+	}
+	return addr.Unmap(), nil
+}
+
+// matchesFamily returns true if the address belongs to the family
+func matchesFamily(addr netip.Addr, family string) bool {
+	switch family {
+	case config.IPFamilyIPv4:
+		return addr.Is4()
+	case config.IPFamilyIPv6:
+		return addr.Is6()
+	default:
+		return true
+	}
+}
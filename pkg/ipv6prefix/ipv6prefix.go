@@ -0,0 +1,147 @@
+package ipv6prefix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Source returns the IPv6 prefix currently delegated to the network
+type Source interface {
+	// Prefix returns the current prefix
+	Prefix(ctx context.Context) (netip.Prefix, error)
+}
+
+// NewSource returns a Source based on the configuration
+func NewSource(cfg *config.ConfigIPv6Prefix) (Source, error) {
+	switch {
+	case cfg.Interface != "":
+		return &interfaceSource{
+			name:   cfg.Interface,
+			length: cfg.Length,
+		}, nil
+	case cfg.URL != "":
+		return &urlSource{
+			url:        cfg.URL,
+			length:     cfg.Length,
+			httpClient: http.DefaultClient,
+		}, nil
+	default:
+		return nil, errors.New("one of interface and url must be set")
+	}
+}
+
+// Apply replaces the prefix portion of the address with the given prefix
+// The remaining bits (the host suffix) are kept from the address
+func Apply(prefix netip.Prefix, addr netip.Addr) netip.Addr {
+	p := prefix.Masked().Addr().As16()
+	a := addr.As16()
+	bits := prefix.Bits()
+	for i := range a {
+		switch {
+		case bits >= 8:
+			a[i] = p[i]
+			bits -= 8
+		case bits > 0:
+			mask := byte(0xFF) << (8 - bits)
+			a[i] = (p[i] & mask) | (a[i] &^ mask)
+			bits = 0
+		default:
+			// Nothing else to copy
+			return netip.AddrFrom16(a)
+		}
+	}
+	return netip.AddrFrom16(a)
+}
+
+// isGlobalIPv6 returns true if the address is a global unicast IPv6 address
+func isGlobalIPv6(addr netip.Addr) bool {
+	return addr.Is6() && !addr.Is4In6() &&
+		addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() // Excludes unique local addresses (fc00::/7)
+}
+
+// interfaceSource reads the prefix from the addresses of a network interface
+type interfaceSource struct {
+	name   string
+	length int
+}
+
+// Prefix implements the Source interface
+func (s *interfaceSource) Prefix(_ context.Context) (netip.Prefix, error) {
+	iface, err := net.InterfaceByName(s.name)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("failed to get interface '%s': %w", s.name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("failed to get addresses of interface '%s': %w", s.name, err)
+	}
+
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok || !isGlobalIPv6(addr) {
+			continue
+		}
+
+		return netip.PrefixFrom(addr, s.length).Masked(), nil
+	}
+
+	return netip.Prefix{}, fmt.Errorf("interface '%s' does not have a global IPv6 address", s.name)
+}
+
+// urlSource reads the prefix from the public IPv6 address returned by an external service
+type urlSource struct {
+	url        string
+	length     int
+	httpClient *http.Client
+}
+
+// Prefix implements the Source interface
+func (s *urlSource) Prefix(ctx context.Context) (netip.Prefix, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	// Responses should be very small
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return netip.Prefix{}, fmt.Errorf("invalid response status code HTTP %d; response: %s", res.StatusCode, string(body))
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("response is not a valid IP address: %w", err)
+	}
+	if !isGlobalIPv6(addr) {
+		return netip.Prefix{}, fmt.Errorf("response '%s' is not a global IPv6 address", addr)
+	}
+
+	return netip.PrefixFrom(addr, s.length).Masked(), nil
+}
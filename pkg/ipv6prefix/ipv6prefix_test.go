@@ -0,0 +1,67 @@
+package ipv6prefix
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		addr     string
+		expected string
+	}{
+		{"2001:db8:1234:5600::/56", "::a:b:c:d", "2001:db8:1234:5600:a:b:c:d"},
+		{"2001:db8:1234:5678::/64", "::1", "2001:db8:1234:5678::1"},
+		// Suffix bits that overlap with the prefix are replaced
+		{"2001:db8:1234:5600::/56", "fd00::ff:a:b:c:d", "2001:db8:1234:56ff:a:b:c:d"},
+		// Prefix length that is not a multiple of 8
+		{"2001:db8:1234:5670::/60", "::f:1", "2001:db8:1234:5670::f:1"},
+		{"2001:db8:1234:5670::/60", "0:0:0:ff::1", "2001:db8:1234:567f::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix+" "+tt.addr, func(t *testing.T) {
+			res := Apply(netip.MustParsePrefix(tt.prefix), netip.MustParseAddr(tt.addr))
+			assert.Equal(t, tt.expected, res.String())
+		})
+	}
+}
+
+func TestURLSource(t *testing.T) {
+	var response string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	s := &urlSource{
+		url:        srv.URL,
+		length:     56,
+		httpClient: srv.Client(),
+	}
+
+	t.Run("Valid address", func(t *testing.T) {
+		response = "2001:db8:1234:5678:9abc::1\n"
+		prefix, err := s.Prefix(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "2001:db8:1234:5600::/56", prefix.String())
+	})
+
+	t.Run("IPv4 address", func(t *testing.T) {
+		response = "203.0.113.1"
+		_, err := s.Prefix(t.Context())
+		require.ErrorContains(t, err, "not a global IPv6 address")
+	})
+
+	t.Run("Invalid response", func(t *testing.T) {
+		response = "hello world"
+		_, err := s.Prefix(t.Context())
+		require.ErrorContains(t, err, "not a valid IP address")
+	})
+}
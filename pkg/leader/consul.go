@@ -0,0 +1,148 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// Timeout for requests to the Consul API
+const consulRequestTimeout = 10 * time.Second
+
+var errConsulNotFound = errors.New("not found")
+
+// Consul is a Lock that uses a key in Consul, acquired with a session that expires if it's not renewed
+// It's not safe for concurrent use
+type Consul struct {
+	baseURL    string
+	key        string
+	token      string
+	httpClient *http.Client
+
+	// ID of the session used to acquire the key
+	sessionID string
+}
+
+// NewConsul returns a new Consul lock
+func NewConsul(cfg config.ConfigLeaderElectionConsul) *Consul {
+	return &Consul{
+		baseURL:    strings.TrimSuffix(cfg.URL, "/"),
+		key:        cfg.Key,
+		token:      cfg.Token,
+		httpClient: tracing.NewHTTPClient(),
+	}
+}
+
+// TryAcquire implements the Lock interface
+func (c *Consul) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	// Renew the session if we have one, or create a new one if it expired
+	if c.sessionID != "" {
+		err := c.do(ctx, http.MethodPut, "/v1/session/renew/"+url.PathEscape(c.sessionID), nil, nil)
+		if errors.Is(err, errConsulNotFound) {
+			c.sessionID = ""
+		} else if err != nil {
+			return false, fmt.Errorf("failed to renew Consul session: %w", err)
+		}
+	}
+	if c.sessionID == "" {
+		var session struct {
+			ID string `json:"ID"`
+		}
+		err := c.do(ctx, http.MethodPut, "/v1/session/create", map[string]any{
+			"Name": "ddup-" + holder,
+			"TTL":  strconv.Itoa(int(math.Ceil(ttl.Seconds()))) + "s",
+			// When the session expires, the key is deleted, and there's no delay before another session can acquire it
+			"Behavior":  "delete",
+			"LockDelay": "0s",
+		}, &session)
+		if err != nil {
+			return false, fmt.Errorf("failed to create Consul session: %w", err)
+		}
+		c.sessionID = session.ID
+	}
+
+	// Acquiring the key succeeds if it's not locked, or if it's already locked by our session
+	var acquired bool
+	err := c.do(ctx, http.MethodPut, "/v1/kv/"+c.key+"?acquire="+url.QueryEscape(c.sessionID), holder, &acquired)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire Consul lock: %w", err)
+	}
+	return acquired, nil
+}
+
+// Release implements the Lock interface
+func (c *Consul) Release(ctx context.Context, holder string) error {
+	if c.sessionID == "" {
+		return nil
+	}
+
+	// Destroying the session releases the key, and deletes it
+	err := c.do(ctx, http.MethodPut, "/v1/session/destroy/"+url.PathEscape(c.sessionID), nil, nil)
+	if err != nil && !errors.Is(err, errConsulNotFound) {
+		return fmt.Errorf("failed to destroy Consul session: %w", err)
+	}
+	c.sessionID = ""
+	return nil
+}
+
+func (c *Consul) do(ctx context.Context, method string, path string, body any, res any) error {
+	ctx, cancel := context.WithTimeout(ctx, consulRequestTimeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	switch v := body.(type) {
+	case nil:
+		// No body
+	case string:
+		reqBody = strings.NewReader(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to serialize request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errConsulNotFound
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("request failed: status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if res == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// Timeout for requests to the etcd API
+const etcdRequestTimeout = 10 * time.Second
+
+var errEtcdUnauthorized = errors.New("unauthorized")
+
+// Etcd is a Lock that uses a key in etcd, attached to an etcd lease that expires if it's not kept alive
+// The etcd server is accessed using its HTTP/JSON API
+// It's not safe for concurrent use
+type Etcd struct {
+	baseURL    string
+	key        string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	// Authentication token, if authentication is enabled
+	token string
+	// ID of the etcd lease attached to the key, while this replica holds the lock
+	leaseID string
+}
+
+// NewEtcd returns a new Etcd lock
+func NewEtcd(cfg config.ConfigLeaderElectionEtcd) *Etcd {
+	return &Etcd{
+		baseURL:    strings.TrimSuffix(cfg.URL, "/"),
+		key:        cfg.Key,
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: tracing.NewHTTPClient(),
+	}
+}
+
+// TryAcquire implements the Lock interface
+func (e *Etcd) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	// If we hold the lock, keep the lease alive
+	if e.leaseID != "" {
+		var res struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		err := e.call(ctx, "/v3/lease/keepalive", map[string]any{"ID": e.leaseID}, &res)
+		if err != nil {
+			return false, fmt.Errorf("failed to keep the etcd lease alive: %w", err)
+		}
+
+		// A TTL of 0 or less means the lease expired, and the key was deleted
+		if t, _ := strconv.ParseInt(res.Result.TTL, 10, 64); t > 0 {
+			// Make sure the key is still ours
+			owned, err := e.txn(ctx, etcdCompareValue(e.key, holder), nil)
+			if err != nil {
+				return false, err
+			}
+			if owned {
+				return true, nil
+			}
+			_ = e.call(ctx, "/v3/lease/revoke", map[string]any{"ID": e.leaseID}, nil)
+		}
+		e.leaseID = ""
+	}
+
+	// Grant a new lease, and create the key if it doesn't exist
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	err := e.call(ctx, "/v3/lease/grant", map[string]any{"TTL": strconv.Itoa(int(math.Ceil(ttl.Seconds())))}, &grant)
+	if err != nil {
+		return false, fmt.Errorf("failed to grant etcd lease: %w", err)
+	}
+
+	created, err := e.txn(ctx,
+		map[string]any{"key": etcdEncode(e.key), "result": "EQUAL", "target": "CREATE", "create_revision": "0"},
+		map[string]any{"request_put": map[string]any{"key": etcdEncode(e.key), "value": etcdEncode(holder), "lease": grant.ID}},
+	)
+	if err != nil || !created {
+		// Revoke the lease we don't need
+		_ = e.call(ctx, "/v3/lease/revoke", map[string]any{"ID": grant.ID}, nil)
+		return false, err
+	}
+
+	e.leaseID = grant.ID
+	return true, nil
+}
+
+// Release implements the Lock interface
+func (e *Etcd) Release(ctx context.Context, holder string) error {
+	if e.leaseID == "" {
+		return nil
+	}
+
+	// Revoking the lease deletes the key attached to it
+	err := e.call(ctx, "/v3/lease/revoke", map[string]any{"ID": e.leaseID}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to revoke etcd lease: %w", err)
+	}
+	e.leaseID = ""
+	return nil
+}
+
+// txn runs a transaction with a single comparison, and the operation to perform if it succeeds (which can be nil)
+// It returns true if the comparison succeeded
+func (e *Etcd) txn(ctx context.Context, compare map[string]any, success map[string]any) (bool, error) {
+	req := map[string]any{
+		"compare": []any{compare},
+	}
+	if success != nil {
+		req["success"] = []any{success}
+	}
+
+	var res struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err := e.call(ctx, "/v3/kv/txn", req, &res)
+	if err != nil {
+		return false, fmt.Errorf("etcd transaction failed: %w", err)
+	}
+	return res.Succeeded, nil
+}
+
+// call invokes a method of the etcd API, authenticating if needed
+func (e *Etcd) call(ctx context.Context, path string, body any, res any) error {
+	if e.username != "" && e.token == "" {
+		err := e.authenticate(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := e.post(ctx, path, body, res)
+	if errors.Is(err, errEtcdUnauthorized) && e.username != "" {
+		// The token may have expired, so authenticate again
+		err = e.authenticate(ctx)
+		if err != nil {
+			return err
+		}
+		err = e.post(ctx, path, body, res)
+	}
+	return err
+}
+
+func (e *Etcd) authenticate(ctx context.Context) error {
+	e.token = ""
+
+	var res struct {
+		Token string `json:"token"`
+	}
+	err := e.post(ctx, "/v3/auth/authenticate", map[string]any{"name": e.username, "password": e.password}, &res)
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with etcd: %w", err)
+	}
+	e.token = res.Token
+	return nil
+}
+
+func (e *Etcd) post(ctx context.Context, path string, body any, res any) error {
+	ctx, cancel := context.WithTimeout(ctx, etcdRequestTimeout)
+	defer cancel()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.token != "" {
+		req.Header.Set("Authorization", e.token)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errEtcdUnauthorized
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("request failed: status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if res == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// etcdCompareValue returns a comparison that succeeds if the key has the value
+func etcdCompareValue(key string, value string) map[string]any {
+	return map[string]any{"key": etcdEncode(key), "result": "EQUAL", "target": "VALUE", "value": etcdEncode(value)}
+}
+
+// etcdEncode encodes keys and values for the etcd API, which uses base64
+func etcdEncode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
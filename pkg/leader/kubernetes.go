@@ -0,0 +1,261 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+const (
+	// Directory where Kubernetes mounts the credentials of the pod's service account
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// Format of timestamps in Lease objects
+	k8sMicroTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+	// Timeout for requests to the Kubernetes API
+	k8sRequestTimeout = 10 * time.Second
+)
+
+var (
+	errK8sNotFound = errors.New("not found")
+	errK8sConflict = errors.New("conflict")
+)
+
+// Kubernetes is a Lock that uses a Lease object in Kubernetes, using the API server of the cluster ddup runs in
+type Kubernetes struct {
+	// URL of the Lease objects in the namespace
+	leasesURL  string
+	namespace  string
+	name       string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// k8sLease contains the properties of a Lease object
+type k8sLease struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   map[string]any `json:"metadata"`
+	Spec       k8sLeaseSpec   `json:"spec"`
+}
+
+type k8sLeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// NewKubernetes returns a new Kubernetes lock, using the in-cluster configuration
+func NewKubernetes(cfg config.ConfigLeaderElectionKubernetes) (*Kubernetes, error) {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the namespace of the pod: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	caData, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA certificate of the cluster: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, errors.New("CA certificate of the cluster is invalid")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    pool,
+	}
+
+	return newKubernetes("https://"+net.JoinHostPort(host, port), namespace, cfg.LeaseName, serviceAccountDir+"/token", &http.Client{Transport: transport}), nil
+}
+
+func newKubernetes(apiServer string, namespace string, name string, tokenFile string, httpClient *http.Client) *Kubernetes {
+	return &Kubernetes{
+		leasesURL:  apiServer + "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(namespace) + "/leases",
+		namespace:  namespace,
+		name:       name,
+		tokenFile:  tokenFile,
+		httpClient: httpClient,
+	}
+}
+
+// TryAcquire implements the Lock interface
+func (k *Kubernetes) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	lease, err := k.get(ctx)
+	if errors.Is(err, errK8sNotFound) {
+		// Create the Lease object, which is acquired by the holder
+		lease = &k8sLease{
+			Metadata: map[string]any{
+				"name":      k.name,
+				"namespace": k.namespace,
+			},
+			Spec: k8sLeaseSpec{
+				AcquireTime: now.UTC().Format(k8sMicroTimeFormat),
+			},
+		}
+		lease.setHolder(holder, ttl, now)
+		err = k.send(ctx, http.MethodPost, k.leasesURL, lease)
+		if errors.Is(err, errK8sConflict) {
+			// Another replica created it first
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to create Lease: %w", err)
+		}
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get Lease: %w", err)
+	}
+
+	if lease.Spec.HolderIdentity != holder {
+		if lease.Spec.HolderIdentity != "" && !lease.expired(now) {
+			return false, nil
+		}
+		lease.Spec.AcquireTime = now.UTC().Format(k8sMicroTimeFormat)
+		lease.Spec.LeaseTransitions++
+	}
+	lease.setHolder(holder, ttl, now)
+
+	// The update includes the resource version of the object we read, so it fails with a conflict if another replica updated it in the meanwhile
+	err = k.send(ctx, http.MethodPut, k.leaseURL(), lease)
+	if errors.Is(err, errK8sConflict) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to update Lease: %w", err)
+	}
+	return true, nil
+}
+
+// Release implements the Lock interface
+func (k *Kubernetes) Release(ctx context.Context, holder string) error {
+	lease, err := k.get(ctx)
+	if errors.Is(err, errK8sNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get Lease: %w", err)
+	}
+	if lease.Spec.HolderIdentity != holder {
+		return nil
+	}
+
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.LeaseDurationSeconds = 1
+	err = k.send(ctx, http.MethodPut, k.leaseURL(), lease)
+	if err != nil && !errors.Is(err, errK8sConflict) {
+		return fmt.Errorf("failed to update Lease: %w", err)
+	}
+	return nil
+}
+
+// leaseURL returns the URL of the Lease object
+func (k *Kubernetes) leaseURL() string {
+	return k.leasesURL + "/" + url.PathEscape(k.name)
+}
+
+func (k *Kubernetes) get(ctx context.Context) (*k8sLease, error) {
+	var lease k8sLease
+	err := k.do(ctx, http.MethodGet, k.leaseURL(), nil, &lease)
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+func (k *Kubernetes) send(ctx context.Context, method string, u string, lease *k8sLease) error {
+	lease.APIVersion = "coordination.k8s.io/v1"
+	lease.Kind = "Lease"
+	body, err := json.Marshal(lease)
+	if err != nil {
+		return fmt.Errorf("failed to serialize Lease: %w", err)
+	}
+	return k.do(ctx, method, u, body, nil)
+}
+
+func (k *Kubernetes) do(ctx context.Context, method string, u string, body []byte, res any) error {
+	ctx, cancel := context.WithTimeout(ctx, k8sRequestTimeout)
+	defer cancel()
+
+	// The token is read at every request, as Kubernetes rotates it periodically
+	token, err := os.ReadFile(k.tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the service account token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errK8sNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return errK8sConflict
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("request failed: status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	if res == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// setHolder sets the holder of the lease, renewed at the given time
+func (l *k8sLease) setHolder(holder string, ttl time.Duration, now time.Time) {
+	l.Spec.HolderIdentity = holder
+	l.Spec.LeaseDurationSeconds = int(math.Ceil(ttl.Seconds()))
+	l.Spec.RenewTime = now.UTC().Format(k8sMicroTimeFormat)
+}
+
+// expired returns true if the lease was not renewed within its duration
+func (l *k8sLease) expired(now time.Time) bool {
+	renewed, err := time.Parse(time.RFC3339Nano, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
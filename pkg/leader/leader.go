@@ -0,0 +1,191 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/logging"
+)
+
+// Timeout for releasing the lock when shutting down
+const releaseTimeout = 5 * time.Second
+
+// Lock is a lock that can be held by one replica at a time, and that expires if it's not renewed
+type Lock interface {
+	// TryAcquire acquires the lock for the holder, or renews it if the holder already has it, for the given duration
+	// It returns false if the lock is held by another holder and has not expired
+	TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release releases the lock, if it's held by the holder
+	Release(ctx context.Context, holder string) error
+}
+
+// NewLock returns the Lock for the leader election configuration
+func NewLock(cfg *config.ConfigLeaderElection) (Lock, error) {
+	switch {
+	case cfg == nil:
+		return nil, errors.New("leader election is not configured")
+	case cfg.Kubernetes != nil:
+		return NewKubernetes(*cfg.Kubernetes)
+	case cfg.Redis != nil:
+		return NewRedis(*cfg.Redis)
+	case cfg.Etcd != nil:
+		return NewEtcd(*cfg.Etcd), nil
+	case cfg.Consul != nil:
+		return NewConsul(*cfg.Consul), nil
+	default:
+		return nil, errors.New("no lock backend is configured")
+	}
+}
+
+// Elector runs leader election between replicas of ddup, using a Lock
+type Elector struct {
+	lock          Lock
+	identity      string
+	leaseDuration time.Duration
+	retryInterval time.Duration
+
+	// Receives a message when this replica becomes the leader
+	electedCh chan struct{}
+
+	mu sync.Mutex
+	// This replica is the leader until this time, unless it renews its leadership
+	// Protected by mu
+	leaderUntil time.Time
+}
+
+// NewElector returns a new Elector for the leader election configuration
+func NewElector(cfg *config.ConfigLeaderElection) (*Elector, error) {
+	lock, err := NewLock(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := cfg.Identity
+	if identity == "" {
+		identity, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname to use as identity: %w", err)
+		}
+	}
+
+	return newElector(lock, identity, cfg.LeaseDuration, cfg.RetryInterval), nil
+}
+
+func newElector(lock Lock, identity string, leaseDuration time.Duration, retryInterval time.Duration) *Elector {
+	return &Elector{
+		lock:          lock,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		retryInterval: retryInterval,
+		electedCh:     make(chan struct{}, 1),
+	}
+}
+
+// IsLeader returns true if this replica is currently the leader
+func (e *Elector) IsLeader() bool {
+	return e.isLeaderAt(time.Now())
+}
+
+// Elected returns a channel that receives a message when this replica becomes the leader
+func (e *Elector) Elected() <-chan struct{} {
+	return e.electedCh
+}
+
+// Identity returns the identity of this replica
+func (e *Elector) Identity() string {
+	return e.identity
+}
+
+// Run tries to acquire the leadership, and renews it while this replica is the leader
+// When the context is canceled, the leadership is released, so another replica can take over right away
+func (e *Elector) Run(ctx context.Context) error {
+	logger().InfoContext(ctx, "Leader election started", "identity", e.identity, "leaseDuration", e.leaseDuration)
+
+	e.tryAcquire(ctx)
+
+	ticker := time.NewTicker(e.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.release()
+			return nil
+		case <-ticker.C:
+			e.tryAcquire(ctx)
+		}
+	}
+}
+
+// tryAcquire tries to acquire or renew the leadership
+func (e *Elector) tryAcquire(ctx context.Context) {
+	start := time.Now()
+	wasLeader := e.isLeaderAt(start)
+
+	acquired, err := e.lock.TryAcquire(ctx, e.identity, e.leaseDuration)
+	switch {
+	case err != nil:
+		// Until the leadership expires, no other replica can acquire it, so we keep it
+		logger().WarnContext(ctx, "Failed to acquire or renew the leadership", "error", err)
+		if wasLeader && !e.IsLeader() {
+			logger().WarnContext(ctx, "Leadership expired, this replica is no longer the leader")
+		}
+	case acquired:
+		// The leadership is considered valid until one retry interval before it expires, to account for delays renewing it
+		e.setLeaderUntil(start.Add(e.leaseDuration - e.retryInterval))
+		if !wasLeader {
+			logger().InfoContext(ctx, "This replica is now the leader", "identity", e.identity)
+			select {
+			case e.electedCh <- struct{}{}:
+			default:
+			}
+		}
+	default:
+		e.setLeaderUntil(time.Time{})
+		if wasLeader {
+			logger().WarnContext(ctx, "Leadership was acquired by another replica, this replica is no longer the leader")
+		}
+	}
+}
+
+// release releases the leadership, if this replica has it
+func (e *Elector) release() {
+	if !e.IsLeader() {
+		return
+	}
+	e.setLeaderUntil(time.Time{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	err := e.lock.Release(ctx, e.identity)
+	if err != nil {
+		logger().Warn("Failed to release the leadership", "error", err)
+		return
+	}
+	logger().Info("Released the leadership")
+}
+
+func (e *Elector) isLeaderAt(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return now.Before(e.leaderUntil)
+}
+
+func (e *Elector) setLeaderUntil(t time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leaderUntil = t
+}
+
+// logger returns the logger for leader election
+func logger() *slog.Logger {
+	return logging.Component("leader")
+}
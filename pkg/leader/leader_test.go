@@ -0,0 +1,428 @@
+package leader
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// mockLock is a Lock whose result is set by the test
+type mockLock struct {
+	acquired bool
+	err      error
+	released []string
+}
+
+func (m *mockLock) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return m.acquired, m.err
+}
+
+func (m *mockLock) Release(ctx context.Context, holder string) error {
+	m.released = append(m.released, holder)
+	return nil
+}
+
+func TestElector(t *testing.T) {
+	t.Run("Acquire and lose leadership", func(t *testing.T) {
+		lock := &mockLock{acquired: true}
+		e := newElector(lock, "replica-1", 15*time.Second, 5*time.Second)
+		assert.False(t, e.IsLeader())
+
+		e.tryAcquire(t.Context())
+		assert.True(t, e.IsLeader())
+		select {
+		case <-e.Elected():
+		default:
+			t.Fatal("Expected a message on the elected channel")
+		}
+
+		// Renewing the leadership does not send another message
+		e.tryAcquire(t.Context())
+		assert.True(t, e.IsLeader())
+		assert.Empty(t, e.Elected())
+
+		// Another replica acquired the lock
+		lock.acquired = false
+		e.tryAcquire(t.Context())
+		assert.False(t, e.IsLeader())
+	})
+
+	t.Run("Errors keep the leadership until it expires", func(t *testing.T) {
+		lock := &mockLock{acquired: true}
+		e := newElector(lock, "replica-1", 15*time.Second, 5*time.Second)
+		e.tryAcquire(t.Context())
+		require.True(t, e.IsLeader())
+
+		lock.err = errors.New("lock unavailable")
+		e.tryAcquire(t.Context())
+		assert.True(t, e.IsLeader())
+
+		e.setLeaderUntil(time.Now().Add(-time.Second))
+		e.tryAcquire(t.Context())
+		assert.False(t, e.IsLeader())
+	})
+
+	t.Run("Leadership is released when stopping", func(t *testing.T) {
+		lock := &mockLock{acquired: true}
+		e := newElector(lock, "replica-1", 15*time.Second, 5*time.Second)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error)
+		go func() {
+			done <- e.Run(ctx)
+		}()
+
+		<-e.Elected()
+		cancel()
+		require.NoError(t, <-done)
+		assert.False(t, e.IsLeader())
+		assert.Equal(t, []string{"replica-1"}, lock.released)
+	})
+}
+
+// fakeLeaseServer is a minimal implementation of the Kubernetes API for Lease objects
+type fakeLeaseServer struct {
+	lock            sync.Mutex
+	lease           map[string]any
+	resourceVersion int
+}
+
+func (f *fakeLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	const leasesPath = "/apis/coordination.k8s.io/v1/namespaces/ns/leases"
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == leasesPath+"/ddup":
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.lease)
+	case r.Method == http.MethodPost && r.URL.Path == leasesPath:
+		if f.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.store(w, r)
+	case r.Method == http.MethodPut && r.URL.Path == leasesPath+"/ddup":
+		var lease map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&lease)
+		metadata, _ := lease["metadata"].(map[string]any)
+		if f.lease == nil || metadata["resourceVersion"] != strconv.Itoa(f.resourceVersion) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.lease = lease
+		f.resourceVersion++
+		metadata["resourceVersion"] = strconv.Itoa(f.resourceVersion)
+		_ = json.NewEncoder(w).Encode(f.lease)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeLeaseServer) store(w http.ResponseWriter, r *http.Request) {
+	var lease map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&lease)
+	f.resourceVersion++
+	lease["metadata"].(map[string]any)["resourceVersion"] = strconv.Itoa(f.resourceVersion)
+	f.lease = lease
+	_ = json.NewEncoder(w).Encode(f.lease)
+}
+
+func (f *fakeLeaseServer) spec() map[string]any {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.lease["spec"].(map[string]any)
+}
+
+func TestKubernetes(t *testing.T) {
+	fake := &fakeLeaseServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("test-token\n"), 0o600))
+
+	k := newKubernetes(srv.URL, "ns", "ddup", tokenFile, srv.Client())
+
+	// The lease is created by the first replica
+	ok, err := k.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "replica-1", fake.spec()["holderIdentity"])
+	assert.EqualValues(t, 15, fake.spec()["leaseDurationSeconds"])
+
+	// Other replicas can't acquire it while it's valid
+	ok, err = k.TryAcquire(t.Context(), "replica-2", 15*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// The holder can renew it
+	ok, err = k.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Once it expires, another replica takes over
+	fake.spec()["renewTime"] = time.Now().Add(-time.Minute).UTC().Format(k8sMicroTimeFormat)
+	ok, err = k.TryAcquire(t.Context(), "replica-2", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "replica-2", fake.spec()["holderIdentity"])
+	assert.EqualValues(t, 1, fake.spec()["leaseTransitions"])
+
+	// Releasing is a no-op for replicas that are not the holder
+	require.NoError(t, k.Release(t.Context(), "replica-1"))
+	assert.Equal(t, "replica-2", fake.spec()["holderIdentity"])
+
+	// After the holder releases it, another replica can acquire it right away
+	require.NoError(t, k.Release(t.Context(), "replica-2"))
+	assert.Nil(t, fake.spec()["holderIdentity"])
+	ok, err = k.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// fakeEtcdServer is a minimal implementation of the etcd HTTP/JSON API, with a single key
+type fakeEtcdServer struct {
+	lock sync.Mutex
+	// Value of the key, and the lease it's attached to
+	value   string
+	leaseOf string
+	// Leases that are alive
+	leases map[string]bool
+	nextID int
+}
+
+func (f *fakeEtcdServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var req map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.leases[id] = true
+		_ = json.NewEncoder(w).Encode(map[string]any{"ID": id, "TTL": req["TTL"]})
+	case "/v3/lease/keepalive":
+		ttl := "0"
+		if f.leases[req["ID"].(string)] {
+			ttl = "15"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"ID": req["ID"], "TTL": ttl}})
+	case "/v3/lease/revoke":
+		id := req["ID"].(string)
+		delete(f.leases, id)
+		if f.leaseOf == id {
+			f.value = ""
+			f.leaseOf = ""
+		}
+		_, _ = w.Write([]byte("{}"))
+	case "/v3/kv/txn":
+		cmp := req["compare"].([]any)[0].(map[string]any)
+		var ok bool
+		switch cmp["target"] {
+		case "CREATE":
+			ok = f.value == ""
+		case "VALUE":
+			value, _ := base64.StdEncoding.DecodeString(cmp["value"].(string))
+			ok = f.value != "" && f.value == string(value)
+		}
+		if ok && req["success"] != nil {
+			put := req["success"].([]any)[0].(map[string]any)["request_put"].(map[string]any)
+			value, _ := base64.StdEncoding.DecodeString(put["value"].(string))
+			f.value = string(value)
+			f.leaseOf = put["lease"].(string)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"succeeded": ok})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// expire simulates the expiration of the lease the key is attached to
+func (f *fakeEtcdServer) expire() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.leases, f.leaseOf)
+	f.value = ""
+	f.leaseOf = ""
+}
+
+func TestEtcd(t *testing.T) {
+	fake := &fakeEtcdServer{leases: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	e1 := newTestEtcd(srv)
+	e2 := newTestEtcd(srv)
+
+	ok, err := e1.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "replica-1", fake.value)
+
+	// Other replicas can't acquire it, and the lease they were granted is revoked
+	ok, err = e2.TryAcquire(t.Context(), "replica-2", 15*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Len(t, fake.leases, 1)
+
+	// The holder keeps the lease alive
+	ok, err = e1.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Once the lease expires, another replica takes over
+	fake.expire()
+	ok, err = e2.TryAcquire(t.Context(), "replica-2", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = e1.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Releasing revokes the lease, which deletes the key
+	require.NoError(t, e2.Release(t.Context(), "replica-2"))
+	assert.Empty(t, fake.value)
+}
+
+func newTestEtcd(srv *httptest.Server) *Etcd {
+	e := NewEtcd(config.ConfigLeaderElectionEtcd{URL: srv.URL, Key: "ddup/leader"})
+	e.httpClient = srv.Client()
+	return e
+}
+
+// fakeConsulServer is a minimal implementation of the Consul API for sessions and locks, with a single key
+type fakeConsulServer struct {
+	lock sync.Mutex
+	// Sessions that are valid
+	sessions map[string]bool
+	// Session holding the key, and its value
+	holder string
+	value  string
+	nextID int
+}
+
+func (f *fakeConsulServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if r.Header.Get("X-Consul-Token") != "token" || r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		f.nextID++
+		id := "session-" + strconv.Itoa(f.nextID)
+		f.sessions[id] = true
+		_ = json.NewEncoder(w).Encode(map[string]any{"ID": id})
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		if !f.sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		f.invalidate(strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/"))
+		_, _ = w.Write([]byte("true"))
+	case r.URL.Path == "/v1/kv/ddup/leader":
+		session := r.URL.Query().Get("acquire")
+		ok := f.sessions[session] && (f.holder == "" || f.holder == session)
+		if ok {
+			body, _ := io.ReadAll(r.Body)
+			f.holder = session
+			f.value = string(body)
+		}
+		_ = json.NewEncoder(w).Encode(ok)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// invalidate invalidates a session, deleting the key if it holds it
+func (f *fakeConsulServer) invalidate(session string) {
+	delete(f.sessions, session)
+	if f.holder == session {
+		f.holder = ""
+		f.value = ""
+	}
+}
+
+func TestConsul(t *testing.T) {
+	fake := &fakeConsulServer{sessions: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	c1 := newTestConsul(srv)
+	c2 := newTestConsul(srv)
+
+	ok, err := c1.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "replica-1", fake.value)
+
+	ok, err = c2.TryAcquire(t.Context(), "replica-2", 15*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// The holder renews its session
+	ok, err = c1.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Once the session expires, another replica takes over
+	fake.lock.Lock()
+	fake.invalidate(c1.sessionID)
+	fake.lock.Unlock()
+	ok, err = c2.TryAcquire(t.Context(), "replica-2", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The previous holder creates a new session, but can't acquire the key
+	ok, err = c1.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Releasing destroys the session, which deletes the key
+	require.NoError(t, c2.Release(t.Context(), "replica-2"))
+	assert.Empty(t, fake.value)
+	ok, err = c1.TryAcquire(t.Context(), "replica-1", 15*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func newTestConsul(srv *httptest.Server) *Consul {
+	c := NewConsul(config.ConfigLeaderElectionConsul{URL: srv.URL, Key: "ddup/leader", Token: "token"})
+	c.httpClient = srv.Client()
+	return c
+}
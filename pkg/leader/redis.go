@@ -0,0 +1,69 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+var (
+	// Acquires the lock if it's not set, or renews it if it's held by the holder
+	redisAcquireScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+	// Deletes the lock if it's held by the holder
+	redisReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+// Redis is a Lock that uses a key in Redis, which expires if it's not renewed
+type Redis struct {
+	key    string
+	client *redis.Client
+}
+
+// NewRedis returns a new Redis lock
+func NewRedis(cfg config.ConfigLeaderElectionRedis) (*Redis, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	return &Redis{
+		key:    cfg.Key,
+		client: redis.NewClient(opts),
+	}, nil
+}
+
+// TryAcquire implements the Lock interface
+func (r *Redis) TryAcquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	res, err := redisAcquireScript.Run(ctx, r.client, []string{r.key}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire Redis lock: %w", err)
+	}
+	return res == 1, nil
+}
+
+// Release implements the Lock interface
+func (r *Redis) Release(ctx context.Context, holder string) error {
+	err := redisReleaseScript.Run(ctx, r.client, []string{r.key}, holder).Err()
+	if err != nil {
+		return fmt.Errorf("failed to release Redis lock: %w", err)
+	}
+	return nil
+}
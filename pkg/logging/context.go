@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// contextAttrsKey is the key for the attributes stored in the context
+type contextAttrsKey struct{}
+
+// ContextWithAttrs returns a context that contains attributes that are added to all logs emitted with it, such as the ID of a request
+// Attributes are added to the ones already in the context
+func ContextWithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(contextAttrsKey{}).([]slog.Attr)
+	all := make([]slog.Attr, 0, len(prev)+len(attrs))
+	all = append(all, prev...)
+	all = append(all, attrs...)
+	return context.WithValue(ctx, contextAttrsKey{}, all)
+}
+
+// ContextHandler is a slog.Handler that adds the attributes stored in the context with ContextWithAttrs to each record
+type ContextHandler struct {
+	next slog.Handler
+}
+
+// NewContextHandler returns a new ContextHandler that passes records to the next handler
+func NewContextHandler(next slog.Handler) *ContextHandler {
+	return &ContextHandler{next: next}
+}
+
+// Enabled implements slog.Handler
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *ContextHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs, _ := ctx.Value(contextAttrsKey{}).([]slog.Attr)
+	if len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{next: h.next.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	next := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	log := slog.New(NewContextHandler(next)).With(ComponentKey, "server")
+
+	ctx := ContextWithAttrs(t.Context(), slog.String("requestId", "abc"))
+	log.InfoContext(ctx, "with context")
+	log.InfoContext(t.Context(), "without context")
+	log.InfoContext(ContextWithAttrs(ctx, slog.Int("n", 1)), "nested")
+
+	assert.Equal(t, []string{
+		`level=INFO msg="with context" component=server requestId=abc`,
+		`level=INFO msg="without context" component=server`,
+		`level=INFO msg=nested component=server requestId=abc n=1`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
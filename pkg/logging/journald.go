@@ -0,0 +1,191 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Path of the socket used by systemd-journald for the native protocol
+var journaldSocket = "/run/systemd/journal/socket"
+
+// JournaldHandler is a slog.Handler that sends logs to systemd-journald using its native protocol
+// Attributes are sent as journal fields, with names converted to uppercase, and nested in groups using "_" as separator
+type JournaldHandler struct {
+	level      slog.Leveler
+	identifier string
+
+	// Shared with handlers derived using WithAttrs and WithGroup
+	conn *journaldConn
+
+	// Fields from WithAttrs, already encoded
+	fields []byte
+	// Prefix for the name of the fields, from WithGroup
+	prefix string
+}
+
+// NewJournaldHandler returns a new JournaldHandler that connects to the journal
+func NewJournaldHandler(identifier string, level slog.Leveler) (*JournaldHandler, error) {
+	conn, err := net.Dial("unixgram", journaldSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the journal: %w", err)
+	}
+
+	if identifier == "" {
+		identifier = "ddup"
+	}
+
+	return &JournaldHandler{
+		level:      level,
+		identifier: identifier,
+		conn:       &journaldConn{conn: conn},
+	}, nil
+}
+
+// Enabled implements slog.Handler
+func (h *JournaldHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle implements slog.Handler
+func (h *JournaldHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	appendJournaldField(&buf, "MESSAGE", r.Message)
+	// Journal priorities are the same as syslog severities
+	appendJournaldField(&buf, "PRIORITY", strconv.Itoa(syslogSeverity(r.Level)))
+	appendJournaldField(&buf, "SYSLOG_IDENTIFIER", h.identifier)
+	buf.Write(h.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		appendJournaldAttr(&buf, h.prefix, a)
+		return true
+	})
+
+	return h.conn.write(buf.Bytes())
+}
+
+// WithAttrs implements slog.Handler
+func (h *JournaldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	buf := bytes.NewBuffer(bytes.Clone(h.fields))
+	for _, a := range attrs {
+		appendJournaldAttr(buf, h.prefix, a)
+	}
+
+	h2 := *h
+	h2.fields = buf.Bytes()
+	return &h2
+}
+
+// WithGroup implements slog.Handler
+func (h *JournaldHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.prefix = h.prefix + name + "_"
+	return &h2
+}
+
+// Close the connection to the journal
+func (h *JournaldHandler) Close() error {
+	return h.conn.close()
+}
+
+// appendJournaldAttr appends an attribute to the buffer, flattening groups
+func appendJournaldAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		// Attributes in groups with an empty key are inlined
+		if a.Key != "" {
+			prefix += a.Key + "_"
+		}
+		for _, ga := range a.Value.Group() {
+			appendJournaldAttr(buf, prefix, ga)
+		}
+		return
+	}
+
+	name := journaldFieldName(prefix + a.Key)
+	if name == "" {
+		return
+	}
+	appendJournaldField(buf, name, a.Value.String())
+}
+
+// appendJournaldField appends a field to the buffer, using the journal's native protocol
+func appendJournaldField(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+
+	// Values that contain newlines are encoded with their length
+	if strings.ContainsRune(value, '\n') {
+		buf.WriteByte('\n')
+		_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buf.WriteByte('=')
+	}
+
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldFieldName returns a valid name for a journal field
+// Names can only contain uppercase letters, digits, and underscores, must not start with an underscore or digit, and are at most 64 characters
+func journaldFieldName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+
+	// Fields starting with an underscore are reserved for the journal
+	res := strings.TrimLeft(string(name), "_")
+	if res != "" && res[0] >= '0' && res[0] <= '9' {
+		res = "F_" + res
+	}
+	if len(res) > 64 {
+		res = res[:64]
+	}
+	return res
+}
+
+// journaldConn is the connection to the journal
+type journaldConn struct {
+	conn net.Conn
+	lock sync.Mutex
+}
+
+func (c *journaldConn) write(msg []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	// Each message is sent as a single datagram
+	_, err := c.conn.Write(msg)
+	return err
+}
+
+func (c *journaldConn) close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournaldHandler(t *testing.T) {
+	// Listen on a socket that replaces the journal's
+	socket := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenPacket("unixgram", socket)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	origSocket := journaldSocket
+	journaldSocket = socket
+	t.Cleanup(func() {
+		journaldSocket = origSocket
+	})
+
+	h, err := NewJournaldHandler("ddup", slog.LevelInfo)
+	require.NoError(t, err)
+	defer h.Close()
+
+	receive := func(t *testing.T) map[string]string {
+		t.Helper()
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		return parseJournaldFields(t, buf[:n])
+	}
+
+	log := slog.New(h).With("domain", "app.example.com")
+	log.Debug("Not sent")
+	log.WithGroup("dns").Error("Failed to update records", "provider", "cf", "error", "line 1\nline 2")
+
+	fields := receive(t)
+	assert.Equal(t, map[string]string{
+		"MESSAGE":           "Failed to update records",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "ddup",
+		"DOMAIN":            "app.example.com",
+		"DNS_PROVIDER":      "cf",
+		"DNS_ERROR":         "line 1\nline 2",
+	}, fields)
+
+	log.Info("Endpoint is up", slog.Group("endpoint", "ip", "10.0.0.1", "healthy", true))
+	fields = receive(t)
+	assert.Equal(t, "6", fields["PRIORITY"])
+	assert.Equal(t, "10.0.0.1", fields["ENDPOINT_IP"])
+	assert.Equal(t, "true", fields["ENDPOINT_HEALTHY"])
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	assert.Equal(t, "DOMAIN", journaldFieldName("domain"))
+	assert.Equal(t, "RETRY_DELAY", journaldFieldName("retry-delay"))
+	assert.Equal(t, "PRIVATE", journaldFieldName("_private"))
+	assert.Equal(t, "F_1ST", journaldFieldName("1st"))
+	assert.Empty(t, journaldFieldName("__"))
+	assert.Len(t, journaldFieldName(string(bytes.Repeat([]byte("a"), 100))), 64)
+}
+
+// parseJournaldFields parses a message encoded with the journal's native protocol
+func parseJournaldFields(t *testing.T, msg []byte) map[string]string {
+	t.Helper()
+
+	res := map[string]string{}
+	for len(msg) > 0 {
+		i := bytes.IndexAny(msg, "=\n")
+		require.GreaterOrEqual(t, i, 0)
+		name := string(msg[:i])
+
+		if msg[i] == '=' {
+			end := bytes.IndexByte(msg, '\n')
+			require.Greater(t, end, i)
+			res[name] = string(msg[i+1 : end])
+			msg = msg[end+1:]
+			continue
+		}
+
+		// Binary-safe format: little-endian 64-bit length, followed by the value and a newline
+		msg = msg[i+1:]
+		require.GreaterOrEqual(t, len(msg), 8)
+		l := int(binary.LittleEndian.Uint64(msg[:8]))
+		msg = msg[8:]
+		require.Greater(t, len(msg), l)
+		res[name] = string(msg[:l])
+		msg = msg[l+1:]
+	}
+	return res
+}
@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/italypaleale/go-kit/observability"
+
+	"github.com/italypaleale/ddup/pkg/buildinfo"
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// destinationHandler is a slog.Handler that sends logs to a destination other than the standard output
+type destinationHandler interface {
+	slog.Handler
+	Close() error
+}
+
+// InitLogs returns the logger for the app, using the logging configuration
+// If syslog or journald are configured, logs are sent there instead of the standard output; they are still sent to OpenTelemetry, if enabled
+// If levels are configured for components, logs are filtered by a LevelRouter
+func InitLogs(ctx context.Context, cfg *config.Config) (log *slog.Logger, shutdownFn func(ctx context.Context) error, err error) {
+	level, err := observability.GetLogLevel(cfg.Logs.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The underlying handlers must accept logs at the lowest level used by any component, as filtering is done by the router
+	minLevel := level
+	levels := make(map[string]slog.Level, len(cfg.Logs.Levels))
+	for component, l := range cfg.Logs.Levels {
+		componentLevel, err := observability.GetLogLevel(l)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid log level for component '%s': %w", component, err)
+		}
+		levels[component] = componentLevel
+		minLevel = min(minLevel, componentLevel)
+	}
+
+	opts := observability.InitLogsOpts{
+		Config:     cfg,
+		Level:      minLevel.String(),
+		JSON:       cfg.Logs.JSON,
+		AppName:    buildinfo.AppName,
+		AppVersion: buildinfo.AppVersion,
+	}
+
+	var dest destinationHandler
+	switch {
+	case cfg.Logs.Syslog != nil:
+		dest, err = NewSyslogHandler(*cfg.Logs.Syslog, minLevel)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize syslog: %w", err)
+		}
+	case cfg.Logs.Journald:
+		dest, err = NewJournaldHandler(buildinfo.AppName, minLevel)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize journald: %w", err)
+		}
+	}
+
+	// When logs are sent to another destination, the output of the logger returned by observability.InitLogs is discarded
+	// We still need it because it sends logs to OpenTelemetry
+	var devNull *os.File
+	if dest != nil {
+		devNull, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			_ = dest.Close()
+			return nil, nil, fmt.Errorf("failed to open %s: %w", os.DevNull, err)
+		}
+		opts.Writer = devNull
+		opts.JSON = true
+	}
+
+	base, shutdownFn, err := observability.InitLogs(ctx, opts)
+	if err != nil {
+		if dest != nil {
+			_ = dest.Close()
+			_ = devNull.Close()
+		}
+		return nil, nil, err
+	}
+
+	// The base logger's handler already includes the app's name and version
+	handler := base.Handler()
+	if dest != nil {
+		handler = slog.NewMultiHandler(
+			handler,
+			dest.WithAttrs([]slog.Attr{
+				slog.String("app", buildinfo.AppName),
+				slog.String("version", buildinfo.AppVersion),
+			}),
+		)
+
+		baseShutdownFn := shutdownFn
+		shutdownFn = func(ctx context.Context) error {
+			return errors.Join(
+				baseShutdownFn(ctx),
+				dest.Close(),
+				devNull.Close(),
+			)
+		}
+	}
+
+	if len(levels) > 0 {
+		handler = NewLevelRouter(handler, level, levels)
+	}
+
+	// Add attributes stored in the context, such as request IDs
+	handler = NewContextHandler(handler)
+
+	return slog.New(handler), shutdownFn, nil
+}
@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FailureAction indicates how a failure should be logged
+type FailureAction int
+
+const (
+	// FailureLogFull indicates that the failure is new and should be logged in full
+	FailureLogFull FailureAction = iota
+	// FailureLogSummary indicates that the failure is still occurring, and a summary should be logged
+	FailureLogSummary
+	// FailureLogSuppressed indicates that the failure is still occurring, and it should not be logged
+	FailureLogSuppressed
+)
+
+// FailureStatus is the status of a failure that may be repeating
+type FailureStatus struct {
+	// How the failure should be logged
+	Action FailureAction
+	// Number of consecutive failures, including the current one
+	Count int
+	// Time of the first failure
+	Since time.Time
+}
+
+// RepeatedFailures suppresses logs for failures that repeat, such as an endpoint that stays down
+// The first failure is logged in full, then a summary is logged periodically until the failure is resolved
+// Methods are safe for concurrent use; a nil RepeatedFailures logs all failures in full
+type RepeatedFailures struct {
+	lock     sync.Mutex
+	interval time.Duration
+	failures map[string]*repeatedFailure
+}
+
+type repeatedFailure struct {
+	since      time.Time
+	count      int
+	lastLogged time.Time
+}
+
+// NewRepeatedFailures returns a new RepeatedFailures that logs summaries at the given interval
+func NewRepeatedFailures(interval time.Duration) *RepeatedFailures {
+	return &RepeatedFailures{
+		interval: interval,
+		failures: make(map[string]*repeatedFailure),
+	}
+}
+
+// SetInterval updates the interval for summaries
+func (r *RepeatedFailures) SetInterval(interval time.Duration) {
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.interval = interval
+}
+
+// Failure records a failure for the key, and returns how it should be logged
+func (r *RepeatedFailures) Failure(key string, now time.Time) FailureStatus {
+	if r == nil {
+		return FailureStatus{Action: FailureLogFull, Count: 1, Since: now}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	f, ok := r.failures[key]
+	if !ok {
+		r.failures[key] = &repeatedFailure{
+			since:      now,
+			count:      1,
+			lastLogged: now,
+		}
+		return FailureStatus{Action: FailureLogFull, Count: 1, Since: now}
+	}
+
+	f.count++
+	res := FailureStatus{Action: FailureLogSuppressed, Count: f.count, Since: f.since}
+	if now.Sub(f.lastLogged) >= r.interval {
+		res.Action = FailureLogSummary
+		f.lastLogged = now
+	}
+	return res
+}
+
+// Success records that the key is not failing anymore
+// It returns the status of the failure that was resolved, with a Count of 0 if the key was not failing
+func (r *RepeatedFailures) Success(key string) FailureStatus {
+	if r == nil {
+		return FailureStatus{}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	f, ok := r.failures[key]
+	if !ok {
+		return FailureStatus{}
+	}
+	delete(r.failures, key)
+	return FailureStatus{Action: FailureLogFull, Count: f.count, Since: f.since}
+}
+
+// Log records a failure for the key and logs it: in full the first time, then as periodic summaries
+// Suppressed failures are logged at the debug level
+func (r *RepeatedFailures) Log(ctx context.Context, log *slog.Logger, key string, level slog.Level, msg string, args ...any) {
+	now := time.Now()
+	status := r.Failure(key, now)
+	switch status.Action {
+	case FailureLogSummary:
+		args = append(args, "checks", status.Count, "duration", now.Sub(status.Since).Round(time.Second))
+		log.Log(ctx, level, msg+" (still failing)", args...)
+	case FailureLogSuppressed:
+		log.Log(ctx, slog.LevelDebug, msg, args...)
+	default:
+		log.Log(ctx, level, msg, args...)
+	}
+}
+
+// Resolved records that the key is not failing anymore, and if it was, logs the message with a summary of the failure
+func (r *RepeatedFailures) Resolved(ctx context.Context, log *slog.Logger, key string, msg string, args ...any) {
+	status := r.Success(key)
+	if status.Count == 0 {
+		return
+	}
+
+	args = append(args, "checks", status.Count, "duration", time.Since(status.Since).Round(time.Second))
+	log.InfoContext(ctx, msg, args...)
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepeatedFailures(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("First failure, suppression, and summaries", func(t *testing.T) {
+		r := NewRepeatedFailures(time.Hour)
+
+		status := r.Failure("a", start)
+		assert.Equal(t, FailureStatus{Action: FailureLogFull, Count: 1, Since: start}, status)
+
+		// Failures are suppressed until the interval has passed since the last log
+		for i := 1; i < 120; i++ {
+			status = r.Failure("a", start.Add(time.Duration(i)*30*time.Second))
+			assert.Equal(t, FailureLogSuppressed, status.Action)
+			assert.Equal(t, i+1, status.Count)
+		}
+
+		status = r.Failure("a", start.Add(time.Hour))
+		assert.Equal(t, FailureStatus{Action: FailureLogSummary, Count: 121, Since: start}, status)
+
+		status = r.Failure("a", start.Add(time.Hour+30*time.Second))
+		assert.Equal(t, FailureLogSuppressed, status.Action)
+
+		// Other keys are tracked separately
+		status = r.Failure("b", start.Add(time.Hour))
+		assert.Equal(t, FailureLogFull, status.Action)
+	})
+
+	t.Run("Success resets the state", func(t *testing.T) {
+		r := NewRepeatedFailures(time.Hour)
+
+		assert.Equal(t, FailureStatus{}, r.Success("a"))
+
+		r.Failure("a", start)
+		r.Failure("a", start.Add(time.Minute))
+		assert.Equal(t, FailureStatus{Action: FailureLogFull, Count: 2, Since: start}, r.Success("a"))
+
+		// After the failure is resolved, the next one is logged in full
+		status := r.Failure("a", start.Add(2*time.Minute))
+		assert.Equal(t, FailureStatus{Action: FailureLogFull, Count: 1, Since: start.Add(2 * time.Minute)}, status)
+	})
+
+	t.Run("Nil logs everything", func(t *testing.T) {
+		var r *RepeatedFailures
+
+		r.SetInterval(time.Minute)
+		assert.Equal(t, FailureLogFull, r.Failure("a", start).Action)
+		assert.Equal(t, FailureLogFull, r.Failure("a", start).Action)
+		assert.Equal(t, FailureStatus{}, r.Success("a"))
+	})
+
+	t.Run("Log and resolve", func(t *testing.T) {
+		var buf bytes.Buffer
+		log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+			Level: slog.LevelInfo,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}))
+		lines := func() []string {
+			defer buf.Reset()
+			return strings.Split(strings.TrimSpace(buf.String()), "\n")
+		}
+
+		r := NewRepeatedFailures(time.Hour)
+		r.Log(t.Context(), log, "a", slog.LevelWarn, "Check failed", "ip", "10.0.0.1")
+		r.Log(t.Context(), log, "a", slog.LevelWarn, "Check failed", "ip", "10.0.0.1")
+		assert.Equal(t, []string{`level=WARN msg="Check failed" ip=10.0.0.1`}, lines())
+
+		// With a zero interval, a summary is logged for every repeated failure
+		r.SetInterval(0)
+		r.Log(t.Context(), log, "a", slog.LevelWarn, "Check failed", "ip", "10.0.0.1")
+		assert.Equal(t, []string{`level=WARN msg="Check failed (still failing)" ip=10.0.0.1 checks=3 duration=0s`}, lines())
+
+		r.Resolved(t.Context(), log, "a", "Recovered", "ip", "10.0.0.1")
+		assert.Equal(t, []string{`level=INFO msg=Recovered ip=10.0.0.1 checks=3 duration=0s`}, lines())
+
+		// Not failing, so nothing is logged
+		r.Resolved(t.Context(), log, "a", "Recovered", "ip", "10.0.0.1")
+		assert.Empty(t, buf.String())
+	})
+}
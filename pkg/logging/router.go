@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// ComponentKey is the attribute that identifies the component that emits a log
+const ComponentKey = "component"
+
+// Component returns a logger for a component of the app, whose level can be configured separately
+// The logger is derived from the default one, so it must be invoked after the default logger is set, and not stored in global variables
+func Component(name string) *slog.Logger {
+	return slog.Default().With(slog.String(ComponentKey, name))
+}
+
+// LevelRouter is a slog.Handler that filters logs using a level that depends on the component that emits them
+// The component is set with the ComponentKey attribute on the logger, such as with Component
+// The underlying handler must accept logs at the lowest level used by any component
+type LevelRouter struct {
+	next         slog.Handler
+	defaultLevel slog.Level
+	levels       map[string]slog.Level
+
+	// Level for the component of this handler
+	level slog.Level
+	// If true, the handler was derived using WithGroup
+	grouped bool
+}
+
+// NewLevelRouter returns a new LevelRouter that filters logs before passing them to the next handler
+func NewLevelRouter(next slog.Handler, defaultLevel slog.Level, levels map[string]slog.Level) *LevelRouter {
+	return &LevelRouter{
+		next:         next,
+		defaultLevel: defaultLevel,
+		levels:       levels,
+		level:        defaultLevel,
+	}
+}
+
+// Enabled implements slog.Handler
+func (h *LevelRouter) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *LevelRouter) Handle(ctx context.Context, r slog.Record) error {
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *LevelRouter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+
+	// Attributes added after a group are not top-level, so they don't set the component
+	if h.grouped {
+		return &h2
+	}
+	for _, a := range attrs {
+		if a.Key != ComponentKey {
+			continue
+		}
+		level, ok := h.levels[a.Value.String()]
+		if ok {
+			h2.level = level
+		} else {
+			h2.level = h.defaultLevel
+		}
+	}
+	return &h2
+}
+
+// WithGroup implements slog.Handler
+func (h *LevelRouter) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.grouped = true
+	return &h2
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelRouter(t *testing.T) {
+	var buf bytes.Buffer
+	next := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	log := slog.New(NewLevelRouter(next, slog.LevelInfo, map[string]slog.Level{
+		"dns":    slog.LevelDebug,
+		"server": slog.LevelWarn,
+	}))
+
+	lines := func() []string {
+		defer buf.Reset()
+		return strings.Split(strings.TrimSpace(buf.String()), "\n")
+	}
+
+	t.Run("Default level", func(t *testing.T) {
+		log.Debug("hidden")
+		log.Info("shown")
+		assert.Equal(t, []string{`level=INFO msg=shown`}, lines())
+	})
+
+	t.Run("Component with lower level", func(t *testing.T) {
+		dnsLog := log.With(ComponentKey, "dns")
+		dnsLog.Debug("shown")
+		assert.Equal(t, []string{`level=DEBUG msg=shown component=dns`}, lines())
+	})
+
+	t.Run("Component with higher level", func(t *testing.T) {
+		serverLog := log.With(ComponentKey, "server").With("path", "/healthz")
+		serverLog.Info("hidden")
+		serverLog.Warn("shown")
+		assert.Equal(t, []string{`level=WARN msg=shown component=server path=/healthz`}, lines())
+	})
+
+	t.Run("Component without level", func(t *testing.T) {
+		hcLog := log.With(ComponentKey, "healthcheck")
+		hcLog.Debug("hidden")
+		hcLog.Info("shown")
+		assert.Equal(t, []string{`level=INFO msg=shown component=healthcheck`}, lines())
+	})
+
+	t.Run("Attributes in groups don't set the component", func(t *testing.T) {
+		groupLog := log.WithGroup("req").With(ComponentKey, "dns")
+		groupLog.Debug("hidden")
+		groupLog.Info("shown")
+		assert.Equal(t, []string{`level=INFO msg=shown req.component=dns`}, lines())
+	})
+}
@@ -0,0 +1,239 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Paths of the Unix sockets used by the local syslog daemon, in order of preference
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Format for timestamps in RFC5424 messages, which allows up to 6 digits for fractional seconds
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// SyslogHandler is a slog.Handler that sends logs to syslog, using the RFC5424 format
+type SyslogHandler struct {
+	level    slog.Leveler
+	facility int
+	// Header fields that are the same for all messages
+	hostname string
+	tag      string
+	pid      string
+
+	// Shared with handlers derived using WithAttrs and WithGroup
+	w *syslogWriter
+
+	// Formats the attributes of the record
+	// Its output buffer is shared with derived handlers, and protected by the lock in the writer
+	attrs slog.Handler
+	buf   *bytes.Buffer
+}
+
+// NewSyslogHandler returns a new SyslogHandler that connects to the syslog server in the configuration
+func NewSyslogHandler(cfg config.ConfigSyslog, level slog.Leveler) (*SyslogHandler, error) {
+	facility, err := cfg.FacilityCode()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &syslogWriter{
+		network: cfg.Network,
+	}
+	if cfg.Network != "" {
+		w.address = cfg.RemoteAddress()
+	}
+	err = w.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "ddup"
+	}
+
+	buf := &bytes.Buffer{}
+	return &SyslogHandler{
+		level:    level,
+		facility: facility,
+		hostname: hostname,
+		tag:      tag,
+		pid:      strconv.Itoa(os.Getpid()),
+		w:        w,
+		attrs: slog.NewTextHandler(buf, &slog.HandlerOptions{
+			// Level is filtered by this handler
+			Level: slog.LevelDebug - 1,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				// Time and level are in the syslog header, and the message is added separately
+				if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey || a.Key == slog.MessageKey) {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+		buf: buf,
+	}, nil
+}
+
+// Enabled implements slog.Handler
+func (h *SyslogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle implements slog.Handler
+func (h *SyslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.lock.Lock()
+	defer h.w.lock.Unlock()
+
+	// Format the attributes
+	h.buf.Reset()
+	err := h.attrs.Handle(ctx, r)
+	if err != nil {
+		return err
+	}
+	attrs := bytes.TrimSpace(h.buf.Bytes())
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	// Format: <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	msg := make([]byte, 0, 128+len(r.Message)+len(attrs))
+	msg = fmt.Appendf(msg, "<%d>1 %s %s %s %s - - %s",
+		h.facility*8+syslogSeverity(r.Level),
+		t.Format(syslogTimeFormat),
+		h.hostname,
+		h.tag,
+		h.pid,
+		r.Message,
+	)
+	if len(attrs) > 0 {
+		msg = append(msg, ' ')
+		msg = append(msg, attrs...)
+	}
+
+	return h.w.write(msg)
+}
+
+// WithAttrs implements slog.Handler
+func (h *SyslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = h.attrs.WithAttrs(attrs)
+	return &h2
+}
+
+// WithGroup implements slog.Handler
+func (h *SyslogHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.attrs = h.attrs.WithGroup(name)
+	return &h2
+}
+
+// Close the connection to the syslog server
+func (h *SyslogHandler) Close() error {
+	return h.w.close()
+}
+
+// syslogSeverity returns the syslog severity for a log level
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // Error
+	case level >= slog.LevelWarn:
+		return 4 // Warning
+	case level >= slog.LevelInfo:
+		return 6 // Informational
+	default:
+		return 7 // Debug
+	}
+}
+
+// syslogWriter sends messages to a syslog server, re-connecting if needed
+type syslogWriter struct {
+	// Network and address of the remote server; if empty, uses the local syslog daemon
+	network string
+	address string
+
+	conn net.Conn
+	// If true, the connection is stream-oriented and messages need to be framed
+	stream bool
+	lock   sync.Mutex
+}
+
+func (w *syslogWriter) connect() (err error) {
+	if w.network != "" {
+		w.conn, err = net.DialTimeout(w.network, w.address, 10*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog server: %w", err)
+		}
+		w.stream = w.network == "tcp"
+		return nil
+	}
+
+	// Connect to the local syslog daemon, which usually listens on a datagram socket
+	for _, path := range localSyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			w.conn, err = net.Dial(network, path)
+			if err == nil {
+				w.stream = network == "unix"
+				return nil
+			}
+		}
+	}
+	return errors.New("failed to connect to the local syslog daemon: no syslog socket found")
+}
+
+// write sends a message, re-connecting once if the connection was lost
+// The caller must hold the lock
+func (w *syslogWriter) write(msg []byte) error {
+	if w.conn != nil {
+		err := w.send(msg)
+		if err == nil {
+			return nil
+		}
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+
+	err := w.connect()
+	if err != nil {
+		return err
+	}
+	return w.send(msg)
+}
+
+func (w *syslogWriter) send(msg []byte) error {
+	if w.stream {
+		// Use octet-counting framing, as per RFC6587
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+func (w *syslogWriter) close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestSyslogHandler(t *testing.T) {
+	hostname, _ := os.Hostname()
+	pid := strconv.Itoa(os.Getpid())
+
+	// Matches the RFC5424 header, and captures the priority and the message
+	headerRe := regexp.MustCompile(`^<(\d+)>1 \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}(?:Z|[+-]\d{2}:\d{2}) ` +
+		regexp.QuoteMeta(hostname) + ` ddup ` + pid + ` - - (.*)$`)
+
+	t.Run("UDP", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		h, err := NewSyslogHandler(config.ConfigSyslog{
+			Network:  "udp",
+			Address:  conn.LocalAddr().String(),
+			Facility: "local0",
+		}, slog.LevelInfo)
+		require.NoError(t, err)
+		defer h.Close()
+
+		log := slog.New(h).With("domain", "app.example.com")
+		log.Debug("Not sent")
+		log.Warn("Endpoint is down", "ip", "10.0.0.1")
+
+		buf := make([]byte, 2048)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		match := headerRe.FindStringSubmatch(string(buf[:n]))
+		require.NotNil(t, match, "message does not match the expected format: %s", string(buf[:n]))
+		// local0 (16) * 8 + warning (4)
+		assert.Equal(t, "132", match[1])
+		assert.Equal(t, "Endpoint is down domain=app.example.com ip=10.0.0.1", match[2])
+	})
+
+	t.Run("TCP", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+
+		received := make(chan string, 2)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			// Messages use octet-counting framing
+			r := bufio.NewReader(conn)
+			for {
+				lenStr, err := r.ReadString(' ')
+				if err != nil {
+					return
+				}
+				l, err := strconv.Atoi(strings.TrimSpace(lenStr))
+				if err != nil {
+					return
+				}
+				msg := make([]byte, l)
+				_, err = io.ReadFull(r, msg)
+				if err != nil {
+					return
+				}
+				received <- string(msg)
+			}
+		}()
+
+		h, err := NewSyslogHandler(config.ConfigSyslog{
+			Network: "tcp",
+			Address: ln.Addr().String(),
+		}, slog.LevelDebug)
+		require.NoError(t, err)
+		defer h.Close()
+
+		log := slog.New(h)
+		log.Debug("First")
+		log.WithGroup("dns").Error("Second", "provider", "cf")
+
+		for _, expect := range []struct {
+			pri string
+			msg string
+		}{
+			// daemon (3) * 8 + debug (7)
+			{pri: "31", msg: "First"},
+			// daemon (3) * 8 + error (3)
+			{pri: "27", msg: "Second dns.provider=cf"},
+		} {
+			select {
+			case msg := <-received:
+				match := headerRe.FindStringSubmatch(msg)
+				require.NotNil(t, match, "message does not match the expected format: %s", msg)
+				assert.Equal(t, expect.pri, match[1])
+				assert.Equal(t, expect.msg, match[2])
+			case <-time.After(5 * time.Second):
+				require.Fail(t, "timed out waiting for message")
+			}
+		}
+	})
+
+	t.Run("Invalid facility", func(t *testing.T) {
+		_, err := NewSyslogHandler(config.ConfigSyslog{Network: "udp", Address: "127.0.0.1:514", Facility: "nope"}, slog.LevelInfo)
+		require.ErrorContains(t, err, "syslog facility 'nope' is not supported")
+	})
+}
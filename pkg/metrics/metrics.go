@@ -3,9 +3,9 @@ package metrics
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
-	"github.com/italypaleale/go-kit/observability"
 	"go.opentelemetry.io/otel/attribute"
 	api "go.opentelemetry.io/otel/metric"
 
@@ -18,18 +18,25 @@ const prefix = "dd"
 type AppMetrics struct {
 	apiCalls     api.Float64Histogram
 	healthChecks api.Int64Counter
-}
+	flapping     api.Int64Counter
+	minHealthy   api.Int64Counter
+	drift        api.Int64Counter
+	healthy      api.Int64Gauge
+	unhealthy    api.Int64Gauge
+	failures     api.Int64Gauge
+	transitions  api.Int64Counter
+	dnsUpdates   api.Int64Counter
+	restarts     api.Int64Counter
 
-func NewAppMetrics(ctx context.Context) (m *AppMetrics, shutdownFn func(ctx context.Context) error, err error) {
-	cfg := config.Get()
+	// Hash of the configuration currently applied, reported by the build info gauge
+	configHash atomic.Pointer[string]
+}
 
+func NewAppMetrics(ctx context.Context, cfg *config.Config) (m *AppMetrics, shutdownFn func(ctx context.Context) error, err error) {
 	m = &AppMetrics{}
+	m.SetConfigHash(cfg.Hash())
 
-	meter, shutdownFn, err := observability.InitMetrics(ctx, observability.InitMetricsOpts{
-		Config:  cfg,
-		AppName: buildinfo.AppName,
-		Prefix:  prefix,
-	})
+	meter, shutdownFn, err := initMeter(ctx, cfg)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to init metrics: %w", err)
 	}
@@ -42,6 +49,88 @@ func NewAppMetrics(ctx context.Context) (m *AppMetrics, shutdownFn func(ctx cont
 		return nil, nil, fmt.Errorf("failed to create "+prefix+"_checks meter: %w", err)
 	}
 
+	m.flapping, err = meter.Int64Counter(
+		prefix+"_flapping",
+		api.WithDescription("The number of times endpoints were held out of DNS because they were flapping"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_flapping meter: %w", err)
+	}
+
+	m.minHealthy, err = meter.Int64Counter(
+		prefix+"_min_healthy_breaches",
+		api.WithDescription("The number of times fewer endpoints than the minimum were healthy, and the previous IPs were kept"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_min_healthy_breaches meter: %w", err)
+	}
+
+	m.drift, err = meter.Int64Counter(
+		prefix+"_drift",
+		api.WithDescription("The number of times records published by providers differed from the desired state, and were corrected"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_drift meter: %w", err)
+	}
+
+	m.healthy, err = meter.Int64Gauge(
+		prefix+"_endpoints_healthy",
+		api.WithDescription("The number of endpoints of a domain that are healthy and published in DNS"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_endpoints_healthy meter: %w", err)
+	}
+
+	m.unhealthy, err = meter.Int64Gauge(
+		prefix+"_endpoints_unhealthy",
+		api.WithDescription("The number of endpoints of a domain that are not published in DNS"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_endpoints_unhealthy meter: %w", err)
+	}
+
+	m.failures, err = meter.Int64Gauge(
+		prefix+"_endpoint_consecutive_failures",
+		api.WithDescription("The number of consecutive failed health checks of an endpoint; it's removed from DNS when this reaches the maximum number of attempts"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_endpoint_consecutive_failures meter: %w", err)
+	}
+
+	m.transitions, err = meter.Int64Counter(
+		prefix+"_endpoint_transitions",
+		api.WithDescription("The number of times endpoints were added to or removed from DNS"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_endpoint_transitions meter: %w", err)
+	}
+
+	m.dnsUpdates, err = meter.Int64Counter(
+		prefix+"_dns_updates",
+		api.WithDescription("The number of attempts to update DNS records"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_dns_updates meter: %w", err)
+	}
+
+	m.restarts, err = meter.Int64Counter(
+		prefix+"_service_restarts",
+		api.WithDescription("The number of times services were restarted after failing"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_service_restarts meter: %w", err)
+	}
+
+	// The gauge always reports 1, with the build and the configuration as attributes
+	_, err = meter.Int64ObservableGauge(
+		prefix+"_build_info",
+		api.WithDescription("Information about the build and the configuration currently applied; the value is always 1"),
+		api.WithInt64Callback(m.observeBuildInfo),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create "+prefix+"_build_info meter: %w", err)
+	}
+
 	m.apiCalls, err = meter.Float64Histogram(
 		prefix+"_api_calls",
 		api.WithDescription("API calls to providers and duration in milliseconds"),
@@ -73,6 +162,178 @@ func (m *AppMetrics) RecordHealthCheck(domain string, endpoint string, ok bool)
 	)
 }
 
+//nolint:contextcheck
+func (m *AppMetrics) RecordFlapping(domain string, ip string) {
+	if m == nil {
+		return
+	}
+
+	m.flapping.Add(
+		context.Background(),
+		1,
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "domain", Value: attribute.StringValue(domain)},
+				attribute.KeyValue{Key: "ip", Value: attribute.StringValue(ip)},
+			),
+		),
+	)
+}
+
+//nolint:contextcheck
+func (m *AppMetrics) RecordMinHealthyBreach(domain string) {
+	if m == nil {
+		return
+	}
+
+	m.minHealthy.Add(
+		context.Background(),
+		1,
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "domain", Value: attribute.StringValue(domain)},
+			),
+		),
+	)
+}
+
+//nolint:contextcheck
+func (m *AppMetrics) RecordDrift(domain string) {
+	if m == nil {
+		return
+	}
+
+	m.drift.Add(
+		context.Background(),
+		1,
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "domain", Value: attribute.StringValue(domain)},
+			),
+		),
+	)
+}
+
+//nolint:contextcheck
+func (m *AppMetrics) RecordEndpointCounts(domain string, healthy int, unhealthy int) {
+	if m == nil {
+		return
+	}
+
+	attrs := api.WithAttributeSet(
+		attribute.NewSet(
+			attribute.KeyValue{Key: "domain", Value: attribute.StringValue(domain)},
+		),
+	)
+	m.healthy.Record(context.Background(), int64(healthy), attrs)
+	m.unhealthy.Record(context.Background(), int64(unhealthy), attrs)
+}
+
+//nolint:contextcheck
+func (m *AppMetrics) RecordConsecutiveFailures(domain string, endpoint string, failures int) {
+	if m == nil {
+		return
+	}
+
+	m.failures.Record(
+		context.Background(),
+		int64(failures),
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "domain", Value: attribute.StringValue(domain)},
+				attribute.KeyValue{Key: "endpoint", Value: attribute.StringValue(endpoint)},
+			),
+		),
+	)
+}
+
+//nolint:contextcheck
+func (m *AppMetrics) RecordEndpointTransition(domain string, ip string, up bool) {
+	if m == nil {
+		return
+	}
+
+	to := "down"
+	if up {
+		to = "up"
+	}
+	m.transitions.Add(
+		context.Background(),
+		1,
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "domain", Value: attribute.StringValue(domain)},
+				attribute.KeyValue{Key: "ip", Value: attribute.StringValue(ip)},
+				attribute.KeyValue{Key: "to", Value: attribute.StringValue(to)},
+			),
+		),
+	)
+}
+
+//nolint:contextcheck
+func (m *AppMetrics) RecordDNSUpdate(domain string, ok bool) {
+	if m == nil {
+		return
+	}
+
+	m.dnsUpdates.Add(
+		context.Background(),
+		1,
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "domain", Value: attribute.StringValue(domain)},
+				attribute.KeyValue{Key: "ok", Value: attribute.BoolValue(ok)},
+			),
+		),
+	)
+}
+
+//nolint:contextcheck
+func (m *AppMetrics) RecordServiceRestart(service string) {
+	if m == nil {
+		return
+	}
+
+	m.restarts.Add(
+		context.Background(),
+		1,
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "service", Value: attribute.StringValue(service)},
+			),
+		),
+	)
+}
+
+// SetConfigHash sets the hash of the configuration currently applied, which is reported by the build info gauge
+func (m *AppMetrics) SetConfigHash(hash string) {
+	if m == nil {
+		return
+	}
+
+	m.configHash.Store(&hash)
+}
+
+// observeBuildInfo is the callback of the build info gauge
+func (m *AppMetrics) observeBuildInfo(_ context.Context, o api.Int64Observer) error {
+	var configHash string
+	if h := m.configHash.Load(); h != nil {
+		configHash = *h
+	}
+
+	o.Observe(
+		1,
+		api.WithAttributeSet(
+			attribute.NewSet(
+				attribute.KeyValue{Key: "version", Value: attribute.StringValue(buildinfo.AppVersion)},
+				attribute.KeyValue{Key: "commit", Value: attribute.StringValue(buildinfo.CommitHash)},
+				attribute.KeyValue{Key: "config_hash", Value: attribute.StringValue(configHash)},
+			),
+		),
+	)
+	return nil
+}
+
 //nolint:contextcheck
 func (m *AppMetrics) RecordAPICall(provider string, method string, path string, ok bool, duration time.Duration) {
 	if m == nil {
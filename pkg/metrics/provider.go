@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/italypaleale/go-kit/observability"
+	"go.opentelemetry.io/contrib/exporters/autoexport"
+	api "go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/italypaleale/ddup/pkg/buildinfo"
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// initMeter returns the meter for the metrics of the app, and the function that shuts down the exporters
+// Metrics are exported with the OpenTelemetry exporter configured with the OTEL_METRICS_EXPORTER env var, and to a StatsD server if configured
+func initMeter(ctx context.Context, cfg *config.Config) (api.Meter, func(ctx context.Context) error, error) {
+	if cfg.StatsD == nil {
+		//nolint:wrapcheck
+		return observability.InitMetrics(ctx, observability.InitMetricsOpts{
+			Config:  cfg,
+			AppName: buildinfo.AppName,
+			Prefix:  prefix,
+		})
+	}
+
+	// This is the same as observability.InitMetrics, with the reader for StatsD in addition to the one for the OpenTelemetry exporter
+	resource, err := cfg.GetOtelResource(buildinfo.AppName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get OpenTelemetry resource: %w", err)
+	}
+
+	// If the env var OTEL_METRICS_EXPORTER is empty, we set it to "none"
+	if os.Getenv("OTEL_METRICS_EXPORTER") == "" {
+		_ = os.Setenv("OTEL_METRICS_EXPORTER", "none") //nolint:errcheck
+	}
+	mr, err := autoexport.NewMetricReader(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize OpenTelemetry metric reader: %w", err)
+	}
+
+	exporter, err := newStatsDExporter(*cfg.StatsD)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(resource),
+		sdkmetric.WithReader(mr),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.StatsD.Interval))),
+	)
+	return mp.Meter(prefix), mp.Shutdown, nil
+}
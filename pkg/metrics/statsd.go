@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// Maximum size of the UDP packets sent to the StatsD server, which fits in the MTU of most networks
+const statsdMaxPacketSize = 1432
+
+// Replaces the characters that have a special meaning in the StatsD protocol, in names and tags
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "=", "_", "#", "_", " ", "_", "\n", "_")
+
+// statsdExporter is an OpenTelemetry metric exporter that sends metrics to a StatsD server over UDP
+// Counters are sent as StatsD counters with the increment since the last export, and gauges as StatsD gauges.
+// Histograms are sent as two counters, with the number of measurements and their sum, and the suffixes ".count" and ".sum".
+type statsdExporter struct {
+	cfg config.ConfigStatsD
+
+	lock sync.Mutex
+	// Connection to the StatsD server; nil after the exporter is shut down
+	// Protected by lock
+	conn net.Conn
+}
+
+// Compile time interface check
+var _ sdkmetric.Exporter = (*statsdExporter)(nil)
+
+// newStatsDExporter returns a statsdExporter that sends metrics to the server in the configuration
+func newStatsDExporter(cfg config.ConfigStatsD) (*statsdExporter, error) {
+	// Connecting a UDP socket doesn't send any packet, but it resolves the address
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD server '%s': %w", cfg.Address, err)
+	}
+
+	return &statsdExporter{
+		cfg:  cfg,
+		conn: conn,
+	}, nil
+}
+
+// Temporality implements sdkmetric.Exporter
+// StatsD servers aggregate counters themselves, so they receive the increments since the last export
+func (e *statsdExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindCounter, sdkmetric.InstrumentKindObservableCounter, sdkmetric.InstrumentKindHistogram:
+		return metricdata.DeltaTemporality
+	default:
+		return metricdata.CumulativeTemporality
+	}
+}
+
+// Aggregation implements sdkmetric.Exporter
+func (e *statsdExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+// Export implements sdkmetric.Exporter
+func (e *statsdExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	var lines []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			lines = append(lines, e.formatMetric(m)...)
+		}
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.conn == nil {
+		return errors.New("StatsD exporter is shut down")
+	}
+
+	// Lines are batched in packets, separated by newlines
+	var errs []error
+	packet := make([]byte, 0, statsdMaxPacketSize)
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacketSize {
+			errs = append(errs, e.send(packet))
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		errs = append(errs, e.send(packet))
+	}
+
+	return errors.Join(errs...)
+}
+
+// send sends a packet to the StatsD server
+// It must be called while holding the lock
+func (e *statsdExporter) send(packet []byte) error {
+	_, err := e.conn.Write(packet)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics to StatsD server: %w", err)
+	}
+	return nil
+}
+
+// ForceFlush implements sdkmetric.Exporter
+// Metrics are sent as soon as they're exported, so there's nothing to flush
+func (e *statsdExporter) ForceFlush(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Shutdown implements sdkmetric.Exporter
+func (e *statsdExporter) Shutdown(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// formatMetric returns the lines in the StatsD protocol for the data points of the metric
+func (e *statsdExporter) formatMetric(m metricdata.Metrics) []string {
+	switch data := m.Data.(type) {
+	case metricdata.Sum[int64]:
+		return formatSum(e, m.Name, data)
+	case metricdata.Sum[float64]:
+		return formatSum(e, m.Name, data)
+	case metricdata.Gauge[int64]:
+		return formatGauge(e, m.Name, data)
+	case metricdata.Gauge[float64]:
+		return formatGauge(e, m.Name, data)
+	case metricdata.Histogram[int64]:
+		return formatHistogram(e, m.Name, data)
+	case metricdata.Histogram[float64]:
+		return formatHistogram(e, m.Name, data)
+	default:
+		return nil
+	}
+}
+
+// formatSum formats the data points of a sum
+// Monotonic sums are counters, while sums that can decrease are sent as gauges with their current value
+func formatSum[N int64 | float64](e *statsdExporter, name string, data metricdata.Sum[N]) []string {
+	typ := "c"
+	if !data.IsMonotonic {
+		typ = "g"
+	}
+
+	res := make([]string, 0, len(data.DataPoints))
+	for _, dp := range data.DataPoints {
+		res = append(res, e.formatLine(name, formatStatsDValue(dp.Value), typ, dp.Attributes))
+	}
+	return res
+}
+
+// formatGauge formats the data points of a gauge
+func formatGauge[N int64 | float64](e *statsdExporter, name string, data metricdata.Gauge[N]) []string {
+	res := make([]string, 0, len(data.DataPoints))
+	for _, dp := range data.DataPoints {
+		res = append(res, e.formatLine(name, formatStatsDValue(dp.Value), "g", dp.Attributes))
+	}
+	return res
+}
+
+// formatHistogram formats the data points of a histogram as counters with the number of measurements and their sum
+func formatHistogram[N int64 | float64](e *statsdExporter, name string, data metricdata.Histogram[N]) []string {
+	res := make([]string, 0, len(data.DataPoints)*2)
+	for _, dp := range data.DataPoints {
+		res = append(res,
+			e.formatLine(name+".count", strconv.FormatUint(dp.Count, 10), "c", dp.Attributes),
+			e.formatLine(name+".sum", formatStatsDValue(dp.Sum), "c", dp.Attributes),
+		)
+	}
+	return res
+}
+
+// formatLine returns a line in the StatsD protocol, with the attributes as tags in the configured format
+func (e *statsdExporter) formatLine(name string, value string, typ string, attrs attribute.Set) string {
+	var b strings.Builder
+	b.WriteString(statsdReplacer.Replace(e.cfg.Prefix + name))
+
+	// With the Telegraf format, tags are part of the name
+	tags := attrs.ToSlice()
+	if e.cfg.Format == config.StatsDFormatTelegraf {
+		for _, kv := range tags {
+			b.WriteString("," + statsdReplacer.Replace(string(kv.Key)) + "=" + statsdReplacer.Replace(kv.Value.Emit()))
+		}
+	}
+
+	b.WriteString(":" + value + "|" + typ)
+
+	// With the DogStatsD format, tags are appended at the end
+	if e.cfg.Format != config.StatsDFormatTelegraf && len(tags) > 0 {
+		b.WriteString("|#")
+		for i, kv := range tags {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(statsdReplacer.Replace(string(kv.Key)) + ":" + statsdReplacer.Replace(kv.Value.Emit()))
+		}
+	}
+
+	return b.String()
+}
+
+// formatStatsDValue formats a value for the StatsD protocol, without exponents
+func formatStatsDValue[N int64 | float64](v N) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 64)
+}
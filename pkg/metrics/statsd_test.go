@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	api "go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestStatsDExporter(t *testing.T) {
+	// Records metrics and returns the lines received by the StatsD server
+	collect := func(t *testing.T, format string) []string {
+		t.Helper()
+
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer server.Close()
+
+		exporter, err := newStatsDExporter(config.ConfigStatsD{Address: server.LocalAddr().String(), Format: format, Prefix: "ddup."})
+		require.NoError(t, err)
+
+		// Metrics are exported when the provider is flushed
+		mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(time.Hour))))
+		meter := mp.Meter(prefix)
+
+		attrs := api.WithAttributeSet(attribute.NewSet(
+			attribute.String("domain", "app.example.com"),
+			attribute.Bool("ok", true),
+		))
+		counter, err := meter.Int64Counter(prefix + "_checks")
+		require.NoError(t, err)
+		counter.Add(t.Context(), 3, attrs)
+		gauge, err := meter.Int64Gauge(prefix + "_endpoints_healthy")
+		require.NoError(t, err)
+		gauge.Record(t.Context(), 2, attrs)
+		histogram, err := meter.Float64Histogram(prefix + "_api_calls")
+		require.NoError(t, err)
+		histogram.Record(t.Context(), 10.5, attrs)
+		histogram.Record(t.Context(), 4, attrs)
+
+		require.NoError(t, mp.ForceFlush(t.Context()))
+		require.NoError(t, mp.Shutdown(t.Context()))
+
+		// All lines fit in a single packet
+		buf := make([]byte, statsdMaxPacketSize)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := server.ReadFrom(buf)
+		require.NoError(t, err)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+
+	t.Run("DogStatsD", func(t *testing.T) {
+		lines := collect(t, config.StatsDFormatDogStatsD)
+		assert.ElementsMatch(t, []string{
+			"ddup.dd_checks:3|c|#domain:app.example.com,ok:true",
+			"ddup.dd_endpoints_healthy:2|g|#domain:app.example.com,ok:true",
+			"ddup.dd_api_calls.count:2|c|#domain:app.example.com,ok:true",
+			"ddup.dd_api_calls.sum:14.5|c|#domain:app.example.com,ok:true",
+		}, lines)
+	})
+
+	t.Run("Telegraf", func(t *testing.T) {
+		lines := collect(t, config.StatsDFormatTelegraf)
+		assert.ElementsMatch(t, []string{
+			"ddup.dd_checks,domain=app.example.com,ok=true:3|c",
+			"ddup.dd_endpoints_healthy,domain=app.example.com,ok=true:2|g",
+			"ddup.dd_api_calls.count,domain=app.example.com,ok=true:2|c",
+			"ddup.dd_api_calls.sum,domain=app.example.com,ok=true:14.5|c",
+		}, lines)
+	})
+
+	t.Run("Special characters are replaced", func(t *testing.T) {
+		e := &statsdExporter{cfg: config.ConfigStatsD{Format: config.StatsDFormatDogStatsD}}
+		line := e.formatLine("dd_flapping", "1", "c", attribute.NewSet(attribute.String("ip", "2001:db8::1")))
+		assert.Equal(t, "dd_flapping:1|c|#ip:2001_db8__1", line)
+	})
+}
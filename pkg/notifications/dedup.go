@@ -0,0 +1,180 @@
+package notifications
+
+import (
+	"slices"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/events"
+)
+
+// Notification is the payload sent to webhooks
+type Notification struct {
+	events.Event
+
+	// If true, this is a reminder that a problem is still occurring
+	Reminder bool `json:"reminder,omitempty"`
+	// Number of events that were suppressed since the last notification for the same domain, endpoint, and event type
+	Suppressed int `json:"suppressed,omitempty"`
+	// For problems, such as an endpoint that is down, the time the problem started
+	Since time.Time `json:"since,omitzero"`
+}
+
+// Events that resolve a problem, keyed by the type of the event, with the type of the problem as value
+var resolves = map[events.Type]events.Type{
+	events.TypeEndpointUp:      events.TypeEndpointDown,
+	events.TypeDomainRecovered: events.TypeDomainDegraded,
+	events.TypeDNSUpdated:      events.TypeProviderError,
+}
+
+// A newer event supersedes pending notifications for the opposite state, keyed by the type of the newer event
+// A successful DNS update supersedes provider errors, but not vice versa, since updates that were performed are always reported
+var supersedes = map[events.Type]events.Type{
+	events.TypeEndpointUp:      events.TypeEndpointDown,
+	events.TypeEndpointDown:    events.TypeEndpointUp,
+	events.TypeDomainRecovered: events.TypeDomainDegraded,
+	events.TypeDomainDegraded:  events.TypeDomainRecovered,
+	events.TypeDNSUpdated:      events.TypeProviderError,
+}
+
+// isProblem returns true if the event type indicates a problem that persists until it's resolved
+func isProblem(typ events.Type) bool {
+	for _, v := range resolves {
+		if v == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// alertKey identifies the alerts that are deduplicated together
+type alertKey struct {
+	domain string
+	ip     string
+	typ    events.Type
+}
+
+// alertState is the state of the alerts for a key
+type alertState struct {
+	// Last event received
+	last events.Event
+	// Time the last notification was sent
+	lastSent time.Time
+	// Number of events suppressed since the last notification was sent
+	suppressed int
+	// If true, the last event received was suppressed and differs from the last one that was sent
+	pending bool
+	// For problems, true until the problem is resolved
+	active bool
+	// For problems, the time the problem started
+	since time.Time
+}
+
+// deduper collapses repeated alerts and enforces a minimum interval between notifications
+// It's not safe for concurrent use
+type deduper struct {
+	alerts map[alertKey]*alertState
+}
+
+func newDeduper() *deduper {
+	return &deduper{
+		alerts: make(map[alertKey]*alertState),
+	}
+}
+
+// process handles an event, and returns the notification to send, if any
+func (d *deduper) process(e events.Event, now time.Time, minInterval time.Duration) (Notification, bool) {
+	// An event that resolves a problem stops reminders for it
+	problem, ok := resolves[e.Type]
+	if ok {
+		st, ok := d.alerts[alertKey{domain: e.Domain, ip: e.IP, typ: problem}]
+		if ok {
+			st.active = false
+		}
+	}
+	opposite, ok := supersedes[e.Type]
+	if ok {
+		st, ok := d.alerts[alertKey{domain: e.Domain, ip: e.IP, typ: opposite}]
+		if ok {
+			st.pending = false
+		}
+	}
+
+	key := alertKey{domain: e.Domain, ip: e.IP, typ: e.Type}
+	st, ok := d.alerts[key]
+	if !ok {
+		st = &alertState{}
+		d.alerts[key] = st
+	}
+
+	// Identical alerts for problems that are still occurring are collapsed
+	// A problem that was not active before starts now
+	var identical bool
+	if isProblem(e.Type) {
+		if st.active {
+			identical = isSameEvent(st.last, e)
+		} else {
+			st.active = true
+			st.since = now
+		}
+	}
+
+	// Enforce the minimum interval
+	if ok && (identical || now.Sub(st.lastSent) < minInterval) {
+		st.suppressed++
+		st.pending = st.pending || !identical
+		st.last = e
+		return Notification{}, false
+	}
+
+	st.last = e
+	return d.send(st, now, false), true
+}
+
+// flush returns the notifications to send for events that were suppressed because of the minimum interval, and reminders for problems that are still occurring
+func (d *deduper) flush(now time.Time, minInterval time.Duration, reminderInterval time.Duration) []Notification {
+	var res []Notification
+	for _, st := range d.alerts {
+		switch {
+		case st.pending && now.Sub(st.lastSent) >= minInterval:
+			res = append(res, d.send(st, now, false))
+		case st.active && reminderInterval > 0 && now.Sub(st.lastSent) >= reminderInterval:
+			res = append(res, d.send(st, now, true))
+		}
+	}
+
+	// Sort by time of the event, so notifications are sent in order
+	slices.SortFunc(res, func(a, b Notification) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return res
+}
+
+// send returns the notification for the last event of a key, and resets the suppression state
+func (d *deduper) send(st *alertState, now time.Time, reminder bool) Notification {
+	n := Notification{
+		Event:      st.last,
+		Reminder:   reminder,
+		Suppressed: st.suppressed,
+	}
+	if st.active {
+		n.Since = st.since
+	}
+
+	st.lastSent = now
+	st.suppressed = 0
+	st.pending = false
+
+	return n
+}
+
+// isSameEvent returns true if two events carry the same information, ignoring their time
+func isSameEvent(a, b events.Event) bool {
+	return a.Type == b.Type &&
+		a.Domain == b.Domain &&
+		a.Provider == b.Provider &&
+		a.IP == b.IP &&
+		slices.Equal(a.IPs, b.IPs) &&
+		a.TTL == b.TTL &&
+		a.Error == b.Error
+}
@@ -0,0 +1,113 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/events"
+)
+
+func TestDeduper(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	down := events.Event{Type: events.TypeEndpointDown, Domain: "example.com", IP: "1.1.1.1"}
+	up := events.Event{Type: events.TypeEndpointUp, Domain: "example.com", IP: "1.1.1.1"}
+	providerErr := events.Event{Type: events.TypeProviderError, Domain: "example.com", Error: "boom"}
+
+	t.Run("Collapses identical problems", func(t *testing.T) {
+		d := newDeduper()
+
+		n, ok := d.process(providerErr, start, 0)
+		require.True(t, ok)
+		assert.Equal(t, providerErr, n.Event)
+		assert.Equal(t, start, n.Since)
+
+		// The same error in the next cycles is suppressed
+		for i := range 3 {
+			_, ok = d.process(providerErr, start.Add(time.Duration(i+1)*time.Minute), 0)
+			assert.False(t, ok)
+		}
+
+		// A different error is sent
+		otherErr := providerErr
+		otherErr.Error = "other"
+		n, ok = d.process(otherErr, start.Add(5*time.Minute), 0)
+		require.True(t, ok)
+		assert.Equal(t, "other", n.Error)
+		assert.Equal(t, 3, n.Suppressed)
+		assert.Equal(t, start, n.Since)
+
+		// After a successful update, the error is sent again
+		_, ok = d.process(events.Event{Type: events.TypeDNSUpdated, Domain: "example.com"}, start.Add(6*time.Minute), 0)
+		require.True(t, ok)
+		n, ok = d.process(otherErr, start.Add(7*time.Minute), 0)
+		require.True(t, ok)
+		assert.Equal(t, start.Add(7*time.Minute), n.Since)
+	})
+
+	t.Run("Minimum interval", func(t *testing.T) {
+		d := newDeduper()
+		minInterval := 5 * time.Minute
+
+		_, ok := d.process(down, start, minInterval)
+		require.True(t, ok)
+		_, ok = d.process(up, start.Add(time.Minute), minInterval)
+		require.True(t, ok)
+
+		// The endpoint goes down and up again within the interval
+		_, ok = d.process(down, start.Add(2*time.Minute), minInterval)
+		assert.False(t, ok)
+		_, ok = d.process(up, start.Add(3*time.Minute), minInterval)
+		assert.False(t, ok)
+		_, ok = d.process(down, start.Add(4*time.Minute), minInterval)
+		assert.False(t, ok)
+
+		// Nothing is flushed before the interval has passed
+		assert.Empty(t, d.flush(start.Add(4*time.Minute), minInterval, 0))
+
+		// Once the interval has passed, the last state is sent: the endpoint is down, and the last "up" is not sent as the problem is still active
+		res := d.flush(start.Add(6*time.Minute), minInterval, 0)
+		require.Len(t, res, 1)
+		assert.Equal(t, events.TypeEndpointDown, res[0].Type)
+		assert.Equal(t, 2, res[0].Suppressed)
+		assert.False(t, res[0].Reminder)
+
+		assert.Empty(t, d.flush(start.Add(7*time.Minute), minInterval, 0))
+	})
+
+	t.Run("Reminders", func(t *testing.T) {
+		d := newDeduper()
+		reminderInterval := time.Hour
+
+		_, ok := d.process(down, start, 0)
+		require.True(t, ok)
+		assert.Empty(t, d.flush(start.Add(30*time.Minute), 0, reminderInterval))
+
+		res := d.flush(start.Add(time.Hour), 0, reminderInterval)
+		require.Len(t, res, 1)
+		assert.True(t, res[0].Reminder)
+		assert.Equal(t, events.TypeEndpointDown, res[0].Type)
+		assert.Equal(t, start, res[0].Since)
+
+		// Next reminder is after another interval
+		assert.Empty(t, d.flush(start.Add(90*time.Minute), 0, reminderInterval))
+
+		// After the endpoint is back up, no more reminders are sent
+		_, ok = d.process(up, start.Add(100*time.Minute), 0)
+		require.True(t, ok)
+		assert.Empty(t, d.flush(start.Add(5*time.Hour), 0, reminderInterval))
+	})
+
+	t.Run("Different endpoints are independent", func(t *testing.T) {
+		d := newDeduper()
+		other := down
+		other.IP = "2.2.2.2"
+
+		_, ok := d.process(down, start, time.Hour)
+		require.True(t, ok)
+		_, ok = d.process(other, start, time.Hour)
+		require.True(t, ok)
+	})
+}
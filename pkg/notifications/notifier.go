@@ -0,0 +1,200 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/events"
+	"github.com/italypaleale/ddup/pkg/logging"
+)
+
+const (
+	// Number of events buffered while notifications are dispatched
+	eventsBufferSize = 100
+	// Interval for sending notifications that were delayed, and reminders
+	defaultFlushInterval = 10 * time.Second
+)
+
+// Notifier sends notifications to webhooks when events are published
+type Notifier struct {
+	client *http.Client
+	cfg    atomic.Pointer[config.ConfigNotifications]
+	events <-chan events.Event
+	dedup  *deduper
+	// Function to unsubscribe from the events bus
+	unsubscribe func()
+	// Interval for sending notifications that were delayed, and reminders
+	flushInterval time.Duration
+
+	// Tracks deliveries in progress
+	wg sync.WaitGroup
+}
+
+// NewNotifier returns a new Notifier that sends events from the bus to the webhooks
+// The notifier subscribes to the bus right away, so events published before Run is invoked are not lost
+func NewNotifier(cfg config.ConfigNotifications, bus *events.Bus) *Notifier {
+	n := &Notifier{
+		client:        &http.Client{},
+		dedup:         newDeduper(),
+		flushInterval: defaultFlushInterval,
+	}
+	n.events, n.unsubscribe = bus.Subscribe(eventsBufferSize)
+	n.UpdateConfig(cfg)
+	return n
+}
+
+// UpdateConfig replaces the configuration for notifications, such as after the configuration file is reloaded
+// Deliveries in progress are not affected
+func (n *Notifier) UpdateConfig(cfg config.ConfigNotifications) {
+	n.cfg.Store(&cfg)
+}
+
+// Run dispatches events to webhooks until the context is canceled
+func (n *Notifier) Run(ctx context.Context) error {
+	defer n.unsubscribe()
+
+	// Before returning, wait for deliveries in progress, which are canceled with the context
+	defer n.wg.Wait()
+
+	// Periodically send notifications that were delayed because of the minimum interval, and reminders
+	ticker := time.NewTicker(n.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-n.events:
+			cfg := n.cfg.Load()
+			notification, ok := n.dedup.process(e, time.Now(), cfg.MinInterval)
+			if !ok {
+				logger().DebugContext(ctx, "Notification suppressed", "type", e.Type, "domain", e.Domain, "ip", e.IP)
+				continue
+			}
+			n.dispatch(ctx, cfg.Webhooks, notification)
+		case <-ticker.C:
+			cfg := n.cfg.Load()
+			for _, notification := range n.dedup.flush(time.Now(), cfg.MinInterval, cfg.ReminderInterval) {
+				n.dispatch(ctx, cfg.Webhooks, notification)
+			}
+		}
+	}
+}
+
+// dispatch sends a notification to all webhooks that are subscribed to its type
+// Each delivery runs in a background goroutine, so a slow webhook doesn't delay the others
+func (n *Notifier) dispatch(ctx context.Context, webhooks []config.ConfigWebhook, notification Notification) {
+	for _, wh := range webhooks {
+		if len(wh.Events) > 0 && !slices.Contains(wh.Events, string(notification.Type)) {
+			continue
+		}
+
+		n.wg.Go(func() {
+			n.deliver(ctx, &wh, notification)
+		})
+	}
+}
+
+// deliver sends a notification to a webhook, retrying on failure
+func (n *Notifier) deliver(ctx context.Context, wh *config.ConfigWebhook, notification Notification) {
+	log := logger().With("webhook", wh.Name, "type", notification.Type, "domain", notification.Domain)
+
+	body, err := renderBody(wh, notification)
+	if err != nil {
+		log.ErrorContext(ctx, "Failed to render webhook notification", "error", err)
+		return
+	}
+
+	retries := 0
+	if wh.Retries != nil {
+		retries = *wh.Retries
+	}
+	delay := wh.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err = n.send(ctx, wh, body)
+		if err == nil {
+			log.DebugContext(ctx, "Sent webhook notification")
+			return
+		}
+
+		if attempt >= retries || ctx.Err() != nil {
+			log.ErrorContext(ctx, "Failed to send webhook notification", "error", err, "attempts", attempt+1)
+			return
+		}
+
+		log.WarnContext(ctx, "Failed to send webhook notification, retrying", "error", err, "retryDelay", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// send performs a single request to the webhook
+func (n *Notifier) send(ctx context.Context, wh *config.ConfigWebhook, body []byte) error {
+	if wh.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wh.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range wh.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<20))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("invalid response status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// renderBody returns the body of the request for a notification
+// If the webhook doesn't have a template, the notification is encoded as JSON
+func renderBody(wh *config.ConfigWebhook, notification Notification) ([]byte, error) {
+	tpl, err := wh.BodyTemplate()
+	if err != nil {
+		return nil, err
+	}
+	if tpl == nil {
+		return json.Marshal(notification)
+	}
+
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute body template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// logger returns the logger for notifications
+func logger() *slog.Logger {
+	return logging.Component("notifications")
+}
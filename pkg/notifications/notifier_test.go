@@ -0,0 +1,156 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/events"
+)
+
+func TestNotifier(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+
+	newServer := func(t *testing.T, failures int32) (*httptest.Server, chan request) {
+		reqs := make(chan request, 10)
+		var count atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			reqs <- request{header: r.Header, body: body}
+			if count.Add(1) <= failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		t.Cleanup(srv.Close)
+		return srv, reqs
+	}
+
+	newWebhook := func(url string) config.ConfigWebhook {
+		retries := 3
+		return config.ConfigWebhook{
+			Name:       "test",
+			URL:        url,
+			Timeout:    5 * time.Second,
+			Retries:    &retries,
+			RetryDelay: time.Millisecond,
+		}
+	}
+
+	receive := func(t *testing.T, reqs chan request) request {
+		t.Helper()
+		select {
+		case r := <-reqs:
+			return r
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timed out waiting for request")
+			return request{}
+		}
+	}
+
+	startNotifier := func(t *testing.T, webhooks ...config.ConfigWebhook) *events.Bus {
+		bus := events.NewBus()
+		n := NewNotifier(config.ConfigNotifications{Webhooks: webhooks}, bus)
+		done := make(chan struct{})
+		go func() {
+			_ = n.Run(t.Context())
+			close(done)
+		}()
+
+		// The test's context is canceled before cleanup functions are invoked
+		t.Cleanup(func() {
+			<-done
+		})
+
+		return bus
+	}
+
+	t.Run("Sends event as JSON", func(t *testing.T) {
+		srv, reqs := newServer(t, 0)
+		wh := newWebhook(srv.URL)
+		wh.Headers = map[string]string{"Authorization": "Bearer token"}
+		bus := startNotifier(t, wh)
+
+		bus.Publish(events.Event{Type: events.TypeEndpointDown, Domain: "example.com", IP: "1.1.1.1"})
+
+		r := receive(t, reqs)
+		assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.header.Get("Authorization"))
+
+		var e events.Event
+		require.NoError(t, json.Unmarshal(r.body, &e))
+		assert.Equal(t, events.TypeEndpointDown, e.Type)
+		assert.Equal(t, "example.com", e.Domain)
+		assert.Equal(t, "1.1.1.1", e.IP)
+	})
+
+	t.Run("Templated body", func(t *testing.T) {
+		srv, reqs := newServer(t, 0)
+		wh := newWebhook(srv.URL)
+		wh.Body = `{"text": {{ printf "%s: %s" .Type .Domain | json }}}`
+		bus := startNotifier(t, wh)
+
+		bus.Publish(events.Event{Type: events.TypeDNSUpdated, Domain: "example.com"})
+
+		r := receive(t, reqs)
+		assert.JSONEq(t, `{"text": "dns.updated: example.com"}`, string(r.body))
+	})
+
+	t.Run("Filters events", func(t *testing.T) {
+		srv, reqs := newServer(t, 0)
+		wh := newWebhook(srv.URL)
+		wh.Events = []string{string(events.TypeProviderError)}
+		bus := startNotifier(t, wh)
+
+		bus.Publish(events.Event{Type: events.TypeDNSUpdated, Domain: "example.com"})
+		bus.Publish(events.Event{Type: events.TypeProviderError, Domain: "example.com", Error: "boom"})
+
+		r := receive(t, reqs)
+		var e events.Event
+		require.NoError(t, json.Unmarshal(r.body, &e))
+		assert.Equal(t, events.TypeProviderError, e.Type)
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("Retries on failure", func(t *testing.T) {
+		srv, reqs := newServer(t, 2)
+		bus := startNotifier(t, newWebhook(srv.URL))
+
+		bus.Publish(events.Event{Type: events.TypeEndpointUp, Domain: "example.com", IP: "1.1.1.1"})
+
+		// The first 2 attempts fail, and the third succeeds
+		for range 3 {
+			receive(t, reqs)
+		}
+		time.Sleep(20 * time.Millisecond)
+		assert.Empty(t, reqs)
+	})
+
+	t.Run("Gives up after retries", func(t *testing.T) {
+		srv, reqs := newServer(t, 100)
+		wh := newWebhook(srv.URL)
+		retries := 1
+		wh.Retries = &retries
+		bus := startNotifier(t, wh)
+
+		bus.Publish(events.Event{Type: events.TypeEndpointUp, Domain: "example.com", IP: "1.1.1.1"})
+
+		for range 2 {
+			receive(t, reqs)
+		}
+		time.Sleep(20 * time.Millisecond)
+		assert.Empty(t, reqs)
+	})
+}
@@ -0,0 +1,224 @@
+package publicip
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/logging"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+// service is a service that returns the public IP of the machine
+type service struct {
+	name string
+	// URLs used to detect the IPv4 and IPv6 addresses
+	urlIPv4 string
+	urlIPv6 string
+	// Parses the IP from the response body
+	parse func(body []byte) (string, error)
+}
+
+// Built-in services
+var builtinServices = map[string]service{
+	"ipify": {
+		name:    "ipify",
+		urlIPv4: "https://api.ipify.org",
+		urlIPv6: "https://api6.ipify.org",
+		parse:   parsePlainText,
+	},
+	"icanhazip": {
+		name:    "icanhazip",
+		urlIPv4: "https://ipv4.icanhazip.com",
+		urlIPv6: "https://ipv6.icanhazip.com",
+		parse:   parsePlainText,
+	},
+	"cloudflare": {
+		name:    "cloudflare",
+		urlIPv4: "https://1.1.1.1/cdn-cgi/trace",
+		urlIPv6: "https://[2606:4700:4700::1111]/cdn-cgi/trace",
+		parse:   parseCloudflareTrace,
+	},
+}
+
+// Detector detects the public IP of the machine, querying multiple services and requiring a minimum number of them to agree
+type Detector struct {
+	services     []service
+	minAgreement int
+	timeout      time.Duration
+	httpClient   *http.Client
+}
+
+// NewDetector returns a new Detector based on the configuration
+func NewDetector(cfg config.ConfigPublicIP) (*Detector, error) {
+	if len(cfg.Services) == 0 {
+		return nil, errors.New("at least one service must be configured")
+	}
+	if cfg.MinAgreement < 1 || cfg.MinAgreement > len(cfg.Services) {
+		return nil, fmt.Errorf("minAgreement must be between 1 and %d", len(cfg.Services))
+	}
+
+	services := make([]service, len(cfg.Services))
+	for i, s := range cfg.Services {
+		svc, ok := builtinServices[s]
+		if !ok {
+			// Custom services use the same URL for IPv4 and IPv6
+			svc = service{
+				name:    s,
+				urlIPv4: s,
+				urlIPv6: s,
+				parse:   parsePlainText,
+			}
+		}
+		services[i] = svc
+	}
+
+	return &Detector{
+		services:     services,
+		minAgreement: cfg.MinAgreement,
+		timeout:      cfg.Timeout,
+		httpClient:   tracing.NewHTTPClient(),
+	}, nil
+}
+
+// PublicIP returns the public IPv4 address of the machine, or the IPv6 address if ipv6 is true
+// Results are not cached: the ipsource package caches them, so domains checked in the same cycle share them
+func (d *Detector) PublicIP(ctx context.Context, ipv6 bool) (netip.Addr, error) {
+	return d.detect(ctx, ipv6)
+}
+
+// detect queries all services concurrently, and returns the IP that was returned by at least minAgreement of them
+func (d *Detector) detect(ctx context.Context, ipv6 bool) (netip.Addr, error) {
+	type result struct {
+		addr netip.Addr
+		err  error
+	}
+	results := make([]result, len(d.services))
+
+	var wg sync.WaitGroup
+	for i, svc := range d.services {
+		wg.Go(func() {
+			results[i].addr, results[i].err = d.query(ctx, svc, ipv6)
+		})
+	}
+	wg.Wait()
+
+	// Count the votes for each address
+	votes := make(map[netip.Addr]int, len(results))
+	errs := make([]error, 0)
+	var (
+		best      netip.Addr
+		bestVotes int
+	)
+	for i, res := range results {
+		if res.err != nil {
+			logger().DebugContext(ctx, "Failed to detect public IP", slog.String("service", d.services[i].name), slog.Any("error", res.err))
+			errs = append(errs, fmt.Errorf("service '%s': %w", d.services[i].name, res.err))
+			continue
+		}
+		votes[res.addr]++
+		if votes[res.addr] > bestVotes {
+			best = res.addr
+			bestVotes = votes[res.addr]
+		}
+	}
+
+	if bestVotes < d.minAgreement {
+		if len(votes) > 1 {
+			addrs := make([]string, 0, len(votes))
+			for addr, n := range votes {
+				addrs = append(addrs, fmt.Sprintf("%s (%d)", addr, n))
+			}
+			slices.Sort(addrs)
+			errs = append(errs, fmt.Errorf("services returned different addresses: %s", strings.Join(addrs, ", ")))
+		}
+		return netip.Addr{}, fmt.Errorf("fewer than %d services agreed on the public IP: %w", d.minAgreement, errors.Join(errs...))
+	}
+
+	return best, nil
+}
+
+// query returns the IP returned by a service
+func (d *Detector) query(ctx context.Context, svc service, ipv6 bool) (netip.Addr, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	u := svc.urlIPv4
+	if ipv6 {
+		u = svc.urlIPv6
+	}
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, u, nil)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	res, err := d.httpClient.Do(req)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("request error: %w", err)
+	}
+	defer res.Body.Close() //nolint:errcheck
+
+	// Responses should be small
+	body, err := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return netip.Addr{}, fmt.Errorf("invalid response status code HTTP %d", res.StatusCode)
+	}
+
+	str, err := svc.parse(body)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(str)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("response is not a valid IP address: %w", err)
+	}
+	addr = addr.Unmap()
+
+	switch {
+	case ipv6 && !addr.Is6():
+		return netip.Addr{}, fmt.Errorf("response '%s' is not an IPv6 address", addr)
+	case !ipv6 && !addr.Is4():
+		return netip.Addr{}, fmt.Errorf("response '%s' is not an IPv4 address", addr)
+	case !addr.IsGlobalUnicast() || addr.IsPrivate():
+		return netip.Addr{}, fmt.Errorf("response '%s' is not a public IP address", addr)
+	}
+
+	return addr, nil
+}
+
+// parsePlainText parses responses that contain only the IP
+func parsePlainText(body []byte) (string, error) {
+	return strings.TrimSpace(string(body)), nil
+}
+
+// parseCloudflareTrace parses responses from Cloudflare's trace endpoint, which contain lines in the format "key=value"
+func parseCloudflareTrace(body []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		ip, ok := strings.CutPrefix(scanner.Text(), "ip=")
+		if ok {
+			return strings.TrimSpace(ip), nil
+		}
+	}
+	return "", errors.New("response does not contain the IP")
+}
+
+// logger returns the logger for the public IP detector
+func logger() *slog.Logger {
+	return logging.Component("publicip")
+}
@@ -0,0 +1,110 @@
+package publicip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// newTestService returns a server that responds with the given body, and counts the requests it receives
+func newTestService(t *testing.T, body string, status int) (string, *atomic.Int32) {
+	t.Helper()
+
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, &count
+}
+
+func TestDetector(t *testing.T) {
+	newDetector := func(t *testing.T, minAgreement int, services ...string) *Detector {
+		t.Helper()
+
+		d, err := NewDetector(config.ConfigPublicIP{
+			Services:     services,
+			MinAgreement: minAgreement,
+			Timeout:      5 * time.Second,
+		})
+		require.NoError(t, err)
+		return d
+	}
+
+	t.Run("Services agree", func(t *testing.T) {
+		svc1, _ := newTestService(t, "203.0.113.1\n", http.StatusOK)
+		svc2, _ := newTestService(t, "203.0.113.1", http.StatusOK)
+		svc3, _ := newTestService(t, "", http.StatusInternalServerError)
+
+		addr, err := newDetector(t, 2, svc1, svc2, svc3).PublicIP(t.Context(), false)
+		require.NoError(t, err)
+		assert.Equal(t, "203.0.113.1", addr.String())
+	})
+
+	t.Run("Services disagree", func(t *testing.T) {
+		svc1, _ := newTestService(t, "203.0.113.1", http.StatusOK)
+		svc2, _ := newTestService(t, "203.0.113.2", http.StatusOK)
+		svc3, _ := newTestService(t, "", http.StatusInternalServerError)
+
+		_, err := newDetector(t, 2, svc1, svc2, svc3).PublicIP(t.Context(), false)
+		require.ErrorContains(t, err, "fewer than 2 services agreed on the public IP")
+		require.ErrorContains(t, err, "services returned different addresses: 203.0.113.1 (1), 203.0.113.2 (1)")
+		require.ErrorContains(t, err, "invalid response status code HTTP 500")
+	})
+
+	t.Run("Address family", func(t *testing.T) {
+		svc, _ := newTestService(t, "2001:db8::1", http.StatusOK)
+		d := newDetector(t, 1, svc)
+
+		addr, err := d.PublicIP(t.Context(), true)
+		require.NoError(t, err)
+		assert.Equal(t, "2001:db8::1", addr.String())
+
+		_, err = d.PublicIP(t.Context(), false)
+		require.ErrorContains(t, err, "response '2001:db8::1' is not an IPv4 address")
+	})
+
+	t.Run("Private address", func(t *testing.T) {
+		svc, _ := newTestService(t, "192.168.1.1", http.StatusOK)
+
+		_, err := newDetector(t, 1, svc).PublicIP(t.Context(), false)
+		require.ErrorContains(t, err, "response '192.168.1.1' is not a public IP address")
+	})
+
+	t.Run("Results are not cached", func(t *testing.T) {
+		svc, count := newTestService(t, "203.0.113.1", http.StatusOK)
+		d := newDetector(t, 1, svc)
+
+		// Results are cached by the ipsource package, so the services are queried each time
+		for range 3 {
+			addr, err := d.PublicIP(t.Context(), false)
+			require.NoError(t, err)
+			assert.Equal(t, "203.0.113.1", addr.String())
+		}
+		assert.Equal(t, int32(3), count.Load())
+	})
+
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := NewDetector(config.ConfigPublicIP{Services: []string{"ipify"}, MinAgreement: 2})
+		require.ErrorContains(t, err, "minAgreement must be between 1 and 1")
+	})
+}
+
+func TestParseCloudflareTrace(t *testing.T) {
+	ip, err := parseCloudflareTrace([]byte("fl=123\nh=1.1.1.1\nip=203.0.113.1\nts=1700000000.000\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", ip)
+
+	_, err = parseCloudflareTrace([]byte("fl=123\n"))
+	require.ErrorContains(t, err, "response does not contain the IP")
+}
@@ -0,0 +1,185 @@
+package quorum
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/logging"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+const (
+	// Path of the API route that returns the observations of an instance
+	ObservationsPath = "/api/observations"
+	// Path of the API route that receives the observations of remote checker agents
+	ReportPath = "/api/agents/report"
+)
+
+// Observations fetched from peers are re-used for this long, so domains checked in the same cycle don't query peers again
+const cacheDuration = 5 * time.Second
+
+// Observations contains the results of the last health checks performed by an instance, keyed by domain
+type Observations map[string]DomainObservations
+
+// DomainObservations contains the results of the last health checks for a domain
+type DomainObservations struct {
+	// Time of the last check
+	CheckedAt time.Time `json:"checkedAt"`
+	// Whether each endpoint passed the last check, keyed by IP
+	Endpoints map[string]bool `json:"endpoints"`
+}
+
+// Vote is the outcome of asking the vantage points whether an endpoint is down
+type Vote struct {
+	// Number of vantage points, including this instance, that observed the endpoint as down
+	Down int
+	// Number of vantage points, including this instance, with a recent observation of the endpoint
+	Voters int
+}
+
+// NewVote returns a Vote that contains the observation of this instance
+func NewVote(healthy bool) Vote {
+	v := Vote{}
+	v.Add(healthy)
+	return v
+}
+
+// Add adds the observation of a vantage point
+func (v *Vote) Add(healthy bool) {
+	v.Voters++
+	if !healthy {
+		v.Down++
+	}
+}
+
+// AddObservations adds the observation of the endpoint from another vantage point, if it's more recent than maxAge
+func (v *Vote) AddObservations(obs Observations, domain string, ip string, now time.Time, maxAge time.Duration) {
+	dobs, ok := obs[domain]
+	if !ok || now.Sub(dobs.CheckedAt) > maxAge {
+		return
+	}
+	healthy, ok := dobs.Endpoints[ip]
+	if !ok {
+		return
+	}
+	v.Add(healthy)
+}
+
+// Confirmed returns true if the majority of vantage points observed the endpoint as down
+func (v Vote) Confirmed() bool {
+	return v.Down*2 > v.Voters
+}
+
+// Quorum collects observations from other instances of ddup, so endpoints are removed from DNS only if the majority of vantage points observe them as down
+type Quorum struct {
+	peers      []config.ConfigQuorumPeer
+	maxAge     time.Duration
+	timeout    time.Duration
+	httpClient *http.Client
+
+	lock sync.Mutex
+	// Observations from each peer, in the same order as peers; nil for peers that could not be reached
+	// Protected by lock
+	observations []Observations
+	// Time the observations were fetched
+	// Protected by lock
+	fetched time.Time
+}
+
+// New returns a new Quorum object
+func New(cfg *config.ConfigQuorum) *Quorum {
+	return &Quorum{
+		peers:      cfg.Peers,
+		maxAge:     cfg.MaxAge,
+		timeout:    cfg.Timeout,
+		httpClient: tracing.NewHTTPClient(),
+	}
+}
+
+// ConfirmDown asks the vantage points whether the endpoint with the given IP is down
+// This instance observed the endpoint as down, and it counts as one vote
+// Peers that can't be reached, or that haven't checked the domain recently, don't vote
+func (q *Quorum) ConfirmDown(ctx context.Context, domain string, ip string) Vote {
+	vote := NewVote(false)
+	now := time.Now()
+	for _, obs := range q.getObservations(ctx) {
+		vote.AddObservations(obs, domain, ip, now, q.maxAge)
+	}
+	return vote
+}
+
+// getObservations returns the observations from the peers, fetching them if the cached ones are too old
+func (q *Quorum) getObservations(ctx context.Context) []Observations {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.observations != nil && time.Since(q.fetched) < cacheDuration {
+		return q.observations
+	}
+
+	// Fetch from all peers concurrently
+	res := make([]Observations, len(q.peers))
+	var wg sync.WaitGroup
+	for i, peer := range q.peers {
+		wg.Go(func() {
+			obs, err := q.fetch(ctx, peer)
+			if err != nil {
+				logger().WarnContext(ctx, "Failed to get observations from peer", "peer", peer.URL, "error", err)
+				return
+			}
+			res[i] = obs
+		})
+	}
+	wg.Wait()
+
+	q.observations = res
+	q.fetched = time.Now()
+	return res
+}
+
+func (q *Quorum) fetch(ctx context.Context, peer config.ConfigQuorumPeer) (Observations, error) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(peer.URL, "/")+ObservationsPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if peer.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+peer.APIToken)
+	}
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return nil, fmt.Errorf("request failed: status code %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var obs Observations
+	err = json.NewDecoder(resp.Body).Decode(&obs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if obs == nil {
+		obs = Observations{}
+	}
+	return obs, nil
+}
+
+// logger returns the logger for the quorum
+func logger() *slog.Logger {
+	return logging.Component("quorum")
+}
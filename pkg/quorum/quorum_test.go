@@ -0,0 +1,117 @@
+package quorum
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestQuorum(t *testing.T) {
+	newPeer := func(obs Observations, calls *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls != nil {
+				calls.Add(1)
+			}
+			if r.URL.Path != ObservationsPath || r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(obs)
+		}))
+	}
+
+	now := time.Now()
+	var calls atomic.Int32
+	down := newPeer(Observations{
+		"example.com": {CheckedAt: now, Endpoints: map[string]bool{"1.1.1.1": false, "2.2.2.2": true}},
+	}, &calls)
+	defer down.Close()
+	up := newPeer(Observations{
+		"example.com": {CheckedAt: now, Endpoints: map[string]bool{"1.1.1.1": true, "2.2.2.2": true}},
+	}, nil)
+	defer up.Close()
+	stale := newPeer(Observations{
+		"example.com": {CheckedAt: now.Add(-time.Hour), Endpoints: map[string]bool{"1.1.1.1": false, "2.2.2.2": false}},
+	}, nil)
+	defer stale.Close()
+
+	newQuorum := func(peers ...string) *Quorum {
+		cfg := &config.ConfigQuorum{MaxAge: time.Minute, Timeout: 5 * time.Second}
+		for _, p := range peers {
+			cfg.Peers = append(cfg.Peers, config.ConfigQuorumPeer{URL: p, APIToken: "token"})
+		}
+		return New(cfg)
+	}
+
+	t.Run("majority observes the endpoint as down", func(t *testing.T) {
+		calls.Store(0)
+		q := newQuorum(down.URL, up.URL, stale.URL)
+		vote := q.ConfirmDown(t.Context(), "example.com", "1.1.1.1")
+		assert.Equal(t, Vote{Down: 2, Voters: 3}, vote)
+		assert.True(t, vote.Confirmed())
+
+		// Observations are cached
+		vote = q.ConfirmDown(t.Context(), "example.com", "2.2.2.2")
+		assert.Equal(t, Vote{Down: 1, Voters: 3}, vote)
+		assert.False(t, vote.Confirmed())
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("tie is not a majority", func(t *testing.T) {
+		vote := newQuorum(up.URL).ConfirmDown(t.Context(), "example.com", "1.1.1.1")
+		assert.Equal(t, Vote{Down: 1, Voters: 2}, vote)
+		assert.False(t, vote.Confirmed())
+	})
+
+	t.Run("peers without recent observations don't vote", func(t *testing.T) {
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachable.Close()
+
+		q := newQuorum(stale.URL, unreachable.URL)
+		vote := q.ConfirmDown(t.Context(), "example.com", "1.1.1.1")
+		assert.Equal(t, Vote{Down: 1, Voters: 1}, vote)
+		assert.True(t, vote.Confirmed())
+
+		vote = q.ConfirmDown(t.Context(), "other.com", "1.1.1.1")
+		assert.Equal(t, Vote{Down: 1, Voters: 1}, vote)
+	})
+}
+
+func TestReports(t *testing.T) {
+	now := time.Now()
+	r := NewReports()
+	r.Set("eu", Observations{
+		"example.com": {CheckedAt: now, Endpoints: map[string]bool{"1.1.1.1": false, "2.2.2.2": true}},
+	})
+	r.Set("us", Observations{
+		"example.com": {CheckedAt: now, Endpoints: map[string]bool{"1.1.1.1": false, "2.2.2.2": false}},
+	})
+	r.Set("ap", Observations{
+		"example.com": {CheckedAt: now.Add(-time.Hour), Endpoints: map[string]bool{"1.1.1.1": true, "2.2.2.2": false}},
+	})
+
+	// This instance observes the endpoint as healthy, but the agents don't
+	vote := NewVote(true)
+	r.AddVotes(&vote, "example.com", "1.1.1.1", time.Minute)
+	assert.Equal(t, Vote{Down: 2, Voters: 3}, vote)
+	assert.True(t, vote.Confirmed())
+
+	vote = NewVote(true)
+	r.AddVotes(&vote, "example.com", "2.2.2.2", time.Minute)
+	assert.Equal(t, Vote{Down: 1, Voters: 3}, vote)
+	assert.False(t, vote.Confirmed())
+
+	// Reports replace the previous ones from the same agent
+	r.Set("us", Observations{})
+	vote = NewVote(true)
+	r.AddVotes(&vote, "example.com", "1.1.1.1", time.Minute)
+	assert.Equal(t, Vote{Down: 1, Voters: 2}, vote)
+	assert.False(t, vote.Confirmed())
+}
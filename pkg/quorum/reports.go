@@ -0,0 +1,40 @@
+package quorum
+
+import (
+	"sync"
+	"time"
+)
+
+// Reports contains the observations reported by remote checker agents
+// It's safe for concurrent use
+type Reports struct {
+	lock sync.RWMutex
+	// Last observations reported by each agent, keyed by the agent's name
+	reports map[string]Observations
+}
+
+// NewReports returns a new Reports object
+func NewReports() *Reports {
+	return &Reports{
+		reports: make(map[string]Observations),
+	}
+}
+
+// Set stores the observations reported by an agent, replacing the previous ones
+func (r *Reports) Set(agent string, obs Observations) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.reports[agent] = obs
+}
+
+// AddVotes adds to the vote the observations of the endpoint reported by agents, ignoring those older than maxAge
+func (r *Reports) AddVotes(vote *Vote, domain string, ip string, maxAge time.Duration) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	now := time.Now()
+	for _, obs := range r.reports {
+		vote.AddObservations(obs, domain, ip, now, maxAge)
+	}
+}
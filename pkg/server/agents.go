@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/italypaleale/ddup/pkg/quorum"
+)
+
+// Maximum size for the reports sent by remote checker agents
+const agentReportMaxBodySize = 1 << 20
+
+// handleAgentReport is the handler for the route that receives the results of the health checks performed by a remote checker agent
+func (s *Server) handleAgentReport(w http.ResponseWriter, r *http.Request) {
+	if s.agents == nil {
+		errAgentsDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	var obs quorum.Observations
+	err := json.NewDecoder(r.Body).Decode(&obs)
+	if err != nil {
+		errAgentReportInvalid.
+			Clone(withMetadata(map[string]string{"error": err.Error()})).
+			WriteResponse(r.Context(), w)
+		return
+	}
+
+	agent := getAgentName(r.Context())
+	s.agents.ReportObservations(agent, obs)
+	logger().DebugContext(r.Context(), "Received report from remote checker agent", "agent", agent, "domains", len(obs))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/quorum"
+)
+
+type mockAgentReportReceiver struct {
+	reports map[string]quorum.Observations
+}
+
+func (m *mockAgentReportReceiver) ReportObservations(agent string, obs quorum.Observations) {
+	if m.reports == nil {
+		m.reports = map[string]quorum.Observations{}
+	}
+	m.reports[agent] = obs
+}
+
+func TestHandleAgentReport(t *testing.T) {
+	clients := []config.ConfigAgentsClient{
+		{Name: "eu", Token: "eutoken"},
+		{Name: "us", Token: "ustoken"},
+	}
+	doRequest := func(t *testing.T, s *Server, clients []config.ConfigAgentsClient, token string, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		mux := http.NewServeMux()
+		mux.Handle("POST "+quorum.ReportPath, Use(http.HandlerFunc(s.handleAgentReport), MiddlewareRequireAgentToken(clients)))
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, quorum.ReportPath, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Report is stored for the agent", func(t *testing.T) {
+		receiver := &mockAgentReportReceiver{}
+		s := &Server{agents: receiver}
+
+		rec := doRequest(t, s, clients, "ustoken", `{"example.com":{"checkedAt":"2026-01-02T03:04:05Z","endpoints":{"1.1.1.1":false}}}`)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		require.Contains(t, receiver.reports, "us")
+		assert.Equal(t, map[string]bool{"1.1.1.1": false}, receiver.reports["us"]["example.com"].Endpoints)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		receiver := &mockAgentReportReceiver{}
+		s := &Server{agents: receiver}
+
+		rec := doRequest(t, s, clients, "nope", `{}`)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), errAuthRequired.Code)
+		assert.Empty(t, receiver.reports)
+	})
+
+	t.Run("Invalid body", func(t *testing.T) {
+		s := &Server{agents: &mockAgentReportReceiver{}}
+
+		rec := doRequest(t, s, clients, "eutoken", `not json`)
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), errAgentReportInvalid.Code)
+	})
+
+	t.Run("Agents not enabled", func(t *testing.T) {
+		s := &Server{agents: &mockAgentReportReceiver{}}
+
+		rec := doRequest(t, s, nil, "eutoken", `{}`)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), errAgentsDisabled.Code)
+	})
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// MiddlewareRequireAPIToken is a middleware that allows requests only if they include one of the API tokens in the Authorization header.
+// Read-only tokens are recognized, but they are not allowed to perform the request.
+// If the list of tokens is empty, all requests are rejected.
+func MiddlewareRequireAPIToken(tokens []string, readOnlyTokens []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(tokens) == 0 {
+				errAdminDisabled.WriteResponse(r.Context(), w)
+				return
+			}
+
+			token, ok := getBearerToken(r)
+			switch {
+			case ok && matchToken(token, tokens):
+				next.ServeHTTP(w, r)
+			case ok && matchToken(token, readOnlyTokens):
+				errTokenReadOnly.WriteResponse(r.Context(), w)
+			default:
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				errAuthRequired.WriteResponse(r.Context(), w)
+			}
+		})
+	}
+}
+
+// MiddlewareRequireReadAccess is a middleware for routes that return the status, which can be used with any API token.
+// If dashboard authentication is enabled, users who are logged in are allowed too.
+// If there are no read-only tokens and dashboard authentication is disabled, all requests are allowed.
+func MiddlewareRequireReadAccess(tokens []string, readOnlyTokens []string, auth *dashboardAuth) Middleware {
+	return func(next http.Handler) http.Handler {
+		if len(readOnlyTokens) == 0 && auth == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := getBearerToken(r)
+			if ok && (matchToken(token, readOnlyTokens) || matchToken(token, tokens)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if auth != nil {
+				_, ok = auth.authenticate(r)
+				if ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+				errLoginRequired.WriteResponse(r.Context(), w)
+				return
+			}
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			errAuthRequired.WriteResponse(r.Context(), w)
+		})
+	}
+}
+
+// agentContextKey is the key for the name of the remote checker agent in the request context
+type agentContextKey struct{}
+
+// MiddlewareRequireAgentToken is a middleware for routes used by remote checker agents, which allows requests only if they include the token of an agent.
+// The name of the agent is stored in the request context.
+// If there are no agents, all requests are rejected.
+func MiddlewareRequireAgentToken(agents []config.ConfigAgentsClient) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(agents) == 0 {
+				errAgentsDisabled.WriteResponse(r.Context(), w)
+				return
+			}
+
+			token, ok := getBearerToken(r)
+			if ok {
+				for _, a := range agents {
+					if matchToken(token, []string{a.Token}) {
+						ctx := context.WithValue(r.Context(), agentContextKey{}, a.Name)
+						next.ServeHTTP(w, r.WithContext(ctx))
+						return
+					}
+				}
+			}
+
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			errAuthRequired.WriteResponse(r.Context(), w)
+		})
+	}
+}
+
+// getAgentName returns the name of the remote checker agent from the context, or an empty string if not set
+func getAgentName(ctx context.Context) string {
+	name, _ := ctx.Value(agentContextKey{}).(string)
+	return name
+}
+
+// getBearerToken returns the bearer token from the Authorization header
+func getBearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// matchToken returns true if the token is in the list, using constant-time comparisons
+func matchToken(token string, tokens []string) bool {
+	var found bool
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestMiddlewareRequireAPIToken(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	doRequest := func(t *testing.T, tokens []string, authorization string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/config", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		Use(okHandler, MiddlewareRequireAPIToken(tokens, []string{"ro1"})).ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Valid token", func(t *testing.T) {
+		rec := doRequest(t, []string{"tok1", "tok2"}, "Bearer tok2")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("Scheme is case-insensitive", func(t *testing.T) {
+		rec := doRequest(t, []string{"tok1"}, "bearer tok1")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		rec := doRequest(t, []string{"tok1"}, "Bearer nope")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Read-only token", func(t *testing.T) {
+		rec := doRequest(t, []string{"tok1"}, "Bearer ro1")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		rec := doRequest(t, []string{"tok1"}, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Wrong scheme", func(t *testing.T) {
+		rec := doRequest(t, []string{"tok1"}, "Basic tok1")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("No tokens configured", func(t *testing.T) {
+		rec := doRequest(t, nil, "Bearer tok1")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestMiddlewareRequireReadAccess(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	doRequest := func(t *testing.T, readOnlyTokens []string, auth *dashboardAuth, authorization string) int {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		Use(okHandler, MiddlewareRequireReadAccess([]string{"tok1"}, readOnlyTokens, auth)).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("Public when not configured", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, doRequest(t, nil, nil, ""))
+	})
+
+	t.Run("Read-only tokens", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, doRequest(t, []string{"ro1"}, nil, "Bearer ro1"))
+		assert.Equal(t, http.StatusNoContent, doRequest(t, []string{"ro1"}, nil, "Bearer tok1"))
+		assert.Equal(t, http.StatusUnauthorized, doRequest(t, []string{"ro1"}, nil, "Bearer nope"))
+		assert.Equal(t, http.StatusUnauthorized, doRequest(t, []string{"ro1"}, nil, ""))
+	})
+
+	t.Run("Dashboard authentication", func(t *testing.T) {
+		auth, err := newDashboardAuth(&config.ConfigDashboardAuth{Username: "admin", Password: "s3cret"})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusNoContent, doRequest(t, nil, auth, "Bearer tok1"))
+		assert.Equal(t, http.StatusNoContent, doRequest(t, nil, auth, "Basic YWRtaW46czNjcmV0"))
+		assert.Equal(t, http.StatusUnauthorized, doRequest(t, nil, auth, ""))
+	})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+// Maximum duration of health checks and DNS updates run on demand
+const checkTimeout = 2 * time.Minute
+
+// handleCheck is the handler for the routes that run health checks and DNS updates on demand
+// If the request includes a record name, only that domain is checked
+func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if s.checker == nil {
+		errCheckDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	recordName := r.PathValue("recordname")
+
+	// The check continues if the client disconnects, so DNS updates are not interrupted halfway
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), checkTimeout)
+	defer cancel()
+
+	err := s.checker.CheckNow(ctx, recordName)
+	switch {
+	case errors.Is(err, healthcheck.ErrDomainNotFound):
+		errStatusDomainNotFound.WriteResponse(r.Context(), w)
+		return
+	case err != nil:
+		logger().ErrorContext(r.Context(), "Failed to run health checks on demand", "domain", recordName, "error", err)
+		errCheck.WriteResponse(r.Context(), w)
+		return
+	}
+
+	logger().InfoContext(r.Context(), "Health checks run via API", "domain", recordName)
+
+	// Respond with the updated status, if available
+	if s.hc != nil && recordName == "" {
+		respondWithJSON(r.Context(), w, s.hc.GetAllDomainsStatus())
+		return
+	}
+	s.respondWithDomainStatus(w, r, recordName)
+}
+
+// handleSync is the handler for the route that pushes the records of a domain to the provider, even if they haven't changed
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if s.checker == nil {
+		errCheckDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	recordName := r.PathValue("recordname")
+
+	// The update continues if the client disconnects, so it's not interrupted halfway
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), checkTimeout)
+	defer cancel()
+
+	err := s.checker.SyncNow(ctx, recordName)
+	switch {
+	case errors.Is(err, healthcheck.ErrDomainNotFound):
+		errStatusDomainNotFound.WriteResponse(r.Context(), w)
+		return
+	case errors.Is(err, healthcheck.ErrNoHealthyEndpoints):
+		errSyncNoHealthy.WriteResponse(r.Context(), w)
+		return
+	case errors.Is(err, healthcheck.ErrDomainPaused):
+		errSyncPaused.WriteResponse(r.Context(), w)
+		return
+	case errors.Is(err, healthcheck.ErrNotLeader):
+		errSyncNotLeader.WriteResponse(r.Context(), w)
+		return
+	case err != nil:
+		logger().ErrorContext(r.Context(), "Failed to sync DNS records on demand", "domain", recordName, "error", err)
+		errSync.
+			Clone(withMetadata(map[string]string{"error": err.Error()})).
+			WriteResponse(r.Context(), w)
+		return
+	}
+
+	logger().InfoContext(r.Context(), "DNS records synced via API", "domain", recordName)
+	s.respondWithDomainStatus(w, r, recordName)
+}
+
+// respondWithDomainStatus responds with the status of the domain, if available
+func (s *Server) respondWithDomainStatus(w http.ResponseWriter, r *http.Request, domain string) {
+	var status *healthcheck.DomainStatus
+	if s.hc != nil {
+		status = s.hc.GetDomainStatus(domain)
+	}
+	if status == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respondWithJSON(r.Context(), w, status)
+}
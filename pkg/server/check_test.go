@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+type mockCheckRunner struct {
+	err     error
+	calls   int
+	domains []string
+	synced  []string
+}
+
+func (m *mockCheckRunner) CheckNow(ctx context.Context, domain string) error {
+	m.calls++
+	if m.err != nil {
+		return m.err
+	}
+	m.domains = append(m.domains, domain)
+	return nil
+}
+
+func (m *mockCheckRunner) SyncNow(ctx context.Context, domain string) error {
+	m.calls++
+	if m.err != nil {
+		return m.err
+	}
+	m.synced = append(m.synced, domain)
+	return nil
+}
+
+func TestHandleCheck(t *testing.T) {
+	doRequest := func(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/check", s.handleCheck)
+		mux.HandleFunc("POST /api/check/{recordname}", s.handleCheck)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, path, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("All domains", func(t *testing.T) {
+		runner := &mockCheckRunner{}
+		s := &Server{checker: runner}
+
+		rec := doRequest(t, s, "/api/check")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, []string{""}, runner.domains)
+	})
+
+	t.Run("Single domain", func(t *testing.T) {
+		runner := &mockCheckRunner{}
+		s := &Server{checker: runner}
+
+		rec := doRequest(t, s, "/api/check/app.example.com")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, []string{"app.example.com"}, runner.domains)
+	})
+
+	t.Run("Domain not found", func(t *testing.T) {
+		s := &Server{checker: &mockCheckRunner{err: healthcheck.ErrDomainNotFound}}
+
+		rec := doRequest(t, s, "/api/check/nope.example.com")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), errStatusDomainNotFound.Code)
+	})
+
+	t.Run("Other errors", func(t *testing.T) {
+		s := &Server{checker: &mockCheckRunner{err: errors.New("simulated")}}
+
+		rec := doRequest(t, s, "/api/check")
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), errCheck.Code)
+	})
+
+	t.Run("Checks disabled", func(t *testing.T) {
+		s := &Server{}
+
+		rec := doRequest(t, s, "/api/check")
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
+
+func TestHandleSync(t *testing.T) {
+	doRequest := func(t *testing.T, s *Server) *httptest.ResponseRecorder {
+		t.Helper()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/sync/{recordname}", s.handleSync)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/sync/app.example.com", nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Sync", func(t *testing.T) {
+		runner := &mockCheckRunner{}
+		s := &Server{checker: runner}
+
+		rec := doRequest(t, s)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, []string{"app.example.com"}, runner.synced)
+	})
+
+	t.Run("Domain not found", func(t *testing.T) {
+		s := &Server{checker: &mockCheckRunner{err: healthcheck.ErrDomainNotFound}}
+
+		rec := doRequest(t, s)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("No healthy endpoints", func(t *testing.T) {
+		s := &Server{checker: &mockCheckRunner{err: healthcheck.ErrNoHealthyEndpoints}}
+
+		rec := doRequest(t, s)
+		require.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), errSyncNoHealthy.Code)
+	})
+
+	t.Run("Update failed", func(t *testing.T) {
+		s := &Server{checker: &mockCheckRunner{err: errors.New("simulated")}}
+
+		rec := doRequest(t, s)
+		require.Equal(t, http.StatusBadGateway, rec.Code)
+
+		var res apiError
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, errSync.Code, res.Code)
+		assert.Equal(t, "simulated", res.Metadata["error"])
+	})
+}
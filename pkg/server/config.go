@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+const (
+	// Maximum size for config documents sent to the server
+	configMaxBodySize = 1 << 20
+	// Suffix added to the path of the config file to store a backup of the previous version
+	configBackupSuffix = ".bak"
+)
+
+// configValidationResponse is the response for the config validation route
+type configValidationResponse struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// handleConfigValidate is the handler for the route that validates a candidate configuration document, without applying it
+func (s *Server) handleConfigValidate(w http.ResponseWriter, r *http.Request) {
+	body, ok := readConfigBody(w, r)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(r.Context(), w, validateConfigDocument(body, config.FormatFromPath(s.getConfig().GetLoadedConfigPath())))
+}
+
+// handleConfigGet is the handler for the route that returns the current configuration file
+func (s *Server) handleConfigGet(w http.ResponseWriter, r *http.Request) {
+	filePath := s.getConfig().GetLoadedConfigPath()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		errConfigFileRead.
+			Clone(withMetadata(map[string]string{"error": err.Error()})).
+			WriteResponse(r.Context(), w)
+		return
+	}
+
+	switch config.FormatFromPath(filePath) {
+	case config.FormatJSON:
+		w.Header().Set(headerContentType, jsonContentType)
+	case config.FormatTOML:
+		w.Header().Set(headerContentType, tomlContentType)
+	default:
+		w.Header().Set(headerContentType, yamlContentType)
+	}
+	_, _ = w.Write(data) //nolint:errcheck
+}
+
+// handleConfigPut is the handler for the route that replaces the configuration file.
+// The new configuration is validated and then saved to disk, keeping a backup of the previous version, and then applied.
+func (s *Server) handleConfigPut(w http.ResponseWriter, r *http.Request) {
+	if s.reloader == nil {
+		errConfigReloadDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	body, ok := readConfigBody(w, r)
+	if !ok {
+		return
+	}
+
+	// Validate the new configuration before saving it
+	// The document must be in the same format as the file it replaces
+	report := validateConfigDocument(body, config.FormatFromPath(s.getConfig().GetLoadedConfigPath()))
+	if !report.Valid {
+		w.Header().Set(headerContentType, jsonContentType)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		respondWithJSON(r.Context(), w, report)
+		return
+	}
+
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+
+	// Save the new file, keeping a backup of the previous one
+	filePath, prev, err := replaceConfigFile(s.getConfig().GetLoadedConfigPath(), body)
+	if err != nil {
+		errConfigFileWrite.
+			Clone(withMetadata(map[string]string{"error": err.Error()})).
+			WriteResponse(r.Context(), w)
+		return
+	}
+
+	// Apply the new configuration
+	// If that fails, restore the previous file
+	err = s.reloader.Reload(r.Context())
+	if err != nil {
+		// The backup is not written again, so it keeps the previous version
+		restoreErr := restoreConfigFile(filePath, prev)
+		if restoreErr != nil {
+			logger().ErrorContext(r.Context(), "Failed to restore the previous configuration file", slog.Any("error", restoreErr))
+		}
+
+		errConfigReload.
+			Clone(withMetadata(map[string]string{"error": err.Error()})).
+			WriteResponse(r.Context(), w)
+		return
+	}
+
+	logger().InfoContext(r.Context(), "Configuration file updated via API", slog.String("path", filePath))
+
+	respondWithJSON(r.Context(), w, report)
+}
+
+// readConfigBody reads a config document from the request body
+// If the response is false, an error was already sent to the client
+func readConfigBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			errConfigBodyTooLarge.WriteResponse(r.Context(), w)
+			return nil, false
+		}
+		errConfigBodyRead.WriteResponse(r.Context(), w)
+		return nil, false
+	}
+
+	return body, true
+}
+
+// validateConfigDocument parses and validates a configuration document in the given format, returning the validation report
+// References to environmental variables are not expanded, as values could otherwise be returned in validation errors
+func validateConfigDocument(doc []byte, format string) configValidationResponse {
+	cfg, err := config.ParseFormatWithOptions(bytes.NewReader(doc), format, config.ParseOptions{SkipEnvExpansion: true})
+	if err != nil {
+		return configValidationResponse{
+			Valid:  false,
+			Errors: []string{err.Error()},
+		}
+	}
+
+	// Validation may emit logs, which we discard
+	err = cfg.Validate(slog.New(slog.DiscardHandler))
+	if err != nil {
+		return configValidationResponse{
+			Valid:  false,
+			Errors: config.ValidationErrors(err),
+		}
+	}
+
+	return configValidationResponse{
+		Valid: true,
+	}
+}
+
+// replaceConfigFile replaces the content of the config file, after storing a backup of the previous version.
+// If the path is a symbolic link, the target of the link is updated.
+// It returns the path of the file that was updated and its previous content.
+func replaceConfigFile(filePath string, data []byte) (string, []byte, error) {
+	if filePath == "" {
+		return "", nil, errors.New("no configuration file was loaded")
+	}
+
+	filePath, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to resolve path of the configuration file: %w", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to stat the configuration file: %w", err)
+	}
+	perm := info.Mode().Perm()
+
+	prev, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the configuration file: %w", err)
+	}
+
+	err = os.WriteFile(filePath+configBackupSuffix, prev, perm)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to write backup of the configuration file: %w", err)
+	}
+
+	err = writeFileAtomic(filePath, data, perm)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return filePath, prev, nil
+}
+
+// restoreConfigFile restores the content of the config file at the path returned by replaceConfigFile.
+// Unlike replaceConfigFile, it doesn't write a backup, which must keep the version before the replacement.
+func restoreConfigFile(filePath string, data []byte) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat the configuration file: %w", err)
+	}
+
+	return writeFileAtomic(filePath, data, info.Mode().Perm())
+}
+
+// writeFileAtomic writes to a temporary file and then renames it, so the file is replaced atomically
+func writeFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	closeErr := tmp.Close()
+	if err != nil || closeErr != nil {
+		return fmt.Errorf("failed to write temporary file: %w", errors.Join(err, closeErr))
+	}
+
+	err = os.Rename(tmp.Name(), filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace the configuration file: %w", err)
+	}
+
+	return nil
+}
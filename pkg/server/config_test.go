@@ -0,0 +1,308 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+const testValidConfig = `
+providers:
+  p1:
+    cloudflare:
+      apiToken: "token"
+      zoneId: "zone"
+domains:
+  - recordName: "app.example.com"
+    provider: "p1"
+    endpoints:
+      - url: "http://10.0.0.1/health"
+        ip: "10.0.0.1"
+`
+
+type mockConfigReloader struct {
+	// Path of the config file
+	path    string
+	err     error
+	content []byte
+}
+
+func (m *mockConfigReloader) Reload(ctx context.Context) (err error) {
+	// Store the content of the file at the time of the reload
+	m.content, err = os.ReadFile(m.path)
+	if err != nil {
+		return err
+	}
+	return m.err
+}
+
+// setTestConfigFile writes a config file in a temporary folder and sets it as the loaded config file of the server
+func setTestConfigFile(t *testing.T, s *Server, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(filePath, []byte(content), 0o600)
+	require.NoError(t, err)
+
+	setTestConfigPath(s, filePath)
+	return filePath
+}
+
+// setTestConfigPath sets the path of the loaded config file of the server
+func setTestConfigPath(s *Server, filePath string) {
+	cfg := config.GetDefaultConfig()
+	cfg.SetLoadedConfigPath(filePath)
+	s.UpdateConfig(cfg)
+}
+
+func TestHandleConfigValidate(t *testing.T) {
+	s := &Server{}
+
+	doRequest := func(t *testing.T, body string) (*httptest.ResponseRecorder, configValidationResponse) {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/config/validate", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		Use(http.HandlerFunc(s.handleConfigValidate), MiddlewareMaxBodySize(configMaxBodySize)).ServeHTTP(rec, req)
+
+		var res configValidationResponse
+		if rec.Code == http.StatusOK {
+			err := json.Unmarshal(rec.Body.Bytes(), &res)
+			require.NoError(t, err)
+		}
+		return rec, res
+	}
+
+	t.Run("Valid config", func(t *testing.T) {
+		rec, res := doRequest(t, testValidConfig)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, res.Valid)
+		assert.Empty(t, res.Errors)
+	})
+
+	t.Run("Reports all errors", func(t *testing.T) {
+		rec, res := doRequest(t, `
+providers:
+  p1:
+    cloudflare:
+      apiToken: "token"
+      zoneId: "zone"
+domains:
+  - recordName: "app.example.com"
+    provider: "p2"
+    endpoints:
+      - url: ""
+        ip: "10.0.0.1"
+      - url: "http://10.0.0.2/health"
+`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, res.Valid)
+		require.Len(t, res.Errors, 3)
+		assert.Contains(t, res.Errors[0], "provider 'p2' does not exist")
+		assert.Contains(t, res.Errors[1], "URL is empty")
+		assert.Contains(t, res.Errors[2], "one of IP and ipFrom must be set")
+	})
+
+	t.Run("Invalid YAML", func(t *testing.T) {
+		rec, res := doRequest(t, "interval: [")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, res.Valid)
+		require.Len(t, res.Errors, 1)
+		assert.Contains(t, res.Errors[0], "failed to decode configuration")
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		rec, res := doRequest(t, "notAField: 1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, res.Valid)
+		require.Len(t, res.Errors, 1)
+		assert.Contains(t, res.Errors[0], "notAField")
+	})
+
+	t.Run("Empty document", func(t *testing.T) {
+		rec, res := doRequest(t, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, res.Valid)
+		assert.Equal(t, []string{"configuration document is empty"}, res.Errors)
+	})
+
+	t.Run("Body too large", func(t *testing.T) {
+		rec, _ := doRequest(t, strings.Repeat("#", configMaxBodySize+1))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("Environmental variables are not expanded", func(t *testing.T) {
+		t.Setenv("DDUP_TEST_VALIDATE_SECRET", "supersecret")
+
+		rec, res := doRequest(t, `
+domains:
+  - recordName: "${DDUP_TEST_VALIDATE_SECRET}"
+    provider: "p1"
+`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.False(t, res.Valid)
+		assert.NotContains(t, rec.Body.String(), "supersecret")
+	})
+}
+
+func TestHandleConfigGet(t *testing.T) {
+	s := &Server{}
+
+	t.Run("Returns the config file", func(t *testing.T) {
+		setTestConfigFile(t, s, testValidConfig)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/config", nil)
+		rec := httptest.NewRecorder()
+		s.handleConfigGet(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, yamlContentType, rec.Header().Get(headerContentType))
+		assert.Equal(t, testValidConfig, rec.Body.String())
+	})
+
+	t.Run("File does not exist", func(t *testing.T) {
+		filePath := setTestConfigFile(t, s, testValidConfig)
+		require.NoError(t, os.Remove(filePath))
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/config", nil)
+		rec := httptest.NewRecorder()
+		s.handleConfigGet(rec, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
+
+func TestHandleConfigPut(t *testing.T) {
+	const newConfig = testValidConfig + "interval: 10s\n"
+
+	doRequest := func(t *testing.T, s *Server, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPut, "/api/config", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		Use(http.HandlerFunc(s.handleConfigPut), MiddlewareMaxBodySize(configMaxBodySize)).ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Updates the config file", func(t *testing.T) {
+		s := &Server{}
+		filePath := setTestConfigFile(t, s, testValidConfig)
+		reloader := &mockConfigReloader{path: filePath}
+		s.reloader = reloader
+
+		rec := doRequest(t, s, newConfig)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		// Reload should have been invoked after the file was updated
+		assert.Equal(t, newConfig, string(reloader.content))
+
+		read, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, newConfig, string(read))
+
+		// Check the backup
+		read, err = os.ReadFile(filePath + configBackupSuffix)
+		require.NoError(t, err)
+		assert.Equal(t, testValidConfig, string(read))
+
+		// File permissions should be preserved
+		info, err := os.Stat(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("Invalid config is not saved", func(t *testing.T) {
+		s := &Server{}
+		filePath := setTestConfigFile(t, s, testValidConfig)
+		reloader := &mockConfigReloader{path: filePath}
+		s.reloader = reloader
+
+		rec := doRequest(t, s, "notAField: 1")
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+		var res configValidationResponse
+		err := json.Unmarshal(rec.Body.Bytes(), &res)
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+		assert.NotEmpty(t, res.Errors)
+
+		assert.Nil(t, reloader.content)
+		read, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, testValidConfig, string(read))
+	})
+
+	t.Run("Restores previous file if reload fails", func(t *testing.T) {
+		s := &Server{}
+		filePath := setTestConfigFile(t, s, testValidConfig)
+		reloader := &mockConfigReloader{path: filePath, err: errors.New("simulated")}
+		s.reloader = reloader
+
+		rec := doRequest(t, s, newConfig)
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "simulated")
+		assert.Equal(t, newConfig, string(reloader.content))
+
+		read, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, testValidConfig, string(read))
+	})
+
+	t.Run("Backup is not replaced if reload fails", func(t *testing.T) {
+		s := &Server{}
+		filePath := setTestConfigFile(t, s, testValidConfig)
+		s.reloader = &mockConfigReloader{path: filePath, err: errors.New("simulated")}
+
+		// The document passes validation, but applying it fails
+		rec := doRequest(t, s, newConfig)
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+
+		// The backup contains the version before the request, and not the rejected document
+		read, err := os.ReadFile(filePath + configBackupSuffix)
+		require.NoError(t, err)
+		assert.Equal(t, testValidConfig, string(read))
+
+		info, err := os.Stat(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("Follows symlinks", func(t *testing.T) {
+		s := &Server{}
+		target := setTestConfigFile(t, s, testValidConfig)
+		link := filepath.Join(t.TempDir(), "link.yaml")
+		require.NoError(t, os.Symlink(target, link))
+		setTestConfigPath(s, link)
+		s.reloader = &mockConfigReloader{path: link}
+
+		rec := doRequest(t, s, newConfig)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+
+		read, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, newConfig, string(read))
+	})
+
+	t.Run("Reload not available", func(t *testing.T) {
+		s := &Server{}
+		setTestConfigFile(t, s, testValidConfig)
+
+		rec := doRequest(t, s, newConfig)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
@@ -0,0 +1,453 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+const (
+	// Name of the cookie that contains the login session
+	sessionCookieName = "ddup_session"
+	// Path of the login page
+	loginPath = "/login"
+
+	// Purposes of signed tokens, so a token can't be used in place of another
+	tokenPurposeSession   = "session"
+	tokenPurposeOIDCState = "oidc-state"
+)
+
+// dashboardAuth authenticates users of the dashboard, using login sessions stored in signed cookies
+type dashboardAuth struct {
+	// Password of each user, as plain text or bcrypt hash
+	users map[string]string
+	// Key used to sign session cookies
+	// It's generated when the server starts, so sessions are invalidated on restart
+	key             []byte
+	sessionDuration time.Duration
+	// Hash compared when the user doesn't exist, so the response time doesn't reveal whether a user exists
+	dummyHash []byte
+	// If set, users log in with OIDC instead of a password
+	oidc *oidcProvider
+}
+
+// sessionPayload is the payload of the session cookie
+type sessionPayload struct {
+	Username string `json:"u"`
+	Expires  int64  `json:"exp"`
+}
+
+func newDashboardAuth(cfg *config.ConfigDashboardAuth) (*dashboardAuth, error) {
+	a := &dashboardAuth{
+		sessionDuration: cfg.SessionDuration,
+		key:             make([]byte, 32),
+	}
+
+	switch {
+	case cfg.OIDC != nil:
+		a.oidc = newOIDCProvider(cfg.OIDC)
+	case cfg.HtpasswdFile != "":
+		var err error
+		a.users, err = loadHtpasswd(cfg.HtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		a.users = map[string]string{cfg.Username: cfg.Password}
+	}
+
+	_, err := rand.Read(a.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session key: %w", err)
+	}
+
+	a.dummyHash, err = bcrypt.GenerateFromPassword(a.key, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate hash: %w", err)
+	}
+
+	return a, nil
+}
+
+// loadHtpasswd loads users from a htpasswd file
+// Only bcrypt hashes are supported, as other formats supported by htpasswd are insecure
+func loadHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open htpasswd file: %w", err)
+	}
+	defer f.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			return nil, errors.New("htpasswd file contains an invalid line")
+		}
+		if !isBcryptHash(hash) {
+			return nil, fmt.Errorf("password for user '%s' in the htpasswd file is not hashed with bcrypt", username)
+		}
+		users[username] = hash
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+
+	if len(users) == 0 {
+		return nil, errors.New("htpasswd file does not contain any user")
+	}
+	return users, nil
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// checkCredentials returns true if the username and password are valid
+func (a *dashboardAuth) checkCredentials(username string, password string) bool {
+	expected, ok := a.users[username]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return false
+	}
+
+	if isBcryptHash(expected) {
+		return bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// newSession returns a signed session token for the user
+func (a *dashboardAuth) newSession(username string, now time.Time) string {
+	return a.encodeSigned(tokenPurposeSession, sessionPayload{
+		Username: username,
+		Expires:  now.Add(a.sessionDuration).Unix(),
+	})
+}
+
+// validateSession returns the username from a session token, if it's valid and not expired
+func (a *dashboardAuth) validateSession(token string, now time.Time) (string, bool) {
+	var payload sessionPayload
+	if !a.decodeSigned(tokenPurposeSession, token, &payload) || payload.Username == "" || now.Unix() >= payload.Expires {
+		return "", false
+	}
+
+	// Sessions of users that were removed are not valid
+	// This doesn't apply to users logging in with OIDC, who are not known in advance
+	if a.oidc == nil {
+		_, ok := a.users[payload.Username]
+		if !ok {
+			return "", false
+		}
+	}
+
+	return payload.Username, true
+}
+
+// encodeSigned encodes the payload as JSON and signs it for the given purpose
+func (a *dashboardAuth) encodeSigned(purpose string, payload any) string {
+	data, _ := json.Marshal(payload)
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(purpose, encoded))
+}
+
+// decodeSigned verifies the signature of a token created with encodeSigned, and decodes its payload
+func (a *dashboardAuth) decodeSigned(purpose string, token string, dest any) bool {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(sigBytes, a.sign(purpose, encoded)) {
+		return false
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, dest) == nil
+}
+
+func (a *dashboardAuth) sign(purpose string, data string) []byte {
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(purpose + ":" + data))
+	return h.Sum(nil)
+}
+
+// authenticate returns the user that made the request, using the session cookie
+// Alternatively, clients can pass HTTP Basic credentials or, with OIDC, an ID token as bearer token
+func (a *dashboardAuth) authenticate(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err == nil {
+		username, ok := a.validateSession(cookie.Value, time.Now())
+		if ok {
+			return username, true
+		}
+	}
+
+	if a.oidc != nil {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return "", false
+		}
+		username, err := a.oidc.verifyToken(r.Context(), token, "")
+		if err != nil {
+			logger().DebugContext(r.Context(), "Invalid bearer token", slog.Any("error", err))
+			return "", false
+		}
+		return username, true
+	}
+
+	username, password, ok := r.BasicAuth()
+	if ok && a.checkCredentials(username, password) {
+		return username, true
+	}
+
+	return "", false
+}
+
+// MiddlewareRequireLogin returns a middleware that allows requests only from users who are logged in
+// If redirect is true, other requests are redirected to the login page; otherwise, they receive an error
+func (a *dashboardAuth) MiddlewareRequireLogin(redirect bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := a.authenticate(r)
+			if ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if redirect {
+				// With OIDC, users are sent to the identity provider right away
+				path := loginPath
+				if a.oidc != nil {
+					path = oidcLoginPath
+				}
+				basePath := getBasePath(r.Context())
+				http.Redirect(w, r, basePath+path+"?next="+url.QueryEscape(basePath+r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			errLoginRequired.WriteResponse(r.Context(), w)
+		})
+	}
+}
+
+// handleLoginPage is the handler for the route that shows the login page
+func (a *dashboardAuth) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	a.renderLoginPage(w, r, http.StatusOK, "")
+}
+
+// handleLogin is the handler for the route that processes the login form
+func (a *dashboardAuth) handleLogin(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		a.renderLoginPage(w, r, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	username := r.PostForm.Get("username")
+	if !a.checkCredentials(username, r.PostForm.Get("password")) {
+		logger().WarnContext(r.Context(), "Failed dashboard login", slog.String("username", username), slog.String("remoteAddr", r.RemoteAddr))
+		a.renderLoginPage(w, r, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+
+	a.startSession(w, r, username, r.PostForm.Get("next"))
+}
+
+// startSession sets the session cookie for the user, and redirects to the next page
+func (a *dashboardAuth) startSession(w http.ResponseWriter, r *http.Request, username string, next string) {
+	now := time.Now()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    a.newSession(username, now),
+		Path:     getBasePath(r.Context()) + "/",
+		Expires:  now.Add(a.sessionDuration),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	logger().InfoContext(r.Context(), "User logged into the dashboard", slog.String("username", username))
+	http.Redirect(w, r, safeRedirectPath(r.Context(), next), http.StatusSeeOther)
+}
+
+// handleOIDCLogin is the handler for the route that starts a login with OIDC, redirecting to the identity provider
+func (a *dashboardAuth) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := a.oidc.authCodeURL(r.Context(), a.oidc.redirectURL(r), safeRedirectPath(r.Context(), r.URL.Query().Get("next")))
+	if err != nil {
+		logger().ErrorContext(r.Context(), "Failed to start login with OIDC", slog.Any("error", err))
+		a.renderLoginPage(w, r, http.StatusBadGateway, "The identity provider is not available")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    a.encodeSigned(tokenPurposeOIDCState, state),
+		Path:     getBasePath(r.Context()) + oidcLoginPath,
+		MaxAge:   int(oidcStateDuration / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleOIDCCallback is the handler for the route the identity provider redirects users to after logging in
+func (a *dashboardAuth) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	// The state cookie can only be used once
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     getBasePath(r.Context()) + oidcLoginPath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		logger().WarnContext(r.Context(), "Identity provider returned an error", slog.String("error", q.Get("error")), slog.String("description", q.Get("error_description")))
+		a.renderLoginPage(w, r, http.StatusUnauthorized, "Single sign-on failed")
+		return
+	}
+
+	var state oidcState
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil || !a.decodeSigned(tokenPurposeOIDCState, cookie.Value, &state) || state.State == "" || time.Now().Unix() >= state.Expires ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(q.Get("state"))) != 1 {
+		a.renderLoginPage(w, r, http.StatusBadRequest, "The login session is invalid or expired; please try again")
+		return
+	}
+
+	idToken, err := a.oidc.exchangeCode(r.Context(), q.Get("code"), a.oidc.redirectURL(r), state.Verifier)
+	if err != nil {
+		logger().WarnContext(r.Context(), "Failed to complete login with OIDC", slog.Any("error", err))
+		a.renderLoginPage(w, r, http.StatusUnauthorized, "Single sign-on failed")
+		return
+	}
+
+	username, err := a.oidc.verifyToken(r.Context(), idToken, state.Nonce)
+	if errors.Is(err, errOIDCGroupNotAllowed) {
+		logger().WarnContext(r.Context(), "User is not allowed to log into the dashboard", slog.Any("error", err))
+		a.renderLoginPage(w, r, http.StatusForbidden, "You are not allowed to access the dashboard")
+		return
+	} else if err != nil {
+		logger().WarnContext(r.Context(), "Failed to complete login with OIDC", slog.Any("error", err))
+		a.renderLoginPage(w, r, http.StatusUnauthorized, "Single sign-on failed")
+		return
+	}
+
+	a.startSession(w, r, username, state.Next)
+}
+
+// handleLogout is the handler for the route that ends the login session
+func (a *dashboardAuth) handleLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     getBasePath(r.Context()) + "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, getBasePath(r.Context())+loginPath, http.StatusSeeOther)
+}
+
+// safeRedirectPath returns the path to redirect to after logging in
+// Only local paths are allowed, to prevent open redirects; otherwise, the path of the dashboard is returned
+func safeRedirectPath(ctx context.Context, next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return getBasePath(ctx) + "/"
+	}
+	return next
+}
+
+var loginPageTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Log in - ddup</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f4f4f5; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; }
+form { background: #fff; padding: 2rem; border-radius: 0.5rem; box-shadow: 0 1px 3px rgba(0,0,0,0.1); width: 100%; max-width: 20rem; }
+h1 { font-size: 1.25rem; margin: 0 0 1.5rem; }
+label { display: block; font-size: 0.875rem; margin-bottom: 0.25rem; }
+input { display: block; width: 100%; box-sizing: border-box; padding: 0.5rem; margin-bottom: 1rem; border: 1px solid #d4d4d8; border-radius: 0.25rem; }
+button, .button { display: block; width: 100%; box-sizing: border-box; padding: 0.5rem; border: 0; border-radius: 0.25rem; background: #18181b; color: #fff; cursor: pointer; font-size: 0.875rem; text-align: center; text-decoration: none; }
+.error { color: #b91c1c; font-size: 0.875rem; margin-bottom: 1rem; }
+</style>
+</head>
+<body>
+<form method="post" action="{{.BasePath}}/login">
+<h1>ddup</h1>
+{{if .Error}}<div class="error">{{.Error}}</div>{{end}}
+{{if .OIDC}}
+<a class="button" href="{{.BasePath}}/login/oidc?next={{.Next}}">Log in with single sign-on</a>
+{{else}}
+<input type="hidden" name="next" value="{{.Next}}">
+<label for="username">Username</label>
+<input id="username" name="username" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit">Log in</button>
+{{end}}
+</form>
+</body>
+</html>
+`))
+
+func (a *dashboardAuth) renderLoginPage(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	next := r.URL.Query().Get("next")
+	if r.Method == http.MethodPost {
+		next = r.PostForm.Get("next")
+	}
+
+	w.Header().Set(headerContentType, "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := loginPageTemplate.Execute(w, struct {
+		Error    string
+		Next     string
+		OIDC     bool
+		BasePath string
+	}{
+		Error:    errMsg,
+		Next:     safeRedirectPath(r.Context(), next),
+		OIDC:     a.oidc != nil,
+		BasePath: getBasePath(r.Context()),
+	})
+	if err != nil {
+		logger().WarnContext(r.Context(), "Error rendering login page", slog.Any("error", err))
+	}
+}
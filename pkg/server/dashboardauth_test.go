@@ -0,0 +1,211 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestDashboardAuthCredentials(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	t.Run("Plain text password", func(t *testing.T) {
+		a, err := newDashboardAuth(&config.ConfigDashboardAuth{Username: "admin", Password: "s3cret"})
+		require.NoError(t, err)
+
+		assert.True(t, a.checkCredentials("admin", "s3cret"))
+		assert.False(t, a.checkCredentials("admin", "nope"))
+		assert.False(t, a.checkCredentials("other", "s3cret"))
+	})
+
+	t.Run("Hashed password", func(t *testing.T) {
+		a, err := newDashboardAuth(&config.ConfigDashboardAuth{Username: "admin", Password: string(hash)})
+		require.NoError(t, err)
+
+		assert.True(t, a.checkCredentials("admin", "s3cret"))
+		assert.False(t, a.checkCredentials("admin", string(hash)))
+	})
+
+	t.Run("htpasswd file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "htpasswd")
+		require.NoError(t, os.WriteFile(path, []byte("# Users\nalice:"+string(hash)+"\n\nbob:"+string(hash)+"\n"), 0o600))
+
+		a, err := newDashboardAuth(&config.ConfigDashboardAuth{HtpasswdFile: path})
+		require.NoError(t, err)
+
+		assert.True(t, a.checkCredentials("alice", "s3cret"))
+		assert.True(t, a.checkCredentials("bob", "s3cret"))
+		assert.False(t, a.checkCredentials("carol", "s3cret"))
+	})
+
+	t.Run("htpasswd file with unsupported hash", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "htpasswd")
+		require.NoError(t, os.WriteFile(path, []byte("alice:$apr1$abc$def\n"), 0o600))
+
+		_, err := newDashboardAuth(&config.ConfigDashboardAuth{HtpasswdFile: path})
+		require.ErrorContains(t, err, "password for user 'alice' in the htpasswd file is not hashed with bcrypt")
+	})
+}
+
+func TestDashboardAuthSession(t *testing.T) {
+	a, err := newDashboardAuth(&config.ConfigDashboardAuth{Username: "admin", Password: "s3cret", SessionDuration: time.Hour})
+	require.NoError(t, err)
+
+	now := time.Now()
+	token := a.newSession("admin", now)
+
+	username, ok := a.validateSession(token, now.Add(59*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, "admin", username)
+
+	_, ok = a.validateSession(token, now.Add(time.Hour))
+	assert.False(t, ok, "session should be expired")
+
+	_, ok = a.validateSession("x"+token, now)
+	assert.False(t, ok, "tampered session should not be valid")
+
+	_, ok = a.validateSession(a.newSession("removed", now), now)
+	assert.False(t, ok, "session of unknown users should not be valid")
+
+	// Sessions signed by another server are not valid
+	other, err := newDashboardAuth(&config.ConfigDashboardAuth{Username: "admin", Password: "s3cret", SessionDuration: time.Hour})
+	require.NoError(t, err)
+	_, ok = other.validateSession(token, now)
+	assert.False(t, ok)
+}
+
+func TestDashboardAuthLogin(t *testing.T) {
+	a, err := newDashboardAuth(&config.ConfigDashboardAuth{Username: "admin", Password: "s3cret", SessionDuration: time.Hour})
+	require.NoError(t, err)
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	login := func(t *testing.T, username, password, next string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		form := url.Values{"username": {username}, "password": {password}, "next": {next}}
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, loginPath, strings.NewReader(form.Encode()))
+		req.Header.Set(headerContentType, "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		a.handleLogin(rec, req)
+		return rec
+	}
+
+	t.Run("Login page", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, loginPath+"?next=%2Fdomains", nil)
+		rec := httptest.NewRecorder()
+		a.handleLoginPage(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `name="next" value="/domains"`)
+	})
+
+	t.Run("Successful login", func(t *testing.T) {
+		rec := login(t, "admin", "s3cret", "/domains")
+		assert.Equal(t, http.StatusSeeOther, rec.Code)
+		assert.Equal(t, "/domains", rec.Header().Get("Location"))
+
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, sessionCookieName, cookies[0].Name)
+		assert.True(t, cookies[0].HttpOnly)
+
+		// The session cookie allows accessing protected routes
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status", nil)
+		req.AddCookie(cookies[0])
+		rec = httptest.NewRecorder()
+		Use(okHandler, a.MiddlewareRequireLogin(false)).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("Failed login", func(t *testing.T) {
+		rec := login(t, "admin", "nope", "/")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, rec.Result().Cookies())
+		assert.Contains(t, rec.Body.String(), "Invalid username or password")
+	})
+
+	t.Run("Redirects only to local paths", func(t *testing.T) {
+		for _, next := range []string{"https://evil.example.com", "//evil.example.com", `/\evil.example.com`, ""} {
+			rec := login(t, "admin", "s3cret", next)
+			assert.Equal(t, "/", rec.Header().Get("Location"), next)
+		}
+	})
+
+	t.Run("Basic auth", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status", nil)
+		req.SetBasicAuth("admin", "s3cret")
+		rec := httptest.NewRecorder()
+		Use(okHandler, a.MiddlewareRequireLogin(false)).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("Not logged in", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status", nil)
+		rec := httptest.NewRecorder()
+		Use(okHandler, a.MiddlewareRequireLogin(false)).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/domains?x=1", nil)
+		rec = httptest.NewRecorder()
+		Use(okHandler, a.MiddlewareRequireLogin(true)).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusFound, rec.Code)
+		assert.Equal(t, "/login?next=%2Fdomains%3Fx%3D1", rec.Header().Get("Location"))
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/logout", nil)
+		rec := httptest.NewRecorder()
+		a.handleLogout(rec, req)
+
+		assert.Equal(t, http.StatusSeeOther, rec.Code)
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, sessionCookieName, cookies[0].Name)
+		assert.Equal(t, -1, cookies[0].MaxAge)
+	})
+	t.Run("Base path", func(t *testing.T) {
+		withBasePath := func(h http.Handler) http.Handler {
+			return MiddlewareBasePath("/ddup")(h)
+		}
+
+		// Users who aren't logged in are redirected to the login page under the base path, and back to the full path
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/ddup/domains", nil)
+		rec := httptest.NewRecorder()
+		withBasePath(Use(okHandler, a.MiddlewareRequireLogin(true))).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusFound, rec.Code)
+		assert.Equal(t, "/ddup/login?next=%2Fddup%2Fdomains", rec.Header().Get("Location"))
+
+		// The login form is posted under the base path
+		req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/ddup/login", nil)
+		rec = httptest.NewRecorder()
+		withBasePath(http.HandlerFunc(a.handleLoginPage)).ServeHTTP(rec, req)
+		assert.Contains(t, rec.Body.String(), `action="/ddup/login"`)
+		assert.Contains(t, rec.Body.String(), `name="next" value="/ddup/"`)
+
+		// The session cookie is scoped to the base path
+		form := url.Values{"username": {"admin"}, "password": {"s3cret"}}
+		req = httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/ddup/login", strings.NewReader(form.Encode()))
+		req.Header.Set(headerContentType, "application/x-www-form-urlencoded")
+		rec = httptest.NewRecorder()
+		withBasePath(http.HandlerFunc(a.handleLogin)).ServeHTTP(rec, req)
+		assert.Equal(t, "/ddup/", rec.Header().Get("Location"))
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "/ddup/", cookies[0].Path)
+	})
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+// handleDomainPause is the handler for the route that pauses health checks and DNS updates for a domain
+func (s *Server) handleDomainPause(w http.ResponseWriter, r *http.Request) {
+	s.setDomainPaused(w, r, true)
+}
+
+// handleDomainResume is the handler for the route that resumes a paused domain
+func (s *Server) handleDomainResume(w http.ResponseWriter, r *http.Request) {
+	s.setDomainPaused(w, r, false)
+}
+
+func (s *Server) setDomainPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if s.pauser == nil {
+		errDomainPauseDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	domain := r.PathValue("recordname")
+
+	err := s.pauser.SetDomainPaused(domain, paused)
+	switch {
+	case errors.Is(err, healthcheck.ErrDomainNotFound):
+		errStatusDomainNotFound.WriteResponse(r.Context(), w)
+		return
+	case err != nil:
+		errDomainPause.WriteResponse(r.Context(), w)
+		return
+	}
+
+	logger().InfoContext(r.Context(), "Domain paused state changed via API", "domain", domain, "paused", paused)
+
+	// Respond with the updated status of the domain, if available
+	s.respondWithDomainStatus(w, r, domain)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+type mockDomainPauser struct {
+	err    error
+	domain string
+	paused bool
+}
+
+func (m *mockDomainPauser) SetDomainPaused(domain string, paused bool) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.domain = domain
+	m.paused = paused
+	return nil
+}
+
+func TestHandleDomainPause(t *testing.T) {
+	doRequest := func(t *testing.T, s *Server, action string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/domains/{recordname}/pause", s.handleDomainPause)
+		mux.HandleFunc("POST /api/domains/{recordname}/resume", s.handleDomainResume)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/domains/app.example.com/"+action, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Pause", func(t *testing.T) {
+		pauser := &mockDomainPauser{}
+		s := &Server{pauser: pauser}
+
+		rec := doRequest(t, s, "pause")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "app.example.com", pauser.domain)
+		assert.True(t, pauser.paused)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		pauser := &mockDomainPauser{paused: true}
+		s := &Server{pauser: pauser}
+
+		rec := doRequest(t, s, "resume")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.False(t, pauser.paused)
+	})
+
+	t.Run("Domain not found", func(t *testing.T) {
+		s := &Server{pauser: &mockDomainPauser{err: healthcheck.ErrDomainNotFound}}
+
+		rec := doRequest(t, s, "pause")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), errStatusDomainNotFound.Code)
+	})
+
+	t.Run("Other errors", func(t *testing.T) {
+		s := &Server{pauser: &mockDomainPauser{err: errors.New("simulated")}}
+
+		rec := doRequest(t, s, "pause")
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("Pausing disabled", func(t *testing.T) {
+		s := &Server{}
+
+		rec := doRequest(t, s, "pause")
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
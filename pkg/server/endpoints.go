@@ -0,0 +1,48 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+// handleEndpointDrain is the handler for the route that administratively removes an endpoint from DNS
+func (s *Server) handleEndpointDrain(w http.ResponseWriter, r *http.Request) {
+	s.setEndpointDrained(w, r, true)
+}
+
+// handleEndpointUndrain is the handler for the route that restores a drained endpoint
+func (s *Server) handleEndpointUndrain(w http.ResponseWriter, r *http.Request) {
+	s.setEndpointDrained(w, r, false)
+}
+
+func (s *Server) setEndpointDrained(w http.ResponseWriter, r *http.Request, drained bool) {
+	if s.drainer == nil {
+		errEndpointDrainDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	domain := r.PathValue("domain")
+	ip := r.PathValue("ip")
+
+	err := s.drainer.SetEndpointDrained(domain, ip, drained)
+	switch {
+	case errors.Is(err, healthcheck.ErrDomainNotFound):
+		errStatusDomainNotFound.WriteResponse(r.Context(), w)
+		return
+	case errors.Is(err, healthcheck.ErrEndpointNotFound):
+		errEndpointNotFound.
+			Clone(withMetadata(map[string]string{"domain": domain, "ip": ip})).
+			WriteResponse(r.Context(), w)
+		return
+	case err != nil:
+		errEndpointDrain.WriteResponse(r.Context(), w)
+		return
+	}
+
+	logger().InfoContext(r.Context(), "Endpoint drain state changed via API", "domain", domain, "ip", ip, "drained", drained)
+
+	// Respond with the updated status of the domain, if available
+	s.respondWithDomainStatus(w, r, domain)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+type mockEndpointDrainer struct {
+	err     error
+	domain  string
+	ip      string
+	drained bool
+}
+
+func (m *mockEndpointDrainer) SetEndpointDrained(domain string, ip string, drained bool) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.domain = domain
+	m.ip = ip
+	m.drained = drained
+	return nil
+}
+
+func TestHandleEndpointDrain(t *testing.T) {
+	doRequest := func(t *testing.T, s *Server, action string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/endpoints/{domain}/{ip}/drain", s.handleEndpointDrain)
+		mux.HandleFunc("POST /api/endpoints/{domain}/{ip}/undrain", s.handleEndpointUndrain)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/endpoints/app.example.com/10.0.0.1/"+action, nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Drain", func(t *testing.T) {
+		drainer := &mockEndpointDrainer{}
+		s := &Server{drainer: drainer}
+
+		rec := doRequest(t, s, "drain")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "app.example.com", drainer.domain)
+		assert.Equal(t, "10.0.0.1", drainer.ip)
+		assert.True(t, drainer.drained)
+	})
+
+	t.Run("Undrain", func(t *testing.T) {
+		drainer := &mockEndpointDrainer{drained: true}
+		s := &Server{drainer: drainer}
+
+		rec := doRequest(t, s, "undrain")
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "10.0.0.1", drainer.ip)
+		assert.False(t, drainer.drained)
+	})
+
+	t.Run("Domain not found", func(t *testing.T) {
+		s := &Server{drainer: &mockEndpointDrainer{err: healthcheck.ErrDomainNotFound}}
+
+		rec := doRequest(t, s, "drain")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), errStatusDomainNotFound.Code)
+	})
+
+	t.Run("Endpoint not found", func(t *testing.T) {
+		s := &Server{drainer: &mockEndpointDrainer{err: healthcheck.ErrEndpointNotFound}}
+
+		rec := doRequest(t, s, "drain")
+		require.Equal(t, http.StatusNotFound, rec.Code)
+
+		var res apiError
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, errEndpointNotFound.Code, res.Code)
+		assert.Equal(t, "10.0.0.1", res.Metadata["ip"])
+	})
+
+	t.Run("Other errors", func(t *testing.T) {
+		s := &Server{drainer: &mockEndpointDrainer{err: errors.New("simulated")}}
+
+		rec := doRequest(t, s, "drain")
+		require.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("Draining disabled", func(t *testing.T) {
+		s := &Server{}
+
+		rec := doRequest(t, s, "drain")
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
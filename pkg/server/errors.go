@@ -8,7 +8,40 @@ import (
 
 var (
 	errStatusRecordNameEmpty = newApiError("api_status_recordname_empty", http.StatusBadRequest, "Parameter record name is empty")
+	errStatusHealthyInvalid  = newApiError("api_status_healthy_invalid", http.StatusBadRequest, "Parameter healthy must be 'true' or 'false'")
+	errStatusNameInvalid     = newApiError("api_status_name_invalid", http.StatusBadRequest, "Parameter name is not a valid glob pattern")
+	errStatusSortInvalid     = newApiError("api_status_sort_invalid", http.StatusBadRequest, "Parameter sort must be 'name', 'provider', 'lastUpdated', or 'healthy', optionally prefixed with '-'")
+	errStatusLimitInvalid    = newApiError("api_status_limit_invalid", http.StatusBadRequest, "Parameter limit must be a positive integer")
+	errStatusOffsetInvalid   = newApiError("api_status_offset_invalid", http.StatusBadRequest, "Parameter offset must be a non-negative integer")
 	errStatusDomainNotFound  = newApiError("api_status_domain_notfound", http.StatusNotFound, "Domain not found in the configuration")
+	errConfigBodyTooLarge    = newApiError("api_config_body_too_large", http.StatusRequestEntityTooLarge, "Configuration document is too large")
+	errConfigBodyRead        = newApiError("api_config_body_read", http.StatusBadRequest, "Failed to read the configuration document from the request body")
+	errConfigFileRead        = newApiError("api_config_file_read", http.StatusInternalServerError, "Failed to read the configuration file")
+	errConfigFileWrite       = newApiError("api_config_file_write", http.StatusInternalServerError, "Failed to write the configuration file")
+	errConfigReload          = newApiError("api_config_reload", http.StatusInternalServerError, "Failed to apply the new configuration; the previous configuration file was restored")
+	errConfigReloadDisabled  = newApiError("api_config_reload_disabled", http.StatusServiceUnavailable, "Configuration reloading is not available")
+	errEndpointNotFound      = newApiError("api_endpoint_notfound", http.StatusNotFound, "Endpoint not found in the domain")
+	errEndpointDrain         = newApiError("api_endpoint_drain", http.StatusInternalServerError, "Failed to update the drain state of the endpoint")
+	errEndpointDrainDisabled = newApiError("api_endpoint_drain_disabled", http.StatusServiceUnavailable, "Draining endpoints is not available")
+	errCheck                 = newApiError("api_check", http.StatusInternalServerError, "Failed to run the health checks")
+	errCheckDisabled         = newApiError("api_check_disabled", http.StatusServiceUnavailable, "Running health checks on demand is not available")
+	errSync                  = newApiError("api_sync", http.StatusBadGateway, "Failed to update the DNS records")
+	errSyncNoHealthy         = newApiError("api_sync_no_healthy", http.StatusConflict, "The domain has no healthy endpoints, so the DNS records were not updated")
+	errSyncPaused            = newApiError("api_sync_paused", http.StatusConflict, "The domain is paused; resume it before syncing the DNS records")
+	errSyncNotLeader         = newApiError("api_sync_not_leader", http.StatusConflict, "This replica is not the leader, so it does not update the DNS records; send the request to the leader")
+	errDomainPause           = newApiError("api_domain_pause", http.StatusInternalServerError, "Failed to update the paused state of the domain")
+	errDomainPauseDisabled   = newApiError("api_domain_pause_disabled", http.StatusServiceUnavailable, "Pausing domains is not available")
+	errObservationsDisabled  = newApiError("api_observations_disabled", http.StatusServiceUnavailable, "Health observations are not available")
+	errRecordsExportDisabled = newApiError("api_records_export_disabled", http.StatusServiceUnavailable, "Exporting the state of the records is not available")
+	errRecordsFormatInvalid  = newApiError("api_records_format_invalid", http.StatusBadRequest, "Parameter format must be 'json' or 'csv'")
+	errAgentReportInvalid    = newApiError("api_agent_report_invalid", http.StatusBadRequest, "The report in the request body is invalid")
+	errPublicStatusDisabled  = newApiError("api_public_status_disabled", http.StatusForbidden, "The public status is not enabled")
+	errAgentsDisabled        = newApiError("api_agents_disabled", http.StatusForbidden, "Remote checker agents are not enabled")
+	errNotReady              = newApiError("api_not_ready", http.StatusServiceUnavailable, "The service is not ready; the metadata contains the domains that are not ready")
+	errAuthRequired          = newApiError("api_auth_required", http.StatusUnauthorized, "Missing or invalid API token")
+	errLoginRequired         = newApiError("api_login_required", http.StatusUnauthorized, "Log into the dashboard to access this resource")
+	errTokenReadOnly         = newApiError("api_token_readonly", http.StatusForbidden, "The API token only allows reading the status")
+	errAdminDisabled         = newApiError("api_admin_disabled", http.StatusForbidden, "Administrative endpoints are disabled because no API token is configured")
 )
 
 type apiError struct {
@@ -16,6 +49,8 @@ type apiError struct {
 	Message    string            `json:"message"`
 	InnerError error             `json:"innerError,omitempty"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
+	// ID of the request, for correlating the response with logs
+	RequestID string `json:"requestId,omitempty"`
 
 	httpStatus int
 }
@@ -30,6 +65,8 @@ func newApiError(code string, httpStatus int, message string) *apiError {
 }
 
 func (e apiError) WriteResponse(ctx context.Context, w http.ResponseWriter) {
+	e.RequestID = getRequestID(ctx)
+
 	w.Header().Add(headerContentType, jsonContentType)
 	w.WriteHeader(e.httpStatus)
 
@@ -59,7 +96,6 @@ func withInnerError(innerError error) func(*apiError) {
 	}
 }
 
-//nolint:unused
 func withMetadata(metadata map[string]string) func(*apiError) {
 	return func(e *apiError) {
 		e.Metadata = metadata
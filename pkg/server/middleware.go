@@ -1,6 +1,29 @@
 package server
 
-import "net/http"
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/italypaleale/ddup/pkg/logging"
+)
+
+const (
+	// Header that contains the ID of the request
+	headerRequestID = "X-Request-Id"
+	// Maximum length of request IDs sent by clients
+	maxRequestIDLength = 128
+)
+
+// requestIDContextKey is the key for the request ID in the context
+type requestIDContextKey struct{}
+
+// basePathContextKey is the key for the base path in the context
+type basePathContextKey struct{}
 
 // Middleware type is a function that takes an http.Handler and returns another http.Handler
 type Middleware func(next http.Handler) http.Handler
@@ -14,11 +37,109 @@ func Use(h http.Handler, middlewares ...Middleware) http.Handler {
 }
 
 // MiddlewareMaxBodySize is a middleware that limits the size of the request body
+// If the body was limited by MiddlewareDefaultMaxBodySize, this limit replaces the default one
 func MiddlewareMaxBodySize(maxSize int64) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+			body := r.Body
+			dl, ok := body.(*defaultLimitBody)
+			if ok {
+				body = dl.original
+			}
+			r.Body = http.MaxBytesReader(w, body, maxSize)
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// MiddlewareDefaultMaxBodySize is a middleware that sets the default limit for the size of the request body
+// Individual routes can override the limit with MiddlewareMaxBodySize
+func MiddlewareDefaultMaxBodySize(maxSize int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = &defaultLimitBody{
+				ReadCloser: http.MaxBytesReader(w, r.Body, maxSize),
+				original:   r.Body,
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// defaultLimitBody is the body of a request limited by MiddlewareDefaultMaxBodySize
+type defaultLimitBody struct {
+	io.ReadCloser
+
+	original io.ReadCloser
+}
+
+// MiddlewareBasePath is a middleware that serves the handler under a base path, such as "/ddup"
+// The base path is removed from the path of requests, and it's stored in the context so it can be added back to the URLs in responses.
+// Requests outside of the base path receive a 404 response, and requests for the base path without a trailing slash are redirected.
+func MiddlewareBasePath(basePath string) Middleware {
+	return func(next http.Handler) http.Handler {
+		stripped := http.StripPrefix(basePath, next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == basePath:
+				target := basePath + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+			case strings.HasPrefix(r.URL.Path, basePath+"/"):
+				ctx := context.WithValue(r.Context(), basePathContextKey{}, basePath)
+				stripped.ServeHTTP(w, r.WithContext(ctx))
+			default:
+				http.NotFound(w, r)
+			}
+		})
+	}
+}
+
+// getBasePath returns the base path the server is served under, from the context, or an empty string if not set
+func getBasePath(ctx context.Context) string {
+	basePath, _ := ctx.Value(basePathContextKey{}).(string)
+	return basePath
+}
+
+// MiddlewareRequestID is a middleware that assigns an ID to each request, which is returned in the response headers and included in logs and error responses
+// If the request includes a valid ID in the X-Request-Id header, such as one set by a proxy, that is used; otherwise, a new one is generated
+func MiddlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(headerRequestID)
+		if !isValidRequestID(id) {
+			id = uuid.New().String()
+			r.Header.Set(headerRequestID, id)
+		}
+
+		w.Header().Set(headerRequestID, id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+		ctx = logging.ContextWithAttrs(ctx, slog.String("requestId", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getRequestID returns the ID of the request from the context, or an empty string if not set
+func getRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// isValidRequestID returns true if the request ID sent by a client can be used
+// IDs must not be too long and can contain only letters, digits, and a few symbols, so they are safe to include in logs
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+			// All good
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -374,3 +374,139 @@ func TestMiddlewareMaxBodySize(t *testing.T) {
 		assert.Equal(t, "test", rec2.Header().Get("X-Integration")) // Header middleware should still run
 	})
 }
+
+func TestMiddlewareDefaultMaxBodySize(t *testing.T) {
+	// Handler that reads the body
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body) //nolint:errcheck
+	})
+
+	t.Run("Default limit applies", func(t *testing.T) {
+		wrappedHandler := Use(handler, MiddlewareDefaultMaxBodySize(10))
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader(strings.Repeat("a", 20)))
+		rec := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("Route limit replaces default", func(t *testing.T) {
+		// The route-level middleware is applied inside the default one
+		wrappedHandler := Use(
+			Use(handler, MiddlewareMaxBodySize(50)),
+			MiddlewareDefaultMaxBodySize(10),
+		)
+
+		body := strings.Repeat("a", 20)
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, body, rec.Body.String())
+
+		// Bodies above the route limit are still rejected
+		req = httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/", strings.NewReader(strings.Repeat("a", 60)))
+		rec = httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	var gotID string
+	handler := Use(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = getRequestID(r.Context())
+		errStatusDomainNotFound.WriteResponse(r.Context(), w)
+	}), MiddlewareRequestID)
+
+	doRequest := func(t *testing.T, id string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status/x", nil)
+		if id != "" {
+			req.Header.Set(headerRequestID, id)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Generates an ID", func(t *testing.T) {
+		rec := doRequest(t, "")
+		id := rec.Header().Get(headerRequestID)
+		assert.Len(t, id, 36)
+		assert.Equal(t, id, gotID)
+		assert.Contains(t, rec.Body.String(), `"requestId":"`+id+`"`)
+
+		// Each request has a different ID
+		assert.NotEqual(t, id, doRequest(t, "").Header().Get(headerRequestID))
+	})
+
+	t.Run("Uses the ID from the request", func(t *testing.T) {
+		rec := doRequest(t, "proxy-1234.abc")
+		assert.Equal(t, "proxy-1234.abc", rec.Header().Get(headerRequestID))
+		assert.Equal(t, "proxy-1234.abc", gotID)
+		assert.Contains(t, rec.Body.String(), `"requestId":"proxy-1234.abc"`)
+	})
+
+	t.Run("Replaces invalid IDs", func(t *testing.T) {
+		for _, id := range []string{"has space", "new\nline", strings.Repeat("a", maxRequestIDLength+1)} {
+			rec := doRequest(t, id)
+			assert.NotEqual(t, id, rec.Header().Get(headerRequestID))
+			assert.Len(t, rec.Header().Get(headerRequestID), 36)
+		}
+	})
+}
+
+func TestMiddlewareBasePath(t *testing.T) {
+	var gotPath, gotBasePath string
+	handler := Use(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotBasePath = getBasePath(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}), MiddlewareBasePath("/ddup"))
+
+	doRequest := func(t *testing.T, target string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		gotPath, gotBasePath = "", ""
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Strips the base path", func(t *testing.T) {
+		rec := doRequest(t, "/ddup/api/status")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "/api/status", gotPath)
+		assert.Equal(t, "/ddup", gotBasePath)
+
+		rec = doRequest(t, "/ddup/")
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "/", gotPath)
+	})
+
+	t.Run("Redirects to the trailing slash", func(t *testing.T) {
+		rec := doRequest(t, "/ddup?x=1")
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, "/ddup/?x=1", rec.Header().Get("Location"))
+	})
+
+	t.Run("Paths outside of the base path", func(t *testing.T) {
+		for _, target := range []string{"/", "/api/status", "/ddupx/api/status"} {
+			rec := doRequest(t, target)
+			assert.Equal(t, http.StatusNotFound, rec.Code, target)
+			assert.Empty(t, gotPath, target)
+		}
+	})
+}
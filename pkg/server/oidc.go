@@ -0,0 +1,426 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/tracing"
+)
+
+const (
+	// Paths of the routes for logging in with OIDC
+	oidcLoginPath    = "/login/oidc"
+	oidcCallbackPath = "/login/oidc/callback"
+	// Name of the cookie that contains the state of a login in progress
+	oidcStateCookieName = "ddup_oidc_state"
+	// Time users have to complete the login with the identity provider
+	oidcStateDuration = 10 * time.Minute
+
+	// Timeout for requests to the identity provider
+	oidcRequestTimeout = 15 * time.Second
+	// Minimum interval between refreshes of the keys, when a token is signed with an unknown key
+	jwksMinRefreshInterval = time.Minute
+)
+
+// oidcProvider authenticates users with an OpenID Connect identity provider
+type oidcProvider struct {
+	cfg    *config.ConfigOIDC
+	client *http.Client
+
+	lock sync.Mutex
+	// Metadata from the discovery document, which is loaded on first use
+	metadata *oidcMetadata
+	// Keys used to verify tokens, by key ID
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// oidcMetadata contains the properties used from the OIDC discovery document
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcState is the payload of the cookie that contains the state of a login in progress
+type oidcState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Next     string `json:"next"`
+	Expires  int64  `json:"exp"`
+}
+
+func newOIDCProvider(cfg *config.ConfigOIDC) *oidcProvider {
+	client := tracing.NewHTTPClient()
+	client.Timeout = oidcRequestTimeout
+
+	return &oidcProvider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// getMetadata returns the metadata from the discovery document, loading it if needed
+// Loading is retried on the next request if it fails, so the server can start when the identity provider is not reachable
+func (p *oidcProvider) getMetadata(ctx context.Context) (*oidcMetadata, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	md := &oidcMetadata{}
+	err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", md)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load discovery document: %w", err)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("issuer in the discovery document '%s' does not match the configured issuer", md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	p.metadata = md
+	return md, nil
+}
+
+// getKey returns the public key with the given ID
+// If the key is not known, keys are fetched again from the identity provider, as they may have been rotated
+func (p *oidcProvider) getKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	md, err := p.getMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key, ok := p.keys[kid]
+	if ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksMinRefreshInterval {
+		return nil, fmt.Errorf("token is signed with unknown key '%s'", kid)
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = p.getJSON(ctx, md.JWKSURI, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keys: %w", err)
+	}
+
+	p.keysFetched = time.Now()
+	p.keys = make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pk, err := jwk.PublicKey()
+		if err != nil {
+			// Ignore keys that are not supported
+			logger().DebugContext(ctx, "Ignoring key from OIDC provider", slog.String("kid", jwk.KeyID), slog.Any("error", err))
+			continue
+		}
+		p.keys[jwk.KeyID] = pk
+	}
+
+	key, ok = p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("token is signed with unknown key '%s'", kid)
+	}
+	return key, nil
+}
+
+// verifyToken verifies an ID token, and returns the name of the user
+// If nonce is not empty, the token must contain the same nonce
+func (p *oidcProvider) verifyToken(ctx context.Context, token string, nonce string) (string, error) {
+	md, err := p.getMetadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.getKey(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+
+	if nonce != "" {
+		tokenNonce, _ := claims["nonce"].(string)
+		if tokenNonce != nonce {
+			return "", errors.New("invalid token: nonce does not match")
+		}
+	}
+
+	if len(p.cfg.AllowedGroups) > 0 && !slices.ContainsFunc(claimStrings(claims[p.cfg.GroupsClaim]), func(g string) bool {
+		return slices.Contains(p.cfg.AllowedGroups, g)
+	}) {
+		return "", errOIDCGroupNotAllowed
+	}
+
+	// Use the most readable name available for the user
+	for _, c := range []string{"preferred_username", "email", "sub"} {
+		v, _ := claims[c].(string)
+		if v != "" {
+			return v, nil
+		}
+	}
+	return "", errors.New("invalid token: subject is missing")
+}
+
+// errOIDCGroupNotAllowed is returned when the user doesn't belong to any of the allowed groups
+var errOIDCGroupNotAllowed = errors.New("user does not belong to any of the allowed groups")
+
+// authCodeURL returns the URL to redirect users to for logging in, and the state of the login
+func (p *oidcProvider) authCodeURL(ctx context.Context, redirectURL string, next string) (string, *oidcState, error) {
+	md, err := p.getMetadata(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	state := &oidcState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+		Next:     next,
+		Expires:  time.Now().Add(oidcStateDuration).Unix(),
+	}
+	challenge := sha256.Sum256([]byte(state.Verifier))
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state.State)
+	q.Set("nonce", state.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), state, nil
+}
+
+// exchangeCode exchanges an authorization code for an ID token
+func (p *oidcProvider) exchangeCode(ctx context.Context, code string, redirectURL string, verifier string) (string, error) {
+	md, err := p.getMetadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set(headerContentType, "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request token: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("failed to parse token response (status %d): %w", res.StatusCode, err)
+	case body.Error != "":
+		return "", fmt.Errorf("failed to request token: %s: %s", body.Error, body.ErrorDescription)
+	case res.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("failed to request token: status %d", res.StatusCode)
+	case body.IDToken == "":
+		return "", errors.New("token response does not contain an ID token")
+	}
+
+	return body.IDToken, nil
+}
+
+// redirectURL returns the URL the identity provider redirects users to after logging in
+func (p *oidcProvider) redirectURL(r *http.Request) string {
+	if p.cfg.RedirectURL != "" {
+		return p.cfg.RedirectURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + getBasePath(r.Context()) + oidcCallbackPath
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, u string, dest any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid response status code: %d", res.StatusCode)
+	}
+
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(dest)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// jsonWebKey is a public key in the JWK format
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// PublicKey returns the public key
+func (k jsonWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Curve)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != size {
+			return nil, errors.New("invalid x coordinate")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil || len(y) != size {
+			return nil, errors.New("invalid y coordinate")
+		}
+
+		// Encode the point in the uncompressed format, which also validates it
+		point := make([]byte, 0, 1+2*size)
+		point = append(point, 4)
+		point = append(point, x...)
+		point = append(point, y...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.KeyType)
+	}
+}
+
+// claimStrings returns the values of a claim that can be a string or a list of strings
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		res := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+// randomString returns a random string, for use as state, nonce, or PKCE verifier
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
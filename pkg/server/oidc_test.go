@@ -0,0 +1,284 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+// testIdentityProvider is an OIDC identity provider used for testing
+type testIdentityProvider struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	// Claims added to the ID token issued by the token endpoint
+	claims jwt.MapClaims
+	// PKCE challenge from the last authorization request
+	challenge string
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &testIdentityProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if clientID != "ddup" || clientSecret != "secret" || r.PostFormValue("code") != "goodcode" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idp.token(t, idp.claims)})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+
+	return idp
+}
+
+// token returns a signed ID token with the given claims, in addition to the default ones
+func (idp *testIdentityProvider) token(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	c := jwt.MapClaims{
+		"iss": idp.srv.URL,
+		"aud": "ddup",
+		"sub": "1234",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		c[k] = v
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	tok.Header["kid"] = "key1"
+	signed, err := tok.SignedString(idp.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+
+	newAuth := func(t *testing.T, allowedGroups ...string) *dashboardAuth {
+		t.Helper()
+		a, err := newDashboardAuth(&config.ConfigDashboardAuth{
+			OIDC: &config.ConfigOIDC{
+				Issuer:        idp.srv.URL,
+				ClientID:      "ddup",
+				ClientSecret:  "secret",
+				Scopes:        []string{"openid", "profile"},
+				AllowedGroups: allowedGroups,
+				GroupsClaim:   "groups",
+			},
+			SessionDuration: time.Hour,
+		})
+		require.NoError(t, err)
+		return a
+	}
+
+	// login starts the login flow and completes it with the given authorization code
+	login := func(t *testing.T, a *dashboardAuth, code string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, oidcLoginPath+"?next=%2Fdomains", nil)
+		rec := httptest.NewRecorder()
+		a.handleOIDCLogin(rec, req)
+		require.Equal(t, http.StatusFound, rec.Code)
+
+		authURL, err := url.Parse(rec.Header().Get("Location"))
+		require.NoError(t, err)
+		q := authURL.Query()
+		assert.Equal(t, idp.srv.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+		assert.Equal(t, "ddup", q.Get("client_id"))
+		assert.Equal(t, "openid profile", q.Get("scope"))
+		assert.Equal(t, "http://example.com/login/oidc/callback", q.Get("redirect_uri"))
+		assert.Equal(t, "S256", q.Get("code_challenge_method"))
+		idp.challenge = q.Get("code_challenge")
+		idp.claims["nonce"] = q.Get("nonce")
+
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		require.Equal(t, oidcStateCookieName, cookies[0].Name)
+
+		req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, oidcCallbackPath+"?code="+code+"&state="+q.Get("state"), nil)
+		req.AddCookie(cookies[0])
+		rec = httptest.NewRecorder()
+		a.handleOIDCCallback(rec, req)
+		return rec
+	}
+
+	sessionCookie := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == sessionCookieName {
+				return c
+			}
+		}
+		return nil
+	}
+
+	t.Run("Successful login", func(t *testing.T) {
+		idp.claims = jwt.MapClaims{"preferred_username": "alice", "groups": []string{"users", "admins"}}
+		a := newAuth(t, "admins")
+
+		rec := login(t, a, "goodcode")
+		require.Equal(t, http.StatusSeeOther, rec.Code)
+		assert.Equal(t, "/domains", rec.Header().Get("Location"))
+
+		cookie := sessionCookie(rec)
+		require.NotNil(t, cookie)
+		username, ok := a.validateSession(cookie.Value, time.Now())
+		assert.True(t, ok)
+		assert.Equal(t, "alice", username)
+	})
+
+	t.Run("User not in allowed groups", func(t *testing.T) {
+		idp.claims = jwt.MapClaims{"preferred_username": "bob", "groups": "users"}
+		a := newAuth(t, "admins")
+
+		rec := login(t, a, "goodcode")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Nil(t, sessionCookie(rec))
+	})
+
+	t.Run("Invalid code", func(t *testing.T) {
+		idp.claims = jwt.MapClaims{}
+		a := newAuth(t)
+
+		rec := login(t, a, "badcode")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Nil(t, sessionCookie(rec))
+	})
+
+	t.Run("Invalid state", func(t *testing.T) {
+		a := newAuth(t)
+
+		// No state cookie
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, oidcCallbackPath+"?code=goodcode&state=abc", nil)
+		rec := httptest.NewRecorder()
+		a.handleOIDCCallback(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		// A session cookie can't be used as state cookie
+		req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, oidcCallbackPath+"?code=goodcode&state=", nil)
+		req.AddCookie(&http.Cookie{Name: oidcStateCookieName, Value: a.newSession("alice", time.Now())})
+		rec = httptest.NewRecorder()
+		a.handleOIDCCallback(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("State cookie can't be used as session", func(t *testing.T) {
+		a := newAuth(t)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, oidcLoginPath, nil)
+		rec := httptest.NewRecorder()
+		a.handleOIDCLogin(rec, req)
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+
+		_, ok := a.validateSession(cookies[0].Value, time.Now())
+		assert.False(t, ok)
+	})
+
+	t.Run("Bearer token", func(t *testing.T) {
+		a := newAuth(t, "admins")
+		okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		doRequest := func(token string) int {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			Use(okHandler, a.MiddlewareRequireLogin(false)).ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusNoContent, doRequest(idp.token(t, jwt.MapClaims{"groups": []string{"admins"}})))
+		assert.Equal(t, http.StatusUnauthorized, doRequest(idp.token(t, jwt.MapClaims{"groups": []string{"users"}})))
+		assert.Equal(t, http.StatusUnauthorized, doRequest(idp.token(t, jwt.MapClaims{"groups": []string{"admins"}, "aud": "other"})))
+		assert.Equal(t, http.StatusUnauthorized, doRequest(idp.token(t, jwt.MapClaims{"groups": []string{"admins"}, "exp": time.Now().Add(-time.Hour).Unix()})))
+	})
+
+	t.Run("Redirects to the identity provider", func(t *testing.T) {
+		a := newAuth(t)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/domains", nil)
+		rec := httptest.NewRecorder()
+		Use(http.NotFoundHandler(), a.MiddlewareRequireLogin(true)).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusFound, rec.Code)
+		assert.Equal(t, "/login/oidc?next=%2Fdomains", rec.Header().Get("Location"))
+	})
+}
+
+func TestJSONWebKey(t *testing.T) {
+	t.Run("EC key", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		require.NoError(t, err)
+		point, err := key.PublicKey.Bytes()
+		require.NoError(t, err)
+
+		pk, err := jsonWebKey{
+			KeyType: "EC",
+			Curve:   "P-384",
+			X:       base64.RawURLEncoding.EncodeToString(point[1:49]),
+			Y:       base64.RawURLEncoding.EncodeToString(point[49:]),
+		}.PublicKey()
+		require.NoError(t, err)
+		assert.True(t, key.PublicKey.Equal(pk))
+	})
+
+	t.Run("Invalid EC point", func(t *testing.T) {
+		_, err := jsonWebKey{
+			KeyType: "EC",
+			Curve:   "P-256",
+			X:       base64.RawURLEncoding.EncodeToString(make([]byte, 32)),
+			Y:       base64.RawURLEncoding.EncodeToString(make([]byte, 32)),
+		}.PublicKey()
+		require.Error(t, err)
+	})
+
+	t.Run("Unsupported key type", func(t *testing.T) {
+		_, err := jsonWebKey{KeyType: "oct"}.PublicKey()
+		require.ErrorContains(t, err, "unsupported key type 'oct'")
+	})
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/buildinfo"
+)
+
+// Path of the OpenAPI document
+const openAPIPath = "/api/openapi.json"
+
+// Descriptions of the path parameters used in the routes
+var openAPIParamDescriptions = map[string]string{
+	"recordname": "Record name of the domain, as in the configuration",
+	"domain":     "Record name of the domain, as in the configuration",
+	"ip":         "IP of the endpoint",
+}
+
+var (
+	pathParamRegexp = regexp.MustCompile(`\{([A-Za-z0-9_]+)\.{0,3}\}`)
+	timeType        = reflect.TypeFor[time.Time]()
+)
+
+// handleOpenAPI is the handler for the route that returns the OpenAPI document
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(headerContentType, jsonContentType)
+	_, _ = w.Write(s.openAPIDoc) //nolint:errcheck
+}
+
+// openAPISecurity contains the authentication methods that are enabled, which are included in the OpenAPI document
+type openAPISecurity struct {
+	// If true, read-only API tokens are configured, so routes that return the status require authentication
+	ReadProtected bool
+	// If true, users can log into the dashboard
+	DashboardLogin bool
+	// If true, users can authenticate with username and password (otherwise, with OIDC)
+	BasicAuth bool
+}
+
+// buildOpenAPIDocument returns the OpenAPI 3 document that describes the routes
+// If the server is served under a base path, it's set as the URL of the server in the document
+func buildOpenAPIDocument(routes []apiRoute, security openAPISecurity, basePath string) ([]byte, error) {
+	g := &openAPIGenerator{
+		schemas: map[string]any{},
+	}
+
+	paths := map[string]map[string]any{}
+	for _, route := range routes {
+		if paths[route.Path] == nil {
+			paths[route.Path] = map[string]any{}
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = g.operation(route, security)
+	}
+
+	// Authentication methods
+	securitySchemes := map[string]any{
+		"bearerToken": map[string]any{
+			"type":        "http",
+			"scheme":      "bearer",
+			"description": "API token, or ID token issued by the OIDC identity provider if dashboard login uses OIDC",
+		},
+	}
+	if security.DashboardLogin {
+		securitySchemes["sessionCookie"] = map[string]any{
+			"type":        "apiKey",
+			"in":          "cookie",
+			"name":        sessionCookieName,
+			"description": "Session of users logged into the dashboard",
+		}
+		if security.BasicAuth {
+			securitySchemes["basicAuth"] = map[string]any{
+				"type":   "http",
+				"scheme": "basic",
+			}
+		}
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   buildinfo.AppName,
+			"version": buildinfo.AppVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas":         g.schemas,
+			"securitySchemes": securitySchemes,
+		},
+	}
+	if basePath != "" {
+		doc["servers"] = []map[string]any{
+			{"url": basePath},
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+// openAPIGenerator builds the objects in the OpenAPI document
+type openAPIGenerator struct {
+	// Schemas of named types, which are referenced by the operations
+	schemas map[string]any
+}
+
+func (g *openAPIGenerator) operation(route apiRoute, security openAPISecurity) map[string]any {
+	op := map[string]any{
+		"operationId": route.OperationID,
+		"summary":     route.Summary,
+	}
+
+	// Path and query string parameters
+	matches := pathParamRegexp.FindAllStringSubmatch(route.Path, -1)
+	if len(matches) > 0 || len(route.QueryParams) > 0 {
+		params := make([]any, 0, len(matches)+len(route.QueryParams))
+		for _, m := range matches {
+			params = append(params, map[string]any{
+				"name":        m[1],
+				"in":          "path",
+				"required":    true,
+				"description": openAPIParamDescriptions[m[1]],
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range route.QueryParams {
+			params = append(params, map[string]any{
+				"name":        p.Name,
+				"in":          "query",
+				"required":    false,
+				"description": p.Description,
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		op["parameters"] = params
+	}
+
+	if route.Request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": g.schema(reflect.TypeOf(route.Request)),
+				},
+			},
+		}
+	}
+	if route.RequestConfigDocument {
+		op["requestBody"] = map[string]any{
+			"required":    true,
+			"description": "Configuration document, in the same format as the configuration file",
+			"content":     configDocumentContent(),
+		}
+	}
+
+	// Successful responses
+	responses := map[string]any{}
+	switch {
+	case route.ResponseConfigDocument:
+		responses["200"] = map[string]any{
+			"description": "Configuration document",
+			"content":     configDocumentContent(),
+		}
+	case route.Response != nil:
+		responses["200"] = g.jsonResponse("Successful response", route.Response)
+	default:
+		responses["204"] = map[string]any{"description": "Successful response"}
+	}
+	for status, body := range route.OtherResponses {
+		responses[strconv.Itoa(status)] = g.jsonResponse(http.StatusText(status), body)
+	}
+
+	// Error responses, including the ones related to authentication
+	errs := slices.Clone(route.Errors)
+	switch route.Access {
+	case accessRead:
+		if security.DashboardLogin {
+			errs = append(errs, errLoginRequired)
+		} else if security.ReadProtected {
+			errs = append(errs, errAuthRequired)
+		}
+	case accessAdmin:
+		errs = append(errs, errAuthRequired, errTokenReadOnly, errAdminDisabled)
+	case accessAgent:
+		errs = append(errs, errAuthRequired)
+	}
+	errsByStatus := map[int][]string{}
+	for _, e := range errs {
+		errsByStatus[e.httpStatus] = append(errsByStatus[e.httpStatus], e.Code+": "+e.Message)
+	}
+	for _, status := range slices.Sorted(maps.Keys(errsByStatus)) {
+		responses[strconv.Itoa(status)] = g.jsonResponse("Error codes:\n- "+strings.Join(errsByStatus[status], "\n- "), apiError{})
+	}
+	op["responses"] = responses
+
+	// Security requirements
+	switch {
+	case route.Access == accessAdmin || route.Access == accessAgent:
+		op["security"] = []any{map[string]any{"bearerToken": []string{}}}
+	case route.Access == accessRead && (security.ReadProtected || security.DashboardLogin):
+		requirements := []any{map[string]any{"bearerToken": []string{}}}
+		if security.DashboardLogin {
+			requirements = append(requirements, map[string]any{"sessionCookie": []string{}})
+			if security.BasicAuth {
+				requirements = append(requirements, map[string]any{"basicAuth": []string{}})
+			}
+		}
+		op["security"] = requirements
+	}
+
+	return op
+}
+
+func (g *openAPIGenerator) jsonResponse(description string, body any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{
+				"schema": g.schema(reflect.TypeOf(body)),
+			},
+		},
+	}
+}
+
+// schema returns the JSON schema for values of the type, as they are encoded by encoding/json
+// Named struct types are added to the components and referenced
+func (g *openAPIGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		// Use the name of the type with the first letter in uppercase
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		_, ok := g.schemas[name]
+		if !ok {
+			// Set a placeholder first to support recursive types
+			g.schemas[name] = nil
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.structSchema(t)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	default:
+		// Interfaces can contain any value
+		return map[string]any{}
+	}
+}
+
+func (g *openAPIGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+
+		properties[name] = g.schema(f.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	res := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		res["required"] = required
+	}
+	return res
+}
+
+// configDocumentContent returns the content types of configuration documents
+func configDocumentContent() map[string]any {
+	return map[string]any{
+		"application/yaml": map[string]any{"schema": map[string]any{"type": "string"}},
+		"application/json": map[string]any{"schema": map[string]any{"type": "string"}},
+		"application/toml": map[string]any{"schema": map[string]any{"type": "string"}},
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	// openAPIOperation contains the properties of operations that are checked in the tests
+	type openAPIOperation struct {
+		OperationID string `json:"operationId"`
+		Parameters  []struct {
+			Name        string `json:"name"`
+			In          string `json:"in"`
+			Description string `json:"description"`
+		} `json:"parameters"`
+		Responses map[string]any   `json:"responses"`
+		Security  []map[string]any `json:"security"`
+	}
+	type openAPIDocument struct {
+		OpenAPI string `json:"openapi"`
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+		Paths      map[string]map[string]openAPIOperation `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+
+	t.Run("Served by the server", func(t *testing.T) {
+		s, err := NewServer(NewServerOpts{})
+		require.NoError(t, err)
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, openAPIPath, nil)
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, jsonContentType, rec.Header().Get(headerContentType))
+
+		var doc openAPIDocument
+		err = json.Unmarshal(rec.Body.Bytes(), &doc)
+		require.NoError(t, err)
+		assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+		// All routes are in the document
+		operationIDs := map[string]bool{}
+		for _, route := range s.apiRoutes() {
+			op, ok := doc.Paths[route.Path][strings.ToLower(route.Method)]
+			require.True(t, ok, "route %s %s not in the document", route.Method, route.Path)
+			assert.Equal(t, route.OperationID, op.OperationID)
+			assert.False(t, operationIDs[op.OperationID], "duplicate operation ID %s", op.OperationID)
+			operationIDs[op.OperationID] = true
+
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					assert.Contains(t, route.Path, "{"+p.Name+"}")
+				}
+				assert.NotEmpty(t, p.Description, "parameter %s of route %s %s has no description", p.Name, route.Method, route.Path)
+			}
+			assert.Len(t, op.Parameters, strings.Count(route.Path, "{")+len(route.QueryParams))
+		}
+
+		// Security requirements
+		assert.Empty(t, doc.Paths["/api/status"]["get"].Security)
+		assert.NotContains(t, doc.Paths["/api/status"]["get"].Responses, "401")
+		assert.Len(t, doc.Paths["/api/config"]["put"].Security, 1)
+		assert.Contains(t, doc.Paths["/api/config"]["put"].Responses, "401")
+		assert.Contains(t, doc.Paths["/api/config"]["put"].Responses, "422")
+		assert.Contains(t, doc.Paths["/healthz"]["get"].Responses, "204")
+
+		// Schemas of the responses
+		status := doc.Components.Schemas["DomainStatus"]
+		assert.Equal(t, map[string]any{"type": "string", "format": "date-time"}, status.Properties["lastUpdated"])
+		assert.Equal(t, map[string]any{"$ref": "#/components/schemas/DomainStatusEndpoint"}, status.Properties["endpoints"]["items"])
+		assert.Contains(t, status.Required, "provider")
+		assert.NotContains(t, status.Required, "paused")
+		assert.Contains(t, doc.Components.Schemas, "DomainStatusEndpoint")
+		assert.Contains(t, doc.Components.Schemas, "ApiError")
+		assert.Contains(t, doc.Components.Schemas, "ConfigValidationResponse")
+		assert.NotContains(t, doc.Components.Schemas["ApiError"].Properties, "httpStatus")
+	})
+
+	t.Run("Dashboard login", func(t *testing.T) {
+		data, err := buildOpenAPIDocument((&Server{}).apiRoutes(), openAPISecurity{
+			DashboardLogin: true,
+			BasicAuth:      true,
+		}, "")
+		require.NoError(t, err)
+
+		var doc openAPIDocument
+		err = json.Unmarshal(data, &doc)
+		require.NoError(t, err)
+
+		op := doc.Paths["/api/status/{recordname}"]["get"]
+		assert.Len(t, op.Security, 3)
+		assert.Contains(t, op.Responses, "401")
+	})
+
+	t.Run("Base path", func(t *testing.T) {
+		data, err := buildOpenAPIDocument((&Server{}).apiRoutes(), openAPISecurity{}, "/ddup")
+		require.NoError(t, err)
+
+		var doc openAPIDocument
+		err = json.Unmarshal(data, &doc)
+		require.NoError(t, err)
+
+		require.Len(t, doc.Servers, 1)
+		assert.Equal(t, "/ddup", doc.Servers[0].URL)
+		assert.Contains(t, doc.Paths, "/api/status")
+	})
+}
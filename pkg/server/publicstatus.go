@@ -0,0 +1,269 @@
+package server
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+// Path of the public status page
+const publicStatusPagePath = "/status"
+
+// Prefix of the paths of the public status API
+const publicStatusAPIPrefix = "/api/public/"
+
+// Status of domains in the public status
+const (
+	publicStatusUp       = "up"
+	publicStatusDegraded = "degraded"
+	publicStatusDown     = "down"
+	publicStatusPaused   = "paused"
+	// Only for endpoints
+	publicStatusDrained = "drained"
+)
+
+// publicStatusResponse is the response of the public status route
+// It can be consumed by status-page tools, such as with the "JSON Query" monitors of Uptime Kuma, checking that "status" is "up".
+type publicStatusResponse struct {
+	// Overall status, which is the worst status of the domains that aren't paused
+	Status string `json:"status"`
+	// Status of each domain, keyed by record name
+	Domains map[string]publicDomainStatus `json:"domains"`
+}
+
+// publicDomainStatus is the status of a domain in the public status
+// It doesn't include the IPs of the endpoints nor the details of errors, which are available in the status API only.
+type publicDomainStatus struct {
+	// One of "up", "degraded", "down", or "paused"
+	Status string `json:"status"`
+	// Number of endpoints that are healthy
+	HealthyEndpoints int `json:"healthyEndpoints"`
+	// Number of endpoints, not including drained ones
+	TotalEndpoints int `json:"totalEndpoints"`
+	// Status of each endpoint
+	Endpoints []publicEndpointStatus `json:"endpoints"`
+}
+
+// publicEndpointStatus is the status of an endpoint in the public status
+type publicEndpointStatus struct {
+	// Name of the endpoint, as in the configuration, if set
+	Name string `json:"name,omitempty"`
+	// One of "up", "degraded", "down", or "drained"
+	Status string `json:"status"`
+	// Duration of the last health check, in milliseconds
+	LatencyMs int64 `json:"latencyMs,omitempty"`
+}
+
+// shieldsBadge is the response for the shields.io endpoint badges
+// See: https://shields.io/badges/endpoint-badge
+type shieldsBadge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// Colors of the badges for each status
+var publicStatusColors = map[string]string{
+	publicStatusUp:       "brightgreen",
+	publicStatusDegraded: "yellow",
+	publicStatusDown:     "red",
+	publicStatusPaused:   "lightgrey",
+	publicStatusDrained:  "lightgrey",
+}
+
+// handlePublicStatus is the handler for the route that returns a summary of the status of all domains
+func (s *Server) handlePublicStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.getConfig().Server.PublicStatus.Enabled {
+		errPublicStatusDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	respondWithJSON(r.Context(), w, s.getPublicStatus())
+}
+
+// getPublicStatus returns the summary of the status of all domains
+func (s *Server) getPublicStatus() publicStatusResponse {
+	res := publicStatusResponse{
+		Status:  publicStatusUp,
+		Domains: map[string]publicDomainStatus{},
+	}
+	for name, status := range s.hc.GetAllDomainsStatus() {
+		ds := getPublicDomainStatus(status)
+		res.Domains[name] = ds
+
+		switch {
+		case ds.Status == publicStatusDown:
+			res.Status = publicStatusDown
+		case ds.Status == publicStatusDegraded && res.Status == publicStatusUp:
+			res.Status = publicStatusDegraded
+		}
+	}
+
+	return res
+}
+
+// handlePublicBadge is the handler for the route that returns the status of a domain as a shields.io badge
+func (s *Server) handlePublicBadge(w http.ResponseWriter, r *http.Request) {
+	if !s.getConfig().Server.PublicStatus.Enabled {
+		errPublicStatusDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	recordName := r.PathValue("recordname")
+	status := s.hc.GetDomainStatus(recordName)
+	if status == nil {
+		errStatusDomainNotFound.WriteResponse(r.Context(), w)
+		return
+	}
+
+	ds := getPublicDomainStatus(*status)
+	respondWithJSON(r.Context(), w, shieldsBadge{
+		SchemaVersion: 1,
+		Label:         recordName,
+		Message:       ds.Status,
+		Color:         publicStatusColors[ds.Status],
+	})
+}
+
+// getPublicDomainStatus returns the summary of the status of a domain, without the IPs of the endpoints and the details of errors
+// A domain is down if none of its endpoints is healthy, and degraded if some are unhealthy or slow, or if the DNS records could not be updated.
+func getPublicDomainStatus(status healthcheck.DomainStatus) publicDomainStatus {
+	res := publicDomainStatus{
+		Endpoints: make([]publicEndpointStatus, 0, len(status.Endpoints)),
+	}
+	degraded := status.Error != ""
+	for _, e := range status.Endpoints {
+		pe := publicEndpointStatus{
+			Name:      e.Name,
+			LatencyMs: e.LastLatencyMs,
+		}
+		switch {
+		case e.Drained:
+			// Drained endpoints are removed on purpose, so they don't affect the status
+			pe.Status = publicStatusDrained
+			res.Endpoints = append(res.Endpoints, pe)
+			continue
+		case !e.Healthy:
+			pe.Status = publicStatusDown
+		case e.Degraded:
+			pe.Status = publicStatusDegraded
+		default:
+			pe.Status = publicStatusUp
+		}
+		res.Endpoints = append(res.Endpoints, pe)
+
+		res.TotalEndpoints++
+		if e.Healthy {
+			res.HealthyEndpoints++
+		}
+		if pe.Status != publicStatusUp {
+			degraded = true
+		}
+	}
+
+	switch {
+	case status.Paused:
+		res.Status = publicStatusPaused
+	case res.HealthyEndpoints == 0:
+		res.Status = publicStatusDown
+	case degraded:
+		res.Status = publicStatusDegraded
+	default:
+		res.Status = publicStatusUp
+	}
+	return res
+}
+
+// handlePublicStatusPage is the handler for the public status page
+func (s *Server) handlePublicStatusPage(w http.ResponseWriter, r *http.Request) {
+	cfg := s.getConfig().Server.PublicStatus
+	if !cfg.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := s.getPublicStatus()
+	names := make([]string, 0, len(status.Domains))
+	for name := range status.Domains {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	type pageDomain struct {
+		Name string
+		publicDomainStatus
+	}
+	domains := make([]pageDomain, len(names))
+	for i, name := range names {
+		domains[i] = pageDomain{Name: name, publicDomainStatus: status.Domains[name]}
+	}
+
+	w.Header().Set(headerContentType, "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err := publicStatusPageTemplate.Execute(w, struct {
+		Title   string
+		Status  string
+		Domains []pageDomain
+		Updated string
+	}{
+		Title:   cfg.Title,
+		Status:  status.Status,
+		Domains: domains,
+		Updated: time.Now().UTC().Format(time.RFC1123),
+	})
+	if err != nil {
+		logger().WarnContext(r.Context(), "Error rendering public status page", slog.Any("error", err))
+	}
+}
+
+var publicStatusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"title": func(s string) string {
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+	"inc": func(i int) int {
+		return i + 1
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; background: #f4f4f5; margin: 0; padding: 2rem 1rem; color: #18181b; }
+main { max-width: 40rem; margin: 0 auto; }
+h1 { font-size: 1.5rem; margin: 0 0 1.5rem; }
+.banner { padding: 1rem; border-radius: 0.5rem; color: #fff; font-weight: 600; margin-bottom: 1.5rem; }
+section { background: #fff; padding: 1rem; border-radius: 0.5rem; box-shadow: 0 1px 3px rgba(0,0,0,0.1); margin-bottom: 1rem; }
+h2 { font-size: 1rem; margin: 0 0 0.5rem; display: flex; justify-content: space-between; }
+ul { list-style: none; padding: 0; margin: 0; font-size: 0.875rem; }
+li { display: flex; justify-content: space-between; padding: 0.25rem 0; border-top: 1px solid #f4f4f5; }
+.up { background: #16a34a; } .degraded { background: #ca8a04; } .down { background: #dc2626; } .paused, .drained { background: #71717a; }
+.badge { color: #fff; border-radius: 0.25rem; padding: 0 0.5rem; font-size: 0.75rem; font-weight: 600; }
+footer { font-size: 0.75rem; color: #71717a; text-align: center; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<div class="banner {{.Status}}">{{if eq .Status "up"}}All systems operational{{else if eq .Status "degraded"}}Some systems are degraded{{else}}Some systems are down{{end}}</div>
+{{range .Domains}}
+<section>
+<h2><span>{{.Name}}</span><span class="badge {{.Status}}">{{title .Status}}</span></h2>
+<ul>
+{{range $i, $e := .Endpoints}}<li><span>{{if $e.Name}}{{$e.Name}}{{else}}Endpoint {{inc $i}}{{end}}</span><span>{{if $e.LatencyMs}}{{$e.LatencyMs}} ms {{end}}<span class="badge {{$e.Status}}">{{title $e.Status}}</span></span></li>
+{{end}}</ul>
+</section>
+{{end}}
+<footer>Updated {{.Updated}}</footer>
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+func TestHandlePublicStatus(t *testing.T) {
+	hc := &mockStatusProvider{
+		status: map[string]healthcheck.DomainStatus{
+			"ok.example.com": {
+				Endpoints: []healthcheck.DomainStatusEndpoint{
+					{IP: "10.0.0.1", Name: "primary", Healthy: true, LastLatencyMs: 12},
+					// Drained endpoints are ignored
+					{IP: "10.0.0.2", Drained: true},
+				},
+			},
+			"degraded.example.com": {
+				Error: "failed to update records: 10.0.0.3",
+				Endpoints: []healthcheck.DomainStatusEndpoint{
+					{IP: "10.0.0.3", URL: "https://10.0.0.3/healthz", Healthy: true},
+					{IP: "10.0.0.4", Healthy: false, LastError: "dial tcp 10.0.0.4:443: connection refused"},
+				},
+			},
+			"paused.example.com": {
+				Paused: true,
+			},
+		},
+	}
+	s := &Server{hc: hc}
+
+	doRequest := func(t *testing.T, handler http.HandlerFunc, recordName string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/public", nil)
+		req.SetPathValue("recordname", recordName)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		s.UpdateConfig(config.GetDefaultConfig())
+
+		rec := doRequest(t, s.handlePublicStatus, "")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = doRequest(t, s.handlePublicBadge, "ok.example.com")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	cfg := config.GetDefaultConfig()
+	cfg.Server.PublicStatus = config.ConfigPublicStatus{Enabled: true, Title: "Status"}
+	s.UpdateConfig(cfg)
+
+	t.Run("Status", func(t *testing.T) {
+		rec := doRequest(t, s.handlePublicStatus, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res publicStatusResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, publicStatusResponse{
+			Status: publicStatusDegraded,
+			Domains: map[string]publicDomainStatus{
+				"ok.example.com": {
+					Status: publicStatusUp, HealthyEndpoints: 1, TotalEndpoints: 1,
+					Endpoints: []publicEndpointStatus{
+						{Name: "primary", Status: publicStatusUp, LatencyMs: 12},
+						{Status: publicStatusDrained},
+					},
+				},
+				"degraded.example.com": {
+					Status: publicStatusDegraded, HealthyEndpoints: 1, TotalEndpoints: 2,
+					Endpoints: []publicEndpointStatus{
+						{Status: publicStatusUp},
+						{Status: publicStatusDown},
+					},
+				},
+				"paused.example.com": {
+					Status:    publicStatusPaused,
+					Endpoints: []publicEndpointStatus{},
+				},
+			},
+		}, res)
+
+		// IPs, URLs, and errors are not included
+		assert.NotContains(t, rec.Body.String(), "10.0.0.")
+		assert.NotContains(t, rec.Body.String(), "refused")
+	})
+
+	t.Run("Status with a domain down", func(t *testing.T) {
+		hc.status["down.example.com"] = healthcheck.DomainStatus{
+			Endpoints:   []healthcheck.DomainStatusEndpoint{{IP: "10.0.0.5", Healthy: false}},
+			FallbackIPs: []string{"10.0.0.100"},
+		}
+		defer delete(hc.status, "down.example.com")
+
+		rec := doRequest(t, s.handlePublicStatus, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res publicStatusResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, publicStatusDown, res.Status)
+		assert.Equal(t, publicStatusDown, res.Domains["down.example.com"].Status)
+	})
+
+	t.Run("Badge", func(t *testing.T) {
+		rec := doRequest(t, s.handlePublicBadge, "degraded.example.com")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var res shieldsBadge
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Equal(t, shieldsBadge{SchemaVersion: 1, Label: "degraded.example.com", Message: "degraded", Color: "yellow"}, res)
+	})
+
+	t.Run("Badge for unknown domain", func(t *testing.T) {
+		rec := doRequest(t, s.handlePublicBadge, "unknown.example.com")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Page", func(t *testing.T) {
+		rec := doRequest(t, s.handlePublicStatusPage, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		body := rec.Body.String()
+		assert.Contains(t, body, "Some systems are degraded")
+		assert.Contains(t, body, "ok.example.com")
+		assert.Contains(t, body, "primary")
+		assert.Contains(t, body, "Endpoint 2")
+		assert.NotContains(t, body, "10.0.0.")
+		assert.NotContains(t, body, "refused")
+	})
+}
+
+func TestPublicStatusServer(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Server.PublicStatus = config.ConfigPublicStatus{Enabled: true, Port: 7402, Title: "Status"}
+
+	s, err := NewServer(NewServerOpts{
+		Config: cfg,
+		HealthChecker: &mockStatusProvider{
+			status: map[string]healthcheck.DomainStatus{
+				"app.example.com": {Endpoints: []healthcheck.DomainStatusEndpoint{{IP: "10.0.0.1", Healthy: true}}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, s.publicHandler)
+
+	doRequest := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		s.publicHandler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The public status is served
+	assert.Equal(t, http.StatusOK, doRequest("/").Code)
+	assert.Equal(t, http.StatusOK, doRequest("/status").Code)
+	assert.Equal(t, http.StatusOK, doRequest("/api/public/status").Code)
+	assert.Equal(t, http.StatusOK, doRequest("/api/public/badge/app.example.com").Code)
+
+	// Nothing else is
+	assert.Equal(t, http.StatusNotFound, doRequest("/api/status").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest("/index.html").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest("/api/openapi.json").Code)
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+// Reasons reported for domains that are not ready
+// The route is public, so the details of errors are not included; they are available in the status API
+const (
+	notReadyError              = "error"
+	notReadyNoHealthyEndpoints = "no_healthy_endpoints"
+)
+
+// handleReadyz is the handler for the readiness route
+// The response has status code 503 if any of the conditions in the readiness configuration hold, listing the domains that are not ready and the reason
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	cfg := s.getConfig().Server.Readiness
+
+	notReady := map[string]string{}
+	if s.hc != nil && (cfg.FailOnProviderError || cfg.FailOnNoHealthyEndpoints) {
+		for name, status := range s.hc.GetAllDomainsStatus() {
+			// Paused domains are not checked, so they are ignored
+			if status.Paused {
+				continue
+			}
+
+			switch {
+			case cfg.FailOnProviderError && status.Error != "":
+				notReady[name] = notReadyError
+			case cfg.FailOnNoHealthyEndpoints && !slices.ContainsFunc(status.Endpoints, isEndpointHealthy):
+				notReady[name] = notReadyNoHealthyEndpoints
+			}
+		}
+	}
+
+	if len(notReady) > 0 {
+		errNotReady.
+			Clone(withMetadata(notReady)).
+			WriteResponse(r.Context(), w)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func isEndpointHealthy(e healthcheck.DomainStatusEndpoint) bool {
+	return e.Healthy
+}
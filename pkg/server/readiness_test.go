@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+type mockStatusProvider struct {
+	status map[string]healthcheck.DomainStatus
+}
+
+func (m *mockStatusProvider) GetAllDomainsStatus() map[string]healthcheck.DomainStatus {
+	return m.status
+}
+
+func (m *mockStatusProvider) GetDomainStatus(domain string) *healthcheck.DomainStatus {
+	status, ok := m.status[domain]
+	if !ok {
+		return nil
+	}
+	return &status
+}
+
+func TestHandleReadyz(t *testing.T) {
+	hc := &mockStatusProvider{
+		status: map[string]healthcheck.DomainStatus{
+			"ok.example.com": {
+				Endpoints: []healthcheck.DomainStatusEndpoint{{IP: "10.0.0.1", Healthy: true}},
+			},
+			"error.example.com": {
+				Error:     "failed to update records",
+				Endpoints: []healthcheck.DomainStatusEndpoint{{IP: "10.0.0.2", Healthy: true}},
+			},
+			"down.example.com": {
+				Endpoints:   []healthcheck.DomainStatusEndpoint{{IP: "10.0.0.3", Healthy: false}},
+				FallbackIPs: []string{"10.0.0.100"},
+			},
+			"paused.example.com": {
+				Paused: true,
+				Error:  "failed to update records",
+			},
+		},
+	}
+	s := &Server{hc: hc}
+
+	setReadiness := func(t *testing.T, readiness config.ConfigReadiness) {
+		t.Helper()
+
+		cfg := config.GetDefaultConfig()
+		cfg.Server.Readiness = readiness
+		s.UpdateConfig(cfg)
+	}
+
+	doRequest := func(t *testing.T) (*httptest.ResponseRecorder, map[string]string) {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/readyz", nil)
+		rec := httptest.NewRecorder()
+		s.handleReadyz(rec, req)
+
+		var res apiError
+		if rec.Code != http.StatusNoContent {
+			err := json.Unmarshal(rec.Body.Bytes(), &res)
+			require.NoError(t, err)
+		}
+		return rec, res.Metadata
+	}
+
+	t.Run("No conditions", func(t *testing.T) {
+		setReadiness(t, config.ConfigReadiness{})
+
+		rec, _ := doRequest(t)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		setReadiness(t, config.ConfigReadiness{FailOnProviderError: true})
+
+		rec, metadata := doRequest(t)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, map[string]string{
+			"error.example.com": notReadyError,
+		}, metadata)
+	})
+
+	t.Run("No healthy endpoints", func(t *testing.T) {
+		setReadiness(t, config.ConfigReadiness{FailOnNoHealthyEndpoints: true})
+
+		rec, metadata := doRequest(t)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, map[string]string{
+			"down.example.com": notReadyNoHealthyEndpoints,
+		}, metadata)
+	})
+
+	t.Run("All conditions", func(t *testing.T) {
+		setReadiness(t, config.ConfigReadiness{FailOnProviderError: true, FailOnNoHealthyEndpoints: true})
+
+		rec, metadata := doRequest(t)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Len(t, metadata, 2)
+
+		// Error details are not exposed
+		assert.NotContains(t, rec.Body.String(), "failed to update records")
+	})
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+// handleRecordsExport is the handler for the route that returns the desired and actual state of the records of all domains
+func (s *Server) handleRecordsExport(w http.ResponseWriter, r *http.Request) {
+	if s.exporter == nil {
+		errRecordsExportDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		errRecordsFormatInvalid.WriteResponse(r.Context(), w)
+		return
+	}
+
+	// Records are read from the providers
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	states := s.exporter.ExportRecords(ctx)
+
+	if format == "csv" {
+		w.Header().Set(headerContentType, csvContentType)
+		err := healthcheck.WriteRecordStatesCSV(w, states)
+		if err != nil {
+			logger().WarnContext(r.Context(), "Error writing CSV response", "error", err)
+		}
+		return
+	}
+
+	w.Header().Set(headerContentType, jsonContentType)
+	respondWithJSON(r.Context(), w, states)
+}
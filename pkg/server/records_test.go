@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+type mockRecordExporter struct {
+	states []healthcheck.RecordState
+}
+
+func (m *mockRecordExporter) ExportRecords(ctx context.Context) []healthcheck.RecordState {
+	return m.states
+}
+
+func TestHandleRecordsExport(t *testing.T) {
+	exporter := &mockRecordExporter{
+		states: []healthcheck.RecordState{
+			{Domain: "app.example.com", Provider: "cf", RecordType: "A", TTL: 60, Desired: []string{"10.0.0.1", "10.0.0.2"}, Actual: []string{"10.0.0.1"}},
+			{Domain: "www.example.com", Provider: "exec", RecordType: "A", TTL: 60, Desired: []string{"10.0.0.3"}},
+		},
+	}
+
+	doRequest := func(t *testing.T, s *Server, query string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/records"+query, nil)
+		rec := httptest.NewRecorder()
+		s.handleRecordsExport(rec, req)
+		return rec
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		rec := doRequest(t, &Server{exporter: exporter}, "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, jsonContentType, rec.Header().Get(headerContentType))
+
+		var states []healthcheck.RecordState
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &states))
+		assert.Equal(t, exporter.states, states)
+		assert.Contains(t, rec.Body.String(), `"actual":null`)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		rec := doRequest(t, &Server{exporter: exporter}, "?format=csv")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, csvContentType, rec.Header().Get(headerContentType))
+		assert.Equal(t, "domain,provider,recordType,ttl,desired,actual,inSync,error\n"+
+			"app.example.com,cf,A,60,10.0.0.1 10.0.0.2,10.0.0.1,false,\n"+
+			"www.example.com,exec,A,60,10.0.0.3,,false,\n", rec.Body.String())
+	})
+
+	t.Run("Invalid format", func(t *testing.T) {
+		rec := doRequest(t, &Server{exporter: exporter}, "?format=xml")
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), errRecordsFormatInvalid.Code)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		rec := doRequest(t, &Server{}, "")
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Contains(t, rec.Body.String(), errRecordsExportDisabled.Code)
+	})
+}
@@ -0,0 +1,316 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+	"github.com/italypaleale/ddup/pkg/quorum"
+)
+
+// routeAccess is the access level required to invoke a route of the API
+type routeAccess int
+
+const (
+	// The route is available to anyone who can reach the server
+	accessPublic routeAccess = iota
+	// The route returns the status, and it can be used with read-only tokens or by users logged into the dashboard
+	accessRead
+	// The route is administrative, and it requires an API token that is not read-only
+	accessAdmin
+	// The route is used by remote checker agents, and it requires the token of an agent
+	accessAgent
+)
+
+// apiRoute describes a route of the API
+// Routes are registered in the mux and described in the OpenAPI document from the same list, so the two are always in sync
+type apiRoute struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Access      routeAccess
+	Handler     http.HandlerFunc
+	// Additional middlewares for the route, applied before the access checks
+	Middlewares []Middleware
+	// Optional parameters in the query string
+	QueryParams []apiQueryParam
+
+	// Value whose type is the JSON request body; if nil, the request has no JSON body
+	Request any
+	// If true, the request body is a configuration document
+	RequestConfigDocument bool
+	// If true, the response body is a configuration document
+	ResponseConfigDocument bool
+	// Value whose type is the JSON response body; if nil, the response has no body
+	Response any
+	// Additional responses with a JSON body, by status code
+	OtherResponses map[int]any
+	// Errors the route can return, in addition to the ones related to authentication
+	Errors []*apiError
+}
+
+// apiQueryParam is an optional parameter in the query string of a route
+type apiQueryParam struct {
+	Name        string
+	Description string
+}
+
+// apiRoutes returns the list of routes of the API
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{
+			Method:      http.MethodGet,
+			Path:        "/healthz",
+			OperationID: "healthz",
+			Summary:     "Returns a successful response if the server is running",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/readyz",
+			OperationID: "readyz",
+			Summary:     "Returns a successful response if the service is ready, according to the conditions in the configuration",
+			Handler:     s.handleReadyz,
+			Errors:      []*apiError{errNotReady},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        openAPIPath,
+			OperationID: "getOpenAPIDocument",
+			Summary:     "Returns the OpenAPI document describing the API",
+			Handler:     s.handleOpenAPI,
+			Response:    map[string]any{},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/api/status",
+			OperationID: "getAllDomainsStatus",
+			Summary:     "Returns the status of all domains, keyed by record name; the X-Total-Count header contains the number of domains that match the filters",
+			Access:      accessRead,
+			Handler:     s.handleStatusList,
+			QueryParams: []apiQueryParam{
+				{Name: "provider", Description: "Only return domains that use this DNS provider"},
+				{Name: "healthy", Description: "If 'true', only return domains with at least one healthy endpoint; if 'false', only domains without healthy endpoints"},
+				{Name: "name", Description: "Only return domains whose record name matches this glob pattern, such as '*.example.com'"},
+				{Name: "sort", Description: "Order of the domains: 'name' (the default), 'provider', 'lastUpdated', or 'healthy' (number of healthy endpoints); prefix with '-' for descending order"},
+				{Name: "limit", Description: "Maximum number of domains to return"},
+				{Name: "offset", Description: "Number of domains to skip, for pagination"},
+			},
+			Response: map[string]healthcheck.DomainStatus{},
+			Errors:   []*apiError{errStatusHealthyInvalid, errStatusNameInvalid, errStatusSortInvalid, errStatusLimitInvalid, errStatusOffsetInvalid},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/api/status/{recordname}",
+			OperationID: "getDomainStatus",
+			Summary:     "Returns the status of a domain",
+			Access:      accessRead,
+			Handler:     s.handleStatusGet,
+			Response:    healthcheck.DomainStatus{},
+			Errors:      []*apiError{errStatusRecordNameEmpty, errStatusDomainNotFound},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/api/public/status",
+			OperationID: "getPublicStatus",
+			Summary:     "Returns a summary of the status of all domains, for status pages, if the public status is enabled",
+			Handler:     s.handlePublicStatus,
+			Response:    publicStatusResponse{},
+			Errors:      []*apiError{errPublicStatusDisabled},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/api/public/badge/{recordname}",
+			OperationID: "getPublicBadge",
+			Summary:     "Returns the status of a domain in the format of the shields.io endpoint badges, if the public status is enabled",
+			Handler:     s.handlePublicBadge,
+			Response:    shieldsBadge{},
+			Errors:      []*apiError{errPublicStatusDisabled, errStatusDomainNotFound},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/api/records",
+			OperationID: "exportRecords",
+			Summary:     "Returns the desired and actual state of the records of all domains, in JSON or, with format=csv, in CSV",
+			Access:      accessRead,
+			Handler:     s.handleRecordsExport,
+			Response:    []healthcheck.RecordState{},
+			Errors:      []*apiError{errRecordsFormatInvalid, errRecordsExportDisabled},
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        quorum.ObservationsPath,
+			OperationID: "getObservations",
+			Summary:     "Returns the results of the last health checks, which other instances use to confirm that endpoints are down",
+			Access:      accessRead,
+			Handler:     s.handleObservations,
+			Response:    quorum.Observations{},
+			Errors:      []*apiError{errObservationsDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        quorum.ReportPath,
+			OperationID: "reportAgentResults",
+			Summary:     "Receives the results of the health checks performed by a remote checker agent",
+			Access:      accessAgent,
+			Handler:     s.handleAgentReport,
+			// Reports can be larger than the default limit for request bodies
+			Middlewares: []Middleware{MiddlewareMaxBodySize(agentReportMaxBodySize)},
+			Request:     quorum.Observations{},
+			Errors:      []*apiError{errAgentReportInvalid, errAgentsDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/config/validate",
+			OperationID: "validateConfig",
+			Summary:     "Validates a configuration document, without applying it",
+			Access:      accessAdmin,
+			Handler:     s.handleConfigValidate,
+			// Config documents can be larger than the default limit for request bodies
+			Middlewares:           []Middleware{MiddlewareMaxBodySize(configMaxBodySize)},
+			RequestConfigDocument: true,
+			Response:              configValidationResponse{},
+			Errors:                []*apiError{errConfigBodyTooLarge, errConfigBodyRead},
+		},
+		{
+			Method:                 http.MethodGet,
+			Path:                   "/api/config",
+			OperationID:            "getConfig",
+			Summary:                "Returns the current configuration file",
+			Access:                 accessAdmin,
+			Handler:                s.handleConfigGet,
+			ResponseConfigDocument: true,
+			Errors:                 []*apiError{errConfigFileRead},
+		},
+		{
+			Method:                http.MethodPut,
+			Path:                  "/api/config",
+			OperationID:           "replaceConfig",
+			Summary:               "Replaces the configuration file and applies it",
+			Access:                accessAdmin,
+			Handler:               s.handleConfigPut,
+			Middlewares:           []Middleware{MiddlewareMaxBodySize(configMaxBodySize)},
+			RequestConfigDocument: true,
+			Response:              configValidationResponse{},
+			OtherResponses: map[int]any{
+				http.StatusUnprocessableEntity: configValidationResponse{},
+			},
+			Errors: []*apiError{errConfigBodyTooLarge, errConfigBodyRead, errConfigFileWrite, errConfigReload, errConfigReloadDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/endpoints/{domain}/{ip}/drain",
+			OperationID: "drainEndpoint",
+			Summary:     "Removes an endpoint from the DNS records of the domain, regardless of its health",
+			Access:      accessAdmin,
+			Handler:     s.handleEndpointDrain,
+			Response:    healthcheck.DomainStatus{},
+			Errors:      []*apiError{errStatusDomainNotFound, errEndpointNotFound, errEndpointDrain, errEndpointDrainDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/endpoints/{domain}/{ip}/undrain",
+			OperationID: "undrainEndpoint",
+			Summary:     "Restores an endpoint that was drained",
+			Access:      accessAdmin,
+			Handler:     s.handleEndpointUndrain,
+			Response:    healthcheck.DomainStatus{},
+			Errors:      []*apiError{errStatusDomainNotFound, errEndpointNotFound, errEndpointDrain, errEndpointDrainDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/check",
+			OperationID: "checkAllDomains",
+			Summary:     "Runs the health checks for all domains and updates the DNS records if needed",
+			Access:      accessAdmin,
+			Handler:     s.handleCheck,
+			Response:    map[string]healthcheck.DomainStatus{},
+			Errors:      []*apiError{errCheck, errCheckDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/check/{recordname}",
+			OperationID: "checkDomain",
+			Summary:     "Runs the health checks for a domain and updates its DNS records if needed",
+			Access:      accessAdmin,
+			Handler:     s.handleCheck,
+			Response:    healthcheck.DomainStatus{},
+			Errors:      []*apiError{errStatusDomainNotFound, errCheck, errCheckDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/sync/{recordname}",
+			OperationID: "syncDomain",
+			Summary:     "Runs the health checks for a domain and pushes its DNS records to the provider, even if they haven't changed",
+			Access:      accessAdmin,
+			Handler:     s.handleSync,
+			Response:    healthcheck.DomainStatus{},
+			Errors:      []*apiError{errStatusDomainNotFound, errSync, errSyncNoHealthy, errSyncPaused, errSyncNotLeader, errCheckDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/domains/{recordname}/pause",
+			OperationID: "pauseDomain",
+			Summary:     "Pauses health checks and DNS updates for a domain",
+			Access:      accessAdmin,
+			Handler:     s.handleDomainPause,
+			Response:    healthcheck.DomainStatus{},
+			Errors:      []*apiError{errStatusDomainNotFound, errDomainPause, errDomainPauseDisabled},
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/api/domains/{recordname}/resume",
+			OperationID: "resumeDomain",
+			Summary:     "Resumes a paused domain",
+			Access:      accessAdmin,
+			Handler:     s.handleDomainResume,
+			Response:    healthcheck.DomainStatus{},
+			Errors:      []*apiError{errStatusDomainNotFound, errDomainPause, errDomainPauseDisabled},
+		},
+	}
+}
+
+// registerAPIRoutes registers the routes of the API in the mux
+func registerAPIRoutes(mux *http.ServeMux, routes []apiRoute, requireReadAccess Middleware, requireAPIToken Middleware, requireAgentToken Middleware) {
+	for _, route := range routes {
+		middlewares := route.Middlewares
+		switch route.Access {
+		case accessRead:
+			middlewares = append(middlewares, requireReadAccess)
+		case accessAdmin:
+			middlewares = append(middlewares, requireAPIToken)
+		case accessAgent:
+			middlewares = append(middlewares, requireAgentToken)
+		}
+		mux.Handle(route.Method+" "+route.Path, Use(route.Handler, middlewares...))
+	}
+}
+
+// handleObservations is the handler for the route that returns the results of the last health checks
+func (s *Server) handleObservations(w http.ResponseWriter, r *http.Request) {
+	if s.observer == nil {
+		errObservationsDisabled.WriteResponse(r.Context(), w)
+		return
+	}
+
+	respondWithJSON(r.Context(), w, s.observer.GetObservations())
+}
+
+// handleStatusGet is the handler for the route that returns the status of a domain
+func (s *Server) handleStatusGet(w http.ResponseWriter, r *http.Request) {
+	recordName := r.PathValue("recordname")
+	if recordName == "" {
+		errStatusRecordNameEmpty.WriteResponse(r.Context(), w)
+		return
+	}
+
+	status := s.hc.GetDomainStatus(recordName)
+	if status == nil {
+		errStatusDomainNotFound.WriteResponse(r.Context(), w)
+		return
+	}
+
+	respondWithJSON(r.Context(), w, status)
+}
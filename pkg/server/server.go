@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,37 +20,103 @@ import (
 
 	"github.com/italypaleale/ddup/pkg/config"
 	"github.com/italypaleale/ddup/pkg/healthcheck"
+	"github.com/italypaleale/ddup/pkg/logging"
 )
 
 const (
 	headerContentType = "Content-Type"
 	jsonContentType   = "application/json; charset=utf-8"
+	yamlContentType   = "application/yaml; charset=utf-8"
+	tomlContentType   = "application/toml; charset=utf-8"
+	csvContentType    = "text/csv; charset=utf-8"
 )
 
 // Server is the server based on Gin
 type Server struct {
-	hc healthcheck.StatusProvider
+	hc       healthcheck.StatusProvider
+	reloader ConfigReloader
+	drainer  healthcheck.EndpointDrainer
+	checker  healthcheck.CheckRunner
+	pauser   healthcheck.DomainPauser
+	observer healthcheck.ObservationProvider
+	agents   healthcheck.AgentReportReceiver
+	exporter healthcheck.RecordExporter
+
+	// Current configuration
+	// Options that are read when the server is started, such as the address it listens on, are not changed when the configuration is reloaded
+	cfg atomic.Pointer[config.Config]
+
+	// Lock held while the config file is updated
+	configLock sync.Mutex
+
+	// OpenAPI document that describes the API
+	openAPIDoc []byte
 
 	appSrv  *http.Server
 	handler http.Handler
 	running atomic.Bool
 	wg      sync.WaitGroup
 
-	// Listener for the app server
+	// If set, the app server uses TLS
+	tlsConfig *tls.Config
+	// If set, an additional server listens for ACME http-01 challenges
+	challengeSrv     *http.Server
+	challengeHandler http.Handler
+	// If set, an additional server serves the public status only
+	publicSrv     *http.Server
+	publicHandler http.Handler
+
+	// Listeners for the app server, one for each bind address
 	// This can be used for testing without having to start an actual TCP listener
-	appListener net.Listener
+	appListeners []net.Listener
+}
+
+// ConfigReloader reloads the configuration file and applies it
+type ConfigReloader interface {
+	Reload(ctx context.Context) error
 }
 
 // NewServerOpts contains options for the NewServer method
 type NewServerOpts struct {
+	// Configuration; if nil, the default configuration is used
+	Config        *config.Config
 	HealthChecker healthcheck.StatusProvider
+	// Optional object used to apply changes to the configuration file
+	ConfigReloader ConfigReloader
+	// Optional object used to drain and undrain endpoints
+	EndpointDrainer healthcheck.EndpointDrainer
+	// Optional object used to run health checks on demand
+	CheckRunner healthcheck.CheckRunner
+	// Optional object used to pause and resume domains
+	DomainPauser healthcheck.DomainPauser
+	// Optional object that returns the results of the last health checks to other instances, for checks from multiple vantage points
+	ObservationProvider healthcheck.ObservationProvider
+	// Optional object that receives the results reported by remote checker agents
+	AgentReportReceiver healthcheck.AgentReportReceiver
+	// Optional object that returns the desired and actual state of the records
+	RecordExporter healthcheck.RecordExporter
+	// Optional TLS configuration; if set, the server uses HTTPS
+	TLSConfig *tls.Config
+	// Optional handler for ACME http-01 challenges, served over HTTP on the port set in the ACME configuration
+	ACMEHTTPHandler http.Handler
 }
 
 // NewServer creates a new Server object and initializes it
 func NewServer(opts NewServerOpts) (*Server, error) {
 	s := &Server{
-		hc: opts.HealthChecker,
+		hc:       opts.HealthChecker,
+		reloader: opts.ConfigReloader,
+		drainer:  opts.EndpointDrainer,
+		checker:  opts.CheckRunner,
+		pauser:   opts.DomainPauser,
+		observer: opts.ObservationProvider,
+		agents:   opts.AgentReportReceiver,
+		exporter: opts.RecordExporter,
+
+		tlsConfig:        opts.TLSConfig,
+		challengeHandler: opts.ACMEHTTPHandler,
 	}
+	s.UpdateConfig(opts.Config)
 
 	// Init the object
 	err := s.init()
@@ -59,6 +127,21 @@ func NewServer(opts NewServerOpts) (*Server, error) {
 	return s, nil
 }
 
+// UpdateConfig sets the configuration used by the server, such as after it's been reloaded
+// If cfg is nil, the default configuration is used
+func (s *Server) UpdateConfig(cfg *config.Config) {
+	s.cfg.Store(cfg)
+}
+
+// getConfig returns the current configuration
+func (s *Server) getConfig() *config.Config {
+	cfg := s.cfg.Load()
+	if cfg == nil {
+		return config.GetDefaultConfig()
+	}
+	return cfg
+}
+
 // Init the Server object and create the mux
 func (s *Server) init() error {
 	// Init the app server
@@ -71,65 +154,123 @@ func (s *Server) init() error {
 }
 
 func (s *Server) initAppServer() (err error) {
-	cfg := config.Get()
+	cfg := s.getConfig()
 
 	// Create the mux
 	mux := http.NewServeMux()
 
-	// Register routes
-	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusNoContent)
-	})
-
-	mux.HandleFunc("GET /api/status/{recordname}", func(w http.ResponseWriter, r *http.Request) {
-		recordName := r.PathValue("recordname")
-		if recordName == "" {
-			errStatusRecordNameEmpty.WriteResponse(r.Context(), w)
-			return
+	// If dashboard authentication is enabled, the dashboard and the status API require logging in
+	var (
+		auth                 *dashboardAuth
+		requireLoginRedirect []Middleware
+	)
+	if cfg.Server.DashboardAuth != nil {
+		auth, err = newDashboardAuth(cfg.Server.DashboardAuth)
+		if err != nil {
+			return fmt.Errorf("failed to init dashboard authentication: %w", err)
 		}
-
-		status := s.hc.GetDomainStatus(recordName)
-		if status == nil {
-			errStatusDomainNotFound.WriteResponse(r.Context(), w)
-			return
+		requireLoginRedirect = []Middleware{auth.MiddlewareRequireLogin(true)}
+
+		mux.HandleFunc("GET "+loginPath, auth.handleLoginPage)
+		mux.HandleFunc("POST /logout", auth.handleLogout)
+		if auth.oidc != nil {
+			mux.HandleFunc("GET "+oidcLoginPath, auth.handleOIDCLogin)
+			mux.HandleFunc("GET "+oidcCallbackPath, auth.handleOIDCCallback)
+		} else {
+			mux.HandleFunc("POST "+loginPath, auth.handleLogin)
 		}
+	}
 
-		respondWithJSON(r.Context(), w, status)
-	})
+	// Register the routes of the API and build the OpenAPI document that describes them
+	routes := s.apiRoutes()
+	var agentClients []config.ConfigAgentsClient
+	if cfg.Agents != nil {
+		agentClients = cfg.Agents.Clients
+	}
+	registerAPIRoutes(mux, routes,
+		MiddlewareRequireReadAccess(cfg.Server.APITokens, cfg.Server.ReadOnlyAPITokens, auth),
+		MiddlewareRequireAPIToken(cfg.Server.APITokens, cfg.Server.ReadOnlyAPITokens),
+		MiddlewareRequireAgentToken(agentClients),
+	)
+	s.openAPIDoc, err = buildOpenAPIDocument(routes, openAPISecurity{
+		ReadProtected:  len(cfg.Server.ReadOnlyAPITokens) > 0,
+		DashboardLogin: auth != nil,
+		BasicAuth:      auth != nil && auth.oidc == nil,
+	}, cfg.Server.BasePath)
+	if err != nil {
+		return fmt.Errorf("failed to build OpenAPI document: %w", err)
+	}
 
-	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
-		respondWithJSON(r.Context(), w, s.hc.GetAllDomainsStatus())
-	})
+	// The public status page never requires logging in
+	mux.HandleFunc("GET "+publicStatusPagePath, s.handlePublicStatusPage)
 
 	// Add static files (includes dashboard)
-	err = registerStatic(mux)
+	err = registerStatic(mux, cfg.Server.BasePath, requireLoginRedirect...)
 	if err != nil {
 		return fmt.Errorf("failed to register static server: %w", err)
 	}
 
-	middlewares := make([]Middleware, 0, 4)
+	middlewares := make([]Middleware, 0, 6)
+
+	// Serve everything under the base path, if set
+	// This runs after the other middlewares, so logs include the full path
+	if cfg.Server.BasePath != "" {
+		middlewares = append(middlewares, MiddlewareBasePath(cfg.Server.BasePath))
+	}
+
 	middlewares = append(middlewares,
 		// Recover from panics
 		sloghttp.Recovery,
-		// Limit request body to 1KB
-		MiddlewareMaxBodySize(1<<10),
+		// Limit request body to 1KB, unless the route sets a different limit
+		MiddlewareDefaultMaxBodySize(1<<10),
 	)
 
-	if cfg.Dev.EnableCORS {
+	// CORS
+	switch {
+	case len(cfg.Server.CORS.AllowedOrigins) > 0:
+		middlewares = append(middlewares,
+			cors.New(cors.Options{
+				AllowedOrigins: cfg.Server.CORS.AllowedOrigins,
+				AllowedMethods: cfg.Server.CORS.AllowedMethods,
+				AllowedHeaders: cfg.Server.CORS.AllowedHeaders,
+				ExposedHeaders: []string{headerRequestID, headerTotalCount},
+			}).Handler,
+		)
+	case cfg.Dev.EnableCORS:
 		middlewares = append(middlewares,
-			// CORS
 			cors.Default().Handler,
 		)
 	}
 
 	middlewares = append(middlewares,
 		// Log requests
-		sloghttp.New(slog.Default()),
+		sloghttp.New(logger()),
+		// Assign an ID to each request
+		// This must run before the request logger, which includes the ID in the logs
+		MiddlewareRequestID,
 	)
 
 	// Add middlewares
 	s.handler = Use(mux, middlewares...)
 
+	// The separate server for the public status only serves the public status page and API
+	if cfg.Server.PublicStatus.Enabled && cfg.Server.PublicStatus.Port != 0 {
+		publicMux := http.NewServeMux()
+		publicMux.HandleFunc("GET /{$}", s.handlePublicStatusPage)
+		publicMux.HandleFunc("GET "+publicStatusPagePath, s.handlePublicStatusPage)
+		for _, route := range routes {
+			if strings.HasPrefix(route.Path, publicStatusAPIPrefix) {
+				publicMux.Handle(route.Method+" "+route.Path, route.Handler)
+			}
+		}
+		s.publicHandler = Use(publicMux,
+			sloghttp.Recovery,
+			MiddlewareDefaultMaxBodySize(1<<10),
+			sloghttp.New(logger()),
+			MiddlewareRequestID,
+		)
+	}
+
 	return nil
 }
 
@@ -140,6 +281,10 @@ func (s *Server) Run(ctx context.Context) error {
 		return errors.New("server is already running")
 	}
 	defer s.running.Store(false)
+	// The listeners are closed when the server stops, so new ones are created if the server is started again
+	defer func() {
+		s.appListeners = nil
+	}()
 	defer s.wg.Wait()
 
 	// App server
@@ -157,18 +302,68 @@ func (s *Server) Run(ctx context.Context) error {
 		shutdownCancel()
 		if err != nil {
 			// Log the error only (could be context canceled)
-			slog.WarnContext(shutdownCtx,
+			logger().WarnContext(shutdownCtx,
 				"App server shutdown error",
 				slog.Any("error", err),
 			)
 		}
 	}()
 
-	// Block until the context is canceled or the app server exits unexpectedly.
+	// Server for ACME http-01 challenges
+	challengeSrvErrCh := make(chan error, 1)
+	if s.challengeHandler != nil {
+		s.wg.Add(1)
+		err = s.startChallengeServer(ctx, challengeSrvErrCh)
+		if err != nil {
+			s.wg.Done()
+			return fmt.Errorf("failed to start ACME challenge server: %w", err)
+		}
+		defer func() { //nolint:contextcheck
+			defer s.wg.Done()
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := s.challengeSrv.Shutdown(shutdownCtx)
+			shutdownCancel()
+			if err != nil {
+				logger().WarnContext(shutdownCtx,
+					"ACME challenge server shutdown error",
+					slog.Any("error", err),
+				)
+			}
+		}()
+	}
+
+	// Server for the public status
+	publicSrvErrCh := make(chan error, 1)
+	if s.publicHandler != nil {
+		s.wg.Add(1)
+		err = s.startPublicServer(ctx, publicSrvErrCh)
+		if err != nil {
+			s.wg.Done()
+			return fmt.Errorf("failed to start public status server: %w", err)
+		}
+		defer func() { //nolint:contextcheck
+			defer s.wg.Done()
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := s.publicSrv.Shutdown(shutdownCtx)
+			shutdownCancel()
+			if err != nil {
+				logger().WarnContext(shutdownCtx,
+					"Public status server shutdown error",
+					slog.Any("error", err),
+				)
+			}
+		}()
+	}
+
+	// Block until the context is canceled or a server exits unexpectedly.
 	select {
 	case <-ctx.Done():
 	case err = <-appSrvErrCh:
 		return fmt.Errorf("app server failed: %w", err)
+	case err = <-challengeSrvErrCh:
+		return fmt.Errorf("ACME challenge server failed: %w", err)
+	case err = <-publicSrvErrCh:
+		return fmt.Errorf("public status server failed: %w", err)
 	}
 
 	// Servers are stopped with deferred calls
@@ -176,51 +371,142 @@ func (s *Server) Run(ctx context.Context) error {
 }
 
 func (s *Server) startAppServer(ctx context.Context, appSrvErrCh chan<- error) error {
-	cfg := config.Get()
+	cfg := s.getConfig()
 
 	// Create the HTTP(S) server
 	s.appSrv = &http.Server{
-		Addr:              net.JoinHostPort(cfg.Server.Bind, strconv.Itoa(cfg.Server.Port)),
 		MaxHeaderBytes:    1 << 20,
 		ReadHeaderTimeout: 10 * time.Second,
 		Handler:           s.handler,
 	}
 
-	// Create the listener if we don't have one already
-	if s.appListener == nil {
+	// Create the listeners if we don't have them already
+	if len(s.appListeners) == 0 {
 		var err error
-		s.appListener, err = net.Listen("tcp", s.appSrv.Addr) //nolint:noctx
+		s.appListeners, err = listenAll(cfg.Server.Bind, cfg.Server.Port)
 		if err != nil {
-			return fmt.Errorf("failed to create TCP listener: %w", err)
+			return err
+		}
+	}
+
+	if s.tlsConfig != nil {
+		for i, l := range s.appListeners {
+			s.appListeners[i] = tls.NewListener(l, s.tlsConfig)
 		}
 	}
 
-	// Start the HTTP(S) server in a background goroutine
-	slog.InfoContext(ctx, "App server started",
-		slog.String("bind", cfg.Server.Bind),
+	// Start the HTTP(S) server in background goroutines
+	logger().InfoContext(ctx, "App server started",
+		slog.Any("bind", []string(cfg.Server.Bind)),
 		slog.Int("port", cfg.Server.Port),
+		slog.Bool("tls", s.tlsConfig != nil),
 	)
-	go func() { //nolint:contextcheck
-		defer s.appListener.Close() //nolint:errcheck
-
-		// Next call blocks until the server is shut down
-		srvErr := s.appSrv.Serve(s.appListener)
-		if !errors.Is(srvErr, http.ErrServerClosed) {
-			select {
-			case appSrvErrCh <- srvErr:
-			default:
-			}
+	serveAll(s.appSrv, s.appListeners, appSrvErrCh)
+
+	return nil
+}
+
+// startChallengeServer starts the server for ACME http-01 challenges, which must listen on plain HTTP
+func (s *Server) startChallengeServer(ctx context.Context, srvErrCh chan<- error) error {
+	cfg := s.getConfig()
+
+	s.challengeSrv = &http.Server{
+		MaxHeaderBytes:    1 << 20,
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler:           s.challengeHandler,
+	}
+
+	listeners, err := listenAll(cfg.Server.Bind, cfg.Server.ACME.HTTPPort)
+	if err != nil {
+		return err
+	}
+
+	logger().InfoContext(ctx, "ACME challenge server started",
+		slog.Any("bind", []string(cfg.Server.Bind)),
+		slog.Int("port", cfg.Server.ACME.HTTPPort),
+	)
+	serveAll(s.challengeSrv, listeners, srvErrCh)
+
+	return nil
+}
+
+// startPublicServer starts the server that only serves the public status
+// It uses TLS if the app server does.
+func (s *Server) startPublicServer(ctx context.Context, srvErrCh chan<- error) error {
+	cfg := s.getConfig()
+
+	s.publicSrv = &http.Server{
+		MaxHeaderBytes:    1 << 20,
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler:           s.publicHandler,
+	}
+
+	listeners, err := listenAll(cfg.Server.PublicStatus.Bind, cfg.Server.PublicStatus.Port)
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		for i, l := range listeners {
+			listeners[i] = tls.NewListener(l, s.tlsConfig)
 		}
-	}()
+	}
+
+	logger().InfoContext(ctx, "Public status server started",
+		slog.Any("bind", []string(cfg.Server.PublicStatus.Bind)),
+		slog.Int("port", cfg.Server.PublicStatus.Port),
+		slog.Bool("tls", s.tlsConfig != nil),
+	)
+	serveAll(s.publicSrv, listeners, srvErrCh)
 
 	return nil
 }
 
+// listenAll creates a TCP listener on the port for each of the addresses
+// If any listener can't be created, the ones created already are closed.
+func listenAll(addrs []string, port int) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		l, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(port))) //nolint:noctx
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("failed to create TCP listener on '%s': %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// serveAll starts serving requests on each of the listeners, in background goroutines
+// The first error returned by the server, other than for shutting down, is sent to srvErrCh.
+func serveAll(srv *http.Server, listeners []net.Listener, srvErrCh chan<- error) {
+	for _, listener := range listeners {
+		go func() { //nolint:contextcheck
+			defer listener.Close() //nolint:errcheck
+
+			// Next call blocks until the server is shut down
+			srvErr := srv.Serve(listener)
+			if !errors.Is(srvErr, http.ErrServerClosed) {
+				select {
+				case srvErrCh <- srvErr:
+				default:
+				}
+			}
+		}()
+	}
+}
+
 func respondWithJSON(ctx context.Context, w http.ResponseWriter, data any) {
 	enc := json.NewEncoder(w)
 	enc.SetEscapeHTML(false)
 	err := enc.Encode(data)
 	if err != nil {
-		slog.WarnContext(ctx, "Error writing JSON response", slog.Any("error", err))
+		logger().WarnContext(ctx, "Error writing JSON response", slog.Any("error", err))
 	}
 }
+
+// logger returns the logger for the server
+func logger() *slog.Logger {
+	return logging.Component("server")
+}
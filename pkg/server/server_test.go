@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/config"
+)
+
+func TestServerCORS(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Server.CORS = config.ConfigCORS{
+		AllowedOrigins: []string{"https://status.example.com"},
+		AllowedMethods: []string{http.MethodGet},
+		AllowedHeaders: []string{"Authorization"},
+	}
+
+	s, err := NewServer(NewServerOpts{Config: cfg})
+	require.NoError(t, err)
+
+	preflight := func(origin string, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodOptions, "/healthz", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", "authorization")
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Allowed origin", func(t *testing.T) {
+		rec := preflight("https://status.example.com", http.MethodGet)
+		assert.Equal(t, "https://status.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET", rec.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/healthz", nil)
+		req.Header.Set("Origin", "https://status.example.com")
+		rec = httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "https://status.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Origin not allowed", func(t *testing.T) {
+		rec := preflight("https://evil.example.com", http.MethodGet)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Method not allowed", func(t *testing.T) {
+		rec := preflight("https://status.example.com", http.MethodPut)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestServerBasePath(t *testing.T) {
+	cfg := config.GetDefaultConfig()
+	cfg.Server.BasePath = "/ddup"
+
+	s, err := NewServer(NewServerOpts{Config: cfg})
+	require.NoError(t, err)
+
+	doRequest := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, doRequest("/ddup/healthz").Code)
+	assert.Equal(t, http.StatusNotFound, doRequest("/healthz").Code)
+
+	// The index page includes the base path
+	rec := doRequest("/ddup/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	// The OpenAPI document has the base path as the server URL
+	rec = doRequest("/ddup/api/openapi.json")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"servers":[{"url":"/ddup"}]`)
+}
+
+func TestRewriteIndexHTML(t *testing.T) {
+	index := `<!doctype html><html><head><script type="module" crossorigin src="/assets/index.js"></script><link rel="stylesheet" crossorigin href="/assets/index.css"></head><body><a href="https://example.com/">x</a></body></html>`
+	res := rewriteIndexHTML([]byte(index), "/ddup")
+	assert.Equal(t, `<!doctype html><html><head><script type="module" crossorigin src="/ddup/assets/index.js"></script><link rel="stylesheet" crossorigin href="/ddup/assets/index.css"><meta name="ddup-base-path" content="/ddup"></head><body><a href="https://example.com/">x</a></body></html>`, string(res))
+}
+
+func TestListenAll(t *testing.T) {
+	t.Run("One listener for each address", func(t *testing.T) {
+		listeners, err := listenAll([]string{"127.0.0.1", "127.0.0.2"}, 0)
+		require.NoError(t, err)
+		require.Len(t, listeners, 2)
+		defer func() {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+		}()
+
+		assert.True(t, strings.HasPrefix(listeners[0].Addr().String(), "127.0.0.1:"))
+		assert.True(t, strings.HasPrefix(listeners[1].Addr().String(), "127.0.0.2:"))
+	})
+
+	t.Run("Listeners are closed on failure", func(t *testing.T) {
+		// Find a free port, then make the second address fail
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := l.Addr().(*net.TCPAddr).Port
+		require.NoError(t, l.Close())
+
+		_, err = listenAll([]string{"127.0.0.1", "not-an-address.invalid"}, port)
+		require.ErrorContains(t, err, "failed to create TCP listener on 'not-an-address.invalid'")
+
+		// The first listener was closed, so the port can be used again
+		l, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		require.NoError(t, err)
+		_ = l.Close()
+	})
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"fmt"
+	"html"
 	"io/fs"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/italypaleale/ddup/dashboard"
@@ -14,7 +16,7 @@ import (
 // Copyright (c) 2024, Elias Schneider
 // License: BSD 2-Clause (https://github.com/pocket-id/pocket-id/tree/v1.11.2/LICENSE)
 
-func registerStatic(mux *http.ServeMux) error {
+func registerStatic(mux *http.ServeMux, basePath string, middlewares ...Middleware) error {
 	distFS, err := fs.Sub(dashboard.DashboardFS, "dist")
 	if err != nil {
 		return fmt.Errorf("failed to create sub FS: %w", err)
@@ -23,14 +25,36 @@ func registerStatic(mux *http.ServeMux) error {
 	cacheMaxAge := time.Hour * 24
 	fileServer := NewCachingFileServer(http.FS(distFS), int(cacheMaxAge.Seconds()))
 
-	mux.Handle("GET /", fileServer)
+	// When served under a base path, the paths in the index page are rewritten
+	if basePath != "" {
+		index, err := fs.ReadFile(distFS, "index.html")
+		if err != nil {
+			return fmt.Errorf("failed to read index page: %w", err)
+		}
+		fileServer.index = rewriteIndexHTML(index, basePath)
+	}
+
+	mux.Handle("GET /", Use(fileServer, middlewares...))
 
 	return nil
 }
 
+// rewriteIndexHTML adds the base path to the absolute paths of the assets in the index page
+// The base path is also included in a meta tag, which the dashboard reads to call the API.
+func rewriteIndexHTML(index []byte, basePath string) []byte {
+	replacer := strings.NewReplacer(
+		` src="/`, ` src="`+basePath+`/`,
+		` href="/`, ` href="`+basePath+`/`,
+		`</head>`, `<meta name="ddup-base-path" content="`+html.EscapeString(basePath)+`"></head>`,
+	)
+	return []byte(replacer.Replace(string(index)))
+}
+
 // CachingFileServer wraps http.FileServer to add caching headers
 type CachingFileServer struct {
-	root                    http.FileSystem
+	root http.FileSystem
+	// If set, served instead of the index.html file for the root path
+	index                   []byte
 	lastModified            time.Time
 	cacheMaxAge             int
 	lastModifiedHeaderValue string
@@ -61,5 +85,11 @@ func (f *CachingFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Last-Modified", f.lastModifiedHeaderValue)
 	w.Header().Set("Cache-Control", f.cacheControlHeaderValue)
 
+	if f.index != nil && r.URL.Path == "/" {
+		w.Header().Set(headerContentType, "text/html; charset=utf-8")
+		_, _ = w.Write(f.index)
+		return
+	}
+
 	http.FileServer(f.root).ServeHTTP(w, r)
 }
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+// Header with the number of domains that match the filters, before pagination
+const headerTotalCount = "X-Total-Count"
+
+// Sort orders for the list of domains; each one can be prefixed with "-" to sort in descending order
+// Ties are broken by the record name
+var statusListSorts = map[string]func(a, b statusListItem) int{
+	"name": func(a, b statusListItem) int {
+		return cmp.Compare(a.name, b.name)
+	},
+	"provider": func(a, b statusListItem) int {
+		return cmp.Compare(a.status.Provider, b.status.Provider)
+	},
+	"lastUpdated": func(a, b statusListItem) int {
+		return a.status.LastUpdated.Compare(b.status.LastUpdated)
+	},
+	"healthy": func(a, b statusListItem) int {
+		return cmp.Compare(countHealthyEndpoints(a.status), countHealthyEndpoints(b.status))
+	},
+}
+
+// statusListItem is the status of a domain in the list, with its record name
+type statusListItem struct {
+	name   string
+	status healthcheck.DomainStatus
+}
+
+// statusListQuery contains the options for listing the status of domains, parsed from the query string
+type statusListQuery struct {
+	// If not empty, only domains using this provider are returned
+	provider string
+	// If not nil, only domains that have (or don't have) healthy endpoints are returned
+	healthy *bool
+	// If not empty, only domains whose record name matches this glob pattern are returned
+	name string
+	// Sort order, as a key of statusListSorts
+	sort string
+	// If true, the sort order is descending
+	desc bool
+	// Maximum number of domains to return; 0 means no limit
+	limit int
+	// Number of domains to skip
+	offset int
+}
+
+// parseStatusListQuery parses the query string of requests to list the status of domains
+func parseStatusListQuery(r *http.Request) (q statusListQuery, apiErr *apiError) {
+	values := r.URL.Query()
+
+	q.provider = values.Get("provider")
+
+	if v := values.Get("healthy"); v != "" {
+		healthy, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, errStatusHealthyInvalid
+		}
+		q.healthy = &healthy
+	}
+
+	q.name = values.Get("name")
+	if q.name != "" {
+		_, err := path.Match(q.name, "")
+		if err != nil {
+			return q, errStatusNameInvalid
+		}
+	}
+
+	q.sort = "name"
+	if v := values.Get("sort"); v != "" {
+		q.sort, q.desc = strings.CutPrefix(v, "-")
+		if statusListSorts[q.sort] == nil {
+			return q, errStatusSortInvalid
+		}
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return q, errStatusLimitInvalid
+		}
+		q.limit = limit
+	}
+
+	if v := values.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return q, errStatusOffsetInvalid
+		}
+		q.offset = offset
+	}
+
+	return q, nil
+}
+
+// match returns true if the domain matches the filters in the query
+func (q statusListQuery) match(name string, status healthcheck.DomainStatus) bool {
+	if q.provider != "" && status.Provider != q.provider {
+		return false
+	}
+	if q.healthy != nil && (countHealthyEndpoints(status) > 0) != *q.healthy {
+		return false
+	}
+	if q.name != "" {
+		// The pattern was validated when parsing the query
+		ok, _ := path.Match(q.name, name)
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the domains that match the filters, sorted and paginated, and the number of domains that match the filters
+func (q statusListQuery) apply(all map[string]healthcheck.DomainStatus) ([]statusListItem, int) {
+	items := make([]statusListItem, 0, len(all))
+	for name, status := range all {
+		if q.match(name, status) {
+			items = append(items, statusListItem{name: name, status: status})
+		}
+	}
+	total := len(items)
+
+	sortFn := statusListSorts[q.sort]
+	slices.SortFunc(items, func(a, b statusListItem) int {
+		res := sortFn(a, b)
+		if q.desc {
+			res = -res
+		}
+		if res == 0 {
+			res = cmp.Compare(a.name, b.name)
+		}
+		return res
+	})
+
+	items = items[min(q.offset, len(items)):]
+	if q.limit > 0 && len(items) > q.limit {
+		items = items[:q.limit]
+	}
+
+	return items, total
+}
+
+// countHealthyEndpoints returns the number of healthy endpoints of the domain
+func countHealthyEndpoints(status healthcheck.DomainStatus) int {
+	var n int
+	for _, ep := range status.Endpoints {
+		if ep.Healthy {
+			n++
+		}
+	}
+	return n
+}
+
+// statusListResponse is the response with the status of domains, keyed by record name
+// It is a JSON object whose keys are in the order of the list, rather than sorted alphabetically like maps
+type statusListResponse []statusListItem
+
+// MarshalJSON implements json.Marshaler
+func (l statusListResponse) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	buf.WriteByte('{')
+	for i, item := range l {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		err := enc.Encode(item.name)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		err = enc.Encode(item.status)
+		if err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// handleStatusList is the handler for the route that returns the status of all domains
+// Domains can be filtered, sorted, and paginated with the parameters in the query string
+func (s *Server) handleStatusList(w http.ResponseWriter, r *http.Request) {
+	q, apiErr := parseStatusListQuery(r)
+	if apiErr != nil {
+		apiErr.WriteResponse(r.Context(), w)
+		return
+	}
+
+	items, total := q.apply(s.hc.GetAllDomainsStatus())
+
+	w.Header().Set(headerTotalCount, strconv.Itoa(total))
+	respondWithJSON(r.Context(), w, statusListResponse(items))
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/italypaleale/ddup/pkg/healthcheck"
+)
+
+func TestHandleStatusList(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	hc := &mockStatusProvider{
+		status: map[string]healthcheck.DomainStatus{
+			"app.example.com": {
+				Provider:    "cf",
+				LastUpdated: now.Add(2 * time.Minute),
+				Endpoints: []healthcheck.DomainStatusEndpoint{
+					{IP: "10.0.0.1", Healthy: true},
+					{IP: "10.0.0.2", Healthy: true},
+				},
+			},
+			"api.example.com": {
+				Provider:    "exec",
+				LastUpdated: now.Add(1 * time.Minute),
+				Endpoints: []healthcheck.DomainStatusEndpoint{
+					{IP: "10.0.0.3", Healthy: true},
+					{IP: "10.0.0.4", Healthy: false},
+				},
+			},
+			"down.example.org": {
+				Provider:    "cf",
+				LastUpdated: now.Add(3 * time.Minute),
+				Endpoints: []healthcheck.DomainStatusEndpoint{
+					{IP: "10.0.0.5", Healthy: false},
+				},
+			},
+		},
+	}
+	s := &Server{hc: hc}
+
+	// Returns the record names in the response, in order, and the total count
+	doRequest := func(t *testing.T, query string) ([]string, string) {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status"+query, nil)
+		rec := httptest.NewRecorder()
+		s.handleStatusList(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		// The response must be a valid object of domain statuses
+		var res map[string]healthcheck.DomainStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+
+		// Read the keys in order
+		dec := json.NewDecoder(rec.Body)
+		_, err := dec.Token()
+		require.NoError(t, err)
+		var names []string
+		for dec.More() {
+			tok, err := dec.Token()
+			require.NoError(t, err)
+			names = append(names, tok.(string))
+			var status healthcheck.DomainStatus
+			require.NoError(t, dec.Decode(&status))
+			assert.Equal(t, hc.status[tok.(string)], status)
+		}
+		return names, rec.Header().Get(headerTotalCount)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantNames []string
+		wantTotal string
+	}{
+		{name: "All domains", query: "", wantNames: []string{"api.example.com", "app.example.com", "down.example.org"}, wantTotal: "3"},
+		{name: "Filter by provider", query: "?provider=cf", wantNames: []string{"app.example.com", "down.example.org"}, wantTotal: "2"},
+		{name: "Healthy only", query: "?healthy=true", wantNames: []string{"api.example.com", "app.example.com"}, wantTotal: "2"},
+		{name: "Unhealthy only", query: "?healthy=false", wantNames: []string{"down.example.org"}, wantTotal: "1"},
+		{name: "Name glob", query: "?name=*.example.com", wantNames: []string{"api.example.com", "app.example.com"}, wantTotal: "2"},
+		{name: "No matches", query: "?provider=cf&name=api.*", wantNames: nil, wantTotal: "0"},
+		{name: "Sort by name descending", query: "?sort=-name", wantNames: []string{"down.example.org", "app.example.com", "api.example.com"}, wantTotal: "3"},
+		{name: "Sort by provider", query: "?sort=provider", wantNames: []string{"app.example.com", "down.example.org", "api.example.com"}, wantTotal: "3"},
+		{name: "Sort by last updated descending", query: "?sort=-lastUpdated", wantNames: []string{"down.example.org", "app.example.com", "api.example.com"}, wantTotal: "3"},
+		{name: "Sort by healthy endpoints", query: "?sort=healthy", wantNames: []string{"down.example.org", "api.example.com", "app.example.com"}, wantTotal: "3"},
+		{name: "Limit", query: "?limit=2", wantNames: []string{"api.example.com", "app.example.com"}, wantTotal: "3"},
+		{name: "Limit and offset", query: "?sort=-name&limit=2&offset=1", wantNames: []string{"app.example.com", "api.example.com"}, wantTotal: "3"},
+		{name: "Offset past the end", query: "?offset=10", wantNames: nil, wantTotal: "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, total := doRequest(t, tt.query)
+			assert.Equal(t, tt.wantNames, names)
+			assert.Equal(t, tt.wantTotal, total)
+		})
+	}
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		invalid := map[string]*apiError{
+			"?healthy=maybe": errStatusHealthyInvalid,
+			"?name=[":        errStatusNameInvalid,
+			"?sort=ip":       errStatusSortInvalid,
+			"?limit=0":       errStatusLimitInvalid,
+			"?limit=abc":     errStatusLimitInvalid,
+			"?offset=-1":     errStatusOffsetInvalid,
+		}
+		for query, wantErr := range invalid {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/api/status"+query, nil)
+			rec := httptest.NewRecorder()
+			s.handleStatusList(rec, req)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+			assert.Contains(t, rec.Body.String(), wantErr.Code, query)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+// Package servicerunner contains utilities for the services that ddup runs in background with the service runner.
+package servicerunner
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/italypaleale/go-kit/servicerunner"
+
+	"github.com/italypaleale/ddup/pkg/logging"
+	appmetrics "github.com/italypaleale/ddup/pkg/metrics"
+)
+
+// RestartOptions contains the options for WithRestart
+type RestartOptions struct {
+	// Delay before the first restart, which is doubled after every restart
+	// +default 1s
+	InitialBackoff time.Duration
+	// Maximum delay between restarts
+	// The delay is reset to InitialBackoff if the service ran for longer than this before failing.
+	// +default 1m
+	MaxBackoff time.Duration
+	// Metrics, which can be nil
+	Metrics *appmetrics.AppMetrics
+}
+
+// WithRestart returns a service that runs the given service, and restarts it with exponential backoff when it returns an error or panics
+// This way, a failing service doesn't stop the other services that are running with the service runner.
+// The returned service stops when the context is canceled, or when the service returns without an error.
+func WithRestart(name string, service servicerunner.Service, opts RestartOptions) servicerunner.Service {
+	initialBackoff := cmp.Or(opts.InitialBackoff, time.Second)
+	maxBackoff := max(cmp.Or(opts.MaxBackoff, time.Minute), initialBackoff)
+
+	return func(ctx context.Context) error {
+		log := logger().With(slog.String("service", name))
+
+		backoff := initialBackoff
+		for {
+			start := time.Now()
+			err := runService(ctx, service)
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+
+			// If the service ran for long enough, it's not failing repeatedly, so the backoff is reset
+			if time.Since(start) > maxBackoff {
+				backoff = initialBackoff
+			}
+
+			log.ErrorContext(ctx, "Service failed; restarting it",
+				slog.Any("error", err),
+				slog.Duration("delay", backoff),
+			)
+			opts.Metrics.RecordServiceRestart(name)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}
+}
+
+// runService runs the service, returning an error if it panics
+// Errors caused by the context being canceled are ignored, like the service runner does
+func runService(ctx context.Context, service servicerunner.Service) (err error) {
+	defer func() {
+		p := recover()
+		if p != nil {
+			err = fmt.Errorf("service panicked: %v", p)
+		}
+	}()
+
+	err = service(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// logger returns the logger for the service runner
+func logger() *slog.Logger {
+	return logging.Component("servicerunner")
+}
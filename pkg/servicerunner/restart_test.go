@@ -0,0 +1,96 @@
+package servicerunner
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRestart(t *testing.T) {
+	opts := RestartOptions{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+	}
+
+	t.Run("Failing service is restarted", func(t *testing.T) {
+		var runs atomic.Int32
+		service := WithRestart("test", func(ctx context.Context) error {
+			// Fail twice, then run until the context is canceled
+			if runs.Add(1) <= 2 {
+				return errors.New("simulated failure")
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}, opts)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error, 1)
+		go func() {
+			done <- service(ctx)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return runs.Load() == 3
+		}, 5*time.Second, time.Millisecond)
+
+		cancel()
+		require.NoError(t, <-done)
+		assert.Equal(t, int32(3), runs.Load())
+	})
+
+	t.Run("Panics are recovered", func(t *testing.T) {
+		var runs atomic.Int32
+		service := WithRestart("test", func(ctx context.Context) error {
+			if runs.Add(1) == 1 {
+				panic("simulated panic")
+			}
+			return nil
+		}, opts)
+
+		require.NoError(t, service(t.Context()))
+		assert.Equal(t, int32(2), runs.Load())
+	})
+
+	t.Run("Service that returns without an error is not restarted", func(t *testing.T) {
+		var runs atomic.Int32
+		service := WithRestart("test", func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}, opts)
+
+		require.NoError(t, service(t.Context()))
+		assert.Equal(t, int32(1), runs.Load())
+	})
+
+	t.Run("Context canceled during backoff", func(t *testing.T) {
+		var runs atomic.Int32
+		service := WithRestart("test", func(ctx context.Context) error {
+			runs.Add(1)
+			return errors.New("simulated failure")
+		}, RestartOptions{InitialBackoff: time.Hour})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error, 1)
+		go func() {
+			done <- service(ctx)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return runs.Load() == 1
+		}, 5*time.Second, time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("service did not stop after the context was canceled")
+		}
+		assert.Equal(t, int32(1), runs.Load())
+	})
+}
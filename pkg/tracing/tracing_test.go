@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkTrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTransport(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdkTrace.NewTracerProvider(sdkTrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewHTTPClient()
+
+	t.Run("Propagates context", func(t *testing.T) {
+		ctx, parent := Tracer().Start(t.Context(), "parent")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/ok?token=secret", nil)
+		require.NoError(t, err)
+
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		parent.End()
+
+		// The original request is not modified
+		assert.Empty(t, req.Header.Get("traceparent"))
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+		span := spans[0]
+		assert.Equal(t, "HTTP GET", span.Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+		assert.Contains(t, traceparent, span.SpanContext().SpanID().String())
+		for _, attr := range span.Attributes() {
+			assert.NotContains(t, attr.Value.Emit(), "secret")
+		}
+	})
+
+	t.Run("Error status", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/fail", nil)
+		require.NoError(t, err)
+
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		spans := recorder.Ended()
+		assert.Equal(t, codes.Error, spans[len(spans)-1].Status().Code)
+	})
+
+	t.Run("EndSpan records errors", func(t *testing.T) {
+		_, span := Tracer().Start(t.Context(), "failing")
+		EndSpan(span, errors.New("boom"))
+
+		spans := recorder.Ended()
+		last := spans[len(spans)-1]
+		assert.Equal(t, "failing", last.Name())
+		assert.Equal(t, codes.Error, last.Status().Code)
+		assert.Equal(t, "boom", last.Status().Description)
+	})
+}